@@ -0,0 +1,242 @@
+package inspect
+
+import (
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"go.step.sm/crypto/x509util"
+)
+
+// ASN1Node is the representation of a DER-encoded ASN.1 value. Constructed
+// values, and bit strings or octet strings encapsulating other DER-encoded
+// values, will have the list of children.
+type ASN1Node struct {
+	Type     string    `json:"type"`
+	Value    string    `json:"value,omitempty"`
+	Children ASN1Nodes `json:"children,omitempty"`
+}
+
+// ASN1Nodes is a list of ASN.1 nodes.
+type ASN1Nodes []*ASN1Node
+
+// ParseASN1 parses the given DER data and returns the list of ASN.1 values
+// found on it.
+func ParseASN1(der []byte) (ASN1Nodes, error) {
+	return parseASN1(der, 0)
+}
+
+// maxASN1Depth is the maximum number of nested values supported by
+// ParseASN1.
+const maxASN1Depth = 32
+
+var asn1TypeNames = map[int]string{
+	asn1.TagBoolean:         "BOOLEAN",
+	asn1.TagInteger:         "INTEGER",
+	asn1.TagBitString:       "BIT STRING",
+	asn1.TagOctetString:     "OCTET STRING",
+	asn1.TagNull:            "NULL",
+	asn1.TagOID:             "OBJECT IDENTIFIER",
+	asn1.TagEnum:            "ENUMERATED",
+	asn1.TagUTF8String:      "UTF8String",
+	asn1.TagSequence:        "SEQUENCE",
+	asn1.TagSet:             "SET",
+	asn1.TagNumericString:   "NumericString",
+	asn1.TagPrintableString: "PrintableString",
+	asn1.TagT61String:       "T61String",
+	asn1.TagIA5String:       "IA5String",
+	asn1.TagUTCTime:         "UTCTime",
+	asn1.TagGeneralizedTime: "GeneralizedTime",
+	asn1.TagGeneralString:   "GeneralString",
+	26:                      "VisibleString",
+	30:                      "BMPString",
+}
+
+func parseASN1(der []byte, depth int) (ASN1Nodes, error) {
+	if depth > maxASN1Depth {
+		return nil, errors.New("asn1: maximum depth exceeded")
+	}
+
+	var nodes ASN1Nodes
+	for len(der) > 0 {
+		var raw asn1.RawValue
+		rest, err := asn1.Unmarshal(der, &raw)
+		if err != nil {
+			return nil, err
+		}
+		node, err := newASN1Node(raw, depth)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+		der = rest
+	}
+	return nodes, nil
+}
+
+func newASN1Node(raw asn1.RawValue, depth int) (*ASN1Node, error) {
+	node := new(ASN1Node)
+	switch raw.Class {
+	case asn1.ClassUniversal:
+		if s, ok := asn1TypeNames[raw.Tag]; ok {
+			node.Type = s
+		} else {
+			node.Type = fmt.Sprintf("UNIVERSAL %d", raw.Tag)
+		}
+	case asn1.ClassApplication:
+		node.Type = fmt.Sprintf("[APPLICATION %d]", raw.Tag)
+	case asn1.ClassContextSpecific:
+		node.Type = fmt.Sprintf("[%d]", raw.Tag)
+	default:
+		node.Type = fmt.Sprintf("[PRIVATE %d]", raw.Tag)
+	}
+
+	if raw.IsCompound {
+		children, err := parseASN1(raw.Bytes, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = children
+		return node, nil
+	}
+
+	if raw.Class != asn1.ClassUniversal {
+		node.Value = hexString(raw.Bytes)
+		return node, nil
+	}
+
+	switch raw.Tag {
+	case asn1.TagBoolean:
+		var b bool
+		if _, err := asn1.Unmarshal(raw.FullBytes, &b); err != nil {
+			return nil, err
+		}
+		node.Value = fmt.Sprint(b)
+	case asn1.TagInteger, asn1.TagEnum:
+		// Enumerated values are encoded as integers.
+		b := append([]byte{}, raw.FullBytes...)
+		b[0] = asn1.TagInteger
+		var v *big.Int
+		if _, err := asn1.Unmarshal(b, &v); err != nil {
+			return nil, err
+		}
+		if v.BitLen() > 64 {
+			node.Value = hexString(raw.Bytes)
+		} else {
+			node.Value = v.String()
+		}
+	case asn1.TagOID:
+		var oid asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(raw.FullBytes, &oid); err != nil {
+			return nil, err
+		}
+		node.Value = oidString(oid)
+	case asn1.TagNull:
+	case asn1.TagBitString, asn1.TagOctetString:
+		data := raw.Bytes
+		if raw.Tag == asn1.TagBitString {
+			if len(data) == 0 {
+				return nil, errors.New("asn1: invalid bit string")
+			}
+			// Only bit strings without padding can encapsulate other values.
+			if data[0] != 0 {
+				node.Value = hexString(data)
+				return node, nil
+			}
+			data = data[1:]
+		}
+		if isEncapsulated(data) {
+			if children, err := parseASN1(data, depth+1); err == nil {
+				node.Children = children
+				return node, nil
+			}
+		}
+		node.Value = hexString(data)
+	case asn1.TagUTF8String, asn1.TagPrintableString, asn1.TagIA5String,
+		asn1.TagNumericString, asn1.TagT61String, asn1.TagGeneralString,
+		asn1.TagUTCTime, asn1.TagGeneralizedTime, 26:
+		node.Value = string(raw.Bytes)
+	case 30:
+		s, err := decodeBMPString(raw.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		node.Value = s
+	default:
+		node.Value = hexString(raw.Bytes)
+	}
+	return node, nil
+}
+
+// isEncapsulated returns true if the given data looks like a DER-encoded
+// sequence or set.
+func isEncapsulated(data []byte) bool {
+	return len(data) > 1 && (data[0] == 0x30 || data[0] == 0x31)
+}
+
+// decodeBMPString decodes the UTF-16 big endian string used by the ASN.1
+// BMPString type.
+func decodeBMPString(b []byte) (string, error) {
+	if len(b)%2 != 0 {
+		return "", errors.New("asn1: invalid BMPString")
+	}
+	s := make([]uint16, 0, len(b)/2)
+	for i := 0; i < len(b); i += 2 {
+		s = append(s, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(s)), nil
+}
+
+// displayText returns the string value of the ASN.1 string types used in
+// different structures.
+func displayText(raw asn1.RawValue) (string, error) {
+	if raw.Class != asn1.ClassUniversal {
+		return "", errors.New("asn1: invalid string class")
+	}
+	switch raw.Tag {
+	case asn1.TagUTF8String, asn1.TagPrintableString, asn1.TagIA5String,
+		asn1.TagNumericString, asn1.TagT61String, 26:
+		if !utf8.Valid(raw.Bytes) {
+			return "", errors.New("asn1: invalid string")
+		}
+		return string(raw.Bytes), nil
+	case 30:
+		return decodeBMPString(raw.Bytes)
+	default:
+		return "", fmt.Errorf("asn1: invalid string tag %d", raw.Tag)
+	}
+}
+
+// oidString returns the string representation of an object identifier,
+// including its name if it's known.
+func oidString(oid asn1.ObjectIdentifier) string {
+	if name := x509util.OIDName(oid); name != "" {
+		return name + " (" + oid.String() + ")"
+	}
+	return oid.String()
+}
+
+// Text returns the text representation of the ASN.1 values.
+func (nodes ASN1Nodes) Text() string {
+	w := new(textWriter)
+	nodes.writeText(w, 0)
+	return w.String()
+}
+
+func (nodes ASN1Nodes) writeText(w *textWriter, indent int) {
+	for _, n := range nodes {
+		n.writeText(w, indent)
+	}
+}
+
+func (n *ASN1Node) writeText(w *textWriter, indent int) {
+	if n.Value != "" {
+		w.line(indent, "%s %s", n.Type, n.Value)
+	} else {
+		w.line(indent, n.Type)
+	}
+	n.Children.writeText(w, indent+1)
+}
@@ -0,0 +1,82 @@
+package inspect
+
+import (
+	"encoding/asn1"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseASN1(t *testing.T) {
+	bigNumber, ok := new(big.Int).SetString("123456789012345678901234567890", 10)
+	require.True(t, ok)
+
+	tests := []struct {
+		name    string
+		der     []byte
+		want    ASN1Nodes
+		wantErr bool
+	}{
+		{"ok sequence", mustMarshal(t, struct {
+			A bool
+			B int
+			C *big.Int
+			D string `asn1:"utf8"`
+			E string `asn1:"ia5"`
+			F asn1.Enumerated
+		}{true, -10, bigNumber, "café", "ia5", 3}), ASN1Nodes{
+			{Type: "SEQUENCE", Children: ASN1Nodes{
+				{Type: "BOOLEAN", Value: "true"},
+				{Type: "INTEGER", Value: "-10"},
+				{Type: "INTEGER", Value: "01:8e:e9:0f:f6:c3:73:e0:ee:4e:3f:0a:d2"},
+				{Type: "UTF8String", Value: "café"},
+				{Type: "IA5String", Value: "ia5"},
+				{Type: "ENUMERATED", Value: "3"},
+			}},
+		}, false},
+		{"ok encapsulated", mustMarshal(t, mustMarshal(t, []int{1})), ASN1Nodes{
+			{Type: "OCTET STRING", Children: ASN1Nodes{
+				{Type: "SEQUENCE", Children: ASN1Nodes{{Type: "INTEGER", Value: "1"}}},
+			}},
+		}, false},
+		{"ok bit string", mustMarshal(t, asn1.BitString{Bytes: []byte{0x80}, BitLength: 1}), ASN1Nodes{
+			{Type: "BIT STRING", Value: "07:80"},
+		}, false},
+		{"ok context specific", []byte{0x80, 0x02, 0x01, 0x02, 0xa1, 0x03, 0x02, 0x01, 0x05}, ASN1Nodes{
+			{Type: "[0]", Value: "01:02"},
+			{Type: "[1]", Children: ASN1Nodes{{Type: "INTEGER", Value: "5"}}},
+		}, false},
+		{"ok bmpString", []byte{0x1e, 0x04, 0x00, 0x68, 0x00, 0x69}, ASN1Nodes{
+			{Type: "BMPString", Value: "hi"},
+		}, false},
+		{"ok null", []byte{0x05, 0x00}, ASN1Nodes{{Type: "NULL"}}, false},
+		{"fail truncated", []byte{0x30, 0x03, 0x02}, nil, true},
+		{"fail bmpString", []byte{0x1e, 0x01, 0x00}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseASN1(tt.der)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestASN1Nodes_Text(t *testing.T) {
+	nodes, err := ParseASN1(mustMarshal(t, struct {
+		OID  asn1.ObjectIdentifier
+		Rest []string
+	}{asn1.ObjectIdentifier{2, 5, 4, 3}, []string{"foo"}}))
+	require.NoError(t, err)
+	assert.Equal(t, `SEQUENCE
+    OBJECT IDENTIFIER commonName (2.5.4.3)
+    SEQUENCE
+        PrintableString foo
+`, nodes.Text())
+}
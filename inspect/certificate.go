@@ -0,0 +1,117 @@
+package inspect
+
+import (
+	"crypto/x509"
+	"math/big"
+
+	"go.step.sm/crypto/x509util"
+)
+
+// Certificate is the representation of an X.509 certificate.
+type Certificate struct {
+	Version            int                 `json:"version"`
+	SerialNumber       string              `json:"serialNumber"`
+	SignatureAlgorithm string              `json:"signatureAlgorithm"`
+	Issuer             Name                `json:"issuer"`
+	Validity           Validity            `json:"validity"`
+	Subject            Name                `json:"subject"`
+	PublicKey          PublicKey           `json:"publicKey"`
+	Extensions         []Extension         `json:"extensions,omitempty"`
+	TPMHardwareDetails *TPMHardwareDetails `json:"tpmHardwareDetails,omitempty"`
+	Signature          Signature           `json:"signature"`
+	Fingerprint        string              `json:"fingerprint"`
+}
+
+// TPMHardwareDetails contains the TPM manufacturer, model and version encoded
+// in the subject alternative name of TPM attestation certificates.
+type TPMHardwareDetails struct {
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Model        string `json:"model,omitempty"`
+	Version      string `json:"version,omitempty"`
+}
+
+// NewCertificate returns the representation of the given certificate. Values
+// that cannot be decoded will be represented using their ASN.1 or hex
+// representations.
+func NewCertificate(cert *x509.Certificate) *Certificate {
+	c := &Certificate{
+		Version:            cert.Version,
+		SerialNumber:       serialNumberString(cert.SerialNumber),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		Issuer:             newNameFromRaw(cert.RawIssuer),
+		Validity: Validity{
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+		},
+		Subject:     newNameFromRaw(cert.RawSubject),
+		PublicKey:   newPublicKey(cert.PublicKey),
+		Extensions:  newExtensions(cert.Extensions),
+		Signature:   newSignature(cert.SignatureAlgorithm, cert.Signature),
+		Fingerprint: x509util.Fingerprint(cert),
+	}
+	if sans, err := x509util.ParseSubjectAlternativeNames(cert); err == nil {
+		if d := sans.TPMHardwareDetails; d.Manufacturer != "" || d.Model != "" || d.Version != "" {
+			c.TPMHardwareDetails = &TPMHardwareDetails{
+				Manufacturer: d.Manufacturer,
+				Model:        d.Model,
+				Version:      d.Version,
+			}
+		}
+	}
+	return c
+}
+
+// Text returns the text representation of the certificate.
+func (c *Certificate) Text() string {
+	w := new(textWriter)
+	w.line(0, "Certificate:")
+	w.line(1, "Data:")
+	w.line(2, "Version: %d (0x%x)", c.Version, c.Version-1)
+	writeSerialNumberText(w, 2, c.SerialNumber)
+	w.line(2, "Signature Algorithm: %s", c.SignatureAlgorithm)
+	w.line(2, "Issuer: %s", c.Issuer.DN)
+	w.line(2, "Validity")
+	w.line(3, "Not Before: %s", c.Validity.NotBefore.UTC().Format(timeLayout))
+	w.line(3, "Not After : %s", c.Validity.NotAfter.UTC().Format(timeLayout))
+	w.line(2, "Subject: %s", c.Subject.DN)
+	w.line(2, "Subject Public Key Info:")
+	c.PublicKey.writeText(w, 3)
+	writeExtensionsText(w, 2, "X509v3 extensions:", c.Extensions)
+	if d := c.TPMHardwareDetails; d != nil {
+		w.line(2, "TPM Hardware Details:")
+		w.line(3, "Manufacturer: %s", d.Manufacturer)
+		w.line(3, "Model: %s", d.Model)
+		w.line(3, "Version: %s", d.Version)
+	}
+	c.Signature.writeText(w, 1)
+	w.line(1, "Fingerprint (SHA-256): %s", c.Fingerprint)
+	return w.String()
+}
+
+// serialNumberString returns the decimal representation of a serial number.
+func serialNumberString(sn *big.Int) string {
+	if sn == nil {
+		return ""
+	}
+	return sn.String()
+}
+
+// writeSerialNumberText writes the decimal serial number using the OpenSSL
+// format, small numbers are written in decimal and hex, large numbers only in
+// hex.
+func writeSerialNumberText(w *textWriter, indent int, s string) {
+	sn, ok := new(big.Int).SetString(s, 10)
+	switch {
+	case !ok:
+		w.line(indent, "Serial Number: %s", s)
+	case sn.Sign() >= 0 && sn.IsInt64():
+		w.line(indent, "Serial Number: %d (0x%x)", sn.Int64(), sn.Int64())
+	default:
+		w.line(indent, "Serial Number:")
+		prefix := ""
+		if sn.Sign() < 0 {
+			prefix = "(Negative)"
+		}
+		w.line(indent+1, prefix+hexString(new(big.Int).Abs(sn).Bytes()))
+	}
+}
@@ -0,0 +1,117 @@
+package inspect
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+)
+
+// CertificateRequest is the representation of an X.509 certificate request.
+type CertificateRequest struct {
+	Version    int                    `json:"version"`
+	Subject    Name                   `json:"subject"`
+	PublicKey  PublicKey              `json:"publicKey"`
+	Attributes []CertificateAttribute `json:"attributes,omitempty"`
+	Extensions []Extension            `json:"extensions,omitempty"`
+	Signature  Signature              `json:"signature"`
+}
+
+// CertificateAttribute is the representation of an attribute in a certificate
+// request. The values that are strings will be represented as a string, the
+// rest will use the ASN.1 representation.
+type CertificateAttribute struct {
+	ID     string        `json:"id"`
+	Name   string        `json:"name,omitempty"`
+	Values []interface{} `json:"values"`
+}
+
+// oidExtensionRequest is the attribute used to encode the extensions in the
+// certificate request, the extensions are represented separately.
+var oidExtensionRequest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}
+
+// NewCertificateRequest returns the representation of the given certificate
+// request. Values that cannot be decoded will be represented using their ASN.1
+// or hex representations.
+func NewCertificateRequest(cr *x509.CertificateRequest) *CertificateRequest {
+	return &CertificateRequest{
+		Version:    cr.Version,
+		Subject:    newNameFromRaw(cr.RawSubject),
+		PublicKey:  newPublicKey(cr.PublicKey),
+		Attributes: parseCertificateAttributes(cr.RawTBSCertificateRequest),
+		Extensions: newExtensions(cr.Extensions),
+		Signature:  newSignature(cr.SignatureAlgorithm, cr.Signature),
+	}
+}
+
+func parseCertificateAttributes(tbs []byte) []CertificateAttribute {
+	var v struct {
+		Version    int
+		Subject    asn1.RawValue
+		PublicKey  asn1.RawValue
+		Attributes []struct {
+			Type   asn1.ObjectIdentifier
+			Values []asn1.RawValue `asn1:"set"`
+		} `asn1:"tag:0"`
+	}
+	if err := unmarshal(tbs, &v); err != nil {
+		return nil
+	}
+
+	var attrs []CertificateAttribute
+	for _, attr := range v.Attributes {
+		if attr.Type.Equal(oidExtensionRequest) {
+			continue
+		}
+		ca := CertificateAttribute{
+			ID:     attr.Type.String(),
+			Name:   shortAttributeName(attr.Type),
+			Values: []interface{}{},
+		}
+		if ca.Name == ca.ID {
+			ca.Name = ""
+		}
+		for _, value := range attr.Values {
+			if s, err := displayText(value); err == nil {
+				ca.Values = append(ca.Values, s)
+			} else if nodes, err := ParseASN1(value.FullBytes); err == nil {
+				ca.Values = append(ca.Values, nodes)
+			} else {
+				ca.Values = append(ca.Values, HexValue(hexString(value.FullBytes)))
+			}
+		}
+		attrs = append(attrs, ca)
+	}
+	return attrs
+}
+
+// Text returns the text representation of the certificate request.
+func (cr *CertificateRequest) Text() string {
+	w := new(textWriter)
+	w.line(0, "Certificate Request:")
+	w.line(1, "Data:")
+	w.line(2, "Version: %d (0x%x)", cr.Version+1, cr.Version)
+	w.line(2, "Subject: %s", cr.Subject.DN)
+	w.line(2, "Subject Public Key Info:")
+	cr.PublicKey.writeText(w, 3)
+	w.line(2, "Attributes:")
+	if len(cr.Attributes) == 0 && len(cr.Extensions) == 0 {
+		w.line(3, "(none)")
+	}
+	for _, attr := range cr.Attributes {
+		name := attr.Name
+		if name == "" {
+			name = attr.ID
+		}
+		w.line(3, "%s:", name)
+		for _, value := range attr.Values {
+			switch v := value.(type) {
+			case string:
+				w.line(4, v)
+			case textValue:
+				v.writeText(w, 4)
+			}
+		}
+	}
+	writeExtensionsText(w, 3, "Requested Extensions:", cr.Extensions)
+	cr.Signature.writeText(w, 1)
+	return w.String()
+}
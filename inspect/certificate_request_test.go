@@ -0,0 +1,74 @@
+package inspect
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCertificateRequest(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "test.smallstep.com"},
+		DNSNames: []string{"test.smallstep.com"},
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	require.NoError(t, err)
+	cr, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+
+	got := NewCertificateRequest(cr)
+	assert.Equal(t, 0, got.Version)
+	assert.Equal(t, "CN=test.smallstep.com", got.Subject.DN)
+	assert.Equal(t, "ECDSA", got.PublicKey.Algorithm)
+	assert.Equal(t, "ECDSA-SHA256", got.Signature.Algorithm)
+	assert.Empty(t, got.Attributes)
+	require.Len(t, got.Extensions, 1)
+	assert.Equal(t, GeneralNames{{Type: "dns", Value: "test.smallstep.com"}}, got.Extensions[0].Value)
+
+	text := got.Text()
+	assert.Contains(t, text, "Certificate Request:\n    Data:\n        Version: 1 (0x0)\n        Subject: CN=test.smallstep.com\n")
+	assert.Contains(t, text, "        Attributes:\n            Requested Extensions:\n                Subject Alternative Name:\n                    DNS:test.smallstep.com\n")
+}
+
+func Test_parseCertificateAttributes(t *testing.T) {
+	type attribute struct {
+		Type   asn1.ObjectIdentifier
+		Values []asn1.RawValue `asn1:"set"`
+	}
+	tbs := mustMarshal(t, struct {
+		Version    int
+		Subject    asn1.RawValue
+		PublicKey  asn1.RawValue
+		Attributes []attribute `asn1:"tag:0"`
+	}{
+		Subject:   asn1.RawValue{FullBytes: mustMarshal(t, pkix.RDNSequence{})},
+		PublicKey: asn1.RawValue{FullBytes: mustMarshal(t, []int{1})},
+		Attributes: []attribute{
+			{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}, []asn1.RawValue{
+				{Tag: asn1.TagPrintableString, Bytes: []byte("password")},
+			}},
+			{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}, []asn1.RawValue{
+				{FullBytes: mustMarshal(t, []pkix.Extension{})},
+			}},
+			{asn1.ObjectIdentifier{1, 2, 3, 4}, []asn1.RawValue{
+				{FullBytes: mustMarshal(t, 10)},
+			}},
+		},
+	})
+
+	assert.Equal(t, []CertificateAttribute{
+		{ID: "1.2.840.113549.1.9.7", Name: "challengePassword", Values: []interface{}{"password"}},
+		{ID: "1.2.3.4", Values: []interface{}{ASN1Nodes{{Type: "INTEGER", Value: "10"}}}},
+	}, parseCertificateAttributes(tbs))
+	assert.Nil(t, parseCertificateAttributes([]byte{0x30, 0x00}))
+}
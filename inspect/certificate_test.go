@@ -0,0 +1,180 @@
+package inspect
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/x509util"
+)
+
+func createCertificate(t *testing.T, template *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) *x509.Certificate {
+	t.Helper()
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	b, err := asn1.Marshal(v)
+	require.NoError(t, err)
+	return b
+}
+
+func TestNewCertificate(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	sans := []x509util.SubjectAlternativeName{
+		{Type: x509util.DNSType, Value: "test.smallstep.com"},
+		{Type: x509util.IPType, Value: "127.0.0.1"},
+		{Type: x509util.PermanentIdentifierType, Value: "ek-1234"},
+		{Type: x509util.DirectoryNameType, ASN1Value: []byte(`{"extraNames": [
+			{"type": "2.23.133.2.1", "value": "id:53544D20"},
+			{"type": "2.23.133.2.2", "value": "ST33HTPHAHD4"},
+			{"type": "2.23.133.2.3", "value": "id:00010102"}
+		]}`)},
+	}
+	var rawValues []asn1.RawValue
+	for _, san := range sans {
+		rv, err := san.RawValue()
+		require.NoError(t, err)
+		rawValues = append(rawValues, rv)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1234),
+		Subject:               pkix.Name{CommonName: "Test Certificate", Organization: []string{"Smallstep"}},
+		NotBefore:             now,
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		SubjectKeyId:          []byte{1, 2, 3, 4},
+		OCSPServer:            []string{"http://ocsp.smallstep.com"},
+		IssuingCertificateURL: []string{"http://ca.smallstep.com/ca.crt"},
+		CRLDistributionPoints: []string{"http://ca.smallstep.com/ca.crl"},
+		PolicyIdentifiers:     []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 1}},
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{2, 5, 29, 17}, Value: mustMarshal(t, rawValues)},
+			{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: mustMarshal(t, []string{"foo", "bar"})},
+		},
+	}
+
+	cert := createCertificate(t, template, pub, priv)
+	got := NewCertificate(cert)
+
+	assert.Equal(t, 3, got.Version)
+	assert.Equal(t, "1234", got.SerialNumber)
+	assert.Equal(t, "Ed25519", got.SignatureAlgorithm)
+	assert.Equal(t, "O=Smallstep, CN=Test Certificate", got.Subject.DN)
+	assert.Equal(t, got.Subject, got.Issuer)
+	assert.Equal(t, "Ed25519", got.PublicKey.Algorithm)
+	assert.Equal(t, x509util.Fingerprint(cert), got.Fingerprint)
+	assert.Equal(t, &TPMHardwareDetails{
+		Manufacturer: "id:53544D20",
+		Model:        "ST33HTPHAHD4",
+		Version:      "id:00010102",
+	}, got.TPMHardwareDetails)
+
+	values := map[string]interface{}{}
+	for _, ext := range got.Extensions {
+		values[ext.ID] = ext.Value
+	}
+	assert.Equal(t, KeyUsage{"Digital Signature"}, values["2.5.29.15"])
+	assert.Equal(t, ExtKeyUsage{
+		"Server Authentication (1.3.6.1.5.5.7.3.1)",
+		"Client Authentication (1.3.6.1.5.5.7.3.2)",
+	}, values["2.5.29.37"])
+	assert.Equal(t, &BasicConstraints{CA: false}, values["2.5.29.19"])
+	assert.Equal(t, HexValue("01:02:03:04"), values["2.5.29.14"])
+	assert.Equal(t, AccessDescriptions{
+		{Method: "OCSP (1.3.6.1.5.5.7.48.1)", Location: GeneralName{Type: "uri", Value: "http://ocsp.smallstep.com"}},
+		{Method: "CA Issuers (1.3.6.1.5.5.7.48.2)", Location: GeneralName{Type: "uri", Value: "http://ca.smallstep.com/ca.crt"}},
+	}, values["1.3.6.1.5.5.7.1.1"])
+	assert.Equal(t, DistributionPoints{
+		{FullName: GeneralNames{{Type: "uri", Value: "http://ca.smallstep.com/ca.crl"}}},
+	}, values["2.5.29.31"])
+	assert.Equal(t, CertificatePolicies{
+		{Policy: "CA/B Forum Domain Validated (2.23.140.1.2.1)"},
+	}, values["2.5.29.32"])
+	assert.Equal(t, GeneralNames{
+		{Type: "dns", Value: "test.smallstep.com"},
+		{Type: "ip", Value: "127.0.0.1"},
+		{Type: "permanentIdentifier", Value: "ek-1234"},
+		{Type: "dn", Value: "TPM Manufacturer=id:53544D20, TPM Model=ST33HTPHAHD4, TPM Version=id:00010102"},
+	}, values["2.5.29.17"])
+	assert.Equal(t, ASN1Nodes{
+		{Type: "SEQUENCE", Children: ASN1Nodes{
+			{Type: "PrintableString", Value: "foo"},
+			{Type: "PrintableString", Value: "bar"},
+		}},
+	}, values["1.2.3.4"])
+
+	text := got.Text()
+	for _, s := range []string{
+		"Certificate:\n    Data:\n        Version: 3 (0x2)\n        Serial Number: 1234 (0x4d2)\n",
+		"        Validity\n            Not Before: Jan  2 03:04:05 2024 UTC\n            Not After : Jan  3 03:04:05 2024 UTC\n",
+		"            Public Key Algorithm: Ed25519\n                Public-Key: (256 bit)\n",
+		"            Key Usage: critical\n                Digital Signature\n",
+		"            Subject Alternative Name:\n                DNS:test.smallstep.com\n                IP Address:127.0.0.1\n                Permanent Identifier:ek-1234\n",
+		"            Authority Information Access:\n                OCSP (1.3.6.1.5.5.7.48.1) - URI:http://ocsp.smallstep.com\n",
+		"            1.2.3.4:\n                SEQUENCE\n                    PrintableString foo\n                    PrintableString bar\n",
+		"        TPM Hardware Details:\n            Manufacturer: id:53544D20\n            Model: ST33HTPHAHD4\n            Version: id:00010102\n",
+		"    Signature Algorithm: Ed25519\n    Signature Value:\n",
+		"    Fingerprint (SHA-256): " + got.Fingerprint + "\n",
+	} {
+		assert.Contains(t, text, s)
+	}
+
+	b, err := json.Marshal(got)
+	require.NoError(t, err)
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &m))
+	assert.Equal(t, "1234", m["serialNumber"])
+	assert.Equal(t, map[string]interface{}{
+		"manufacturer": "id:53544D20",
+		"model":        "ST33HTPHAHD4",
+		"version":      "id:00010102",
+	}, m["tpmHardwareDetails"])
+}
+
+func TestNewCertificate_publicKeys(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: new(big.Int).Lsh(big.NewInt(1), 100),
+		Subject:      pkix.Name{CommonName: "Test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("::1")},
+	}
+	cert := createCertificate(t, template, ecKey.Public(), ecKey)
+	got := NewCertificate(cert)
+
+	assert.Equal(t, "ECDSA", got.PublicKey.Algorithm)
+	assert.Equal(t, "P-256", got.PublicKey.Curve)
+	assert.Equal(t, 256, got.PublicKey.Size)
+	assert.Equal(t, "ECDSA-SHA256", got.SignatureAlgorithm)
+	assert.Nil(t, got.TPMHardwareDetails)
+	assert.Contains(t, got.Text(), "        Serial Number:\n            10:00:00:00:00:00:00:00:00:00:00:00:00\n")
+	assert.Contains(t, got.Text(), "                Curve: P-256\n")
+}
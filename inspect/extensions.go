@@ -0,0 +1,1180 @@
+package inspect
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+
+	"go.step.sm/crypto/x509util"
+)
+
+// Extension is the representation of an X.509 extension. The value will be
+// one of the types defined in this package for the known extensions, the
+// ASN1Nodes with the parsed value for unknown extensions, or the HexValue of
+// the raw value if it cannot be parsed.
+type Extension struct {
+	ID       string      `json:"id"`
+	Name     string      `json:"name,omitempty"`
+	Critical bool        `json:"critical"`
+	Value    interface{} `json:"value,omitempty"`
+}
+
+// textValue is the interface implemented by the values of the extensions.
+type textValue interface {
+	writeText(w *textWriter, indent int)
+}
+
+type extensionDecoder func(der []byte) (textValue, error)
+
+var extensionDecoders = map[string]extensionDecoder{
+	"2.5.29.14":               decodeSubjectKeyID,
+	"2.5.29.15":               decodeKeyUsage,
+	"2.5.29.17":               decodeGeneralNamesExtension,
+	"2.5.29.18":               decodeGeneralNamesExtension,
+	"2.5.29.19":               decodeBasicConstraints,
+	"2.5.29.20":               decodeInteger,
+	"2.5.29.21":               decodeReasonCode,
+	"2.5.29.24":               decodeInvalidityDate,
+	"2.5.29.27":               decodeInteger,
+	"2.5.29.29":               decodeGeneralNamesExtension,
+	"2.5.29.30":               decodeNameConstraints,
+	"2.5.29.31":               decodeDistributionPoints,
+	"2.5.29.32":               decodeCertificatePolicies,
+	"2.5.29.33":               decodePolicyMappings,
+	"2.5.29.35":               decodeAuthorityKeyID,
+	"2.5.29.36":               decodePolicyConstraints,
+	"2.5.29.37":               decodeExtKeyUsage,
+	"2.5.29.46":               decodeDistributionPoints,
+	"2.5.29.54":               decodeInhibitAnyPolicy,
+	"1.3.6.1.5.5.7.1.1":       decodeAccessDescriptions,
+	"1.3.6.1.5.5.7.1.11":      decodeAccessDescriptions,
+	"1.3.6.1.5.5.7.1.24":      decodeTLSFeatures,
+	"1.3.6.1.4.1.11129.2.4.2": decodeSignedCertificateTimestamps,
+	"2.23.133.6.1.1":          decodeSubjectKeyAttestationEvidence,
+}
+
+func newExtension(ext pkix.Extension) Extension {
+	return Extension{
+		ID:       ext.Id.String(),
+		Name:     x509util.OIDName(ext.Id),
+		Critical: ext.Critical,
+		Value:    decodeExtension(ext),
+	}
+}
+
+func newExtensions(exts []pkix.Extension) []Extension {
+	if len(exts) == 0 {
+		return nil
+	}
+	ret := make([]Extension, len(exts))
+	for i, ext := range exts {
+		ret[i] = newExtension(ext)
+	}
+	return ret
+}
+
+// decodeExtension decodes the value of the extension. If the extension is not
+// known or it cannot be decoded, it will return the ASN.1 representation of
+// it or the hex value.
+func decodeExtension(ext pkix.Extension) textValue {
+	if fn, ok := extensionDecoders[ext.Id.String()]; ok {
+		if v, err := fn(ext.Value); err == nil {
+			return v
+		}
+	}
+	if nodes, err := ParseASN1(ext.Value); err == nil {
+		return nodes
+	}
+	return HexValue(hexString(ext.Value))
+}
+
+func (e Extension) writeText(w *textWriter, indent int) {
+	name := e.Name
+	if name == "" {
+		name = e.ID
+	}
+	if e.Critical {
+		w.line(indent, "%s: critical", name)
+	} else {
+		w.line(indent, "%s:", name)
+	}
+	if v, ok := e.Value.(textValue); ok {
+		v.writeText(w, indent+1)
+	}
+}
+
+func writeExtensionsText(w *textWriter, indent int, title string, exts []Extension) {
+	if len(exts) == 0 {
+		return
+	}
+	w.line(indent, title)
+	for _, e := range exts {
+		e.writeText(w, indent+1)
+	}
+}
+
+// unmarshal parses the DER-encoded data into v and fails if there's trailing
+// data.
+func unmarshal(der []byte, v interface{}, params ...string) error {
+	rest, err := asn1.UnmarshalWithParams(der, v, strings.Join(params, ","))
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errors.New("asn1: trailing data")
+	}
+	return nil
+}
+
+// HexValue is the colon separated hex representation of some bytes.
+type HexValue string
+
+func (v HexValue) writeText(w *textWriter, indent int) {
+	w.hex(indent, string(v))
+}
+
+func decodeSubjectKeyID(der []byte) (textValue, error) {
+	var keyID []byte
+	if err := unmarshal(der, &keyID); err != nil {
+		return nil, err
+	}
+	return HexValue(hexString(keyID)), nil
+}
+
+// AuthorityKeyIdentifier is the representation of the authority key
+// identifier extension.
+type AuthorityKeyIdentifier struct {
+	KeyID        string       `json:"keyID,omitempty"`
+	Issuer       GeneralNames `json:"issuer,omitempty"`
+	SerialNumber string       `json:"serialNumber,omitempty"`
+}
+
+func decodeAuthorityKeyID(der []byte) (textValue, error) {
+	var v struct {
+		KeyID        []byte        `asn1:"optional,tag:0"`
+		Issuer       asn1.RawValue `asn1:"optional,tag:1"`
+		SerialNumber *big.Int      `asn1:"optional,tag:2"`
+	}
+	if err := unmarshal(der, &v); err != nil {
+		return nil, err
+	}
+	akid := &AuthorityKeyIdentifier{
+		KeyID: hexString(v.KeyID),
+	}
+	if len(v.Issuer.Bytes) > 0 {
+		names, err := parseGeneralNames(v.Issuer.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		akid.Issuer = names
+	}
+	if v.SerialNumber != nil {
+		akid.SerialNumber = hexString(v.SerialNumber.Bytes())
+	}
+	return akid, nil
+}
+
+func (v *AuthorityKeyIdentifier) writeText(w *textWriter, indent int) {
+	if v.KeyID != "" {
+		w.line(indent, "keyid:%s", v.KeyID)
+	}
+	for _, n := range v.Issuer {
+		w.line(indent, n.String())
+	}
+	if v.SerialNumber != "" {
+		w.line(indent, "serial:%s", v.SerialNumber)
+	}
+}
+
+// KeyUsage is the list of key usages in the key usage extension.
+type KeyUsage []string
+
+var keyUsageNames = []string{
+	"Digital Signature", "Content Commitment", "Key Encipherment",
+	"Data Encipherment", "Key Agreement", "Certificate Sign", "CRL Sign",
+	"Encipher Only", "Decipher Only",
+}
+
+func decodeKeyUsage(der []byte) (textValue, error) {
+	var bits asn1.BitString
+	if err := unmarshal(der, &bits); err != nil {
+		return nil, err
+	}
+	return KeyUsage(bitNames(bits, keyUsageNames)), nil
+}
+
+func (v KeyUsage) writeText(w *textWriter, indent int) {
+	w.line(indent, strings.Join(v, ", "))
+}
+
+// bitNames returns the names of the bits set in the given bit string.
+func bitNames(bits asn1.BitString, names []string) []string {
+	ret := []string{}
+	for i := 0; i < bits.BitLength; i++ {
+		if bits.At(i) == 0 {
+			continue
+		}
+		if i < len(names) {
+			ret = append(ret, names[i])
+		} else {
+			ret = append(ret, fmt.Sprintf("Unknown (%d)", i))
+		}
+	}
+	return ret
+}
+
+// ExtKeyUsage is the list of extended key usages in the extended key usage
+// extension.
+type ExtKeyUsage []string
+
+func decodeExtKeyUsage(der []byte) (textValue, error) {
+	var oids []asn1.ObjectIdentifier
+	if err := unmarshal(der, &oids); err != nil {
+		return nil, err
+	}
+	ret := make(ExtKeyUsage, len(oids))
+	for i, oid := range oids {
+		ret[i] = oidString(oid)
+	}
+	return ret, nil
+}
+
+func (v ExtKeyUsage) writeText(w *textWriter, indent int) {
+	w.line(indent, strings.Join(v, ", "))
+}
+
+// BasicConstraints is the representation of the basic constraints extension.
+type BasicConstraints struct {
+	CA         bool `json:"ca"`
+	MaxPathLen *int `json:"maxPathLen,omitempty"`
+}
+
+func decodeBasicConstraints(der []byte) (textValue, error) {
+	var v struct {
+		CA         bool `asn1:"optional"`
+		MaxPathLen int  `asn1:"optional,default:-1"`
+	}
+	if err := unmarshal(der, &v); err != nil {
+		return nil, err
+	}
+	bc := &BasicConstraints{CA: v.CA}
+	if v.MaxPathLen >= 0 {
+		bc.MaxPathLen = &v.MaxPathLen
+	}
+	return bc, nil
+}
+
+func (v *BasicConstraints) writeText(w *textWriter, indent int) {
+	s := "CA:FALSE"
+	if v.CA {
+		s = "CA:TRUE"
+	}
+	if v.MaxPathLen != nil {
+		s += ", pathlen:" + strconv.Itoa(*v.MaxPathLen)
+	}
+	w.line(indent, s)
+}
+
+// GeneralName is the representation of a GeneralName. The type will be one of
+// the name types defined in x509util, or the object identifier for unknown
+// otherName types.
+type GeneralName struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+var generalNameLabels = map[string]string{
+	x509util.EmailType:               "email",
+	x509util.DNSType:                 "DNS",
+	x509util.X400AddressType:         "X400Name",
+	x509util.DirectoryNameType:       "DirName",
+	x509util.EDIPartyNameType:        "EdiPartyName",
+	x509util.URIType:                 "URI",
+	x509util.IPType:                  "IP Address",
+	x509util.RegisteredIDType:        "Registered ID",
+	x509util.PermanentIdentifierType: "Permanent Identifier",
+	x509util.HardwareModuleNameType:  "Hardware Module Name",
+	x509util.UserPrincipalNameType:   "UPN",
+}
+
+// String returns the text representation of the general name.
+func (n GeneralName) String() string {
+	if label, ok := generalNameLabels[n.Type]; ok {
+		return label + ":" + n.Value
+	}
+	if oid, err := parseOID(n.Type); err == nil {
+		return "othername:" + oidString(oid) + ":" + n.Value
+	}
+	return n.Type + ":" + n.Value
+}
+
+// GeneralNames is a list of general names.
+type GeneralNames []GeneralName
+
+func (v GeneralNames) writeText(w *textWriter, indent int) {
+	for _, n := range v {
+		w.line(indent, n.String())
+	}
+}
+
+func decodeGeneralNamesExtension(der []byte) (textValue, error) {
+	var seq asn1.RawValue
+	if err := unmarshal(der, &seq); err != nil {
+		return nil, err
+	}
+	if seq.Class != asn1.ClassUniversal || seq.Tag != asn1.TagSequence {
+		return nil, errors.New("invalid general names")
+	}
+	return parseGeneralNames(seq.Bytes)
+}
+
+// parseGeneralNames parses a list of concatenated general names.
+func parseGeneralNames(der []byte) (GeneralNames, error) {
+	var names GeneralNames
+	for len(der) > 0 {
+		var raw asn1.RawValue
+		rest, err := asn1.Unmarshal(der, &raw)
+		if err != nil {
+			return nil, err
+		}
+		name, err := parseGeneralName(raw)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		der = rest
+	}
+	return names, nil
+}
+
+func parseGeneralName(raw asn1.RawValue) (GeneralName, error) {
+	if raw.Class != asn1.ClassContextSpecific {
+		return GeneralName{}, errors.New("invalid general name class")
+	}
+	switch raw.Tag {
+	case 0:
+		return parseOtherName(raw)
+	case 1:
+		return GeneralName{Type: x509util.EmailType, Value: string(raw.Bytes)}, nil
+	case 2:
+		return GeneralName{Type: x509util.DNSType, Value: string(raw.Bytes)}, nil
+	case 3:
+		return GeneralName{Type: x509util.X400AddressType, Value: hexString(raw.Bytes)}, nil
+	case 4:
+		return GeneralName{Type: x509util.DirectoryNameType, Value: newNameFromRaw(raw.Bytes).DN}, nil
+	case 5:
+		return GeneralName{Type: x509util.EDIPartyNameType, Value: hexString(raw.Bytes)}, nil
+	case 6:
+		return GeneralName{Type: x509util.URIType, Value: string(raw.Bytes)}, nil
+	case 7:
+		switch len(raw.Bytes) {
+		case net.IPv4len, net.IPv6len:
+			return GeneralName{Type: x509util.IPType, Value: net.IP(raw.Bytes).String()}, nil
+		case 2 * net.IPv4len, 2 * net.IPv6len:
+			// IP ranges are used in name constraints.
+			n := len(raw.Bytes) / 2
+			ipNet := &net.IPNet{IP: raw.Bytes[:n], Mask: raw.Bytes[n:]}
+			if _, bits := ipNet.Mask.Size(); bits == 0 {
+				return GeneralName{Type: x509util.IPType, Value: ipNet.IP.String() + "/" + hexString(ipNet.Mask)}, nil
+			}
+			return GeneralName{Type: x509util.IPType, Value: ipNet.String()}, nil
+		default:
+			return GeneralName{}, errors.New("invalid ip address")
+		}
+	case 8:
+		var oid asn1.ObjectIdentifier
+		if err := unmarshal(raw.FullBytes, &oid, "tag:8"); err != nil {
+			return GeneralName{}, err
+		}
+		return GeneralName{Type: x509util.RegisteredIDType, Value: oidString(oid)}, nil
+	default:
+		return GeneralName{}, fmt.Errorf("invalid general name tag %d", raw.Tag)
+	}
+}
+
+// parseOtherName parses an otherName general name using the x509util parser,
+// so all the types supported by x509util are properly decoded.
+func parseOtherName(raw asn1.RawValue) (GeneralName, error) {
+	der, err := asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassUniversal,
+		Tag:        asn1.TagSequence,
+		IsCompound: true,
+		Bytes:      raw.FullBytes,
+	})
+	if err != nil {
+		return GeneralName{}, err
+	}
+	sans, err := x509util.ParseSubjectAlternativeNameExtension(der)
+	if err != nil {
+		return GeneralName{}, err
+	}
+	if len(sans) != 1 {
+		return GeneralName{}, errors.New("invalid otherName")
+	}
+
+	san := sans[0]
+	switch san.Type {
+	case x509util.PermanentIdentifierType:
+		var v x509util.PermanentIdentifier
+		if err := json.Unmarshal(san.ASN1Value, &v); err != nil {
+			return GeneralName{}, err
+		}
+		value := v.Identifier
+		if len(v.Assigner) > 0 {
+			value += ", assigner:" + oidString(asn1.ObjectIdentifier(v.Assigner))
+		}
+		return GeneralName{Type: san.Type, Value: value}, nil
+	case x509util.HardwareModuleNameType:
+		var v x509util.HardwareModuleName
+		if err := json.Unmarshal(san.ASN1Value, &v); err != nil {
+			return GeneralName{}, err
+		}
+		return GeneralName{
+			Type:  san.Type,
+			Value: fmt.Sprintf("type:%s, serialNumber:%s", oidString(asn1.ObjectIdentifier(v.Type)), hexString(v.SerialNumber)),
+		}, nil
+	default:
+		return GeneralName{Type: san.Type, Value: san.Value}, nil
+	}
+}
+
+// parseOID parses the string representation of an object identifier.
+func parseOID(s string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return nil, errors.New("invalid object identifier")
+	}
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, errors.New("invalid object identifier")
+		}
+		oid[i] = n
+	}
+	return oid, nil
+}
+
+// DistributionPoint is the representation of a distribution point in the CRL
+// distribution points and freshest CRL extensions.
+type DistributionPoint struct {
+	FullName     GeneralNames `json:"fullName,omitempty"`
+	RelativeName string       `json:"relativeName,omitempty"`
+	Reasons      []string     `json:"reasons,omitempty"`
+	CRLIssuer    GeneralNames `json:"crlIssuer,omitempty"`
+}
+
+// DistributionPoints is the list of distribution points in the CRL
+// distribution points and freshest CRL extensions.
+type DistributionPoints []DistributionPoint
+
+var reasonFlagNames = []string{
+	"Unused", "Key Compromise", "CA Compromise", "Affiliation Changed",
+	"Superseded", "Cessation Of Operation", "Certificate Hold",
+	"Privilege Withdrawn", "AA Compromise",
+}
+
+func decodeDistributionPoints(der []byte) (textValue, error) {
+	var dps []struct {
+		DistributionPoint asn1.RawValue  `asn1:"optional,tag:0"`
+		Reasons           asn1.BitString `asn1:"optional,tag:1"`
+		CRLIssuer         asn1.RawValue  `asn1:"optional,tag:2"`
+	}
+	if err := unmarshal(der, &dps); err != nil {
+		return nil, err
+	}
+
+	ret := make(DistributionPoints, len(dps))
+	for i, dp := range dps {
+		if len(dp.DistributionPoint.Bytes) > 0 {
+			var name asn1.RawValue
+			if err := unmarshal(dp.DistributionPoint.Bytes, &name); err != nil {
+				return nil, err
+			}
+			switch {
+			case name.Class == asn1.ClassContextSpecific && name.Tag == 0:
+				names, err := parseGeneralNames(name.Bytes)
+				if err != nil {
+					return nil, err
+				}
+				ret[i].FullName = names
+			case name.Class == asn1.ClassContextSpecific && name.Tag == 1:
+				var rdn pkix.RelativeDistinguishedNameSET
+				if err := unmarshal(name.FullBytes, &rdn, "set,tag:1"); err != nil {
+					return nil, err
+				}
+				ret[i].RelativeName = newName(pkix.RDNSequence{rdn}).DN
+			default:
+				return nil, errors.New("invalid distribution point name")
+			}
+		}
+		if dp.Reasons.BitLength > 0 {
+			ret[i].Reasons = bitNames(dp.Reasons, reasonFlagNames)
+		}
+		if len(dp.CRLIssuer.Bytes) > 0 {
+			names, err := parseGeneralNames(dp.CRLIssuer.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			ret[i].CRLIssuer = names
+		}
+	}
+	return ret, nil
+}
+
+func (v DistributionPoints) writeText(w *textWriter, indent int) {
+	for _, dp := range v {
+		if len(dp.FullName) > 0 {
+			w.line(indent, "Full Name:")
+			dp.FullName.writeText(w, indent+1)
+		}
+		if dp.RelativeName != "" {
+			w.line(indent, "Relative Name: %s", dp.RelativeName)
+		}
+		if len(dp.Reasons) > 0 {
+			w.line(indent, "Reasons: %s", strings.Join(dp.Reasons, ", "))
+		}
+		if len(dp.CRLIssuer) > 0 {
+			w.line(indent, "CRL Issuer:")
+			dp.CRLIssuer.writeText(w, indent+1)
+		}
+	}
+}
+
+// AccessDescription is the representation of an access description in the
+// authority and subject information access extensions.
+type AccessDescription struct {
+	Method   string      `json:"method"`
+	Location GeneralName `json:"location"`
+}
+
+// AccessDescriptions is the list of access descriptions in the authority and
+// subject information access extensions.
+type AccessDescriptions []AccessDescription
+
+type accessDescription struct {
+	Method   asn1.ObjectIdentifier
+	Location asn1.RawValue
+}
+
+func decodeAccessDescriptions(der []byte) (textValue, error) {
+	var ads []accessDescription
+	if err := unmarshal(der, &ads); err != nil {
+		return nil, err
+	}
+	return newAccessDescriptions(ads)
+}
+
+func newAccessDescriptions(ads []accessDescription) (AccessDescriptions, error) {
+	ret := make(AccessDescriptions, len(ads))
+	for i, ad := range ads {
+		name, err := parseGeneralName(ad.Location)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = AccessDescription{
+			Method:   oidString(ad.Method),
+			Location: name,
+		}
+	}
+	return ret, nil
+}
+
+func (v AccessDescriptions) writeText(w *textWriter, indent int) {
+	for _, ad := range v {
+		w.line(indent, "%s - %s", ad.Method, ad.Location)
+	}
+}
+
+// PolicyInformation is the representation of a policy in the certificate
+// policies extension.
+type PolicyInformation struct {
+	Policy     string            `json:"policy"`
+	Qualifiers []PolicyQualifier `json:"qualifiers,omitempty"`
+}
+
+// PolicyQualifier is the representation of a policy qualifier. Only one of
+// CPS or UserNotice will be set for the known qualifiers, the rest will use
+// Value.
+type PolicyQualifier struct {
+	Qualifier  string      `json:"qualifier"`
+	CPS        string      `json:"cps,omitempty"`
+	UserNotice *UserNotice `json:"userNotice,omitempty"`
+	Value      ASN1Nodes   `json:"value,omitempty"`
+}
+
+// UserNotice is the representation of the user notice policy qualifier.
+type UserNotice struct {
+	Organization  string `json:"organization,omitempty"`
+	NoticeNumbers []int  `json:"noticeNumbers,omitempty"`
+	ExplicitText  string `json:"explicitText,omitempty"`
+}
+
+// CertificatePolicies is the list of policies in the certificate policies
+// extension.
+type CertificatePolicies []PolicyInformation
+
+var (
+	oidQualifierCPS        = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 1}
+	oidQualifierUserNotice = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 2}
+)
+
+func decodeCertificatePolicies(der []byte) (textValue, error) {
+	var policies []struct {
+		Policy     asn1.ObjectIdentifier
+		Qualifiers []struct {
+			ID        asn1.ObjectIdentifier
+			Qualifier asn1.RawValue
+		} `asn1:"optional"`
+	}
+	if err := unmarshal(der, &policies); err != nil {
+		return nil, err
+	}
+
+	ret := make(CertificatePolicies, len(policies))
+	for i, p := range policies {
+		ret[i].Policy = oidString(p.Policy)
+		for _, q := range p.Qualifiers {
+			pq := PolicyQualifier{Qualifier: oidString(q.ID)}
+			switch {
+			case q.ID.Equal(oidQualifierCPS):
+				s, err := displayText(q.Qualifier)
+				if err != nil {
+					return nil, err
+				}
+				pq.CPS = s
+			case q.ID.Equal(oidQualifierUserNotice):
+				un, err := parseUserNotice(q.Qualifier.FullBytes)
+				if err != nil {
+					return nil, err
+				}
+				pq.UserNotice = un
+			default:
+				nodes, err := ParseASN1(q.Qualifier.FullBytes)
+				if err != nil {
+					return nil, err
+				}
+				pq.Value = nodes
+			}
+			ret[i].Qualifiers = append(ret[i].Qualifiers, pq)
+		}
+	}
+	return ret, nil
+}
+
+func parseUserNotice(der []byte) (*UserNotice, error) {
+	var elems []asn1.RawValue
+	if err := unmarshal(der, &elems); err != nil {
+		return nil, err
+	}
+
+	un := new(UserNotice)
+	for _, e := range elems {
+		// The noticeRef is the only sequence, any other value must be the
+		// explicit text.
+		if e.Class == asn1.ClassUniversal && e.Tag == asn1.TagSequence {
+			var ref struct {
+				Organization  asn1.RawValue
+				NoticeNumbers []int
+			}
+			if err := unmarshal(e.FullBytes, &ref); err != nil {
+				return nil, err
+			}
+			s, err := displayText(ref.Organization)
+			if err != nil {
+				return nil, err
+			}
+			un.Organization = s
+			un.NoticeNumbers = ref.NoticeNumbers
+			continue
+		}
+		s, err := displayText(e)
+		if err != nil {
+			return nil, err
+		}
+		un.ExplicitText = s
+	}
+	return un, nil
+}
+
+func (v CertificatePolicies) writeText(w *textWriter, indent int) {
+	for _, p := range v {
+		w.line(indent, "Policy: %s", p.Policy)
+		for _, q := range p.Qualifiers {
+			switch {
+			case q.CPS != "":
+				w.line(indent+1, "CPS: %s", q.CPS)
+			case q.UserNotice != nil:
+				w.line(indent+1, "User Notice:")
+				if q.UserNotice.Organization != "" {
+					w.line(indent+2, "Organization: %s", q.UserNotice.Organization)
+				}
+				if len(q.UserNotice.NoticeNumbers) > 0 {
+					numbers := make([]string, len(q.UserNotice.NoticeNumbers))
+					for i, n := range q.UserNotice.NoticeNumbers {
+						numbers[i] = strconv.Itoa(n)
+					}
+					w.line(indent+2, "Numbers: %s", strings.Join(numbers, ", "))
+				}
+				if q.UserNotice.ExplicitText != "" {
+					w.line(indent+2, "Explicit Text: %s", q.UserNotice.ExplicitText)
+				}
+			default:
+				w.line(indent+1, "%s:", q.Qualifier)
+				q.Value.writeText(w, indent+2)
+			}
+		}
+	}
+}
+
+// NameConstraints is the representation of the name constraints extension.
+type NameConstraints struct {
+	Permitted GeneralNames `json:"permitted,omitempty"`
+	Excluded  GeneralNames `json:"excluded,omitempty"`
+}
+
+func decodeNameConstraints(der []byte) (textValue, error) {
+	var v struct {
+		Permitted []asn1.RawValue `asn1:"optional,tag:0"`
+		Excluded  []asn1.RawValue `asn1:"optional,tag:1"`
+	}
+	if err := unmarshal(der, &v); err != nil {
+		return nil, err
+	}
+
+	parseSubtrees := func(subtrees []asn1.RawValue) (GeneralNames, error) {
+		var names GeneralNames
+		for _, st := range subtrees {
+			var subtree struct {
+				Base asn1.RawValue
+				Min  int `asn1:"optional,tag:0"`
+				Max  int `asn1:"optional,tag:1"`
+			}
+			if err := unmarshal(st.FullBytes, &subtree); err != nil {
+				return nil, err
+			}
+			name, err := parseGeneralName(subtree.Base)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, name)
+		}
+		return names, nil
+	}
+
+	var (
+		nc  NameConstraints
+		err error
+	)
+	if nc.Permitted, err = parseSubtrees(v.Permitted); err != nil {
+		return nil, err
+	}
+	if nc.Excluded, err = parseSubtrees(v.Excluded); err != nil {
+		return nil, err
+	}
+	return &nc, nil
+}
+
+func (v *NameConstraints) writeText(w *textWriter, indent int) {
+	if len(v.Permitted) > 0 {
+		w.line(indent, "Permitted:")
+		v.Permitted.writeText(w, indent+1)
+	}
+	if len(v.Excluded) > 0 {
+		w.line(indent, "Excluded:")
+		v.Excluded.writeText(w, indent+1)
+	}
+}
+
+// PolicyMapping is the representation of a mapping in the policy mappings
+// extension.
+type PolicyMapping struct {
+	IssuerDomainPolicy  string `json:"issuerDomainPolicy"`
+	SubjectDomainPolicy string `json:"subjectDomainPolicy"`
+}
+
+// PolicyMappings is the list of mappings in the policy mappings extension.
+type PolicyMappings []PolicyMapping
+
+func decodePolicyMappings(der []byte) (textValue, error) {
+	var mappings []struct {
+		IssuerDomainPolicy  asn1.ObjectIdentifier
+		SubjectDomainPolicy asn1.ObjectIdentifier
+	}
+	if err := unmarshal(der, &mappings); err != nil {
+		return nil, err
+	}
+	ret := make(PolicyMappings, len(mappings))
+	for i, m := range mappings {
+		ret[i] = PolicyMapping{
+			IssuerDomainPolicy:  oidString(m.IssuerDomainPolicy),
+			SubjectDomainPolicy: oidString(m.SubjectDomainPolicy),
+		}
+	}
+	return ret, nil
+}
+
+func (v PolicyMappings) writeText(w *textWriter, indent int) {
+	for _, m := range v {
+		w.line(indent, "%s => %s", m.IssuerDomainPolicy, m.SubjectDomainPolicy)
+	}
+}
+
+// PolicyConstraints is the representation of the policy constraints
+// extension.
+type PolicyConstraints struct {
+	RequireExplicitPolicy *int `json:"requireExplicitPolicy,omitempty"`
+	InhibitPolicyMapping  *int `json:"inhibitPolicyMapping,omitempty"`
+}
+
+func decodePolicyConstraints(der []byte) (textValue, error) {
+	var v struct {
+		RequireExplicitPolicy int `asn1:"optional,tag:0,default:-1"`
+		InhibitPolicyMapping  int `asn1:"optional,tag:1,default:-1"`
+	}
+	if err := unmarshal(der, &v); err != nil {
+		return nil, err
+	}
+	pc := new(PolicyConstraints)
+	if v.RequireExplicitPolicy >= 0 {
+		pc.RequireExplicitPolicy = &v.RequireExplicitPolicy
+	}
+	if v.InhibitPolicyMapping >= 0 {
+		pc.InhibitPolicyMapping = &v.InhibitPolicyMapping
+	}
+	return pc, nil
+}
+
+func (v *PolicyConstraints) writeText(w *textWriter, indent int) {
+	if v.RequireExplicitPolicy != nil {
+		w.line(indent, "Require Explicit Policy: %d", *v.RequireExplicitPolicy)
+	}
+	if v.InhibitPolicyMapping != nil {
+		w.line(indent, "Inhibit Policy Mapping: %d", *v.InhibitPolicyMapping)
+	}
+}
+
+// SkipCerts is the value of the inhibit any policy extension.
+type SkipCerts int
+
+func decodeInhibitAnyPolicy(der []byte) (textValue, error) {
+	var v int
+	if err := unmarshal(der, &v); err != nil {
+		return nil, err
+	}
+	return SkipCerts(v), nil
+}
+
+func (v SkipCerts) writeText(w *textWriter, indent int) {
+	w.line(indent, "%d", int(v))
+}
+
+// Integer is the value of the extensions that contain just an integer, like
+// the CRL number and the delta CRL indicator.
+type Integer struct {
+	*big.Int
+}
+
+func decodeInteger(der []byte) (textValue, error) {
+	var v *big.Int
+	if err := unmarshal(der, &v); err != nil {
+		return nil, err
+	}
+	return Integer{v}, nil
+}
+
+func (v Integer) writeText(w *textWriter, indent int) {
+	w.line(indent, v.String())
+}
+
+// CRLReason is the value of the CRL reason code extension.
+type CRLReason string
+
+var crlReasonNames = map[int]string{
+	0:  "Unspecified",
+	1:  "Key Compromise",
+	2:  "CA Compromise",
+	3:  "Affiliation Changed",
+	4:  "Superseded",
+	5:  "Cessation Of Operation",
+	6:  "Certificate Hold",
+	8:  "Remove From CRL",
+	9:  "Privilege Withdrawn",
+	10: "AA Compromise",
+}
+
+func decodeReasonCode(der []byte) (textValue, error) {
+	var v asn1.Enumerated
+	if err := unmarshal(der, &v); err != nil {
+		return nil, err
+	}
+	if s, ok := crlReasonNames[int(v)]; ok {
+		return CRLReason(s), nil
+	}
+	return CRLReason(fmt.Sprintf("Unknown (%d)", v)), nil
+}
+
+func (v CRLReason) writeText(w *textWriter, indent int) {
+	w.line(indent, string(v))
+}
+
+// InvalidityDate is the value of the invalidity date CRL entry extension.
+type InvalidityDate struct {
+	time.Time
+}
+
+func decodeInvalidityDate(der []byte) (textValue, error) {
+	var t time.Time
+	if err := unmarshal(der, &t, "generalized"); err != nil {
+		return nil, err
+	}
+	return InvalidityDate{t}, nil
+}
+
+func (v InvalidityDate) writeText(w *textWriter, indent int) {
+	w.line(indent, v.UTC().Format(timeLayout))
+}
+
+// TLSFeatures is the list of features in the TLS feature extension.
+type TLSFeatures []string
+
+var tlsFeatureNames = map[int]string{
+	5:  "status_request",
+	17: "status_request_v2",
+}
+
+func decodeTLSFeatures(der []byte) (textValue, error) {
+	var features []int
+	if err := unmarshal(der, &features); err != nil {
+		return nil, err
+	}
+	ret := make(TLSFeatures, len(features))
+	for i, f := range features {
+		if s, ok := tlsFeatureNames[f]; ok {
+			ret[i] = s
+		} else {
+			ret[i] = strconv.Itoa(f)
+		}
+	}
+	return ret, nil
+}
+
+func (v TLSFeatures) writeText(w *textWriter, indent int) {
+	w.line(indent, strings.Join(v, ", "))
+}
+
+// SignedCertificateTimestamp is the representation of a signed certificate
+// timestamp as defined in RFC 6962.
+type SignedCertificateTimestamp struct {
+	Version            int       `json:"version"`
+	LogID              string    `json:"logID"`
+	Timestamp          time.Time `json:"timestamp"`
+	Extensions         string    `json:"extensions,omitempty"`
+	HashAlgorithm      string    `json:"hashAlgorithm"`
+	SignatureAlgorithm string    `json:"signatureAlgorithm"`
+	Signature          string    `json:"signature"`
+}
+
+// SignedCertificateTimestamps is the list of timestamps in the certificate
+// transparency SCT list extension.
+type SignedCertificateTimestamps []SignedCertificateTimestamp
+
+var (
+	sctHashAlgorithms = map[uint8]string{
+		0: "none", 1: "md5", 2: "sha1", 3: "sha224", 4: "sha256", 5: "sha384", 6: "sha512",
+	}
+	sctSignatureAlgorithms = map[uint8]string{
+		0: "anonymous", 1: "rsa", 2: "dsa", 3: "ecdsa",
+	}
+)
+
+func decodeSignedCertificateTimestamps(der []byte) (textValue, error) {
+	var data []byte
+	if err := unmarshal(der, &data); err != nil {
+		return nil, err
+	}
+
+	var list cryptobyte.String
+	input := cryptobyte.String(data)
+	if !input.ReadUint16LengthPrefixed(&list) || !input.Empty() {
+		return nil, errors.New("invalid signed certificate timestamp list")
+	}
+
+	var ret SignedCertificateTimestamps
+	for !list.Empty() {
+		var (
+			sct, logID, exts, sig cryptobyte.String
+			version, hash, algo   uint8
+			timestamp             uint64
+		)
+		if !list.ReadUint16LengthPrefixed(&sct) ||
+			!sct.ReadUint8(&version) ||
+			!sct.ReadBytes((*[]byte)(&logID), 32) ||
+			!sct.ReadUint64(&timestamp) ||
+			!sct.ReadUint16LengthPrefixed(&exts) ||
+			!sct.ReadUint8(&hash) ||
+			!sct.ReadUint8(&algo) ||
+			!sct.ReadUint16LengthPrefixed(&sig) ||
+			!sct.Empty() {
+			return nil, errors.New("invalid signed certificate timestamp")
+		}
+		ret = append(ret, SignedCertificateTimestamp{
+			Version:            int(version) + 1,
+			LogID:              hexString(logID),
+			Timestamp:          time.UnixMilli(int64(timestamp)).UTC(),
+			Extensions:         hexString(exts),
+			HashAlgorithm:      lookupName(sctHashAlgorithms, hash),
+			SignatureAlgorithm: lookupName(sctSignatureAlgorithms, algo),
+			Signature:          hexString(sig),
+		})
+	}
+	return ret, nil
+}
+
+func lookupName(m map[uint8]string, v uint8) string {
+	if s, ok := m[v]; ok {
+		return s
+	}
+	return fmt.Sprintf("unknown (%d)", v)
+}
+
+func (v SignedCertificateTimestamps) writeText(w *textWriter, indent int) {
+	for _, sct := range v {
+		w.line(indent, "Signed Certificate Timestamp:")
+		w.line(indent+1, "Version   : v%d", sct.Version)
+		w.line(indent+1, "Log ID    :")
+		w.hex(indent+2, sct.LogID)
+		w.line(indent+1, "Timestamp : %s", sct.Timestamp.Format(timeLayout))
+		if sct.Extensions == "" {
+			w.line(indent+1, "Extensions: none")
+		} else {
+			w.line(indent+1, "Extensions:")
+			w.hex(indent+2, sct.Extensions)
+		}
+		w.line(indent+1, "Signature : %s-with-%s", sct.SignatureAlgorithm, sct.HashAlgorithm)
+		w.hex(indent+2, sct.Signature)
+	}
+}
+
+// SubjectKeyAttestationEvidence is the representation of the Subject Key
+// Attestation Evidence (SKAE) extension defined by the Trusted Computing
+// Group. Enveloped evidence is encrypted, and it's represented as ASN.1.
+type SubjectKeyAttestationEvidence struct {
+	TCGSpecVersion      string             `json:"tcgSpecVersion"`
+	Type                string             `json:"type"`
+	CertifyInfo         string             `json:"certifyInfo,omitempty"`
+	Signature           string             `json:"signature,omitempty"`
+	AuthorityInfoAccess AccessDescriptions `json:"authorityInfoAccess,omitempty"`
+	Issuer              string             `json:"issuer,omitempty"`
+	SerialNumber        string             `json:"serialNumber,omitempty"`
+	Evidence            ASN1Nodes          `json:"evidence,omitempty"`
+}
+
+type attestationEvidence struct {
+	TPMCertifyInfo struct {
+		CertifyInfo asn1.BitString
+		Signature   asn1.BitString
+	}
+	TPMIdentityCredAccessInfo struct {
+		AuthorityInfoAccess []accessDescription
+		IssuerSerial        struct {
+			IssuerName   asn1.RawValue
+			SerialNumber *big.Int
+		}
+	}
+}
+
+func decodeSubjectKeyAttestationEvidence(der []byte) (textValue, error) {
+	var v struct {
+		TCGSpecVersion struct {
+			Major int
+			Minor int
+		}
+		KeyAttestationEvidence asn1.RawValue
+	}
+	if err := unmarshal(der, &v); err != nil {
+		return nil, err
+	}
+
+	evidence := v.KeyAttestationEvidence
+	// Support the evidence choice wrapped in a sequence.
+	if evidence.Class == asn1.ClassUniversal && evidence.Tag == asn1.TagSequence {
+		if err := unmarshal(evidence.Bytes, &evidence); err != nil {
+			return nil, err
+		}
+	}
+	if evidence.Class != asn1.ClassContextSpecific {
+		return nil, errors.New("invalid key attestation evidence")
+	}
+
+	skae := &SubjectKeyAttestationEvidence{
+		TCGSpecVersion: fmt.Sprintf("%d.%d", v.TCGSpecVersion.Major, v.TCGSpecVersion.Minor),
+	}
+	switch evidence.Tag {
+	case 0:
+		var ae attestationEvidence
+		if err := unmarshal(evidence.Bytes, &ae); err != nil {
+			if err := unmarshal(evidence.FullBytes, &ae, "tag:0"); err != nil {
+				return nil, err
+			}
+		}
+		ads, err := newAccessDescriptions(ae.TPMIdentityCredAccessInfo.AuthorityInfoAccess)
+		if err != nil {
+			return nil, err
+		}
+		skae.Type = "attestEvidence"
+		skae.CertifyInfo = hexString(ae.TPMCertifyInfo.CertifyInfo.Bytes)
+		skae.Signature = hexString(ae.TPMCertifyInfo.Signature.Bytes)
+		skae.AuthorityInfoAccess = ads
+		skae.Issuer = newNameFromRaw(ae.TPMIdentityCredAccessInfo.IssuerSerial.IssuerName.FullBytes).DN
+		if sn := ae.TPMIdentityCredAccessInfo.IssuerSerial.SerialNumber; sn != nil {
+			skae.SerialNumber = hexString(sn.Bytes())
+		}
+	case 1:
+		nodes, err := ParseASN1(evidence.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		skae.Type = "envelopedAttestEvidence"
+		skae.Evidence = nodes
+	default:
+		return nil, errors.New("invalid key attestation evidence")
+	}
+	return skae, nil
+}
+
+func (v *SubjectKeyAttestationEvidence) writeText(w *textWriter, indent int) {
+	w.line(indent, "TCG Spec Version: %s", v.TCGSpecVersion)
+	w.line(indent, "Type: %s", v.Type)
+	if v.CertifyInfo != "" {
+		w.line(indent, "Certify Info:")
+		w.hex(indent+1, v.CertifyInfo)
+	}
+	if v.Signature != "" {
+		w.line(indent, "Signature:")
+		w.hex(indent+1, v.Signature)
+	}
+	if len(v.AuthorityInfoAccess) > 0 {
+		w.line(indent, "Authority Information Access:")
+		v.AuthorityInfoAccess.writeText(w, indent+1)
+	}
+	if v.Issuer != "" {
+		w.line(indent, "Issuer: %s", v.Issuer)
+	}
+	if v.SerialNumber != "" {
+		w.line(indent, "Serial Number: %s", v.SerialNumber)
+	}
+	if len(v.Evidence) > 0 {
+		w.line(indent, "Evidence:")
+		v.Evidence.writeText(w, indent+1)
+	}
+}
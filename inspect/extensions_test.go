@@ -0,0 +1,232 @@
+package inspect
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func Test_decodeExtension(t *testing.T) {
+	uri := func(s string) asn1.RawValue {
+		return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 6, Bytes: []byte(s)}
+	}
+	dns := func(s string) asn1.RawValue {
+		return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte(s)}
+	}
+	ip := func(b ...byte) asn1.RawValue {
+		return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 7, Bytes: b}
+	}
+	explicit := func(tag int, v interface{}) asn1.RawValue {
+		return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: mustMarshal(t, v)}
+	}
+	implicit := func(tag int, values ...asn1.RawValue) asn1.RawValue {
+		var b []byte
+		for _, v := range values {
+			b = append(b, mustMarshal(t, v)...)
+		}
+		return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: b}
+	}
+	ext := func(oid asn1.ObjectIdentifier, value []byte) pkix.Extension {
+		return pkix.Extension{Id: oid, Value: value}
+	}
+
+	issuer := mustMarshal(t, pkix.Name{CommonName: "AK CA"}.ToRDNSequence())
+
+	var sctList cryptobyte.Builder
+	sctList.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint8(0)
+			b.AddBytes(make([]byte, 32))
+			b.AddUint64(1704164645000)
+			b.AddUint16(0)
+			b.AddUint8(4)
+			b.AddUint8(3)
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddBytes([]byte{0xaa, 0xbb})
+			})
+		})
+	})
+
+	tests := []struct {
+		name string
+		ext  pkix.Extension
+		want interface{}
+	}{
+		{"authorityKeyIdentifier", ext(asn1.ObjectIdentifier{2, 5, 29, 35}, mustMarshal(t, struct {
+			KeyID        []byte        `asn1:"optional,tag:0"`
+			Issuer       asn1.RawValue `asn1:"optional"`
+			SerialNumber *big.Int      `asn1:"optional,tag:2"`
+		}{[]byte{1, 2}, implicit(1, explicit(4, pkix.Name{CommonName: "Root"}.ToRDNSequence())), big.NewInt(10)})),
+			&AuthorityKeyIdentifier{KeyID: "01:02", Issuer: GeneralNames{{Type: "dn", Value: "CN=Root"}}, SerialNumber: "0a"}},
+		{"basicConstraints", ext(asn1.ObjectIdentifier{2, 5, 29, 19}, mustMarshal(t, struct {
+			CA         bool
+			MaxPathLen int
+		}{true, 0})), &BasicConstraints{CA: true, MaxPathLen: intPtr(0)}},
+		{"keyUsage", ext(asn1.ObjectIdentifier{2, 5, 29, 15}, mustMarshal(t, asn1.BitString{Bytes: []byte{0x06}, BitLength: 7})),
+			KeyUsage{"Certificate Sign", "CRL Sign"}},
+		{"nameConstraints", ext(asn1.ObjectIdentifier{2, 5, 29, 30}, mustMarshal(t, struct {
+			Permitted asn1.RawValue
+			Excluded  asn1.RawValue
+		}{
+			implicit(0, asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: mustMarshal(t, dns(".smallstep.com"))}),
+			implicit(1, asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: mustMarshal(t, ip(10, 0, 0, 0, 255, 0, 0, 0))}),
+		})), &NameConstraints{
+			Permitted: GeneralNames{{Type: "dns", Value: ".smallstep.com"}},
+			Excluded:  GeneralNames{{Type: "ip", Value: "10.0.0.0/8"}},
+		}},
+		{"certificatePolicies", ext(asn1.ObjectIdentifier{2, 5, 29, 32}, mustMarshal(t, []struct {
+			Policy     asn1.ObjectIdentifier
+			Qualifiers []struct {
+				ID        asn1.ObjectIdentifier
+				Qualifier interface{}
+			}
+		}{{
+			Policy: asn1.ObjectIdentifier{1, 2, 3, 4},
+			Qualifiers: []struct {
+				ID        asn1.ObjectIdentifier
+				Qualifier interface{}
+			}{
+				{oidQualifierCPS, asn1.RawValue{Tag: asn1.TagIA5String, Bytes: []byte("https://smallstep.com/cps")}},
+				{oidQualifierUserNotice, struct {
+					NoticeRef struct {
+						Organization  string `asn1:"utf8"`
+						NoticeNumbers []int
+					}
+					ExplicitText string `asn1:"utf8"`
+				}{struct {
+					Organization  string `asn1:"utf8"`
+					NoticeNumbers []int
+				}{"Smallstep", []int{1, 2}}, "Test notice"}},
+			},
+		}})), CertificatePolicies{{
+			Policy: "1.2.3.4",
+			Qualifiers: []PolicyQualifier{
+				{Qualifier: "CPS (1.3.6.1.5.5.7.2.1)", CPS: "https://smallstep.com/cps"},
+				{Qualifier: "User Notice (1.3.6.1.5.5.7.2.2)", UserNotice: &UserNotice{
+					Organization: "Smallstep", NoticeNumbers: []int{1, 2}, ExplicitText: "Test notice",
+				}},
+			},
+		}}},
+		{"policyMappings", ext(asn1.ObjectIdentifier{2, 5, 29, 33}, mustMarshal(t, []struct {
+			IssuerDomainPolicy  asn1.ObjectIdentifier
+			SubjectDomainPolicy asn1.ObjectIdentifier
+		}{{asn1.ObjectIdentifier{1, 2, 3}, asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}}})),
+			PolicyMappings{{IssuerDomainPolicy: "1.2.3", SubjectDomainPolicy: "CA/B Forum Domain Validated (2.23.140.1.2.1)"}}},
+		{"policyConstraints", ext(asn1.ObjectIdentifier{2, 5, 29, 36}, mustMarshal(t, struct {
+			InhibitPolicyMapping int `asn1:"tag:1"`
+		}{2})), &PolicyConstraints{InhibitPolicyMapping: intPtr(2)}},
+		{"inhibitAnyPolicy", ext(asn1.ObjectIdentifier{2, 5, 29, 54}, mustMarshal(t, 1)), SkipCerts(1)},
+		{"crlDistributionPoints", ext(asn1.ObjectIdentifier{2, 5, 29, 31}, mustMarshal(t, []struct {
+			DistributionPoint asn1.RawValue  `asn1:"optional"`
+			Reasons           asn1.BitString `asn1:"optional,tag:1"`
+			CRLIssuer         asn1.RawValue  `asn1:"optional"`
+		}{{
+			DistributionPoint: explicit(0, implicit(0, uri("http://ca.smallstep.com/crl"))),
+			Reasons:           asn1.BitString{Bytes: []byte{0x60}, BitLength: 3},
+			CRLIssuer:         implicit(2, dns("ca.smallstep.com")),
+		}})), DistributionPoints{{
+			FullName:  GeneralNames{{Type: "uri", Value: "http://ca.smallstep.com/crl"}},
+			Reasons:   []string{"Key Compromise", "CA Compromise"},
+			CRLIssuer: GeneralNames{{Type: "dns", Value: "ca.smallstep.com"}},
+		}}},
+		{"crlNumber", ext(asn1.ObjectIdentifier{2, 5, 29, 20}, mustMarshal(t, big.NewInt(42))), Integer{big.NewInt(42)}},
+		{"reasonCode", ext(asn1.ObjectIdentifier{2, 5, 29, 21}, mustMarshal(t, asn1.Enumerated(1))), CRLReason("Key Compromise")},
+		{"invalidityDate", ext(asn1.ObjectIdentifier{2, 5, 29, 24}, []byte("\x18\x0f20240102030405Z")),
+			InvalidityDate{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}},
+		{"tlsFeature", ext(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}, mustMarshal(t, []int{5, 99})), TLSFeatures{"status_request", "99"}},
+		{"sctList", ext(asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}, mustMarshal(t, sctList.BytesOrPanic())),
+			SignedCertificateTimestamps{{
+				Version:            1,
+				LogID:              hexString(make([]byte, 32)),
+				Timestamp:          time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				HashAlgorithm:      "sha256",
+				SignatureAlgorithm: "ecdsa",
+				Signature:          "aa:bb",
+			}}},
+		{"skae", ext(asn1.ObjectIdentifier{2, 23, 133, 6, 1, 1}, mustMarshal(t, struct {
+			TCGSpecVersion         struct{ Major, Minor int }
+			KeyAttestationEvidence asn1.RawValue
+		}{
+			struct{ Major, Minor int }{2, 0},
+			explicit(0, struct {
+				TPMCertifyInfo struct {
+					CertifyInfo asn1.BitString
+					Signature   asn1.BitString
+				}
+				TPMIdentityCredAccessInfo struct {
+					AuthorityInfoAccess []accessDescription
+					IssuerSerial        struct {
+						IssuerName   asn1.RawValue
+						SerialNumber *big.Int
+					}
+				}
+			}{
+				TPMCertifyInfo: struct {
+					CertifyInfo asn1.BitString
+					Signature   asn1.BitString
+				}{asn1.BitString{Bytes: []byte{1, 2}, BitLength: 16}, asn1.BitString{Bytes: []byte{3, 4}, BitLength: 16}},
+				TPMIdentityCredAccessInfo: struct {
+					AuthorityInfoAccess []accessDescription
+					IssuerSerial        struct {
+						IssuerName   asn1.RawValue
+						SerialNumber *big.Int
+					}
+				}{
+					AuthorityInfoAccess: []accessDescription{{asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 2}, uri("http://ca.smallstep.com/ak.crt")}},
+					IssuerSerial: struct {
+						IssuerName   asn1.RawValue
+						SerialNumber *big.Int
+					}{asn1.RawValue{FullBytes: issuer}, big.NewInt(255)},
+				},
+			}),
+		})), &SubjectKeyAttestationEvidence{
+			TCGSpecVersion: "2.0",
+			Type:           "attestEvidence",
+			CertifyInfo:    "01:02",
+			Signature:      "03:04",
+			AuthorityInfoAccess: AccessDescriptions{
+				{Method: "CA Issuers (1.3.6.1.5.5.7.48.2)", Location: GeneralName{Type: "uri", Value: "http://ca.smallstep.com/ak.crt"}},
+			},
+			Issuer:       "CN=AK CA",
+			SerialNumber: "ff",
+		}},
+		{"unknown", ext(asn1.ObjectIdentifier{1, 2, 3, 4}, mustMarshal(t, asn1.ObjectIdentifier{2, 5, 29, 32, 0})),
+			ASN1Nodes{{Type: "OBJECT IDENTIFIER", Value: "Any Policy (2.5.29.32.0)"}}},
+		{"invalid", ext(asn1.ObjectIdentifier{2, 5, 29, 19}, []byte{0x30, 0x05, 0x01}), HexValue("30:05:01")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, decodeExtension(tt.ext))
+		})
+	}
+}
+
+func TestExtension_writeText(t *testing.T) {
+	exts := newExtensions([]pkix.Extension{
+		{Id: asn1.ObjectIdentifier{2, 5, 29, 19}, Critical: true, Value: mustMarshal(t, struct{ CA bool }{true})},
+		{Id: asn1.ObjectIdentifier{2, 5, 29, 15}, Value: mustMarshal(t, asn1.BitString{Bytes: []byte{0x80}, BitLength: 1})},
+		{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: []byte{0x05, 0x00}},
+	})
+	require.Len(t, exts, 3)
+
+	w := new(textWriter)
+	writeExtensionsText(w, 0, "Extensions:", exts)
+	assert.Equal(t, `Extensions:
+    Basic Constraints: critical
+        CA:TRUE
+    Key Usage:
+        Digital Signature
+    1.2.3.4:
+        NULL
+`, w.String())
+}
@@ -0,0 +1,262 @@
+// Package inspect implements methods to render X.509 certificates, certificate
+// requests and revocation lists, SSH certificates and JSON Web Keys as human
+// readable text, in a format similar to the one used by "openssl x509 -text",
+// or as structured data that can be encoded as JSON.
+//
+// The names of the object identifiers are shared with the x509util package,
+// new names can be added using x509util.RegisterOIDName.
+package inspect
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.step.sm/crypto/fingerprint"
+	"go.step.sm/crypto/x25519"
+	"go.step.sm/crypto/x509util"
+)
+
+// timeLayout is the layout used to print times in the text representation,
+// it's the same one used by OpenSSL.
+const timeLayout = "Jan _2 15:04:05 2006 MST"
+
+// Attribute is the representation of an attribute type and value used in
+// distinguished names and certificate request attributes.
+type Attribute struct {
+	ID    string `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value"`
+}
+
+// Name is the representation of an X.501 distinguished name.
+type Name struct {
+	DN         string      `json:"dn"`
+	Attributes []Attribute `json:"attributes,omitempty"`
+}
+
+// newName creates a Name from an RDN sequence.
+func newName(rdns pkix.RDNSequence) Name {
+	var name Name
+	var parts []string
+	for _, rdn := range rdns {
+		var set []string
+		for _, atv := range rdn {
+			a := Attribute{
+				ID:    atv.Type.String(),
+				Name:  x509util.OIDName(atv.Type),
+				Value: attributeValue(atv.Value),
+			}
+			name.Attributes = append(name.Attributes, a)
+			set = append(set, shortAttributeName(atv.Type)+"="+a.Value)
+		}
+		parts = append(parts, strings.Join(set, " + "))
+	}
+	name.DN = strings.Join(parts, ", ")
+	return name
+}
+
+// newNameFromRaw creates a Name from the DER representation of an RDN
+// sequence, if the data cannot be parsed the returned name will be the hex
+// representation of it.
+func newNameFromRaw(der []byte) Name {
+	var rdns pkix.RDNSequence
+	if rest, err := asn1.Unmarshal(der, &rdns); err != nil || len(rest) > 0 {
+		return Name{DN: hexString(der)}
+	}
+	return newName(rdns)
+}
+
+var shortAttributeNames = map[string]string{
+	"2.5.4.3":                    "CN",
+	"2.5.4.5":                    "serialNumber",
+	"2.5.4.6":                    "C",
+	"2.5.4.7":                    "L",
+	"2.5.4.8":                    "ST",
+	"2.5.4.9":                    "street",
+	"2.5.4.10":                   "O",
+	"2.5.4.11":                   "OU",
+	"2.5.4.17":                   "postalCode",
+	"0.9.2342.19200300.100.1.1":  "UID",
+	"0.9.2342.19200300.100.1.25": "DC",
+}
+
+func shortAttributeName(oid asn1.ObjectIdentifier) string {
+	if s, ok := shortAttributeNames[oid.String()]; ok {
+		return s
+	}
+	if s := x509util.OIDName(oid); s != "" {
+		return s
+	}
+	return oid.String()
+}
+
+func attributeValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return hexString(v)
+	case asn1.RawValue:
+		if len(v.FullBytes) > 0 {
+			return hexString(v.FullBytes)
+		}
+		return hexString(v.Bytes)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// PublicKey is the representation of a public key.
+type PublicKey struct {
+	Algorithm   string `json:"algorithm"`
+	Size        int    `json:"size,omitempty"`
+	Curve       string `json:"curve,omitempty"`
+	Modulus     string `json:"modulus,omitempty"`
+	Exponent    int    `json:"exponent,omitempty"`
+	Value       string `json:"value,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// newPublicKey creates the PublicKey representation of the given key. The
+// fingerprint is the SHA-256 hash of the DER-encoded subject public key info.
+func newPublicKey(pub crypto.PublicKey) PublicKey {
+	var pk PublicKey
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		pk.Algorithm = "RSA"
+		pk.Size = k.N.BitLen()
+		pk.Modulus = hexString(k.N.Bytes())
+		pk.Exponent = k.E
+	case *ecdsa.PublicKey:
+		pk.Algorithm = "ECDSA"
+		pk.Size = k.Curve.Params().BitSize
+		pk.Curve = k.Curve.Params().Name
+		if ek, err := k.ECDH(); err == nil {
+			pk.Value = hexString(ek.Bytes())
+		}
+	case *ecdh.PublicKey:
+		pk.Algorithm = "ECDH"
+		pk.Curve = fmt.Sprint(k.Curve())
+		pk.Value = hexString(k.Bytes())
+	case ed25519.PublicKey:
+		pk.Algorithm = "Ed25519"
+		pk.Size = 256
+		pk.Value = hexString(k)
+	case x25519.PublicKey:
+		pk.Algorithm = "X25519"
+		pk.Size = 256
+		pk.Value = hexString(k)
+	case nil:
+		pk.Algorithm = "Unknown"
+	default:
+		pk.Algorithm = fmt.Sprintf("Unknown (%T)", pub)
+	}
+	if b, err := x509.MarshalPKIXPublicKey(pub); err == nil {
+		sum := sha256.Sum256(b)
+		pk.Fingerprint = fingerprint.Fingerprint(sum[:], fingerprint.HexFingerprint)
+	}
+	return pk
+}
+
+func (pk PublicKey) writeText(w *textWriter, indent int) {
+	w.line(indent, "Public Key Algorithm: %s", pk.Algorithm)
+	if pk.Size > 0 {
+		w.line(indent+1, "Public-Key: (%d bit)", pk.Size)
+	}
+	if pk.Modulus != "" {
+		w.line(indent+1, "Modulus:")
+		w.hex(indent+2, pk.Modulus)
+		w.line(indent+1, "Exponent: %d (0x%x)", pk.Exponent, pk.Exponent)
+	}
+	if pk.Value != "" {
+		w.line(indent+1, "pub:")
+		w.hex(indent+2, pk.Value)
+	}
+	if pk.Curve != "" {
+		w.line(indent+1, "Curve: %s", pk.Curve)
+	}
+	if pk.Fingerprint != "" {
+		w.line(indent+1, "Fingerprint: %s", pk.Fingerprint)
+	}
+}
+
+// Signature is the representation of a signature.
+type Signature struct {
+	Algorithm string `json:"algorithm"`
+	Value     string `json:"value"`
+}
+
+func newSignature(algo x509.SignatureAlgorithm, sig []byte) Signature {
+	return Signature{
+		Algorithm: algo.String(),
+		Value:     hexString(sig),
+	}
+}
+
+func (s Signature) writeText(w *textWriter, indent int) {
+	w.line(indent, "Signature Algorithm: %s", s.Algorithm)
+	w.line(indent, "Signature Value:")
+	w.hex(indent+1, s.Value)
+}
+
+// Validity is the representation of the validity period of a certificate.
+type Validity struct {
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+}
+
+// hexString returns the lowercase hex representation of the given data with
+// the bytes separated by colons.
+func hexString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.Grow(len(b) * 3)
+	for i, c := range b {
+		if i > 0 {
+			sb.WriteByte(':')
+		}
+		fmt.Fprintf(&sb, "%02x", c)
+	}
+	return sb.String()
+}
+
+// textWriter is a helper used to write the text representation of the
+// different objects.
+type textWriter struct {
+	strings.Builder
+}
+
+// line writes a new line with the given indentation level.
+func (w *textWriter) line(indent int, format string, args ...interface{}) {
+	w.WriteString(strings.Repeat("    ", indent))
+	if len(args) == 0 {
+		w.WriteString(format)
+	} else {
+		fmt.Fprintf(w, format, args...)
+	}
+	w.WriteByte('\n')
+}
+
+// hex writes a colon separated hex string in lines of 18 bytes.
+func (w *textWriter) hex(indent int, s string) {
+	const lineLength = 18 * 3
+	for len(s) > lineLength {
+		w.line(indent, s[:lineLength])
+		s = s[lineLength:]
+	}
+	if s != "" {
+		w.line(indent, s)
+	}
+}
@@ -0,0 +1,135 @@
+package inspect
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"time"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x25519"
+	"go.step.sm/crypto/x509util"
+)
+
+// JSONWebKey is the representation of a JSON Web Key. Private key material is
+// never included in the representation.
+type JSONWebKey struct {
+	KeyID        string               `json:"kid,omitempty"`
+	KeyType      string               `json:"kty"`
+	Algorithm    string               `json:"alg,omitempty"`
+	Use          string               `json:"use,omitempty"`
+	Private      bool                 `json:"private"`
+	Size         int                  `json:"size,omitempty"`
+	PublicKey    *PublicKey           `json:"publicKey,omitempty"`
+	Thumbprint   string               `json:"thumbprint,omitempty"`
+	Certificates []CertificateSummary `json:"certificates,omitempty"`
+}
+
+// CertificateSummary is a short representation of a certificate in the
+// certificate chain of a JSON Web Key.
+type CertificateSummary struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serialNumber"`
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+	Fingerprint  string    `json:"fingerprint"`
+}
+
+// NewJSONWebKey returns the representation of the given JSON Web Key. The
+// thumbprint is the base64url-encoded SHA-256 JWK thumbprint defined in RFC
+// 7638.
+func NewJSONWebKey(jwk *jose.JSONWebKey) *JSONWebKey {
+	k := &JSONWebKey{
+		KeyID:     jwk.KeyID,
+		Algorithm: jwk.Algorithm,
+		Use:       jwk.Use,
+		Private:   !jwk.IsPublic(),
+	}
+
+	var pub crypto.PublicKey
+	switch key := jwk.Key.(type) {
+	case []byte:
+		k.KeyType = "oct"
+		k.Size = 8 * len(key)
+	case *rsa.PublicKey, *rsa.PrivateKey:
+		k.KeyType = "RSA"
+		pub = jwk.Public().Key
+	case *ecdsa.PublicKey, *ecdsa.PrivateKey:
+		k.KeyType = "EC"
+		pub = jwk.Public().Key
+	case ed25519.PublicKey, ed25519.PrivateKey:
+		k.KeyType = "OKP"
+		pub = jwk.Public().Key
+	case x25519.PublicKey:
+		k.KeyType = "OKP"
+		pub = key
+	case x25519.PrivateKey:
+		k.KeyType = "OKP"
+		pub = key.Public()
+	default:
+		k.KeyType = "unknown"
+	}
+
+	if pub != nil {
+		pk := newPublicKey(pub)
+		k.Size = pk.Size
+		k.PublicKey = &pk
+	}
+	if thumbprint, err := jose.Thumbprint(jwk); err == nil {
+		k.Thumbprint = thumbprint
+	}
+	for _, cert := range jwk.Certificates {
+		k.Certificates = append(k.Certificates, CertificateSummary{
+			Subject:      newNameFromRaw(cert.RawSubject).DN,
+			Issuer:       newNameFromRaw(cert.RawIssuer).DN,
+			SerialNumber: serialNumberString(cert.SerialNumber),
+			NotBefore:    cert.NotBefore,
+			NotAfter:     cert.NotAfter,
+			Fingerprint:  x509util.Fingerprint(cert),
+		})
+	}
+	return k
+}
+
+// Text returns the text representation of the JSON Web Key.
+func (k *JSONWebKey) Text() string {
+	w := new(textWriter)
+	w.line(0, "JSON Web Key:")
+	if k.KeyID != "" {
+		w.line(1, "Key ID: %s", k.KeyID)
+	}
+	w.line(1, "Key Type: %s", k.KeyType)
+	if k.Algorithm != "" {
+		w.line(1, "Algorithm: %s", k.Algorithm)
+	}
+	if k.Use != "" {
+		w.line(1, "Use: %s", k.Use)
+	}
+	if k.Private {
+		w.line(1, "Private: yes")
+	} else {
+		w.line(1, "Private: no")
+	}
+	if k.PublicKey != nil {
+		k.PublicKey.writeText(w, 1)
+	} else if k.Size > 0 {
+		w.line(1, "Size: %d bit", k.Size)
+	}
+	if k.Thumbprint != "" {
+		w.line(1, "Thumbprint (SHA-256): %s", k.Thumbprint)
+	}
+	if len(k.Certificates) > 0 {
+		w.line(1, "Certificates:")
+		for _, c := range k.Certificates {
+			w.line(2, "Subject: %s", c.Subject)
+			w.line(3, "Issuer: %s", c.Issuer)
+			w.line(3, "Serial Number: %s", c.SerialNumber)
+			w.line(3, "Not Before: %s", c.NotBefore.UTC().Format(timeLayout))
+			w.line(3, "Not After : %s", c.NotAfter.UTC().Format(timeLayout))
+			w.line(3, "Fingerprint (SHA-256): %s", c.Fingerprint)
+		}
+	}
+	return w.String()
+}
@@ -0,0 +1,72 @@
+package inspect
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x509util"
+)
+
+func TestNewJSONWebKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	cert := createCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(10),
+		Subject:      pkix.Name{CommonName: "Test"},
+		NotBefore:    now,
+		NotAfter:     now.Add(time.Hour),
+	}, key.Public(), key)
+
+	jwk := &jose.JSONWebKey{
+		Key:          key,
+		KeyID:        "the-kid",
+		Algorithm:    "ES256",
+		Use:          "sig",
+		Certificates: []*x509.Certificate{cert},
+	}
+	thumbprint, err := jose.Thumbprint(jwk)
+	require.NoError(t, err)
+
+	got := NewJSONWebKey(jwk)
+	assert.Equal(t, "the-kid", got.KeyID)
+	assert.Equal(t, "EC", got.KeyType)
+	assert.Equal(t, "ES256", got.Algorithm)
+	assert.Equal(t, "sig", got.Use)
+	assert.True(t, got.Private)
+	assert.Equal(t, 256, got.Size)
+	assert.Equal(t, thumbprint, got.Thumbprint)
+	require.NotNil(t, got.PublicKey)
+	assert.Equal(t, "P-256", got.PublicKey.Curve)
+	assert.Equal(t, []CertificateSummary{{
+		Subject:      "CN=Test",
+		Issuer:       "CN=Test",
+		SerialNumber: "10",
+		NotBefore:    now,
+		NotAfter:     now.Add(time.Hour),
+		Fingerprint:  x509util.Fingerprint(cert),
+	}}, got.Certificates)
+
+	text := got.Text()
+	assert.Contains(t, text, "JSON Web Key:\n    Key ID: the-kid\n    Key Type: EC\n    Algorithm: ES256\n    Use: sig\n    Private: yes\n")
+	assert.Contains(t, text, "    Thumbprint (SHA-256): "+thumbprint+"\n")
+	assert.Contains(t, text, "    Certificates:\n        Subject: CN=Test\n            Issuer: CN=Test\n")
+
+	got = NewJSONWebKey(&jose.JSONWebKey{Key: []byte("a-symmetric-key-of-32-bytes-long")})
+	assert.Equal(t, "oct", got.KeyType)
+	assert.Equal(t, 256, got.Size)
+	assert.True(t, got.Private)
+	assert.Nil(t, got.PublicKey)
+	assert.Contains(t, got.Text(), "    Size: 256 bit\n")
+}
@@ -0,0 +1,80 @@
+package inspect
+
+import (
+	"crypto/x509"
+	"time"
+)
+
+// RevocationList is the representation of an X.509 certificate revocation
+// list.
+type RevocationList struct {
+	SignatureAlgorithm  string               `json:"signatureAlgorithm"`
+	Issuer              Name                 `json:"issuer"`
+	ThisUpdate          time.Time            `json:"thisUpdate"`
+	NextUpdate          *time.Time           `json:"nextUpdate,omitempty"`
+	Number              string               `json:"number,omitempty"`
+	Extensions          []Extension          `json:"extensions,omitempty"`
+	RevokedCertificates []RevokedCertificate `json:"revokedCertificates,omitempty"`
+	Signature           Signature            `json:"signature"`
+}
+
+// RevokedCertificate is the representation of an entry in a certificate
+// revocation list.
+type RevokedCertificate struct {
+	SerialNumber   string      `json:"serialNumber"`
+	RevocationTime time.Time   `json:"revocationTime"`
+	Extensions     []Extension `json:"extensions,omitempty"`
+}
+
+// NewRevocationList returns the representation of the given revocation list.
+// Values that cannot be decoded will be represented using their ASN.1 or hex
+// representations.
+func NewRevocationList(crl *x509.RevocationList) *RevocationList {
+	rl := &RevocationList{
+		SignatureAlgorithm: crl.SignatureAlgorithm.String(),
+		Issuer:             newNameFromRaw(crl.RawIssuer),
+		ThisUpdate:         crl.ThisUpdate,
+		Number:             serialNumberString(crl.Number),
+		Extensions:         newExtensions(crl.Extensions),
+		Signature:          newSignature(crl.SignatureAlgorithm, crl.Signature),
+	}
+	if !crl.NextUpdate.IsZero() {
+		nextUpdate := crl.NextUpdate
+		rl.NextUpdate = &nextUpdate
+	}
+	for _, rc := range crl.RevokedCertificateEntries {
+		rl.RevokedCertificates = append(rl.RevokedCertificates, RevokedCertificate{
+			SerialNumber:   serialNumberString(rc.SerialNumber),
+			RevocationTime: rc.RevocationTime,
+			Extensions:     newExtensions(rc.Extensions),
+		})
+	}
+	return rl
+}
+
+// Text returns the text representation of the revocation list.
+func (rl *RevocationList) Text() string {
+	w := new(textWriter)
+	w.line(0, "Certificate Revocation List (CRL):")
+	w.line(1, "Signature Algorithm: %s", rl.SignatureAlgorithm)
+	w.line(1, "Issuer: %s", rl.Issuer.DN)
+	w.line(1, "Last Update: %s", rl.ThisUpdate.UTC().Format(timeLayout))
+	if rl.NextUpdate != nil {
+		w.line(1, "Next Update: %s", rl.NextUpdate.UTC().Format(timeLayout))
+	} else {
+		w.line(1, "Next Update: NONE")
+	}
+	writeExtensionsText(w, 1, "CRL extensions:", rl.Extensions)
+	if len(rl.RevokedCertificates) == 0 {
+		w.line(0, "No Revoked Certificates.")
+	} else {
+		w.line(0, "Revoked Certificates:")
+		for _, rc := range rl.RevokedCertificates {
+			writeSerialNumberText(w, 1, rc.SerialNumber)
+			w.line(2, "Revocation Date: %s", rc.RevocationTime.UTC().Format(timeLayout))
+			writeExtensionsText(w, 2, "CRL entry extensions:", rc.Extensions)
+		}
+	}
+	rl.Signature.writeText(w, 1)
+	return w.String()
+}
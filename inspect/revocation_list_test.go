@@ -0,0 +1,78 @@
+package inspect
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRevocationList(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	issuer := createCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now,
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCRLSign | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, pub, priv)
+
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(7),
+		ThisUpdate: now,
+		NextUpdate: now.Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{{
+			SerialNumber:   big.NewInt(1234),
+			RevocationTime: now,
+			ReasonCode:     1,
+		}},
+	}, issuer, priv)
+	require.NoError(t, err)
+	crl, err := x509.ParseRevocationList(der)
+	require.NoError(t, err)
+
+	got := NewRevocationList(crl)
+	assert.Equal(t, "CN=Test CA", got.Issuer.DN)
+	assert.Equal(t, "7", got.Number)
+	assert.Equal(t, now, got.ThisUpdate)
+	require.NotNil(t, got.NextUpdate)
+	assert.Equal(t, now.Add(time.Hour), *got.NextUpdate)
+	require.Len(t, got.RevokedCertificates, 1)
+	assert.Equal(t, "1234", got.RevokedCertificates[0].SerialNumber)
+	assert.Equal(t, []Extension{{
+		ID: "2.5.29.21", Name: "CRL Reason Code", Value: CRLReason("Key Compromise"),
+	}}, got.RevokedCertificates[0].Extensions)
+
+	var values []interface{}
+	for _, e := range got.Extensions {
+		values = append(values, e.Value)
+	}
+	assert.Contains(t, values, Integer{big.NewInt(7)})
+
+	text := got.Text()
+	assert.Contains(t, text, "Certificate Revocation List (CRL):\n    Signature Algorithm: Ed25519\n    Issuer: CN=Test CA\n")
+	assert.Contains(t, text, "    Last Update: Jan  2 03:04:05 2024 UTC\n    Next Update: Jan  2 04:04:05 2024 UTC\n")
+	assert.Contains(t, text, "        CRL Number:\n            7\n")
+	assert.Contains(t, text, "Revoked Certificates:\n    Serial Number: 1234 (0x4d2)\n        Revocation Date: Jan  2 03:04:05 2024 UTC\n        CRL entry extensions:\n            CRL Reason Code:\n                Key Compromise\n")
+
+	empty := NewRevocationList(&x509.RevocationList{
+		RawIssuer:  mustMarshal(t, pkix.Name{CommonName: "Test CA"}.ToRDNSequence()),
+		ThisUpdate: now,
+		Extensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 20}, Value: []byte{0x02, 0x01, 0x01}}},
+	})
+	assert.Nil(t, empty.NextUpdate)
+	assert.Contains(t, empty.Text(), "    Next Update: NONE\n")
+	assert.Contains(t, empty.Text(), "No Revoked Certificates.\n")
+}
@@ -0,0 +1,153 @@
+package inspect
+
+import (
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"go.step.sm/crypto/sshutil"
+)
+
+// SSHCertificate is the representation of an SSH certificate.
+type SSHCertificate struct {
+	Type            string            `json:"type"`
+	CertificateType string            `json:"certificateType"`
+	PublicKey       SSHPublicKey      `json:"publicKey"`
+	SigningKey      SSHPublicKey      `json:"signingKey"`
+	KeyID           string            `json:"keyID"`
+	Serial          uint64            `json:"serial"`
+	ValidAfter      *time.Time        `json:"validAfter,omitempty"`
+	ValidBefore     *time.Time        `json:"validBefore,omitempty"`
+	Principals      []string          `json:"principals"`
+	CriticalOptions map[string]string `json:"criticalOptions"`
+	Extensions      map[string]string `json:"extensions"`
+	Signature       SSHSignature      `json:"signature"`
+}
+
+// SSHPublicKey is the representation of an SSH public key.
+type SSHPublicKey struct {
+	Type        string `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// SSHSignature is the representation of the signature of an SSH certificate.
+type SSHSignature struct {
+	Format string `json:"format"`
+	Value  string `json:"value"`
+}
+
+// NewSSHCertificate returns the representation of the given SSH certificate.
+// The validity times will be nil if the certificate is valid from the
+// beginning or until the end of times.
+func NewSSHCertificate(cert *ssh.Certificate) *SSHCertificate {
+	c := &SSHCertificate{
+		Type:            cert.Type(),
+		CertificateType: sshCertificateType(cert.CertType),
+		PublicKey:       newSSHPublicKey(cert.Key),
+		KeyID:           cert.KeyId,
+		Serial:          cert.Serial,
+		Principals:      cert.ValidPrincipals,
+		CriticalOptions: cert.CriticalOptions,
+		Extensions:      cert.Extensions,
+	}
+	if c.Principals == nil {
+		c.Principals = []string{}
+	}
+	if c.CriticalOptions == nil {
+		c.CriticalOptions = map[string]string{}
+	}
+	if c.Extensions == nil {
+		c.Extensions = map[string]string{}
+	}
+	if cert.SignatureKey != nil {
+		c.SigningKey = newSSHPublicKey(cert.SignatureKey)
+	}
+	if cert.Signature != nil {
+		c.Signature = SSHSignature{
+			Format: cert.Signature.Format,
+			Value:  hexString(cert.Signature.Blob),
+		}
+	}
+	if cert.ValidAfter != 0 {
+		t := time.Unix(int64(cert.ValidAfter), 0).UTC()
+		c.ValidAfter = &t
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity {
+		t := time.Unix(int64(cert.ValidBefore), 0).UTC()
+		c.ValidBefore = &t
+	}
+	return c
+}
+
+func newSSHPublicKey(pub ssh.PublicKey) SSHPublicKey {
+	return SSHPublicKey{
+		Type:        pub.Type(),
+		Fingerprint: sshutil.Fingerprint(pub),
+	}
+}
+
+func sshCertificateType(typ uint32) string {
+	switch typ {
+	case ssh.UserCert:
+		return "user"
+	case ssh.HostCert:
+		return "host"
+	default:
+		return "unknown"
+	}
+}
+
+// Text returns the text representation of the SSH certificate using the same
+// format as "ssh-keygen -L".
+func (c *SSHCertificate) Text() string {
+	const validityLayout = "2006-01-02T15:04:05"
+
+	w := new(textWriter)
+	w.line(1, "Type: %s %s certificate", c.Type, c.CertificateType)
+	w.line(1, "Public key: %s %s", c.PublicKey.Type, c.PublicKey.Fingerprint)
+	w.line(1, "Signing CA: %s %s (using %s)", c.SigningKey.Type, c.SigningKey.Fingerprint, c.Signature.Format)
+	w.line(1, "Key ID: %q", c.KeyID)
+	w.line(1, "Serial: %d", c.Serial)
+	switch {
+	case c.ValidAfter == nil && c.ValidBefore == nil:
+		w.line(1, "Valid: forever")
+	case c.ValidAfter == nil:
+		w.line(1, "Valid: before %s", c.ValidBefore.Format(validityLayout))
+	case c.ValidBefore == nil:
+		w.line(1, "Valid: after %s", c.ValidAfter.Format(validityLayout))
+	default:
+		w.line(1, "Valid: from %s to %s", c.ValidAfter.Format(validityLayout), c.ValidBefore.Format(validityLayout))
+	}
+	if len(c.Principals) == 0 {
+		w.line(1, "Principals: (none)")
+	} else {
+		w.line(1, "Principals:")
+		for _, p := range c.Principals {
+			w.line(2, p)
+		}
+	}
+	writeSSHOptionsText(w, "Critical Options", c.CriticalOptions)
+	writeSSHOptionsText(w, "Extensions", c.Extensions)
+	return w.String()
+}
+
+func writeSSHOptionsText(w *textWriter, title string, options map[string]string) {
+	if len(options) == 0 {
+		w.line(1, "%s: (none)", title)
+		return
+	}
+	keys := make([]string, 0, len(options))
+	for k := range options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	w.line(1, "%s:", title)
+	for _, k := range keys {
+		if v := options[k]; v != "" {
+			w.line(2, "%s %s", k, v)
+		} else {
+			w.line(2, k)
+		}
+	}
+}
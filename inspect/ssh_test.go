@@ -0,0 +1,79 @@
+package inspect
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"go.step.sm/crypto/sshutil"
+)
+
+func TestNewSSHCertificate(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	key, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(caKey)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	cert := &ssh.Certificate{
+		Key:             key,
+		Serial:          1234,
+		CertType:        ssh.UserCert,
+		KeyId:           "jane@smallstep.com",
+		ValidPrincipals: []string{"jane", "jane@smallstep.com"},
+		ValidAfter:      uint64(now.Unix()),
+		ValidBefore:     uint64(now.Add(time.Hour).Unix()),
+		Permissions: ssh.Permissions{
+			CriticalOptions: map[string]string{"force-command": "/bin/true"},
+			Extensions:      map[string]string{"permit-pty": "", "permit-agent-forwarding": ""},
+		},
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, signer))
+
+	got := NewSSHCertificate(cert)
+	assert.Equal(t, "ssh-ed25519-cert-v01@openssh.com", got.Type)
+	assert.Equal(t, "user", got.CertificateType)
+	assert.Equal(t, SSHPublicKey{Type: "ssh-ed25519", Fingerprint: sshutil.Fingerprint(key)}, got.PublicKey)
+	assert.Equal(t, SSHPublicKey{Type: "ssh-ed25519", Fingerprint: sshutil.Fingerprint(signer.PublicKey())}, got.SigningKey)
+	assert.Equal(t, "ssh-ed25519", got.Signature.Format)
+	assert.Equal(t, now, *got.ValidAfter)
+
+	assert.Equal(t, `    Type: ssh-ed25519-cert-v01@openssh.com user certificate
+    Public key: ssh-ed25519 `+sshutil.Fingerprint(key)+`
+    Signing CA: ssh-ed25519 `+sshutil.Fingerprint(signer.PublicKey())+` (using ssh-ed25519)
+    Key ID: "jane@smallstep.com"
+    Serial: 1234
+    Valid: from 2024-01-02T03:04:05 to 2024-01-02T04:04:05
+    Principals:
+        jane
+        jane@smallstep.com
+    Critical Options:
+        force-command /bin/true
+    Extensions:
+        permit-agent-forwarding
+        permit-pty
+`, got.Text())
+
+	cert.CertType = ssh.HostCert
+	cert.ValidAfter = 0
+	cert.ValidBefore = ssh.CertTimeInfinity
+	cert.ValidPrincipals = nil
+	cert.Permissions = ssh.Permissions{}
+	got = NewSSHCertificate(cert)
+	assert.Equal(t, "host", got.CertificateType)
+	assert.Nil(t, got.ValidAfter)
+	assert.Nil(t, got.ValidBefore)
+	assert.Equal(t, []string{}, got.Principals)
+	text := got.Text()
+	assert.Contains(t, text, "    Valid: forever\n    Principals: (none)\n    Critical Options: (none)\n    Extensions: (none)\n")
+}
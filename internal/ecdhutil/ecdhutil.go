@@ -0,0 +1,41 @@
+// Package ecdhutil implements conversions between crypto/ecdh keys and other
+// key types shared by the packages in this module.
+package ecdhutil
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+)
+
+// ToECDSAPublicKey converts a NIST *ecdh.PublicKey to an *ecdsa.PublicKey.
+func ToECDSAPublicKey(p *ecdh.PublicKey) (*ecdsa.PublicKey, error) {
+	if p == nil {
+		return nil, errors.New("ecdh public key cannot be nil")
+	}
+	rawKey := p.Bytes()
+	switch p.Curve() {
+	case ecdh.P256():
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     big.NewInt(0).SetBytes(rawKey[1:33]),
+			Y:     big.NewInt(0).SetBytes(rawKey[33:]),
+		}, nil
+	case ecdh.P384():
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P384(),
+			X:     big.NewInt(0).SetBytes(rawKey[1:49]),
+			Y:     big.NewInt(0).SetBytes(rawKey[49:]),
+		}, nil
+	case ecdh.P521():
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P521(),
+			X:     big.NewInt(0).SetBytes(rawKey[1:67]),
+			Y:     big.NewInt(0).SetBytes(rawKey[67:]),
+		}, nil
+	default:
+		return nil, errors.New("cannot convert non-NIST *ecdh.PublicKey to *ecdsa.PublicKey")
+	}
+}
@@ -0,0 +1,34 @@
+package ecdhutil
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToECDSAPublicKey(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		t.Run(curve.Params().Name, func(t *testing.T) {
+			key, err := ecdsa.GenerateKey(curve, rand.Reader)
+			require.NoError(t, err)
+			pub, err := key.PublicKey.ECDH()
+			require.NoError(t, err)
+
+			got, err := ToECDSAPublicKey(pub)
+			require.NoError(t, err)
+			assert.True(t, key.PublicKey.Equal(got))
+		})
+	}
+
+	xKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, err = ToECDSAPublicKey(xKey.PublicKey())
+	assert.Error(t, err)
+	_, err = ToECDSAPublicKey(nil)
+	assert.Error(t, err)
+}
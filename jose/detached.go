@@ -0,0 +1,466 @@
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strings"
+
+	jose "github.com/go-jose/go-jose/v3"
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/x25519"
+)
+
+// supportedCritical is the list of header parameters in the crit header that
+// are understood when verifying a detached JWS.
+var supportedCritical = map[string]bool{
+	"b64": true,
+}
+
+// DetachedSignature is a signature in a JWS with a detached payload.
+type DetachedSignature struct {
+	// Protected is the decoded protected header.
+	Protected map[string]interface{}
+	// Header is the unprotected header, it's only available in the JSON
+	// serialization.
+	Header map[string]interface{}
+	// Signature is the raw signature.
+	Signature []byte
+
+	rawProtected string
+}
+
+// Algorithm returns the signature algorithm in the protected header.
+func (s *DetachedSignature) Algorithm() SignatureAlgorithm {
+	alg, _ := s.Protected["alg"].(string)
+	return SignatureAlgorithm(alg)
+}
+
+// KeyID returns the kid in the protected or the unprotected header.
+func (s *DetachedSignature) KeyID() string {
+	if kid, ok := s.Protected["kid"].(string); ok {
+		return kid
+	}
+	kid, _ := s.Header["kid"].(string)
+	return kid
+}
+
+// isEncoded returns the value of the b64 header, defaults to true.
+func (s *DetachedSignature) isEncoded() bool {
+	if b64, ok := s.Protected["b64"].(bool); ok {
+		return b64
+	}
+	return true
+}
+
+// DetachedJWS is a JSON Web Signature with a detached payload as defined in
+// RFC 7515, Appendix F. The payload can be unencoded using the "b64" header
+// defined in RFC 7797.
+type DetachedJWS struct {
+	Signatures []DetachedSignature
+}
+
+// SignDetached signs the payload read from the given reader and returns a JWS
+// with a detached payload. To sign an unencoded payload (RFC 7797), use
+// (*SignerOptions).WithBase64(false).
+//
+// The key can be any key supported by NewSigner, or a crypto.Signer, like a key
+// in a KMS, that will be used with NewOpaqueSignerWithAlgorithm. The payload is
+// read into memory before signing it.
+func SignDetached(payload io.Reader, key SigningKey, opts *SignerOptions) (*DetachedJWS, error) {
+	return SignDetachedMulti(payload, []SigningKey{key}, opts)
+}
+
+// SignDetachedMulti signs the payload read from the given reader with multiple
+// keys, and returns a JWS with a detached payload and multiple signatures. See
+// SignDetached for more details.
+func SignDetachedMulti(payload io.Reader, keys []SigningKey, opts *SignerOptions) (*DetachedJWS, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("signing keys cannot be empty")
+	}
+	opts, err := detachedSignerOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	signers := make([]Signer, len(keys))
+	for i, key := range keys {
+		if opts.EmbedJWK && isSymmetricKey(key.Key) {
+			return nil, errors.New("cannot embed the jwk of a symmetric key")
+		}
+		if s, ok := key.Key.(crypto.Signer); ok && !isNativeSigner(s) {
+			if key.Key, err = NewOpaqueSignerWithAlgorithm(s, key.Algorithm); err != nil {
+				return nil, err
+			}
+		}
+		signer, err := NewSigner(key, opts)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating signer")
+		}
+		signers[i] = signer
+	}
+
+	data, err := io.ReadAll(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading payload")
+	}
+
+	jws := &DetachedJWS{
+		Signatures: make([]DetachedSignature, len(signers)),
+	}
+	for i, signer := range signers {
+		obj, err := signer.Sign(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "error signing payload")
+		}
+		s, err := obj.DetachedCompactSerialize()
+		if err != nil {
+			return nil, errors.Wrap(err, "error serializing signature")
+		}
+		parts := strings.Split(s, ".")
+		sig, err := newDetachedSignature(parts[0], nil, parts[2])
+		if err != nil {
+			return nil, err
+		}
+		jws.Signatures[i] = *sig
+	}
+	return jws, nil
+}
+
+// detachedSignerOptions returns a copy of the given options with the b64
+// header validated and added to the crit header if necessary.
+func detachedSignerOptions(opts *SignerOptions) (*SignerOptions, error) {
+	so := &SignerOptions{
+		ExtraHeaders: make(map[HeaderKey]interface{}),
+	}
+	if opts != nil {
+		so.NonceSource = opts.NonceSource
+		so.EmbedJWK = opts.EmbedJWK
+		for k, v := range opts.ExtraHeaders {
+			so.ExtraHeaders[k] = v
+		}
+	}
+
+	v, ok := so.ExtraHeaders["b64"]
+	if !ok {
+		return so, nil
+	}
+	encoded, ok := v.(bool)
+	if !ok {
+		return nil, errors.New("invalid b64 header: value is not a boolean")
+	}
+	if encoded {
+		return so, nil
+	}
+	protected := map[string]interface{}{"crit": so.ExtraHeaders["crit"]}
+	if err := addCritical(protected, "b64"); err != nil {
+		return nil, err
+	}
+	so.ExtraHeaders["crit"] = protected["crit"]
+	return so, nil
+}
+
+func isSymmetricKey(key interface{}) bool {
+	switch k := key.(type) {
+	case []byte:
+		return true
+	case *JSONWebKey:
+		return IsSymmetric(k)
+	case JSONWebKey:
+		return IsSymmetric(&k)
+	default:
+		return false
+	}
+}
+
+// isNativeSigner returns if the given signer is directly supported by
+// NewSigner.
+func isNativeSigner(s crypto.Signer) bool {
+	switch s.(type) {
+	case *ecdsa.PrivateKey, *rsa.PrivateKey, ed25519.PrivateKey, x25519.PrivateKey:
+		return true
+	default:
+		return false
+	}
+}
+
+// ParseDetachedJWS parses a JWS with a detached payload in the compact or JSON
+// serialization. It validates the crit header, and fails if the JWS contains a
+// payload.
+func ParseDetachedJWS(s string) (*DetachedJWS, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "{") {
+		return parseDetachedJSON(s)
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("error parsing JWS: compact serialization must have three parts")
+	}
+	if parts[1] != "" {
+		return nil, errors.New("error parsing JWS: payload is not detached")
+	}
+	sig, err := newDetachedSignature(parts[0], nil, parts[2])
+	if err != nil {
+		return nil, err
+	}
+	return &DetachedJWS{
+		Signatures: []DetachedSignature{*sig},
+	}, nil
+}
+
+type rawDetachedSignature struct {
+	Protected string                 `json:"protected,omitempty"`
+	Header    map[string]interface{} `json:"header,omitempty"`
+	Signature string                 `json:"signature"`
+}
+
+type rawDetachedJWS struct {
+	Payload    *string                `json:"payload,omitempty"`
+	Protected  string                 `json:"protected,omitempty"`
+	Header     map[string]interface{} `json:"header,omitempty"`
+	Signature  string                 `json:"signature,omitempty"`
+	Signatures []rawDetachedSignature `json:"signatures,omitempty"`
+}
+
+func parseDetachedJSON(s string) (*DetachedJWS, error) {
+	var raw rawDetachedJWS
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, errors.Wrap(err, "error parsing JWS")
+	}
+	if raw.Payload != nil && *raw.Payload != "" {
+		return nil, errors.New("error parsing JWS: payload is not detached")
+	}
+
+	sigs := raw.Signatures
+	switch {
+	case len(sigs) == 0 && raw.Signature != "":
+		sigs = []rawDetachedSignature{{Protected: raw.Protected, Header: raw.Header, Signature: raw.Signature}}
+	case len(sigs) == 0:
+		return nil, errors.New("error parsing JWS: missing signature")
+	case raw.Signature != "" || raw.Protected != "" || raw.Header != nil:
+		return nil, errors.New("error parsing JWS: general and flattened serializations cannot be mixed")
+	}
+
+	jws := &DetachedJWS{
+		Signatures: make([]DetachedSignature, len(sigs)),
+	}
+	for i, rs := range sigs {
+		sig, err := newDetachedSignature(rs.Protected, rs.Header, rs.Signature)
+		if err != nil {
+			return nil, err
+		}
+		// RFC 7797 requires the same b64 value in all signatures.
+		if i > 0 && sig.isEncoded() != jws.Signatures[0].isEncoded() {
+			return nil, errors.New("error parsing JWS: b64 header must be the same in all signatures")
+		}
+		jws.Signatures[i] = *sig
+	}
+	return jws, nil
+}
+
+func newDetachedSignature(protected string, header map[string]interface{}, signature string) (*DetachedSignature, error) {
+	if protected == "" {
+		return nil, errors.New("error parsing JWS: missing protected header")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(protected)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing JWS: invalid protected header")
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, errors.Wrap(err, "error parsing JWS: invalid protected header")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing JWS: invalid signature")
+	}
+	if err := validateCritical(m, header); err != nil {
+		return nil, err
+	}
+	return &DetachedSignature{
+		Protected:    m,
+		Header:       header,
+		Signature:    sig,
+		rawProtected: protected,
+	}, nil
+}
+
+// validateCritical validates the crit and b64 headers as defined in RFC 7515,
+// section 4.1.11 and RFC 7797, section 6.
+func validateCritical(protected, header map[string]interface{}) error {
+	for k := range header {
+		if _, ok := protected[k]; ok {
+			return errors.Errorf("error parsing JWS: header %s is in the protected and unprotected headers", k)
+		}
+	}
+	if _, ok := header["crit"]; ok {
+		return errors.New("error parsing JWS: crit header must be protected")
+	}
+	if _, ok := header["b64"]; ok {
+		return errors.New("error parsing JWS: b64 header must be protected")
+	}
+	if _, ok := protected["alg"].(string); !ok {
+		return errors.New("error parsing JWS: missing or invalid alg header")
+	}
+
+	critical := map[string]bool{}
+	if v, ok := protected["crit"]; ok {
+		list, ok := v.([]interface{})
+		if !ok || len(list) == 0 {
+			return errors.New("error parsing JWS: crit header must be a non-empty list")
+		}
+		for _, item := range list {
+			name, ok := item.(string)
+			if !ok {
+				return errors.New("error parsing JWS: crit header must be a list of strings")
+			}
+			if !supportedCritical[name] {
+				return errors.Errorf("error parsing JWS: unsupported critical header %s", name)
+			}
+			if _, ok := protected[name]; !ok {
+				return errors.Errorf("error parsing JWS: critical header %s is missing", name)
+			}
+			critical[name] = true
+		}
+	}
+
+	if v, ok := protected["b64"]; ok {
+		if _, ok := v.(bool); !ok {
+			return errors.New("error parsing JWS: b64 header must be a boolean")
+		}
+		if !critical["b64"] {
+			return errors.New("error parsing JWS: b64 header must be in the crit header")
+		}
+	}
+	return nil
+}
+
+// CompactSerialize serializes the JWS using the compact serialization with an
+// empty payload. It fails if the JWS has more than one signature.
+func (j *DetachedJWS) CompactSerialize() (string, error) {
+	if len(j.Signatures) != 1 {
+		return "", errors.New("compact serialization requires exactly one signature")
+	}
+	sig := j.Signatures[0]
+	if sig.Header != nil {
+		return "", errors.New("compact serialization does not support unprotected headers")
+	}
+	return sig.rawProtected + ".." + base64.RawURLEncoding.EncodeToString(sig.Signature), nil
+}
+
+// FullSerialize serializes the JWS using the JSON serialization without the
+// payload member. The flattened syntax is used if the JWS has only one
+// signature.
+func (j *DetachedJWS) FullSerialize() string {
+	var raw rawDetachedJWS
+	if len(j.Signatures) == 1 {
+		sig := j.Signatures[0]
+		raw.Protected = sig.rawProtected
+		raw.Header = sig.Header
+		raw.Signature = base64.RawURLEncoding.EncodeToString(sig.Signature)
+	} else {
+		raw.Signatures = make([]rawDetachedSignature, len(j.Signatures))
+		for i, sig := range j.Signatures {
+			raw.Signatures[i] = rawDetachedSignature{
+				Protected: sig.rawProtected,
+				Header:    sig.Header,
+				Signature: base64.RawURLEncoding.EncodeToString(sig.Signature),
+			}
+		}
+	}
+	b, _ := json.Marshal(raw)
+	return string(b)
+}
+
+// Verify verifies the JWS using the payload read from the given reader and the
+// given key. If the JWS has multiple signatures, it returns the index of the
+// first signature verified. Only signatures with an algorithm compatible with
+// the key are verified. The payload is read into memory before verifying it.
+//
+// The key can be a []byte for HMAC algorithms, a public key, or a *JSONWebKey
+// with one of them.
+func (j *DetachedJWS) Verify(payload io.Reader, key interface{}) (int, error) {
+	if len(j.Signatures) == 0 {
+		return -1, errors.New("jws does not have signatures")
+	}
+
+	jwk, ok := key.(*JSONWebKey)
+	if !ok {
+		jwk = &JSONWebKey{Key: key}
+	}
+
+	encoded := j.Signatures[0].isEncoded()
+	var indexes []int
+	var keys []interface{}
+	for i := range j.Signatures {
+		sig := &j.Signatures[i]
+		if sig.isEncoded() != encoded {
+			return -1, errors.New("b64 header must be the same in all signatures")
+		}
+		if jwk.KeyID != "" && sig.KeyID() != "" && jwk.KeyID != sig.KeyID() {
+			continue
+		}
+		pub, ok := verificationKey(jwk, sig.Algorithm())
+		if !ok {
+			continue
+		}
+		if k, ok := pub.(x25519.PublicKey); ok {
+			pub = X25519Verifier(k)
+		}
+		indexes = append(indexes, i)
+		keys = append(keys, pub)
+	}
+	if len(keys) == 0 {
+		return -1, errors.New("jws does not have signatures compatible with the key")
+	}
+
+	data, err := io.ReadAll(payload)
+	if err != nil {
+		return -1, errors.Wrap(err, "error reading payload")
+	}
+
+	for i, pub := range keys {
+		sig := &j.Signatures[indexes[i]]
+		obj, err := jose.ParseDetached(sig.rawProtected+".."+base64.RawURLEncoding.EncodeToString(sig.Signature), data)
+		if err != nil {
+			return -1, errors.Wrap(err, "error parsing signature")
+		}
+		if err := obj.DetachedVerify(data, pub); err == nil {
+			return indexes[i], nil
+		}
+	}
+	return -1, ErrCryptoFailure
+}
+
+// addCritical adds the given name to the crit header if it's not there.
+func addCritical(protected map[string]interface{}, name string) error {
+	var crit []string
+	switch v := protected["crit"].(type) {
+	case nil:
+	case []string:
+		crit = v
+	case []interface{}:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return errors.New("invalid crit header: value is not a list of strings")
+			}
+			crit = append(crit, s)
+		}
+	default:
+		return errors.New("invalid crit header: value is not a list of strings")
+	}
+	for _, s := range crit {
+		if s == name {
+			protected["crit"] = crit
+			return nil
+		}
+	}
+	protected["crit"] = append(crit, name)
+	return nil
+}
@@ -0,0 +1,263 @@
+package jose
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/x25519"
+)
+
+// RFC 7797, section 4.
+const (
+	rfc7797Key       = "AyM1SysPpbyDfgZld3umj1qzKObwVMkoqQ-EstJQLr_T-1qS0gZH75aKtMN3Yj0iPS4hcgUuTwjAzZr1Z9CAow"
+	rfc7797Payload   = "$.02"
+	rfc7797Encoded   = "eyJhbGciOiJIUzI1NiJ9..5mvfOroL-g7HyqJoozehmsaqmvTYGEq5jTI1gVvoEoQ"
+	rfc7797Unencoded = "eyJhbGciOiJIUzI1NiIsImI2NCI6ZmFsc2UsImNyaXQiOlsiYjY0Il19..A5dxf2s96_n5FLueVuW1Z_vh161FwXZC4YLPff6dmDY"
+)
+
+func TestSignDetached_rfc7797(t *testing.T) {
+	key, err := base64.RawURLEncoding.DecodeString(rfc7797Key)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name string
+		opts *SignerOptions
+		want string
+	}{
+		{"encoded", nil, rfc7797Encoded},
+		{"unencoded", new(SignerOptions).WithBase64(false), rfc7797Unencoded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jws, err := SignDetached(strings.NewReader(rfc7797Payload), SigningKey{Algorithm: HS256, Key: key}, tt.opts)
+			assert.FatalError(t, err)
+			s, err := jws.CompactSerialize()
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, s)
+
+			jws, err = ParseDetachedJWS(tt.want)
+			assert.FatalError(t, err)
+			i, err := jws.Verify(strings.NewReader(rfc7797Payload), key)
+			assert.FatalError(t, err)
+			assert.Equals(t, 0, i)
+
+			_, err = jws.Verify(strings.NewReader("$.03"), key)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSignDetached(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	assert.FatalError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	_, xKey, err := x25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	opaque, err := NewOpaqueSignerWithAlgorithm(p256, ES256)
+	assert.FatalError(t, err)
+
+	// Large payload with dots.
+	payload := bytes.Repeat([]byte("a large.artifact\n"), 100000)
+
+	tests := []struct {
+		name   string
+		key    SigningKey
+		pub    interface{}
+		goJose bool
+	}{
+		{"ES256", SigningKey{Algorithm: ES256, Key: p256}, p256.Public(), true},
+		{"ES512", SigningKey{Algorithm: ES512, Key: p521}, p521.Public(), true},
+		{"RS256", SigningKey{Algorithm: RS256, Key: rsaKey}, rsaKey.Public(), true},
+		{"PS384", SigningKey{Algorithm: PS384, Key: rsaKey}, rsaKey.Public(), true},
+		{"EdDSA", SigningKey{Algorithm: EdDSA, Key: edKey}, edKey.Public(), true},
+		{"XEdDSA", SigningKey{Algorithm: XEdDSA, Key: xKey}, xKey.Public(), false},
+		{"HS512", SigningKey{Algorithm: HS512, Key: []byte("a-secret")}, []byte("a-secret"), true},
+		{"opaque", SigningKey{Algorithm: ES256, Key: opaque}, &JSONWebKey{Key: p256.Public(), KeyID: opaque.Public().KeyID}, true},
+		{"crypto.Signer", SigningKey{Algorithm: ES256, Key: rawECDSASigner{p256}}, &JSONWebKey{Key: p256.Public(), KeyID: opaque.Public().KeyID}, true},
+		{"jwk", SigningKey{Algorithm: ES256, Key: &JSONWebKey{Key: p256, KeyID: "kid"}}, &JSONWebKey{Key: p256.Public(), KeyID: "kid"}, true},
+	}
+	for _, tt := range tests {
+		for _, b64 := range []bool{true, false} {
+			opts := new(SignerOptions).WithType("JWS")
+			name := tt.name + "/encoded"
+			if !b64 {
+				opts = opts.WithBase64(false)
+				name = tt.name + "/unencoded"
+			}
+			t.Run(name, func(t *testing.T) {
+				jws, err := SignDetached(bytes.NewReader(payload), tt.key, opts)
+				assert.FatalError(t, err)
+				assert.Equals(t, tt.key.Algorithm, jws.Signatures[0].Algorithm())
+				assert.Equals(t, "JWS", jws.Signatures[0].Protected["typ"])
+				if jwk, ok := tt.pub.(*JSONWebKey); ok {
+					assert.Equals(t, jwk.KeyID, jws.Signatures[0].KeyID())
+				}
+
+				compact, err := jws.CompactSerialize()
+				assert.FatalError(t, err)
+				assert.True(t, strings.Contains(compact, ".."))
+
+				for _, s := range []string{compact, jws.FullSerialize()} {
+					parsed, err := ParseDetachedJWS(s)
+					assert.FatalError(t, err)
+					i, err := parsed.Verify(bytes.NewReader(payload), tt.pub)
+					assert.FatalError(t, err)
+					assert.Equals(t, 0, i)
+
+					_, err = parsed.Verify(bytes.NewReader(payload[1:]), tt.pub)
+					assert.Error(t, err)
+				}
+
+				// Interoperability with go-jose.
+				if tt.goJose {
+					obj, err := jose.ParseDetached(compact, payload)
+					assert.FatalError(t, err)
+					assert.FatalError(t, obj.DetachedVerify(payload, tt.pub))
+				}
+			})
+		}
+	}
+}
+
+func TestSignDetachedMulti(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+
+	payload := []byte(`{"event":"push"}`)
+	jws, err := SignDetachedMulti(bytes.NewReader(payload), []SigningKey{
+		{Algorithm: ES256, Key: p256},
+		{Algorithm: PS256, Key: rsaKey},
+		{Algorithm: EdDSA, Key: edKey},
+	}, new(SignerOptions).WithBase64(false))
+	assert.FatalError(t, err)
+	assert.Len(t, 3, jws.Signatures)
+
+	_, err = jws.CompactSerialize()
+	assert.Error(t, err)
+
+	s := jws.FullSerialize()
+	var m map[string]interface{}
+	assert.FatalError(t, json.Unmarshal([]byte(s), &m))
+	assert.Nil(t, m["payload"])
+	assert.Len(t, 3, m["signatures"])
+
+	parsed, err := ParseDetachedJWS(s)
+	assert.FatalError(t, err)
+	for i, pub := range []crypto.PublicKey{p256.Public(), rsaKey.Public(), edKey.Public()} {
+		got, err := parsed.Verify(bytes.NewReader(payload), pub)
+		assert.FatalError(t, err)
+		assert.Equals(t, i, got)
+	}
+
+	_, err = parsed.Verify(bytes.NewReader(payload), other.Public())
+	assert.Error(t, err)
+	_, err = parsed.Verify(bytes.NewReader(payload), []byte("a-secret"))
+	assert.Error(t, err)
+}
+
+func TestSignDetached_fail(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name string
+		keys []SigningKey
+		opts *SignerOptions
+	}{
+		{"fail no keys", nil, nil},
+		{"fail alg", []SigningKey{{Algorithm: ES384, Key: p256}}, nil},
+		{"fail hmac alg", []SigningKey{{Algorithm: ES256, Key: []byte("a-secret")}}, nil},
+		{"fail unsupported alg", []SigningKey{{Algorithm: "none", Key: p256}}, nil},
+		{"fail key type", []SigningKey{{Algorithm: ES256, Key: "a-key"}}, nil},
+		{"fail b64", []SigningKey{{Algorithm: ES256, Key: p256}}, new(SignerOptions).WithHeader("b64", "false")},
+		{"fail embed jwk", []SigningKey{{Algorithm: HS256, Key: []byte("a-secret")}}, &SignerOptions{EmbedJWK: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := SignDetachedMulti(strings.NewReader("payload"), tt.keys, tt.opts)
+			assert.Error(t, err)
+		})
+	}
+
+	// Reader errors
+	_, err = SignDetached(io.MultiReader(strings.NewReader("payload"), iotestErrReader{}), SigningKey{Algorithm: ES256, Key: p256}, nil)
+	assert.Error(t, err)
+}
+
+type iotestErrReader struct{}
+
+func (iotestErrReader) Read([]byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+func TestParseDetachedJWS_fail(t *testing.T) {
+	header := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+	sig := base64.RawURLEncoding.EncodeToString([]byte("signature"))
+
+	tests := []struct {
+		name string
+		jws  string
+	}{
+		{"fail parts", "foo.bar"},
+		{"fail payload", header(`{"alg":"HS256"}`) + ".cGF5bG9hZA." + sig},
+		{"fail header base64", "%%.." + sig},
+		{"fail header json", header(`{"alg"`) + ".." + sig},
+		{"fail signature", header(`{"alg":"HS256"}`) + "..%%"},
+		{"fail no alg", header(`{"typ":"JWT"}`) + ".." + sig},
+		{"fail crit type", header(`{"alg":"HS256","b64":false,"crit":"b64"}`) + ".." + sig},
+		{"fail crit empty", header(`{"alg":"HS256","crit":[]}`) + ".." + sig},
+		{"fail crit item", header(`{"alg":"HS256","crit":[1]}`) + ".." + sig},
+		{"fail crit unsupported", header(`{"alg":"HS256","b64":false,"crit":["b64","exp"],"exp":1}`) + ".." + sig},
+		{"fail crit missing", header(`{"alg":"HS256","crit":["b64"]}`) + ".." + sig},
+		{"fail b64 not critical", header(`{"alg":"HS256","b64":false}`) + ".." + sig},
+		{"fail b64 type", header(`{"alg":"HS256","b64":"false","crit":["b64"]}`) + ".." + sig},
+		{"fail json", `{"protected":`},
+		{"fail json payload", `{"payload":"cGF5bG9hZA","protected":"` + header(`{"alg":"HS256"}`) + `","signature":"` + sig + `"}`},
+		{"fail json no signature", `{"protected":"` + header(`{"alg":"HS256"}`) + `"}`},
+		{"fail json no protected", `{"header":{"alg":"HS256"},"signature":"` + sig + `"}`},
+		{"fail json mixed", `{"signature":"` + sig + `","signatures":[{"protected":"` + header(`{"alg":"HS256"}`) + `","signature":"` + sig + `"}]}`},
+		{"fail json crit unprotected", `{"protected":"` + header(`{"alg":"HS256"}`) + `","header":{"crit":["b64"]},"signature":"` + sig + `"}`},
+		{"fail json b64 unprotected", `{"protected":"` + header(`{"alg":"HS256"}`) + `","header":{"b64":false},"signature":"` + sig + `"}`},
+		{"fail json duplicated header", `{"protected":"` + header(`{"alg":"HS256","kid":"1"}`) + `","header":{"kid":"2"},"signature":"` + sig + `"}`},
+		{"fail json b64 mismatch", `{"signatures":[{"protected":"` + header(`{"alg":"HS256"}`) + `","signature":"` + sig + `"},{"protected":"` + header(`{"alg":"HS256","b64":false,"crit":["b64"]}`) + `","signature":"` + sig + `"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseDetachedJWS(tt.jws)
+			assert.Error(t, err)
+		})
+	}
+
+	// Empty payload and unprotected headers are allowed in the JSON
+	// serialization.
+	jws, err := ParseDetachedJWS(`{"payload":"","protected":"` + header(`{"alg":"HS256"}`) + `","header":{"kid":"1"},"signature":"` + sig + `"}`)
+	assert.FatalError(t, err)
+	assert.Equals(t, "1", jws.Signatures[0].KeyID())
+	_, err = jws.CompactSerialize()
+	assert.Error(t, err)
+}
@@ -20,13 +20,19 @@ type PasswordPrompter func(s string) ([]byte, error)
 var PromptPassword PasswordPrompter
 
 // Encrypt returns the given data encrypted with the default encryption
-// algorithm (PBES2-HS256+A128KW).
+// algorithm (PBES2-HS256+A128KW). If the WithRecipients option is used, the
+// data will be encrypted to the given keys instead, and the returned JWE will
+// use the JSON serialization if there is more than one recipient.
 func Encrypt(data []byte, opts ...Option) (*JSONWebEncryption, error) {
 	ctx, err := new(context).apply(opts...)
 	if err != nil {
 		return nil, err
 	}
 
+	if len(ctx.recipients) > 0 {
+		return encryptToRecipients(data, ctx)
+	}
+
 	var passphrase []byte
 	switch {
 	case len(ctx.password) > 0:
@@ -61,7 +67,7 @@ func Encrypt(data []byte, opts ...Option) (*JSONWebEncryption, error) {
 		encrypterOptions.WithContentType(ContentType(ctx.contentType))
 	}
 
-	encrypter, err := NewEncrypter(DefaultEncAlgorithm, recipient, encrypterOptions)
+	encrypter, err := NewEncrypter(ctx.contentEncryption(), recipient, encrypterOptions)
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating cipher")
 	}
@@ -99,6 +105,18 @@ func Decrypt(data []byte, opts ...Option) ([]byte, error) {
 		return data, nil //nolint:nilerr // Return the given data if we cannot parse it as encrypted.
 	}
 
+	// Try with the given decryption key.
+	if ctx.decryptionKey != nil {
+		decrypter, err := newDecryptionKey(ctx.decryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		if _, _, data, err = enc.DecryptMulti(decrypter); err == nil {
+			return data, nil
+		}
+		return nil, errors.New("failed to decrypt JWE: invalid decryption key")
+	}
+
 	// Try with the given password.
 	if len(ctx.password) > 0 {
 		if data, err = enc.Decrypt(ctx.password); err == nil {
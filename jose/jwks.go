@@ -0,0 +1,427 @@
+package jose
+
+import (
+	"crypto"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultKeySetMaxAge is the default max-age used in the Cache-Control
+	// header by the KeySetHandler.
+	DefaultKeySetMaxAge = 5 * time.Minute
+
+	// DefaultKeySetCacheDuration is the time a RemoteKeySet caches a JWK Set if
+	// the response does not have a Cache-Control header with a max-age.
+	DefaultKeySetCacheDuration = 5 * time.Minute
+
+	// DefaultKeySetMinRefreshInterval is the minimum time between requests done
+	// by a RemoteKeySet to retrieve the JWK Set.
+	DefaultKeySetMinRefreshInterval = 30 * time.Second
+
+	// maxKeySetCacheDuration is the maximum time a RemoteKeySet caches a JWK
+	// Set, regardless of the max-age in the Cache-Control header.
+	maxKeySetCacheDuration = 24 * time.Hour
+
+	// maxKeySetSize is the maximum size of a JWK Set retrieved by a
+	// RemoteKeySet.
+	maxKeySetSize = 1 << 20
+)
+
+type keySetEntry struct {
+	signer crypto.Signer
+	jwk    JSONWebKey
+}
+
+// KeySetHandler is an http.Handler that publishes the public keys of a list of
+// signers as a JWK Set. The signers can be regular keys or keys in a KMS. The
+// kid of each key is its JWK thumbprint.
+//
+// To rotate a key, the new signer is added with Rotate, and the old one keeps
+// being published until it is explicitly removed, so tokens signed with the
+// old key can be verified during the rotation period.
+type KeySetHandler struct {
+	// MaxAge is the max-age set in the Cache-Control header, if it's 0
+	// DefaultKeySetMaxAge will be used. It must be set before serving
+	// requests.
+	MaxAge time.Duration
+
+	mu      sync.RWMutex
+	entries []keySetEntry
+	current string
+}
+
+// NewKeySetHandler creates a new KeySetHandler with the given signers. The
+// last signer will be the current one used by NewSigner.
+func NewKeySetHandler(signers ...crypto.Signer) (*KeySetHandler, error) {
+	h := new(KeySetHandler)
+	for _, s := range signers {
+		if _, err := h.Rotate(s); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// Add adds the public key of the given signer to the key set and returns its
+// kid. The current signer is not modified.
+func (h *KeySetHandler) Add(signer crypto.Signer) (string, error) {
+	entry, err := newKeySetEntry(signer)
+	if err != nil {
+		return "", err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.add(entry)
+	return entry.jwk.KeyID, nil
+}
+
+// Rotate adds the public key of the given signer to the key set, and makes it
+// the current signer. It returns the kid of the new key. Previous keys are
+// kept in the key set until they are removed.
+func (h *KeySetHandler) Rotate(signer crypto.Signer) (string, error) {
+	entry, err := newKeySetEntry(signer)
+	if err != nil {
+		return "", err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.add(entry)
+	h.current = entry.jwk.KeyID
+	return entry.jwk.KeyID, nil
+}
+
+// Remove removes the key with the given kid from the key set. It returns false
+// if the key was not found. The current key cannot be removed.
+func (h *KeySetHandler) Remove(kid string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if kid == h.current {
+		return false
+	}
+	for i := range h.entries {
+		if h.entries[i].jwk.KeyID == kid {
+			h.entries = append(h.entries[:i], h.entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// KeySet returns the JWK Set with the public keys.
+func (h *KeySetHandler) KeySet() *JSONWebKeySet {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	keys := make([]JSONWebKey, len(h.entries))
+	for i := range h.entries {
+		keys[i] = h.entries[i].jwk
+	}
+	return &JSONWebKeySet{Keys: keys}
+}
+
+// NewSigner returns a Signer using the current key. The signed tokens will
+// have the kid header with the thumbprint of the key.
+func (h *KeySetHandler) NewSigner(opts *SignerOptions) (Signer, error) {
+	h.mu.RLock()
+	var entry keySetEntry
+	for _, e := range h.entries {
+		if e.jwk.KeyID == h.current {
+			entry = e
+			break
+		}
+	}
+	h.mu.RUnlock()
+
+	if entry.signer == nil {
+		return nil, errors.New("key set does not have a current signer")
+	}
+	// Copy the options so the kid header is not added to the caller's ones.
+	so := new(SignerOptions)
+	if opts != nil {
+		*so = *opts
+		so.ExtraHeaders = make(map[HeaderKey]interface{}, len(opts.ExtraHeaders)+1)
+		for k, v := range opts.ExtraHeaders {
+			so.ExtraHeaders[k] = v
+		}
+	}
+	return NewSigner(SigningKey{
+		Algorithm: SignatureAlgorithm(entry.jwk.Algorithm),
+		Key:       NewOpaqueSigner(entry.signer),
+	}, so.WithHeader("kid", entry.jwk.KeyID))
+}
+
+// ServeHTTP implements the http.Handler interface and writes the JWK Set.
+func (h *KeySetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := json.Marshal(h.KeySet())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	maxAge := h.MaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultKeySetMaxAge
+	}
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write(b) //nolint:errcheck // nothing to do on failure
+	}
+}
+
+func (h *KeySetHandler) add(entry *keySetEntry) {
+	for i := range h.entries {
+		if h.entries[i].jwk.KeyID == entry.jwk.KeyID {
+			h.entries[i] = *entry
+			return
+		}
+	}
+	h.entries = append(h.entries, *entry)
+}
+
+func newKeySetEntry(signer crypto.Signer) (*keySetEntry, error) {
+	if signer == nil {
+		return nil, errors.New("signer cannot be nil")
+	}
+	opaque := NewOpaqueSigner(signer)
+	algs := opaque.Algs()
+	if len(algs) == 0 {
+		return nil, errors.Errorf("unsupported key type %T", signer.Public())
+	}
+	jwk := JSONWebKey{
+		Key:       signer.Public(),
+		Algorithm: string(algs[0]),
+		Use:       "sig",
+	}
+	kid, err := Thumbprint(&jwk)
+	if err != nil {
+		return nil, err
+	}
+	jwk.KeyID = kid
+	return &keySetEntry{signer: signer, jwk: jwk}, nil
+}
+
+// RemoteKeySetOption is the type used to configure a RemoteKeySet.
+type RemoteKeySetOption func(ks *RemoteKeySet)
+
+// WithHTTPClient sets the http.Client used to retrieve the JWK Set.
+func WithHTTPClient(client *http.Client) RemoteKeySetOption {
+	return func(ks *RemoteKeySet) {
+		ks.client = client
+	}
+}
+
+// WithCacheDuration sets the time the JWK Set will be cached if the response
+// does not have a Cache-Control header with a max-age.
+func WithCacheDuration(d time.Duration) RemoteKeySetOption {
+	return func(ks *RemoteKeySet) {
+		ks.cacheDuration = d
+	}
+}
+
+// WithMinRefreshInterval sets the minimum time between two requests to
+// retrieve the JWK Set. It applies to cache expirations, including responses
+// that disable the cache, and to requests for keys with an unknown kid.
+func WithMinRefreshInterval(d time.Duration) RemoteKeySetOption {
+	return func(ks *RemoteKeySet) {
+		ks.minRefreshInterval = d
+	}
+}
+
+// RemoteKeySet is a JWK Set retrieved from a URL. The key set is cached
+// following the Cache-Control header of the response, and it's refreshed if a
+// key with an unknown kid is requested, so keys added on a key rotation can be
+// used without waiting for the cache to expire. The JWK Set is never retrieved
+// more than once every minimum refresh interval.
+type RemoteKeySet struct {
+	url                string
+	client             *http.Client
+	cacheDuration      time.Duration
+	minRefreshInterval time.Duration
+	now                func() time.Time
+
+	mu        sync.Mutex
+	keySet    *JSONWebKeySet
+	expiresAt time.Time
+	fetchedAt time.Time
+	err       error
+}
+
+// NewRemoteKeySet creates a new RemoteKeySet that retrieves the keys from the
+// given URL. URLs must start with "https://".
+func NewRemoteKeySet(url string, opts ...RemoteKeySetOption) (*RemoteKeySet, error) {
+	if !strings.HasPrefix(url, "https://") {
+		return nil, errors.Errorf("invalid url %s: url must start with https://", url)
+	}
+	ks := &RemoteKeySet{
+		url:                url,
+		client:             &http.Client{Timeout: 30 * time.Second},
+		cacheDuration:      DefaultKeySetCacheDuration,
+		minRefreshInterval: DefaultKeySetMinRefreshInterval,
+		now:                time.Now,
+	}
+	for _, fn := range opts {
+		fn(ks)
+	}
+	return ks, nil
+}
+
+// KeySet returns the JWK Set, it will be retrieved from the URL if it's not
+// cached or if the cache has expired.
+func (ks *RemoteKeySet) KeySet() (*JSONWebKeySet, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if err := ks.maybeRefresh(false); err != nil {
+		return nil, err
+	}
+	return ks.keySet, nil
+}
+
+// Key returns the key with the given kid. If the key is not found, the JWK Set
+// will be retrieved again, at most once every minimum refresh interval.
+func (ks *RemoteKeySet) Key(kid string) (*JSONWebKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if err := ks.maybeRefresh(false); err != nil {
+		return nil, err
+	}
+	if jwk := lookupKey(ks.keySet, kid); jwk != nil {
+		return jwk, nil
+	}
+	if err := ks.maybeRefresh(true); err != nil {
+		return nil, err
+	}
+	if jwk := lookupKey(ks.keySet, kid); jwk != nil {
+		return jwk, nil
+	}
+	return nil, errors.Errorf("cannot find key with kid %s on %s", kid, ks.url)
+}
+
+// Verify validates the token payload with the key in the JWK Set with the kid
+// in the token header, and deserializes the token into the destination. If the
+// token does not have a kid, all the keys in the set will be tried.
+func (ks *RemoteKeySet) Verify(token *JSONWebToken, dest ...interface{}) error {
+	if len(token.Headers) == 0 {
+		return errors.New("token does not have a header")
+	}
+
+	if kid := token.Headers[0].KeyID; kid != "" {
+		jwk, err := ks.Key(kid)
+		if err != nil {
+			return err
+		}
+		return Verify(token, jwk.Key, dest...)
+	}
+
+	keySet, err := ks.KeySet()
+	if err != nil {
+		return err
+	}
+	for i := range keySet.Keys {
+		jwk := &keySet.Keys[i]
+		if jwk.Use == "enc" || (jwk.Algorithm != "" && jwk.Algorithm != token.Headers[0].Algorithm) {
+			continue
+		}
+		if err := Verify(token, jwk.Key, dest...); err == nil {
+			return nil
+		}
+	}
+	return errors.New("token cannot be verified with any key in the key set")
+}
+
+// maybeRefresh retrieves the JWK Set if it's not cached, if the cache has
+// expired, or if force is true, but only if the minimum refresh interval has
+// passed since the last attempt. Otherwise, it returns the error of the last
+// attempt, if any, and the cached JWK Set is used. It must be called with the
+// lock held.
+func (ks *RemoteKeySet) maybeRefresh(force bool) error {
+	now := ks.now()
+	if !force && ks.keySet != nil && now.Before(ks.expiresAt) {
+		return nil
+	}
+	if !ks.fetchedAt.IsZero() && now.Sub(ks.fetchedAt) < ks.minRefreshInterval {
+		return ks.err
+	}
+	ks.err = ks.refresh(now)
+	return ks.err
+}
+
+// refresh retrieves the JWK Set from the URL. It must be called with the lock
+// held. The time of the attempt is recorded even if it fails, so the minimum
+// refresh interval also limits the requests to a failing URL.
+func (ks *RemoteKeySet) refresh(now time.Time) error {
+	ks.fetchedAt = now
+
+	resp, err := ks.client.Get(ks.url)
+	if err != nil {
+		return errors.Wrapf(err, "error retrieving %s", ks.url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("error retrieving %s: status code %d", ks.url, resp.StatusCode)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxKeySetSize+1))
+	if err != nil {
+		return errors.Wrapf(err, "error retrieving %s", ks.url)
+	}
+	if len(b) > maxKeySetSize {
+		return errors.Errorf("error retrieving %s: response is too large", ks.url)
+	}
+	keySet := new(JSONWebKeySet)
+	if err := json.Unmarshal(b, keySet); err != nil {
+		return errors.Errorf("error reading %s: unsupported format", ks.url)
+	}
+
+	ks.keySet = keySet
+	ks.expiresAt = now.Add(cacheMaxAge(resp.Header.Get("Cache-Control"), ks.cacheDuration))
+	return nil
+}
+
+func lookupKey(keySet *JSONWebKeySet, kid string) *JSONWebKey {
+	if keys := keySet.Key(kid); len(keys) > 0 {
+		return &keys[0]
+	}
+	return nil
+}
+
+// cacheMaxAge returns the max-age in the given Cache-Control header, if the
+// header does not define it, it will return the given default duration. The
+// no-store and no-cache directives disable the cache. The max-age is limited
+// to maxKeySetCacheDuration.
+func cacheMaxAge(header string, defaultDuration time.Duration) time.Duration {
+	maxAge := defaultDuration
+	for _, directive := range strings.Split(header, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store" || directive == "no-cache":
+			return 0
+		case strings.HasPrefix(directive, "max-age="):
+			n, err := strconv.ParseInt(strings.TrimPrefix(directive, "max-age="), 10, 64)
+			switch {
+			case errors.Is(err, strconv.ErrRange) && n > 0, err == nil && n > int64(maxKeySetCacheDuration/time.Second):
+				maxAge = maxKeySetCacheDuration
+			case err == nil && n >= 0:
+				maxAge = time.Duration(n) * time.Second
+			}
+		}
+	}
+	return maxAge
+}
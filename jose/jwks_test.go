@@ -0,0 +1,344 @@
+package jose
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func mustSignToken(t *testing.T, h *KeySetHandler, claims Claims) *JSONWebToken {
+	t.Helper()
+	signer, err := h.NewSigner(nil)
+	assert.FatalError(t, err)
+	raw, err := Signed(signer).Claims(claims).CompactSerialize()
+	assert.FatalError(t, err)
+	tok, err := ParseSigned(raw)
+	assert.FatalError(t, err)
+	return tok
+}
+
+func TestKeySetHandler(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+
+	h, err := NewKeySetHandler(ecKey, rsaKey)
+	assert.FatalError(t, err)
+
+	ecKid, err := Thumbprint(&JSONWebKey{Key: ecKey.Public()})
+	assert.FatalError(t, err)
+	rsaKid, err := Thumbprint(&JSONWebKey{Key: rsaKey.Public()})
+	assert.FatalError(t, err)
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	assert.FatalError(t, err)
+	defer resp.Body.Close()
+	assert.Equals(t, http.StatusOK, resp.StatusCode)
+	assert.Equals(t, "application/jwk-set+json", resp.Header.Get("Content-Type"))
+	assert.Equals(t, "public, max-age=300", resp.Header.Get("Cache-Control"))
+
+	var keySet JSONWebKeySet
+	assert.FatalError(t, json.NewDecoder(resp.Body).Decode(&keySet))
+	assert.Len(t, 2, keySet.Keys)
+	assert.Equals(t, ecKid, keySet.Keys[0].KeyID)
+	assert.Equals(t, "ES256", keySet.Keys[0].Algorithm)
+	assert.Equals(t, "sig", keySet.Keys[0].Use)
+	assert.True(t, keySet.Keys[0].IsPublic())
+	assert.Equals(t, rsaKid, keySet.Keys[1].KeyID)
+	assert.Equals(t, "RS256", keySet.Keys[1].Algorithm)
+	assert.True(t, keySet.Keys[1].IsPublic())
+
+	// The last signer is the current one.
+	tok := mustSignToken(t, h, Claims{Subject: "foo"})
+	assert.Equals(t, rsaKid, tok.Headers[0].KeyID)
+	assert.FatalError(t, Verify(tok, rsaKey.Public()))
+
+	// Rotate
+	edKid, err := h.Rotate(edKey)
+	assert.FatalError(t, err)
+	tok = mustSignToken(t, h, Claims{Subject: "foo"})
+	assert.Equals(t, edKid, tok.Headers[0].KeyID)
+	assert.Equals(t, "EdDSA", tok.Headers[0].Algorithm)
+	assert.Len(t, 3, h.KeySet().Keys)
+
+	// The current key cannot be removed.
+	assert.False(t, h.Remove(edKid))
+	assert.True(t, h.Remove(rsaKid))
+	assert.False(t, h.Remove(rsaKid))
+	assert.Len(t, 2, h.KeySet().Keys)
+
+	// Adding an existing key does not duplicate it.
+	kid, err := h.Add(ecKey)
+	assert.FatalError(t, err)
+	assert.Equals(t, ecKid, kid)
+	assert.Len(t, 2, h.KeySet().Keys)
+
+	// MaxAge and methods
+	h.MaxAge = time.Hour
+	resp, err = http.Head(srv.URL)
+	assert.FatalError(t, err)
+	resp.Body.Close()
+	assert.Equals(t, "public, max-age=3600", resp.Header.Get("Cache-Control"))
+	resp, err = http.Post(srv.URL, "application/json", nil)
+	assert.FatalError(t, err)
+	resp.Body.Close()
+	assert.Equals(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	// The signer options are not modified.
+	opts := new(SignerOptions).WithType("JWT")
+	signer, err := h.NewSigner(opts)
+	assert.FatalError(t, err)
+	assert.Equals(t, map[HeaderKey]interface{}{"typ": ContentType("JWT")}, opts.ExtraHeaders)
+	raw, err := Signed(signer).Claims(Claims{Subject: "foo"}).CompactSerialize()
+	assert.FatalError(t, err)
+	tok, err = ParseSigned(raw)
+	assert.FatalError(t, err)
+	assert.Equals(t, edKid, tok.Headers[0].KeyID)
+	assert.Equals(t, "JWT", tok.Headers[0].ExtraHeaders["typ"])
+
+	// Errors
+	_, err = NewKeySetHandler(nil)
+	assert.Error(t, err)
+	_, err = new(KeySetHandler).NewSigner(nil)
+	assert.Error(t, err)
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	oldKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	newKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.FatalError(t, err)
+
+	h, err := NewKeySetHandler(oldKey)
+	assert.FatalError(t, err)
+	h.MaxAge = time.Hour
+
+	var requests int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	ks, err := NewRemoteKeySet(srv.URL, WithHTTPClient(srv.Client()), WithMinRefreshInterval(time.Minute))
+	assert.FatalError(t, err)
+	ks.now = func() time.Time { return now }
+
+	var claims Claims
+	tok := mustSignToken(t, h, Claims{Subject: "old"})
+	assert.FatalError(t, ks.Verify(tok, &claims))
+	assert.Equals(t, "old", claims.Subject)
+	assert.Equals(t, int32(1), atomic.LoadInt32(&requests))
+
+	// Cached
+	assert.FatalError(t, ks.Verify(tok, &claims))
+	assert.Equals(t, int32(1), atomic.LoadInt32(&requests))
+
+	// Rotation, the unknown kid is not refreshed before the min interval.
+	_, err = h.Rotate(newKey)
+	assert.FatalError(t, err)
+	newTok := mustSignToken(t, h, Claims{Subject: "new"})
+	assert.Error(t, ks.Verify(newTok, &claims))
+	assert.Equals(t, int32(1), atomic.LoadInt32(&requests))
+
+	// After the min interval the unknown kid forces a refresh.
+	now = now.Add(time.Minute)
+	assert.FatalError(t, ks.Verify(newTok, &claims))
+	assert.Equals(t, "new", claims.Subject)
+	assert.Equals(t, int32(2), atomic.LoadInt32(&requests))
+
+	// The old key is still valid during the rotation.
+	assert.FatalError(t, ks.Verify(tok, &claims))
+	assert.Equals(t, "old", claims.Subject)
+	assert.Equals(t, int32(2), atomic.LoadInt32(&requests))
+
+	// Cache expiration
+	keySet, err := ks.KeySet()
+	assert.FatalError(t, err)
+	assert.Len(t, 2, keySet.Keys)
+	assert.True(t, h.Remove(tok.Headers[0].KeyID))
+	now = now.Add(time.Hour)
+	keySet, err = ks.KeySet()
+	assert.FatalError(t, err)
+	assert.Len(t, 1, keySet.Keys)
+	assert.Equals(t, int32(3), atomic.LoadInt32(&requests))
+	assert.Error(t, ks.Verify(tok, &claims))
+
+	// Token without kid
+	signer, err := NewSigner(SigningKey{Algorithm: ES384, Key: newKey}, nil)
+	assert.FatalError(t, err)
+	raw, err := Signed(signer).Claims(Claims{Subject: "no-kid"}).CompactSerialize()
+	assert.FatalError(t, err)
+	noKidTok, err := ParseSigned(raw)
+	assert.FatalError(t, err)
+	assert.FatalError(t, ks.Verify(noKidTok, &claims))
+	assert.Equals(t, "no-kid", claims.Subject)
+
+	signer, err = NewSigner(SigningKey{Algorithm: ES256, Key: oldKey}, nil)
+	assert.FatalError(t, err)
+	raw, err = Signed(signer).Claims(Claims{Subject: "no-kid"}).CompactSerialize()
+	assert.FatalError(t, err)
+	noKidTok, err = ParseSigned(raw)
+	assert.FatalError(t, err)
+	assert.Error(t, ks.Verify(noKidTok, &claims))
+}
+
+func TestRemoteKeySet_fail(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bad-json":
+			w.Write([]byte("not a jwks"))
+		case "/not-modified":
+			w.WriteHeader(http.StatusNotModified)
+		case "/too-large":
+			w.Write([]byte(`{"keys":[],"padding":"`))
+			w.Write(bytes.Repeat([]byte("a"), maxKeySetSize))
+			w.Write([]byte(`"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	_, err := NewRemoteKeySet("http://example.com/jwks")
+	assert.Error(t, err)
+
+	for _, path := range []string{"/not-found", "/bad-json", "/not-modified", "/too-large"} {
+		ks, err := NewRemoteKeySet(srv.URL+path, WithHTTPClient(srv.Client()))
+		assert.FatalError(t, err)
+		_, err = ks.KeySet()
+		assert.Error(t, err)
+		_, err = ks.Key("kid")
+		assert.Error(t, err)
+	}
+
+	// Untrusted certificate
+	ks, err := NewRemoteKeySet(srv.URL, WithHTTPClient(&http.Client{}))
+	assert.FatalError(t, err)
+	_, err = ks.KeySet()
+	assert.Error(t, err)
+}
+
+func TestRemoteKeySet_failThrottle(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	h, err := NewKeySetHandler(key)
+	assert.FatalError(t, err)
+	h.MaxAge = time.Hour
+
+	var requests, failing int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	ks, err := NewRemoteKeySet(srv.URL, WithHTTPClient(srv.Client()), WithMinRefreshInterval(time.Minute))
+	assert.FatalError(t, err)
+	ks.now = func() time.Time { return now }
+
+	_, err = ks.KeySet()
+	assert.FatalError(t, err)
+	assert.Equals(t, int32(1), atomic.LoadInt32(&requests))
+
+	// A failed refresh also waits for the min interval.
+	atomic.StoreInt32(&failing, 1)
+	now = now.Add(time.Minute)
+	_, err = ks.Key("unknown")
+	assert.Error(t, err)
+	assert.Equals(t, int32(2), atomic.LoadInt32(&requests))
+	_, err = ks.Key("unknown")
+	assert.Error(t, err)
+	assert.Equals(t, int32(2), atomic.LoadInt32(&requests))
+
+	now = now.Add(time.Minute)
+	_, err = ks.Key("unknown")
+	assert.Error(t, err)
+	assert.Equals(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestRemoteKeySet_noCache(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	h, err := NewKeySetHandler(key)
+	assert.FatalError(t, err)
+
+	for _, cacheControl := range []string{"no-store", "no-cache", "max-age=0"} {
+		t.Run(cacheControl, func(t *testing.T) {
+			var requests int32
+			srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				w.Header().Set("Cache-Control", cacheControl)
+				json.NewEncoder(w).Encode(h.KeySet())
+			}))
+			defer srv.Close()
+
+			now := time.Now()
+			ks, err := NewRemoteKeySet(srv.URL, WithHTTPClient(srv.Client()), WithMinRefreshInterval(time.Minute))
+			assert.FatalError(t, err)
+			ks.now = func() time.Time { return now }
+
+			// The JWK Set is not retrieved again before the min interval.
+			tok := mustSignToken(t, h, Claims{Subject: "subject"})
+			for i := 0; i < 3; i++ {
+				var claims Claims
+				assert.FatalError(t, ks.Verify(tok, &claims))
+				assert.Equals(t, "subject", claims.Subject)
+				_, err = ks.KeySet()
+				assert.FatalError(t, err)
+			}
+			assert.Equals(t, int32(1), atomic.LoadInt32(&requests))
+
+			now = now.Add(time.Minute)
+			_, err = ks.KeySet()
+			assert.FatalError(t, err)
+			assert.Equals(t, int32(2), atomic.LoadInt32(&requests))
+		})
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", time.Minute},
+		{"public, max-age=60", 60 * time.Second},
+		{"Max-Age=3600, must-revalidate", time.Hour},
+		{"no-store", 0},
+		{"max-age=120, no-cache", 0},
+		{"max-age=foo", time.Minute},
+		{"max-age=-1", time.Minute},
+		{"max-age=86400", 24 * time.Hour},
+		{"max-age=86401", 24 * time.Hour},
+		{"max-age=9223372036854775807", 24 * time.Hour},
+		{"max-age=99999999999999999999", 24 * time.Hour},
+		{"max-age=-99999999999999999999", time.Minute},
+	}
+	for _, tt := range tests {
+		assert.Equals(t, tt.want, cacheMaxAge(tt.header, time.Minute))
+	}
+}
@@ -0,0 +1,444 @@
+package jose
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// keyStoreCurrent is the name of the file that contains the name of the
+	// directory with the current version of the keys.
+	keyStoreCurrent = "current"
+	// keyStorePrefix is the prefix of the directories with the keys.
+	keyStorePrefix = "keys-"
+	// keyStoreExt is the extension used in the encrypted keys.
+	keyStoreExt = ".json"
+)
+
+// KeyStore is a directory of JWE encrypted JWKs indexed by kid. The keys are
+// encrypted with the options used to open the KeyStore, a password or a list
+// of recipients and a decryption key.
+//
+// The keys are stored in a versioned subdirectory, and a "current" file points
+// to the version in use. Rotate writes all the keys in a new subdirectory and
+// replaces the "current" file atomically, so an interrupted rotation always
+// leaves the keys encrypted with either the old or the new options.
+//
+// A KeyStore is safe for concurrent use, but a directory must not be used by
+// more than one process at the same time.
+type KeyStore struct {
+	dir     string
+	mu      sync.RWMutex
+	opts    []Option
+	current string
+}
+
+// OpenKeyStore opens the KeyStore in the given directory, creating it if it
+// does not exist. The options will be used to encrypt and decrypt the keys,
+// and they are usually WithPassword, WithPasswordPrompter, or WithRecipients
+// along with WithDecryptionKey. With WithPasswordPrompter, the password is
+// prompted once on each operation.
+func OpenKeyStore(dir string, opts ...Option) (*KeyStore, error) {
+	if _, err := new(context).apply(opts...); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "error creating key store")
+	}
+
+	ks := &KeyStore{
+		dir:  dir,
+		opts: opts,
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, keyStoreCurrent))
+	switch {
+	case os.IsNotExist(err):
+		if ks.current, err = ks.newVersion(); err != nil {
+			return nil, err
+		}
+		if err := ks.setCurrent(ks.current); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, errors.Wrap(err, "error reading key store")
+	default:
+		ks.current = strings.TrimSpace(string(b))
+		if !strings.HasPrefix(ks.current, keyStorePrefix) || filepath.Base(ks.current) != ks.current {
+			return nil, errors.Errorf("error reading key store: invalid version %q", ks.current)
+		}
+		if fi, err := os.Stat(filepath.Join(dir, ks.current)); err != nil || !fi.IsDir() {
+			return nil, errors.Errorf("error reading key store: version %q not found", ks.current)
+		}
+	}
+
+	// Remove versions left by interrupted rotations.
+	if err := ks.removeVersions(ks.current); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+// List returns the sorted list of kids in the KeyStore.
+func (ks *KeyStore) List() ([]string, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.list()
+}
+
+// Get returns the decrypted key with the given kid.
+func (ks *KeyStore) Get(kid string) (*JSONWebKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	filename, err := ks.filename(ks.current, kid)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading key %s", kid)
+	}
+	opts, err := promptPassword(ks.opts)
+	if err != nil {
+		return nil, err
+	}
+	return ks.decrypt(kid, b, opts)
+}
+
+// Add encrypts and stores the given key. If the key does not have a kid, the
+// JWK thumbprint will be used. It returns the kid of the stored key, and it
+// fails if a key with the same kid already exists.
+func (ks *KeyStore) Add(jwk *JSONWebKey) (string, error) {
+	switch {
+	case jwk == nil || jwk.Key == nil:
+		return "", errors.New("error adding key: key cannot be empty")
+	case jwk.IsPublic():
+		return "", errors.New("error adding key: key is not a private key")
+	}
+
+	key := *jwk
+	if key.KeyID == "" {
+		kid, err := Thumbprint(&key)
+		if err != nil {
+			return "", err
+		}
+		key.KeyID = kid
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	filename, err := ks.filename(ks.current, key.KeyID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filename); err == nil {
+		return "", errors.Wrapf(os.ErrExist, "error adding key %s", key.KeyID)
+	}
+	opts, err := promptPassword(ks.opts)
+	if err != nil {
+		return "", err
+	}
+	b, err := ks.encrypt(&key, opts)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(filename, b); err != nil {
+		return "", errors.Wrapf(err, "error adding key %s", key.KeyID)
+	}
+	return key.KeyID, nil
+}
+
+// Remove deletes the key with the given kid.
+func (ks *KeyStore) Remove(kid string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	filename, err := ks.filename(ks.current, kid)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filename); err != nil {
+		return errors.Wrapf(err, "error removing key %s", kid)
+	}
+	return nil
+}
+
+// Rotate re-encrypts all the keys with the given options, and uses them for
+// the following operations. The options must allow to encrypt and decrypt the
+// keys, for example WithPassword with the new passphrase, or WithRecipients
+// and WithDecryptionKey to move from PBES2 to a recipient key. If no options
+// are given, the keys are re-encrypted with the current ones, this will update
+// the PBES2 salt and iteration count.
+//
+// The rotation is atomic, if it fails the keys are left untouched.
+func (ks *KeyStore) Rotate(opts ...Option) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.rotate(opts)
+}
+
+// Upgrade re-encrypts all the keys if any of them was encrypted using PBES2
+// with an iteration count different than PBKDF2Iterations. It returns true if
+// the keys were re-encrypted.
+func (ks *KeyStore) Upgrade() (bool, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	kids, err := ks.list()
+	if err != nil {
+		return false, err
+	}
+
+	var upgrade bool
+	for _, kid := range kids {
+		filename, err := ks.filename(ks.current, kid)
+		if err != nil {
+			return false, err
+		}
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			return false, errors.Wrapf(err, "error reading key %s", kid)
+		}
+		enc, err := ParseEncrypted(string(b))
+		if err != nil {
+			return false, errors.Wrapf(err, "error parsing key %s", kid)
+		}
+		if v, ok := enc.Header.ExtraHeaders[HeaderKey("p2c")].(float64); ok && v != PBKDF2Iterations {
+			upgrade = true
+			break
+		}
+	}
+
+	if !upgrade {
+		return false, nil
+	}
+	if err := ks.rotate(nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (ks *KeyStore) rotate(opts []Option) error {
+	sameOpts := len(opts) == 0
+	if sameOpts {
+		opts = ks.opts
+	} else if _, err := new(context).apply(opts...); err != nil {
+		return err
+	}
+
+	kids, err := ks.list()
+	if err != nil {
+		return err
+	}
+
+	// Prompt for the current and new passwords only once.
+	currentOpts, err := promptPassword(ks.opts)
+	if err != nil {
+		return err
+	}
+	newOpts := currentOpts
+	if !sameOpts {
+		if newOpts, err = promptPassword(opts); err != nil {
+			return err
+		}
+	}
+
+	version, err := ks.newVersion()
+	if err != nil {
+		return err
+	}
+
+	for _, kid := range kids {
+		if err := ks.reencrypt(version, kid, currentOpts, newOpts); err != nil {
+			os.RemoveAll(filepath.Join(ks.dir, version))
+			return err
+		}
+	}
+
+	if err := ks.setCurrent(version); err != nil {
+		os.RemoveAll(filepath.Join(ks.dir, version))
+		return err
+	}
+
+	ks.opts = opts
+	ks.current = version
+	return ks.removeVersions(version)
+}
+
+// reencrypt decrypts the key with the given kid in the current version using
+// currentOpts, and writes it encrypted with newOpts in the given version.
+// Before writing it, it verifies that the key can be decrypted with newOpts.
+func (ks *KeyStore) reencrypt(version, kid string, currentOpts, newOpts []Option) error {
+	src, err := ks.filename(ks.current, kid)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(src)
+	if err != nil {
+		return errors.Wrapf(err, "error reading key %s", kid)
+	}
+	jwk, err := ks.decrypt(kid, b, currentOpts)
+	if err != nil {
+		return err
+	}
+	if b, err = ks.encrypt(jwk, newOpts); err != nil {
+		return err
+	}
+	if _, err := ks.decrypt(kid, b, newOpts); err != nil {
+		return errors.Wrapf(err, "error rotating key %s", kid)
+	}
+	dst, err := ks.filename(version, kid)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(dst, b); err != nil {
+		return errors.Wrapf(err, "error writing key %s", kid)
+	}
+	return nil
+}
+
+// promptPassword returns the given options with the password returned by the
+// password prompter in them, so the password is only prompted once per
+// operation instead of once per key. The options are returned as they are if
+// they don't use a password prompter.
+func promptPassword(opts []Option) ([]Option, error) {
+	ctx, err := new(context).apply(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.passwordPrompter == nil || len(ctx.password) > 0 ||
+		(len(ctx.recipients) > 0 && ctx.decryptionKey != nil) {
+		return opts, nil
+	}
+	pass, err := ctx.passwordPrompter(ctx.passwordPrompt)
+	if err != nil {
+		return nil, err
+	}
+	if len(pass) == 0 {
+		return nil, errors.New("error reading password: password cannot be empty")
+	}
+	return append(opts[:len(opts):len(opts)], WithPassword(pass)), nil
+}
+
+func (ks *KeyStore) list() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(ks.dir, ks.current))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading key store")
+	}
+	var kids []string
+	for _, e := range entries {
+		if name := e.Name(); !e.IsDir() && strings.HasSuffix(name, keyStoreExt) {
+			kids = append(kids, strings.TrimSuffix(name, keyStoreExt))
+		}
+	}
+	sort.Strings(kids)
+	return kids, nil
+}
+
+func (ks *KeyStore) filename(version, kid string) (string, error) {
+	if kid == "" || kid == "." || kid == ".." || strings.ContainsAny(kid, `/\`+"\x00") {
+		return "", errors.Errorf("invalid kid %q", kid)
+	}
+	return filepath.Join(ks.dir, version, kid+keyStoreExt), nil
+}
+
+func (ks *KeyStore) encrypt(jwk *JSONWebKey, opts []Option) ([]byte, error) {
+	b, err := json.Marshal(jwk)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling JWK")
+	}
+	opts = append(opts[:len(opts):len(opts)], WithContentType("jwk+json"))
+	enc, err := Encrypt(b, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(enc.FullSerialize()), nil
+}
+
+func (ks *KeyStore) decrypt(kid string, b []byte, opts []Option) (*JSONWebKey, error) {
+	if _, err := ParseEncrypted(string(b)); err != nil {
+		return nil, errors.Errorf("error reading key %s: key is not encrypted", kid)
+	}
+	opts = append(opts[:len(opts):len(opts)], WithFilename(kid))
+	b, err := Decrypt(b, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error decrypting key %s", kid)
+	}
+	jwk := new(JSONWebKey)
+	if err := json.Unmarshal(b, jwk); err != nil {
+		return nil, errors.Wrapf(err, "error reading key %s", kid)
+	}
+	if jwk.KeyID != kid {
+		return nil, errors.Errorf("error reading key %s: kid does not match", kid)
+	}
+	return jwk, nil
+}
+
+func (ks *KeyStore) newVersion() (string, error) {
+	dir, err := os.MkdirTemp(ks.dir, keyStorePrefix)
+	if err != nil {
+		return "", errors.Wrap(err, "error creating key store")
+	}
+	return filepath.Base(dir), nil
+}
+
+func (ks *KeyStore) setCurrent(version string) error {
+	if err := writeFileAtomic(filepath.Join(ks.dir, keyStoreCurrent), []byte(version+"\n")); err != nil {
+		return errors.Wrap(err, "error writing key store")
+	}
+	return nil
+}
+
+// removeVersions removes all the versions but the given one.
+func (ks *KeyStore) removeVersions(version string) error {
+	entries, err := os.ReadDir(ks.dir)
+	if err != nil {
+		return errors.Wrap(err, "error reading key store")
+	}
+	for _, e := range entries {
+		if name := e.Name(); e.IsDir() && name != version && strings.HasPrefix(name, keyStorePrefix) {
+			if err := os.RemoveAll(filepath.Join(ks.dir, name)); err != nil {
+				return errors.Wrap(err, "error removing old keys")
+			}
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes the data to a temporary file in the same directory
+// and renames it to the given filename.
+func writeFileAtomic(filename string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp-")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package jose
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func readCurrentVersion(t *testing.T, dir string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(dir, keyStoreCurrent))
+	assert.FatalError(t, err)
+	return filepath.Join(dir, string(b[:len(b)-1]))
+}
+
+func TestKeyStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keys")
+	ks, err := OpenKeyStore(dir, WithPassword([]byte("password")))
+	assert.FatalError(t, err)
+
+	kids, err := ks.List()
+	assert.FatalError(t, err)
+	assert.Len(t, 0, kids)
+
+	ecKey := mustGenerateJWK(t, "EC", "P-256", "", "sig", "", 0)
+	kid, err := ks.Add(ecKey)
+	assert.FatalError(t, err)
+	assert.Equals(t, ecKey.KeyID, kid)
+
+	edKey := mustGenerateJWK(t, "OKP", "Ed25519", "", "sig", "my-key", 0)
+	kid, err = ks.Add(edKey)
+	assert.FatalError(t, err)
+	assert.Equals(t, "my-key", kid)
+
+	// Key without kid
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.FatalError(t, err)
+	thumbprint, err := Thumbprint(&JSONWebKey{Key: key})
+	assert.FatalError(t, err)
+	kid, err = ks.Add(&JSONWebKey{Key: key})
+	assert.FatalError(t, err)
+	assert.Equals(t, thumbprint, kid)
+
+	kids, err = ks.List()
+	assert.FatalError(t, err)
+	assert.Len(t, 3, kids)
+
+	// Keys are encrypted
+	b, err := os.ReadFile(filepath.Join(readCurrentVersion(t, dir), "my-key.json"))
+	assert.FatalError(t, err)
+	enc, err := ParseEncrypted(string(b))
+	assert.FatalError(t, err)
+	assert.Equals(t, string(PBES2_HS256_A128KW), enc.Header.Algorithm)
+
+	// Reopen the key store
+	ks, err = OpenKeyStore(dir, WithPassword([]byte("password")))
+	assert.FatalError(t, err)
+	jwk, err := ks.Get("my-key")
+	assert.FatalError(t, err)
+	assert.Equals(t, edKey.Key, jwk.Key)
+	assert.Equals(t, "my-key", jwk.KeyID)
+
+	// Rotate passphrase
+	assert.FatalError(t, ks.Rotate(WithPassword([]byte("new-password"))))
+	jwk, err = ks.Get(ecKey.KeyID)
+	assert.FatalError(t, err)
+	assert.Equals(t, ecKey.Key, jwk.Key)
+
+	ks, err = OpenKeyStore(dir, WithPassword([]byte("password")))
+	assert.FatalError(t, err)
+	_, err = ks.Get(ecKey.KeyID)
+	assert.Error(t, err)
+
+	// Remove
+	ks, err = OpenKeyStore(dir, WithPassword([]byte("new-password")))
+	assert.FatalError(t, err)
+	assert.FatalError(t, ks.Remove(thumbprint))
+	kids, err = ks.List()
+	assert.FatalError(t, err)
+	want := []string{ecKey.KeyID, "my-key"}
+	sort.Strings(want)
+	assert.Equals(t, want, kids)
+
+	// Only one version is kept
+	entries, err := os.ReadDir(dir)
+	assert.FatalError(t, err)
+	assert.Len(t, 2, entries)
+}
+
+func TestKeyStore_rotateRecipients(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey := mustGenerateJWK(t, "RSA", "", "", "sig", "rsa", 0)
+	ecKey := mustGenerateJWK(t, "EC", "P-256", "", "sig", "ec", 0)
+	recipient := JSONWebKey{Key: rsaKey.Public().Key}
+
+	ks, err := OpenKeyStore(dir, WithRecipients(&recipient), WithDecryptionKey(rsaKey.Key))
+	assert.FatalError(t, err)
+	_, err = ks.Add(rsaKey)
+	assert.FatalError(t, err)
+	_, err = ks.Add(ecKey)
+	assert.FatalError(t, err)
+
+	// New options must be able to decrypt the keys
+	other := mustGenerateJWK(t, "EC", "P-256", "", "sig", "other", 0)
+	otherPublic := JSONWebKey{Key: other.Public().Key}
+	assert.Error(t, ks.Rotate(WithRecipients(&otherPublic)))
+	assert.Error(t, ks.Rotate(WithRecipients(&otherPublic), WithDecryptionKey(rsaKey.Key)))
+
+	// Failed rotations do not modify the key store
+	jwk, err := ks.Get("ec")
+	assert.FatalError(t, err)
+	assert.Equals(t, ecKey.Key, jwk.Key)
+	entries, err := os.ReadDir(dir)
+	assert.FatalError(t, err)
+	assert.Len(t, 2, entries)
+
+	assert.FatalError(t, ks.Rotate(WithRecipients(&otherPublic), WithDecryptionKey(other.Key)))
+	jwk, err = ks.Get("rsa")
+	assert.FatalError(t, err)
+	assert.True(t, rsaKey.Key.(*rsa.PrivateKey).Equal(jwk.Key))
+
+	b, err := os.ReadFile(filepath.Join(readCurrentVersion(t, dir), "rsa.json"))
+	assert.FatalError(t, err)
+	enc, err := ParseEncrypted(string(b))
+	assert.FatalError(t, err)
+	assert.Equals(t, string(ECDH_ES_A256KW), enc.Header.Algorithm)
+
+	// Upgrade does not apply to recipients
+	ok, err := ks.Upgrade()
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+}
+
+func TestKeyStore_Upgrade(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := OpenKeyStore(dir, WithPassword([]byte("password")))
+	assert.FatalError(t, err)
+
+	// Store a key encrypted with an old iteration count.
+	jwk := mustGenerateJWK(t, "EC", "P-256", "", "sig", "old", 0)
+	b, err := json.Marshal(jwk)
+	assert.FatalError(t, err)
+	encrypter, err := NewEncrypter(DefaultEncAlgorithm, Recipient{
+		Algorithm:  PBES2_HS256_A128KW,
+		Key:        []byte("password"),
+		PBES2Count: 1000,
+	}, nil)
+	assert.FatalError(t, err)
+	enc, err := encrypter.Encrypt(b)
+	assert.FatalError(t, err)
+	filename := filepath.Join(readCurrentVersion(t, dir), "old.json")
+	assert.FatalError(t, os.WriteFile(filename, []byte(enc.FullSerialize()), 0600))
+
+	ok, err := ks.Upgrade()
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+
+	b, err = os.ReadFile(filepath.Join(readCurrentVersion(t, dir), "old.json"))
+	assert.FatalError(t, err)
+	enc, err = ParseEncrypted(string(b))
+	assert.FatalError(t, err)
+	assert.Equals(t, float64(PBKDF2Iterations), enc.Header.ExtraHeaders["p2c"])
+
+	got, err := ks.Get("old")
+	assert.FatalError(t, err)
+	assert.Equals(t, jwk.Key, got.Key)
+
+	ok, err = ks.Upgrade()
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+}
+
+func TestKeyStore_passwordPrompter(t *testing.T) {
+	var prompts []string
+	prompter := func(password string) PasswordPrompter {
+		return func(s string) ([]byte, error) {
+			prompts = append(prompts, s)
+			return []byte(password), nil
+		}
+	}
+
+	dir := t.TempDir()
+	ks, err := OpenKeyStore(dir, WithPasswordPrompter("password", prompter("password")))
+	assert.FatalError(t, err)
+	for _, kid := range []string{"key-1", "key-2", "key-3"} {
+		_, err := ks.Add(mustGenerateJWK(t, "EC", "P-256", "", "sig", kid, 0))
+		assert.FatalError(t, err)
+	}
+	assert.Len(t, 3, prompts)
+
+	// Rotations prompt once for the current and once for the new password.
+	prompts = nil
+	assert.FatalError(t, ks.Rotate(WithPasswordPrompter("new password", prompter("new-password"))))
+	assert.Equals(t, []string{"password", "new password"}, prompts)
+
+	prompts = nil
+	assert.FatalError(t, ks.Rotate())
+	assert.Equals(t, []string{"new password"}, prompts)
+
+	prompts = nil
+	_, err = ks.Get("key-2")
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"new password"}, prompts)
+
+	ks, err = OpenKeyStore(dir, WithPassword([]byte("new-password")))
+	assert.FatalError(t, err)
+	_, err = ks.Get("key-3")
+	assert.FatalError(t, err)
+
+	// Prompt errors
+	ks, err = OpenKeyStore(dir, WithPasswordPrompter("password", func(string) ([]byte, error) {
+		return nil, errors.New("prompt failed")
+	}))
+	assert.FatalError(t, err)
+	_, err = ks.Get("key-1")
+	assert.Error(t, err)
+	assert.Error(t, ks.Rotate())
+
+	ks, err = OpenKeyStore(dir, WithPasswordPrompter("password", prompter("")))
+	assert.FatalError(t, err)
+	_, err = ks.Get("key-1")
+	assert.Error(t, err)
+}
+
+func TestKeyStore_fail(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := OpenKeyStore(dir, WithPassword([]byte("password")))
+	assert.FatalError(t, err)
+
+	jwk := mustGenerateJWK(t, "EC", "P-256", "", "sig", "key", 0)
+	_, err = ks.Add(jwk)
+	assert.FatalError(t, err)
+
+	_, err = ks.Add(jwk)
+	assert.True(t, errors.Is(err, os.ErrExist))
+	_, err = ks.Add(nil)
+	assert.Error(t, err)
+	pub := jwk.Public()
+	_, err = ks.Add(&pub)
+	assert.Error(t, err)
+
+	_, err = ks.Get("missing")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	assert.True(t, errors.Is(ks.Remove("missing"), os.ErrNotExist))
+	for _, kid := range []string{"", ".", "..", "../key", `a\b`} {
+		_, err = ks.Get(kid)
+		assert.Error(t, err)
+	}
+
+	// Unencrypted keys are not allowed
+	b, err := json.Marshal(mustGenerateJWK(t, "EC", "P-256", "", "sig", "plain", 0))
+	assert.FatalError(t, err)
+	assert.FatalError(t, os.WriteFile(filepath.Join(readCurrentVersion(t, dir), "plain.json"), b, 0600))
+	_, err = ks.Get("plain")
+	assert.Error(t, err)
+
+	// Invalid current version
+	assert.FatalError(t, os.WriteFile(filepath.Join(dir, keyStoreCurrent), []byte("../foo\n"), 0600))
+	_, err = OpenKeyStore(dir)
+	assert.Error(t, err)
+	assert.FatalError(t, os.WriteFile(filepath.Join(dir, keyStoreCurrent), []byte("keys-missing\n"), 0600))
+	_, err = OpenKeyStore(dir)
+	assert.Error(t, err)
+}
@@ -0,0 +1,166 @@
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// kmsSigner implements the OpaqueSigner interface using a crypto.Signer with a
+// fixed signature algorithm.
+type kmsSigner struct {
+	signer crypto.Signer
+	jwk    *JSONWebKey
+}
+
+// NewOpaqueSignerWithAlgorithm creates a new OpaqueSigner from a crypto.Signer,
+// like a key in a KMS, that signs with the given algorithm. If the algorithm
+// is empty, RS256 will be used with RSA keys, the algorithm for the curve with
+// EC keys, and EdDSA with Ed25519 keys.
+//
+// The public key of the signer has the JWK thumbprint as the kid, and it's set
+// in the kid header of the signed tokens.
+func NewOpaqueSignerWithAlgorithm(signer crypto.Signer, alg SignatureAlgorithm) (OpaqueSigner, error) {
+	if signer == nil {
+		return nil, errors.New("signer cannot be nil")
+	}
+
+	pub := signer.Public()
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		switch alg {
+		case "":
+			alg = DefaultRSASigAlgorithm
+		case RS256, RS384, RS512, PS256, PS384, PS512:
+		default:
+			return nil, errors.Errorf("alg '%s' is not compatible with kty 'RSA'", alg)
+		}
+	case *ecdsa.PublicKey:
+		crvAlg := SignatureAlgorithm(getECAlgorithm(k.Curve))
+		switch {
+		case crvAlg == "":
+			return nil, errors.Errorf("unsupported elliptic curve %s", k.Params().Name)
+		case alg == "":
+			alg = crvAlg
+		case alg != crvAlg:
+			return nil, errors.Errorf("alg '%s' is not compatible with kty 'EC' and crv '%s'", alg, k.Params().Name)
+		}
+	case ed25519.PublicKey:
+		switch alg {
+		case "":
+			alg = EdDSA
+		case EdDSA:
+		default:
+			return nil, errors.Errorf("alg '%s' is not compatible with kty 'OKP' and crv 'Ed25519'", alg)
+		}
+	default:
+		return nil, errors.Errorf("unsupported public key type %T", pub)
+	}
+
+	jwk := &JSONWebKey{
+		Key:       pub,
+		Algorithm: string(alg),
+		Use:       "sig",
+	}
+	kid, err := Thumbprint(jwk)
+	if err != nil {
+		return nil, err
+	}
+	jwk.KeyID = kid
+
+	return &kmsSigner{
+		signer: signer,
+		jwk:    jwk,
+	}, nil
+}
+
+// Public returns the public key of the signer.
+func (s *kmsSigner) Public() *JSONWebKey {
+	return s.jwk
+}
+
+// Algs returns the signature algorithm of the signer.
+func (s *kmsSigner) Algs() []SignatureAlgorithm {
+	return []SignatureAlgorithm{SignatureAlgorithm(s.jwk.Algorithm)}
+}
+
+// SignPayload signs the payload with the given algorithm. ECDSA signatures in
+// ASN.1 format are converted to the fixed size format defined in RFC 7518.
+func (s *kmsSigner) SignPayload(payload []byte, alg SignatureAlgorithm) ([]byte, error) {
+	if string(alg) != s.jwk.Algorithm {
+		return nil, errors.Errorf("signer does not support the signature algorithm %s", alg)
+	}
+
+	var opts crypto.SignerOpts
+	switch alg {
+	case EdDSA:
+		return s.signer.Sign(rand.Reader, payload, crypto.Hash(0))
+	case RS256, ES256:
+		opts = crypto.SHA256
+	case RS384, ES384:
+		opts = crypto.SHA384
+	case RS512, ES512:
+		opts = crypto.SHA512
+	case PS256:
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+	case PS384:
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA384}
+	case PS512:
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA512}
+	default:
+		return nil, errors.Errorf("unsupported signature algorithm %s", alg)
+	}
+
+	h := opts.HashFunc().New()
+	h.Write(payload)
+	sig, err := s.signer.Sign(rand.Reader, h.Sum(nil), opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "error signing payload")
+	}
+
+	if pub, ok := s.jwk.Key.(*ecdsa.PublicKey); ok {
+		return ecdsaRawSignature(pub, sig)
+	}
+	return sig, nil
+}
+
+// ecdsaRawSignature converts an ASN.1 ECDSA signature to the concatenation of
+// r and s, each one padded to the size of the curve. Signatures that are
+// already in this format are returned as they are.
+func ecdsaRawSignature(pub *ecdsa.PublicKey, sig []byte) ([]byte, error) {
+	size := (pub.Curve.Params().BitSize + 7) / 8
+
+	var esig struct {
+		R, S *big.Int
+	}
+	if rest, err := asn1.Unmarshal(sig, &esig); err != nil || len(rest) > 0 {
+		if len(sig) == 2*size {
+			return sig, nil
+		}
+		return nil, errors.New("error parsing ECDSA signature")
+	}
+
+	if esig.R.Sign() <= 0 || esig.S.Sign() <= 0 || esig.R.BitLen() > 8*size || esig.S.BitLen() > 8*size {
+		return nil, errors.New("error parsing ECDSA signature")
+	}
+
+	out := make([]byte, 2*size)
+	esig.R.FillBytes(out[:size])
+	esig.S.FillBytes(out[size:])
+	return out, nil
+}
+
+// NewOpaqueKeyDecrypter creates a new OpaqueKeyDecrypter that can be used to
+// decrypt a JWE with the given key. The key can be a *JSONWebKey wrapping one
+// of the supported keys, an *ecdsa.PrivateKey or x25519.PrivateKey for
+// ECDH-ES, a crypto.Decrypter for RSA-OAEP, like a key in a KMS, or a key
+// implementing the ECDHDecrypter interface for ECDH-ES.
+func NewOpaqueKeyDecrypter(key crypto.PrivateKey) (OpaqueKeyDecrypter, error) {
+	return newKeyDecrypter(key)
+}
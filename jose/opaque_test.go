@@ -0,0 +1,189 @@
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/x25519"
+)
+
+// rawECDSASigner returns signatures in the r||s format instead of ASN.1.
+type rawECDSASigner struct {
+	*ecdsa.PrivateKey
+}
+
+func (s rawECDSASigner) Sign(rnd io.Reader, digest []byte, _ crypto.SignerOpts) ([]byte, error) {
+	r, ss, err := ecdsa.Sign(rnd, s.PrivateKey, digest)
+	if err != nil {
+		return nil, err
+	}
+	size := (s.Curve.Params().BitSize + 7) / 8
+	out := make([]byte, 2*size)
+	r.FillBytes(out[:size])
+	ss.FillBytes(out[size:])
+	return out, nil
+}
+
+// badSigner returns always the same signature.
+type badSigner struct {
+	crypto.Signer
+	signature []byte
+}
+
+func (s badSigner) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
+	return s.signature, nil
+}
+
+func TestNewOpaqueSignerWithAlgorithm(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	assert.FatalError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name    string
+		signer  crypto.Signer
+		alg     SignatureAlgorithm
+		wantAlg SignatureAlgorithm
+	}{
+		{"P-256", p256, "", ES256},
+		{"P-256 raw", rawECDSASigner{p256}, ES256, ES256},
+		{"P-521", p521, "", ES512},
+		{"P-521 raw", rawECDSASigner{p521}, "", ES512},
+		{"RSA", rsaKey, "", RS256},
+		{"RS512", rsaKey, RS512, RS512},
+		{"PS256", rsaKey, PS256, PS256},
+		{"PS384", rsaKey, PS384, PS384},
+		{"Ed25519", edKey, "", EdDSA},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opaque, err := NewOpaqueSignerWithAlgorithm(tt.signer, tt.alg)
+			assert.FatalError(t, err)
+			assert.Equals(t, []SignatureAlgorithm{tt.wantAlg}, opaque.Algs())
+
+			kid, err := Thumbprint(&JSONWebKey{Key: tt.signer.Public()})
+			assert.FatalError(t, err)
+			assert.Equals(t, kid, opaque.Public().KeyID)
+			assert.Equals(t, string(tt.wantAlg), opaque.Public().Algorithm)
+
+			signer, err := NewSigner(SigningKey{Algorithm: tt.wantAlg, Key: opaque}, nil)
+			assert.FatalError(t, err)
+			raw, err := Signed(signer).Claims(Claims{Subject: "subject"}).CompactSerialize()
+			assert.FatalError(t, err)
+			tok, err := ParseSigned(raw)
+			assert.FatalError(t, err)
+			assert.Equals(t, kid, tok.Headers[0].KeyID)
+			assert.Equals(t, string(tt.wantAlg), tok.Headers[0].Algorithm)
+
+			var claims Claims
+			assert.FatalError(t, Verify(tok, tt.signer.Public(), &claims))
+			assert.Equals(t, "subject", claims.Subject)
+
+			// The signer only supports one algorithm.
+			_, err = opaque.SignPayload([]byte("payload"), HS256)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestNewOpaqueSignerWithAlgorithm_fail(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	assert.FatalError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	_, xKey, err := x25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name   string
+		signer crypto.Signer
+		alg    SignatureAlgorithm
+	}{
+		{"nil", nil, ""},
+		{"EC alg", p256, ES384},
+		{"EC curve", p224, ""},
+		{"RSA alg", rsaKey, ES256},
+		{"Ed25519 alg", edKey, ES256},
+		{"X25519", xKey, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewOpaqueSignerWithAlgorithm(tt.signer, tt.alg)
+			assert.Error(t, err)
+		})
+	}
+
+	// Invalid signatures
+	for _, sig := range [][]byte{[]byte("foo"), {0x30, 0x06, 0x02, 0x01, 0x00, 0x02, 0x01, 0x01}} {
+		opaque, err := NewOpaqueSignerWithAlgorithm(badSigner{p256, sig}, ES256)
+		assert.FatalError(t, err)
+		_, err = opaque.SignPayload([]byte("payload"), ES256)
+		assert.Error(t, err)
+	}
+}
+
+func TestNewOpaqueKeyDecrypter(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+
+	jwe, err := Encrypt([]byte("the-secret"), WithRecipients(&JSONWebKey{Key: rsaKey.Public()}))
+	assert.FatalError(t, err)
+
+	decrypter, err := NewOpaqueKeyDecrypter(&rsaDecrypter{rsaKey})
+	assert.FatalError(t, err)
+	got, err := jwe.Decrypt(decrypter)
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("the-secret"), got)
+
+	_, err = NewOpaqueKeyDecrypter([]byte("a-symmetric-key"))
+	assert.Error(t, err)
+	_, err = NewOpaqueKeyDecrypter(&JSONWebKey{Key: []byte("a-symmetric-key")})
+	assert.Error(t, err)
+}
+
+func TestNewOpaqueKeyDecrypter_jsonWebKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	_, xKey, err := x25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name string
+		key  crypto.PrivateKey
+		pub  crypto.PublicKey
+	}{
+		{"rsa", rsaKey, rsaKey.Public()},
+		{"ec", ecKey, ecKey.Public()},
+		{"x25519", xKey, xKey.Public()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwe, err := Encrypt([]byte("the-secret"), WithRecipients(&JSONWebKey{Key: tt.pub}))
+			assert.FatalError(t, err)
+
+			decrypter, err := NewOpaqueKeyDecrypter(&JSONWebKey{Key: tt.key})
+			assert.FatalError(t, err)
+			got, err := jwe.Decrypt(decrypter)
+			assert.FatalError(t, err)
+			assert.Equals(t, []byte("the-secret"), got)
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package jose
 
 import (
+	"crypto"
+
+	"github.com/pkg/errors"
 	"go.step.sm/crypto/internal/utils"
 )
 
@@ -13,6 +16,9 @@ type context struct {
 	passwordPrompt   string
 	passwordPrompter PasswordPrompter
 	contentType      string
+	enc              ContentEncryption
+	recipients       []*JSONWebKey
+	decryptionKey    crypto.PrivateKey
 }
 
 // apply the options to the context and returns an error if one of the options
@@ -26,6 +32,14 @@ func (ctx *context) apply(opts ...Option) (*context, error) {
 	return ctx, nil
 }
 
+// contentEncryption returns the content encryption algorithm to use.
+func (ctx *context) contentEncryption() ContentEncryption {
+	if ctx.enc == "" {
+		return DefaultEncAlgorithm
+	}
+	return ctx.enc
+}
+
 // Option is the type used to add attributes to the context.
 type Option func(ctx *context) error
 
@@ -123,3 +137,42 @@ func WithContentType(cty string) Option {
 		return nil
 	}
 }
+
+// WithContentEncryption sets the content encryption algorithm used by Encrypt.
+// It defaults to DefaultEncAlgorithm (A256GCM). X25519 recipients only support
+// the AES-GCM algorithms.
+func WithContentEncryption(enc ContentEncryption) Option {
+	return func(ctx *context) error {
+		if _, err := contentKeySize(enc); err != nil {
+			return err
+		}
+		ctx.enc = enc
+		return nil
+	}
+}
+
+// WithRecipients adds the public keys used to encrypt data. RSA keys use
+// RSA-OAEP-256 by default, and EC, X25519 keys use ECDH-ES+A256KW, the
+// algorithm can be changed setting the Algorithm property in the key.
+func WithRecipients(keys ...*JSONWebKey) Option {
+	return func(ctx *context) error {
+		for _, k := range keys {
+			if k == nil || k.Key == nil {
+				return errors.New("recipient cannot be empty")
+			}
+		}
+		ctx.recipients = append(ctx.recipients, keys...)
+		return nil
+	}
+}
+
+// WithDecryptionKey adds the private key used to decrypt a JWE encrypted with
+// a recipient key. The key can be a *JSONWebKey, a crypto.Decrypter for RSA
+// keys, or a key implementing the ECDHDecrypter interface for EC keys, like
+// keys in a KMS.
+func WithDecryptionKey(key crypto.PrivateKey) Option {
+	return func(ctx *context) error {
+		ctx.decryptionKey = key
+		return nil
+	}
+}
@@ -0,0 +1,501 @@
+package jose
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+
+	josecipher "github.com/go-jose/go-jose/v3/cipher"
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/internal/ecdhutil"
+	"go.step.sm/crypto/x25519"
+)
+
+// ECDHDecrypter is the interface implemented by private keys that can compute
+// an ECDH shared secret, like *ecdh.PrivateKey. Keys in a KMS can implement it
+// to decrypt JWEs using ECDH-ES key agreement.
+type ECDHDecrypter interface {
+	ECDH(remote *ecdh.PublicKey) ([]byte, error)
+}
+
+// encryptToRecipients encrypts the data to each one of the recipients in the
+// context. The returned JWE uses the compact serialization if it has only one
+// recipient, and the JSON serialization if it has more. RSA and EC recipients
+// use go-jose, X25519 recipients, not supported by go-jose, are encrypted by
+// encryptToX25519Recipients and cannot be combined with other key types.
+func encryptToRecipients(data []byte, ctx *context) (*JSONWebEncryption, error) {
+	var x25519Recipients int
+	for _, jwk := range ctx.recipients {
+		if _, ok := jwk.Key.(x25519.PublicKey); ok {
+			x25519Recipients++
+		}
+	}
+	switch {
+	case x25519Recipients == len(ctx.recipients):
+		return encryptToX25519Recipients(data, ctx)
+	case x25519Recipients > 0:
+		return nil, errors.New("X25519 recipients cannot be combined with other key types")
+	}
+
+	recipients := make([]Recipient, len(ctx.recipients))
+	for i, jwk := range ctx.recipients {
+		r, err := newRecipient(jwk)
+		if err != nil {
+			return nil, err
+		}
+		recipients[i] = r
+	}
+
+	opts := new(EncrypterOptions)
+	if ctx.contentType != "" {
+		opts.WithContentType(ContentType(ctx.contentType))
+	}
+
+	var err error
+	var encrypter Encrypter
+	if len(recipients) == 1 {
+		encrypter, err = NewEncrypter(ctx.contentEncryption(), recipients[0], opts)
+	} else {
+		encrypter, err = NewMultiEncrypter(ctx.contentEncryption(), recipients, opts)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating cipher")
+	}
+
+	jwe, err := encrypter.Encrypt(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encrypting data")
+	}
+	return jwe, nil
+}
+
+// newRecipient returns the go-jose recipient for an RSA or EC key.
+func newRecipient(jwk *JSONWebKey) (Recipient, error) {
+	alg := KeyAlgorithm(jwk.Algorithm)
+	switch key := jwk.Key.(type) {
+	case *rsa.PublicKey:
+		switch alg {
+		case "":
+			alg = DefaultRSAKeyAlgorithm
+		case RSA_OAEP, RSA_OAEP_256:
+		default:
+			return Recipient{}, errors.Errorf("unsupported key algorithm %s for RSA keys", alg)
+		}
+		return Recipient{Algorithm: alg, Key: key, KeyID: jwk.KeyID}, nil
+	case *ecdsa.PublicKey, *ecdh.PublicKey:
+		switch alg {
+		case "":
+			alg = ECDH_ES_A256KW
+		case ECDH_ES, ECDH_ES_A128KW, ECDH_ES_A192KW, ECDH_ES_A256KW:
+		default:
+			return Recipient{}, errors.Errorf("unsupported key algorithm %s for EC keys", alg)
+		}
+		pub, err := toECDSAPublicKey(key)
+		if err != nil {
+			return Recipient{}, err
+		}
+		return Recipient{Algorithm: alg, Key: pub, KeyID: jwk.KeyID}, nil
+	default:
+		return Recipient{}, errors.Errorf("unsupported recipient key type %T", jwk.Key)
+	}
+}
+
+// toECDSAPublicKey converts an *ecdh.PublicKey on a NIST curve to the
+// *ecdsa.PublicKey supported by go-jose.
+func toECDSAPublicKey(key crypto.PublicKey) (*ecdsa.PublicKey, error) {
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		return k, nil
+	case *ecdh.PublicKey:
+		return ecdhutil.ToECDSAPublicKey(k)
+	default:
+		return nil, errors.Errorf("unsupported key type %T", key)
+	}
+}
+
+// jweRecipient is the JSON representation of a recipient in the JWE JSON
+// serialization.
+type jweRecipient struct {
+	Header       map[string]interface{} `json:"header,omitempty"`
+	EncryptedKey string                 `json:"encrypted_key,omitempty"`
+}
+
+// jweJSON is the JWE JSON serialization.
+type jweJSON struct {
+	Protected  string         `json:"protected"`
+	Recipients []jweRecipient `json:"recipients"`
+	IV         string         `json:"iv"`
+	Ciphertext string         `json:"ciphertext"`
+	Tag        string         `json:"tag"`
+}
+
+// encryptToX25519Recipients encrypts the data with a random content encryption
+// key, and encrypts that key to each one of the X25519 recipients in the
+// context using ECDH-ES key agreement. Only AES-GCM content encryption is
+// supported.
+func encryptToX25519Recipients(data []byte, ctx *context) (*JSONWebEncryption, error) {
+	enc := ctx.contentEncryption()
+	switch enc {
+	case A128GCM, A192GCM, A256GCM:
+	default:
+		return nil, errors.Errorf("content encryption %s is not supported with X25519 recipients", enc)
+	}
+	keySize, err := contentKeySize(enc)
+	if err != nil {
+		return nil, err
+	}
+
+	// ECDH-ES uses the derived key as the content encryption key, so it can
+	// only be used with one recipient.
+	var cek []byte
+	if len(ctx.recipients) > 1 {
+		for _, jwk := range ctx.recipients {
+			if KeyAlgorithm(jwk.Algorithm) == ECDH_ES {
+				return nil, errors.Errorf("key algorithm %s cannot be used with multiple recipients", ECDH_ES)
+			}
+		}
+	}
+	if KeyAlgorithm(ctx.recipients[0].Algorithm) != ECDH_ES {
+		cek = make([]byte, keySize)
+		if _, err := rand.Read(cek); err != nil {
+			return nil, errors.Wrap(err, "error generating content encryption key")
+		}
+	}
+
+	protected := map[string]interface{}{
+		"enc": enc,
+	}
+	if ctx.contentType != "" {
+		protected["cty"] = ctx.contentType
+	}
+
+	recipients := make([]jweRecipient, len(ctx.recipients))
+	for i, jwk := range ctx.recipients {
+		header, encryptedKey, err := encryptX25519Key(&cek, enc, keySize, jwk)
+		if err != nil {
+			return nil, err
+		}
+		recipients[i] = jweRecipient{
+			Header:       header,
+			EncryptedKey: base64.RawURLEncoding.EncodeToString(encryptedKey),
+		}
+	}
+
+	// Move the recipient header to the protected header if there's only one
+	// recipient, this allows to use the compact serialization.
+	if len(recipients) == 1 {
+		for k, v := range recipients[0].Header {
+			protected[k] = v
+		}
+		recipients[0].Header = nil
+	}
+
+	b, err := json.Marshal(protected)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling header")
+	}
+	protectedHeader := base64.RawURLEncoding.EncodeToString(b)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating cipher")
+	}
+	iv := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return nil, errors.Wrap(err, "error generating iv")
+	}
+	ciphertext := aead.Seal(nil, iv, data, []byte(protectedHeader))
+	n := len(ciphertext) - aead.Overhead()
+
+	b, err = json.Marshal(jweJSON{
+		Protected:  protectedHeader,
+		Recipients: recipients,
+		IV:         base64.RawURLEncoding.EncodeToString(iv),
+		Ciphertext: base64.RawURLEncoding.EncodeToString(ciphertext[:n]),
+		Tag:        base64.RawURLEncoding.EncodeToString(ciphertext[n:]),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling JWE")
+	}
+	return ParseEncrypted(string(b))
+}
+
+// encryptX25519Key encrypts the content encryption key to the given X25519
+// recipient and returns the recipient header and the encrypted key. With
+// ECDH-ES, the content encryption key is the derived one, and it's set in cek.
+func encryptX25519Key(cek *[]byte, enc ContentEncryption, keySize int, jwk *JSONWebKey) (map[string]interface{}, []byte, error) {
+	alg := KeyAlgorithm(jwk.Algorithm)
+	if alg == "" {
+		alg = ECDH_ES_A256KW
+	}
+	kekSize := keySize
+	if alg != ECDH_ES {
+		var err error
+		if kekSize, err = keyWrapSize(alg); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	pub, err := ecdh.X25519().NewPublicKey(jwk.Key.(x25519.PublicKey))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid x25519 key")
+	}
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error generating ephemeral key")
+	}
+	z, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error deriving key")
+	}
+
+	header := map[string]interface{}{
+		"alg": alg,
+		"epk": map[string]interface{}{
+			"kty": OKP,
+			"crv": "X25519",
+			"x":   base64.RawURLEncoding.EncodeToString(priv.PublicKey().Bytes()),
+		},
+	}
+	if jwk.KeyID != "" {
+		header["kid"] = jwk.KeyID
+	}
+
+	if alg == ECDH_ES {
+		*cek = deriveECDHES(string(enc), nil, nil, z, kekSize)
+		return header, nil, nil
+	}
+	block, err := aes.NewCipher(deriveECDHES(string(alg), nil, nil, z, kekSize))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error creating cipher")
+	}
+	encryptedKey, err := josecipher.KeyWrap(block, *cek)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error encrypting key")
+	}
+	return header, encryptedKey, nil
+}
+
+// newDecryptionKey returns the key used to decrypt a JWE. RSA and ECDSA
+// private keys are used directly by go-jose, other keys, like X25519 keys or
+// keys in a KMS, are wrapped in a keyDecrypter.
+func newDecryptionKey(key crypto.PrivateKey) (interface{}, error) {
+	if jwk, ok := key.(*JSONWebKey); ok {
+		key = jwk.Key
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		return k, nil
+	default:
+		return newKeyDecrypter(key)
+	}
+}
+
+// keyDecrypter implements the go-jose OpaqueKeyDecrypter interface using a
+// crypto.Decrypter for RSA-OAEP, or an ECDHDecrypter for ECDH-ES.
+type keyDecrypter struct {
+	key crypto.PrivateKey
+}
+
+// newKeyDecrypter returns a keyDecrypter for the given key. The key can be
+// an *ecdsa.PrivateKey, an x25519.PrivateKey, an ECDHDecrypter or a
+// crypto.Decrypter, or a *JSONWebKey with one of them.
+func newKeyDecrypter(key crypto.PrivateKey) (*keyDecrypter, error) {
+	if jwk, ok := key.(*JSONWebKey); ok {
+		key = jwk.Key
+	}
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		priv, err := k.ECDH()
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid ECDSA key")
+		}
+		return &keyDecrypter{key: priv}, nil
+	case x25519.PrivateKey:
+		priv, err := ecdh.X25519().NewPrivateKey(k)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid x25519 key")
+		}
+		return &keyDecrypter{key: priv}, nil
+	case ECDHDecrypter, crypto.Decrypter:
+		return &keyDecrypter{key: k}, nil
+	default:
+		return nil, errors.Errorf("unsupported decryption key type %T", key)
+	}
+}
+
+// DecryptKey decrypts the content encryption key using the algorithm in the
+// header.
+func (d *keyDecrypter) DecryptKey(encryptedKey []byte, header Header) ([]byte, error) {
+	alg := KeyAlgorithm(header.Algorithm)
+	switch alg {
+	case RSA_OAEP, RSA_OAEP_256:
+		dec, ok := d.key.(crypto.Decrypter)
+		if !ok {
+			return nil, errors.Errorf("key %T does not support %s", d.key, alg)
+		}
+		h := crypto.SHA256
+		if alg == RSA_OAEP {
+			h = crypto.SHA1
+		}
+		return dec.Decrypt(rand.Reader, encryptedKey, &rsa.OAEPOptions{Hash: h})
+	case ECDH_ES, ECDH_ES_A128KW, ECDH_ES_A192KW, ECDH_ES_A256KW:
+		dec, ok := d.key.(ECDHDecrypter)
+		if !ok {
+			return nil, errors.Errorf("key %T does not support %s", d.key, alg)
+		}
+		pub, err := parseEPK(header.ExtraHeaders["epk"])
+		if err != nil {
+			return nil, err
+		}
+		z, err := dec.ECDH(pub)
+		if err != nil {
+			return nil, errors.Wrap(err, "error deriving key")
+		}
+		apu, err := headerBytes(header.ExtraHeaders["apu"])
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid apu header")
+		}
+		apv, err := headerBytes(header.ExtraHeaders["apv"])
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid apv header")
+		}
+		if alg == ECDH_ES {
+			enc, _ := header.ExtraHeaders["enc"].(string)
+			size, err := contentKeySize(ContentEncryption(enc))
+			if err != nil {
+				return nil, err
+			}
+			return deriveECDHES(enc, apu, apv, z, size), nil
+		}
+		size, err := keyWrapSize(alg)
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(deriveECDHES(string(alg), apu, apv, z, size))
+		if err != nil {
+			return nil, err
+		}
+		return josecipher.KeyUnwrap(block, encryptedKey)
+	default:
+		return nil, errors.Errorf("unsupported key algorithm %s", alg)
+	}
+}
+
+// deriveECDHES derives a key from the shared secret z using the Concat KDF
+// defined in RFC 7518, section 4.6.2.
+func deriveECDHES(algID string, apu, apv, z []byte, size int) []byte {
+	supPubInfo := make([]byte, 4)
+	binary.BigEndian.PutUint32(supPubInfo, uint32(size)*8)
+	reader := josecipher.NewConcatKDF(crypto.SHA256, z, lengthPrefixed([]byte(algID)),
+		lengthPrefixed(apu), lengthPrefixed(apv), supPubInfo, []byte{})
+	key := make([]byte, size)
+	// Read on the KDF will never fail
+	_, _ = reader.Read(key)
+	return key
+}
+
+func lengthPrefixed(data []byte) []byte {
+	out := make([]byte, len(data)+4)
+	binary.BigEndian.PutUint32(out, uint32(len(data)))
+	copy(out[4:], data)
+	return out
+}
+
+func keyWrapSize(alg KeyAlgorithm) (int, error) {
+	switch alg {
+	case ECDH_ES_A128KW:
+		return 16, nil
+	case ECDH_ES_A192KW:
+		return 24, nil
+	case ECDH_ES_A256KW:
+		return 32, nil
+	default:
+		return 0, errors.Errorf("unsupported key algorithm %s for EC keys", alg)
+	}
+}
+
+func contentKeySize(enc ContentEncryption) (int, error) {
+	switch enc {
+	case A128GCM:
+		return 16, nil
+	case A192GCM:
+		return 24, nil
+	case A256GCM, A128CBC_HS256:
+		return 32, nil
+	case A192CBC_HS384:
+		return 48, nil
+	case A256CBC_HS512:
+		return 64, nil
+	default:
+		return 0, errors.Errorf("unsupported content encryption %s", enc)
+	}
+}
+
+// parseEPK parses the ephemeral public key header.
+func parseEPK(v interface{}) (*ecdh.PublicKey, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("missing or invalid epk header")
+	}
+	kty, _ := m["kty"].(string)
+	crv, _ := m["crv"].(string)
+	x, err := headerBytes(m["x"])
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid epk header")
+	}
+
+	var curve ecdh.Curve
+	switch {
+	case kty == OKP && crv == "X25519":
+		pub, err := ecdh.X25519().NewPublicKey(x)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid epk header")
+		}
+		return pub, nil
+	case kty == EC && crv == P256:
+		curve = ecdh.P256()
+	case kty == EC && crv == P384:
+		curve = ecdh.P384()
+	case kty == EC && crv == P521:
+		curve = ecdh.P521()
+	default:
+		return nil, errors.Errorf("unsupported epk header with kty %q and crv %q", kty, crv)
+	}
+
+	y, err := headerBytes(m["y"])
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid epk header")
+	}
+	b := make([]byte, 0, 1+len(x)+len(y))
+	b = append(append(append(b, 0x04), x...), y...)
+	pub, err := curve.NewPublicKey(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid epk header")
+	}
+	return pub, nil
+}
+
+// headerBytes decodes a base64url encoded header value, a nil value is
+// decoded as an empty slice.
+func headerBytes(v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, errors.New("value is not a string")
+	}
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,252 @@
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/x25519"
+)
+
+// rsaDecrypter hides the *rsa.PrivateKey type, like a key in a KMS.
+type rsaDecrypter struct {
+	key *rsa.PrivateKey
+}
+
+func (d *rsaDecrypter) Public() crypto.PublicKey { return d.key.Public() }
+
+func (d *rsaDecrypter) Decrypt(rnd io.Reader, msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	return d.key.Decrypt(rnd, msg, opts)
+}
+
+// ecdhDecrypter hides the *ecdh.PrivateKey type, like a key in a KMS.
+type ecdhDecrypter struct {
+	key *ecdh.PrivateKey
+}
+
+func (d *ecdhDecrypter) ECDH(pub *ecdh.PublicKey) ([]byte, error) {
+	return d.key.ECDH(pub)
+}
+
+func TestEncrypt_recipients(t *testing.T) {
+	data := []byte("the-secret")
+
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	assert.FatalError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	xPub, xPriv, err := x25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	ecdhKey, err := ecdh.P384().GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name      string
+		recipient *JSONWebKey
+		key       crypto.PrivateKey
+		wantAlg   KeyAlgorithm
+	}{
+		{"P-256", &JSONWebKey{Key: &p256.PublicKey}, p256, ECDH_ES_A256KW},
+		{"P-256 jwk", &JSONWebKey{Key: &p256.PublicKey, KeyID: "kid"}, &JSONWebKey{Key: p256}, ECDH_ES_A256KW},
+		{"P-256 A128KW", &JSONWebKey{Key: &p256.PublicKey, Algorithm: string(ECDH_ES_A128KW)}, p256, ECDH_ES_A128KW},
+		{"P-256 direct", &JSONWebKey{Key: &p256.PublicKey, Algorithm: string(ECDH_ES)}, p256, ECDH_ES},
+		{"P-521 A192KW", &JSONWebKey{Key: &p521.PublicKey, Algorithm: string(ECDH_ES_A192KW)}, p521, ECDH_ES_A192KW},
+		{"P-384 ecdh", &JSONWebKey{Key: ecdhKey.PublicKey()}, &ecdhDecrypter{ecdhKey}, ECDH_ES_A256KW},
+		{"X25519", &JSONWebKey{Key: xPub}, xPriv, ECDH_ES_A256KW},
+		{"RSA", &JSONWebKey{Key: &rsaKey.PublicKey}, rsaKey, RSA_OAEP_256},
+		{"RSA decrypter", &JSONWebKey{Key: &rsaKey.PublicKey}, &rsaDecrypter{rsaKey}, RSA_OAEP_256},
+		{"RSA-OAEP", &JSONWebKey{Key: &rsaKey.PublicKey, Algorithm: string(RSA_OAEP)}, rsaKey, RSA_OAEP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwe, err := Encrypt(data, WithRecipients(tt.recipient), WithContentType("text/plain"))
+			assert.FatalError(t, err)
+
+			// A single recipient can use the compact serialization.
+			s, err := jwe.CompactSerialize()
+			assert.FatalError(t, err)
+			jwe, err = ParseEncrypted(s)
+			assert.FatalError(t, err)
+			assert.Equals(t, string(tt.wantAlg), jwe.Header.Algorithm)
+			assert.Equals(t, tt.recipient.KeyID, jwe.Header.KeyID)
+			assert.Equals(t, "text/plain", jwe.Header.ExtraHeaders["cty"])
+
+			got, err := Decrypt([]byte(s), WithDecryptionKey(tt.key))
+			assert.FatalError(t, err)
+			assert.Equals(t, data, got)
+
+			// Interoperability with go-jose.
+			if k, ok := tt.key.(*ecdsa.PrivateKey); ok {
+				got, err = jwe.Decrypt(k)
+				assert.FatalError(t, err)
+				assert.Equals(t, data, got)
+			}
+			if k, ok := tt.key.(*rsa.PrivateKey); ok {
+				got, err = jwe.Decrypt(k)
+				assert.FatalError(t, err)
+				assert.Equals(t, data, got)
+			}
+		})
+	}
+}
+
+func TestEncrypt_multipleRecipients(t *testing.T) {
+	data := []byte("the-secret")
+
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	xPub1, xPriv1, err := x25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	xPub2, xPriv2, err := x25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name       string
+		recipients []*JSONWebKey
+		keys       []crypto.PrivateKey
+	}{
+		{"ec and rsa", []*JSONWebKey{
+			{Key: &p256.PublicKey, KeyID: "p256"},
+			{Key: &rsaKey.PublicKey, KeyID: "rsa"},
+		}, []crypto.PrivateKey{p256, rsaKey, &rsaDecrypter{rsaKey}}},
+		{"x25519", []*JSONWebKey{
+			{Key: xPub1, KeyID: "x25519-1"},
+			{Key: xPub2, KeyID: "x25519-2", Algorithm: string(ECDH_ES_A128KW)},
+		}, []crypto.PrivateKey{xPriv1, xPriv2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwe, err := Encrypt(data, WithRecipients(tt.recipients...))
+			assert.FatalError(t, err)
+
+			// Multiple recipients require the JSON serialization.
+			_, err = jwe.CompactSerialize()
+			assert.Error(t, err)
+			s := jwe.FullSerialize()
+
+			for _, key := range tt.keys {
+				got, err := Decrypt([]byte(s), WithDecryptionKey(key))
+				assert.FatalError(t, err)
+				assert.Equals(t, data, got)
+			}
+
+			_, err = Decrypt([]byte(s), WithDecryptionKey(other))
+			assert.Error(t, err)
+		})
+	}
+
+	// X25519 recipients cannot be combined with other key types.
+	_, err = Encrypt(data, WithRecipients(
+		&JSONWebKey{Key: &p256.PublicKey},
+		&JSONWebKey{Key: xPub1},
+	))
+	assert.Error(t, err)
+
+	// The direct key agreement only supports one recipient.
+	_, err = Encrypt(data, WithRecipients(
+		&JSONWebKey{Key: &p256.PublicKey, Algorithm: string(ECDH_ES)},
+		&JSONWebKey{Key: &rsaKey.PublicKey},
+	))
+	assert.Error(t, err)
+	_, err = Encrypt(data, WithRecipients(
+		&JSONWebKey{Key: xPub1, Algorithm: string(ECDH_ES)},
+		&JSONWebKey{Key: xPub2},
+	))
+	assert.Error(t, err)
+}
+
+func TestEncrypt_contentEncryption(t *testing.T) {
+	data := []byte("the-secret")
+
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	xPub, xPriv, err := x25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name    string
+		pub     crypto.PublicKey
+		key     crypto.PrivateKey
+		enc     ContentEncryption
+		wantErr bool
+	}{
+		{"P-256 A128CBC-HS256", &p256.PublicKey, p256, A128CBC_HS256, false},
+		{"P-256 A128GCM", &p256.PublicKey, p256, A128GCM, false},
+		{"RSA A256CBC-HS512", &rsaKey.PublicKey, rsaKey, A256CBC_HS512, false},
+		{"X25519 A192GCM", xPub, xPriv, A192GCM, false},
+		{"fail X25519 A128CBC-HS256", xPub, xPriv, A128CBC_HS256, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwe, err := Encrypt(data, WithRecipients(&JSONWebKey{Key: tt.pub}), WithContentEncryption(tt.enc))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.FatalError(t, err)
+
+			s, err := jwe.CompactSerialize()
+			assert.FatalError(t, err)
+			jwe, err = ParseEncrypted(s)
+			assert.FatalError(t, err)
+			assert.Equals(t, string(tt.enc), jwe.Header.ExtraHeaders["enc"])
+
+			got, err := Decrypt([]byte(s), WithDecryptionKey(tt.key))
+			assert.FatalError(t, err)
+			assert.Equals(t, data, got)
+		})
+	}
+
+	_, err = Encrypt(data, WithRecipients(&JSONWebKey{Key: &p256.PublicKey}), WithContentEncryption("A512GCM"))
+	assert.Error(t, err)
+}
+
+func TestEncrypt_recipientsFail(t *testing.T) {
+	data := []byte("the-secret")
+
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"fail empty", []Option{WithRecipients(nil)}},
+		{"fail nil key", []Option{WithRecipients(&JSONWebKey{})}},
+		{"fail key type", []Option{WithRecipients(&JSONWebKey{Key: []byte("a-symmetric-key")})}},
+		{"fail ec algorithm", []Option{WithRecipients(&JSONWebKey{Key: &p256.PublicKey, Algorithm: string(RSA_OAEP_256)})}},
+		{"fail rsa algorithm", []Option{WithRecipients(&JSONWebKey{Key: &rsaKey.PublicKey, Algorithm: string(ECDH_ES_A256KW)})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Encrypt(data, tt.opts...)
+			assert.Error(t, err)
+		})
+	}
+
+	jwe, err := Encrypt(data, WithRecipients(&JSONWebKey{Key: &p256.PublicKey}))
+	assert.FatalError(t, err)
+	s, err := jwe.CompactSerialize()
+	assert.FatalError(t, err)
+
+	_, err = Decrypt([]byte(s), WithDecryptionKey([]byte("a-symmetric-key")))
+	assert.Error(t, err)
+	_, err = Decrypt([]byte(s), WithDecryptionKey(rsaKey))
+	assert.Error(t, err)
+}
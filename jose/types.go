@@ -91,12 +91,19 @@ type Audience = jwt.Audience
 // If field has zero value then validation is skipped.
 type Expected = jwt.Expected
 
+// DefaultLeeway defines the default leeway for matching NotBefore/Expiry claims.
+const DefaultLeeway = jwt.DefaultLeeway
+
 // Signer represents a signer which takes a payload and produces a signed JWS object.
 type Signer = jose.Signer
 
 // OpaqueSigner represents a jose.Signer that wraps a crypto.Signer
 type OpaqueSigner = jose.OpaqueSigner
 
+// OpaqueKeyDecrypter is an interface that supports decrypting keys with an
+// opaque private key.
+type OpaqueKeyDecrypter = jose.OpaqueKeyDecrypter
+
 // SigningKey represents an algorithm/key used to sign a message.
 type SigningKey = jose.SigningKey
 
@@ -231,6 +238,11 @@ func NewEncrypter(enc ContentEncryption, rcpt Recipient, opts *EncrypterOptions)
 	return jose.NewEncrypter(enc, rcpt, opts)
 }
 
+// NewMultiEncrypter creates a multi-encrypter based on the given parameters.
+func NewMultiEncrypter(enc ContentEncryption, rcpts []Recipient, opts *EncrypterOptions) (Encrypter, error) {
+	return jose.NewMultiEncrypter(enc, rcpts, opts)
+}
+
 // NewNumericDate constructs NumericDate from time.Time value.
 func NewNumericDate(t time.Time) *NumericDate {
 	return jwt.NewNumericDate(t)
@@ -0,0 +1,434 @@
+package jose
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/x25519"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrMalformedToken indicates that the token cannot be parsed.
+	ErrMalformedToken = errors.New("token is malformed")
+
+	// ErrInvalidAlgorithm indicates that the algorithm in the token header is
+	// not allowed.
+	ErrInvalidAlgorithm = errors.New("token algorithm is not allowed")
+
+	// ErrKeyNotFound indicates that there are no keys that can be used to
+	// verify the token.
+	ErrKeyNotFound = errors.New("token key not found")
+
+	// ErrInvalidSignature indicates that the token signature is not valid.
+	ErrInvalidSignature = errors.New("token signature is not valid")
+
+	// ErrMissingClaim indicates that a required claim is missing.
+	ErrMissingClaim = errors.New("token is missing a required claim")
+)
+
+// DefaultValidatorAlgorithms is the list of signature algorithms allowed by
+// default in a Validator. Symmetric algorithms must be explicitly allowed.
+var DefaultValidatorAlgorithms = []SignatureAlgorithm{
+	ES256, ES384, ES512,
+	RS256, RS384, RS512,
+	PS256, PS384, PS512,
+	EdDSA, XEdDSA,
+}
+
+// ValidationError is the error returned by a Validator. The underlying error
+// can be ErrMalformedToken, ErrInvalidAlgorithm, ErrKeyNotFound,
+// ErrInvalidSignature, ErrMissingClaim, ErrInvalidIssuer, ErrInvalidAudience,
+// ErrExpired, ErrNotValidYet or ErrIssuedInTheFuture, and it can be checked
+// using errors.Is.
+type ValidationError struct {
+	Err    error
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	if e.Reason == "" {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + ": " + e.Reason
+}
+
+// Unwrap returns the underlying error.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func newValidationError(err error, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{Err: err, Reason: fmt.Sprintf(format, args...)}
+}
+
+// KeyResolver is the interface used by a Validator to get the keys that can be
+// used to verify a token.
+type KeyResolver interface {
+	ResolveKeys(token *JSONWebToken) ([]JSONWebKey, error)
+}
+
+// KeyResolverFunc is an adapter to allow the use of ordinary functions as a
+// KeyResolver.
+type KeyResolverFunc func(token *JSONWebToken) ([]JSONWebKey, error)
+
+// ResolveKeys calls fn(token).
+func (fn KeyResolverFunc) ResolveKeys(token *JSONWebToken) ([]JSONWebKey, error) {
+	return fn(token)
+}
+
+// NewKeySetResolver returns a KeyResolver that returns the keys in the given
+// JWK Set. If the token has a kid, only the keys with the same kid are
+// returned.
+func NewKeySetResolver(keySet *JSONWebKeySet) KeyResolver {
+	return KeyResolverFunc(func(token *JSONWebToken) ([]JSONWebKey, error) {
+		if kid := token.Headers[0].KeyID; kid != "" {
+			keys := keySet.Key(kid)
+			if len(keys) == 0 {
+				return nil, errors.Errorf("cannot find key with kid %s", kid)
+			}
+			return keys, nil
+		}
+		return keySet.Keys, nil
+	})
+}
+
+// ResolveKeys implements the KeyResolver interface. If the token has a kid,
+// only the key with the same kid is returned, and if it's not found the key
+// set will be refreshed.
+func (ks *RemoteKeySet) ResolveKeys(token *JSONWebToken) ([]JSONWebKey, error) {
+	if kid := token.Headers[0].KeyID; kid != "" {
+		jwk, err := ks.Key(kid)
+		if err != nil {
+			return nil, err
+		}
+		return []JSONWebKey{*jwk}, nil
+	}
+	keySet, err := ks.KeySet()
+	if err != nil {
+		return nil, err
+	}
+	return keySet.Keys, nil
+}
+
+// NewX5CKeyResolver returns a KeyResolver that returns the public key of the
+// leaf certificate in the x5c header, after validating the certificate chain
+// against the given roots. The leaf certificate must be valid for digital
+// signatures and client authentication.
+func NewX5CKeyResolver(roots []*x509.Certificate) KeyResolver {
+	rootPool := x509.NewCertPool()
+	for _, crt := range roots {
+		rootPool.AddCert(crt)
+	}
+	return KeyResolverFunc(func(token *JSONWebToken) ([]JSONWebKey, error) {
+		chains, err := token.Headers[0].Certificates(x509.VerifyOptions{
+			Roots: rootPool,
+			KeyUsages: []x509.ExtKeyUsage{
+				x509.ExtKeyUsageClientAuth,
+			},
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "error verifying x5c certificate chain")
+		}
+		leaf := chains[0][0]
+		if leaf.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+			return nil, errors.New("certificate used to sign x5c token cannot be used for digital signature")
+		}
+		return []JSONWebKey{{Key: leaf.PublicKey, Certificates: chains[0]}}, nil
+	})
+}
+
+// SSHPOPKey is the key used to store the SSH certificate in the JWT header, as
+// returned by ValidateSSHPOP.
+const SSHPOPKey = "sshpop"
+
+// NewSSHPOPKeyResolver returns a KeyResolver that returns the public key of the
+// SSH certificate in the sshpop header, after validating that the certificate
+// is signed by one of the given certificate authorities and it's currently
+// valid.
+func NewSSHPOPKeyResolver(authorities ...ssh.PublicKey) KeyResolver {
+	return KeyResolverFunc(func(token *JSONWebToken) ([]JSONWebKey, error) {
+		v, ok := token.Headers[0].ExtraHeaders[HeaderKey(SSHPOPKey)]
+		if !ok {
+			return nil, errors.New("token missing sshpop header")
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.Errorf("token sshpop header has wrong type; expected string, but got %T", v)
+		}
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decoding sshpop header")
+		}
+		pub, err := ssh.ParsePublicKey(b)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing sshpop certificate")
+		}
+		cert, ok := pub.(*ssh.Certificate)
+		if !ok {
+			return nil, errors.New("token sshpop header is not an ssh certificate")
+		}
+
+		var trusted bool
+		signatureKey := cert.SignatureKey.Marshal()
+		for _, ca := range authorities {
+			if bytes.Equal(signatureKey, ca.Marshal()) {
+				trusted = true
+				break
+			}
+		}
+		if !trusted {
+			return nil, errors.New("sshpop certificate is not signed by a trusted authority")
+		}
+
+		// Principals and critical options are not relevant to sign a token.
+		var principal string
+		if len(cert.ValidPrincipals) > 0 {
+			principal = cert.ValidPrincipals[0]
+		}
+		checker := new(ssh.CertChecker)
+		for opt := range cert.CriticalOptions {
+			checker.SupportedCriticalOptions = append(checker.SupportedCriticalOptions, opt)
+		}
+		if err := checker.CheckCert(principal, cert); err != nil {
+			return nil, errors.Wrap(err, "error validating sshpop certificate")
+		}
+
+		key, err := keyutil.ExtractKey(cert)
+		if err != nil {
+			return nil, errors.Wrap(err, "error extracting public key from sshpop certificate")
+		}
+		return []JSONWebKey{{Key: key}}, nil
+	})
+}
+
+// ValidatorOption is the type used to configure a Validator.
+type ValidatorOption func(v *Validator) error
+
+// WithAllowedAlgorithms sets the list of signature algorithms allowed. The
+// algorithm "none" is never allowed.
+func WithAllowedAlgorithms(algs ...SignatureAlgorithm) ValidatorOption {
+	return func(v *Validator) error {
+		for _, alg := range algs {
+			if alg == "" || alg == "none" {
+				return errors.Errorf("algorithm %q is not allowed", alg)
+			}
+		}
+		v.algorithms = algs
+		return nil
+	}
+}
+
+// WithIssuers sets the list of allowed issuers. If set, the iss claim must be
+// one of them.
+func WithIssuers(issuers ...string) ValidatorOption {
+	return func(v *Validator) error {
+		v.issuers = issuers
+		return nil
+	}
+}
+
+// WithAudiences sets the list of allowed audiences. If set, the aud claim must
+// contain at least one of them.
+func WithAudiences(audiences ...string) ValidatorOption {
+	return func(v *Validator) error {
+		v.audiences = audiences
+		return nil
+	}
+}
+
+// WithLeeway sets the leeway used to validate the exp, nbf and iat claims.
+func WithLeeway(leeway time.Duration) ValidatorOption {
+	return func(v *Validator) error {
+		v.leeway = leeway
+		return nil
+	}
+}
+
+// WithRequiredClaims sets the list of claims that must be present in the
+// token.
+func WithRequiredClaims(claims ...string) ValidatorOption {
+	return func(v *Validator) error {
+		v.requiredClaims = claims
+		return nil
+	}
+}
+
+// WithKeyResolver sets the KeyResolver used to get the keys to verify a token.
+func WithKeyResolver(resolver KeyResolver) ValidatorOption {
+	return func(v *Validator) error {
+		v.resolver = resolver
+		return nil
+	}
+}
+
+// Validator verifies and validates signed JWTs. A Validator only accepts
+// tokens signed with one of the allowed algorithms, and only uses keys
+// compatible with the algorithm in the token.
+type Validator struct {
+	algorithms     []SignatureAlgorithm
+	issuers        []string
+	audiences      []string
+	leeway         time.Duration
+	requiredClaims []string
+	resolver       KeyResolver
+	now            func() time.Time
+}
+
+// NewValidator creates a new Validator with the given options. A KeyResolver
+// is required.
+func NewValidator(opts ...ValidatorOption) (*Validator, error) {
+	v := &Validator{
+		algorithms: DefaultValidatorAlgorithms,
+		leeway:     DefaultLeeway,
+		now:        time.Now,
+	}
+	for _, fn := range opts {
+		if err := fn(v); err != nil {
+			return nil, err
+		}
+	}
+	if v.resolver == nil {
+		return nil, errors.New("validator key resolver is required")
+	}
+	return v, nil
+}
+
+// Validate parses the given token, verifies its signature and validates its
+// claims. It returns the registered claims, and it deserializes the token into
+// the optional destinations. The destinations are only modified if the token is
+// valid. All the returned errors are a *ValidationError.
+func (v *Validator) Validate(token string, dest ...interface{}) (*Claims, error) {
+	tok, err := ParseSigned(token)
+	if err != nil {
+		return nil, &ValidationError{Err: ErrMalformedToken, Reason: err.Error()}
+	}
+	if len(tok.Headers) != 1 {
+		return nil, newValidationError(ErrMalformedToken, "token must have one signature")
+	}
+
+	alg := SignatureAlgorithm(tok.Headers[0].Algorithm)
+	if !v.isAllowed(alg) {
+		return nil, newValidationError(ErrInvalidAlgorithm, "algorithm %q is not allowed", alg)
+	}
+
+	keys, err := v.resolver.ResolveKeys(tok)
+	if err != nil {
+		return nil, &ValidationError{Err: ErrKeyNotFound, Reason: err.Error()}
+	}
+
+	var found bool
+	var claims Claims
+	var raw map[string]interface{}
+	for i := range keys {
+		key, ok := verificationKey(&keys[i], alg)
+		if !ok {
+			continue
+		}
+		found = true
+		if err := Verify(tok, key, &claims, &raw); err != nil {
+			continue
+		}
+		if err := v.validateClaims(&claims, raw); err != nil {
+			return nil, err
+		}
+		// The destinations are only filled after the claims are validated.
+		if len(dest) > 0 {
+			if err := tok.UnsafeClaimsWithoutVerification(dest...); err != nil {
+				return nil, &ValidationError{Err: ErrMalformedToken, Reason: err.Error()}
+			}
+		}
+		return &claims, nil
+	}
+	if !found {
+		return nil, newValidationError(ErrKeyNotFound, "no keys compatible with algorithm %q", alg)
+	}
+	return nil, &ValidationError{Err: ErrInvalidSignature}
+}
+
+func (v *Validator) validateClaims(claims *Claims, raw map[string]interface{}) error {
+	for _, name := range v.requiredClaims {
+		if _, ok := raw[name]; !ok {
+			return newValidationError(ErrMissingClaim, "claim %q is required", name)
+		}
+	}
+
+	if len(v.issuers) > 0 && !contains(v.issuers, claims.Issuer) {
+		return newValidationError(ErrInvalidIssuer, "issuer %q is not allowed", claims.Issuer)
+	}
+
+	if len(v.audiences) > 0 {
+		var ok bool
+		for _, aud := range v.audiences {
+			if claims.Audience.Contains(aud) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return newValidationError(ErrInvalidAudience, "audience %q is not allowed", claims.Audience)
+		}
+	}
+
+	if err := claims.ValidateWithLeeway(Expected{Time: v.now()}, v.leeway); err != nil {
+		return &ValidationError{Err: err}
+	}
+	return nil
+}
+
+func (v *Validator) isAllowed(alg SignatureAlgorithm) bool {
+	for _, a := range v.algorithms {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// verificationKey returns the key used to verify a signature with the given
+// algorithm. It returns false if the key is not compatible with the algorithm.
+func verificationKey(jwk *JSONWebKey, alg SignatureAlgorithm) (interface{}, bool) {
+	if jwk.Use == "enc" || (jwk.Algorithm != "" && jwk.Algorithm != string(alg)) {
+		return nil, false
+	}
+
+	if b, ok := jwk.Key.([]byte); ok {
+		return b, alg == HS256 || alg == HS384 || alg == HS512
+	}
+	key, err := keyutil.PublicKey(jwk.Key)
+	if err != nil {
+		return nil, false
+	}
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg {
+		case RS256, RS384, RS512, PS256, PS384, PS512:
+			return k, true
+		}
+	case *ecdsa.PublicKey:
+		return k, string(alg) == getECAlgorithm(k.Curve)
+	case ed25519.PublicKey:
+		return k, alg == EdDSA
+	case x25519.PublicKey:
+		return k, alg == XEdDSA
+	}
+	return nil, false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,347 @@
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func mustSignClaims(t *testing.T, key SigningKey, opts *SignerOptions, claims ...interface{}) string {
+	t.Helper()
+	signer, err := NewSigner(key, opts)
+	assert.FatalError(t, err)
+	builder := Signed(signer)
+	for _, c := range claims {
+		builder = builder.Claims(c)
+	}
+	raw, err := builder.CompactSerialize()
+	assert.FatalError(t, err)
+	return raw
+}
+
+func assertValidationError(t *testing.T, want, err error) {
+	t.Helper()
+	var verr *ValidationError
+	if assert.True(t, errors.As(err, &verr), "error is not a *ValidationError") {
+		assert.True(t, errors.Is(err, want), "unexpected error "+err.Error())
+	}
+}
+
+func TestValidator(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+
+	keySet := &JSONWebKeySet{Keys: []JSONWebKey{
+		{Key: ecKey.Public(), KeyID: "ec"},
+		{Key: rsaKey.Public(), KeyID: "rsa", Algorithm: string(RS256)},
+		{Key: edKey, KeyID: "ed"},
+	}}
+
+	now := time.Now()
+	v, err := NewValidator(WithKeyResolver(NewKeySetResolver(keySet)),
+		WithIssuers("issuer"), WithAudiences("audience", "other"), WithLeeway(time.Second),
+		WithRequiredClaims("sub", "exp", "email"))
+	assert.FatalError(t, err)
+	v.now = func() time.Time { return now }
+
+	type privateClaims struct {
+		Email string `json:"email"`
+	}
+	claims := Claims{
+		Issuer:    "issuer",
+		Subject:   "subject",
+		Audience:  Audience{"audience"},
+		NotBefore: NewNumericDate(now),
+		IssuedAt:  NewNumericDate(now),
+		Expiry:    NewNumericDate(now.Add(time.Minute)),
+	}
+	private := privateClaims{Email: "jane@doe.com"}
+	withKid := func(kid string) *SignerOptions {
+		return new(SignerOptions).WithHeader("kid", kid)
+	}
+	withClaims := func(fn func(c *Claims)) Claims {
+		c := claims
+		fn(&c)
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"ok ES256", mustSignClaims(t, SigningKey{Algorithm: ES256, Key: ecKey}, withKid("ec"), claims, private), nil},
+		{"ok RS256", mustSignClaims(t, SigningKey{Algorithm: RS256, Key: rsaKey}, withKid("rsa"), claims, private), nil},
+		{"ok EdDSA", mustSignClaims(t, SigningKey{Algorithm: EdDSA, Key: edKey}, withKid("ed"), claims, private), nil},
+		{"ok no kid", mustSignClaims(t, SigningKey{Algorithm: ES256, Key: ecKey}, nil, claims, private), nil},
+		{"ok multiple audiences", mustSignClaims(t, SigningKey{Algorithm: ES256, Key: ecKey}, nil, withClaims(func(c *Claims) {
+			c.Audience = Audience{"foo", "other"}
+		}), private), nil},
+		{"fail malformed", "not.a.token", ErrMalformedToken},
+		{"fail alg none", "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"subject"}`)) + ".", ErrInvalidAlgorithm},
+		{"fail alg not allowed", mustSignClaims(t, SigningKey{Algorithm: HS256, Key: []byte("the-secret-is-32-bytes-long-1234")}, nil, claims, private), ErrInvalidAlgorithm},
+		{"fail kid", mustSignClaims(t, SigningKey{Algorithm: ES256, Key: ecKey}, withKid("foo"), claims, private), ErrKeyNotFound},
+		{"fail alg key mismatch", mustSignClaims(t, SigningKey{Algorithm: PS256, Key: rsaKey}, withKid("rsa"), claims, private), ErrKeyNotFound},
+		{"fail alg kid mismatch", mustSignClaims(t, SigningKey{Algorithm: ES256, Key: ecKey}, withKid("ed"), claims, private), ErrKeyNotFound},
+		{"fail signature", mustSignClaims(t, SigningKey{Algorithm: ES256, Key: otherKey}, withKid("ec"), claims, private), ErrInvalidSignature},
+		{"fail signature no kid", mustSignClaims(t, SigningKey{Algorithm: ES256, Key: otherKey}, nil, claims, private), ErrInvalidSignature},
+		{"fail missing claim", mustSignClaims(t, SigningKey{Algorithm: ES256, Key: ecKey}, nil, claims), ErrMissingClaim},
+		{"fail issuer", mustSignClaims(t, SigningKey{Algorithm: ES256, Key: ecKey}, nil, withClaims(func(c *Claims) {
+			c.Issuer = "foo"
+		}), private), ErrInvalidIssuer},
+		{"fail audience", mustSignClaims(t, SigningKey{Algorithm: ES256, Key: ecKey}, nil, withClaims(func(c *Claims) {
+			c.Audience = Audience{"foo"}
+		}), private), ErrInvalidAudience},
+		{"fail expired", mustSignClaims(t, SigningKey{Algorithm: ES256, Key: ecKey}, nil, withClaims(func(c *Claims) {
+			c.Expiry = NewNumericDate(now.Add(-2 * time.Second))
+		}), private), ErrExpired},
+		{"fail not valid yet", mustSignClaims(t, SigningKey{Algorithm: ES256, Key: ecKey}, nil, withClaims(func(c *Claims) {
+			c.NotBefore = NewNumericDate(now.Add(2 * time.Second))
+		}), private), ErrNotValidYet},
+		{"fail issued in the future", mustSignClaims(t, SigningKey{Algorithm: ES256, Key: ecKey}, nil, withClaims(func(c *Claims) {
+			c.IssuedAt = NewNumericDate(now.Add(2 * time.Second))
+		}), private), ErrIssuedInTheFuture},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got privateClaims
+			c, err := v.Validate(tt.token, &got)
+			if tt.wantErr != nil {
+				assertValidationError(t, tt.wantErr, err)
+				assert.Nil(t, c)
+				assert.Equals(t, privateClaims{}, got)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, "subject", c.Subject)
+			assert.Equals(t, private, got)
+		})
+	}
+}
+
+func TestValidator_algorithmConfusion(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	pubBytes, err := x509.MarshalPKIXPublicKey(rsaKey.Public())
+	assert.FatalError(t, err)
+
+	// Even if HS256 is allowed, an asymmetric key is never used as an HMAC
+	// secret.
+	v, err := NewValidator(WithAllowedAlgorithms(HS256, RS256),
+		WithKeyResolver(NewKeySetResolver(&JSONWebKeySet{Keys: []JSONWebKey{{Key: rsaKey.Public()}}})))
+	assert.FatalError(t, err)
+	token := mustSignClaims(t, SigningKey{Algorithm: HS256, Key: pubBytes}, nil, Claims{Subject: "subject"})
+	_, err = v.Validate(token)
+	assertValidationError(t, ErrKeyNotFound, err)
+
+	// Symmetric keys only work with HMAC algorithms.
+	secret := []byte("the-secret-is-32-bytes-long-1234")
+	v, err = NewValidator(WithAllowedAlgorithms(HS256),
+		WithKeyResolver(NewKeySetResolver(&JSONWebKeySet{Keys: []JSONWebKey{{Key: secret}}})))
+	assert.FatalError(t, err)
+	token = mustSignClaims(t, SigningKey{Algorithm: HS256, Key: secret}, nil, Claims{Subject: "subject"})
+	c, err := v.Validate(token)
+	assert.FatalError(t, err)
+	assert.Equals(t, "subject", c.Subject)
+
+	// Options
+	_, err = NewValidator(WithAllowedAlgorithms("none"), WithKeyResolver(NewKeySetResolver(&JSONWebKeySet{})))
+	assert.Error(t, err)
+	_, err = NewValidator()
+	assert.Error(t, err)
+}
+
+func TestValidator_remoteKeySet(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.FatalError(t, err)
+	h, err := NewKeySetHandler(key)
+	assert.FatalError(t, err)
+	srv := httptest.NewTLSServer(h)
+	defer srv.Close()
+
+	ks, err := NewRemoteKeySet(srv.URL, WithHTTPClient(srv.Client()))
+	assert.FatalError(t, err)
+	v, err := NewValidator(WithKeyResolver(ks))
+	assert.FatalError(t, err)
+
+	signer, err := h.NewSigner(nil)
+	assert.FatalError(t, err)
+	token, err := Signed(signer).Claims(Claims{Subject: "subject"}).CompactSerialize()
+	assert.FatalError(t, err)
+	c, err := v.Validate(token)
+	assert.FatalError(t, err)
+	assert.Equals(t, "subject", c.Subject)
+
+	// Unknown kid
+	token = mustSignClaims(t, SigningKey{Algorithm: ES384, Key: key}, new(SignerOptions).WithHeader("kid", "foo"), Claims{Subject: "subject"})
+	_, err = v.Validate(token)
+	assertValidationError(t, ErrKeyNotFound, err)
+}
+
+func mustCreateCertificate(t *testing.T, template, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) *x509.Certificate {
+	t.Helper()
+	b, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	assert.FatalError(t, err)
+	cert, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	return cert
+}
+
+func TestValidator_x5c(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+
+	now := time.Now()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Root CA"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	ca := mustCreateCertificate(t, caTemplate, caTemplate, caKey.Public(), caKey)
+	newLeaf := func(keyUsage x509.KeyUsage, extKeyUsage x509.ExtKeyUsage) *x509.Certificate {
+		return mustCreateCertificate(t, &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: "leaf"},
+			NotBefore:    now.Add(-time.Minute),
+			NotAfter:     now.Add(time.Hour),
+			KeyUsage:     keyUsage,
+			ExtKeyUsage:  []x509.ExtKeyUsage{extKeyUsage},
+		}, ca, leafKey.Public(), caKey)
+	}
+	sign := func(leaf *x509.Certificate, key crypto.Signer) string {
+		x5c, err := ValidateX5C([]*x509.Certificate{leaf}, leafKey)
+		assert.FatalError(t, err)
+		return mustSignClaims(t, SigningKey{Algorithm: ES256, Key: key}, new(SignerOptions).WithHeader("x5c", x5c), Claims{Subject: "subject"})
+	}
+
+	otherCA := mustCreateCertificate(t, caTemplate, caTemplate, leafKey.Public(), leafKey)
+	leaf := newLeaf(x509.KeyUsageDigitalSignature, x509.ExtKeyUsageClientAuth)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name    string
+		roots   []*x509.Certificate
+		token   string
+		wantErr error
+	}{
+		{"ok", []*x509.Certificate{ca}, sign(leaf, leafKey), nil},
+		{"fail roots", []*x509.Certificate{otherCA}, sign(leaf, leafKey), ErrKeyNotFound},
+		{"fail ext key usage", []*x509.Certificate{ca}, sign(newLeaf(x509.KeyUsageDigitalSignature, x509.ExtKeyUsageServerAuth), leafKey), ErrKeyNotFound},
+		{"fail no x5c", []*x509.Certificate{ca}, mustSignClaims(t, SigningKey{Algorithm: ES256, Key: leafKey}, nil, Claims{Subject: "subject"}), ErrKeyNotFound},
+		{"fail signature", []*x509.Certificate{ca}, sign(leaf, otherKey), ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewValidator(WithKeyResolver(NewX5CKeyResolver(tt.roots)))
+			assert.FatalError(t, err)
+			c, err := v.Validate(tt.token)
+			if tt.wantErr != nil {
+				assertValidationError(t, tt.wantErr, err)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, "subject", c.Subject)
+		})
+	}
+}
+
+func TestValidator_sshpop(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	caSigner, err := ssh.NewSignerFromSigner(caKey)
+	assert.FatalError(t, err)
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	sshPub, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+
+	now := time.Now()
+	newCert := func(validAfter, validBefore time.Time) string {
+		cert := &ssh.Certificate{
+			Key:             sshPub,
+			CertType:        ssh.UserCert,
+			KeyId:           "jane@doe.com",
+			ValidPrincipals: []string{"jane"},
+			ValidAfter:      uint64(validAfter.Unix()),
+			ValidBefore:     uint64(validBefore.Unix()),
+			Permissions: ssh.Permissions{
+				CriticalOptions: map[string]string{"force-command": "/bin/true"},
+			},
+		}
+		assert.FatalError(t, cert.SignCert(rand.Reader, caSigner))
+
+		f, err := os.CreateTemp(t.TempDir(), "cert")
+		assert.FatalError(t, err)
+		_, err = f.Write(ssh.MarshalAuthorizedKey(cert))
+		assert.FatalError(t, err)
+		assert.FatalError(t, f.Close())
+
+		sshpop, err := ValidateSSHPOP(f.Name(), key)
+		assert.FatalError(t, err)
+		return mustSignClaims(t, SigningKey{Algorithm: EdDSA, Key: key}, new(SignerOptions).WithHeader(SSHPOPKey, sshpop), Claims{Subject: "subject"})
+	}
+
+	otherCA, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name        string
+		authorities []ssh.PublicKey
+		token       string
+		wantErr     error
+	}{
+		{"ok", []ssh.PublicKey{otherCA, caSigner.PublicKey()}, newCert(now.Add(-time.Minute), now.Add(time.Hour)), nil},
+		{"fail authority", []ssh.PublicKey{otherCA}, newCert(now.Add(-time.Minute), now.Add(time.Hour)), ErrKeyNotFound},
+		{"fail expired", []ssh.PublicKey{caSigner.PublicKey()}, newCert(now.Add(-time.Hour), now.Add(-time.Minute)), ErrKeyNotFound},
+		{"fail no sshpop", []ssh.PublicKey{caSigner.PublicKey()}, mustSignClaims(t, SigningKey{Algorithm: EdDSA, Key: key}, nil, Claims{Subject: "subject"}), ErrKeyNotFound},
+		{"fail bad sshpop", []ssh.PublicKey{caSigner.PublicKey()}, mustSignClaims(t, SigningKey{Algorithm: EdDSA, Key: key}, new(SignerOptions).WithHeader(SSHPOPKey, "Zm9v"), Claims{Subject: "subject"}), ErrKeyNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewValidator(WithKeyResolver(NewSSHPOPKeyResolver(tt.authorities...)))
+			assert.FatalError(t, err)
+			c, err := v.Validate(tt.token)
+			if tt.wantErr != nil {
+				assertValidationError(t, tt.wantErr, err)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, "subject", c.Subject)
+		})
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	err := &ValidationError{Err: ErrMissingClaim, Reason: `claim "sub" is required`}
+	assert.Equals(t, `token is missing a required claim: claim "sub" is required`, err.Error())
+	assert.True(t, errors.Is(err, ErrMissingClaim))
+	assert.Equals(t, "token signature is not valid", (&ValidationError{Err: ErrInvalidSignature}).Error())
+}
@@ -151,6 +151,8 @@ const (
 	TPMKMS Type = "tpmkms"
 	// MacKMS is the KMS implementation using macOS Keychain and Secure Enclave.
 	MacKMS Type = "mackms"
+	// JWKKMS is the KMS implementation using a directory of encrypted JWKs.
+	JWKKMS Type = "jwkkms"
 )
 
 // TypeOf returns the type of of the given uri.
@@ -181,7 +183,7 @@ func (t Type) Validate() error {
 		return nil
 	case YubiKey, PKCS11, TPMKMS: // Hardware based kms.
 		return nil
-	case SSHAgentKMS, CAPIKMS, MacKMS: // Others
+	case SSHAgentKMS, CAPIKMS, MacKMS, JWKKMS: // Others
 		return nil
 	}
 
@@ -0,0 +1,67 @@
+package kms
+
+import (
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/kms/apiv1"
+)
+
+// NewJOSESigner returns a jose.Signer that signs with the key with the given
+// uri in the KMS. The signature algorithm can be empty, in that case RS256 is
+// used with RSA keys, the algorithm for the curve with EC keys, and EdDSA with
+// Ed25519 keys. The kid header of the signed tokens is the JWK thumbprint of
+// the public key.
+//
+// The KeyManager must be initialized with the uri, for example:
+//
+//	km, err := kms.New(ctx, apiv1.Options{URI: uri})
+//	if err != nil {
+//		return err
+//	}
+//	defer km.Close()
+//	signer, err := kms.NewJOSESigner(km, uri, jose.ES256, nil)
+func NewJOSESigner(km KeyManager, uri string, alg jose.SignatureAlgorithm, opts *jose.SignerOptions) (jose.Signer, error) {
+	opaque, err := NewJOSEOpaqueSigner(km, uri, alg)
+	if err != nil {
+		return nil, err
+	}
+	return jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.SignatureAlgorithm(opaque.Public().Algorithm),
+		Key:       opaque,
+	}, opts)
+}
+
+// NewJOSEOpaqueSigner returns a jose.OpaqueSigner that signs with the key with
+// the given uri in the KMS. See NewJOSESigner for more details.
+func NewJOSEOpaqueSigner(km KeyManager, uri string, alg jose.SignatureAlgorithm) (jose.OpaqueSigner, error) {
+	if km == nil {
+		return nil, errors.New("kms cannot be nil")
+	}
+	signer, err := km.CreateSigner(&apiv1.CreateSignerRequest{
+		SigningKey: uri,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating signer for %s", uri)
+	}
+	return jose.NewOpaqueSignerWithAlgorithm(signer, alg)
+}
+
+// NewJOSEDecrypter returns a jose.OpaqueKeyDecrypter that can be used to
+// decrypt a JWE encrypted to the key with the given uri in the KMS. The KMS
+// must implement the apiv1.Decrypter interface.
+func NewJOSEDecrypter(km KeyManager, uri string) (jose.OpaqueKeyDecrypter, error) {
+	if km == nil {
+		return nil, errors.New("kms cannot be nil")
+	}
+	d, ok := km.(apiv1.Decrypter)
+	if !ok {
+		return nil, errors.Errorf("%T does not implement the Decrypter interface", km)
+	}
+	decrypter, err := d.CreateDecrypter(&apiv1.CreateDecrypterRequest{
+		DecryptionKey: uri,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating decrypter for %s", uri)
+	}
+	return jose.NewOpaqueKeyDecrypter(decrypter)
+}
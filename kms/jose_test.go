@@ -0,0 +1,111 @@
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
+)
+
+func writeKey(t *testing.T, key crypto.PrivateKey) string {
+	t.Helper()
+	block, err := pemutil.Serialize(key)
+	require.NoError(t, err)
+	filename := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(filename, pem.EncodeToMemory(block), 0600))
+	return filename
+}
+
+func TestNewJOSESigner(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	km, err := New(context.Background(), apiv1.Options{Type: apiv1.SoftKMS})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		key     crypto.Signer
+		alg     jose.SignatureAlgorithm
+		wantAlg string
+		wantErr bool
+	}{
+		{"ok ec", ecKey, "", "ES384", false},
+		{"ok rsa", rsaKey, "", "RS256", false},
+		{"ok rsa-pss", rsaKey, jose.PS384, "PS384", false},
+		{"ok ed25519", edKey, "", "EdDSA", false},
+		{"fail alg", ecKey, jose.ES256, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uri := "softkms:path=" + writeKey(t, tt.key)
+			kid, err := jose.Thumbprint(&jose.JSONWebKey{Key: tt.key.Public()})
+			require.NoError(t, err)
+
+			signer, err := NewJOSESigner(km, uri, tt.alg, new(jose.SignerOptions).WithType("JWT"))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			raw, err := jose.Signed(signer).Claims(jose.Claims{Subject: "subject"}).CompactSerialize()
+			require.NoError(t, err)
+			tok, err := jose.ParseSigned(raw)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAlg, tok.Headers[0].Algorithm)
+			assert.Equal(t, kid, tok.Headers[0].KeyID)
+			assert.Equal(t, "JWT", tok.Headers[0].ExtraHeaders["typ"])
+
+			var claims jose.Claims
+			require.NoError(t, jose.Verify(tok, tt.key.Public(), &claims))
+			assert.Equal(t, "subject", claims.Subject)
+		})
+	}
+
+	_, err = NewJOSESigner(nil, "softkms:path=foo.pem", "", nil)
+	assert.Error(t, err)
+	_, err = NewJOSESigner(km, "softkms:path="+filepath.Join(t.TempDir(), "missing.pem"), "", nil)
+	assert.Error(t, err)
+}
+
+func TestNewJOSEDecrypter(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	uri := "softkms:path=" + writeKey(t, rsaKey)
+
+	km, err := New(context.Background(), apiv1.Options{Type: apiv1.SoftKMS})
+	require.NoError(t, err)
+
+	jwe, err := jose.Encrypt([]byte("the-secret"), jose.WithRecipients(&jose.JSONWebKey{Key: rsaKey.Public()}))
+	require.NoError(t, err)
+
+	decrypter, err := NewJOSEDecrypter(km, uri)
+	require.NoError(t, err)
+	got, err := jwe.Decrypt(decrypter)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("the-secret"), got)
+
+	_, err = NewJOSEDecrypter(nil, uri)
+	assert.Error(t, err)
+	_, err = NewJOSEDecrypter(&fakeCM{}, "softkms:path="+filepath.Join(t.TempDir(), "missing.pem"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,237 @@
+package jwkkms
+
+import (
+	"context"
+	"crypto"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/kms/uri"
+	"go.step.sm/crypto/pemutil"
+)
+
+// Scheme is the scheme used in uris, the string "jwkkms".
+const Scheme = string(apiv1.JWKKMS)
+
+type algorithmAttributes struct {
+	Type  string
+	Curve string
+	Alg   string
+}
+
+var signatureAlgorithmMapping = map[apiv1.SignatureAlgorithm]algorithmAttributes{
+	apiv1.UnspecifiedSignAlgorithm: {"EC", "P-256", jose.ES256},
+	apiv1.SHA256WithRSA:            {"RSA", "", jose.RS256},
+	apiv1.SHA384WithRSA:            {"RSA", "", jose.RS384},
+	apiv1.SHA512WithRSA:            {"RSA", "", jose.RS512},
+	apiv1.SHA256WithRSAPSS:         {"RSA", "", jose.PS256},
+	apiv1.SHA384WithRSAPSS:         {"RSA", "", jose.PS384},
+	apiv1.SHA512WithRSAPSS:         {"RSA", "", jose.PS512},
+	apiv1.ECDSAWithSHA256:          {"EC", "P-256", jose.ES256},
+	apiv1.ECDSAWithSHA384:          {"EC", "P-384", jose.ES384},
+	apiv1.ECDSAWithSHA512:          {"EC", "P-521", jose.ES512},
+	apiv1.PureEd25519:              {"OKP", "Ed25519", jose.EdDSA},
+}
+
+// JWKKMS is a key manager that uses a jose.KeyStore, a directory of JWE
+// encrypted JWKs. Keys are referenced by their kid, using the kid directly or
+// an uri like "jwkkms:kid=<kid>".
+type JWKKMS struct {
+	keyStore *jose.KeyStore
+}
+
+// New returns a new JWKKMS. The directory of the key store is defined in the
+// uri using the "dir" attribute. By default keys are encrypted with a
+// passphrase, defined with the Pin option or the "pin-value" or "pin-source"
+// attributes in the uri. The "decryption-key" attribute can be used instead to
+// define the path to a PEM key used as the recipient of the encrypted keys.
+//
+//	jwkkms:dir=/path/to/keys;pin-source=/path/to/passphrase
+//	jwkkms:dir=/path/to/keys;decryption-key=/path/to/key.pem
+func New(_ context.Context, opts apiv1.Options) (*JWKKMS, error) {
+	u, err := uri.ParseWithScheme(Scheme, opts.URI)
+	if err != nil {
+		return nil, err
+	}
+	dir := u.Get("dir")
+	if dir == "" {
+		return nil, errors.New("jwkkms uri is missing the dir attribute")
+	}
+
+	var joseOpts []jose.Option
+	switch key := u.Get("decryption-key"); {
+	case key != "":
+		priv, err := pemutil.Read(key)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := priv.(crypto.Signer)
+		if !ok {
+			return nil, errors.Errorf("decryption-key %s is not a private key", key)
+		}
+		joseOpts = append(joseOpts,
+			jose.WithRecipients(&jose.JSONWebKey{Key: signer.Public()}),
+			jose.WithDecryptionKey(priv),
+		)
+	case opts.Pin != "":
+		joseOpts = append(joseOpts, jose.WithPassword([]byte(opts.Pin)))
+	default:
+		if pin := u.Pin(); pin != "" {
+			joseOpts = append(joseOpts, jose.WithPassword([]byte(pin)))
+		}
+	}
+
+	ks, err := jose.OpenKeyStore(dir, joseOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &JWKKMS{
+		keyStore: ks,
+	}, nil
+}
+
+func init() {
+	apiv1.Register(apiv1.JWKKMS, func(ctx context.Context, opts apiv1.Options) (apiv1.KeyManager, error) {
+		return New(ctx, opts)
+	})
+}
+
+// KeyStore returns the key store used by the KMS. It can be used to list the
+// keys or rotate the passphrase.
+func (k *JWKKMS) KeyStore() *jose.KeyStore {
+	return k.keyStore
+}
+
+// Close is a noop that just returns nil.
+func (k *JWKKMS) Close() error {
+	return nil
+}
+
+// CreateKey generates a new key and stores it in the key store. If a name is
+// given, its kid will be used, if not the JWK thumbprint will be the kid.
+func (k *JWKKMS) CreateKey(req *apiv1.CreateKeyRequest) (*apiv1.CreateKeyResponse, error) {
+	v, ok := signatureAlgorithmMapping[req.SignatureAlgorithm]
+	if !ok {
+		return nil, errors.Errorf("jwkKMS does not support signature algorithm '%s'", req.SignatureAlgorithm)
+	}
+
+	var kid string
+	if req.Name != "" {
+		if kid = parseKid(req.Name); kid == "" {
+			return nil, errors.Errorf("invalid key name %s", req.Name)
+		}
+	}
+
+	jwk, err := jose.GenerateJWK(v.Type, v.Curve, v.Alg, "sig", kid, req.Bits)
+	if err != nil {
+		return nil, err
+	}
+	if kid, err = k.keyStore.Add(jwk); err != nil {
+		return nil, toKMSError(err)
+	}
+
+	signer := jwk.Key.(crypto.Signer)
+	name := uri.New(Scheme, map[string][]string{"kid": {kid}}).String()
+	return &apiv1.CreateKeyResponse{
+		Name:      name,
+		PublicKey: signer.Public(),
+		CreateSignerRequest: apiv1.CreateSignerRequest{
+			SigningKey: name,
+		},
+	}, nil
+}
+
+// GetPublicKey returns the public key of the key in the request name.
+func (k *JWKKMS) GetPublicKey(req *apiv1.GetPublicKeyRequest) (crypto.PublicKey, error) {
+	key, err := k.getKey(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("key %s is not an asymmetric key", req.Name)
+	}
+	return signer.Public(), nil
+}
+
+// CreateSigner returns a new signer configured with the given signing key.
+func (k *JWKKMS) CreateSigner(req *apiv1.CreateSignerRequest) (crypto.Signer, error) {
+	if req.SigningKey == "" {
+		return nil, errors.New("signing key cannot be empty")
+	}
+	key, err := k.getKey(req.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("signing key %s is not a crypto.Signer", req.SigningKey)
+	}
+	return signer, nil
+}
+
+// CreateDecrypter returns a new decrypter configured with the given
+// decryption key.
+func (k *JWKKMS) CreateDecrypter(req *apiv1.CreateDecrypterRequest) (crypto.Decrypter, error) {
+	if req.DecryptionKey == "" {
+		return nil, errors.New("decryption key cannot be empty")
+	}
+	key, err := k.getKey(req.DecryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	decrypter, ok := key.(crypto.Decrypter)
+	if !ok {
+		return nil, errors.Errorf("decryption key %s is not a crypto.Decrypter", req.DecryptionKey)
+	}
+	return decrypter, nil
+}
+
+// DeleteKey removes the key in the request name from the key store.
+func (k *JWKKMS) DeleteKey(req *apiv1.DeleteKeyRequest) error {
+	kid := parseKid(req.Name)
+	if kid == "" {
+		return errors.Errorf("invalid key name %s", req.Name)
+	}
+	return toKMSError(k.keyStore.Remove(kid))
+}
+
+func (k *JWKKMS) getKey(name string) (crypto.PrivateKey, error) {
+	kid := parseKid(name)
+	if kid == "" {
+		return nil, errors.Errorf("invalid key name %s", name)
+	}
+	jwk, err := k.keyStore.Get(kid)
+	if err != nil {
+		return nil, toKMSError(err)
+	}
+	return jwk.Key, nil
+}
+
+// parseKid returns the kid in the given name. The name can be the kid, or an
+// uri with the kid attribute.
+func parseKid(name string) string {
+	if uri.HasScheme(Scheme, name) {
+		u, err := uri.ParseWithScheme(Scheme, name)
+		if err != nil {
+			return ""
+		}
+		return u.Get("kid")
+	}
+	return name
+}
+
+func toKMSError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, os.ErrNotExist):
+		return apiv1.NotFoundError{Message: err.Error()}
+	case errors.Is(err, os.ErrExist):
+		return apiv1.AlreadyExistsError{Message: err.Error()}
+	default:
+		return err
+	}
+}
@@ -0,0 +1,146 @@
+package jwkkms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
+)
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	pinFile := filepath.Join(dir, "pin")
+	require.NoError(t, os.WriteFile(pinFile, []byte("password"), 0600))
+
+	priv, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	block, err := pemutil.Serialize(priv)
+	require.NoError(t, err)
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600))
+
+	tests := []struct {
+		name    string
+		opts    apiv1.Options
+		wantErr bool
+	}{
+		{"ok pin", apiv1.Options{URI: "jwkkms:dir=" + filepath.Join(dir, "a"), Pin: "password"}, false},
+		{"ok pin-value", apiv1.Options{URI: "jwkkms:dir=" + filepath.Join(dir, "b") + ";pin-value=password"}, false},
+		{"ok pin-source", apiv1.Options{URI: "jwkkms:dir=" + filepath.Join(dir, "c") + ";pin-source=" + pinFile}, false},
+		{"ok decryption-key", apiv1.Options{URI: "jwkkms:dir=" + filepath.Join(dir, "d") + ";decryption-key=" + keyFile}, false},
+		{"fail uri", apiv1.Options{URI: "softkms:dir=" + dir}, true},
+		{"fail dir", apiv1.Options{URI: "jwkkms:pin-value=password"}, true},
+		{"fail decryption-key", apiv1.Options{URI: "jwkkms:dir=" + dir + ";decryption-key=" + pinFile}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(context.Background(), tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, got)
+			}
+		})
+	}
+}
+
+func TestJWKKMS(t *testing.T) {
+	dir := t.TempDir()
+	fn, ok := apiv1.LoadKeyManagerNewFunc(apiv1.JWKKMS)
+	require.True(t, ok)
+	k, err := fn(context.Background(), apiv1.Options{
+		URI: "jwkkms:dir=" + dir + ";pin-value=password",
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, k.Close())
+	})
+
+	// EC key with a given name
+	resp, err := k.CreateKey(&apiv1.CreateKeyRequest{
+		Name:               "jwkkms:kid=ec-key",
+		SignatureAlgorithm: apiv1.ECDSAWithSHA384,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "jwkkms:kid=ec-key", resp.Name)
+	assert.IsType(t, &ecdsa.PublicKey{}, resp.PublicKey)
+
+	signer, err := k.CreateSigner(&resp.CreateSignerRequest)
+	require.NoError(t, err)
+	assert.Equal(t, resp.PublicKey, signer.Public())
+
+	digest := sha256.Sum256([]byte("the-data"))
+	sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	require.NoError(t, err)
+	assert.True(t, ecdsa.VerifyASN1(resp.PublicKey.(*ecdsa.PublicKey), digest[:], sig))
+
+	// Ed25519 key using the thumbprint
+	resp, err = k.CreateKey(&apiv1.CreateKeyRequest{
+		SignatureAlgorithm: apiv1.PureEd25519,
+	})
+	require.NoError(t, err)
+	kid, err := jose.Thumbprint(&jose.JSONWebKey{Key: resp.PublicKey})
+	require.NoError(t, err)
+	assert.Equal(t, "jwkkms:kid="+kid, resp.Name)
+	pub, err := k.GetPublicKey(&apiv1.GetPublicKeyRequest{Name: kid})
+	require.NoError(t, err)
+	assert.IsType(t, ed25519.PublicKey{}, pub)
+	assert.Equal(t, resp.PublicKey, pub)
+
+	// RSA decrypter
+	resp, err = k.CreateKey(&apiv1.CreateKeyRequest{
+		Name:               "rsa-key",
+		SignatureAlgorithm: apiv1.SHA256WithRSA,
+		Bits:               2048,
+	})
+	require.NoError(t, err)
+	decrypter, err := k.(apiv1.Decrypter).CreateDecrypter(&apiv1.CreateDecrypterRequest{
+		DecryptionKey: resp.Name,
+	})
+	require.NoError(t, err)
+	ciphertext, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, resp.PublicKey.(*rsa.PublicKey), []byte("the-data"), nil)
+	require.NoError(t, err)
+	plaintext, err := decrypter.Decrypt(rand.Reader, ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("the-data"), plaintext)
+
+	kids, err := k.(*JWKKMS).KeyStore().List()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"ec-key", "rsa-key", kid}, kids)
+
+	// Errors
+	_, err = k.CreateKey(&apiv1.CreateKeyRequest{Name: "ec-key"})
+	assert.ErrorIs(t, err, apiv1.AlreadyExistsError{})
+	_, err = k.CreateKey(&apiv1.CreateKeyRequest{Name: "jwkkms:foo=bar"})
+	assert.Error(t, err)
+	_, err = k.CreateKey(&apiv1.CreateKeyRequest{SignatureAlgorithm: apiv1.SignatureAlgorithm(100)})
+	assert.Error(t, err)
+	_, err = k.CreateSigner(&apiv1.CreateSignerRequest{SigningKey: "missing"})
+	assert.ErrorIs(t, err, apiv1.NotFoundError{})
+	_, err = k.CreateSigner(&apiv1.CreateSignerRequest{})
+	assert.Error(t, err)
+	_, err = k.(apiv1.Decrypter).CreateDecrypter(&apiv1.CreateDecrypterRequest{DecryptionKey: "ec-key"})
+	assert.Error(t, err)
+
+	// Delete
+	require.NoError(t, k.(*JWKKMS).DeleteKey(&apiv1.DeleteKeyRequest{Name: "jwkkms:kid=ec-key"}))
+	_, err = k.GetPublicKey(&apiv1.GetPublicKeyRequest{Name: "ec-key"})
+	assert.ErrorIs(t, err, apiv1.NotFoundError{})
+	assert.ErrorIs(t, k.(*JWKKMS).DeleteKey(&apiv1.DeleteKeyRequest{Name: "ec-key"}), apiv1.NotFoundError{})
+}
@@ -297,8 +297,19 @@ func (k *TPMKMS) usesWindowsCertificateStore() bool {
 //   - name=<name>: specify the name to identify the key with
 //   - ak=true: if set to true, an Attestation Key (AK) will be created instead of an application key
 //   - tss2=true: is set to true, the PrivateKey response will contain a [tss2.TPMKey].
+//   - decrypt=true: if set to true, a decryption key will be created instead of a signing key
 //   - attest-by=<akName>: attest an application key at creation time with the AK identified by `akName`
 //   - qualifying-data=<random>: hexadecimal coded binary data that can be used to guarantee freshness when attesting creation of a key
+//   - pin-value=<password>: the password required to sign with the key
+//   - pin-source=<file>: the file with the password required to sign with the key
+//   - pcrs=<indexes>: comma separated list of PCRs the key is bound to; the key can only be used while their values don't change
+//   - pcr-bank=<bank>: the PCR bank used with "pcrs", either sha1 or sha256; defaults to sha256
+//   - policy-authority=<file>: PEM file with the public key allowed to sign policies for the key
+//   - policy-ref=<ref>: hexadecimal coded policy reference required in the policies signed by the "policy-authority"
+//
+// Keys with a PolicyOR can't be created using the URI; use a [tpm.TPM]
+// instance instead. Policies signed by the "policy-authority" are added
+// to the key with [tpm.Key.AddSignedPolicy].
 //
 // Some examples usages:
 //
@@ -313,6 +324,17 @@ func (k *TPMKMS) usesWindowsCertificateStore() bool {
 // Create an application key, attested by `my-ak` with "1234" as the Qualifying Data:
 //
 //	tpmkms:name=my-attested-key;attest-by=my-ak;qualifying-data=61626364
+//
+// Create an application key bound to the values of PCRs 0 and 7 in the
+// SHA-256 bank, and protected with a password:
+//
+//	tpmkms:name=my-bound-key;pcrs=0,7;pin-value=password
+//
+// Create a decryption key. RSA keys decrypt using RSA-OAEP or
+// RSAES-PKCS1-v1_5, and ECDSA keys are used for ECDH key agreement. The
+// type of the key is selected using the signature algorithm:
+//
+//	tpmkms:name=my-decryption-key;decrypt=true
 func (k *TPMKMS) CreateKey(req *apiv1.CreateKeyRequest) (*apiv1.CreateKeyResponse, error) {
 	switch {
 	case req.Name == "":
@@ -376,12 +398,20 @@ func (k *TPMKMS) CreateKey(req *apiv1.CreateKeyRequest) (*apiv1.CreateKeyRespons
 		}, nil
 	}
 
+	policy, err := properties.keyPolicy()
+	if err != nil {
+		return nil, err
+	}
+
 	var key *tpm.Key
 	if properties.attestBy != "" {
 		config := tpm.AttestKeyConfig{
 			Algorithm:      v.Type,
 			Size:           size,
 			QualifyingData: properties.qualifyingData,
+			Password:       properties.pin,
+			Policy:         policy,
+			Decrypt:        properties.decrypt,
 		}
 		key, err = k.tpm.AttestKey(ctx, properties.attestBy, properties.name, config)
 		if err != nil {
@@ -394,6 +424,9 @@ func (k *TPMKMS) CreateKey(req *apiv1.CreateKeyRequest) (*apiv1.CreateKeyRespons
 		config := tpm.CreateKeyConfig{
 			Algorithm: v.Type,
 			Size:      size,
+			Password:  properties.pin,
+			Policy:    policy,
+			Decrypt:   properties.decrypt,
 		}
 		key, err = k.tpm.CreateKey(ctx, properties.name, config)
 		if err != nil {
@@ -412,16 +445,29 @@ func (k *TPMKMS) CreateKey(req *apiv1.CreateKeyRequest) (*apiv1.CreateKeyRespons
 		privateKey = tpmKey
 	}
 
-	signer, err := key.Signer(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed getting signer for key: %w", err)
-	}
-
 	createdKeyURI := fmt.Sprintf("tpmkms:name=%s", key.Name())
 	if properties.attestBy != "" {
 		createdKeyURI = fmt.Sprintf("%s;attest-by=%s", createdKeyURI, key.AttestedBy())
 	}
 
+	// decryption keys can't be used to create a signer
+	if properties.decrypt {
+		decrypter, err := key.DecrypterWithPassword(ctx, properties.pin)
+		if err != nil {
+			return nil, fmt.Errorf("failed getting decrypter for key: %w", err)
+		}
+		return &apiv1.CreateKeyResponse{
+			Name:       createdKeyURI,
+			PublicKey:  decrypter.Public(),
+			PrivateKey: privateKey,
+		}, nil
+	}
+
+	signer, err := key.SignerWithPassword(ctx, properties.pin)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting signer for key: %w", err)
+	}
+
 	return &apiv1.CreateKeyResponse{
 		Name:       createdKeyURI,
 		PublicKey:  signer.Public(),
@@ -469,12 +515,19 @@ func (k *TPMKMS) DeleteKey(req *apiv1.DeleteKeyRequest) error {
 //
 //   - name=<name>: specify the name to identify the key with
 //   - path=<file>: specify the TSS2 PEM file to use
+//   - pin-value=<password>: the password required to sign with the key
+//   - pin-source=<file>: the file with the password required to sign with the key
+//
+// The policy of the key, if any, is satisfied on each signing operation.
 func (k *TPMKMS) CreateSigner(req *apiv1.CreateSignerRequest) (crypto.Signer, error) {
 	if req.Signer != nil {
 		return req.Signer, nil
 	}
 
-	var pemBytes []byte
+	var (
+		pemBytes []byte
+		password string
+	)
 
 	switch {
 	case req.SigningKey != "":
@@ -493,7 +546,7 @@ func (k *TPMKMS) CreateSigner(req *apiv1.CreateSignerRequest) (crypto.Signer, er
 			if err != nil {
 				return nil, err
 			}
-			signer, err := key.Signer(ctx)
+			signer, err := key.SignerWithPassword(ctx, properties.pin)
 			if err != nil {
 				return nil, fmt.Errorf("failed getting signer for key %q: %w", properties.name, err)
 			}
@@ -502,6 +555,7 @@ func (k *TPMKMS) CreateSigner(req *apiv1.CreateSignerRequest) (crypto.Signer, er
 			if pemBytes, err = os.ReadFile(properties.path); err != nil {
 				return nil, fmt.Errorf("failed reading key from %q: %w", properties.path, err)
 			}
+			password = properties.pin
 		default:
 			return nil, fmt.Errorf("failed parsing %q: name and path cannot be empty", req.SigningKey)
 		}
@@ -518,13 +572,89 @@ func (k *TPMKMS) CreateSigner(req *apiv1.CreateSignerRequest) (crypto.Signer, er
 	}
 
 	ctx := context.Background()
-	signer, err := tpm.CreateTSS2Signer(ctx, k.tpm, key)
+	signer, err := tpm.CreateTSS2SignerWithPassword(ctx, k.tpm, key, password)
 	if err != nil {
 		return nil, fmt.Errorf("failed getting signer for TSS2 PEM: %w", err)
 	}
 	return signer, nil
 }
 
+// CreateDecrypter creates a decrypter using a key present in the TPM KMS. The
+// key must have been created with "decrypt=true". The returned
+// [crypto.Decrypter] implements [tpm.Decrypter], so it can also be used for
+// ECDH key agreement with ECDSA keys.
+//
+// The `decryptionKey` in the [apiv1.CreateDecrypterRequest] can be used to
+// specify some key properties. These are as follows:
+//
+//   - name=<name>: specify the name to identify the key with
+//   - path=<file>: specify the TSS2 PEM file to use
+//   - pin-value=<password>: the password required to decrypt with the key
+//   - pin-source=<file>: the file with the password required to decrypt with the key
+//
+// The policy of the key, if any, is satisfied on each decryption operation.
+func (k *TPMKMS) CreateDecrypter(req *apiv1.CreateDecrypterRequest) (crypto.Decrypter, error) {
+	if req.Decrypter != nil {
+		return req.Decrypter, nil
+	}
+
+	var (
+		pemBytes []byte
+		password = string(req.Password)
+	)
+
+	switch {
+	case req.DecryptionKey != "":
+		properties, err := parseNameURI(req.DecryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing %q: %w", req.DecryptionKey, err)
+		}
+		if properties.ak {
+			return nil, fmt.Errorf("decrypting with an AK is not supported")
+		}
+		if properties.pin != "" {
+			password = properties.pin
+		}
+
+		switch {
+		case properties.name != "":
+			ctx := context.Background()
+			key, err := k.getKey(ctx, properties.name)
+			if err != nil {
+				return nil, err
+			}
+			decrypter, err := key.DecrypterWithPassword(ctx, password)
+			if err != nil {
+				return nil, fmt.Errorf("failed getting decrypter for key %q: %w", properties.name, err)
+			}
+			return decrypter, nil
+		case properties.path != "":
+			if pemBytes, err = os.ReadFile(properties.path); err != nil {
+				return nil, fmt.Errorf("failed reading key from %q: %w", properties.path, err)
+			}
+		default:
+			return nil, fmt.Errorf("failed parsing %q: name and path cannot be empty", req.DecryptionKey)
+		}
+	case len(req.DecryptionKeyPEM) > 0:
+		pemBytes = req.DecryptionKeyPEM
+	default:
+		return nil, errors.New("createDecrypterRequest 'decryptionKey' and 'decryptionKeyPEM' cannot be empty")
+	}
+
+	// Create a decrypter from a TSS2 PEM block
+	key, err := parseTSS2(pemBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	decrypter, err := tpm.CreateTSS2DecrypterWithPassword(ctx, k.tpm, key, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting decrypter for TSS2 PEM: %w", err)
+	}
+	return decrypter, nil
+}
+
 // GetPublicKey returns the public key present in the TPM KMS.
 //
 // The `name` in the [apiv1.GetPublicKeyRequest] can be used to specify some key
@@ -1352,6 +1482,7 @@ type deletingCertificateChainManager interface {
 
 var _ apiv1.KeyManager = (*TPMKMS)(nil)
 var _ apiv1.Attester = (*TPMKMS)(nil)
+var _ apiv1.Decrypter = (*TPMKMS)(nil)
 var _ apiv1.CertificateManager = (*TPMKMS)(nil)
 var _ apiv1.CertificateChainManager = (*TPMKMS)(nil)
 var _ deletingCertificateChainManager = (*TPMKMS)(nil)
@@ -6,6 +6,7 @@ package tpmkms
 import (
 	"context"
 	"crypto"
+	"crypto/ecdh"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -186,6 +187,32 @@ func TestTPMKMS_CreateKey(t *testing.T) {
 				return false
 			},
 		},
+		{
+			name: "ok/decrypt-key",
+			fields: fields{
+				tpm: tpmWithAK,
+			},
+			args: args{
+				req: &apiv1.CreateKeyRequest{
+					Name:               "tpmkms:name=decrypt-key;decrypt=true",
+					SignatureAlgorithm: apiv1.ECDSAWithSHA256,
+				},
+			},
+			assertFunc: func(tt assert.TestingT, i1 interface{}, i2 ...interface{}) bool {
+				if assert.IsType(t, &apiv1.CreateKeyResponse{}, i1) {
+					r, _ := i1.(*apiv1.CreateKeyResponse)
+					if assert.NotNil(t, r) {
+						assert.Equal(t, "tpmkms:name=decrypt-key", r.Name)
+						assert.Equal(t, apiv1.CreateSignerRequest{}, r.CreateSignerRequest)
+						if assert.NotNil(t, r.PublicKey) {
+							assert.IsType(t, &ecdsa.PublicKey{}, r.PublicKey)
+						}
+						return true
+					}
+				}
+				return false
+			},
+		},
 		{
 			name: "ok/ecdsa-key-tss2",
 			fields: fields{
@@ -661,6 +688,105 @@ func TestTPMKMS_CreateSigner(t *testing.T) {
 	}
 }
 
+func TestTPMKMS_CreateDecrypter(t *testing.T) {
+	ctx := context.Background()
+	tpm := newSimulatedTPM(t)
+	k := &TPMKMS{
+		tpm: tpm,
+	}
+
+	_, err := k.CreateKey(&apiv1.CreateKeyRequest{
+		Name:               "tpmkms:name=rsa-key;decrypt=true",
+		SignatureAlgorithm: apiv1.SHA256WithRSA,
+		Bits:               2048,
+	})
+	require.NoError(t, err)
+	_, err = k.CreateKey(&apiv1.CreateKeyRequest{
+		Name:               "tpmkms:name=ecdsa-key;decrypt=true;pin-value=password",
+		SignatureAlgorithm: apiv1.ECDSAWithSHA256,
+	})
+	require.NoError(t, err)
+	_, err = k.CreateKey(&apiv1.CreateKeyRequest{
+		Name:               "tpmkms:name=signing-key",
+		SignatureAlgorithm: apiv1.ECDSAWithSHA256,
+	})
+	require.NoError(t, err)
+
+	key, err := tpm.GetKey(ctx, "rsa-key")
+	require.NoError(t, err)
+	tss2Key, err := key.ToTSS2(ctx)
+	require.NoError(t, err)
+	pemBytes, err := tss2Key.EncodeToMemory()
+	require.NoError(t, err)
+	tmp := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "tss2.pem"), pemBytes, 0600))
+
+	rsaDecrypter, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	msg := []byte("unreplevined-hyperpyretic-antichlorine-sulfonylurea")
+	assertRSA := func(t *testing.T, d crypto.Decrypter) {
+		t.Helper()
+		pub, ok := d.Public().(*rsa.PublicKey)
+		require.True(t, ok)
+		ciphertext, err := rsa.EncryptOAEP(crypto.SHA256.New(), rand.Reader, pub, msg, nil)
+		require.NoError(t, err)
+		plaintext, err := d.Decrypt(rand.Reader, ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256})
+		require.NoError(t, err)
+		assert.Equal(t, msg, plaintext)
+	}
+	assertECDH := func(t *testing.T, d crypto.Decrypter) {
+		t.Helper()
+		pub, ok := d.Public().(*ecdsa.PublicKey)
+		require.True(t, ok)
+		ecdhPublic, err := pub.ECDH()
+		require.NoError(t, err)
+		remote, err := ecdh.P256().GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		want, err := remote.ECDH(ecdhPublic)
+		require.NoError(t, err)
+
+		dec, ok := d.(tpmp.Decrypter)
+		require.True(t, ok)
+		got, err := dec.ECDH(remote.PublicKey())
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	tests := []struct {
+		name   string
+		req    *apiv1.CreateDecrypterRequest
+		assert func(t *testing.T, d crypto.Decrypter)
+		expErr error
+	}{
+		{"ok/decrypter", &apiv1.CreateDecrypterRequest{Decrypter: rsaDecrypter}, func(t *testing.T, d crypto.Decrypter) {
+			assert.Equal(t, rsaDecrypter, d)
+		}, nil},
+		{"ok/decryption-key", &apiv1.CreateDecrypterRequest{DecryptionKey: "tpmkms:name=rsa-key"}, assertRSA, nil},
+		{"ok/decryption-key-pin", &apiv1.CreateDecrypterRequest{DecryptionKey: "tpmkms:name=ecdsa-key;pin-value=password"}, assertECDH, nil},
+		{"ok/decryption-key-password", &apiv1.CreateDecrypterRequest{DecryptionKey: "tpmkms:name=ecdsa-key", Password: []byte("password")}, assertECDH, nil},
+		{"ok/decryption-key-path", &apiv1.CreateDecrypterRequest{DecryptionKey: "tpmkms:path=" + filepath.Join(tmp, "tss2.pem")}, assertRSA, nil},
+		{"ok/decryption-key-pem", &apiv1.CreateDecrypterRequest{DecryptionKeyPEM: pemBytes}, assertRSA, nil},
+		{"fail/empty", &apiv1.CreateDecrypterRequest{}, nil, errors.New("createDecrypterRequest 'decryptionKey' and 'decryptionKeyPEM' cannot be empty")},
+		{"fail/empty-opaque", &apiv1.CreateDecrypterRequest{DecryptionKey: "tpmkms:"}, nil, errors.New(`failed parsing "tpmkms:": name and path cannot be empty`)},
+		{"fail/ak", &apiv1.CreateDecrypterRequest{DecryptionKey: "tpmkms:name=ak1;ak=true"}, nil, errors.New("decrypting with an AK is not supported")},
+		{"fail/unknown-key", &apiv1.CreateDecrypterRequest{DecryptionKey: "tpmkms:name=unknown-key"}, nil, errors.New(`failed getting key "unknown-key": not found`)},
+		{"fail/signing-key", &apiv1.CreateDecrypterRequest{DecryptionKey: "tpmkms:name=signing-key"}, nil, errors.New(`failed getting decrypter for key "signing-key": failed getting decrypter for key "signing-key": invalid TSS2 key: key is not a decryption key`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := k.CreateDecrypter(tt.req)
+			if tt.expErr != nil {
+				assert.EqualError(t, err, tt.expErr.Error())
+				return
+			}
+
+			require.NoError(t, err)
+			tt.assert(t, got)
+		})
+	}
+}
+
 func TestTPMKMS_GetPublicKey(t *testing.T) {
 	tpmWithKey := newSimulatedTPM(t, withKey("key1"))
 	_, err := tpmWithKey.CreateAK(context.Background(), "ak1")
@@ -4,18 +4,29 @@
 package tpmkms
 
 import (
+	"crypto"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"go.step.sm/crypto/kms/uri"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/tpm"
 )
 
 type objectProperties struct {
 	name                      string
 	ak                        bool
 	tss2                      bool
+	decrypt                   bool
 	attestBy                  string
 	qualifyingData            []byte
+	pin                       string
+	pcrs                      *tpm.PCRSelection
+	policyAuthority           string
+	policyRef                 []byte
 	path                      string
 	storeLocation             string
 	store                     string
@@ -53,11 +64,22 @@ func parseNameURI(nameURI string) (o objectProperties, err error) {
 
 		o.ak = u.GetBool("ak")
 		o.tss2 = u.GetBool("tss2")
+		o.decrypt = u.GetBool("decrypt")
 		o.attestBy = u.Get("attest-by")
 		if qualifyingData := u.GetEncoded("qualifying-data"); qualifyingData != nil {
 			o.qualifyingData = qualifyingData
 		}
 
+		// password and policy used when creating and signing with keys
+		o.pin = u.Pin()
+		if o.pcrs, err = parsePCRs(u.Get("pcrs"), u.Get("pcr-bank")); err != nil {
+			return o, err
+		}
+		o.policyAuthority = u.Get("policy-authority")
+		if o.policyRef, err = u.GetHexEncoded("policy-ref"); err != nil {
+			return o, fmt.Errorf(`failed parsing "policy-ref": %w`, err)
+		}
+
 		// store location and store options are used on Windows to override
 		// which store(s) are used for storing and loading (intermediate) certificates
 		o.storeLocation = u.Get("store-location")
@@ -74,6 +96,12 @@ func parseNameURI(nameURI string) (o objectProperties, err error) {
 		if o.ak && o.attestBy != "" {
 			return o, errors.New(`"ak" and "attest-by" are mutually exclusive`)
 		}
+		if o.ak && o.decrypt {
+			return o, errors.New(`"ak" and "decrypt" are mutually exclusive`)
+		}
+		if o.policyAuthority == "" && o.policyRef != nil {
+			return o, errors.New(`"policy-ref" requires "policy-authority"`)
+		}
 
 		return
 	}
@@ -87,3 +115,61 @@ func parseNameURI(nameURI string) (o objectProperties, err error) {
 	o.name = nameURI // assumes there's no other properties encoded; just a name
 	return
 }
+
+// parsePCRs parses the comma separated list of PCR indexes and the
+// PCR bank used to bind a key to PCR values. The SHA-256 bank is used
+// by default.
+func parsePCRs(pcrs, bank string) (*tpm.PCRSelection, error) {
+	if pcrs == "" {
+		if bank != "" {
+			return nil, errors.New(`"pcr-bank" requires "pcrs"`)
+		}
+		return nil, nil
+	}
+
+	sel := &tpm.PCRSelection{Bank: crypto.SHA256}
+	switch strings.ToLower(bank) {
+	case "", "sha256":
+	case "sha1":
+		sel.Bank = crypto.SHA1
+	default:
+		return nil, fmt.Errorf("unsupported PCR bank %q", bank)
+	}
+
+	for _, s := range strings.Split(pcrs, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid PCR index %q", s)
+		}
+		sel.PCRs = append(sel.PCRs, i)
+	}
+
+	return sel, nil
+}
+
+// keyPolicy returns the policy for a new key. It returns nil if no
+// policy options are set.
+func (o objectProperties) keyPolicy() (*tpm.KeyPolicy, error) {
+	if o.pcrs == nil && o.policyAuthority == "" {
+		return nil, nil
+	}
+
+	policy := &tpm.KeyPolicy{
+		PCRs: o.pcrs,
+	}
+	if o.policyAuthority != "" {
+		v, err := pemutil.Read(o.policyAuthority)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading policy authority: %w", err)
+		}
+		if cert, ok := v.(*x509.Certificate); ok {
+			v = cert.PublicKey
+		}
+		policy.Authorize = &tpm.AuthorizePolicy{
+			Authority: v,
+			PolicyRef: o.policyRef,
+		}
+	}
+
+	return policy, nil
+}
@@ -1,9 +1,20 @@
 package tpmkms
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/tpm"
 )
 
 func Test_parseNameURI(t *testing.T) {
@@ -22,8 +33,19 @@ func Test_parseNameURI(t *testing.T) {
 		{"ok/key-without-name-key-with-other-properties", args{"tpmkms:key1;attest-by=ak1"}, objectProperties{name: "key1", attestBy: "ak1"}, false},
 		{"ok/attested-key", args{"tpmkms:name=key2;attest-by=ak1;qualifying-data=61626364"}, objectProperties{name: "key2", attestBy: "ak1", qualifyingData: []byte{'a', 'b', 'c', 'd'}}, false},
 		{"ok/ak", args{"tpmkms:name=ak1;ak=true"}, objectProperties{name: "ak1", ak: true}, false},
+		{"ok/decrypt", args{"tpmkms:name=key1;decrypt=true"}, objectProperties{name: "key1", decrypt: true}, false},
+		{"ok/pin", args{"tpmkms:name=key1;pin-value=password"}, objectProperties{name: "key1", pin: "password"}, false},
+		{"ok/pcrs", args{"tpmkms:name=key1;pcrs=0,7"}, objectProperties{name: "key1", pcrs: &tpm.PCRSelection{Bank: crypto.SHA256, PCRs: []int{0, 7}}}, false},
+		{"ok/pcrs-sha1", args{"tpmkms:name=key1;pcrs=16;pcr-bank=sha1"}, objectProperties{name: "key1", pcrs: &tpm.PCRSelection{Bank: crypto.SHA1, PCRs: []int{16}}}, false},
+		{"ok/policy-authority", args{"tpmkms:name=key1;policy-authority=authority.pem;policy-ref=0x6162"}, objectProperties{name: "key1", policyAuthority: "authority.pem", policyRef: []byte("ab")}, false},
 		{"fail/empty", args{""}, objectProperties{}, true},
 		{"fail/wrong-scheme", args{nameURI: "tpmkmz:name=bla"}, objectProperties{}, true},
+		{"fail/ak-decrypt", args{"tpmkms:name=ak1;ak=true;decrypt=true"}, objectProperties{}, true},
+		{"fail/pcrs", args{"tpmkms:name=key1;pcrs=0,a"}, objectProperties{}, true},
+		{"fail/pcr-bank", args{"tpmkms:name=key1;pcrs=0;pcr-bank=sha512"}, objectProperties{}, true},
+		{"fail/pcr-bank-without-pcrs", args{"tpmkms:name=key1;pcr-bank=sha1"}, objectProperties{}, true},
+		{"fail/policy-ref", args{"tpmkms:name=key1;policy-authority=authority.pem;policy-ref=zz"}, objectProperties{}, true},
+		{"fail/policy-ref-without-authority", args{"tpmkms:name=key1;policy-ref=6162"}, objectProperties{}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -38,3 +60,36 @@ func Test_parseNameURI(t *testing.T) {
 		})
 	}
 }
+
+func Test_objectProperties_keyPolicy(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	block, err := pemutil.Serialize(key.Public())
+	require.NoError(t, err)
+	authority := filepath.Join(t.TempDir(), "authority.pem")
+	require.NoError(t, os.WriteFile(authority, pem.EncodeToMemory(block), 0600))
+
+	pcrs := &tpm.PCRSelection{Bank: crypto.SHA256, PCRs: []int{0, 7}}
+
+	tests := []struct {
+		name      string
+		o         objectProperties
+		want      *tpm.KeyPolicy
+		assertion assert.ErrorAssertionFunc
+	}{
+		{"ok none", objectProperties{name: "key1", pin: "password"}, nil, assert.NoError},
+		{"ok pcrs", objectProperties{pcrs: pcrs}, &tpm.KeyPolicy{PCRs: pcrs}, assert.NoError},
+		{"ok authority", objectProperties{pcrs: pcrs, policyAuthority: authority, policyRef: []byte("ref")}, &tpm.KeyPolicy{
+			PCRs:      pcrs,
+			Authorize: &tpm.AuthorizePolicy{Authority: key.Public(), PolicyRef: []byte("ref")},
+		}, assert.NoError},
+		{"fail authority", objectProperties{policyAuthority: filepath.Join(t.TempDir(), "missing.pem")}, nil, assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.o.keyPolicy()
+			tt.assertion(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
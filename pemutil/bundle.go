@@ -0,0 +1,423 @@
+package pemutil
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/internal/utils"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/tpm/tss2"
+	"go.step.sm/crypto/x25519"
+	"golang.org/x/crypto/ssh"
+)
+
+// ObjectType represents the type of an object decoded by ParseBundle.
+type ObjectType int
+
+const (
+	// ObjectUnknown is the type of an unknown object.
+	ObjectUnknown ObjectType = iota
+	// ObjectPrivateKey is the type used for private keys.
+	ObjectPrivateKey
+	// ObjectPublicKey is the type used for public keys.
+	ObjectPublicKey
+	// ObjectCertificate is the type used for *x509.Certificate.
+	ObjectCertificate
+	// ObjectCertificateRequest is the type used for *x509.CertificateRequest.
+	ObjectCertificateRequest
+	// ObjectRevocationList is the type used for *x509.RevocationList.
+	ObjectRevocationList
+	// ObjectSSHPublicKey is the type used for ssh.PublicKey.
+	ObjectSSHPublicKey
+	// ObjectSSHCertificate is the type used for *ssh.Certificate.
+	ObjectSSHCertificate
+	// ObjectTSS2PrivateKey is the type used for *tss2.TPMKey.
+	ObjectTSS2PrivateKey
+)
+
+// String returns a string representation of the object type.
+func (t ObjectType) String() string {
+	switch t {
+	case ObjectPrivateKey:
+		return "private key"
+	case ObjectPublicKey:
+		return "public key"
+	case ObjectCertificate:
+		return "certificate"
+	case ObjectCertificateRequest:
+		return "certificate request"
+	case ObjectRevocationList:
+		return "revocation list"
+	case ObjectSSHPublicKey:
+		return "ssh public key"
+	case ObjectSSHCertificate:
+		return "ssh certificate"
+	case ObjectTSS2PrivateKey:
+		return "tss2 private key"
+	default:
+		return "unknown"
+	}
+}
+
+// Object is an object decoded by ParseBundle. Index is the position of the
+// PEM block or line where the object was found, and PEMType is the type of the
+// PEM block, it will be empty if the object was not PEM encoded.
+type Object struct {
+	Index   int
+	PEMType string
+	Type    ObjectType
+	Value   interface{}
+}
+
+// BlockError is the error returned when a PEM block or a line in the input
+// cannot be decoded.
+type BlockError struct {
+	Index   int
+	PEMType string
+	Err     error
+}
+
+// Error implements the error interface.
+func (e *BlockError) Error() string {
+	if e.PEMType == "" {
+		return fmt.Sprintf("error decoding object %d: %v", e.Index, e.Err)
+	}
+	return fmt.Sprintf("error decoding object %d (%s): %v", e.Index, e.PEMType, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *BlockError) Unwrap() error {
+	return e.Err
+}
+
+// Bundle contains the objects decoded by ParseBundle in the same order they
+// appear in the input, and the errors found decoding the rest.
+type Bundle struct {
+	Objects []Object
+	Errors  []*BlockError
+}
+
+// PrivateKeys returns the private keys in the bundle.
+func (b *Bundle) PrivateKeys() []crypto.PrivateKey {
+	var keys []crypto.PrivateKey
+	for _, o := range b.objects(ObjectPrivateKey) {
+		keys = append(keys, o)
+	}
+	return keys
+}
+
+// PublicKeys returns the public keys in the bundle.
+func (b *Bundle) PublicKeys() []crypto.PublicKey {
+	var keys []crypto.PublicKey
+	for _, o := range b.objects(ObjectPublicKey) {
+		keys = append(keys, o)
+	}
+	return keys
+}
+
+// Certificates returns the X.509 certificates in the bundle.
+func (b *Bundle) Certificates() []*x509.Certificate {
+	var certs []*x509.Certificate
+	for _, o := range b.objects(ObjectCertificate) {
+		certs = append(certs, o.(*x509.Certificate))
+	}
+	return certs
+}
+
+// CertificateRequests returns the X.509 certificate requests in the bundle.
+func (b *Bundle) CertificateRequests() []*x509.CertificateRequest {
+	var csrs []*x509.CertificateRequest
+	for _, o := range b.objects(ObjectCertificateRequest) {
+		csrs = append(csrs, o.(*x509.CertificateRequest))
+	}
+	return csrs
+}
+
+// RevocationLists returns the X.509 revocation lists in the bundle.
+func (b *Bundle) RevocationLists() []*x509.RevocationList {
+	var crls []*x509.RevocationList
+	for _, o := range b.objects(ObjectRevocationList) {
+		crls = append(crls, o.(*x509.RevocationList))
+	}
+	return crls
+}
+
+// SSHPublicKeys returns the SSH public keys in the bundle, SSH certificates are
+// not included.
+func (b *Bundle) SSHPublicKeys() []ssh.PublicKey {
+	var keys []ssh.PublicKey
+	for _, o := range b.objects(ObjectSSHPublicKey) {
+		keys = append(keys, o.(ssh.PublicKey))
+	}
+	return keys
+}
+
+// SSHCertificates returns the SSH certificates in the bundle.
+func (b *Bundle) SSHCertificates() []*ssh.Certificate {
+	var certs []*ssh.Certificate
+	for _, o := range b.objects(ObjectSSHCertificate) {
+		certs = append(certs, o.(*ssh.Certificate))
+	}
+	return certs
+}
+
+// TSS2PrivateKeys returns the TSS2 keys in the bundle.
+func (b *Bundle) TSS2PrivateKeys() []*tss2.TPMKey {
+	var keys []*tss2.TPMKey
+	for _, o := range b.objects(ObjectTSS2PrivateKey) {
+		keys = append(keys, o.(*tss2.TPMKey))
+	}
+	return keys
+}
+
+// KeyPair returns the first private key and the first certificate in the
+// bundle, the leaf, after validating that the key matches the public key in the
+// certificate.
+func (b *Bundle) KeyPair() (crypto.PrivateKey, *x509.Certificate, error) {
+	keys := b.objects(ObjectPrivateKey)
+	if len(keys) == 0 {
+		return nil, nil, errors.New("bundle does not contain a private key")
+	}
+	certs := b.objects(ObjectCertificate)
+	if len(certs) == 0 {
+		return nil, nil, errors.New("bundle does not contain a certificate")
+	}
+	leaf := certs[0].(*x509.Certificate)
+	if err := keyutil.VerifyPair(leaf.PublicKey, keys[0]); err != nil {
+		return nil, nil, errors.Wrap(err, "error validating key pair")
+	}
+	return keys[0], leaf, nil
+}
+
+func (b *Bundle) objects(typ ObjectType) []interface{} {
+	var ret []interface{}
+	for _, o := range b.Objects {
+		if o.Type == typ {
+			ret = append(ret, o.Value)
+		}
+	}
+	return ret
+}
+
+// ReadBundle reads the given filename and returns all the objects encoded in
+// it. See ParseBundle for more details.
+func ReadBundle(filename string, opts ...Options) (*Bundle, error) {
+	b, err := utils.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// force given filename
+	opts = append(opts, WithFilename(filename))
+	return ParseBundle(b, opts...)
+}
+
+// ParseBundle decodes all the PEM blocks in the given bytes and returns a
+// Bundle with the keys, certificates, certificate requests, revocation lists,
+// SSH keys and TSS2 keys found. If the data is not PEM encoded, it will try to
+// decode it as a DER or base64 encoded DER object, or as a list of SSH public
+// keys in the authorized_keys format.
+//
+// Encrypted blocks are decrypted with the password options. The password is
+// requested only once, and it is used for all the encrypted blocks.
+//
+// The blocks that cannot be decoded are reported in the Errors field of the
+// bundle, an error is only returned if no object could be decoded.
+func ParseBundle(b []byte, opts ...Options) (*Bundle, error) {
+	// Populate options
+	ctx := newContext("PEM")
+	if err := ctx.apply(opts); err != nil {
+		return nil, err
+	}
+
+	bundle := new(Bundle)
+	switch {
+	case bytes.Contains(b, PEMBlockHeader):
+		bundle.parsePEM(ctx, b)
+	case isAuthorizedKeys(b):
+		bundle.parseAuthorizedKeys(b)
+	default:
+		bundle.parseDER(b)
+	}
+
+	if len(bundle.Objects) == 0 {
+		if len(bundle.Errors) > 0 {
+			return nil, errors.Wrapf(bundle.Errors[0], "error decoding %s", ctx.filename)
+		}
+		return nil, errors.Errorf("error decoding %s: does not contain any valid object", ctx.filename)
+	}
+	return bundle, nil
+}
+
+func (b *Bundle) add(index int, pemType string, v interface{}) {
+	b.Objects = append(b.Objects, Object{
+		Index:   index,
+		PEMType: pemType,
+		Type:    objectType(v),
+		Value:   v,
+	})
+}
+
+func (b *Bundle) addError(index int, pemType string, err error) {
+	b.Errors = append(b.Errors, &BlockError{
+		Index:   index,
+		PEMType: pemType,
+		Err:     err,
+	})
+}
+
+func (b *Bundle) parsePEM(ctx *context, data []byte) {
+	var block *pem.Block
+	for i := 0; len(data) > 0; i++ {
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "EC PARAMETERS":
+			// Curve parameters are generated by OpenSSL along with the key,
+			// the curve is also encoded in the key.
+			continue
+		case "X509 CRL":
+			crl, err := x509.ParseRevocationList(block.Bytes)
+			if err != nil {
+				b.addError(i, block.Type, err)
+			} else {
+				b.add(i, block.Type, crl)
+			}
+		case "TSS2 PRIVATE KEY":
+			key, err := tss2.ParsePrivateKey(block.Bytes)
+			if err != nil {
+				b.addError(i, block.Type, err)
+			} else {
+				b.add(i, block.Type, key)
+			}
+		default:
+			// Request the password once and use it for all the blocks.
+			if isEncryptedBlock(block) && len(ctx.password) == 0 {
+				pass, err := ctx.promptPassword()
+				if err != nil {
+					b.addError(i, block.Type, err)
+					continue
+				}
+				ctx.password = pass
+			}
+			v, err := Parse(pem.EncodeToMemory(block), withContext(ctx))
+			if err != nil {
+				b.addError(i, block.Type, err)
+			} else {
+				b.add(i, block.Type, v)
+			}
+		}
+	}
+}
+
+func (b *Bundle) parseDER(data []byte) {
+	// Base64 encoded DER
+	if der, err := base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(data), nil))); err == nil && len(der) > 0 {
+		data = der
+	}
+
+	if crt, err := x509.ParseCertificate(data); err == nil {
+		b.add(0, "", crt)
+		return
+	}
+	if csr, err := x509.ParseCertificateRequest(data); err == nil {
+		b.add(0, "", csr)
+		return
+	}
+	if crl, err := x509.ParseRevocationList(data); err == nil {
+		b.add(0, "", crl)
+		return
+	}
+	if key, err := ParseDER(data); err == nil {
+		b.add(0, "", key)
+		return
+	}
+	if key, err := tss2.ParsePrivateKey(data); err == nil {
+		b.add(0, "", key)
+		return
+	}
+	b.addError(0, "", errors.New("unsupported DER encoded object"))
+}
+
+func (b *Bundle) parseAuthorizedKeys(data []byte) {
+	var i int
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey(line)
+		if err != nil {
+			b.addError(i, "", errors.Wrap(err, "error parsing OpenSSH key"))
+		} else {
+			b.add(i, "", key)
+		}
+		i++
+	}
+}
+
+// isAuthorizedKeys returns true if the first non-empty line in the data is an
+// SSH public key in the authorized_keys format.
+func isAuthorizedKeys(data []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		_, _, _, _, err := ssh.ParseAuthorizedKey(line)
+		return err == nil
+	}
+	return false
+}
+
+// isEncryptedBlock returns true if the block is a password protected key that
+// can be decrypted by Parse.
+func isEncryptedBlock(block *pem.Block) bool {
+	switch {
+	case block.Headers["Proc-Type"] == "4,ENCRYPTED":
+		return true
+	case block.Type == "ENCRYPTED PRIVATE KEY", block.Type == "ENCRYPTED COSIGN PRIVATE KEY":
+		return true
+	default:
+		return false
+	}
+}
+
+// objectType returns the ObjectType for the given value.
+func objectType(v interface{}) ObjectType {
+	switch v.(type) {
+	case *x509.Certificate:
+		return ObjectCertificate
+	case *x509.CertificateRequest:
+		return ObjectCertificateRequest
+	case *x509.RevocationList:
+		return ObjectRevocationList
+	case *tss2.TPMKey:
+		return ObjectTSS2PrivateKey
+	case *ssh.Certificate:
+		return ObjectSSHCertificate
+	case ssh.PublicKey:
+		return ObjectSSHPublicKey
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey, *ecdh.PrivateKey, x25519.PrivateKey:
+		return ObjectPrivateKey
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey, *ecdh.PublicKey, x25519.PublicKey:
+		return ObjectPublicKey
+	default:
+		return ObjectUnknown
+	}
+}
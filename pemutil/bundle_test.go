@@ -0,0 +1,249 @@
+package pemutil
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/tpm/tss2"
+	"golang.org/x/crypto/ssh"
+)
+
+type bundleTestData struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+	csr  *x509.CertificateRequest
+	crl  *x509.RevocationList
+}
+
+func newBundleTestData(t *testing.T) *bundleTestData {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now,
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.FatalError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+
+	der, err = x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "Test"},
+	}, key)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+
+	der, err = x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: now,
+		NextUpdate: now.Add(time.Hour),
+	}, cert, key)
+	assert.FatalError(t, err)
+	crl, err := x509.ParseRevocationList(der)
+	assert.FatalError(t, err)
+
+	return &bundleTestData{key: key, cert: cert, csr: csr, crl: crl}
+}
+
+func mustSerialize(t *testing.T, v interface{}, opts ...Options) []byte {
+	t.Helper()
+	block, err := Serialize(v, opts...)
+	assert.FatalError(t, err)
+	return pem.EncodeToMemory(block)
+}
+
+func TestParseBundle(t *testing.T) {
+	td := newBundleTestData(t)
+	tss2Key, err := tss2.EncodeToMemory([]byte{0, 1, 0}, []byte{0, 1, 0})
+	assert.FatalError(t, err)
+
+	var data []byte
+	data = append(data, mustSerialize(t, td.key, WithPassword([]byte("mypassword")), WithPKCS8(true))...)
+	data = append(data, mustSerialize(t, td.cert)...)
+	data = append(data, []byte("# some text between blocks\n")...)
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: td.crl.Raw})...)
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: td.csr.Raw})...)
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{0x06, 0x00}})...)
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("bad certificate")})...)
+	data = append(data, mustSerialize(t, td.key.Public())...)
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "FOO", Bytes: []byte("foo")})...)
+	data = append(data, tss2Key...)
+
+	var prompts int
+	bundle, err := ParseBundle(data, WithPasswordPrompt("Password", func(s string) ([]byte, error) {
+		prompts++
+		return []byte("mypassword"), nil
+	}))
+	assert.FatalError(t, err)
+	assert.Equals(t, 1, prompts)
+
+	assert.Equals(t, ObjectPrivateKey, bundle.Objects[0].Type)
+	assert.Equals(t, "ENCRYPTED PRIVATE KEY", bundle.Objects[0].PEMType)
+	assert.Equals(t, []*x509.Certificate{td.cert}, bundle.Certificates())
+	assert.Equals(t, []*x509.CertificateRequest{td.csr}, bundle.CertificateRequests())
+	assert.Len(t, 1, bundle.RevocationLists())
+	assert.Equals(t, td.crl.Raw, bundle.RevocationLists()[0].Raw)
+	assert.Len(t, 1, bundle.PrivateKeys())
+	assert.True(t, td.key.Equal(bundle.PrivateKeys()[0]))
+	assert.Len(t, 1, bundle.PublicKeys())
+	assert.True(t, td.key.PublicKey.Equal(bundle.PublicKeys()[0]))
+
+	// Bad certificate and unknown block.
+	assert.Len(t, 2, bundle.Errors)
+	assert.Equals(t, 5, bundle.Errors[0].Index)
+	assert.Equals(t, "CERTIFICATE", bundle.Errors[0].PEMType)
+	assert.Equals(t, "FOO", bundle.Errors[1].PEMType)
+	assert.HasPrefix(t, bundle.Errors[1].Error(), "error decoding object 7 (FOO): ")
+	assert.Error(t, errors.Unwrap(bundle.Errors[1]))
+
+	assert.Len(t, 1, bundle.TSS2PrivateKeys())
+
+	key, cert, err := bundle.KeyPair()
+	assert.FatalError(t, err)
+	assert.Equals(t, td.cert, cert)
+	assert.True(t, td.key.Equal(key))
+}
+
+func TestParseBundle_keyPairMismatch(t *testing.T) {
+	td1 := newBundleTestData(t)
+	td2 := newBundleTestData(t)
+
+	data := append(mustSerialize(t, td1.key), mustSerialize(t, td2.cert)...)
+	bundle, err := ParseBundle(data)
+	assert.FatalError(t, err)
+	_, _, err = bundle.KeyPair()
+	assert.Error(t, err)
+
+	bundle, err = ParseBundle(mustSerialize(t, td1.key))
+	assert.FatalError(t, err)
+	_, _, err = bundle.KeyPair()
+	assert.Error(t, err)
+
+	bundle, err = ParseBundle(mustSerialize(t, td1.cert))
+	assert.FatalError(t, err)
+	_, _, err = bundle.KeyPair()
+	assert.Error(t, err)
+}
+
+func TestParseBundle_der(t *testing.T) {
+	td := newBundleTestData(t)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(td.key)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		wantType ObjectType
+	}{
+		{"certificate", td.cert.Raw, ObjectCertificate},
+		{"certificate base64", []byte(base64.StdEncoding.EncodeToString(td.cert.Raw) + "\n"), ObjectCertificate},
+		{"certificate request", td.csr.Raw, ObjectCertificateRequest},
+		{"revocation list", td.crl.Raw, ObjectRevocationList},
+		{"private key", pkcs8, ObjectPrivateKey},
+		{"private key base64", []byte(base64.StdEncoding.EncodeToString(pkcs8)), ObjectPrivateKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundle, err := ParseBundle(tt.data)
+			assert.FatalError(t, err)
+			assert.Len(t, 1, bundle.Objects)
+			assert.Equals(t, tt.wantType, bundle.Objects[0].Type)
+			assert.Equals(t, "", bundle.Objects[0].PEMType)
+		})
+	}
+
+	_, err = ParseBundle([]byte("not a valid object"))
+	assert.Error(t, err)
+}
+
+func TestParseBundle_ssh(t *testing.T) {
+	pub, err := os.ReadFile("testdata/openssh.ed25519.pub.pem")
+	assert.FatalError(t, err)
+	pub2, err := os.ReadFile("testdata/openssh.p256.pub.pem")
+	assert.FatalError(t, err)
+
+	data := bytes.Join([][]byte{[]byte("# comment"), pub, []byte("ssh-ed25519 bad"), pub2}, []byte("\n"))
+	bundle, err := ParseBundle(data)
+	assert.FatalError(t, err)
+	assert.Len(t, 2, bundle.SSHPublicKeys())
+	assert.Equals(t, ssh.KeyAlgoED25519, bundle.SSHPublicKeys()[0].Type())
+	assert.Equals(t, ssh.KeyAlgoECDSA256, bundle.SSHPublicKeys()[1].Type())
+	assert.Len(t, 0, bundle.SSHCertificates())
+	assert.Len(t, 1, bundle.Errors)
+	assert.Equals(t, 1, bundle.Errors[0].Index)
+}
+
+func TestParseBundle_errors(t *testing.T) {
+	td := newBundleTestData(t)
+	encrypted := mustSerialize(t, td.key, WithPassword([]byte("mypassword")))
+
+	_, err := ParseBundle(encrypted, WithPasswordPrompt("Password", func(s string) ([]byte, error) {
+		return nil, errors.New("an error")
+	}))
+	assert.Error(t, err)
+
+	_, err = ParseBundle(encrypted, WithPassword([]byte("badpassword")))
+	assert.Error(t, err)
+
+	_, err = ParseBundle(encrypted, WithPasswordFile("testdata/missing.txt"))
+	assert.Error(t, err)
+
+	bundle, err := ParseBundle(encrypted, WithPasswordFile("testdata/password.txt"))
+	assert.FatalError(t, err)
+	assert.Len(t, 1, bundle.PrivateKeys())
+}
+
+func TestReadBundle(t *testing.T) {
+	bundle, err := ReadBundle("testdata/bundle.crt")
+	assert.FatalError(t, err)
+	assert.Len(t, 2, bundle.Certificates())
+	assert.Len(t, 0, bundle.Errors)
+
+	_, err = ReadBundle("testdata/missing.crt")
+	assert.Error(t, err)
+}
+
+func TestObjectType_String(t *testing.T) {
+	tests := []struct {
+		typ  ObjectType
+		want string
+	}{
+		{ObjectUnknown, "unknown"},
+		{ObjectPrivateKey, "private key"},
+		{ObjectPublicKey, "public key"},
+		{ObjectCertificate, "certificate"},
+		{ObjectCertificateRequest, "certificate request"},
+		{ObjectRevocationList, "revocation list"},
+		{ObjectSSHPublicKey, "ssh public key"},
+		{ObjectSSHCertificate, "ssh certificate"},
+		{ObjectTSS2PrivateKey, "tss2 private key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equals(t, tt.want, tt.typ.String())
+		})
+	}
+	assert.Equals(t, ObjectUnknown, objectType("foo"))
+}
@@ -5,21 +5,23 @@ package pemutil
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/ecdh"
 	"crypto/ecdsa"
 	"crypto/ed25519"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"math"
 	"math/big"
 	"os"
 	"strings"
 
 	"github.com/pkg/errors"
+	"go.step.sm/crypto/internal/ecdhutil"
 	"go.step.sm/crypto/internal/utils"
 	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/x25519"
@@ -61,6 +63,9 @@ type context struct {
 	firstBlock       bool
 	passwordPrompt   string
 	passwordPrompter PasswordPrompter
+	pbes2            pbes2Options
+	sshCipher        string
+	sshRounds        int
 }
 
 // newContext initializes the context with a filename.
@@ -182,6 +187,62 @@ func WithPKCS8(v bool) Options {
 	}
 }
 
+// WithPKCS8Cipher is an option used in the Serialize method and
+// EncryptPKCS8PrivateKeyWithOptions to set the algorithm used to encrypt
+// PKCS#8 private keys. WithPKCS8 must be set to true in the Serialize method.
+func WithPKCS8Cipher(c PKCS8Cipher) Options {
+	return func(ctx *context) error {
+		if cipherByName(c) == nil && aeadByName(c) == nil {
+			return errors.Errorf("unsupported PKCS#8 cipher %q", c)
+		}
+		ctx.pbes2.cipher = c
+		return nil
+	}
+}
+
+// WithPBKDF2 is an option used in the Serialize method and
+// EncryptPKCS8PrivateKeyWithOptions to derive the key that encrypts PKCS#8
+// private keys using PBKDF2 with the given number of iterations and HMAC with
+// the given hash function. A zero value uses the defaults, PBKDF2Iterations
+// and SHA-256.
+func WithPBKDF2(iterations int, prf crypto.Hash) Options {
+	return func(ctx *context) error {
+		if iterations < 0 {
+			return errors.Errorf("invalid PBKDF2 iterations %d", iterations)
+		}
+		if prf != 0 && prfByHash(prf) == nil {
+			return errors.Errorf("unsupported PBKDF2 pseudorandom function %v", prf)
+		}
+		ctx.pbes2.scrypt = false
+		ctx.pbes2.iterations = iterations
+		ctx.pbes2.prf = prf
+		return nil
+	}
+}
+
+// WithScrypt is an option used in the Serialize method and
+// EncryptPKCS8PrivateKeyWithOptions to derive the key that encrypts PKCS#8
+// private keys using scrypt with the given cost parameter (N), block size (r)
+// and parallelization parameter (p). A zero value uses the defaults,
+// ScryptCost, ScryptBlockSize and ScryptParallelization.
+func WithScrypt(n, r, p int) Options {
+	return func(ctx *context) error {
+		switch {
+		case n < 0 || n == 1 || n&(n-1) != 0:
+			return errors.Errorf("invalid scrypt cost parameter %d: it must be a power of 2 greater than 1", n)
+		case r < 0:
+			return errors.Errorf("invalid scrypt block size %d", r)
+		case p < 0:
+			return errors.Errorf("invalid scrypt parallelization parameter %d", p)
+		}
+		ctx.pbes2.scrypt = true
+		ctx.pbes2.scryptN = n
+		ctx.pbes2.scryptR = r
+		ctx.pbes2.scryptP = p
+		return nil
+	}
+}
+
 // WithOpenSSH is an option used in the Serialize method to use OpenSSH encoding
 // form on the private keys. With v set to false default form will be used.
 func WithOpenSSH(v bool) Options {
@@ -191,6 +252,33 @@ func WithOpenSSH(v bool) Options {
 	}
 }
 
+// WithOpenSSHCipher is an option used in the Serialize method and
+// SerializeOpenSSHPrivateKey to set the cipher used to encrypt OpenSSH private
+// keys. It defaults to aes256-ctr, see ParseOpenSSHPrivateKey for the list of
+// supported ciphers.
+func WithOpenSSHCipher(name string) Options {
+	return func(ctx *context) error {
+		if sshCipherByName(name) == nil {
+			return errors.Errorf("unsupported OpenSSH cipher %q", name)
+		}
+		ctx.sshCipher = name
+		return nil
+	}
+}
+
+// WithOpenSSHRounds is an option used in the Serialize method and
+// SerializeOpenSSHPrivateKey to set the number of bcrypt_pbkdf rounds used to
+// derive the key that encrypts OpenSSH private keys. It defaults to 16.
+func WithOpenSSHRounds(rounds int) Options {
+	return func(ctx *context) error {
+		if rounds < 1 || rounds > math.MaxUint32 {
+			return errors.Errorf("invalid OpenSSH rounds %d", rounds)
+		}
+		ctx.sshRounds = rounds
+		return nil
+	}
+}
+
 // WithComment is an option used in the Serialize method to add a comment in the
 // OpenSSH private keys. WithOpenSSH must be set to true too.
 func WithComment(comment string) Options {
@@ -609,6 +697,9 @@ func Serialize(in interface{}, opts ...Options) (*pem.Block, error) {
 				Bytes: b,
 			}
 		}
+	case *SKPrivateKey:
+		// FIDO keys can only be serialized using the OpenSSH format.
+		return SerializeOpenSSHPrivateKey(k, withContext(ctx))
 	case *x509.Certificate:
 		p = &pem.Block{
 			Type:  "CERTIFICATE",
@@ -634,7 +725,13 @@ func Serialize(in interface{}, opts ...Options) (*pem.Block, error) {
 		if password != nil {
 			if ctx.pkcs8 {
 				var err error
-				p, err = EncryptPKCS8PrivateKey(rand.Reader, p.Bytes, password, DefaultEncCipher)
+				opts := ctx.pbes2
+				if opts.cipher == "" {
+					if alg := cipherByKey(DefaultEncCipher); alg != nil {
+						opts.cipher = PKCS8Cipher(alg.name)
+					}
+				}
+				p, err = encryptPKCS8PrivateKey(rand.Reader, p.Bytes, password, opts)
 				if err != nil {
 					return nil, err
 				}
@@ -681,7 +778,8 @@ func ParseDER(b []byte) (interface{}, error) {
 }
 
 // ParseSSH parses parses a public key from an authorized_keys file used in
-// OpenSSH according to the sshd(8) manual page.
+// OpenSSH according to the sshd(8) manual page. FIDO keys are returned as an
+// *SKPublicKey.
 func ParseSSH(b []byte) (interface{}, error) {
 	key, _, _, _, err := ssh.ParseAuthorizedKey(b)
 	if err != nil {
@@ -745,29 +843,7 @@ func ParseSSH(b []byte) (interface{}, error) {
 
 		// convert ECDH public key to ECDSA public key to keep
 		// the returned type backwards compatible.
-		rawKey := p.Bytes()
-		switch p.Curve() {
-		case ecdh.P256():
-			return &ecdsa.PublicKey{
-				Curve: elliptic.P256(),
-				X:     big.NewInt(0).SetBytes(rawKey[1:33]),
-				Y:     big.NewInt(0).SetBytes(rawKey[33:]),
-			}, nil
-		case ecdh.P384():
-			return &ecdsa.PublicKey{
-				Curve: elliptic.P384(),
-				X:     big.NewInt(0).SetBytes(rawKey[1:49]),
-				Y:     big.NewInt(0).SetBytes(rawKey[49:]),
-			}, nil
-		case ecdh.P521():
-			return &ecdsa.PublicKey{
-				Curve: elliptic.P521(),
-				X:     big.NewInt(0).SetBytes(rawKey[1:67]),
-				Y:     big.NewInt(0).SetBytes(rawKey[67:]),
-			}, nil
-		default:
-			return nil, errors.New("cannot convert non-NIST *ecdh.PublicKey to *ecdsa.PublicKey")
-		}
+		return ecdhutil.ToECDSAPublicKey(p)
 	case ssh.KeyAlgoED25519:
 		var w struct {
 			Name     string
@@ -777,6 +853,39 @@ func ParseSSH(b []byte) (interface{}, error) {
 			return nil, errors.Wrap(err, "error unmarshaling key")
 		}
 		return ed25519.PublicKey(w.KeyBytes), nil
+	case ssh.KeyAlgoSKECDSA256:
+		var w struct {
+			Name        string
+			ID          string
+			KeyBytes    []byte
+			Application string
+		}
+		if err := ssh.Unmarshal(key.Marshal(), &w); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling key")
+		}
+		pub, err := parseOpenSSHECDSAPublicKey(ssh.KeyAlgoECDSA256, w.ID, w.KeyBytes)
+		if err != nil {
+			return nil, err
+		}
+		return &SKPublicKey{
+			Type:        w.Name,
+			PublicKey:   pub,
+			Application: w.Application,
+		}, nil
+	case ssh.KeyAlgoSKED25519:
+		var w struct {
+			Name        string
+			KeyBytes    []byte
+			Application string
+		}
+		if err := ssh.Unmarshal(key.Marshal(), &w); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling key")
+		}
+		return &SKPublicKey{
+			Type:        w.Name,
+			PublicKey:   ed25519.PublicKey(w.KeyBytes),
+			Application: w.Application,
+		}, nil
 	case ssh.KeyAlgoDSA:
 		return nil, errors.Errorf("DSA keys not supported")
 	default:
@@ -1,20 +1,23 @@
 package pemutil
 
 import (
+	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/des"  //nolint:gosec // support for legacy keys
-	"crypto/sha1" //nolint:gosec // support for legacy keys
-	"crypto/sha256"
+	"crypto/des"    //nolint:gosec // support for legacy keys
+	_ "crypto/sha1" //nolint:gosec // support for legacy keys
+	_ "crypto/sha256"
+	_ "crypto/sha512"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/pem"
-	"hash"
 	"io"
 
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
 	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
 )
 
 // PBKDF2SaltSize is the default size of the salt for PBKDF2, 128-bit salt.
@@ -48,55 +51,152 @@ type publicKeyInfo struct {
 // Encrypted pkcs8
 // Based on https://github.com/youmark/pkcs8
 // MIT license
-type prfParam struct {
-	Algo      asn1.ObjectIdentifier
-	NullParam asn1.RawValue
+type encryptedPrivateKeyInfo struct {
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
 }
 
+// pbes2Params reflects the PBES2-params defined in RFC 8018, appendix A.4.
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params reflects the PBKDF2-params defined in RFC 8018, appendix A.2.
 type pbkdf2Params struct {
 	Salt           []byte
 	IterationCount int
-	PrfParam       prfParam `asn1:"optional"`
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
 }
 
-type pbkdf2Algorithms struct {
-	Algo         asn1.ObjectIdentifier
-	PBKDF2Params pbkdf2Params
+// scryptParams reflects the scrypt-params defined in RFC 7914, section 7.1.
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
 }
 
-type pbkdf2Encs struct {
-	EncryAlgo asn1.ObjectIdentifier
-	IV        []byte
+// gcmParams reflects the GCMParameters defined in RFC 5084, section 3.2.
+type gcmParams struct {
+	Nonce  []byte
+	ICVLen int `asn1:"optional,default:12"`
 }
 
-type pbes2Params struct {
-	KeyDerivationFunc pbkdf2Algorithms
-	EncryptionScheme  pbkdf2Encs
-}
+var (
+	// key derivation functions
+	oidPKCS5PBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidPBES2       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidScrypt      = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+
+	// pseudorandom functions
+	oidHMACWithSHA1       = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA224     = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACWithSHA256     = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384     = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512     = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidHMACWithSHA512_224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 12}
+	oidHMACWithSHA512_256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 13}
+
+	// encryption
+	oidAES128CBC        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESCBC           = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 7}
+	oidD3DESCBC         = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidAES128GCM        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 6}
+	oidAES192GCM        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 26}
+	oidAES256GCM        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 46}
+	oidChaCha20Poly1305 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 3, 18}
+)
 
-type encryptedlAlgorithmIdentifier struct {
-	Algorithm  asn1.ObjectIdentifier
-	Parameters pbes2Params
+// PKCS8Cipher is the content encryption algorithm used to encrypt PKCS#8
+// private keys.
+type PKCS8Cipher string
+
+// PKCS8Cipher values supported by EncryptPKCS8PrivateKeyWithOptions and
+// WithPKCS8Cipher. The AEAD ciphers, AES-GCM and ChaCha20-Poly1305, are
+// recommended for new keys; the CBC ciphers are kept for compatibility.
+const (
+	PKCS8CipherDESCBC           PKCS8Cipher = "DES-CBC"
+	PKCS8Cipher3DESCBC          PKCS8Cipher = "DES-EDE3-CBC"
+	PKCS8CipherAES128CBC        PKCS8Cipher = "AES-128-CBC"
+	PKCS8CipherAES192CBC        PKCS8Cipher = "AES-192-CBC"
+	PKCS8CipherAES256CBC        PKCS8Cipher = "AES-256-CBC"
+	PKCS8CipherAES128GCM        PKCS8Cipher = "AES-128-GCM"
+	PKCS8CipherAES192GCM        PKCS8Cipher = "AES-192-GCM"
+	PKCS8CipherAES256GCM        PKCS8Cipher = "AES-256-GCM"
+	PKCS8CipherChaCha20Poly1305 PKCS8Cipher = "CHACHA20-POLY1305"
+)
+
+// Default scrypt parameters used by WithScrypt, a cost parameter of 2^15, a
+// block size of 8 and no parallelization, they are the ones recommended by
+// https://pkg.go.dev/golang.org/x/crypto/scrypt for interactive logins.
+const (
+	ScryptCost            = 32768
+	ScryptBlockSize       = 8
+	ScryptParallelization = 1
+)
+
+// Limits on the scrypt parameters of encrypted keys. The memory used by scrypt
+// is about 128·r·(N+p) bytes, it is limited to 64 MiB, twice the OpenSSL
+// default, so keys encrypted with the default parameters can be decrypted. The
+// parallelization parameter multiplies the computation time, it is limited to
+// 16.
+const (
+	scryptMaxMemory          = 64 << 20
+	scryptMaxParallelization = 16
+)
+
+// validateScryptParams checks that the scrypt parameters are valid and that
+// deriving a key with them will not use an excessive amount of memory or time.
+func validateScryptParams(n, r, p int) error {
+	switch {
+	case n <= 1 || n&(n-1) != 0:
+		return errors.Errorf("invalid scrypt cost parameter %d: it must be a power of 2 greater than 1", n)
+	case r <= 0:
+		return errors.Errorf("invalid scrypt block size %d", r)
+	case p <= 0 || p > scryptMaxParallelization:
+		return errors.Errorf("invalid scrypt parallelization parameter %d: it must be between 1 and %d", p, scryptMaxParallelization)
+	case uint64(n)+uint64(p) > scryptMaxMemory/(128*uint64(r)):
+		return errors.Errorf("invalid scrypt parameters: N=%d, r=%d and p=%d require more than %d bytes of memory", n, r, p, scryptMaxMemory)
+	}
+	return nil
 }
 
-type encryptedPrivateKeyInfo struct {
-	Algo       encryptedlAlgorithmIdentifier
-	PrivateKey []byte
+// pbkdf2PRFs holds the pseudorandom functions supported by PBKDF2.
+var pbkdf2PRFs = []struct {
+	hash       crypto.Hash
+	identifier asn1.ObjectIdentifier
+}{
+	{crypto.SHA1, oidHMACWithSHA1},
+	{crypto.SHA224, oidHMACWithSHA224},
+	{crypto.SHA256, oidHMACWithSHA256},
+	{crypto.SHA384, oidHMACWithSHA384},
+	{crypto.SHA512, oidHMACWithSHA512},
+	{crypto.SHA512_224, oidHMACWithSHA512_224},
+	{crypto.SHA512_256, oidHMACWithSHA512_256},
 }
 
-var (
-	// key derivation functions
-	oidPKCS5PBKDF2    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
-	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
-	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+func prfByHash(h crypto.Hash) asn1.ObjectIdentifier {
+	for _, prf := range pbkdf2PRFs {
+		if prf.hash == h {
+			return prf.identifier
+		}
+	}
+	return nil
+}
 
-	// encryption
-	oidAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
-	oidAES192CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
-	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
-	oidDESCBC    = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 7}
-	oidD3DESCBC  = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
-)
+func prfByIdentifier(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	for _, prf := range pbkdf2PRFs {
+		if prf.identifier.Equal(oid) {
+			return prf.hash, true
+		}
+	}
+	return 0, false
+}
 
 // rfc1423Algo holds a method for enciphering a PEM block.
 type rfc1423Algo struct {
@@ -158,11 +258,240 @@ func cipherByKey(key x509.PEMCipher) *rfc1423Algo {
 	return nil
 }
 
-// deriveKey uses a key derivation function to stretch the password into a key
-// with the number of bits our cipher requires. This algorithm was derived from
-// the OpenSSL source.
-func (c rfc1423Algo) deriveKey(password, salt []byte, h func() hash.Hash) []byte {
-	return pbkdf2.Key(password, salt, PBKDF2Iterations, c.keySize, h)
+func cipherByName(name PKCS8Cipher) *rfc1423Algo {
+	for i := range rfc1423Algos {
+		alg := &rfc1423Algos[i]
+		if alg.name == string(name) {
+			return alg
+		}
+	}
+	return nil
+}
+
+func cipherByIdentifier(oid asn1.ObjectIdentifier) *rfc1423Algo {
+	for i := range rfc1423Algos {
+		alg := &rfc1423Algos[i]
+		if alg.identifier.Equal(oid) {
+			return alg
+		}
+	}
+	return nil
+}
+
+// aeadAlgo holds an authenticated cipher used to encrypt PKCS#8 keys.
+type aeadAlgo struct {
+	name       PKCS8Cipher
+	keySize    int
+	identifier asn1.ObjectIdentifier
+	gcm        bool
+}
+
+// aeadAlgos holds the AEAD ciphers supported in PBES2. AES-GCM is defined in
+// RFC 5084 and ChaCha20-Poly1305 in RFC 8103.
+var aeadAlgos = []aeadAlgo{
+	{name: PKCS8CipherAES128GCM, keySize: 16, identifier: oidAES128GCM, gcm: true},
+	{name: PKCS8CipherAES192GCM, keySize: 24, identifier: oidAES192GCM, gcm: true},
+	{name: PKCS8CipherAES256GCM, keySize: 32, identifier: oidAES256GCM, gcm: true},
+	{name: PKCS8CipherChaCha20Poly1305, keySize: chacha20poly1305.KeySize, identifier: oidChaCha20Poly1305},
+}
+
+func aeadByName(name PKCS8Cipher) *aeadAlgo {
+	for i := range aeadAlgos {
+		alg := &aeadAlgos[i]
+		if alg.name == name {
+			return alg
+		}
+	}
+	return nil
+}
+
+func aeadByIdentifier(oid asn1.ObjectIdentifier) *aeadAlgo {
+	for i := range aeadAlgos {
+		alg := &aeadAlgos[i]
+		if alg.identifier.Equal(oid) {
+			return alg
+		}
+	}
+	return nil
+}
+
+// newAEAD returns the cipher.AEAD for the given key and tag size.
+func (a aeadAlgo) newAEAD(key []byte, tagSize int) (cipher.AEAD, error) {
+	if !a.gcm {
+		if tagSize != chacha20poly1305.Overhead {
+			return nil, errors.Errorf("invalid tag size %d", tagSize)
+		}
+		return chacha20poly1305.New(key)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCMWithTagSize(block, tagSize)
+}
+
+// marshalParams returns the encryption scheme parameters for the given nonce.
+// The tag size is always 16 bytes.
+func (a aeadAlgo) marshalParams(nonce []byte) ([]byte, error) {
+	if a.gcm {
+		return asn1.Marshal(gcmParams{Nonce: nonce, ICVLen: 16})
+	}
+	return asn1.Marshal(nonce)
+}
+
+// parseParams returns the nonce and tag size in the encryption scheme
+// parameters.
+func (a aeadAlgo) parseParams(b []byte) ([]byte, int, error) {
+	if a.gcm {
+		var params gcmParams
+		if err := unmarshalParams(b, &params); err != nil {
+			return nil, 0, err
+		}
+		return params.Nonce, params.ICVLen, nil
+	}
+	var nonce []byte
+	if err := unmarshalParams(b, &nonce); err != nil {
+		return nil, 0, err
+	}
+	return nonce, chacha20poly1305.Overhead, nil
+}
+
+// unmarshalParams unmarshals the given algorithm parameters failing if there's
+// trailing data.
+func unmarshalParams(b []byte, v interface{}) error {
+	rest, err := asn1.Unmarshal(b, v)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errors.New("trailing data after parameters")
+	}
+	return nil
+}
+
+// pbes2Options are the options used to encrypt PKCS#8 keys, they are set using
+// WithPKCS8Cipher, WithPBKDF2 and WithScrypt.
+type pbes2Options struct {
+	cipher                    PKCS8Cipher
+	iterations                int
+	prf                       crypto.Hash
+	scrypt                    bool
+	scryptN, scryptR, scryptP int
+}
+
+// deriveKey derives a key of the given size from the password and returns it
+// with the key derivation function used.
+func (o pbes2Options) deriveKey(password, salt []byte, keySize int) (pkix.AlgorithmIdentifier, []byte, error) {
+	if o.scrypt {
+		params := scryptParams{
+			Salt:                     salt,
+			CostParameter:            o.scryptN,
+			BlockSize:                o.scryptR,
+			ParallelizationParameter: o.scryptP,
+		}
+		if params.CostParameter == 0 {
+			params.CostParameter = ScryptCost
+		}
+		if params.BlockSize == 0 {
+			params.BlockSize = ScryptBlockSize
+		}
+		if params.ParallelizationParameter == 0 {
+			params.ParallelizationParameter = ScryptParallelization
+		}
+		// keys that cannot be decrypted are not created
+		if err := validateScryptParams(params.CostParameter, params.BlockSize, params.ParallelizationParameter); err != nil {
+			return pkix.AlgorithmIdentifier{}, nil, err
+		}
+		key, err := scrypt.Key(password, salt, params.CostParameter, params.BlockSize, params.ParallelizationParameter, keySize)
+		if err != nil {
+			return pkix.AlgorithmIdentifier{}, nil, errors.Wrap(err, "failed to derive key")
+		}
+		b, err := asn1.Marshal(params)
+		if err != nil {
+			return pkix.AlgorithmIdentifier{}, nil, errors.Wrap(err, "error marshaling scrypt parameters")
+		}
+		return pkix.AlgorithmIdentifier{
+			Algorithm:  oidScrypt,
+			Parameters: asn1.RawValue{FullBytes: b},
+		}, key, nil
+	}
+
+	params := pbkdf2Params{
+		Salt:           salt,
+		IterationCount: o.iterations,
+	}
+	if params.IterationCount == 0 {
+		params.IterationCount = PBKDF2Iterations
+	}
+	prf := o.prf
+	if prf == 0 {
+		prf = crypto.SHA256
+	}
+	oid := prfByHash(prf)
+	if oid == nil {
+		return pkix.AlgorithmIdentifier{}, nil, errors.Errorf("unsupported pseudorandom function %v", prf)
+	}
+	// HMAC-SHA1 is the default value, and DER requires to omit it.
+	if prf != crypto.SHA1 {
+		params.PRF = pkix.AlgorithmIdentifier{
+			Algorithm:  oid,
+			Parameters: asn1.NullRawValue,
+		}
+	}
+	b, err := asn1.Marshal(params)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, errors.Wrap(err, "error marshaling PBKDF2 parameters")
+	}
+	return pkix.AlgorithmIdentifier{
+		Algorithm:  oidPKCS5PBKDF2,
+		Parameters: asn1.RawValue{FullBytes: b},
+	}, pbkdf2.Key(password, salt, params.IterationCount, keySize, prf.New), nil
+}
+
+// deriveKey uses the key derivation function in the given algorithm identifier
+// to stretch the password into a key with the number of bits our cipher
+// requires.
+func deriveKey(kdf pkix.AlgorithmIdentifier, password []byte, keySize int) ([]byte, error) {
+	switch {
+	case kdf.Algorithm.Equal(oidPKCS5PBKDF2):
+		var params pbkdf2Params
+		if err := unmarshalParams(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal PBKDF2 parameters")
+		}
+		if params.IterationCount <= 0 {
+			return nil, errors.New("invalid PBKDF2 parameters: invalid iteration count")
+		}
+		if params.KeyLength != 0 && params.KeyLength != keySize {
+			return nil, errors.New("invalid PBKDF2 parameters: invalid key length")
+		}
+		// pbkdf2 hash function, HMAC-SHA1 by default
+		prf := crypto.SHA1
+		if len(params.PRF.Algorithm) > 0 {
+			var ok bool
+			if prf, ok = prfByIdentifier(params.PRF.Algorithm); !ok {
+				return nil, errors.Errorf("unsupported encrypted PEM: unknown pseudorandom function %v", params.PRF.Algorithm)
+			}
+		}
+		return pbkdf2.Key(password, params.Salt, params.IterationCount, keySize, prf.New), nil
+	case kdf.Algorithm.Equal(oidScrypt):
+		var params scryptParams
+		if err := unmarshalParams(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal scrypt parameters")
+		}
+		if params.KeyLength != 0 && params.KeyLength != keySize {
+			return nil, errors.New("invalid scrypt parameters: invalid key length")
+		}
+		if err := validateScryptParams(params.CostParameter, params.BlockSize, params.ParallelizationParameter); err != nil {
+			return nil, err
+		}
+		key, err := scrypt.Key(password, params.Salt, params.CostParameter, params.BlockSize, params.ParallelizationParameter, keySize)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid scrypt parameters")
+		}
+		return key, nil
+	default:
+		return nil, errors.New("unsupported encrypted PEM: only PBKDF2 and scrypt are supported")
+	}
 }
 
 // DecryptPEMBlock takes a password encrypted PEM block and the password used
@@ -170,8 +499,7 @@ func (c rfc1423Algo) deriveKey(password, salt []byte, h func() hash.Hash) []byte
 //
 // If the PEM blocks has the Proc-Type header set to "4,ENCRYPTED" it uses
 // x509.DecryptPEMBlock to decrypt the block. If not it tries to decrypt the
-// block using AES-128-CBC, AES-192-CBC, AES-256-CBC, DES, or 3DES using the
-// key derived using PBKDF2 over the given password.
+// block as an encrypted PKCS#8 private key, see DecryptPKCS8PrivateKey.
 func DecryptPEMBlock(block *pem.Block, password []byte) ([]byte, error) {
 	if block.Headers["Proc-Type"] == "4,ENCRYPTED" {
 		return x509.DecryptPEMBlock(block, password)
@@ -188,12 +516,15 @@ func DecryptPEMBlock(block *pem.Block, password []byte) ([]byte, error) {
 // DecryptPKCS8PrivateKey takes a password encrypted private key using the
 // PKCS#8 encoding and returns the decrypted data in PKCS#8 form. If an
 // incorrect password is detected an x509.IncorrectPasswordError is returned.
-// Because of deficiencies in the format, it's not always possible to detect an
-// incorrect password. In these cases no error will be returned but the
+// Because of deficiencies in the CBC modes, it's not always possible to detect
+// an incorrect password. In these cases no error will be returned but the
 // decrypted DER bytes will be random noise.
 //
-// It supports AES-128-CBC, AES-192-CBC, AES-256-CBC, DES, or 3DES encrypted
-// data using the key derived with PBKDF2 over the given password.
+// It supports PBES2 with the PBKDF2 or scrypt key derivation functions, PBKDF2
+// can use HMAC with SHA-1, SHA-224, SHA-256, SHA-384, SHA-512, SHA-512/224 or
+// SHA-512/256. Data can be encrypted using AES-128-CBC, AES-192-CBC,
+// AES-256-CBC, DES, 3DES, AES-128-GCM, AES-192-GCM, AES-256-GCM or
+// ChaCha20-Poly1305.
 func DecryptPKCS8PrivateKey(data, password []byte) ([]byte, error) {
 	var pki encryptedPrivateKeyInfo
 	if _, err := asn1.Unmarshal(data, &pki); err != nil {
@@ -204,52 +535,66 @@ func DecryptPKCS8PrivateKey(data, password []byte) ([]byte, error) {
 		return nil, errors.New("unsupported encrypted PEM: only PBES2 is supported")
 	}
 
-	if !pki.Algo.Parameters.KeyDerivationFunc.Algo.Equal(oidPKCS5PBKDF2) {
-		return nil, errors.New("unsupported encrypted PEM: only PBKDF2 is supported")
+	var params pbes2Params
+	if err := unmarshalParams(pki.Algo.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal PBES2 parameters")
 	}
 
-	encParam := pki.Algo.Parameters.EncryptionScheme
-	kdfParam := pki.Algo.Parameters.KeyDerivationFunc.PBKDF2Params
+	encParam := params.EncryptionScheme
+	if alg := aeadByIdentifier(encParam.Algorithm); alg != nil {
+		nonce, tagSize, err := alg.parseParams(encParam.Parameters.FullBytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal encryption parameters")
+		}
+		symkey, err := deriveKey(params.KeyDerivationFunc, password, alg.keySize)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := alg.newAEAD(symkey, tagSize)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create cipher")
+		}
+		if len(nonce) != aead.NonceSize() {
+			return nil, errors.New("error decrypting PEM: invalid nonce size")
+		}
+		// The authentication tag is appended to the ciphertext, a failure
+		// verifying it means that the password was incorrect.
+		data, err = aead.Open(nil, nonce, pki.PrivateKey, nil)
+		if err != nil {
+			return nil, x509.IncorrectPasswordError
+		}
+		return data, nil
+	}
 
-	iv := encParam.IV
-	salt := kdfParam.Salt
-	iter := kdfParam.IterationCount
+	alg := cipherByIdentifier(encParam.Algorithm)
+	if alg == nil {
+		return nil, errors.Errorf("unsupported encrypted PEM: unknown algorithm %v", encParam.Algorithm)
+	}
 
-	// pbkdf2 hash function
-	keyHash := sha1.New
-	if kdfParam.PrfParam.Algo.Equal(oidHMACWithSHA256) {
-		keyHash = sha256.New
+	var iv []byte
+	if err := unmarshalParams(encParam.Parameters.FullBytes, &iv); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal encryption parameters")
+	}
+	if len(iv) != alg.blockSize {
+		return nil, errors.New("error decrypting PEM: invalid IV size")
 	}
 
-	var symkey []byte
-	var block cipher.Block
-	var err error
-	switch {
-	// AES-128-CBC, AES-192-CBC, AES-256-CBC
-	case encParam.EncryAlgo.Equal(oidAES128CBC):
-		symkey = pbkdf2.Key(password, salt, iter, 16, keyHash)
-		block, err = aes.NewCipher(symkey)
-	case encParam.EncryAlgo.Equal(oidAES192CBC):
-		symkey = pbkdf2.Key(password, salt, iter, 24, keyHash)
-		block, err = aes.NewCipher(symkey)
-	case encParam.EncryAlgo.Equal(oidAES256CBC):
-		symkey = pbkdf2.Key(password, salt, iter, 32, keyHash)
-		block, err = aes.NewCipher(symkey)
-	// DES, TripleDES
-	case encParam.EncryAlgo.Equal(oidDESCBC):
-		symkey = pbkdf2.Key(password, salt, iter, 8, keyHash)
-		block, err = des.NewCipher(symkey) //nolint:gosec // support for legacy keys
-	case encParam.EncryAlgo.Equal(oidD3DESCBC):
-		symkey = pbkdf2.Key(password, salt, iter, 24, keyHash)
-		block, err = des.NewTripleDESCipher(symkey) //nolint:gosec // support for legacy keys
-	default:
-		return nil, errors.Errorf("unsupported encrypted PEM: unknown algorithm %v", encParam.EncryAlgo)
+	symkey, err := deriveKey(params.KeyDerivationFunc, password, alg.keySize)
+	if err != nil {
+		return nil, err
 	}
+	block, err := alg.cipherFunc(symkey)
 	if err != nil {
 		return nil, err
 	}
 
 	data = pki.PrivateKey
+	blockSize := block.BlockSize()
+	dlen := len(data)
+	if dlen == 0 || dlen%blockSize != 0 {
+		return nil, errors.New("error decrypting PEM: invalid padding")
+	}
+
 	mode := cipher.NewCBCDecrypter(block, iv)
 	mode.CryptBlocks(data, data)
 
@@ -259,12 +604,6 @@ func DecryptPKCS8PrivateKey(data, password []byte) ([]byte, error) {
 	//	[x y z 2 2]
 	//	[x y 7 7 7 7 7 7 7]
 	// If we detect a bad padding, we assume it is an invalid password.
-	blockSize := block.BlockSize()
-	dlen := len(data)
-	if dlen == 0 || dlen%blockSize != 0 {
-		return nil, errors.New("error decrypting PEM: invalid padding")
-	}
-
 	last := int(data[dlen-1])
 	if dlen < last {
 		return nil, x509.IncorrectPasswordError
@@ -289,23 +628,109 @@ func EncryptPKCS8PrivateKey(rand io.Reader, data, password []byte, alg x509.PEMC
 	if ciph == nil {
 		return nil, errors.Errorf("failed to encrypt PEM: unknown algorithm %v", alg)
 	}
+	return encryptPKCS8PrivateKey(rand, data, password, pbes2Options{
+		cipher: PKCS8Cipher(ciph.name),
+	})
+}
+
+// EncryptPKCS8PrivateKeyWithOptions returns a PEM block holding the given
+// PKCS#8 encoded private key, encrypted with a key derived from the given
+// password.
+//
+// By default it uses AES-256-CBC and PBKDF2 with HMAC-SHA256 and
+// PBKDF2Iterations iterations. The options WithPKCS8Cipher, WithPBKDF2 and
+// WithScrypt can be used to change the defaults.
+func EncryptPKCS8PrivateKeyWithOptions(rand io.Reader, data, password []byte, opts ...Options) (*pem.Block, error) {
+	ctx := newContext("PKCS#8")
+	if err := ctx.apply(opts); err != nil {
+		return nil, err
+	}
+	return encryptPKCS8PrivateKey(rand, data, password, ctx.pbes2)
+}
+
+func encryptPKCS8PrivateKey(rand io.Reader, data, password []byte, opts pbes2Options) (*pem.Block, error) {
+	name := opts.cipher
+	if name == "" {
+		name = PKCS8CipherAES256CBC
+	}
+
+	var (
+		keySize  int
+		encrypt  func(key []byte) (pkix.AlgorithmIdentifier, []byte, error)
+		ciph     = cipherByName(name)
+		aeadCiph = aeadByName(name)
+	)
+	switch {
+	case ciph != nil:
+		keySize = ciph.keySize
+		encrypt = func(key []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+			return ciph.encrypt(rand, key, data)
+		}
+	case aeadCiph != nil:
+		keySize = aeadCiph.keySize
+		encrypt = func(key []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+			return aeadCiph.encrypt(rand, key, data)
+		}
+	default:
+		return nil, errors.Errorf("failed to encrypt PEM: unknown algorithm %s", name)
+	}
 
 	salt := make([]byte, PBKDF2SaltSize)
 	if _, err := io.ReadFull(rand, salt); err != nil {
 		return nil, errors.Wrap(err, "failed to generate salt")
 	}
-	iv := make([]byte, ciph.blockSize)
+
+	kdf, key, err := opts.deriveKey(password, salt, keySize)
+	if err != nil {
+		return nil, err
+	}
+	enc, encrypted, err := encrypt(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build encrypted asn1 data
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: kdf,
+		EncryptionScheme:  enc,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling encrypted key")
+	}
+	b, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algo: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBES2,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		PrivateKey: encrypted,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling encrypted key")
+	}
+	return &pem.Block{
+		Type:  "ENCRYPTED PRIVATE KEY",
+		Bytes: b,
+	}, nil
+}
+
+// encrypt encrypts the data using the CBC mode and returns it with the
+// encryption scheme used.
+func (c rfc1423Algo) encrypt(rand io.Reader, key, data []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	iv := make([]byte, c.blockSize)
 	if _, err := io.ReadFull(rand, iv); err != nil {
-		return nil, errors.Wrap(err, "failed to generate IV")
+		return pkix.AlgorithmIdentifier{}, nil, errors.Wrap(err, "failed to generate IV")
+	}
+	params, err := asn1.Marshal(iv)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, errors.Wrap(err, "error marshaling IV")
 	}
 
-	key := ciph.deriveKey(password, salt, sha256.New)
-	block, err := ciph.cipherFunc(key)
+	block, err := c.cipherFunc(key)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create cipher")
+		return pkix.AlgorithmIdentifier{}, nil, errors.Wrap(err, "failed to create cipher")
 	}
 	enc := cipher.NewCBCEncrypter(block, iv)
-	pad := ciph.blockSize - len(data)%ciph.blockSize
+	pad := c.blockSize - len(data)%c.blockSize
 	encrypted := make([]byte, len(data), len(data)+pad)
 	// We could save this copy by encrypting all the whole blocks in
 	// the data separately, but it doesn't seem worth the additional
@@ -317,37 +742,29 @@ func EncryptPKCS8PrivateKey(rand io.Reader, data, password []byte, alg x509.PEMC
 	}
 	enc.CryptBlocks(encrypted, encrypted)
 
-	// Build encrypted asn1 data
-	pki := encryptedPrivateKeyInfo{
-		Algo: encryptedlAlgorithmIdentifier{
-			Algorithm: oidPBES2,
-			Parameters: pbes2Params{
-				KeyDerivationFunc: pbkdf2Algorithms{
-					Algo: oidPKCS5PBKDF2,
-					PBKDF2Params: pbkdf2Params{
-						Salt:           salt,
-						IterationCount: PBKDF2Iterations,
-						PrfParam: prfParam{
-							Algo:      oidHMACWithSHA256,
-							NullParam: asn1.NullRawValue,
-						},
-					},
-				},
-				EncryptionScheme: pbkdf2Encs{
-					EncryAlgo: ciph.identifier,
-					IV:        iv,
-				},
-			},
-		},
-		PrivateKey: encrypted,
-	}
+	return pkix.AlgorithmIdentifier{
+		Algorithm:  c.identifier,
+		Parameters: asn1.RawValue{FullBytes: params},
+	}, encrypted, nil
+}
 
-	b, err := asn1.Marshal(pki)
+// encrypt encrypts and authenticates the data and returns it with the
+// encryption scheme used.
+func (a aeadAlgo) encrypt(rand io.Reader, key, data []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	aead, err := a.newAEAD(key, 16)
 	if err != nil {
-		return nil, errors.Wrap(err, "error marshaling encrypted key")
+		return pkix.AlgorithmIdentifier{}, nil, errors.Wrap(err, "failed to create cipher")
 	}
-	return &pem.Block{
-		Type:  "ENCRYPTED PRIVATE KEY",
-		Bytes: b,
-	}, nil
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand, nonce); err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, errors.Wrap(err, "failed to generate nonce")
+	}
+	params, err := a.marshalParams(nonce)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, errors.Wrap(err, "error marshaling nonce")
+	}
+	return pkix.AlgorithmIdentifier{
+		Algorithm:  a.identifier,
+		Parameters: asn1.RawValue{FullBytes: params},
+	}, aead.Seal(nil, nonce, data, nil), nil
 }
@@ -1,11 +1,14 @@
 package pemutil
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"errors"
 	"os"
@@ -230,3 +233,256 @@ func TestDecryptPKCS8PrivateKey_ciphers(t *testing.T) {
 
 	}
 }
+
+func TestDecryptPKCS8PrivateKey_openssl3(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"testdata/pkcs8/scrypt.p256.enc.pem", "testdata/pkcs8/openssl.p256.pem"},
+		{"testdata/pkcs8/sha512.ed25519.enc.pem", "testdata/pkcs8/openssl.ed25519.pem"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := Read(tt.want)
+			assert.FatalError(t, err)
+			got, err := Read(tt.name, WithPassword([]byte("mypassword")))
+			assert.FatalError(t, err)
+			assert.Equals(t, want, got)
+
+			_, err = Read(tt.name, WithPassword([]byte("foobar")))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestEncryptPKCS8PrivateKeyWithOptions(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	data, err := x509.MarshalPKCS8PrivateKey(priv)
+	assert.FatalError(t, err)
+
+	password := []byte("mypassword")
+	ciphers := []PKCS8Cipher{
+		PKCS8CipherDESCBC, PKCS8Cipher3DESCBC,
+		PKCS8CipherAES128CBC, PKCS8CipherAES192CBC, PKCS8CipherAES256CBC,
+		PKCS8CipherAES128GCM, PKCS8CipherAES192GCM, PKCS8CipherAES256GCM,
+		PKCS8CipherChaCha20Poly1305,
+	}
+	kdfs := map[string]Options{
+		"pbkdf2-sha1":       WithPBKDF2(1000, crypto.SHA1),
+		"pbkdf2-sha224":     WithPBKDF2(1000, crypto.SHA224),
+		"pbkdf2-sha256":     WithPBKDF2(1000, crypto.SHA256),
+		"pbkdf2-sha384":     WithPBKDF2(1000, crypto.SHA384),
+		"pbkdf2-sha512":     WithPBKDF2(1000, crypto.SHA512),
+		"pbkdf2-sha512_224": WithPBKDF2(1000, crypto.SHA512_224),
+		"pbkdf2-sha512_256": WithPBKDF2(1000, crypto.SHA512_256),
+		"scrypt":            WithScrypt(1024, 8, 1),
+	}
+	for _, c := range ciphers {
+		for name, kdf := range kdfs {
+			t.Run(string(c)+"/"+name, func(t *testing.T) {
+				block, err := EncryptPKCS8PrivateKeyWithOptions(rand.Reader, data, password, WithPKCS8Cipher(c), kdf)
+				assert.FatalError(t, err)
+				assert.Equals(t, "ENCRYPTED PRIVATE KEY", block.Type)
+
+				decData, err := DecryptPKCS8PrivateKey(block.Bytes, password)
+				assert.FatalError(t, err)
+				assert.Equals(t, data, decData)
+
+				// AEAD ciphers always detect an invalid password.
+				if aeadByName(c) != nil {
+					_, err = DecryptPKCS8PrivateKey(block.Bytes, []byte("foobar"))
+					assert.True(t, errors.Is(err, x509.IncorrectPasswordError))
+				}
+			})
+		}
+	}
+}
+
+func TestEncryptPKCS8PrivateKeyWithOptions_defaults(t *testing.T) {
+	data := []byte("the private key")
+	block, err := EncryptPKCS8PrivateKeyWithOptions(rand.Reader, data, []byte("password"))
+	assert.FatalError(t, err)
+
+	var pki encryptedPrivateKeyInfo
+	_, err = asn1.Unmarshal(block.Bytes, &pki)
+	assert.FatalError(t, err)
+	var params pbes2Params
+	_, err = asn1.Unmarshal(pki.Algo.Parameters.FullBytes, &params)
+	assert.FatalError(t, err)
+	assert.Equals(t, oidPKCS5PBKDF2, params.KeyDerivationFunc.Algorithm)
+	assert.Equals(t, oidAES256CBC, params.EncryptionScheme.Algorithm)
+
+	var kdf pbkdf2Params
+	_, err = asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf)
+	assert.FatalError(t, err)
+	assert.Equals(t, PBKDF2Iterations, kdf.IterationCount)
+	assert.Equals(t, oidHMACWithSHA256, kdf.PRF.Algorithm)
+	assert.Len(t, PBKDF2SaltSize, kdf.Salt)
+
+	// HMAC-SHA1 is the default PRF and it is not encoded.
+	block, err = EncryptPKCS8PrivateKeyWithOptions(rand.Reader, data, []byte("password"), WithPBKDF2(1000, crypto.SHA1))
+	assert.FatalError(t, err)
+	_, err = asn1.Unmarshal(block.Bytes, &pki)
+	assert.FatalError(t, err)
+	_, err = asn1.Unmarshal(pki.Algo.Parameters.FullBytes, &params)
+	assert.FatalError(t, err)
+	var sha1KDF pbkdf2Params
+	_, err = asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &sha1KDF)
+	assert.FatalError(t, err)
+	assert.Equals(t, 1000, sha1KDF.IterationCount)
+	assert.Len(t, 0, sha1KDF.PRF.Algorithm)
+
+	// Scrypt defaults.
+	block, err = EncryptPKCS8PrivateKeyWithOptions(rand.Reader, data, []byte("password"), WithScrypt(0, 0, 0), WithPKCS8Cipher(PKCS8CipherAES128GCM))
+	assert.FatalError(t, err)
+	_, err = asn1.Unmarshal(block.Bytes, &pki)
+	assert.FatalError(t, err)
+	_, err = asn1.Unmarshal(pki.Algo.Parameters.FullBytes, &params)
+	assert.FatalError(t, err)
+	assert.Equals(t, oidScrypt, params.KeyDerivationFunc.Algorithm)
+	assert.Equals(t, oidAES128GCM, params.EncryptionScheme.Algorithm)
+	var scryptKDF scryptParams
+	_, err = asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &scryptKDF)
+	assert.FatalError(t, err)
+	assert.Equals(t, scryptParams{
+		Salt:                     scryptKDF.Salt,
+		CostParameter:            ScryptCost,
+		BlockSize:                ScryptBlockSize,
+		ParallelizationParameter: ScryptParallelization,
+	}, scryptKDF)
+}
+
+func TestEncryptPKCS8PrivateKeyWithOptions_fail(t *testing.T) {
+	data := []byte("the private key")
+	password := []byte("mypassword")
+	tests := []struct {
+		name string
+		opts []Options
+	}{
+		{"fail cipher", []Options{WithPKCS8Cipher("AES-256-XTS")}},
+		{"fail iterations", []Options{WithPBKDF2(-1, crypto.SHA256)}},
+		{"fail prf", []Options{WithPBKDF2(1000, crypto.MD5)}},
+		{"fail scrypt cost", []Options{WithScrypt(1000, 8, 1)}},
+		{"fail scrypt cost one", []Options{WithScrypt(1, 8, 1)}},
+		{"fail scrypt block size", []Options{WithScrypt(1024, -1, 1)}},
+		{"fail scrypt parallelization", []Options{WithScrypt(1024, 8, -1)}},
+		{"fail scrypt memory", []Options{WithScrypt(1<<20, 8, 1)}},
+		{"fail scrypt max parallelization", []Options{WithScrypt(1024, 8, 17)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := EncryptPKCS8PrivateKeyWithOptions(rand.Reader, data, password, tt.opts...)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := EncryptPKCS8PrivateKeyWithOptions(strings.NewReader(""), data, password)
+	assert.Error(t, err)
+	_, err = EncryptPKCS8PrivateKey(rand.Reader, data, password, x509.PEMCipher(100))
+	assert.Error(t, err)
+}
+
+func TestDecryptPKCS8PrivateKey_fail(t *testing.T) {
+	password := []byte("mypassword")
+	block, err := EncryptPKCS8PrivateKeyWithOptions(rand.Reader, []byte("the private key"), password,
+		WithPBKDF2(1000, 0), WithPKCS8Cipher(PKCS8CipherChaCha20Poly1305))
+	assert.FatalError(t, err)
+
+	marshal := func(kdf, enc pkix.AlgorithmIdentifier) []byte {
+		params, err := asn1.Marshal(pbes2Params{KeyDerivationFunc: kdf, EncryptionScheme: enc})
+		assert.FatalError(t, err)
+		b, err := asn1.Marshal(encryptedPrivateKeyInfo{
+			Algo:       pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+			PrivateKey: []byte("encrypted data"),
+		})
+		assert.FatalError(t, err)
+		return b
+	}
+	rawParams := func(v interface{}) asn1.RawValue {
+		b, err := asn1.Marshal(v)
+		assert.FatalError(t, err)
+		return asn1.RawValue{FullBytes: b}
+	}
+
+	pbkdf2KDF := pkix.AlgorithmIdentifier{Algorithm: oidPKCS5PBKDF2, Parameters: rawParams(pbkdf2Params{Salt: []byte("salt"), IterationCount: 1000})}
+	aesCBC := pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: rawParams(make([]byte, 16))}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"fail asn1", []byte("foo")},
+		{"fail pbes1", func() []byte {
+			b, err := asn1.Marshal(encryptedPrivateKeyInfo{
+				Algo:       pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 3}},
+				PrivateKey: []byte("encrypted data"),
+			})
+			assert.FatalError(t, err)
+			return b
+		}()},
+		{"fail kdf", marshal(pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 3}}, aesCBC)},
+		{"fail prf", marshal(pkix.AlgorithmIdentifier{Algorithm: oidPKCS5PBKDF2, Parameters: rawParams(pbkdf2Params{
+			Salt: []byte("salt"), IterationCount: 1000, PRF: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 3}},
+		})}, aesCBC)},
+		{"fail iterations", marshal(pkix.AlgorithmIdentifier{Algorithm: oidPKCS5PBKDF2, Parameters: rawParams(pbkdf2Params{
+			Salt: []byte("salt"),
+		})}, aesCBC)},
+		{"fail key length", marshal(pkix.AlgorithmIdentifier{Algorithm: oidPKCS5PBKDF2, Parameters: rawParams(pbkdf2Params{
+			Salt: []byte("salt"), IterationCount: 1000, KeyLength: 16,
+		})}, aesCBC)},
+		{"fail scrypt", marshal(pkix.AlgorithmIdentifier{Algorithm: oidScrypt, Parameters: rawParams(scryptParams{
+			Salt: []byte("salt"), CostParameter: 1000, BlockSize: 8, ParallelizationParameter: 1,
+		})}, aesCBC)},
+		{"fail scrypt memory", marshal(pkix.AlgorithmIdentifier{Algorithm: oidScrypt, Parameters: rawParams(scryptParams{
+			Salt: []byte("salt"), CostParameter: 1 << 24, BlockSize: 8, ParallelizationParameter: 1,
+		})}, aesCBC)},
+		{"fail scrypt block size overflow", marshal(pkix.AlgorithmIdentifier{Algorithm: oidScrypt, Parameters: rawParams(scryptParams{
+			Salt: []byte("salt"), CostParameter: 2, BlockSize: 1 << 30, ParallelizationParameter: 1,
+		})}, aesCBC)},
+		{"fail scrypt parallelization", marshal(pkix.AlgorithmIdentifier{Algorithm: oidScrypt, Parameters: rawParams(scryptParams{
+			Salt: []byte("salt"), CostParameter: 1024, BlockSize: 8, ParallelizationParameter: 1 << 20,
+		})}, aesCBC)},
+		{"fail cipher", marshal(pbkdf2KDF, pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 3}})},
+		{"fail iv", marshal(pbkdf2KDF, pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: rawParams(make([]byte, 8))})},
+		{"fail gcm nonce", marshal(pbkdf2KDF, pkix.AlgorithmIdentifier{Algorithm: oidAES256GCM, Parameters: rawParams(gcmParams{Nonce: make([]byte, 8), ICVLen: 16})})},
+		{"fail gcm tag size", marshal(pbkdf2KDF, pkix.AlgorithmIdentifier{Algorithm: oidAES256GCM, Parameters: rawParams(gcmParams{Nonce: make([]byte, 12), ICVLen: 4})})},
+		{"fail chacha20 params", marshal(pbkdf2KDF, pkix.AlgorithmIdentifier{Algorithm: oidChaCha20Poly1305, Parameters: rawParams(gcmParams{Nonce: make([]byte, 12)})})},
+		{"fail padding", marshal(pbkdf2KDF, aesCBC)},
+		{"fail tampered", func() []byte {
+			b := append([]byte{}, block.Bytes...)
+			b[len(b)-1] ^= 0xff
+			return b
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecryptPKCS8PrivateKey(tt.data, password)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSerialize_PKCS8Options(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+
+	block, err := Serialize(priv, WithPKCS8(true), WithPassword([]byte("mypassword")),
+		WithPKCS8Cipher(PKCS8CipherAES256GCM), WithScrypt(1024, 8, 1))
+	assert.FatalError(t, err)
+	assert.Equals(t, "ENCRYPTED PRIVATE KEY", block.Type)
+
+	var pki encryptedPrivateKeyInfo
+	_, err = asn1.Unmarshal(block.Bytes, &pki)
+	assert.FatalError(t, err)
+	var params pbes2Params
+	_, err = asn1.Unmarshal(pki.Algo.Parameters.FullBytes, &params)
+	assert.FatalError(t, err)
+	assert.Equals(t, oidScrypt, params.KeyDerivationFunc.Algorithm)
+	assert.Equals(t, oidAES256GCM, params.EncryptionScheme.Algorithm)
+
+	key, err := Parse(pem.EncodeToMemory(block), WithPassword([]byte("mypassword")))
+	assert.FatalError(t, err)
+	assert.Equals(t, priv, key)
+}
@@ -5,20 +5,27 @@
 package pemutil
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/des" //nolint:gosec // support for legacy keys
+	"crypto/ecdh"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
 	"encoding/binary"
 	"encoding/pem"
 	"math/big"
 
 	"github.com/pkg/errors"
 	bcryptpbkdf "go.step.sm/crypto/internal/bcrypt_pbkdf"
+	"go.step.sm/crypto/internal/ecdhutil"
 	"go.step.sm/crypto/randutil"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/poly1305" //nolint:staticcheck // used by chacha20-poly1305@openssh.com
 	"golang.org/x/crypto/ssh"
 )
 
@@ -26,7 +33,6 @@ const (
 	sshMagic             = "openssh-key-v1\x00"
 	sshDefaultKdf        = "bcrypt"
 	sshDefaultCiphername = "aes256-ctr"
-	sshDefaultKeyLength  = 32
 	sshDefaultSaltLength = 16
 	sshDefaultRounds     = 16
 )
@@ -38,6 +44,7 @@ type openSSHPrivateKey struct {
 	NumKeys      uint32
 	PubKey       []byte
 	PrivKeyBlock []byte
+	Rest         []byte `ssh:"rest"`
 }
 
 type openSSHPrivateKeyBlock struct {
@@ -47,8 +54,224 @@ type openSSHPrivateKeyBlock struct {
 	Rest    []byte `ssh:"rest"`
 }
 
+type openSSHKdfOptions struct {
+	Salt   []byte
+	Rounds uint32
+}
+
+// SKPublicKey is the public key of an OpenSSH FIDO/U2F key, the key types
+// sk-ecdsa-sha2-nistp256@openssh.com and sk-ssh-ed25519@openssh.com.
+type SKPublicKey struct {
+	// Type is the key type, ssh.KeyAlgoSKECDSA256 or ssh.KeyAlgoSKED25519.
+	Type string
+	// PublicKey is the *ecdsa.PublicKey or ed25519.PublicKey of the key.
+	PublicKey crypto.PublicKey
+	// Application is the FIDO application string, usually "ssh:".
+	Application string
+}
+
+// SSHPublicKey returns the key as an ssh.PublicKey.
+func (k *SKPublicKey) SSHPublicKey() (ssh.PublicKey, error) {
+	var b []byte
+	switch pub := k.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		p, err := pub.ECDH()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed converting *ecdsa.PublicKey to *ecdh.PublicKey")
+		}
+		b = ssh.Marshal(struct {
+			KeyType     string
+			Curve       string
+			Pub         []byte
+			Application string
+		}{ssh.KeyAlgoSKECDSA256, "nistp256", p.Bytes(), k.Application})
+	case ed25519.PublicKey:
+		b = ssh.Marshal(struct {
+			KeyType     string
+			Pub         []byte
+			Application string
+		}{ssh.KeyAlgoSKED25519, pub, k.Application})
+	default:
+		return nil, errors.Errorf("unsupported public key type %T", pub)
+	}
+	return ssh.ParsePublicKey(b)
+}
+
+// SKPrivateKey is the private key handle of an OpenSSH FIDO/U2F key. The
+// private key is stored in the security key, the handle only contains the
+// information required to use it.
+type SKPrivateKey struct {
+	SKPublicKey
+	// Flags are the FIDO flags of the key, user presence required (0x01) or
+	// user verification required (0x04).
+	Flags uint8
+	// KeyHandle is the handle that identifies the key in the security key.
+	KeyHandle []byte
+	// Reserved is reserved for future use.
+	Reserved []byte
+}
+
+// Public returns the public key corresponding to the private key handle.
+func (k *SKPrivateKey) Public() crypto.PublicKey {
+	return &k.SKPublicKey
+}
+
+// sshCipher holds a cipher used to encrypt OpenSSH private keys.
+type sshCipher struct {
+	name      string
+	keySize   int
+	ivSize    int
+	blockSize int
+	tagSize   int
+	seal      func(key, iv, plaintext []byte) ([]byte, error)
+	open      func(key, iv, ciphertext, tag []byte) ([]byte, error)
+}
+
+// sshCiphers are the ciphers supported by OpenSSH to encrypt private keys.
+var sshCiphers = []sshCipher{
+	{name: "aes128-ctr", keySize: 16, ivSize: aes.BlockSize, blockSize: aes.BlockSize, seal: aesCTR, open: openStream(aesCTR)},
+	{name: "aes192-ctr", keySize: 24, ivSize: aes.BlockSize, blockSize: aes.BlockSize, seal: aesCTR, open: openStream(aesCTR)},
+	{name: "aes256-ctr", keySize: 32, ivSize: aes.BlockSize, blockSize: aes.BlockSize, seal: aesCTR, open: openStream(aesCTR)},
+	{name: "aes128-cbc", keySize: 16, ivSize: aes.BlockSize, blockSize: aes.BlockSize, seal: sealCBC(aes.NewCipher), open: openCBC(aes.NewCipher)},
+	{name: "aes192-cbc", keySize: 24, ivSize: aes.BlockSize, blockSize: aes.BlockSize, seal: sealCBC(aes.NewCipher), open: openCBC(aes.NewCipher)},
+	{name: "aes256-cbc", keySize: 32, ivSize: aes.BlockSize, blockSize: aes.BlockSize, seal: sealCBC(aes.NewCipher), open: openCBC(aes.NewCipher)},
+	{name: "3des-cbc", keySize: 24, ivSize: des.BlockSize, blockSize: des.BlockSize, seal: sealCBC(des.NewTripleDESCipher), open: openCBC(des.NewTripleDESCipher)},
+	{name: "aes128-gcm@openssh.com", keySize: 16, ivSize: 12, blockSize: aes.BlockSize, tagSize: 16, seal: sealGCM, open: openGCM},
+	{name: "aes256-gcm@openssh.com", keySize: 32, ivSize: 12, blockSize: aes.BlockSize, tagSize: 16, seal: sealGCM, open: openGCM},
+	{name: "chacha20-poly1305@openssh.com", keySize: 64, blockSize: 8, tagSize: poly1305.TagSize, seal: sealChaCha20Poly1305, open: openChaCha20Poly1305},
+}
+
+func sshCipherByName(name string) *sshCipher {
+	for i := range sshCiphers {
+		if sshCiphers[i].name == name {
+			return &sshCiphers[i]
+		}
+	}
+	return nil
+}
+
+func aesCTR(key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	dst := make([]byte, len(data))
+	cipher.NewCTR(block, iv).XORKeyStream(dst, data)
+	return dst, nil
+}
+
+func openStream(fn func(key, iv, data []byte) ([]byte, error)) func(key, iv, ciphertext, tag []byte) ([]byte, error) {
+	return func(key, iv, ciphertext, _ []byte) ([]byte, error) {
+		return fn(key, iv, ciphertext)
+	}
+}
+
+func sealCBC(fn func([]byte) (cipher.Block, error)) func(key, iv, plaintext []byte) ([]byte, error) {
+	return func(key, iv, plaintext []byte) ([]byte, error) {
+		block, err := fn(key)
+		if err != nil {
+			return nil, err
+		}
+		dst := make([]byte, len(plaintext))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(dst, plaintext)
+		return dst, nil
+	}
+}
+
+func openCBC(fn func([]byte) (cipher.Block, error)) func(key, iv, ciphertext, tag []byte) ([]byte, error) {
+	return func(key, iv, ciphertext, _ []byte) ([]byte, error) {
+		block, err := fn(key)
+		if err != nil {
+			return nil, err
+		}
+		dst := make([]byte, len(ciphertext))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(dst, ciphertext)
+		return dst, nil
+	}
+}
+
+func sealGCM(key, iv, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nil, iv, plaintext, nil), nil
+}
+
+func openGCM(key, iv, ciphertext, tag []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, len(ciphertext)+len(tag))
+	data = append(append(data, ciphertext...), tag...)
+	plaintext, err := aead.Open(nil, iv, data, nil)
+	if err != nil {
+		return nil, x509.IncorrectPasswordError
+	}
+	return plaintext, nil
+}
+
+// chacha20Poly1305 returns the stream cipher and the poly1305 key used in the
+// chacha20-poly1305@openssh.com cipher, as described in PROTOCOL.chacha20poly1305
+// in the OpenSSH repository. Private keys are encrypted using the sequence
+// number 0 and without additional data, so only the main key, the first 32
+// bytes of the key, is used.
+func chacha20Poly1305(key []byte) (*chacha20.Cipher, [32]byte, error) {
+	var polyKey [32]byte
+	c, err := chacha20.NewUnauthenticatedCipher(key[:chacha20.KeySize], make([]byte, chacha20.NonceSize))
+	if err != nil {
+		return nil, polyKey, err
+	}
+	c.XORKeyStream(polyKey[:], polyKey[:])
+	c.SetCounter(1)
+	return c, polyKey, nil
+}
+
+func sealChaCha20Poly1305(key, _, plaintext []byte) ([]byte, error) {
+	c, polyKey, err := chacha20Poly1305(key)
+	if err != nil {
+		return nil, err
+	}
+	dst := make([]byte, len(plaintext), len(plaintext)+poly1305.TagSize)
+	c.XORKeyStream(dst, plaintext)
+	var tag [poly1305.TagSize]byte
+	poly1305.Sum(&tag, dst, &polyKey)
+	return append(dst, tag[:]...), nil
+}
+
+func openChaCha20Poly1305(key, _, ciphertext, tag []byte) ([]byte, error) {
+	c, polyKey, err := chacha20Poly1305(key)
+	if err != nil {
+		return nil, err
+	}
+	var mac [poly1305.TagSize]byte
+	copy(mac[:], tag)
+	if !poly1305.Verify(&mac, ciphertext, &polyKey) {
+		return nil, x509.IncorrectPasswordError
+	}
+	dst := make([]byte, len(ciphertext))
+	c.XORKeyStream(dst, ciphertext)
+	return dst, nil
+}
+
 // ParseOpenSSHPrivateKey parses a private key in OpenSSH PEM format.
 //
+// It supports RSA, ECDSA, Ed25519 and FIDO (sk-ecdsa-sha2-nistp256@openssh.com
+// and sk-ssh-ed25519@openssh.com) keys, the latter are returned as a
+// *SKPrivateKey. Encrypted keys can use any of the ciphers supported by
+// OpenSSH: aes128-ctr, aes192-ctr, aes256-ctr, aes128-cbc, aes192-cbc,
+// aes256-cbc, 3des-cbc, aes128-gcm@openssh.com, aes256-gcm@openssh.com and
+// chacha20-poly1305@openssh.com.
+//
 // Implemented based on the documentation at
 // https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.key
 //
@@ -75,35 +298,252 @@ func ParseOpenSSHPrivateKey(pemBytes []byte, opts ...Options) (crypto.PrivateKey
 	if err := ssh.Unmarshal(remaining, &w); err != nil {
 		return nil, errors.Wrap(err, "error unmarshaling private key")
 	}
+	if w.NumKeys != 1 {
+		return nil, errors.Errorf("error parsing private key: unsupported number of keys %d", w.NumKeys)
+	}
+
+	encrypted := w.KdfName != "none" || w.CipherName != "none"
+	if encrypted {
+		if w.KdfName != sshDefaultKdf {
+			return nil, errors.Errorf("error parsing private key: unsupported kdf %s", w.KdfName)
+		}
+		c := sshCipherByName(w.CipherName)
+		if c == nil {
+			return nil, errors.Errorf("error parsing private key: unsupported cipher %s", w.CipherName)
+		}
+		if len(w.Rest) != c.tagSize {
+			return nil, errors.New("error parsing private key: invalid authentication tag")
+		}
+		if len(w.PrivKeyBlock)%c.blockSize != 0 {
+			return nil, errors.New("error parsing private key: invalid private key block size")
+		}
+
+		var kdfOpts openSSHKdfOptions
+		if err := ssh.Unmarshal([]byte(w.KdfOpts), &kdfOpts); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling kdf options")
+		}
 
-	var err error
-	var key crypto.PrivateKey
-	if w.KdfName != "none" || w.CipherName != "none" {
 		password, err := ctx.promptPassword()
 		if err != nil {
 			return nil, err
 		}
-		key, err = ssh.ParseRawPrivateKeyWithPassphrase(pemBytes, password)
+
+		// Derive key to decrypt the private key block.
+		k, err := bcryptpbkdf.Key(password, kdfOpts.Salt, int(kdfOpts.Rounds), c.keySize+c.ivSize)
 		if err != nil {
-			return nil, errors.Wrap(err, "error parsing private key")
+			return nil, errors.Wrap(err, "error deriving decryption key")
 		}
-	} else {
-		key, err = ssh.ParseRawPrivateKey(pemBytes)
+		if w.PrivKeyBlock, err = c.open(k[:c.keySize], k[c.keySize:], w.PrivKeyBlock, w.Rest); err != nil {
+			return nil, errors.Wrap(err, "error decrypting private key")
+		}
+	} else if len(w.Rest) > 0 {
+		return nil, errors.New("error parsing private key: unexpected trailing data")
+	}
+
+	var pk1 openSSHPrivateKeyBlock
+	if err := ssh.Unmarshal(w.PrivKeyBlock, &pk1); err != nil || pk1.Check1 != pk1.Check2 {
+		if encrypted {
+			return nil, errors.Wrap(x509.IncorrectPasswordError, "error decrypting private key")
+		}
+		return nil, errors.New("error parsing private key: invalid private key block")
+	}
+
+	key, err := parseOpenSSHPrivateKeyBlock(pk1.Keytype, pk1.Rest)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing private key")
+	}
+	return key, nil
+}
+
+// parseOpenSSHPrivateKeyBlock parses the private key of the given type.
+func parseOpenSSHPrivateKeyBlock(keyType string, b []byte) (crypto.PrivateKey, error) {
+	switch keyType {
+	case ssh.KeyAlgoRSA:
+		var key struct {
+			N       *big.Int
+			E       *big.Int
+			D       *big.Int
+			Iqmp    *big.Int
+			P       *big.Int
+			Q       *big.Int
+			Comment string
+			Pad     []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(b, &key); err != nil {
+			return nil, err
+		}
+		if err := checkOpenSSHKeyPadding(key.Pad); err != nil {
+			return nil, err
+		}
+		if key.E.BitLen() > 24 {
+			return nil, errors.New("exponent too large")
+		}
+		pk := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{
+				N: key.N,
+				E: int(key.E.Int64()),
+			},
+			D:      key.D,
+			Primes: []*big.Int{key.P, key.Q},
+		}
+		if err := pk.Validate(); err != nil {
+			return nil, err
+		}
+		pk.Precompute()
+		return pk, nil
+	case ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521:
+		var key struct {
+			Curve   string
+			Pub     []byte
+			D       *big.Int
+			Comment string
+			Pad     []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(b, &key); err != nil {
+			return nil, err
+		}
+		if err := checkOpenSSHKeyPadding(key.Pad); err != nil {
+			return nil, err
+		}
+		pub, err := parseOpenSSHECDSAPublicKey(keyType, key.Curve, key.Pub)
+		if err != nil {
+			return nil, err
+		}
+		priv := &ecdsa.PrivateKey{
+			PublicKey: *pub,
+			D:         key.D,
+		}
+		// Check that the private key matches the public key.
+		p, err := priv.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(p.PublicKey().Bytes(), key.Pub) {
+			return nil, errors.New("private key does not match public key")
+		}
+		return priv, nil
+	case ssh.KeyAlgoED25519:
+		var key struct {
+			Pub     []byte
+			Priv    []byte
+			Comment string
+			Pad     []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(b, &key); err != nil {
+			return nil, err
+		}
+		if err := checkOpenSSHKeyPadding(key.Pad); err != nil {
+			return nil, err
+		}
+		if len(key.Priv) != ed25519.PrivateKeySize || len(key.Pub) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key size")
+		}
+		priv := make(ed25519.PrivateKey, ed25519.PrivateKeySize)
+		copy(priv, key.Priv)
+		if !bytes.Equal(priv[ed25519.SeedSize:], key.Pub) {
+			return nil, errors.New("private key does not match public key")
+		}
+		return priv, nil
+	case ssh.KeyAlgoSKECDSA256:
+		var key struct {
+			Curve       string
+			Pub         []byte
+			Application string
+			Flags       uint8
+			KeyHandle   []byte
+			Reserved    []byte
+			Comment     string
+			Pad         []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(b, &key); err != nil {
+			return nil, err
+		}
+		if err := checkOpenSSHKeyPadding(key.Pad); err != nil {
+			return nil, err
+		}
+		pub, err := parseOpenSSHECDSAPublicKey(ssh.KeyAlgoECDSA256, key.Curve, key.Pub)
 		if err != nil {
-			return nil, errors.Wrap(err, "error parsing private key")
+			return nil, err
+		}
+		return &SKPrivateKey{
+			SKPublicKey: SKPublicKey{
+				Type:        keyType,
+				PublicKey:   pub,
+				Application: key.Application,
+			},
+			Flags:     key.Flags,
+			KeyHandle: key.KeyHandle,
+			Reserved:  key.Reserved,
+		}, nil
+	case ssh.KeyAlgoSKED25519:
+		var key struct {
+			Pub         []byte
+			Application string
+			Flags       uint8
+			KeyHandle   []byte
+			Reserved    []byte
+			Comment     string
+			Pad         []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(b, &key); err != nil {
+			return nil, err
 		}
+		if err := checkOpenSSHKeyPadding(key.Pad); err != nil {
+			return nil, err
+		}
+		if len(key.Pub) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key size")
+		}
+		return &SKPrivateKey{
+			SKPublicKey: SKPublicKey{
+				Type:        keyType,
+				PublicKey:   ed25519.PublicKey(key.Pub),
+				Application: key.Application,
+			},
+			Flags:     key.Flags,
+			KeyHandle: key.KeyHandle,
+			Reserved:  key.Reserved,
+		}, nil
+	default:
+		return nil, errors.Errorf("unsupported key type %s", keyType)
 	}
+}
 
-	// Convert *ed25519.PrivateKey to ed25519.PrivateKey:
-	switch k := key.(type) {
-	case *ed25519.PrivateKey:
-		return *k, nil
+// parseOpenSSHECDSAPublicKey parses the public key of an ECDSA key.
+func parseOpenSSHECDSAPublicKey(keyType, curveName string, pub []byte) (*ecdsa.PublicKey, error) {
+	var curve ecdh.Curve
+	switch {
+	case keyType == ssh.KeyAlgoECDSA256 && curveName == "nistp256":
+		curve = ecdh.P256()
+	case keyType == ssh.KeyAlgoECDSA384 && curveName == "nistp384":
+		curve = ecdh.P384()
+	case keyType == ssh.KeyAlgoECDSA521 && curveName == "nistp521":
+		curve = ecdh.P521()
 	default:
-		return k, nil
+		return nil, errors.Errorf("unsupported curve %s", curveName)
+	}
+	p, err := curve.NewPublicKey(pub)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed decoding %s key", keyType)
 	}
+	return ecdhutil.ToECDSAPublicKey(p)
+}
+
+// checkOpenSSHKeyPadding checks that the padding of the private key block is
+// the sequence 1, 2, 3, ...
+func checkOpenSSHKeyPadding(pad []byte) error {
+	for i, b := range pad {
+		if int(b) != i+1 {
+			return errors.New("padding not as expected")
+		}
+	}
+	return nil
 }
 
 // SerializeOpenSSHPrivateKey serialize a private key in the OpenSSH PEM format.
+// If a password is given the key will be encrypted using aes256-ctr and 16
+// bcrypt_pbkdf rounds, the options WithOpenSSHCipher and WithOpenSSHRounds can
+// be used to change them.
 func SerializeOpenSSHPrivateKey(key crypto.PrivateKey, opts ...Options) (*pem.Block, error) {
 	ctx := new(context)
 	if err := ctx.apply(opts); err != nil {
@@ -129,15 +569,21 @@ func SerializeOpenSSHPrivateKey(key crypto.PrivateKey, opts ...Options) (*pem.Bl
 		return nil, err
 	}
 
-	var blockSize int
+	var c *sshCipher
+	blockSize := 8
 	if password == nil {
 		w.CipherName = "none"
 		w.KdfName = "none"
-		blockSize = 8
 	} else {
 		w.CipherName = sshDefaultCiphername
+		if ctx.sshCipher != "" {
+			w.CipherName = ctx.sshCipher
+		}
+		if c = sshCipherByName(w.CipherName); c == nil {
+			return nil, errors.Errorf("unsupported cipher %s", w.CipherName)
+		}
 		w.KdfName = sshDefaultKdf
-		blockSize = aes.BlockSize
+		blockSize = c.blockSize
 	}
 
 	switch k := key.(type) {
@@ -240,47 +686,76 @@ func SerializeOpenSSHPrivateKey(key crypto.PrivateKey, opts ...Options) (*pem.Bl
 		}
 		pk1.Keytype = ssh.KeyAlgoED25519
 		pk1.Rest = ssh.Marshal(key)
+	case *SKPrivateKey:
+		sshPub, err := k.SSHPublicKey()
+		if err != nil {
+			return nil, errors.Wrap(err, "error serializing key")
+		}
+		w.PubKey = sshPub.Marshal()
+
+		// The private key has the same fields than the public key, without
+		// the key type, followed by the key handle.
+		var pub struct {
+			KeyType string
+			Rest    []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(w.PubKey, &pub); err != nil {
+			return nil, errors.Wrap(err, "error serializing key")
+		}
+		key := struct {
+			Flags     uint8
+			KeyHandle []byte
+			Reserved  []byte
+			Comment   string
+		}{
+			k.Flags, k.KeyHandle, k.Reserved,
+			ctx.comment,
+		}
+		pk1.Keytype = sshPub.Type()
+		pk1.Rest = append(pub.Rest, ssh.Marshal(key)...)
 	default:
 		return nil, errors.Errorf("unsupported key type %T", k)
 	}
 
 	w.PrivKeyBlock = ssh.Marshal(pk1)
 
-	// Add padding until the private key block matches the block size,
-	// 16 with AES encryption, 8 without.
+	// Add padding until the private key block matches the block size of the
+	// cipher, 8 without encryption.
 	for i, l := 0, len(w.PrivKeyBlock); (l+i)%blockSize != 0; i++ {
 		w.PrivKeyBlock = append(w.PrivKeyBlock, byte(i+1))
 	}
 
 	if password != nil {
+		rounds := sshDefaultRounds
+		if ctx.sshRounds > 0 {
+			rounds = ctx.sshRounds
+		}
+
 		// Create encryption key derivation the password.
 		salt, err := randutil.Salt(sshDefaultSaltLength)
 		if err != nil {
 			return nil, err
 		}
-		kdfOpts := struct {
-			Salt   []byte
-			Rounds uint32
-		}{salt, sshDefaultRounds}
-		w.KdfOpts = string(ssh.Marshal(kdfOpts))
+		w.KdfOpts = string(ssh.Marshal(openSSHKdfOptions{
+			Salt:   salt,
+			Rounds: uint32(rounds),
+		}))
 
 		// Derive key to encrypt the private key block.
-		k, err := bcryptpbkdf.Key(password, salt, sshDefaultRounds, sshDefaultKeyLength+aes.BlockSize)
+		k, err := bcryptpbkdf.Key(password, salt, rounds, c.keySize+c.ivSize)
 		if err != nil {
 			return nil, errors.Wrap(err, "error deriving decryption key")
 		}
 
-		// Encrypt the private key using the derived secret.
-		dst := make([]byte, len(w.PrivKeyBlock))
-		iv := k[sshDefaultKeyLength : sshDefaultKeyLength+aes.BlockSize]
-		block, err := aes.NewCipher(k[:sshDefaultKeyLength])
+		// Encrypt the private key using the derived secret. The
+		// authentication tag of AEAD ciphers is appended after the private
+		// key block.
+		encrypted, err := c.seal(k[:c.keySize], k[c.keySize:], w.PrivKeyBlock)
 		if err != nil {
-			return nil, errors.Wrap(err, "error creating cipher")
+			return nil, errors.Wrap(err, "error encrypting private key")
 		}
-
-		stream := cipher.NewCTR(block, iv)
-		stream.XORKeyStream(dst, w.PrivKeyBlock)
-		w.PrivKeyBlock = dst
+		n := len(encrypted) - c.tagSize
+		w.PrivKeyBlock, w.Rest = encrypted[:n], encrypted[n:]
 	}
 
 	b := ssh.Marshal(w)
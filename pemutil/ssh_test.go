@@ -0,0 +1,191 @@
+package pemutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseOpenSSHPrivateKey_ciphers(t *testing.T) {
+	want, err := Read("testdata/openssh/p256.pem")
+	assert.FatalError(t, err)
+
+	for _, c := range sshCiphers {
+		name := "testdata/openssh/p256." + strings.TrimSuffix(c.name, "@openssh.com") + ".pem"
+		t.Run(c.name, func(t *testing.T) {
+			b, err := os.ReadFile(name)
+			assert.FatalError(t, err)
+
+			key, err := ParseOpenSSHPrivateKey(b, WithPassword([]byte("mypassword")))
+			assert.FatalError(t, err)
+			assert.Equals(t, want, key)
+
+			_, err = ParseOpenSSHPrivateKey(b, WithPassword([]byte("foobar")))
+			assert.True(t, errors.Is(err, x509.IncorrectPasswordError))
+
+			_, err = ParseOpenSSHPrivateKey(b)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSerializeOpenSSHPrivateKey_ciphers(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+
+	for _, c := range sshCiphers {
+		t.Run(c.name, func(t *testing.T) {
+			block, err := SerializeOpenSSHPrivateKey(key, WithPassword([]byte("mypassword")),
+				WithOpenSSHCipher(c.name), WithOpenSSHRounds(4))
+			assert.FatalError(t, err)
+
+			var w openSSHPrivateKey
+			assert.FatalError(t, ssh.Unmarshal(block.Bytes[len(sshMagic):], &w))
+			assert.Equals(t, c.name, w.CipherName)
+			assert.Equals(t, "bcrypt", w.KdfName)
+			assert.Len(t, c.tagSize, w.Rest)
+			var kdfOpts openSSHKdfOptions
+			assert.FatalError(t, ssh.Unmarshal([]byte(w.KdfOpts), &kdfOpts))
+			assert.Equals(t, uint32(4), kdfOpts.Rounds)
+
+			got, err := ParseOpenSSHPrivateKey(pem.EncodeToMemory(block), WithPassword([]byte("mypassword")))
+			assert.FatalError(t, err)
+			assert.Equals(t, key, got)
+
+			// The authentication tag is verified.
+			if c.tagSize > 0 {
+				block.Bytes[len(block.Bytes)-1] ^= 0xff
+				_, err = ParseOpenSSHPrivateKey(pem.EncodeToMemory(block), WithPassword([]byte("mypassword")))
+				assert.True(t, errors.Is(err, x509.IncorrectPasswordError))
+			}
+		})
+	}
+
+	// Defaults
+	block, err := Serialize(key, WithOpenSSH(true), WithPassword([]byte("mypassword")))
+	assert.FatalError(t, err)
+	var w openSSHPrivateKey
+	assert.FatalError(t, ssh.Unmarshal(block.Bytes[len(sshMagic):], &w))
+	assert.Equals(t, "aes256-ctr", w.CipherName)
+	var kdfOpts openSSHKdfOptions
+	assert.FatalError(t, ssh.Unmarshal([]byte(w.KdfOpts), &kdfOpts))
+	assert.Equals(t, uint32(16), kdfOpts.Rounds)
+
+	// Options
+	_, err = SerializeOpenSSHPrivateKey(key, WithOpenSSHCipher("aes256-xts"))
+	assert.Error(t, err)
+	_, err = SerializeOpenSSHPrivateKey(key, WithOpenSSHRounds(0))
+	assert.Error(t, err)
+}
+
+func TestSKPrivateKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name string
+		key  *SKPrivateKey
+		opts []Options
+	}{
+		{"sk-ecdsa", &SKPrivateKey{
+			SKPublicKey: SKPublicKey{Type: ssh.KeyAlgoSKECDSA256, PublicKey: &ecKey.PublicKey, Application: "ssh:"},
+			Flags:       0x01,
+			KeyHandle:   []byte("key-handle"),
+			Reserved:    []byte{},
+		}, nil},
+		{"sk-ed25519", &SKPrivateKey{
+			SKPublicKey: SKPublicKey{Type: ssh.KeyAlgoSKED25519, PublicKey: edKey, Application: "ssh:test"},
+			Flags:       0x05,
+			KeyHandle:   []byte("key-handle"),
+			Reserved:    []byte{},
+		}, []Options{WithPassword([]byte("mypassword")), WithOpenSSHCipher("chacha20-poly1305@openssh.com"), WithOpenSSHRounds(4)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block, err := Serialize(tt.key, append(tt.opts, WithComment("test@smallstep.com"))...)
+			assert.FatalError(t, err)
+			assert.Equals(t, "OPENSSH PRIVATE KEY", block.Type)
+
+			got, err := Parse(pem.EncodeToMemory(block), tt.opts...)
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.key, got)
+			assert.Equals(t, &tt.key.SKPublicKey, got.(*SKPrivateKey).Public())
+
+			// Public key in the authorized_keys format.
+			sshPub, err := tt.key.SSHPublicKey()
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.key.Type, sshPub.Type())
+			pub, err := ParseSSH(ssh.MarshalAuthorizedKey(sshPub))
+			assert.FatalError(t, err)
+			assert.Equals(t, &tt.key.SKPublicKey, pub)
+		})
+	}
+
+	_, err = (&SKPublicKey{PublicKey: []byte("foo")}).SSHPublicKey()
+	assert.Error(t, err)
+}
+
+func TestParseOpenSSHPrivateKey_errors(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	// The comment guarantees that the private key block has padding.
+	block, err := SerializeOpenSSHPrivateKey(key, WithComment("a"))
+	assert.FatalError(t, err)
+
+	var w openSSHPrivateKey
+	assert.FatalError(t, ssh.Unmarshal(block.Bytes[len(sshMagic):], &w))
+	encode := func(fn func(w openSSHPrivateKey) openSSHPrivateKey) []byte {
+		return pem.EncodeToMemory(&pem.Block{
+			Type:  "OPENSSH PRIVATE KEY",
+			Bytes: append([]byte(sshMagic), ssh.Marshal(fn(w))...),
+		})
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"fail pem", []byte("foo")},
+		{"fail magic", pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: []byte("foo")})},
+		{"fail unmarshal", pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: []byte(sshMagic + "foo")})},
+		{"fail num keys", encode(func(w openSSHPrivateKey) openSSHPrivateKey { w.NumKeys = 2; return w })},
+		{"fail kdf", encode(func(w openSSHPrivateKey) openSSHPrivateKey { w.KdfName = "scrypt"; return w })},
+		{"fail cipher", encode(func(w openSSHPrivateKey) openSSHPrivateKey {
+			w.KdfName, w.CipherName = "bcrypt", "aes256-xts"
+			return w
+		})},
+		{"fail tag", encode(func(w openSSHPrivateKey) openSSHPrivateKey {
+			w.KdfName, w.CipherName = "bcrypt", "aes256-gcm@openssh.com"
+			return w
+		})},
+		{"fail trailing data", encode(func(w openSSHPrivateKey) openSSHPrivateKey { w.Rest = []byte("foo"); return w })},
+		{"fail check", encode(func(w openSSHPrivateKey) openSSHPrivateKey {
+			w.PrivKeyBlock = append([]byte{}, w.PrivKeyBlock...)
+			w.PrivKeyBlock[0] ^= 0xff
+			return w
+		})},
+		{"fail padding", encode(func(w openSSHPrivateKey) openSSHPrivateKey {
+			w.PrivKeyBlock = append([]byte{}, w.PrivKeyBlock...)
+			w.PrivKeyBlock[len(w.PrivKeyBlock)-1] ^= 0xff
+			return w
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseOpenSSHPrivateKey(tt.data, WithPassword([]byte("mypassword")))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -32,6 +32,8 @@ $OPENSSL pkey -outform PEM -in pkcs8/openssl.ed25519.pem -aes-192-cbc -passout p
 $OPENSSL pkey -outform PEM -in pkcs8/openssl.rsa2048.pem -aes-256-cbc -passout pass:mypassword  -out pkcs8/openssl.rsa2048.enc.pem
 $OPENSSL pkey -outform PEM -in pkcs8/openssl.p384.pem -des -passout pass:mypassword -out pkcs8/openssl.p384.enc.pem
 $OPENSSL pkey -outform PEM -in pkcs8/openssl.p521.pem -des3 -passout pass:mypassword -out pkcs8/openssl.p521.enc.pem
+$OPENSSL pkcs8 -topk8 -in pkcs8/openssl.p256.pem -scrypt -scrypt_N 1024 -scrypt_r 8 -scrypt_p 1 -passout pass:mypassword -out pkcs8/scrypt.p256.enc.pem
+$OPENSSL pkcs8 -topk8 -in pkcs8/openssl.ed25519.pem -v2 aes-256-cbc -v2prf hmacWithSHA512 -iter 10000 -passout pass:mypassword -out pkcs8/sha512.ed25519.enc.pem
 
 # Ed25519 DER
 $OPENSSL pkey -outform DER -in pkcs8/openssl.ed25519.pem -out pkcs8/openssl.ed25519.der
@@ -95,3 +97,14 @@ do
    cp openssh.rsa$size.pem openssh.rsa$size.enc.pem
    $SSH_KEYGEN -p -N mypassword -f openssh.rsa$size.enc.pem
 done
+
+# Ciphers
+mkdir -p openssh
+$SSH_KEYGEN -t ecdsa -b 256 -f openssh/p256.pem -N "" -C ""
+mv openssh/p256.pem.pub openssh/p256.pub
+for cipher in aes128-ctr aes192-ctr aes256-ctr aes128-cbc aes192-cbc aes256-cbc 3des-cbc aes128-gcm@openssh.com aes256-gcm@openssh.com chacha20-poly1305@openssh.com
+do
+   name=${cipher%@openssh.com}
+   cp openssh/p256.pem openssh/p256.$name.pem
+   $SSH_KEYGEN -p -N mypassword -Z $cipher -a 4 -f openssh/p256.$name.pem
+done
@@ -0,0 +1,303 @@
+package sshutil
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// Critical options defined by OpenSSH.
+const (
+	ForceCommandOption  = "force-command"
+	SourceAddressOption = "source-address"
+)
+
+// DefaultClockSkew is the default clock skew allowed when checking the validity
+// window of a certificate.
+const DefaultClockSkew = time.Minute
+
+// ReasonCode identifies why a certificate failed the verification.
+type ReasonCode string
+
+const (
+	// ReasonUnknownAuthority indicates that the certificate is not signed by
+	// one of the trusted authorities.
+	ReasonUnknownAuthority ReasonCode = "unknown-authority"
+	// ReasonInvalidSignature indicates that the certificate signature does not
+	// verify.
+	ReasonInvalidSignature ReasonCode = "invalid-signature"
+	// ReasonInvalidCertType indicates that the certificate is not of the
+	// expected type.
+	ReasonInvalidCertType ReasonCode = "invalid-cert-type"
+	// ReasonNotYetValid indicates that the certificate validity period has not
+	// started.
+	ReasonNotYetValid ReasonCode = "not-yet-valid"
+	// ReasonExpired indicates that the certificate has expired.
+	ReasonExpired ReasonCode = "expired"
+	// ReasonInvalidPrincipal indicates that the certificate is not valid for
+	// the requested principal.
+	ReasonInvalidPrincipal ReasonCode = "invalid-principal"
+	// ReasonUnsupportedCriticalOption indicates that the certificate contains
+	// a critical option that is not supported.
+	ReasonUnsupportedCriticalOption ReasonCode = "unsupported-critical-option"
+	// ReasonForceCommand indicates that the force-command critical option does
+	// not satisfy the policy.
+	ReasonForceCommand ReasonCode = "force-command"
+	// ReasonSourceAddress indicates that the client address is not allowed by
+	// the source-address critical option.
+	ReasonSourceAddress ReasonCode = "source-address"
+	// ReasonExtension indicates that the certificate extensions do not satisfy
+	// the policy.
+	ReasonExtension ReasonCode = "extension"
+)
+
+// Reason describes a single verification failure.
+type Reason struct {
+	Code    ReasonCode
+	Message string
+}
+
+// VerificationError is the error returned by VerifyCertificate. It contains
+// all the reasons why the certificate failed the verification.
+type VerificationError struct {
+	Reasons []Reason
+}
+
+// Error implements the error interface.
+func (e *VerificationError) Error() string {
+	msgs := make([]string, len(e.Reasons))
+	for i, r := range e.Reasons {
+		msgs[i] = r.Message
+	}
+	return "ssh certificate verification failed: " + strings.Join(msgs, "; ")
+}
+
+// Has returns true if the error contains a reason with the given code.
+func (e *VerificationError) Has(code ReasonCode) bool {
+	for _, r := range e.Reasons {
+		if r.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *VerificationError) add(code ReasonCode, format string, args ...interface{}) {
+	e.Reasons = append(e.Reasons, Reason{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// VerifyOptions are the options used to verify a certificate.
+type VerifyOptions struct {
+	// Authorities are the trusted CA keys. A certificate must be signed by one
+	// of them.
+	Authorities []ssh.PublicKey
+
+	// CertType is the expected certificate type. If it is 0 both user and host
+	// certificates are accepted.
+	CertType CertType
+
+	// Principal is the user or host name that must be present in the
+	// certificate principals. Like OpenSSH, a certificate without principals
+	// is not valid for any principal. If it's empty, the principals are not
+	// checked.
+	Principal string
+
+	// Now returns the current time, if it's not set time.Now will be used.
+	Now func() time.Time
+
+	// ClockSkew is the clock skew allowed in the validity window. If it's 0
+	// DefaultClockSkew will be used, a negative value disables it.
+	ClockSkew time.Duration
+
+	// ClientAddress is the address of the client, it will be matched against
+	// the CIDRs in the source-address critical option. If the certificate has
+	// a source-address critical option and it's not set, the verification
+	// will fail.
+	ClientAddress net.IP
+
+	// SupportedCriticalOptions is the list of critical options supported by
+	// the caller in addition to force-command and source-address. As defined
+	// by OpenSSH, a certificate with an unknown critical option is rejected.
+	SupportedCriticalOptions []string
+
+	// RequireForceCommand requires the force-command critical option to be
+	// present in the certificate.
+	RequireForceCommand bool
+
+	// ForceCommands is the list of allowed values for the force-command
+	// critical option. If it's empty any command is allowed, and the caller is
+	// responsible for enforcing it.
+	ForceCommands []string
+
+	// RequiredExtensions is the list of extensions that must be present in
+	// the certificate.
+	RequiredExtensions []string
+
+	// AllowedExtensions is the list of extensions that can be present in the
+	// certificate. If it's nil any extension is allowed.
+	AllowedExtensions []string
+}
+
+// VerifyCertificate checks the given certificate against the trusted
+// authorities and the policies in the options. If the certificate is not
+// valid, it returns a *VerificationError with all the reasons.
+func VerifyCertificate(cert *ssh.Certificate, opts VerifyOptions) error {
+	if cert == nil {
+		return &VerificationError{Reasons: []Reason{
+			{Code: ReasonInvalidSignature, Message: "certificate cannot be nil"},
+		}}
+	}
+
+	verr := new(VerificationError)
+	verifyAuthority(verr, cert, opts.Authorities)
+	if opts.CertType != 0 && CertType(cert.CertType) != opts.CertType {
+		verr.add(ReasonInvalidCertType, "certificate type is not %s", opts.CertType)
+	}
+	verifyValidity(verr, cert, opts)
+	if opts.Principal != "" && !contains(cert.ValidPrincipals, opts.Principal) {
+		verr.add(ReasonInvalidPrincipal, "principal %q is not in the certificate principals %q", opts.Principal, cert.ValidPrincipals)
+	}
+	verifyCriticalOptions(verr, cert, opts)
+	verifyExtensions(verr, cert, opts)
+
+	if len(verr.Reasons) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func verifyAuthority(verr *VerificationError, cert *ssh.Certificate, authorities []ssh.PublicKey) {
+	if cert.SignatureKey == nil || cert.Signature == nil {
+		verr.add(ReasonInvalidSignature, "certificate is not signed")
+		return
+	}
+
+	var found bool
+	b := cert.SignatureKey.Marshal()
+	for _, k := range authorities {
+		if k != nil && bytes.Equal(k.Marshal(), b) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		verr.add(ReasonUnknownAuthority, "certificate is not signed by a trusted authority")
+		return
+	}
+
+	// Verify the signature over the certificate without the signature.
+	c := *cert
+	c.Signature = nil
+	data := c.Marshal()
+	data = data[:len(data)-4]
+	if err := cert.SignatureKey.Verify(data, cert.Signature); err != nil {
+		verr.add(ReasonInvalidSignature, "certificate signature does not verify")
+	}
+}
+
+func verifyValidity(verr *VerificationError, cert *ssh.Certificate, opts VerifyOptions) {
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+	skew := opts.ClockSkew
+	switch {
+	case skew == 0:
+		skew = DefaultClockSkew
+	case skew < 0:
+		skew = 0
+	}
+
+	t := now()
+	if after := int64(cert.ValidAfter); after < 0 || t.Add(skew).Before(time.Unix(after, 0)) {
+		verr.add(ReasonNotYetValid, "certificate is not yet valid")
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity {
+		if before := int64(cert.ValidBefore); before < 0 || !t.Add(-skew).Before(time.Unix(before, 0)) {
+			verr.add(ReasonExpired, "certificate has expired")
+		}
+	}
+}
+
+func verifyCriticalOptions(verr *VerificationError, cert *ssh.Certificate, opts VerifyOptions) {
+	for name := range cert.CriticalOptions {
+		if name != ForceCommandOption && name != SourceAddressOption && !contains(opts.SupportedCriticalOptions, name) {
+			verr.add(ReasonUnsupportedCriticalOption, "unsupported critical option %q", name)
+		}
+	}
+
+	command, ok := cert.CriticalOptions[ForceCommandOption]
+	switch {
+	case !ok && opts.RequireForceCommand:
+		verr.add(ReasonForceCommand, "certificate does not have a force-command")
+	case ok && len(opts.ForceCommands) > 0 && !contains(opts.ForceCommands, command):
+		verr.add(ReasonForceCommand, "force-command %q is not allowed", command)
+	}
+
+	if v, ok := cert.CriticalOptions[SourceAddressOption]; ok {
+		if err := matchSourceAddress(v, opts.ClientAddress); err != nil {
+			verr.add(ReasonSourceAddress, "%s", err)
+		}
+	}
+}
+
+func verifyExtensions(verr *VerificationError, cert *ssh.Certificate, opts VerifyOptions) {
+	for _, name := range opts.RequiredExtensions {
+		if _, ok := cert.Extensions[name]; !ok {
+			verr.add(ReasonExtension, "required extension %q is missing", name)
+		}
+	}
+	if opts.AllowedExtensions != nil {
+		for name := range cert.Extensions {
+			if !contains(opts.AllowedExtensions, name) {
+				verr.add(ReasonExtension, "extension %q is not allowed", name)
+			}
+		}
+	}
+}
+
+// matchSourceAddress checks that the given address is in the comma-separated
+// list of addresses or CIDRs of a source-address critical option.
+func matchSourceAddress(sourceAddress string, addr net.IP) error {
+	if addr == nil {
+		return errors.Errorf("client address is required by source-address %q", sourceAddress)
+	}
+	for _, s := range strings.Split(sourceAddress, ",") {
+		s = strings.TrimSpace(s)
+		if strings.Contains(s, "/") {
+			_, ipNet, err := net.ParseCIDR(s)
+			if err != nil {
+				return errors.Wrapf(err, "invalid source-address %q", sourceAddress)
+			}
+			if ipNet.Contains(addr) {
+				return nil
+			}
+		} else {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return errors.Errorf("invalid source-address %q", sourceAddress)
+			}
+			if ip.Equal(addr) {
+				return nil
+			}
+		}
+	}
+	return errors.Errorf("client address %s is not allowed by source-address %q", addr, sourceAddress)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package sshutil
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func mustSSHSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	return signer
+}
+
+func TestVerifyCertificate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ca := mustSSHSigner(t)
+	otherCA := mustSSHSigner(t)
+	key := mustSSHSigner(t)
+
+	mustCert := func(t *testing.T, signer ssh.Signer, fn func(c *ssh.Certificate)) *ssh.Certificate {
+		t.Helper()
+		cert := &ssh.Certificate{
+			Key:             key.PublicKey(),
+			CertType:        ssh.UserCert,
+			KeyId:           "jane@example.com",
+			ValidPrincipals: []string{"jane", "admin"},
+			ValidAfter:      uint64(now.Add(-time.Hour).Unix()),
+			ValidBefore:     uint64(now.Add(time.Hour).Unix()),
+			Permissions: ssh.Permissions{
+				CriticalOptions: map[string]string{},
+				Extensions: map[string]string{
+					"permit-pty":             "",
+					"permit-port-forwarding": "",
+				},
+			},
+		}
+		if fn != nil {
+			fn(cert)
+		}
+		cert, err := CreateCertificate(cert, signer)
+		require.NoError(t, err)
+		return cert
+	}
+
+	opts := func(fn func(o *VerifyOptions)) VerifyOptions {
+		o := VerifyOptions{
+			Authorities: []ssh.PublicKey{otherCA.PublicKey(), ca.PublicKey()},
+			CertType:    UserCert,
+			Principal:   "jane",
+			Now:         func() time.Time { return now },
+		}
+		if fn != nil {
+			fn(&o)
+		}
+		return o
+	}
+
+	tampered := mustCert(t, ca, nil)
+	tampered.ValidPrincipals = []string{"root"}
+
+	tests := []struct {
+		name  string
+		cert  *ssh.Certificate
+		opts  VerifyOptions
+		codes []ReasonCode
+	}{
+		{"ok", mustCert(t, ca, nil), opts(nil), nil},
+		{"ok host", mustCert(t, ca, func(c *ssh.Certificate) {
+			c.CertType = ssh.HostCert
+			c.ValidPrincipals = []string{"host.example.com"}
+			c.Extensions = nil
+		}), opts(func(o *VerifyOptions) {
+			o.CertType = HostCert
+			o.Principal = "host.example.com"
+			o.AllowedExtensions = []string{}
+		}), nil},
+		{"ok any type and principal", mustCert(t, ca, nil), opts(func(o *VerifyOptions) {
+			o.CertType = 0
+			o.Principal = ""
+		}), nil},
+		{"ok clock skew", mustCert(t, ca, func(c *ssh.Certificate) {
+			c.ValidAfter = uint64(now.Add(30 * time.Second).Unix())
+		}), opts(nil), nil},
+		{"ok infinity", mustCert(t, ca, func(c *ssh.Certificate) {
+			c.ValidAfter = 0
+			c.ValidBefore = ssh.CertTimeInfinity
+		}), opts(nil), nil},
+		{"ok force-command", mustCert(t, ca, func(c *ssh.Certificate) {
+			c.CriticalOptions[ForceCommandOption] = "/usr/bin/backup"
+		}), opts(func(o *VerifyOptions) {
+			o.RequireForceCommand = true
+			o.ForceCommands = []string{"/usr/bin/true", "/usr/bin/backup"}
+		}), nil},
+		{"ok source-address", mustCert(t, ca, func(c *ssh.Certificate) {
+			c.CriticalOptions[SourceAddressOption] = "10.0.0.0/8, 192.168.1.10,2001:db8::/32"
+		}), opts(func(o *VerifyOptions) {
+			o.ClientAddress = net.ParseIP("192.168.1.10")
+		}), nil},
+		{"ok source-address ipv6", mustCert(t, ca, func(c *ssh.Certificate) {
+			c.CriticalOptions[SourceAddressOption] = "10.0.0.0/8,2001:db8::/32"
+		}), opts(func(o *VerifyOptions) {
+			o.ClientAddress = net.ParseIP("2001:db8::1")
+		}), nil},
+		{"ok supported critical option", mustCert(t, ca, func(c *ssh.Certificate) {
+			c.CriticalOptions["verify-required"] = ""
+		}), opts(func(o *VerifyOptions) {
+			o.SupportedCriticalOptions = []string{"verify-required"}
+		}), nil},
+		{"ok extensions", mustCert(t, ca, nil), opts(func(o *VerifyOptions) {
+			o.RequiredExtensions = []string{"permit-pty"}
+			o.AllowedExtensions = []string{"permit-pty", "permit-port-forwarding", "permit-X11-forwarding"}
+		}), nil},
+		{"fail nil", nil, opts(nil), []ReasonCode{ReasonInvalidSignature}},
+		{"fail unknown authority", mustCert(t, mustSSHSigner(t), nil), opts(nil), []ReasonCode{ReasonUnknownAuthority}},
+		{"fail signature", tampered, opts(func(o *VerifyOptions) {
+			o.Principal = "root"
+		}), []ReasonCode{ReasonInvalidSignature}},
+		{"fail cert type", mustCert(t, ca, nil), opts(func(o *VerifyOptions) {
+			o.CertType = HostCert
+		}), []ReasonCode{ReasonInvalidCertType}},
+		{"fail not yet valid", mustCert(t, ca, func(c *ssh.Certificate) {
+			c.ValidAfter = uint64(now.Add(2 * time.Minute).Unix())
+		}), opts(nil), []ReasonCode{ReasonNotYetValid}},
+		{"fail not yet valid without skew", mustCert(t, ca, func(c *ssh.Certificate) {
+			c.ValidAfter = uint64(now.Add(30 * time.Second).Unix())
+		}), opts(func(o *VerifyOptions) {
+			o.ClockSkew = -1
+		}), []ReasonCode{ReasonNotYetValid}},
+		{"fail expired", mustCert(t, ca, func(c *ssh.Certificate) {
+			c.ValidBefore = uint64(now.Add(-2 * time.Minute).Unix())
+		}), opts(nil), []ReasonCode{ReasonExpired}},
+		{"fail principal", mustCert(t, ca, nil), opts(func(o *VerifyOptions) {
+			o.Principal = "root"
+		}), []ReasonCode{ReasonInvalidPrincipal}},
+		{"fail empty principals", mustCert(t, ca, func(c *ssh.Certificate) {
+			c.ValidPrincipals = nil
+		}), opts(nil), []ReasonCode{ReasonInvalidPrincipal}},
+		{"fail unsupported critical option", mustCert(t, ca, func(c *ssh.Certificate) {
+			c.CriticalOptions["verify-required"] = ""
+		}), opts(nil), []ReasonCode{ReasonUnsupportedCriticalOption}},
+		{"fail missing force-command", mustCert(t, ca, nil), opts(func(o *VerifyOptions) {
+			o.RequireForceCommand = true
+		}), []ReasonCode{ReasonForceCommand}},
+		{"fail force-command", mustCert(t, ca, func(c *ssh.Certificate) {
+			c.CriticalOptions[ForceCommandOption] = "/bin/sh"
+		}), opts(func(o *VerifyOptions) {
+			o.ForceCommands = []string{"/usr/bin/backup"}
+		}), []ReasonCode{ReasonForceCommand}},
+		{"fail source-address", mustCert(t, ca, func(c *ssh.Certificate) {
+			c.CriticalOptions[SourceAddressOption] = "10.0.0.0/8"
+		}), opts(func(o *VerifyOptions) {
+			o.ClientAddress = net.ParseIP("192.168.1.10")
+		}), []ReasonCode{ReasonSourceAddress}},
+		{"fail source-address missing client", mustCert(t, ca, func(c *ssh.Certificate) {
+			c.CriticalOptions[SourceAddressOption] = "10.0.0.0/8"
+		}), opts(nil), []ReasonCode{ReasonSourceAddress}},
+		{"fail source-address invalid", mustCert(t, ca, func(c *ssh.Certificate) {
+			c.CriticalOptions[SourceAddressOption] = "10.0.0.0/33"
+		}), opts(func(o *VerifyOptions) {
+			o.ClientAddress = net.ParseIP("10.0.0.1")
+		}), []ReasonCode{ReasonSourceAddress}},
+		{"fail required extension", mustCert(t, ca, nil), opts(func(o *VerifyOptions) {
+			o.RequiredExtensions = []string{"permit-agent-forwarding"}
+		}), []ReasonCode{ReasonExtension}},
+		{"fail allowed extensions", mustCert(t, ca, nil), opts(func(o *VerifyOptions) {
+			o.AllowedExtensions = []string{"permit-pty"}
+		}), []ReasonCode{ReasonExtension}},
+		{"fail multiple", mustCert(t, ca, func(c *ssh.Certificate) {
+			c.CertType = ssh.HostCert
+			c.ValidBefore = uint64(now.Add(-time.Hour).Unix())
+		}), opts(func(o *VerifyOptions) {
+			o.Principal = "root"
+		}), []ReasonCode{ReasonInvalidCertType, ReasonExpired, ReasonInvalidPrincipal}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyCertificate(tt.cert, tt.opts)
+			if tt.codes == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var verr *VerificationError
+			require.True(t, errors.As(err, &verr))
+			codes := make([]ReasonCode, len(verr.Reasons))
+			for i, r := range verr.Reasons {
+				codes[i] = r.Code
+				assert.True(t, verr.Has(r.Code))
+				assert.Contains(t, err.Error(), r.Message)
+			}
+			assert.Equal(t, tt.codes, codes)
+		})
+	}
+}
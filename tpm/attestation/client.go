@@ -130,7 +130,7 @@ func (ac *Client) Attest(ctx context.Context, t *tpm.TPM, ek *tpm.EK, ak *tpm.AK
 		return nil, fmt.Errorf("failed activating credential: %w", err)
 	}
 
-	secretResp, err := ac.secret(ctx, secret)
+	secretResp, err := ac.secret(ctx, attResp.SessionID, secret)
 	if err != nil {
 		return nil, fmt.Errorf("failed validating secret: %w", err)
 	}
@@ -173,6 +173,7 @@ type attestationRequest struct {
 type attestationResponse struct {
 	Credential []byte `json:"credential"`
 	Secret     []byte `json:"secret"` // encrypted secret
+	SessionID  string `json:"sessionID,omitempty"`
 }
 
 // attest performs the HTTP POST request to the `/attest` endpoint of the
@@ -239,7 +240,8 @@ func (ac *Client) attest(ctx context.Context, info *tpm.Info, ek *tpm.EK, attest
 }
 
 type secretRequest struct {
-	Secret []byte `json:"secret"` // decrypted secret
+	Secret    []byte `json:"secret"` // decrypted secret
+	SessionID string `json:"sessionID,omitempty"`
 }
 
 type secretResponse struct {
@@ -248,9 +250,10 @@ type secretResponse struct {
 
 // secret performs the HTTP POST request to the `/secret` endpoint of the
 // Attestation CA.
-func (ac *Client) secret(ctx context.Context, secret []byte) (*secretResponse, error) {
+func (ac *Client) secret(ctx context.Context, sessionID string, secret []byte) (*secretResponse, error) {
 	sr := secretRequest{
-		Secret: secret,
+		Secret:    secret,
+		SessionID: sessionID,
 	}
 
 	body, err := json.Marshal(sr)
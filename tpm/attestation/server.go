@@ -0,0 +1,483 @@
+package attestation
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/smallstep/go-attestation/attest"
+
+	"go.step.sm/crypto/tpm"
+	"go.step.sm/crypto/x509util"
+)
+
+// DefaultAKTemplate is the template used by default to create AK
+// certificates. The SANs contain the EK URN, as a PermanentIdentifier and as
+// an URI, "urn:ek:sha256:<base64 encoded EK public key ID>".
+const DefaultAKTemplate = `{
+	"subject": {{ toJson .Subject }},
+	"sans": {{ toJson .SANs }},
+	"keyUsage": ["digitalSignature"],
+	"unknownExtKeyUsage": ["2.23.133.8.3"]
+}`
+
+const (
+	// defaultAKCertificateValidity is the validity of AK certificates if no
+	// other validity is configured.
+	defaultAKCertificateValidity = 24 * time.Hour
+	// defaultSessionTimeout is the time a client has to send the activated
+	// secret after the attestation request.
+	defaultSessionTimeout = 5 * time.Minute
+	// maxRequestBodySize is the maximum size of the requests accepted by
+	// the Server.
+	maxRequestBodySize = 1 << 20
+	// sessionIDSize is the number of random bytes in a session ID.
+	sessionIDSize = 32
+	// maxSessions is the maximum number of attestation sessions waiting for
+	// the activated secret.
+	maxSessions = 10000
+)
+
+// Server implements the attestation CA side of the protocol used by
+// [Client]. It verifies the EK certificate against the configured
+// manufacturer roots, challenges the TPM to activate a credential bound to
+// the AK, and issues an AK certificate once the secret in the credential is
+// returned.
+//
+// The `/attest` response contains a random session ID generated by the
+// Server, which the client sends back in the `/secret` request. Clients that
+// don't send the session ID are matched by the activated secret. A session is
+// removed once the secret is verified, or after the session timeout.
+type Server struct {
+	signer          crypto.Signer
+	chain           []*x509.Certificate
+	ekRoots         *x509.CertPool
+	ekIntermediates *x509.CertPool
+	template        string
+	templateData    x509util.TemplateData
+	validity        time.Duration
+	sessionTimeout  time.Duration
+	now             func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// session holds the state of an attestation between the `/attest` and the
+// `/secret` requests.
+type session struct {
+	secret    []byte
+	akPublic  crypto.PublicKey
+	ekPublic  crypto.PublicKey
+	ekCert    *x509.Certificate
+	expiresAt time.Time
+}
+
+// ServerOption is the type used to configure a [Server].
+type ServerOption func(s *Server) error
+
+// WithEKRoots sets the manufacturer roots used to verify EK certificates.
+func WithEKRoots(roots *x509.CertPool) ServerOption {
+	return func(s *Server) error {
+		s.ekRoots = roots
+		return nil
+	}
+}
+
+// WithEKIntermediates sets the manufacturer intermediates used to verify EK
+// certificates.
+func WithEKIntermediates(intermediates *x509.CertPool) ServerOption {
+	return func(s *Server) error {
+		s.ekIntermediates = intermediates
+		return nil
+	}
+}
+
+// WithAKTemplate sets the [x509util] template and data used to create AK
+// certificates. The SANs in the data are always set to the EK URN, and the
+// EK certificate is available in the insecure data as "EKCertificate".
+func WithAKTemplate(text string, data x509util.TemplateData) ServerOption {
+	return func(s *Server) error {
+		if err := x509util.ValidateTemplate([]byte(text)); err != nil {
+			return err
+		}
+		s.template = text
+		s.templateData = data
+		return nil
+	}
+}
+
+// WithAKValidity sets the validity of the AK certificates. It defaults to 24
+// hours.
+func WithAKValidity(d time.Duration) ServerOption {
+	return func(s *Server) error {
+		if d <= 0 {
+			return errors.New("validity must be greater than 0")
+		}
+		s.validity = d
+		return nil
+	}
+}
+
+// WithSessionTimeout sets the time a client has to send the activated
+// secret after the attestation request. It defaults to 5 minutes.
+func WithSessionTimeout(d time.Duration) ServerOption {
+	return func(s *Server) error {
+		if d <= 0 {
+			return errors.New("session timeout must be greater than 0")
+		}
+		s.sessionTimeout = d
+		return nil
+	}
+}
+
+// NewServer creates a new attestation CA [Server]. AK certificates are
+// signed by `signer`, and `chain` is the certificate chain of the signer,
+// starting with its certificate. The chain is appended to the AK
+// certificate in the responses.
+func NewServer(signer crypto.Signer, chain []*x509.Certificate, opts ...ServerOption) (*Server, error) {
+	switch {
+	case signer == nil:
+		return nil, errors.New("signer cannot be nil")
+	case len(chain) == 0:
+		return nil, errors.New("chain cannot be empty")
+	}
+
+	s := &Server{
+		signer:         signer,
+		chain:          chain,
+		template:       DefaultAKTemplate,
+		templateData:   x509util.NewTemplateData(),
+		validity:       defaultAKCertificateValidity,
+		sessionTimeout: defaultSessionTimeout,
+		now:            time.Now,
+		sessions:       make(map[string]*session),
+	}
+	for _, o := range opts {
+		if err := o(s); err != nil {
+			return nil, fmt.Errorf("failed applying option to attestation server: %w", err)
+		}
+	}
+
+	if s.ekRoots == nil {
+		return nil, errors.New("EK roots are required")
+	}
+
+	return s, nil
+}
+
+// ServeHTTP implements [http.Handler]. It serves the `/attest` and `/secret`
+// endpoints, relative to the path the Server is mounted on.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if requestID := r.Header.Get(requestIDHeader); requestID != "" {
+		w.Header().Set(requestIDHeader, requestID)
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+	switch path.Base(r.URL.Path) {
+	case "attest":
+		s.attest(w, r)
+	case "secret":
+		s.secret(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// attest handles the `/attest` requests. It verifies the EK and the AK
+// attestation parameters, and returns a credential that can only be
+// activated by the TPM with the EK and the AK.
+func (s *Server) attest(w http.ResponseWriter, r *http.Request) {
+	var req attestationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "failed decoding attestation request", http.StatusBadRequest)
+		return
+	}
+
+	ekPublic, ekCert, err := s.verifyEK(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	akParams := attest.AttestationParameters{
+		Public:                  req.AttestParams.Public,
+		UseTCSDActivationFormat: req.AttestParams.UseTCSDActivationFormat,
+		CreateData:              req.AttestParams.CreateData,
+		CreateAttestation:       req.AttestParams.CreateAttestation,
+		CreateSignature:         req.AttestParams.CreateSignature,
+	}
+	akPublic, err := attest.ParseAKPublic(attest.TPMVersion20, akParams.Public)
+	if err != nil {
+		http.Error(w, "failed parsing AK public key", http.StatusBadRequest)
+		return
+	}
+
+	// Generate verifies the AK parameters before creating the credential.
+	activation := attest.ActivationParameters{
+		TPMVersion: attest.TPMVersion20,
+		EK:         ekPublic,
+		AK:         akParams,
+	}
+	secret, ec, err := activation.Generate()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed validating attestation parameters: %v", err), http.StatusForbidden)
+		return
+	}
+
+	sessionID, err := s.newSession(&session{
+		secret:   secret,
+		akPublic: akPublic.Public,
+		ekPublic: ekPublic,
+		ekCert:   ekCert,
+	})
+	switch {
+	case errors.Is(err, errTooManySessions):
+		http.Error(w, "too many attestation sessions", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		http.Error(w, "failed creating attestation session", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, &attestationResponse{
+		Credential: ec.Credential,
+		Secret:     ec.Secret,
+		SessionID:  sessionID,
+	})
+}
+
+// secret handles the `/secret` requests. It verifies the secret activated
+// by the TPM and returns the AK certificate chain.
+func (s *Server) secret(w http.ResponseWriter, r *http.Request) {
+	var req secretRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "failed decoding secret request", http.StatusBadRequest)
+		return
+	}
+
+	sess, err := s.verifySession(req.SessionID, req.Secret)
+	switch {
+	case errors.Is(err, errSessionNotFound):
+		http.Error(w, "attestation session not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, "invalid secret", http.StatusForbidden)
+		return
+	}
+
+	cert, err := s.sign(sess)
+	if err != nil {
+		http.Error(w, "failed signing AK certificate", http.StatusInternalServerError)
+		return
+	}
+
+	resp := &secretResponse{
+		CertificateChain: [][]byte{cert.Raw},
+	}
+	for _, c := range s.chain {
+		resp.CertificateChain = append(resp.CertificateChain, c.Raw)
+	}
+	writeJSON(w, resp)
+}
+
+var (
+	errSessionNotFound = errors.New("attestation session not found")
+	errInvalidSecret   = errors.New("invalid secret")
+	errTooManySessions = errors.New("too many attestation sessions")
+)
+
+// newSession stores sess with a new random session ID, and returns the ID.
+// Expired sessions are removed, and no more than maxSessions are kept.
+func (s *Server) newSession(sess *session) (string, error) {
+	b := make([]byte, sessionIDSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed generating session ID: %w", err)
+	}
+	id := base64.RawURLEncoding.EncodeToString(b)
+
+	now := s.now()
+	sess.expiresAt = now.Add(s.sessionTimeout)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range s.sessions {
+		if now.After(v.expiresAt) {
+			delete(s.sessions, k)
+		}
+	}
+	if len(s.sessions) >= maxSessions {
+		return "", errTooManySessions
+	}
+	if _, ok := s.sessions[id]; ok {
+		return "", errors.New("duplicate session ID")
+	}
+	s.sessions[id] = sess
+
+	return id, nil
+}
+
+// verifySession returns the session with the given ID if the secret matches
+// the one in the session. If the ID is empty, as clients not aware of
+// session IDs don't send it, the session is looked up using the secret. The
+// session is removed after the secret is verified, so it can only be used
+// once, or if it has expired.
+func (s *Server) verifySession(id string, secret []byte) (*session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id == "" {
+		id = s.findSessionID(secret)
+	}
+
+	sess, ok := s.sessions[id]
+	switch {
+	case !ok:
+		return nil, errSessionNotFound
+	case s.now().After(sess.expiresAt):
+		delete(s.sessions, id)
+		return nil, errSessionNotFound
+	case subtle.ConstantTimeCompare(sess.secret, secret) != 1:
+		return nil, errInvalidSecret
+	}
+
+	delete(s.sessions, id)
+	return sess, nil
+}
+
+// findSessionID returns the ID of the session with the given secret, or an
+// empty string if there's none. It must be called with the lock held.
+func (s *Server) findSessionID(secret []byte) string {
+	if len(secret) == 0 {
+		return ""
+	}
+	for id, sess := range s.sessions {
+		if subtle.ConstantTimeCompare(sess.secret, secret) == 1 {
+			return id
+		}
+	}
+	return ""
+}
+
+// verifyEK returns the EK public key and the EK certificate in the request
+// after verifying the certificate against the EK roots.
+func (s *Server) verifyEK(req *attestationRequest) (crypto.PublicKey, *x509.Certificate, error) {
+	if len(req.EKCerts) == 0 {
+		return nil, nil, errors.New("EK certificate is required")
+	}
+
+	var ekPublic crypto.PublicKey
+	if len(req.EKPub) > 0 {
+		var err error
+		if ekPublic, err = x509.ParsePKIXPublicKey(req.EKPub); err != nil {
+			return nil, nil, errors.New("failed parsing EK public key")
+		}
+	}
+
+	var verifyErr error
+	for _, der := range req.EKCerts {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			verifyErr = errors.New("failed parsing EK certificate")
+			continue
+		}
+		if ekPublic != nil && !publicKeyEqual(ekPublic, cert.PublicKey) {
+			verifyErr = errors.New("EK certificate does not match EK public key")
+			continue
+		}
+
+		if _, err := tpm.VerifyEKCertificateChain(cert, x509.VerifyOptions{
+			Roots:         s.ekRoots,
+			Intermediates: s.ekIntermediates,
+			CurrentTime:   s.now(),
+		}); err != nil {
+			verifyErr = err
+			continue
+		}
+
+		return cert.PublicKey, cert, nil
+	}
+
+	return nil, nil, verifyErr
+}
+
+// sign creates the AK certificate using the template of the Server.
+func (s *Server) sign(sess *session) (*x509.Certificate, error) {
+	ekURL, err := ekURN(sess.ekPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	data := x509util.NewTemplateData()
+	for k, v := range s.templateData {
+		data[k] = v
+	}
+	data.SetSubjectAlternativeNames(
+		x509util.SubjectAlternativeName{Type: x509util.PermanentIdentifierType, Value: ekURL.String()},
+		x509util.SubjectAlternativeName{Type: x509util.URIType, Value: ekURL.String()},
+	)
+	data.SetInsecure("EKCertificate", sess.ekCert)
+
+	c, err := x509util.NewCertificateFromX509(&x509.Certificate{
+		PublicKey: sess.akPublic,
+	}, x509util.WithTemplate(s.template, data))
+	if err != nil {
+		return nil, err
+	}
+
+	template := c.GetCertificate()
+	now := s.now()
+	template.NotBefore = now.Add(-1 * time.Minute)
+	template.NotAfter = now.Add(s.validity)
+
+	return x509util.CreateCertificate(template, s.chain[0], sess.akPublic, s.signer)
+}
+
+// ekURN returns the URN used to identify an EK, the base64 encoded SHA-256
+// of the EK public key in PKIX, ASN.1 DER format.
+func ekURN(pub crypto.PublicKey) (*url.URL, error) {
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshaling public key: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return &url.URL{
+		Scheme: "urn",
+		Opaque: "ek:sha256:" + base64.StdEncoding.EncodeToString(sum[:]),
+	}, nil
+}
+
+func publicKeyEqual(a, b crypto.PublicKey) bool {
+	ab, err := x509.MarshalPKIXPublicKey(a)
+	if err != nil {
+		return false
+	}
+	bb, err := x509.MarshalPKIXPublicKey(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ab, bb)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(v)
+}
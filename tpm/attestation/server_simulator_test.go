@@ -0,0 +1,255 @@
+//go:build tpmsimulator
+// +build tpmsimulator
+
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/tpm"
+	"go.step.sm/crypto/tpm/simulator"
+	"go.step.sm/crypto/tpm/storage"
+	"go.step.sm/crypto/x509util"
+)
+
+// newSimulatedTPMWithEKCertificate returns a TPM with an RSA EK certificate
+// signed by the manufacturer CA stored in NV.
+func newSimulatedTPMWithEKCertificate(t *testing.T, manufacturer *minica.CA) *tpm.TPM {
+	t.Helper()
+	ctx := context.Background()
+
+	sim, err := simulator.New()
+	require.NoError(t, err)
+	require.NoError(t, sim.Open())
+	t.Cleanup(func() {
+		assert.NoError(t, sim.Close())
+	})
+
+	// EKs are cached, so a different instance is used to write the EK
+	// certificate.
+	setup, err := tpm.New(tpm.WithSimulator(sim), tpm.WithStore(storage.NewDirstore(t.TempDir())))
+	require.NoError(t, err)
+	eks, err := setup.GetEKs(ctx)
+	require.NoError(t, err)
+	ekCert, err := manufacturer.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "Simulator EK"},
+		PublicKey: getPreferredEK(eks).Public(),
+	})
+	require.NoError(t, err)
+	require.NoError(t, setup.DefineNV(ctx, tpm.EKCertificateRSAIndex, tpm.NVConfig{
+		Size:       len(ekCert.Raw),
+		Attributes: tpm.NVOwnerWrite | tpm.NVOwnerRead | tpm.NVAuthRead | tpm.NVNoDA,
+	}))
+	require.NoError(t, setup.WriteNV(ctx, tpm.EKCertificateRSAIndex, ekCert.Raw, 0, ""))
+
+	instance, err := tpm.New(tpm.WithSimulator(sim), tpm.WithStore(storage.NewDirstore(t.TempDir())))
+	require.NoError(t, err)
+	return instance
+}
+
+func newTestCA(t *testing.T) *minica.CA {
+	t.Helper()
+	ca, err := minica.New(
+		minica.WithGetSignerFunc(
+			func() (crypto.Signer, error) {
+				return keyutil.GenerateSigner("RSA", "", 2048)
+			},
+		),
+	)
+	require.NoError(t, err)
+	return ca
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	manufacturer := newTestCA(t)
+	instance := newSimulatedTPMWithEKCertificate(t, manufacturer)
+
+	eks, err := instance.GetEKs(ctx)
+	require.NoError(t, err)
+	ek := getPreferredEK(eks)
+	require.NotNil(t, ek.Certificate())
+	ekURL, err := ek.FingerprintURI()
+	require.NoError(t, err)
+
+	ak, err := instance.CreateAK(ctx, "ak1")
+	require.NoError(t, err)
+
+	ca := newTestCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(manufacturer.Root)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(manufacturer.Intermediate)
+
+	server, err := NewServer(ca.Signer, []*x509.Certificate{ca.Intermediate}, WithEKRoots(roots), WithEKIntermediates(intermediates))
+	require.NoError(t, err)
+	srv := httptest.NewServer(http.StripPrefix("/tpm", server))
+	t.Cleanup(srv.Close)
+
+	t.Run("ok", func(t *testing.T) {
+		client, err := NewClient(srv.URL + "/tpm")
+		require.NoError(t, err)
+		chain, err := client.Attest(ctx, instance, ek, ak)
+		require.NoError(t, err)
+		require.Len(t, chain, 2)
+		assert.Equal(t, ca.Intermediate, chain[1])
+
+		akCert := chain[0]
+		assert.Equal(t, ak.Public(), akCert.PublicKey)
+		require.Len(t, akCert.URIs, 1)
+		assert.Equal(t, ekURL.String(), akCert.URIs[0].String())
+		sans, err := x509util.ParseSubjectAlternativeNames(akCert)
+		require.NoError(t, err)
+		require.Len(t, sans.PermanentIdentifiers, 1)
+		assert.Equal(t, ekURL.String(), sans.PermanentIdentifiers[0].Identifier)
+
+		intermediates := x509.NewCertPool()
+		intermediates.AddCert(chain[1])
+		akRoots := x509.NewCertPool()
+		akRoots.AddCert(ca.Root)
+		_, err = akCert.Verify(x509.VerifyOptions{
+			Roots:         akRoots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		assert.NoError(t, err)
+
+		// the AK certificate can be stored with the AK
+		assert.NoError(t, ak.SetCertificateChain(ctx, chain))
+	})
+
+	t.Run("ok/template", func(t *testing.T) {
+		data := x509util.NewTemplateData()
+		data.SetCommonName("my-device")
+		server, err := NewServer(ca.Signer, []*x509.Certificate{ca.Intermediate}, WithEKRoots(roots),
+			WithEKIntermediates(intermediates), WithAKTemplate(DefaultAKTemplate, data))
+		require.NoError(t, err)
+		srv := httptest.NewServer(server)
+		t.Cleanup(srv.Close)
+
+		client, err := NewClient(srv.URL)
+		require.NoError(t, err)
+		chain, err := client.Attest(ctx, instance, ek, ak)
+		require.NoError(t, err)
+		assert.Equal(t, "my-device", chain[0].Subject.CommonName)
+	})
+
+	t.Run("fail/unknown-manufacturer", func(t *testing.T) {
+		other := newTestCA(t)
+		roots := x509.NewCertPool()
+		roots.AddCert(other.Root)
+		server, err := NewServer(ca.Signer, []*x509.Certificate{ca.Intermediate}, WithEKRoots(roots))
+		require.NoError(t, err)
+		srv := httptest.NewServer(server)
+		t.Cleanup(srv.Close)
+
+		client, err := NewClient(srv.URL)
+		require.NoError(t, err)
+		_, err = client.Attest(ctx, instance, ek, ak)
+		assert.Error(t, err)
+	})
+
+	t.Run("ok/wrong-secret", func(t *testing.T) {
+		params, err := ak.AttestationParameters(ctx)
+		require.NoError(t, err)
+		ekPub, err := x509.MarshalPKIXPublicKey(ek.Public())
+		require.NoError(t, err)
+
+		post := func(endpoint string, v interface{}) *http.Response {
+			body, err := json.Marshal(v)
+			require.NoError(t, err)
+			req, err := http.NewRequest(http.MethodPost, srv.URL+"/tpm/"+endpoint, bytes.NewReader(body))
+			require.NoError(t, err)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			t.Cleanup(func() { resp.Body.Close() })
+			return resp
+		}
+
+		resp := post("attest", attestationRequest{
+			EKPub:   ekPub,
+			EKCerts: [][]byte{ek.Certificate().Raw},
+			AttestParams: attestationParameters{
+				Public:            params.Public,
+				CreateData:        params.CreateData,
+				CreateAttestation: params.CreateAttestation,
+				CreateSignature:   params.CreateSignature,
+			},
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var attResp attestationResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&attResp))
+		require.NotEmpty(t, attResp.SessionID)
+
+		resp = post("secret", secretRequest{SessionID: attResp.SessionID, Secret: []byte("wrong-secret")})
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+		// the session is kept after a wrong secret
+		secret, err := ak.ActivateCredential(ctx, tpm.EncryptedCredential{
+			Credential: attResp.Credential,
+			Secret:     attResp.Secret,
+		})
+		require.NoError(t, err)
+		resp = post("secret", secretRequest{SessionID: attResp.SessionID, Secret: secret})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		// the session is removed after the secret is verified
+		resp = post("secret", secretRequest{SessionID: attResp.SessionID, Secret: secret})
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("ok/no-session-id", func(t *testing.T) {
+		params, err := ak.AttestationParameters(ctx)
+		require.NoError(t, err)
+
+		// clients that don't know about session IDs only send the secret
+		post := func(endpoint string, v interface{}) *http.Response {
+			body, err := json.Marshal(v)
+			require.NoError(t, err)
+			resp, err := http.Post(srv.URL+"/tpm/"+endpoint, "application/json", bytes.NewReader(body))
+			require.NoError(t, err)
+			t.Cleanup(func() { resp.Body.Close() })
+			return resp
+		}
+
+		resp := post("attest", attestationRequest{
+			EKCerts: [][]byte{ek.Certificate().Raw},
+			AttestParams: attestationParameters{
+				Public:            params.Public,
+				CreateData:        params.CreateData,
+				CreateAttestation: params.CreateAttestation,
+				CreateSignature:   params.CreateSignature,
+			},
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var attResp attestationResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&attResp))
+
+		secret, err := ak.ActivateCredential(ctx, tpm.EncryptedCredential{
+			Credential: attResp.Credential,
+			Secret:     attResp.Secret,
+		})
+		require.NoError(t, err)
+		resp = post("secret", map[string][]byte{"secret": secret})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var secretResp secretResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&secretResp))
+		assert.Len(t, secretResp.CertificateChain, 2)
+
+		resp = post("secret", map[string][]byte{"secret": secret})
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
@@ -0,0 +1,198 @@
+package attestation
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/x509util"
+)
+
+func TestNewServer(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	chain := []*x509.Certificate{ca.Intermediate}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Root)
+
+	tests := []struct {
+		name      string
+		opts      []ServerOption
+		assertion assert.ErrorAssertionFunc
+	}{
+		{"ok", []ServerOption{WithEKRoots(roots)}, assert.NoError},
+		{"ok/options", []ServerOption{
+			WithEKRoots(roots), WithEKIntermediates(x509.NewCertPool()),
+			WithAKTemplate(DefaultAKTemplate, x509util.NewTemplateData()),
+			WithAKValidity(time.Hour), WithSessionTimeout(time.Minute),
+		}, assert.NoError},
+		{"fail/no-roots", nil, assert.Error},
+		{"fail/template", []ServerOption{WithEKRoots(roots), WithAKTemplate("{{ fail", nil)}, assert.Error},
+		{"fail/validity", []ServerOption{WithEKRoots(roots), WithAKValidity(0)}, assert.Error},
+		{"fail/session-timeout", []ServerOption{WithEKRoots(roots), WithSessionTimeout(-1)}, assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewServer(ca.Signer, chain, tt.opts...)
+			tt.assertion(t, err)
+			if err != nil {
+				assert.Nil(t, got)
+			} else {
+				assert.NotNil(t, got)
+			}
+		})
+	}
+
+	t.Run("fail/signer", func(t *testing.T) {
+		_, err := NewServer(nil, chain, WithEKRoots(roots))
+		assert.Error(t, err)
+	})
+	t.Run("fail/chain", func(t *testing.T) {
+		_, err := NewServer(ca.Signer, nil, WithEKRoots(roots))
+		assert.Error(t, err)
+	})
+}
+
+func TestServer_ServeHTTP(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Root)
+	server, err := NewServer(ca.Signer, []*x509.Certificate{ca.Intermediate}, WithEKRoots(roots))
+	require.NoError(t, err)
+
+	// EK certificate not signed by the roots
+	other, err := minica.New()
+	require.NoError(t, err)
+	ekKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ekCert, err := other.Sign(&x509.Certificate{PublicKey: ekKey.Public()})
+	require.NoError(t, err)
+
+	mustJSON := func(v interface{}) []byte {
+		b, err := json.Marshal(v)
+		require.NoError(t, err)
+		return b
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		requestID  string
+		body       []byte
+		wantStatus int
+	}{
+		{"fail/method", http.MethodGet, "/attest", "id", nil, http.StatusMethodNotAllowed},
+		{"fail/not-found", http.MethodPost, "/other", "id", nil, http.StatusNotFound},
+		{"fail/attest-json", http.MethodPost, "/attest", "id", []byte("{"), http.StatusBadRequest},
+		{"fail/attest-no-ek-certificate", http.MethodPost, "/attest", "id", mustJSON(attestationRequest{}), http.StatusForbidden},
+		{"fail/attest-ek-certificate", http.MethodPost, "/attest", "id", mustJSON(attestationRequest{
+			EKCerts: [][]byte{ekCert.Raw},
+		}), http.StatusForbidden},
+		{"fail/attest-ek-public", http.MethodPost, "/attest", "id", mustJSON(attestationRequest{
+			EKPub:   []byte("foo"),
+			EKCerts: [][]byte{ekCert.Raw},
+		}), http.StatusForbidden},
+		{"fail/secret-json", http.MethodPost, "/secret", "id", []byte("{"), http.StatusBadRequest},
+		{"fail/secret-no-session", http.MethodPost, "/secret", "id", mustJSON(secretRequest{SessionID: "foo", Secret: []byte("secret")}), http.StatusNotFound},
+		{"fail/secret-no-session-id", http.MethodPost, "/secret", "", mustJSON(secretRequest{Secret: []byte("secret")}), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewReader(tt.body))
+			if tt.requestID != "" {
+				req.Header.Set(requestIDHeader, tt.requestID)
+			}
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.requestID, w.Header().Get(requestIDHeader))
+		})
+	}
+}
+
+func TestServer_sessions(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Root)
+	server, err := NewServer(ca.Signer, []*x509.Certificate{ca.Intermediate}, WithEKRoots(roots), WithSessionTimeout(time.Minute))
+	require.NoError(t, err)
+
+	now := time.Now()
+	server.now = func() time.Time { return now }
+
+	secret := []byte("secret")
+	id, err := server.newSession(&session{secret: secret})
+	require.NoError(t, err)
+	other, err := server.newSession(&session{secret: secret})
+	require.NoError(t, err)
+	assert.NotEqual(t, id, other)
+	assert.Len(t, server.sessions, 2)
+
+	// a wrong secret does not remove the session
+	_, err = server.verifySession(id, []byte("wrong-secret"))
+	assert.ErrorIs(t, err, errInvalidSecret)
+	_, err = server.verifySession("foo", secret)
+	assert.ErrorIs(t, err, errSessionNotFound)
+
+	sess, err := server.verifySession(id, secret)
+	require.NoError(t, err)
+	assert.Equal(t, secret, sess.secret)
+
+	// the session can only be used once
+	_, err = server.verifySession(id, secret)
+	assert.ErrorIs(t, err, errSessionNotFound)
+
+	// expired sessions are removed
+	now = now.Add(2 * time.Minute)
+	_, err = server.verifySession(other, secret)
+	assert.ErrorIs(t, err, errSessionNotFound)
+	assert.Empty(t, server.sessions)
+
+	expired, err := server.newSession(&session{secret: secret})
+	require.NoError(t, err)
+	now = now.Add(2 * time.Minute)
+	_, err = server.newSession(&session{secret: secret})
+	require.NoError(t, err)
+	assert.Len(t, server.sessions, 1)
+	assert.NotContains(t, server.sessions, expired)
+
+	// sessions are found by secret if the session ID is not sent
+	other, err = server.newSession(&session{secret: []byte("other-secret")})
+	require.NoError(t, err)
+	_, err = server.verifySession("", []byte("wrong-secret"))
+	assert.ErrorIs(t, err, errSessionNotFound)
+	_, err = server.verifySession("", nil)
+	assert.ErrorIs(t, err, errSessionNotFound)
+	sess, err = server.verifySession("", []byte("other-secret"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("other-secret"), sess.secret)
+	assert.NotContains(t, server.sessions, other)
+
+	// the number of sessions is bounded
+	for len(server.sessions) < maxSessions {
+		_, err := server.newSession(&session{secret: secret})
+		require.NoError(t, err)
+	}
+	_, err = server.newSession(&session{secret: secret})
+	assert.ErrorIs(t, err, errTooManySessions)
+
+	// expired sessions make room for new ones
+	now = now.Add(2 * time.Minute)
+	_, err = server.newSession(&session{secret: secret})
+	assert.NoError(t, err)
+	assert.Len(t, server.sessions, 1)
+}
@@ -0,0 +1,143 @@
+package tpm
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.step.sm/crypto/tpm/storage"
+	"go.step.sm/crypto/tpm/tss2"
+)
+
+// Decrypter is the interface implemented by decryption keys in the TPM. RSA
+// keys decrypt using RSA-OAEP or RSAES-PKCS1-v1_5, and ECDSA keys compute
+// ECDH shared secrets. It can be used to decrypt JWEs with
+// [go.step.sm/crypto/jose.NewOpaqueKeyDecrypter].
+type Decrypter interface {
+	crypto.Decrypter
+	ECDH(remote *ecdh.PublicKey) ([]byte, error)
+}
+
+// tss2Decrypter is a wrapper on top of [*tss2.Decrypter] that opens and
+// closes the TPM on each decrypt or ECDH call.
+type tss2Decrypter struct {
+	*tss2.Decrypter
+	tpm *TPM
+}
+
+// Decrypt implements crypto.Decrypter. The policy of the TPM key is
+// satisfied before decrypting, so the PCR values are checked on every
+// call.
+func (d *tss2Decrypter) Decrypt(rand io.Reader, msg []byte, opts crypto.DecrypterOpts) (plaintext []byte, err error) {
+	ctx := context.Background()
+	if err = d.tpm.open(goTPMCall(ctx)); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, d.tpm, &err)
+	d.SetCommandChannel(d.tpm.rwc)
+	plaintext, err = d.Decrypter.Decrypt(rand, msg, opts)
+	return
+}
+
+// ECDH returns the ECDH shared secret computed with the remote public key.
+func (d *tss2Decrypter) ECDH(remote *ecdh.PublicKey) (secret []byte, err error) {
+	ctx := context.Background()
+	if err = d.tpm.open(goTPMCall(ctx)); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, d.tpm, &err)
+	d.SetCommandChannel(d.tpm.rwc)
+	secret, err = d.Decrypter.ECDH(remote)
+	return
+}
+
+// GetDecrypter returns a [Decrypter] for a TPM Key identified by `name`. The
+// Key must have been created with the Decrypt option.
+func (t *TPM) GetDecrypter(ctx context.Context, name string) (Decrypter, error) {
+	return t.GetDecrypterWithPassword(ctx, name, "")
+}
+
+// GetDecrypterWithPassword returns a [Decrypter] for a TPM Key identified by
+// `name`, using `password` to authorize decrypting with it. If the Key has
+// a policy, the policy session is started and satisfied on each call. The
+// password is ignored if the Key doesn't require one.
+func (t *TPM) GetDecrypterWithPassword(ctx context.Context, name, password string) (d Decrypter, err error) {
+	if err = t.open(goTPMCall(ctx)); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	key, err := t.store.GetKey(name)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("failed getting decrypter for key %q: %w", name, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed getting decrypter for key %q: %w", name, err)
+	}
+
+	auth, err := decodeKeyAuth(key.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting decrypter for key %q: %w", name, err)
+	}
+	tpmKey, err := storedTSS2Key(key.Data, auth)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting decrypter for key %q: %w", name, err)
+	}
+
+	dec, err := tss2.CreateDecrypter(t.rwc, tpmKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting decrypter for key %q: %w", name, err)
+	}
+	dec.SetPassword(password)
+
+	d = &tss2Decrypter{
+		Decrypter: dec,
+		tpm:       t,
+	}
+
+	return
+}
+
+// Decrypter returns a [Decrypter] backed by the Key.
+func (k *Key) Decrypter(ctx context.Context) (Decrypter, error) {
+	return k.tpm.GetDecrypter(ctx, k.name)
+}
+
+// DecrypterWithPassword returns a [Decrypter] backed by the Key, using
+// `password` to authorize decrypting with it. The password is ignored if
+// the Key doesn't require one.
+func (k *Key) DecrypterWithPassword(ctx context.Context, password string) (Decrypter, error) {
+	return k.tpm.GetDecrypterWithPassword(ctx, k.name, password)
+}
+
+// CreateTSS2Decrypter returns a [Decrypter] using the given [TPM] and
+// [tss2.TPMKey]. The key must have been created with the decrypt attribute.
+func CreateTSS2Decrypter(ctx context.Context, t *TPM, key *tss2.TPMKey) (Decrypter, error) {
+	return CreateTSS2DecrypterWithPassword(ctx, t, key, "")
+}
+
+// CreateTSS2DecrypterWithPassword returns a [Decrypter] using the given
+// [TPM] and [tss2.TPMKey], using `password` to authorize decrypting with the
+// key. The policy in the [tss2.TPMKey] is satisfied on each call.
+func CreateTSS2DecrypterWithPassword(ctx context.Context, t *TPM, key *tss2.TPMKey, password string) (d Decrypter, err error) {
+	if err := t.open(goTPMCall(ctx)); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	dec, err := tss2.CreateDecrypter(t.rwc, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating TSS2 decrypter: %w", err)
+	}
+	dec.SetPassword(password)
+
+	d = &tss2Decrypter{
+		Decrypter: dec,
+		tpm:       t,
+	}
+
+	return
+}
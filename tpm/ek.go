@@ -9,16 +9,21 @@ import (
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/smallstep/go-attestation/attest"
+
+	"go.step.sm/crypto/tpm/storage"
 )
 
 // EK models a TPM Endorsement Key. The EK can be used to
@@ -146,8 +151,9 @@ func keyType(p crypto.PublicKey) string {
 // GetEKs returns a slice of TPM EKs. It will return an error
 // when interaction with the TPM fails. It will loop through
 // the TPM EKs and download the EK certificate if it's available
-// online. The TPM EKs don't change after the first lookup, so
-// the result is cached for future lookups.
+// online. Downloaded EK certificates are cached in the TPMStore,
+// so that they're only downloaded once. The TPM EKs don't change
+// after the first lookup, so the result is cached for future lookups.
 func (t *TPM) GetEKs(ctx context.Context) (eks []*EK, err error) {
 	if len(t.eks) > 0 {
 		return t.eks, nil
@@ -182,9 +188,9 @@ func (t *TPM) GetEKs(ctx context.Context) (eks []*EK, err error) {
 				return nil, fmt.Errorf("failed preparing EK certificate URL: %w", err)
 			}
 			ekURL = u.String()
-			ekCert, err = t.downloadEKCertificate(ctx, u)
+			ekCert, err = t.fetchEKCertificate(ctx, aek.Public, u)
 			if err != nil {
-				return nil, fmt.Errorf("failed downloading EK certificate: %w", err)
+				return nil, err
 			}
 		}
 
@@ -244,44 +250,352 @@ func (t *TPM) downloadEKCertificate(ctx context.Context, ekURL *url.URL) (*x509.
 	return t.downloader.downloadEKCertificate(ctx, ekURL)
 }
 
+// fetchEKCertificate returns the EK certificate for the EK public key `pub`.
+// The EK certificate is looked up in the TPMStore first. If it's not available
+// there, it's downloaded from ekURL and stored for future lookups.
+func (t *TPM) fetchEKCertificate(ctx context.Context, pub crypto.PublicKey, ekURL *url.URL) (*x509.Certificate, error) {
+	name, err := ekCertificateName(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	ekc, err := t.getCachedEKCertificate(name)
+	if err != nil {
+		return nil, err
+	}
+	if ekc != nil && len(ekc.Chain) > 0 {
+		return ekc.Chain[0], nil
+	}
+
+	ekCert, err := t.downloadEKCertificate(ctx, ekURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed downloading EK certificate: %w", err)
+	}
+	if ekCert == nil { // downloads are disabled
+		return nil, nil //nolint:nilnil // a nil *x509.Certificate is valid
+	}
+
+	if err := t.cacheEKCertificate(&storage.EKCertificate{
+		Name:      name,
+		URL:       ekURL.String(),
+		Chain:     []*x509.Certificate{ekCert},
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+
+	return ekCert, nil
+}
+
+// ekCertificateName returns the name used to store the EK certificate for
+// the EK public key `pub`. It is the hex encoded SHA256 of the public key,
+// which, unlike the EK fingerprint, is safe to use as a file name.
+func ekCertificateName(pub crypto.PublicKey) (string, error) {
+	id, err := generateKeyID(pub)
+	if err != nil {
+		return "", fmt.Errorf("failed generating EK public key ID: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// getCachedEKCertificate returns the EK certificate stored with `name`. It
+// returns nil if it's not available, or if there's no storage configured.
+func (t *TPM) getCachedEKCertificate(name string) (*storage.EKCertificate, error) {
+	ekc, err := t.store.GetEKCertificate(name)
+	switch {
+	case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrNoStorageConfigured):
+		return nil, nil //nolint:nilnil // a nil *storage.EKCertificate is valid
+	case err != nil:
+		return nil, fmt.Errorf("failed getting EK certificate from storage: %w", err)
+	default:
+		return ekc, nil
+	}
+}
+
+// cacheEKCertificate adds or updates the EK certificate in the TPMStore. It's
+// a noop if there's no storage configured.
+func (t *TPM) cacheEKCertificate(ekc *storage.EKCertificate) error {
+	err := t.store.UpdateEKCertificate(ekc)
+	if errors.Is(err, storage.ErrNotFound) {
+		err = t.store.AddEKCertificate(ekc)
+	}
+	switch {
+	case errors.Is(err, storage.ErrNoStorageConfigured):
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed storing EK certificate: %w", err)
+	}
+
+	if err := t.store.Persist(); err != nil {
+		return fmt.Errorf("failed persisting EK certificate: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyEKCertificate verifies the EK certificate against the root certificates
+// of the TPM manufacturer, configured using [WithEKRoots]. Only the AMD roots
+// are embedded in this package, so the roots of other manufacturers, like
+// Intel, Infineon, STMicroelectronics or Nuvoton, must be provided by the
+// caller using [WithEKRoots] to verify their EK certificates.
+//
+// Intermediate CA certificates are downloaded by following the issuing
+// certificate URLs in the Authority Information Access extension, which is how
+// Intel and AMD fTPM EK certificate chains are published. The verified chain
+// is cached in the TPMStore, so that the intermediates are only downloaded
+// once. It returns the verified chain, starting with the EK certificate and
+// ending with the manufacturer root.
+func (t *TPM) VerifyEKCertificate(ctx context.Context, ek *EK) (chain []*x509.Certificate, err error) {
+	if ek == nil || ek.certificate == nil {
+		return nil, errors.New("EK does not have a certificate")
+	}
+	if pub, ok := ek.public.(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(ek.certificate.PublicKey) {
+		return nil, errors.New("EK certificate does not match EK public key")
+	}
+
+	if err = t.open(ctx); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	info, err := t.Info(internalCall(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed getting TPM info: %w", err)
+	}
+
+	ekRoots := t.ekRoots
+	if ekRoots == nil {
+		if ekRoots, err = DefaultEKRoots(); err != nil {
+			return nil, err
+		}
+	}
+	roots := ekRoots.Get(info.Manufacturer.ID)
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("no EK roots available for TPM manufacturer %s", info.Manufacturer)
+	}
+
+	name, err := ekCertificateName(ek.public)
+	if err != nil {
+		return nil, err
+	}
+	ekc, err := t.getCachedEKCertificate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var intermediates []*x509.Certificate
+	if ekc != nil && len(ekc.Chain) > 0 && ekc.Chain[0].Equal(ek.certificate) {
+		intermediates = ekc.Chain[1:]
+	}
+
+	// verify with the cached intermediates first, and try again with
+	// downloaded intermediates if that fails.
+	chain, err = verifyEKCertificate(ek, roots, intermediates)
+	if err != nil {
+		if intermediates, err = t.downloader.downloadIntermediates(ctx, ek.certificate, roots); err != nil {
+			return nil, fmt.Errorf("failed downloading EK intermediate certificates: %w", err)
+		}
+		if chain, err = verifyEKCertificate(ek, roots, intermediates); err != nil {
+			return nil, err
+		}
+	}
+
+	createdAt := time.Now()
+	if ekc != nil {
+		createdAt = ekc.CreatedAt
+	}
+	if err := t.cacheEKCertificate(&storage.EKCertificate{
+		Name:      name,
+		URL:       ek.certificateURL,
+		Chain:     chain[:len(chain)-1], // the manufacturer root is not stored
+		CreatedAt: createdAt,
+	}); err != nil {
+		return nil, err
+	}
+
+	return chain, nil
+}
+
+// verifyEKCertificate verifies the EK certificate using the provided roots
+// and intermediates, and returns the first verified chain.
+func verifyEKCertificate(ek *EK, roots, intermediates []*x509.Certificate) ([]*x509.Certificate, error) {
+	rootPool := x509.NewCertPool()
+	for _, root := range roots {
+		rootPool.AddCert(root)
+	}
+	intermediatePool := x509.NewCertPool()
+	for _, intermediate := range intermediates {
+		intermediatePool.AddCert(intermediate)
+	}
+
+	return VerifyEKCertificateChain(ek.certificate, x509.VerifyOptions{
+		Roots:         rootPool,
+		Intermediates: intermediatePool,
+	})
+}
+
+// VerifyEKCertificateChain verifies an EK certificate using the roots,
+// intermediates and current time in opts, and returns the first verified
+// chain, starting with cert.
+//
+// EK certificates usually have an empty subject and a critical SAN with the
+// TPM manufacturer, model and version encoded as a directory name, which the
+// Go standard library doesn't handle, so the SAN is not considered an
+// unhandled critical extension. EK certificates are verified for any
+// extended key usage, and the KeyUsages in opts are ignored.
+func VerifyEKCertificateChain(cert *x509.Certificate, opts x509.VerifyOptions) ([]*x509.Certificate, error) {
+	if cert == nil {
+		return nil, errors.New("EK certificate cannot be nil")
+	}
+
+	c := *cert
+	c.UnhandledCriticalExtensions = nil
+	for _, oid := range cert.UnhandledCriticalExtensions {
+		if !oid.Equal(oidSubjectAlternativeName) {
+			c.UnhandledCriticalExtensions = append(c.UnhandledCriticalExtensions, oid)
+		}
+	}
+
+	opts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	chains, err := c.Verify(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed verifying EK certificate: %w", err)
+	}
+
+	chain := chains[0]
+	chain[0] = cert
+	return chain, nil
+}
+
 type intelEKCertResponse struct {
 	Pubhash     string `json:"pubhash"`
 	Certificate string `json:"certificate"`
 }
 
-// httpClient interface
-type httpClient interface {
+// HTTPClient is the interface used to download EK certificates and
+// their intermediate CA certificates. It's implemented by [*http.Client].
+type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+// maxCertificateSize is the maximum size of a downloaded intermediate CA
+// certificate. Certificates are usually around 1-2 KiB.
+const maxCertificateSize = 64 << 10
+
 type downloader struct {
 	enabled      bool
 	maxDownloads int
-	client       httpClient
+	client       HTTPClient
 }
 
-// downloadEKCertificate attempts to download the EK certificate from ekURL.
-func (d *downloader) downloadEKCertificate(ctx context.Context, ekURL *url.URL) (*x509.Certificate, error) {
-	if !d.enabled {
-		// if downloads are disabled, don't try to download at all
-		return nil, nil //nolint:nilnil // a nil *x509.Certificate is valid
-	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ekURL.String(), http.NoBody)
+// get performs an HTTP GET request to u. The caller must close the
+// body of the response.
+func (d *downloader) get(ctx context.Context, u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), http.NoBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed creating request: %w", err)
 	}
 
 	r, err := d.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed retrieving EK certificate from %q: %w", ekURL, err)
+		return nil, fmt.Errorf("failed retrieving certificate from %q: %w", u, err)
 	}
-	defer r.Body.Close()
 
 	if r.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http request to %q failed with status %d", ekURL, r.StatusCode)
+		r.Body.Close()
+		return nil, fmt.Errorf("http request to %q failed with status %d", u, r.StatusCode)
 	}
 
+	return r, nil
+}
+
+// downloadIntermediates downloads the intermediate CA certificates for cert
+// by following the issuing certificate URLs in the Authority Information
+// Access extension of the certificates. It stops when it finds a certificate
+// issued by one of the roots, or a self-signed certificate.
+func (d *downloader) downloadIntermediates(ctx context.Context, cert *x509.Certificate, roots []*x509.Certificate) ([]*x509.Certificate, error) {
+	if !d.enabled {
+		return nil, nil
+	}
+
+	var intermediates []*x509.Certificate
+	for i := 0; i < d.maxDownloads; i++ {
+		if isIssuedByAny(cert, roots) || len(cert.IssuingCertificateURL) == 0 {
+			return intermediates, nil
+		}
+
+		u, err := url.Parse(cert.IssuingCertificateURL[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing issuing certificate URL %q: %w", cert.IssuingCertificateURL[0], err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("issuing certificate URL %q has unsupported scheme %q", u, u.Scheme)
+		}
+		issuer, err := d.downloadCertificate(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(issuer.RawSubject, issuer.RawIssuer) { // the root is not an intermediate
+			return intermediates, nil
+		}
+
+		intermediates = append(intermediates, issuer)
+		cert = issuer
+	}
+
+	return nil, fmt.Errorf("number of intermediates bigger than the maximum allowed number (%d) of downloads", d.maxDownloads)
+}
+
+// downloadCertificate downloads a DER or PEM encoded certificate from u.
+func (d *downloader) downloadCertificate(ctx context.Context, u *url.URL) (*x509.Certificate, error) {
+	r, err := d.get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCertificateSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed reading response body: %w", err)
+	}
+	if len(body) > maxCertificateSize {
+		return nil, fmt.Errorf("certificate from %q is bigger than %d bytes", u, maxCertificateSize)
+	}
+	if block, _ := pem.Decode(body); block != nil && block.Type == "CERTIFICATE" {
+		body = block.Bytes
+	}
+
+	cert, err := x509.ParseCertificate(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing certificate from %q: %w", u, err)
+	}
+
+	return cert, nil
+}
+
+// isIssuedByAny returns whether cert is signed by one of the issuers.
+func isIssuedByAny(cert *x509.Certificate, issuers []*x509.Certificate) bool {
+	for _, issuer := range issuers {
+		if bytes.Equal(cert.RawIssuer, issuer.RawSubject) && cert.CheckSignatureFrom(issuer) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// downloadEKCertificate attempts to download the EK certificate from ekURL.
+func (d *downloader) downloadEKCertificate(ctx context.Context, ekURL *url.URL) (*x509.Certificate, error) {
+	if !d.enabled {
+		// if downloads are disabled, don't try to download at all
+		return nil, nil //nolint:nilnil // a nil *x509.Certificate is valid
+	}
+
+	r, err := d.get(ctx, ekURL)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+
 	var ekCert *x509.Certificate
 	switch {
 	case strings.Contains(ekURL.String(), "ekop.intel.com/ekcertservice"): // http and https work; http is redirected to https
@@ -9,6 +9,8 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
@@ -18,12 +20,14 @@ import (
 	"net/http"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/tpm/storage"
 	"go.step.sm/crypto/x509util"
 )
 
@@ -170,6 +174,211 @@ func Test_downloader_downloadEKCertifiate(t *testing.T) {
 	}
 }
 
+func newTestEKCertificate(t *testing.T, ca *minica.CA, pub crypto.PublicKey, aia ...string) *x509.Certificate {
+	t.Helper()
+
+	// EK certificates have an empty subject and a critical SAN with the
+	// TPM manufacturer, model and version encoded as a directory name.
+	dirName, err := asn1.Marshal(pkix.RDNSequence{
+		{{Type: asn1.ObjectIdentifier{2, 23, 133, 2, 1}, Value: "id:53494D30"}},
+		{{Type: asn1.ObjectIdentifier{2, 23, 133, 2, 2}, Value: "SIM"}},
+		{{Type: asn1.ObjectIdentifier{2, 23, 133, 2, 3}, Value: "id:00010000"}},
+	})
+	require.NoError(t, err)
+	san, err := asn1.Marshal([]asn1.RawValue{
+		{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: dirName},
+	})
+	require.NoError(t, err)
+
+	cert, err := ca.Sign(&x509.Certificate{
+		PublicKey:             pub,
+		IssuingCertificateURL: aia,
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidSubjectAlternativeName, Critical: true, Value: san},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []asn1.ObjectIdentifier{oidSubjectAlternativeName}, cert.UnhandledCriticalExtensions)
+	return cert
+}
+
+func Test_downloader_downloadIntermediates(t *testing.T) {
+	t.Parallel()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	signer, err := keyutil.GenerateSigner("EC", "P-256", 0)
+	require.NoError(t, err)
+
+	client := &mockClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			var body []byte
+			switch req.URL.String() {
+			case "https://ca.example.com/intermediate.der":
+				body = ca.Intermediate.Raw
+			case "https://ca.example.com/intermediate.pem":
+				body = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw})
+			case "https://ca.example.com/root.der":
+				body = ca.Root.Raw
+			case "https://ca.example.com/garbage":
+				body = []byte("garbage")
+			case "https://ca.example.com/large":
+				body = bytes.Repeat([]byte{0x30}, maxCertificateSize+1)
+			case "ldap://ca.example.com/intermediate", "file:///etc/intermediate.der":
+				t.Errorf("unexpected request to %q", req.URL)
+				body = ca.Intermediate.Raw
+			default:
+				return &http.Response{StatusCode: http.StatusNotFound, Body: http.NoBody}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewReader(body)),
+			}, nil
+		},
+	}
+
+	tests := []struct {
+		name       string
+		downloader *downloader
+		url        string
+		roots      []*x509.Certificate
+		want       []*x509.Certificate
+		assertion  assert.ErrorAssertionFunc
+	}{
+		{"ok", &downloader{enabled: true, maxDownloads: 10, client: client}, "https://ca.example.com/intermediate.der", []*x509.Certificate{ca.Root}, []*x509.Certificate{ca.Intermediate}, assert.NoError},
+		{"ok pem", &downloader{enabled: true, maxDownloads: 10, client: client}, "https://ca.example.com/intermediate.pem", []*x509.Certificate{ca.Root}, []*x509.Certificate{ca.Intermediate}, assert.NoError},
+		{"ok issued by root", &downloader{enabled: true, maxDownloads: 10, client: client}, "https://ca.example.com/intermediate.der", []*x509.Certificate{ca.Intermediate}, nil, assert.NoError},
+		{"ok self-signed", &downloader{enabled: true, maxDownloads: 10, client: client}, "https://ca.example.com/root.der", nil, nil, assert.NoError},
+		{"ok disabled", &downloader{enabled: false, maxDownloads: 10, client: client}, "https://ca.example.com/intermediate.der", nil, nil, assert.NoError},
+		{"fail max downloads", &downloader{enabled: true, maxDownloads: 0, client: client}, "https://ca.example.com/intermediate.der", nil, nil, assert.Error},
+		{"fail status", &downloader{enabled: true, maxDownloads: 10, client: client}, "https://ca.example.com/missing", nil, nil, assert.Error},
+		{"fail parse", &downloader{enabled: true, maxDownloads: 10, client: client}, "https://ca.example.com/garbage", nil, nil, assert.Error},
+		{"fail too large", &downloader{enabled: true, maxDownloads: 10, client: client}, "https://ca.example.com/large", nil, nil, assert.Error},
+		{"fail ldap scheme", &downloader{enabled: true, maxDownloads: 10, client: client}, "ldap://ca.example.com/intermediate", nil, nil, assert.Error},
+		{"fail file scheme", &downloader{enabled: true, maxDownloads: 10, client: client}, "file:///etc/intermediate.der", nil, nil, assert.Error},
+	}
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			cert := newTestEKCertificate(t, ca, signer.Public(), tc.url)
+			got, err := tc.downloader.downloadIntermediates(context.Background(), cert, tc.roots)
+			tc.assertion(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestTPM_fetchEKCertificate(t *testing.T) {
+	t.Parallel()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	signer, err := keyutil.GenerateSigner("RSA", "", 2048)
+	require.NoError(t, err)
+	ekCert := newTestEKCertificate(t, ca, signer.Public())
+	ekURL, err := url.Parse("https://ek.example.com/ek.der")
+	require.NoError(t, err)
+
+	var downloads int
+	client := &mockClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			downloads++
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewReader(ekCert.Raw)),
+			}, nil
+		},
+	}
+
+	store := storage.NewDirstore(t.TempDir())
+	instance := &TPM{
+		store:      store,
+		downloader: &downloader{enabled: true, maxDownloads: 10, client: client},
+	}
+
+	// the EK certificate is downloaded once, and then read from storage
+	for i := 0; i < 2; i++ {
+		got, err := instance.fetchEKCertificate(context.Background(), signer.Public(), ekURL)
+		require.NoError(t, err)
+		assert.Equal(t, ekCert, got)
+		assert.Equal(t, 1, downloads)
+	}
+
+	name, err := ekCertificateName(signer.Public())
+	require.NoError(t, err)
+	ekc, err := store.GetEKCertificate(name)
+	require.NoError(t, err)
+	assert.Equal(t, ekURL.String(), ekc.URL)
+	assert.Equal(t, []*x509.Certificate{ekCert}, ekc.Chain)
+
+	// without storage, the EK certificate is downloaded every time
+	instance.store = storage.BlackHole()
+	got, err := instance.fetchEKCertificate(context.Background(), signer.Public(), ekURL)
+	require.NoError(t, err)
+	assert.Equal(t, ekCert, got)
+	assert.Equal(t, 2, downloads)
+
+	instance.downloader.enabled = false
+	got, err = instance.fetchEKCertificate(context.Background(), signer.Public(), ekURL)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func Test_verifyEKCertificate(t *testing.T) {
+	t.Parallel()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	other, err := minica.New()
+	require.NoError(t, err)
+	signer, err := keyutil.GenerateSigner("EC", "P-256", 0)
+	require.NoError(t, err)
+
+	ek := &EK{
+		public:      signer.Public(),
+		certificate: newTestEKCertificate(t, ca, signer.Public()),
+	}
+
+	chain, err := verifyEKCertificate(ek, []*x509.Certificate{ca.Root}, []*x509.Certificate{ca.Intermediate})
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{ek.certificate, ca.Intermediate, ca.Root}, chain)
+	// the critical SAN is only ignored during verification
+	assert.Len(t, ek.certificate.UnhandledCriticalExtensions, 1)
+
+	_, err = verifyEKCertificate(ek, []*x509.Certificate{ca.Root}, nil)
+	assert.Error(t, err)
+	_, err = verifyEKCertificate(ek, []*x509.Certificate{other.Root}, []*x509.Certificate{ca.Intermediate})
+	assert.Error(t, err)
+}
+
+func TestVerifyEKCertificateChain(t *testing.T) {
+	t.Parallel()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	signer, err := keyutil.GenerateSigner("EC", "P-256", 0)
+	require.NoError(t, err)
+	cert := newTestEKCertificate(t, ca, signer.Public())
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Root)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(ca.Intermediate)
+
+	chain, err := VerifyEKCertificateChain(cert, x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{cert, ca.Intermediate, ca.Root}, chain)
+
+	_, err = VerifyEKCertificateChain(cert, x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   cert.NotAfter.Add(time.Minute),
+	})
+	assert.Error(t, err)
+	_, err = VerifyEKCertificateChain(nil, x509.VerifyOptions{Roots: roots})
+	assert.Error(t, err)
+}
+
 const (
 	// JSON response for https://ekop.intel.com/ekcertservice/WVEG2rRwkQ7m3RpXlUphgo6Y2HLxl18h6ZZkkOAdnBE%3D; also see https://github.com/tpm2-software/tpm2-tools/blob/master/test/integration/tests/getekcertificate.sh
 	intelEKMockResponse = `{"pubhash":"WVEG2rRwkQ7m3RpXlUphgo6Y2HLxl18h6ZZkkOAdnBE%3D","certificate":"MIIEnDCCBEOgAwIBAgIEfT80-DAKBggqhkjOPQQDAjCBlTELMAkGA1UEBgwCVVMxCzAJBgNVBAgMAkNBMRQwEgYDVQQHDAtTYW50YSBDbGFyYTEaMBgGA1UECgwRSW50ZWwgQ29ycG9yYXRpb24xLzAtBgNVBAsMJlRQTSBFSyBpbnRlcm1lZGlhdGUgZm9yIFNQVEhfRVBJRF9QUk9EMRYwFAYDVQQDDA13d3cuaW50ZWwuY29tMB4XDTE1MDUyMjAwMDAwMFoXDTQ5MTIzMTIzNTk1OVowADCCASIwDQYJKoZIhvcNAQEBBQADggEPADCCAQoCggEBAMMg4vJEqGAarPPgHSbGZSSZNVYt4doZfp5_B2xGlhPPtlPpjsLDhvwdEz8sjGzDOLcy8LIIvYOKh3o-W7w-HUCE6DXHyJBqHAW00tMP2-vB262VD6axZb1LaoZGAxRhZMDE9Z1IkBHvH5KN7qbpAGHz03XlZGJzFR72IiUgmL4aSrAdwKEiJ8YJ_azrEVr0CNRpOm9JkZd0aVsMErwYof9xIKczey-18ZUdi7fwlNW1VMEclSOzByn-ZHh9ChO55jBIjatN_YZjSlJw7HL8xaRNxnmo8yk43YGX4p2ug59bTKD13ifJUiwjxU4cLOV4WVJRGL1EcLGBgO73iuQme80CAwEAAaOCAkgwggJEMA8GA1UdEwEB_wQFMAMBAQAwDgYDVR0PAQH_BAQDAgAgMBAGA1UdJQQJMAcGBWeBBQgBMCQGA1UdCQEBAAQaMBgwFgYFZ4EFAhAxDTALDAMyLjACAQACAWcwUAYDVR0RAQH_BEYwRKRCMEAxFjAUBgVngQUCAQwLaWQ6NDk0RTU0NDMxDjAMBgVngQUCAgwDU1BUMRYwFAYFZ4EFAgMMC2lkOjAwMDIwMDAwMB8GA1UdIwQYMBaAFF5zyJqj6QKycrnwdB99hzDj7HJKMFgGA1UdHwRRME8wTaBLoEmGR2h0dHA6Ly91cGdyYWRlcy5pbnRlbC5jb20vY29udGVudC9DUkwvZWtjZXJ0L1NQVEhFUElEUFJPRF9FS19EZXZpY2UuY3JsMHAGCCsGAQUFBwEBBGQwYjBgBggrBgEFBQcwAoZUaHR0cDovL3VwZ3JhZGVzLmludGVsLmNvbS9jb250ZW50L0NSTC9la2NlcnQvU1BUSEVQSURQUk9EX0VLX1BsYXRmb3JtX1B1YmxpY19LZXkuY2VyMIGpBgNVHSAEgaEwgZ4wgZsGCiqGSIb4TQEFAgEwgYwwUgYIKwYBBQUHAgEWRmh0dHA6Ly91cGdyYWRlcy5pbnRlbC5jb20vY29udGVudC9DUkwvZWtjZXJ0L0VLY2VydFBvbGljeVN0YXRlbWVudC5wZGYwNgYIKwYBBQUHAgIwKgwoVENQQSBUcnVzdGVkIFBsYXRmb3JtIE1vZHVsZSBFbmRvcnNlbWVudDAKBggqhkjOPQQDAgNHADBEAiBrQr0ckEoWsrx0971bppP6N8PTb4U6z_hIqpS6o150xAIgNxZNXq7bCqU1b4hGdiSBauowiOVFcaaiTm1p99H_k1Q%3D"}`
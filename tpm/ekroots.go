@@ -0,0 +1,124 @@
+package tpm
+
+import (
+	"crypto/x509"
+	"embed"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"sync"
+
+	"go.step.sm/crypto/tpm/manufacturer"
+)
+
+// embeddedEKRoots contains the TPM manufacturer root certificates that
+// are used by default to verify EK certificates. The certificates are
+// stored in PEM format in a directory named after the hexadecimal
+// representation of the manufacturer ID, e.g. ekroots/414D4400/amdtpm.pem
+// for AMD. Currently only the AMD roots are embedded.
+//
+//go:embed ekroots
+var embeddedEKRoots embed.FS
+
+// EKRoots is a set of TPM manufacturer root certificates, keyed by
+// manufacturer ID, that is used to verify EK certificates. It is safe
+// for concurrent use.
+type EKRoots struct {
+	lock  sync.RWMutex
+	roots map[manufacturer.ID][]*x509.Certificate
+}
+
+// NewEKRoots returns an empty set of EK roots.
+func NewEKRoots() *EKRoots {
+	return &EKRoots{
+		roots: make(map[manufacturer.ID][]*x509.Certificate),
+	}
+}
+
+// DefaultEKRoots returns a new set of EK roots initialized with the
+// manufacturer root certificates embedded in this package. Only the AMD
+// roots are embedded, so the roots of other manufacturers, like Intel,
+// Infineon, STMicroelectronics or Nuvoton, must be obtained from the
+// manufacturer and added using [EKRoots.Add] or [EKRoots.AddPEM].
+func DefaultEKRoots() (*EKRoots, error) {
+	r := NewEKRoots()
+	err := fs.WalkDir(embeddedEKRoots, "ekroots", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		id, err := strconv.ParseUint(path.Base(path.Dir(name)), 16, 32)
+		if err != nil {
+			return fmt.Errorf("invalid manufacturer ID for %q: %w", name, err)
+		}
+		data, err := embeddedEKRoots.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("failed reading %q: %w", name, err)
+		}
+		if err := r.AddPEM(manufacturer.ID(id), data); err != nil {
+			return fmt.Errorf("failed adding %q: %w", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed loading embedded EK roots: %w", err)
+	}
+	return r, nil
+}
+
+// Add adds the root certificates for the manufacturer identified by `id`.
+func (r *EKRoots) Add(id manufacturer.ID, roots ...*x509.Certificate) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.roots[id] = append(r.roots[id], roots...)
+}
+
+// AddPEM adds the PEM encoded root certificates in `data` for the
+// manufacturer identified by `id`.
+func (r *EKRoots) AddPEM(id manufacturer.ID, data []byte) error {
+	var roots []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed parsing certificate: %w", err)
+		}
+		roots = append(roots, cert)
+	}
+	if len(roots) == 0 {
+		return errors.New("no certificates found")
+	}
+	r.Add(id, roots...)
+	return nil
+}
+
+// Get returns the root certificates for the manufacturer identified by `id`.
+func (r *EKRoots) Get(id manufacturer.ID) []*x509.Certificate {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return append([]*x509.Certificate(nil), r.roots[id]...)
+}
+
+// CertPool returns a [*x509.CertPool] with the root certificates for the
+// manufacturer identified by `id`. It returns nil if there are no root
+// certificates for the manufacturer.
+func (r *EKRoots) CertPool(id manufacturer.ID) *x509.CertPool {
+	roots := r.Get(id)
+	if len(roots) == 0 {
+		return nil
+	}
+	pool := x509.NewCertPool()
+	for _, root := range roots {
+		pool.AddCert(root)
+	}
+	return pool
+}
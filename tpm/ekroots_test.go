@@ -0,0 +1,62 @@
+package tpm
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/tpm/manufacturer"
+)
+
+func TestDefaultEKRoots(t *testing.T) {
+	roots, err := DefaultEKRoots()
+	require.NoError(t, err)
+
+	amd := roots.Get(0x414D4400) // AMD
+	require.Len(t, amd, 1)
+	assert.Equal(t, "AMDTPM", amd[0].Subject.CommonName)
+	assert.Equal(t, amd[0].RawSubject, amd[0].RawIssuer)
+	assert.NotNil(t, roots.CertPool(0x414D4400))
+
+	// every call returns a new set of roots
+	other, err := DefaultEKRoots()
+	require.NoError(t, err)
+	other.Add(0x414D4400, amd[0])
+	assert.Len(t, roots.Get(0x414D4400), 1)
+	assert.Len(t, other.Get(0x414D4400), 2)
+}
+
+func TestEKRoots(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	id := manufacturer.ID(0x53494D30) // SIM0
+
+	roots := NewEKRoots()
+	assert.Empty(t, roots.Get(id))
+	assert.Nil(t, roots.CertPool(id))
+
+	roots.Add(id, ca.Root)
+	assert.Equal(t, []*x509.Certificate{ca.Root}, roots.Get(id))
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte{1, 2, 3, 4}})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw})...)
+	require.NoError(t, roots.AddPEM(id, data))
+	assert.Equal(t, []*x509.Certificate{ca.Root, ca.Intermediate}, roots.Get(id))
+
+	pool := roots.CertPool(id)
+	require.NotNil(t, pool)
+	assert.True(t, pool.Equal(func() *x509.CertPool {
+		p := x509.NewCertPool()
+		p.AddCert(ca.Root)
+		p.AddCert(ca.Intermediate)
+		return p
+	}()))
+
+	assert.Error(t, roots.AddPEM(id, []byte("not a certificate")))
+	assert.Error(t, roots.AddPEM(id, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1, 2, 3, 4}})))
+	assert.Len(t, roots.Get(id), 2)
+}
@@ -0,0 +1,404 @@
+package eventlog
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// GUID is an EFI GUID in its binary representation.
+type GUID [16]byte
+
+func newGUID(a uint32, b, c uint16, d [8]byte) (g GUID) {
+	binary.LittleEndian.PutUint32(g[0:4], a)
+	binary.LittleEndian.PutUint16(g[4:6], b)
+	binary.LittleEndian.PutUint16(g[6:8], c)
+	copy(g[8:], d[:])
+	return
+}
+
+// String returns the GUID in the canonical textual representation.
+func (g GUID) String() string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(g[0:4]),
+		binary.LittleEndian.Uint16(g[4:6]),
+		binary.LittleEndian.Uint16(g[6:8]),
+		g[8:10], g[10:16])
+}
+
+var (
+	// EFIGlobalVariable is the vendor GUID of the UEFI global variables,
+	// like SecureBoot, PK and KEK.
+	EFIGlobalVariable = newGUID(0x8be4df61, 0x93ca, 0x11d2, [8]byte{0xaa, 0x0d, 0x00, 0xe0, 0x98, 0x03, 0x2b, 0x8c})
+	// EFIImageSecurityDatabase is the vendor GUID of the db and dbx
+	// variables.
+	EFIImageSecurityDatabase = newGUID(0xd719b2cb, 0x3d3a, 0x4596, [8]byte{0xa3, 0xbc, 0xda, 0xd0, 0x0e, 0x67, 0x65, 0x6f})
+
+	certX509GUID   = newGUID(0xa5c059a1, 0x94e4, 0x4aa7, [8]byte{0x87, 0xb5, 0xab, 0x15, 0x5c, 0x2b, 0xf0, 0x72})
+	certSHA256GUID = newGUID(0xc1c41626, 0x504c, 0x4092, [8]byte{0xac, 0xa9, 0x41, 0xf9, 0x36, 0x93, 0x43, 0x28})
+)
+
+// EFIVariable is an UEFI variable measured in the event log.
+type EFIVariable struct {
+	// Sequence is the position of the event in the log.
+	Sequence int
+	// PCR is the index of the PCR the event was extended into.
+	PCR int
+	// Type is the type of the event.
+	Type EventType
+	// VendorGUID is the vendor of the variable.
+	VendorGUID GUID
+	// Name is the name of the variable.
+	Name string
+	// Data is the value of the variable.
+	Data []byte
+}
+
+// EFIVariables returns the UEFI variables measured in the event log. The data
+// of every event is checked against its digest in the PCR `bank`, so the
+// result can be trusted once the PCRs in that bank have been verified using
+// Verify. Some firmware only measures the data of boot variables, in that
+// case the name and vendor of the variable are not covered by the digest.
+func (l *EventLog) EFIVariables(bank crypto.Hash) ([]EFIVariable, error) {
+	if !l.hasAlgorithm(bank) {
+		return nil, fmt.Errorf("event log does not contain %s digests", bank)
+	}
+
+	var vars []EFIVariable
+	for _, e := range l.Events {
+		switch e.Type {
+		case EFIVariableDriverConfig, EFIVariableBoot, EFIVariableBoot2, EFIVariableAuthority:
+			v, err := parseEFIVariable(e)
+			if err != nil {
+				return nil, err
+			}
+			if err := e.verifyVariable(bank, v); err != nil {
+				return nil, err
+			}
+			vars = append(vars, v)
+		}
+	}
+	return vars, nil
+}
+
+// parseEFIVariable parses the UEFI_VARIABLE_DATA of an event.
+func parseEFIVariable(e Event) (EFIVariable, error) {
+	const headerSize = 32
+	if len(e.Data) < headerSize {
+		return EFIVariable{}, fmt.Errorf("event %d: UEFI variable data is too short", e.Sequence)
+	}
+	nameLength := binary.LittleEndian.Uint64(e.Data[16:24])
+	dataLength := binary.LittleEndian.Uint64(e.Data[24:32])
+	rest := uint64(len(e.Data) - headerSize)
+	if nameLength > rest/2 || dataLength > rest-nameLength*2 {
+		return EFIVariable{}, fmt.Errorf("event %d: invalid UEFI variable data lengths", e.Sequence)
+	}
+
+	v := EFIVariable{
+		Sequence: e.Sequence,
+		PCR:      e.PCR,
+		Type:     e.Type,
+		Name:     decodeUTF16(e.Data[headerSize : headerSize+nameLength*2]),
+		Data:     e.Data[headerSize+nameLength*2 : headerSize+nameLength*2+dataLength],
+	}
+	copy(v.VendorGUID[:], e.Data[:16])
+	return v, nil
+}
+
+// SecureBootState is the Secure Boot configuration measured in PCR 7.
+type SecureBootState struct {
+	// Enabled is true if the SecureBoot variable is set.
+	Enabled bool
+	// PlatformKeys are the certificates in the PK variable.
+	PlatformKeys []*x509.Certificate
+	// KeyExchangeKeys are the certificates in the KEK variable.
+	KeyExchangeKeys []*x509.Certificate
+	// PermittedCertificates are the certificates in the db variable.
+	PermittedCertificates []*x509.Certificate
+	// PermittedHashes are the SHA-256 image hashes in the db variable.
+	PermittedHashes [][]byte
+	// ForbiddenCertificates are the certificates in the dbx variable.
+	ForbiddenCertificates []*x509.Certificate
+	// ForbiddenHashes are the SHA-256 image hashes in the dbx variable.
+	ForbiddenHashes [][]byte
+	// Authorities are the certificates used to verify the loaded boot
+	// components, as measured by EV_EFI_VARIABLE_AUTHORITY events.
+	Authorities []*x509.Certificate
+}
+
+// SecureBoot returns the Secure Boot state measured in PCR 7. The data of
+// every event used is checked against its digest in the PCR `bank`, so the
+// result can be trusted once PCR 7 in that bank has been verified using
+// Verify.
+func (l *EventLog) SecureBoot(bank crypto.Hash) (*SecureBootState, error) {
+	if !l.hasAlgorithm(bank) {
+		return nil, fmt.Errorf("event log does not contain %s digests", bank)
+	}
+
+	var found bool
+	state := new(SecureBootState)
+	for _, e := range l.Events {
+		if e.PCR != 7 || (e.Type != EFIVariableDriverConfig && e.Type != EFIVariableAuthority) {
+			continue
+		}
+		v, err := parseEFIVariable(e)
+		if err != nil {
+			return nil, err
+		}
+		if err := e.verifyVariable(bank, v); err != nil {
+			return nil, err
+		}
+
+		if e.Type == EFIVariableAuthority {
+			// The authority is an EFI_SIGNATURE_DATA, but some boot loaders
+			// log the certificate without the owner. Entries that are not
+			// certificates, like shim's SbatLevel, are ignored.
+			if cert, err := x509.ParseCertificate(v.Data); err == nil {
+				state.Authorities = append(state.Authorities, cert)
+			} else if len(v.Data) > 16 {
+				if cert, err := x509.ParseCertificate(v.Data[16:]); err == nil {
+					state.Authorities = append(state.Authorities, cert)
+				}
+			}
+			continue
+		}
+
+		var certs *[]*x509.Certificate
+		var hashes *[][]byte
+		switch {
+		case v.VendorGUID == EFIGlobalVariable && v.Name == "SecureBoot":
+			found = true
+			state.Enabled = len(v.Data) == 1 && v.Data[0] == 1
+			continue
+		case v.VendorGUID == EFIGlobalVariable && v.Name == "PK":
+			certs = &state.PlatformKeys
+		case v.VendorGUID == EFIGlobalVariable && v.Name == "KEK":
+			certs = &state.KeyExchangeKeys
+		case v.VendorGUID == EFIImageSecurityDatabase && v.Name == "db":
+			certs, hashes = &state.PermittedCertificates, &state.PermittedHashes
+		case v.VendorGUID == EFIImageSecurityDatabase && v.Name == "dbx":
+			certs, hashes = &state.ForbiddenCertificates, &state.ForbiddenHashes
+		default:
+			continue
+		}
+
+		c, h, err := parseSignatureLists(v.Data)
+		if err != nil {
+			return nil, fmt.Errorf("event %d: failed parsing %s: %w", e.Sequence, v.Name, err)
+		}
+		*certs = append(*certs, c...)
+		if hashes != nil {
+			*hashes = append(*hashes, h...)
+		}
+	}
+
+	if !found {
+		return nil, errors.New("event log does not contain the SecureBoot variable")
+	}
+
+	return state, nil
+}
+
+// parseSignatureLists parses a sequence of EFI_SIGNATURE_LIST structures and
+// returns the X.509 certificates and SHA-256 hashes in them. Other signature
+// types are ignored.
+func parseSignatureLists(data []byte) ([]*x509.Certificate, [][]byte, error) {
+	const headerSize = 28
+	var (
+		certs  []*x509.Certificate
+		hashes [][]byte
+	)
+	for len(data) > 0 {
+		if len(data) < headerSize {
+			return nil, nil, errors.New("signature list is too short")
+		}
+		var sigType GUID
+		copy(sigType[:], data[:16])
+		listSize := uint64(binary.LittleEndian.Uint32(data[16:20]))
+		sigHeaderSize := uint64(binary.LittleEndian.Uint32(data[20:24]))
+		sigSize := uint64(binary.LittleEndian.Uint32(data[24:28]))
+		if listSize < headerSize || listSize > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("invalid signature list size %d", listSize)
+		}
+		sigs := data[headerSize:listSize]
+		data = data[listSize:]
+
+		if sigHeaderSize > uint64(len(sigs)) {
+			return nil, nil, fmt.Errorf("invalid signature header size %d", sigHeaderSize)
+		}
+		sigs = sigs[sigHeaderSize:]
+		if sigSize <= 16 || uint64(len(sigs))%sigSize != 0 {
+			return nil, nil, fmt.Errorf("invalid signature size %d", sigSize)
+		}
+
+		for ; len(sigs) > 0; sigs = sigs[sigSize:] {
+			// Skip the owner of the signature.
+			sig := sigs[16:sigSize]
+			switch sigType {
+			case certX509GUID:
+				cert, err := x509.ParseCertificate(sig)
+				if err != nil {
+					return nil, nil, fmt.Errorf("failed parsing certificate: %w", err)
+				}
+				certs = append(certs, cert)
+			case certSHA256GUID:
+				if len(sig) != crypto.SHA256.Size() {
+					return nil, nil, fmt.Errorf("invalid SHA-256 signature size %d", len(sig))
+				}
+				hashes = append(hashes, sig)
+			}
+		}
+	}
+	return certs, hashes, nil
+}
+
+// BootApplication is an UEFI application loaded during boot, usually a boot
+// loader or a kernel.
+type BootApplication struct {
+	// Sequence is the position of the event in the log.
+	Sequence int
+	// PCR is the index of the PCR the event was extended into.
+	PCR int
+	// Digests are the Authenticode digests of the application image.
+	Digests map[crypto.Hash][]byte
+	// Path is the file path of the application, extracted from the device
+	// path. It can be empty.
+	Path string
+	// DevicePath is the raw UEFI device path of the application.
+	DevicePath []byte
+}
+
+// BootApplications returns the UEFI applications measured in the event log,
+// in load order. Only the digests are covered by the PCRs, the path is
+// informational.
+func (l *EventLog) BootApplications() ([]BootApplication, error) {
+	const headerSize = 32
+	var apps []BootApplication
+	for _, e := range l.Events {
+		if e.Type != EFIBootServicesApplication {
+			continue
+		}
+		// UEFI_IMAGE_LOAD_EVENT: ImageLocationInMemory, ImageLengthInMemory,
+		// ImageLinkTimeAddress, LengthOfDevicePath and DevicePath.
+		if len(e.Data) < headerSize {
+			return nil, fmt.Errorf("event %d: image load event is too short", e.Sequence)
+		}
+		size := binary.LittleEndian.Uint64(e.Data[24:32])
+		if size > uint64(len(e.Data)-headerSize) {
+			return nil, fmt.Errorf("event %d: invalid device path length %d", e.Sequence, size)
+		}
+		devicePath := e.Data[headerSize : headerSize+size]
+		path, err := filePath(devicePath)
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", e.Sequence, err)
+		}
+		apps = append(apps, BootApplication{
+			Sequence:   e.Sequence,
+			PCR:        e.PCR,
+			Digests:    e.Digests,
+			Path:       path,
+			DevicePath: devicePath,
+		})
+	}
+	return apps, nil
+}
+
+// filePath returns the path in the file path media nodes of an UEFI device
+// path.
+func filePath(devicePath []byte) (string, error) {
+	const (
+		mediaType          = 0x04
+		filePathSubType    = 0x04
+		endType            = 0x7f
+		endEntireSubType   = 0xff
+		nodeHeaderSize     = 4
+		pathSeparator      = `\`
+		maxDevicePathNodes = 256
+	)
+
+	var path string
+	for i := 0; len(devicePath) > 0; i++ {
+		if len(devicePath) < nodeHeaderSize || i == maxDevicePathNodes {
+			return "", errors.New("invalid device path")
+		}
+		typ, subType := devicePath[0], devicePath[1]
+		size := int(binary.LittleEndian.Uint16(devicePath[2:4]))
+		if size < nodeHeaderSize || size > len(devicePath) {
+			return "", fmt.Errorf("invalid device path node length %d", size)
+		}
+		if typ == endType && subType == endEntireSubType {
+			break
+		}
+		if typ == mediaType && subType == filePathSubType {
+			p := decodeUTF16(devicePath[nodeHeaderSize:size])
+			if path != "" && !strings.HasSuffix(path, pathSeparator) && !strings.HasPrefix(p, pathSeparator) {
+				path += pathSeparator
+			}
+			path += p
+		}
+		devicePath = devicePath[size:]
+	}
+	return path, nil
+}
+
+// verifyData checks that the event digest in the PCR `bank` is the hash of
+// the event data.
+func (e *Event) verifyData(bank crypto.Hash) error {
+	digest, ok := e.Digests[bank]
+	if !ok {
+		return fmt.Errorf("event %d does not have a %s digest", e.Sequence, bank)
+	}
+	h := bank.New()
+	h.Write(e.Data)
+	if !bytes.Equal(h.Sum(nil), digest) {
+		return fmt.Errorf("event %d: %s digest does not match the event data", e.Sequence, bank)
+	}
+	return nil
+}
+
+// verifyVariable checks the digest in the PCR `bank` of an event with the
+// UEFI variable `v`. The digest usually covers the whole UEFI_VARIABLE_DATA,
+// but some firmware only measures the variable data of boot variables, and old
+// versions of shim log an additional byte in authority events that is not
+// covered by the digest.
+func (e *Event) verifyVariable(bank crypto.Hash, v EFIVariable) error {
+	err := e.verifyData(bank)
+	if err == nil {
+		return nil
+	}
+	switch e.Type {
+	case EFIVariableBoot, EFIVariableBoot2:
+		h := bank.New()
+		h.Write(v.Data)
+		if bytes.Equal(h.Sum(nil), e.Digests[bank]) {
+			return nil
+		}
+	case EFIVariableAuthority:
+		if len(e.Data) > 0 {
+			trimmed := *e
+			trimmed.Data = e.Data[:len(e.Data)-1]
+			if trimmed.verifyData(bank) == nil {
+				return nil
+			}
+		}
+	}
+	return err
+}
+
+// decodeUTF16 decodes a little-endian UTF-16 string, removing the trailing
+// NUL characters.
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	for len(u) > 0 && u[len(u)-1] == 0 {
+		u = u[:len(u)-1]
+	}
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,255 @@
+package eventlog
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeUTF16(s string) []byte {
+	u := utf16.Encode([]rune(s + "\x00"))
+	b := make([]byte, len(u)*2)
+	for i, v := range u {
+		binary.LittleEndian.PutUint16(b[i*2:], v)
+	}
+	return b
+}
+
+// newTestVariable creates an UEFI_VARIABLE_DATA structure.
+func newTestVariable(guid GUID, name string, data []byte) []byte {
+	n := utf16.Encode([]rune(name))
+	b := make([]byte, 32, 32+len(n)*2+len(data))
+	copy(b, guid[:])
+	binary.LittleEndian.PutUint64(b[16:], uint64(len(n)))
+	binary.LittleEndian.PutUint64(b[24:], uint64(len(data)))
+	for _, v := range n {
+		b = binary.LittleEndian.AppendUint16(b, v)
+	}
+	return append(b, data...)
+}
+
+// newTestSignatureList creates an EFI_SIGNATURE_LIST with the given
+// signatures, all of them must have the same size.
+func newTestSignatureList(sigType GUID, sigs ...[]byte) []byte {
+	var owner [16]byte
+	sigSize := 16 + len(sigs[0])
+	b := make([]byte, 28, 28+len(sigs)*sigSize)
+	copy(b, sigType[:])
+	binary.LittleEndian.PutUint32(b[16:], uint32(28+len(sigs)*sigSize))
+	binary.LittleEndian.PutUint32(b[24:], uint32(sigSize))
+	for _, s := range sigs {
+		b = append(b, owner[:]...)
+		b = append(b, s...)
+	}
+	return b
+}
+
+func newTestImageLoadEvent(devicePath []byte) []byte {
+	b := make([]byte, 32, 32+len(devicePath))
+	binary.LittleEndian.PutUint64(b[24:], uint64(len(devicePath)))
+	return append(b, devicePath...)
+}
+
+func newTestDevicePathNode(typ, subType byte, data []byte) []byte {
+	b := []byte{typ, subType, 0, 0}
+	binary.LittleEndian.PutUint16(b[2:], uint16(4+len(data)))
+	return append(b, data...)
+}
+
+func mustCertificate(t *testing.T, cn string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestGUID_String(t *testing.T) {
+	assert.Equal(t, "8be4df61-93ca-11d2-aa0d-00e098032b8c", EFIGlobalVariable.String())
+	assert.Equal(t, "d719b2cb-3d3a-4596-a3bc-dad00e67656f", EFIImageSecurityDatabase.String())
+}
+
+func TestEventLog_EFIVariables(t *testing.T) {
+	l := mustReadLog(t, "ubuntu_2104_shielded_vm_no_secure_boot_eventlog")
+	vars, err := l.EFIVariables(crypto.SHA256)
+	require.NoError(t, err)
+
+	names := make([]string, len(vars))
+	for i, v := range vars {
+		names[i] = v.Name
+	}
+	assert.Equal(t, []string{
+		"SecureBoot", "PK", "KEK", "db", "dbx", "BootOrder",
+		"Boot0003", "Boot0000", "Boot0001", "Boot0002", "SbatLevel",
+	}, names)
+	assert.Equal(t, EFIGlobalVariable, vars[0].VendorGUID)
+	assert.Equal(t, EFIVariableDriverConfig, vars[0].Type)
+	assert.Equal(t, 7, vars[0].PCR)
+	assert.Equal(t, []byte{0}, vars[0].Data)
+
+	l, err = Parse(newTestLog(t, []crypto.Hash{crypto.SHA256},
+		testEvent{7, EFIVariableDriverConfig, []byte("short")},
+	))
+	require.NoError(t, err)
+	_, err = l.EFIVariables(crypto.SHA256)
+	assert.Error(t, err)
+
+	invalid := newTestVariable(EFIGlobalVariable, "SecureBoot", []byte{1})
+	binary.LittleEndian.PutUint64(invalid[24:], 100)
+	l, err = Parse(newTestLog(t, []crypto.Hash{crypto.SHA256},
+		testEvent{7, EFIVariableDriverConfig, invalid},
+	))
+	require.NoError(t, err)
+	_, err = l.EFIVariables(crypto.SHA256)
+	assert.Error(t, err)
+
+	// The data of the variables must match the digests.
+	l, err = Parse(newTestLog(t, []crypto.Hash{crypto.SHA256},
+		testEvent{7, EFIVariableDriverConfig, newTestVariable(EFIGlobalVariable, "SecureBoot", []byte{0})},
+	))
+	require.NoError(t, err)
+	_, err = l.EFIVariables(crypto.SHA384)
+	assert.Error(t, err)
+	vars, err = l.EFIVariables(crypto.SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0}, vars[0].Data)
+
+	l.Events[1].Data = newTestVariable(EFIGlobalVariable, "SecureBoot", []byte{1})
+	_, err = l.EFIVariables(crypto.SHA256)
+	assert.Error(t, err)
+}
+
+func TestEventLog_SecureBoot(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		counts  []int
+	}{
+		{"sb_cert_eventlog", true, []int{1, 1, 4, 0, 0, 77, 3}},
+		{"ubuntu_2104_shielded_vm_no_secure_boot_eventlog", false, []int{1, 1, 2, 0, 3, 183, 0}},
+		{"crypto_agile_eventlog", false, []int{1, 1, 3, 0, 0, 77, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := mustReadLog(t, tt.name)
+			state, err := l.SecureBoot(crypto.SHA256)
+			require.NoError(t, err)
+			assert.Equal(t, tt.enabled, state.Enabled)
+			assert.Equal(t, tt.counts, []int{
+				len(state.PlatformKeys), len(state.KeyExchangeKeys),
+				len(state.PermittedCertificates), len(state.PermittedHashes),
+				len(state.ForbiddenCertificates), len(state.ForbiddenHashes),
+				len(state.Authorities),
+			})
+		})
+	}
+
+	pk := mustCertificate(t, "PK")
+	db := mustCertificate(t, "db")
+	hash := bytes.Repeat([]byte{1}, 32)
+	authority := append(make([]byte, 16), db.Raw...)
+	banks := []crypto.Hash{crypto.SHA1, crypto.SHA256}
+	events := []testEvent{
+		{7, EFIVariableDriverConfig, newTestVariable(EFIGlobalVariable, "SecureBoot", []byte{1})},
+		{7, EFIVariableDriverConfig, newTestVariable(EFIGlobalVariable, "PK", newTestSignatureList(certX509GUID, pk.Raw))},
+		{7, EFIVariableDriverConfig, newTestVariable(EFIImageSecurityDatabase, "db", append(
+			newTestSignatureList(certX509GUID, db.Raw),
+			newTestSignatureList(certSHA256GUID, hash)...,
+		))},
+		{7, Separator, []byte{0, 0, 0, 0}},
+		{7, EFIVariableAuthority, newTestVariable(EFIImageSecurityDatabase, "db", authority)},
+		{7, EFIVariableAuthority, newTestVariable(GUID{1}, "SbatLevel", []byte("sbat,1\n"))},
+	}
+	l, err := Parse(newTestLog(t, banks, events...))
+	require.NoError(t, err)
+
+	state, err := l.SecureBoot(crypto.SHA1)
+	require.NoError(t, err)
+	assert.Equal(t, &SecureBootState{
+		Enabled:               true,
+		PlatformKeys:          []*x509.Certificate{pk},
+		PermittedCertificates: []*x509.Certificate{db},
+		PermittedHashes:       [][]byte{hash},
+		Authorities:           []*x509.Certificate{db},
+	}, state)
+
+	_, err = l.SecureBoot(crypto.SHA384)
+	assert.Error(t, err)
+
+	// The data of the events must match the digests.
+	l.Events[1].Data = newTestVariable(EFIGlobalVariable, "SecureBoot", []byte{0})
+	_, err = l.SecureBoot(crypto.SHA256)
+	assert.Error(t, err)
+
+	l, err = Parse(newTestLog(t, banks, events[1:]...))
+	require.NoError(t, err)
+	_, err = l.SecureBoot(crypto.SHA256)
+	assert.Error(t, err)
+
+	l, err = Parse(newTestLog(t, banks, testEvent{7, EFIVariableDriverConfig, newTestVariable(EFIGlobalVariable, "PK", []byte("invalid"))}))
+	require.NoError(t, err)
+	_, err = l.SecureBoot(crypto.SHA256)
+	assert.Error(t, err)
+}
+
+func TestEventLog_BootApplications(t *testing.T) {
+	l := mustReadLog(t, "ubuntu_2104_shielded_vm_no_secure_boot_eventlog")
+	apps, err := l.BootApplications()
+	require.NoError(t, err)
+	require.Len(t, apps, 2)
+	assert.Equal(t, `\EFI\ubuntu\shimx64.efi`, apps[0].Path)
+	assert.Equal(t, `\EFI\ubuntu\grubx64.efi`, apps[1].Path)
+	assert.Equal(t, 4, apps[0].PCR)
+	assert.Len(t, apps[0].Digests[crypto.SHA256], 32)
+
+	devicePath := append(append(append(
+		newTestDevicePathNode(0x04, 0x01, make([]byte, 38)), // hard drive
+		newTestDevicePathNode(0x04, 0x04, encodeUTF16(`\EFI`))...),
+		newTestDevicePathNode(0x04, 0x04, encodeUTF16(`BOOT\BOOTX64.EFI`))...),
+		newTestDevicePathNode(0x7f, 0xff, nil)...)
+	l, err = Parse(newTestLog(t, []crypto.Hash{crypto.SHA256},
+		testEvent{4, EFIBootServicesApplication, newTestImageLoadEvent(devicePath)},
+		testEvent{4, EFIBootServicesApplication, newTestImageLoadEvent(nil)},
+	))
+	require.NoError(t, err)
+	apps, err = l.BootApplications()
+	require.NoError(t, err)
+	require.Len(t, apps, 2)
+	assert.Equal(t, `\EFI\BOOT\BOOTX64.EFI`, apps[0].Path)
+	assert.Equal(t, devicePath, apps[0].DevicePath)
+	assert.Equal(t, 1, apps[0].Sequence)
+	assert.Empty(t, apps[1].Path)
+
+	for _, data := range [][]byte{
+		[]byte("short"),
+		append(newTestImageLoadEvent(nil)[:24], 0xff, 0, 0, 0, 0, 0, 0, 0),
+		newTestImageLoadEvent([]byte{0x04, 0x04, 0xff, 0x00}),
+		newTestImageLoadEvent([]byte{0x04, 0x04}),
+	} {
+		l, err = Parse(newTestLog(t, []crypto.Hash{crypto.SHA256}, testEvent{4, EFIBootServicesApplication, data}))
+		require.NoError(t, err)
+		_, err = l.BootApplications()
+		assert.Error(t, err)
+	}
+}
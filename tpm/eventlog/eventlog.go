@@ -0,0 +1,489 @@
+// Package eventlog implements parsing of TCG PC Client event logs, as
+// produced by firmware and exposed by the operating system, and replaying
+// them to compute the expected values of the PCRs.
+//
+// Both the legacy SHA-1 log format and the crypto-agile log format described
+// in the TCG PC Client Platform Firmware Profile Specification are supported.
+//
+// The contents of an event log are not trustworthy by themselves. Only after
+// the log has been replayed and verified against PCR values obtained from a
+// verified quote (see tpm.VerifyQuote), the events in the verified PCRs can
+// be used to make decisions about the state of a platform.
+package eventlog
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha1" //nolint:gosec // SHA-1 PCR bank
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.step.sm/crypto/tpm"
+)
+
+// numPCRs is the number of PCRs in a TPM 2.0 PCR bank.
+const numPCRs = 24
+
+// EventType is the type of an event in the event log.
+type EventType uint32
+
+// Event types defined in the TCG PC Client Platform Firmware Profile
+// Specification.
+const (
+	PrebootCert                EventType = 0x00000000
+	PostCode                   EventType = 0x00000001
+	NoAction                   EventType = 0x00000003
+	Separator                  EventType = 0x00000004
+	Action                     EventType = 0x00000005
+	EventTag                   EventType = 0x00000006
+	SCRTMContents              EventType = 0x00000007
+	SCRTMVersion               EventType = 0x00000008
+	CPUMicrocode               EventType = 0x00000009
+	PlatformConfigFlags        EventType = 0x0000000A
+	TableOfDevices             EventType = 0x0000000B
+	CompactHash                EventType = 0x0000000C
+	IPL                        EventType = 0x0000000D
+	IPLPartitionData           EventType = 0x0000000E
+	NonhostCode                EventType = 0x0000000F
+	NonhostConfig              EventType = 0x00000010
+	NonhostInfo                EventType = 0x00000011
+	OmitBootDeviceEvents       EventType = 0x00000012
+	EFIVariableDriverConfig    EventType = 0x80000001
+	EFIVariableBoot            EventType = 0x80000002
+	EFIBootServicesApplication EventType = 0x80000003
+	EFIBootServicesDriver      EventType = 0x80000004
+	EFIRuntimeServicesDriver   EventType = 0x80000005
+	EFIGPTEvent                EventType = 0x80000006
+	EFIAction                  EventType = 0x80000007
+	EFIPlatformFirmwareBlob    EventType = 0x80000008
+	EFIHandoffTables           EventType = 0x80000009
+	EFIPlatformFirmwareBlob2   EventType = 0x8000000A
+	EFIHandoffTables2          EventType = 0x8000000B
+	EFIVariableBoot2           EventType = 0x8000000C
+	EFIHCRTMEvent              EventType = 0x80000010
+	EFIVariableAuthority       EventType = 0x800000E0
+	EFISPDMFirmwareBlob        EventType = 0x800000E1
+	EFISPDMFirmwareConfig      EventType = 0x800000E2
+	EFISPDMDevicePolicy        EventType = 0x800000E3
+	EFISPDMDeviceAuthority     EventType = 0x800000E4
+)
+
+var eventTypeNames = map[EventType]string{
+	PrebootCert:                "EV_PREBOOT_CERT",
+	PostCode:                   "EV_POST_CODE",
+	NoAction:                   "EV_NO_ACTION",
+	Separator:                  "EV_SEPARATOR",
+	Action:                     "EV_ACTION",
+	EventTag:                   "EV_EVENT_TAG",
+	SCRTMContents:              "EV_S_CRTM_CONTENTS",
+	SCRTMVersion:               "EV_S_CRTM_VERSION",
+	CPUMicrocode:               "EV_CPU_MICROCODE",
+	PlatformConfigFlags:        "EV_PLATFORM_CONFIG_FLAGS",
+	TableOfDevices:             "EV_TABLE_OF_DEVICES",
+	CompactHash:                "EV_COMPACT_HASH",
+	IPL:                        "EV_IPL",
+	IPLPartitionData:           "EV_IPL_PARTITION_DATA",
+	NonhostCode:                "EV_NONHOST_CODE",
+	NonhostConfig:              "EV_NONHOST_CONFIG",
+	NonhostInfo:                "EV_NONHOST_INFO",
+	OmitBootDeviceEvents:       "EV_OMIT_BOOT_DEVICE_EVENTS",
+	EFIVariableDriverConfig:    "EV_EFI_VARIABLE_DRIVER_CONFIG",
+	EFIVariableBoot:            "EV_EFI_VARIABLE_BOOT",
+	EFIBootServicesApplication: "EV_EFI_BOOT_SERVICES_APPLICATION",
+	EFIBootServicesDriver:      "EV_EFI_BOOT_SERVICES_DRIVER",
+	EFIRuntimeServicesDriver:   "EV_EFI_RUNTIME_SERVICES_DRIVER",
+	EFIGPTEvent:                "EV_EFI_GPT_EVENT",
+	EFIAction:                  "EV_EFI_ACTION",
+	EFIPlatformFirmwareBlob:    "EV_EFI_PLATFORM_FIRMWARE_BLOB",
+	EFIHandoffTables:           "EV_EFI_HANDOFF_TABLES",
+	EFIPlatformFirmwareBlob2:   "EV_EFI_PLATFORM_FIRMWARE_BLOB2",
+	EFIHandoffTables2:          "EV_EFI_HANDOFF_TABLES2",
+	EFIVariableBoot2:           "EV_EFI_VARIABLE_BOOT2",
+	EFIHCRTMEvent:              "EV_EFI_HCRTM_EVENT",
+	EFIVariableAuthority:       "EV_EFI_VARIABLE_AUTHORITY",
+	EFISPDMFirmwareBlob:        "EV_EFI_SPDM_FIRMWARE_BLOB",
+	EFISPDMFirmwareConfig:      "EV_EFI_SPDM_FIRMWARE_CONFIG",
+	EFISPDMDevicePolicy:        "EV_EFI_SPDM_DEVICE_POLICY",
+	EFISPDMDeviceAuthority:     "EV_EFI_SPDM_DEVICE_AUTHORITY",
+}
+
+// String returns the name of the event type as defined in the
+// specification.
+func (t EventType) String() string {
+	if s, ok := eventTypeNames[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("EventType(0x%x)", uint32(t))
+}
+
+// TPM_ALG_ID values of the digest algorithms in the event log.
+const (
+	algSHA1   uint16 = 0x0004
+	algSHA256 uint16 = 0x000B
+	algSHA384 uint16 = 0x000C
+	algSHA512 uint16 = 0x000D
+)
+
+var hashAlgs = map[uint16]crypto.Hash{
+	algSHA1:   crypto.SHA1,
+	algSHA256: crypto.SHA256,
+	algSHA384: crypto.SHA384,
+	algSHA512: crypto.SHA512,
+}
+
+var (
+	specIDSignature = []byte("Spec ID Event03\x00")
+	startupLocality = []byte("StartupLocality\x00")
+)
+
+// maxAlgorithms is the maximum number of digest algorithms accepted in the
+// spec ID event.
+const maxAlgorithms = 16
+
+// Event is a single measurement in the event log.
+type Event struct {
+	// Sequence is the position of the event in the log.
+	Sequence int
+	// PCR is the index of the PCR the event was extended into.
+	PCR int
+	// Type is the type of the event.
+	Type EventType
+	// Digests are the digests extended into each PCR bank.
+	Digests map[crypto.Hash][]byte
+	// Data is the raw event data. Depending on the event type, the data
+	// might not be covered by the digests.
+	Data []byte
+}
+
+// EventLog is a parsed TCG PC Client event log.
+type EventLog struct {
+	// Algorithms are the PCR banks with digests in the log.
+	Algorithms []crypto.Hash
+	// Events are all the events in the log, in order.
+	Events []Event
+}
+
+// legacyEventHeader is the header of a TCG_PCR_EVENT.
+type legacyEventHeader struct {
+	PCRIndex  uint32
+	EventType uint32
+	Digest    [20]byte
+	EventSize uint32
+}
+
+// specIDEventHeader is the fixed size part of a TCG_EfiSpecIDEvent.
+type specIDEventHeader struct {
+	Signature          [16]byte
+	PlatformClass      uint32
+	SpecVersionMinor   uint8
+	SpecVersionMajor   uint8
+	SpecErrata         uint8
+	UintnSize          uint8
+	NumberOfAlgorithms uint32
+}
+
+type specIDAlgorithm struct {
+	AlgorithmID uint16
+	DigestSize  uint16
+}
+
+// Parse parses an event log in either the legacy SHA-1 format or the
+// crypto-agile format.
+func Parse(data []byte) (*EventLog, error) {
+	r := bytes.NewReader(data)
+
+	first, err := readLegacyEvent(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing first event: %w", err)
+	}
+
+	if first.Type != NoAction || !bytes.HasPrefix(first.Data, specIDSignature) {
+		log := &EventLog{
+			Algorithms: []crypto.Hash{crypto.SHA1},
+			Events:     []Event{first},
+		}
+		for r.Len() > 0 {
+			e, err := readLegacyEvent(r)
+			if err != nil {
+				return nil, fmt.Errorf("failed parsing event %d: %w", len(log.Events), err)
+			}
+			e.Sequence = len(log.Events)
+			log.Events = append(log.Events, e)
+		}
+		return log, nil
+	}
+
+	sizes, err := parseSpecIDEvent(first.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing spec ID event: %w", err)
+	}
+
+	log := &EventLog{
+		Events: []Event{first},
+	}
+	for alg := range sizes {
+		if h, ok := hashAlgs[alg]; ok {
+			log.Algorithms = append(log.Algorithms, h)
+		}
+	}
+	sort.Slice(log.Algorithms, func(i, j int) bool {
+		return log.Algorithms[i] < log.Algorithms[j]
+	})
+
+	for r.Len() > 0 {
+		e, err := readEvent2(r, sizes)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing event %d: %w", len(log.Events), err)
+		}
+		e.Sequence = len(log.Events)
+		log.Events = append(log.Events, e)
+	}
+
+	return log, nil
+}
+
+func readLegacyEvent(r *bytes.Reader) (Event, error) {
+	var h legacyEventHeader
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return Event{}, fmt.Errorf("failed reading event header: %w", err)
+	}
+	data, err := readData(r, h.EventSize)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		PCR:     int(h.PCRIndex),
+		Type:    EventType(h.EventType),
+		Digests: map[crypto.Hash][]byte{crypto.SHA1: h.Digest[:]},
+		Data:    data,
+	}, nil
+}
+
+func readEvent2(r *bytes.Reader, sizes map[uint16]uint16) (Event, error) {
+	var h struct {
+		PCRIndex  uint32
+		EventType uint32
+		Count     uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return Event{}, fmt.Errorf("failed reading event header: %w", err)
+	}
+	if h.Count > uint32(len(sizes)) {
+		return Event{}, fmt.Errorf("event has %d digests, but the log has %d algorithms", h.Count, len(sizes))
+	}
+
+	digests := make(map[crypto.Hash][]byte, h.Count)
+	for i := uint32(0); i < h.Count; i++ {
+		var alg uint16
+		if err := binary.Read(r, binary.LittleEndian, &alg); err != nil {
+			return Event{}, fmt.Errorf("failed reading digest algorithm: %w", err)
+		}
+		size, ok := sizes[alg]
+		if !ok {
+			return Event{}, fmt.Errorf("digest algorithm 0x%x is not in the spec ID event", alg)
+		}
+		digest, err := readData(r, uint32(size))
+		if err != nil {
+			return Event{}, err
+		}
+		// Digests of algorithms not known by this package are skipped.
+		if hash, ok := hashAlgs[alg]; ok {
+			digests[hash] = digest
+		}
+	}
+
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return Event{}, fmt.Errorf("failed reading event size: %w", err)
+	}
+	data, err := readData(r, size)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		PCR:     int(h.PCRIndex),
+		Type:    EventType(h.EventType),
+		Digests: digests,
+		Data:    data,
+	}, nil
+}
+
+func readData(r *bytes.Reader, size uint32) ([]byte, error) {
+	if int64(size) > int64(r.Len()) {
+		return nil, fmt.Errorf("event data size %d exceeds the remaining %d bytes", size, r.Len())
+	}
+	data := make([]byte, size)
+	if _, err := r.Read(data); err != nil && size > 0 {
+		return nil, fmt.Errorf("failed reading event data: %w", err)
+	}
+	return data, nil
+}
+
+// parseSpecIDEvent parses a TCG_EfiSpecIDEvent and returns the digest size
+// of each algorithm in the log.
+func parseSpecIDEvent(data []byte) (map[uint16]uint16, error) {
+	r := bytes.NewReader(data)
+	var h specIDEventHeader
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("failed reading header: %w", err)
+	}
+	if h.NumberOfAlgorithms == 0 || h.NumberOfAlgorithms > maxAlgorithms {
+		return nil, fmt.Errorf("invalid number of algorithms %d", h.NumberOfAlgorithms)
+	}
+
+	sizes := make(map[uint16]uint16, h.NumberOfAlgorithms)
+	for i := uint32(0); i < h.NumberOfAlgorithms; i++ {
+		var alg specIDAlgorithm
+		if err := binary.Read(r, binary.LittleEndian, &alg); err != nil {
+			return nil, fmt.Errorf("failed reading algorithm: %w", err)
+		}
+		if hash, ok := hashAlgs[alg.AlgorithmID]; ok && int(alg.DigestSize) != hash.Size() {
+			return nil, fmt.Errorf("invalid digest size %d for %s", alg.DigestSize, hash)
+		}
+		sizes[alg.AlgorithmID] = alg.DigestSize
+	}
+
+	return sizes, nil
+}
+
+// isStartupLocality returns the locality and true if the event is a
+// StartupLocality event. It sets the initial value of PCR 0.
+func (e *Event) isStartupLocality() (byte, bool) {
+	if e.Type != NoAction || e.PCR != 0 || len(e.Data) != len(startupLocality)+1 || !bytes.HasPrefix(e.Data, startupLocality) {
+		return 0, false
+	}
+	return e.Data[len(startupLocality)], true
+}
+
+// Replay extends the digests of all the events in the PCR `bank` and returns
+// the resulting value of each PCR with events in the log, ordered by index.
+// The result can be used as the expected PCR values in tpm.VerifyQuote.
+func (l *EventLog) Replay(bank crypto.Hash) ([]tpm.PCR, error) {
+	if !l.hasAlgorithm(bank) {
+		return nil, fmt.Errorf("event log does not contain %s digests", bank)
+	}
+	if !bank.Available() {
+		return nil, fmt.Errorf("hash %s is not available", bank)
+	}
+
+	locality := l.startupLocality()
+
+	values := make(map[int][]byte)
+	for _, e := range l.Events {
+		if e.Type == NoAction {
+			continue
+		}
+		if e.PCR < 0 || e.PCR >= numPCRs {
+			return nil, fmt.Errorf("event %d has invalid PCR index %d", e.Sequence, e.PCR)
+		}
+		digest, ok := e.Digests[bank]
+		if !ok {
+			return nil, fmt.Errorf("event %d does not have a %s digest", e.Sequence, bank)
+		}
+		v, ok := values[e.PCR]
+		if !ok {
+			v = resetValue(bank, e.PCR, locality)
+		}
+		h := bank.New()
+		h.Write(v)
+		h.Write(digest)
+		values[e.PCR] = h.Sum(nil)
+	}
+
+	pcrs := make([]tpm.PCR, 0, len(values))
+	for i, v := range values {
+		pcrs = append(pcrs, tpm.PCR{
+			Index:           i,
+			Digest:          v,
+			DigestAlgorithm: bank,
+		})
+	}
+	sort.Slice(pcrs, func(i, j int) bool {
+		return pcrs[i].Index < pcrs[j].Index
+	})
+
+	return pcrs, nil
+}
+
+// Verify replays the event log and checks the result against the given PCR
+// values, usually the PCRs of a verified quote. Every given PCR is checked,
+// PCRs without events in the log must have their reset value, all ones for
+// PCRs 17 to 22 and zeros, or the startup locality for PCR 0, for the rest. If
+// a PCR does not have the value computed from the log a *tpm.PCRMismatchError
+// is returned.
+func (l *EventLog) Verify(pcrs []tpm.PCR) error {
+	if len(pcrs) == 0 {
+		return errors.New("no PCRs provided")
+	}
+
+	locality := l.startupLocality()
+	replayed := make(map[crypto.Hash]map[int][]byte)
+	for _, p := range pcrs {
+		values, ok := replayed[p.DigestAlgorithm]
+		if !ok {
+			r, err := l.Replay(p.DigestAlgorithm)
+			if err != nil {
+				return err
+			}
+			values = make(map[int][]byte, len(r))
+			for _, v := range r {
+				values[v.Index] = v.Digest
+			}
+			replayed[p.DigestAlgorithm] = values
+		}
+		expected, ok := values[p.Index]
+		if !ok {
+			if p.Index < 0 || p.Index >= numPCRs {
+				return fmt.Errorf("invalid PCR index %d", p.Index)
+			}
+			expected = resetValue(p.DigestAlgorithm, p.Index, locality)
+			// The dynamic PCRs start with all ones, and they are only
+			// reset to zeros by a dynamic launch, that logs events.
+			if p.Index >= 17 && p.Index <= 22 {
+				expected = bytes.Repeat([]byte{0xff}, p.DigestAlgorithm.Size())
+			}
+		}
+		if !bytes.Equal(expected, p.Digest) {
+			return &tpm.PCRMismatchError{Index: p.Index, Expected: expected, Actual: p.Digest}
+		}
+	}
+
+	return nil
+}
+
+// startupLocality returns the locality in the StartupLocality event, or 0 if
+// the log does not have one.
+func (l *EventLog) startupLocality() byte {
+	var locality byte
+	for i := range l.Events {
+		if v, ok := l.Events[i].isStartupLocality(); ok {
+			locality = v
+		}
+	}
+	return locality
+}
+
+// resetValue returns the value of a PCR before the first event in the log is
+// extended. PCRs start with zeros, except PCR 0 that gets the startup locality
+// in the last byte.
+func resetValue(bank crypto.Hash, index int, locality byte) []byte {
+	v := make([]byte, bank.Size())
+	if index == 0 {
+		v[len(v)-1] = locality
+	}
+	return v
+}
+
+func (l *EventLog) hasAlgorithm(h crypto.Hash) bool {
+	for _, a := range l.Algorithms {
+		if a == h {
+			return true
+		}
+	}
+	return false
+}
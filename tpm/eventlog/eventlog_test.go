@@ -0,0 +1,337 @@
+package eventlog
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/tpm"
+)
+
+// The event logs in testdata are copied from github.com/google/go-attestation,
+// licensed under the Apache License, Version 2.0.
+
+// testDump is the format of testdata/windows_gcp_shielded_vm.json.
+type testDump struct {
+	AK struct {
+		Public []byte
+	}
+	Quote struct {
+		Nonce     []byte
+		Quote     []byte
+		Signature []byte
+	}
+	Log struct {
+		PCRs []struct {
+			Index     int
+			Digest    []byte
+			DigestAlg crypto.Hash
+		}
+		Raw []byte
+	}
+}
+
+func mustReadDump(t *testing.T) *testDump {
+	t.Helper()
+	b, err := os.ReadFile("testdata/windows_gcp_shielded_vm.json")
+	require.NoError(t, err)
+	var dump testDump
+	require.NoError(t, json.Unmarshal(b, &dump))
+	return &dump
+}
+
+func (d *testDump) pcrs() []tpm.PCR {
+	pcrs := make([]tpm.PCR, len(d.Log.PCRs))
+	for i, p := range d.Log.PCRs {
+		pcrs[i] = tpm.PCR{Index: p.Index, Digest: p.Digest, DigestAlgorithm: p.DigestAlg}
+	}
+	return pcrs
+}
+
+func mustReadLog(t *testing.T, name string) *EventLog {
+	t.Helper()
+	b, err := os.ReadFile("testdata/" + name)
+	require.NoError(t, err)
+	l, err := Parse(b)
+	require.NoError(t, err)
+	return l
+}
+
+type testEvent struct {
+	pcr  int
+	typ  EventType
+	data []byte
+}
+
+func algID(h crypto.Hash) uint16 {
+	for id, v := range hashAlgs {
+		if v == h {
+			return id
+		}
+	}
+	return 0xffff
+}
+
+func digest(h crypto.Hash, data ...[]byte) []byte {
+	hh := h.New()
+	for _, d := range data {
+		hh.Write(d)
+	}
+	return hh.Sum(nil)
+}
+
+// newTestLog creates a crypto-agile event log with digests in all `banks`.
+func newTestLog(t *testing.T, banks []crypto.Hash, events ...testEvent) []byte {
+	t.Helper()
+	le := binary.LittleEndian
+
+	spec := new(bytes.Buffer)
+	require.NoError(t, binary.Write(spec, le, specIDEventHeader{
+		Signature:          [16]byte(specIDSignature),
+		SpecVersionMajor:   2,
+		UintnSize:          2,
+		NumberOfAlgorithms: uint32(len(banks)),
+	}))
+	for _, b := range banks {
+		require.NoError(t, binary.Write(spec, le, specIDAlgorithm{AlgorithmID: algID(b), DigestSize: uint16(b.Size())}))
+	}
+	spec.WriteByte(0) // vendor info size
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, binary.Write(buf, le, legacyEventHeader{
+		EventType: uint32(NoAction),
+		EventSize: uint32(spec.Len()),
+	}))
+	buf.Write(spec.Bytes())
+
+	for _, e := range events {
+		require.NoError(t, binary.Write(buf, le, []uint32{uint32(e.pcr), uint32(e.typ), uint32(len(banks))}))
+		for _, b := range banks {
+			require.NoError(t, binary.Write(buf, le, algID(b)))
+			buf.Write(digest(b, e.data))
+		}
+		require.NoError(t, binary.Write(buf, le, uint32(len(e.data))))
+		buf.Write(e.data)
+	}
+
+	return buf.Bytes()
+}
+
+// newTestLegacyLog creates an event log in the SHA-1 format.
+func newTestLegacyLog(t *testing.T, events ...testEvent) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	for _, e := range events {
+		h := legacyEventHeader{
+			PCRIndex:  uint32(e.pcr),
+			EventType: uint32(e.typ),
+			EventSize: uint32(len(e.data)),
+		}
+		copy(h.Digest[:], digest(crypto.SHA1, e.data))
+		require.NoError(t, binary.Write(buf, binary.LittleEndian, h))
+		buf.Write(e.data)
+	}
+	return buf.Bytes()
+}
+
+func TestEventType_String(t *testing.T) {
+	assert.Equal(t, "EV_NO_ACTION", NoAction.String())
+	assert.Equal(t, "EV_EFI_BOOT_SERVICES_APPLICATION", EFIBootServicesApplication.String())
+	assert.Equal(t, "EventType(0x1234)", EventType(0x1234).String())
+}
+
+func TestParse(t *testing.T) {
+	banks := []crypto.Hash{crypto.SHA1, crypto.SHA256}
+	events := []testEvent{
+		{0, SCRTMVersion, []byte("version")},
+		{7, Separator, []byte{0, 0, 0, 0}},
+	}
+
+	agile := newTestLog(t, banks, events...)
+	truncated := agile[:len(agile)-2]
+	// Replace the SHA-256 algorithm ID in the spec ID event and the events,
+	// where it's preceded by the number of algorithms or digests, by SM3.
+	unknownAlg := bytes.ReplaceAll(newTestLog(t, []crypto.Hash{crypto.SHA256}, events...), []byte{1, 0, 0, 0, 0x0b, 0x00}, []byte{1, 0, 0, 0, 0x12, 0x00})
+	noAlgs := newTestLog(t, nil)
+
+	// Events can't have more digests than algorithms in the spec ID event.
+	tooManyDigests := newTestLog(t, []crypto.Hash{crypto.SHA256}, events...)
+	binary.LittleEndian.PutUint32(tooManyDigests[len(tooManyDigests)-46:], 2)
+
+	tests := []struct {
+		name       string
+		data       []byte
+		algorithms []crypto.Hash
+		numEvents  int
+		wantErr    bool
+	}{
+		{"ok crypto-agile", agile, banks, 3, false},
+		{"ok sha1", newTestLegacyLog(t, events...), []crypto.Hash{crypto.SHA1}, 2, false},
+		{"ok unknown algorithm", unknownAlg, nil, 3, false},
+		{"fail empty", nil, nil, 0, true},
+		{"fail truncated", truncated, nil, 0, true},
+		{"fail no algorithms", noAlgs, nil, 0, true},
+		{"fail digests", tooManyDigests, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.data)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.algorithms, got.Algorithms)
+			require.Len(t, got.Events, tt.numEvents)
+			for i, e := range got.Events {
+				assert.Equal(t, i, e.Sequence)
+			}
+			last := got.Events[len(got.Events)-1]
+			assert.Equal(t, 7, last.PCR)
+			assert.Equal(t, Separator, last.Type)
+			assert.Equal(t, []byte{0, 0, 0, 0}, last.Data)
+		})
+	}
+
+	for _, name := range []string{"crypto_agile_eventlog", "sb_cert_eventlog", "ubuntu_2104_shielded_vm_no_secure_boot_eventlog"} {
+		l := mustReadLog(t, name)
+		assert.Contains(t, l.Algorithms, crypto.SHA256, name)
+		assert.NotEmpty(t, l.Events, name)
+	}
+}
+
+func TestEventLog_Replay(t *testing.T) {
+	banks := []crypto.Hash{crypto.SHA1, crypto.SHA256}
+	data := newTestLog(t, banks,
+		testEvent{0, NoAction, append([]byte("StartupLocality\x00"), 3)},
+		testEvent{0, SCRTMVersion, []byte("version")},
+		testEvent{7, EFIVariableDriverConfig, []byte("config")},
+		testEvent{7, Separator, []byte{0, 0, 0, 0}},
+		testEvent{4, NoAction, []byte("ignored")},
+	)
+	l, err := Parse(data)
+	require.NoError(t, err)
+
+	for _, bank := range banks {
+		pcr0 := make([]byte, bank.Size())
+		pcr0[len(pcr0)-1] = 3
+		pcr0 = digest(bank, pcr0, digest(bank, []byte("version")))
+		pcr7 := digest(bank, make([]byte, bank.Size()), digest(bank, []byte("config")))
+		pcr7 = digest(bank, pcr7, digest(bank, []byte{0, 0, 0, 0}))
+
+		got, err := l.Replay(bank)
+		require.NoError(t, err)
+		assert.Equal(t, []tpm.PCR{
+			{Index: 0, Digest: pcr0, DigestAlgorithm: bank},
+			{Index: 7, Digest: pcr7, DigestAlgorithm: bank},
+		}, got)
+	}
+
+	_, err = l.Replay(crypto.SHA384)
+	assert.Error(t, err)
+
+	l, err = Parse(newTestLog(t, banks, testEvent{24, Separator, []byte{0, 0, 0, 0}}))
+	require.NoError(t, err)
+	_, err = l.Replay(crypto.SHA256)
+	assert.Error(t, err)
+
+	l, err = Parse(newTestLog(t, banks, testEvent{0, Separator, []byte{0, 0, 0, 0}}))
+	require.NoError(t, err)
+	delete(l.Events[1].Digests, crypto.SHA256)
+	_, err = l.Replay(crypto.SHA256)
+	assert.Error(t, err)
+}
+
+func TestEventLog_Verify(t *testing.T) {
+	dump := mustReadDump(t)
+	l, err := Parse(dump.Log.Raw)
+	require.NoError(t, err)
+
+	pcrs := dump.pcrs()
+	require.NoError(t, l.Verify(pcrs))
+
+	// The replayed PCRs can be used to verify the quote.
+	pub, err := tpm2.DecodePublic(dump.AK.Public)
+	require.NoError(t, err)
+	akPublic, err := pub.Key()
+	require.NoError(t, err)
+	expected, err := l.Replay(crypto.SHA1)
+	require.NoError(t, err)
+	assert.NoError(t, tpm.VerifyQuote(akPublic, &tpm.Quote{
+		Quote:     dump.Quote.Quote,
+		Signature: dump.Quote.Signature,
+		PCRs:      pcrs,
+	}, dump.Quote.Nonce, expected))
+
+	tampered := dump.pcrs()
+	for i, p := range tampered {
+		if p.Index == 7 {
+			tampered[i].Digest = make([]byte, len(p.Digest))
+		}
+	}
+	err = l.Verify(tampered)
+	var pcrErr *tpm.PCRMismatchError
+	require.True(t, errors.As(err, &pcrErr))
+	assert.Equal(t, 7, pcrErr.Index)
+
+	// Dropping all the events of a quoted PCR is detected.
+	dropped := *l
+	dropped.Events = nil
+	for _, e := range l.Events {
+		if e.PCR != 7 {
+			dropped.Events = append(dropped.Events, e)
+		}
+	}
+	err = dropped.Verify(pcrs)
+	require.True(t, errors.As(err, &pcrErr))
+	assert.Equal(t, 7, pcrErr.Index)
+	assert.Equal(t, make([]byte, crypto.SHA1.Size()), pcrErr.Expected)
+
+	assert.Error(t, l.Verify(nil))
+	assert.Error(t, l.Verify([]tpm.PCR{{Index: 0, Digest: make([]byte, 64), DigestAlgorithm: crypto.SHA512}}))
+	assert.Error(t, l.Verify([]tpm.PCR{{Index: 24, Digest: make([]byte, 20), DigestAlgorithm: crypto.SHA1}}))
+}
+
+func TestEventLog_Verify_resetValues(t *testing.T) {
+	l, err := Parse(newTestLog(t, []crypto.Hash{crypto.SHA256},
+		testEvent{0, NoAction, append([]byte("StartupLocality\x00"), 3)},
+		testEvent{4, Separator, []byte{0, 0, 0, 0}},
+	))
+	require.NoError(t, err)
+
+	pcr0 := make([]byte, 32)
+	pcr0[31] = 3
+	pcr4 := digest(crypto.SHA256, make([]byte, 32), digest(crypto.SHA256, []byte{0, 0, 0, 0}))
+	ones := bytes.Repeat([]byte{0xff}, 32)
+	pcr := func(i int, v []byte) tpm.PCR {
+		return tpm.PCR{Index: i, Digest: v, DigestAlgorithm: crypto.SHA256}
+	}
+
+	assert.NoError(t, l.Verify([]tpm.PCR{pcr(0, pcr0), pcr(4, pcr4), pcr(7, make([]byte, 32)), pcr(17, ones)}))
+
+	tests := []struct {
+		name  string
+		pcr   tpm.PCR
+		index int
+	}{
+		{"fail pcr 0 without locality", pcr(0, make([]byte, 32)), 0},
+		{"fail pcr 7 extended", pcr(7, pcr4), 7},
+		{"fail pcr 17 zeros", pcr(17, make([]byte, 32)), 17},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := l.Verify([]tpm.PCR{pcr(4, pcr4), tt.pcr})
+			var pcrErr *tpm.PCRMismatchError
+			require.True(t, errors.As(err, &pcrErr))
+			assert.Equal(t, tt.index, pcrErr.Index)
+		})
+	}
+}
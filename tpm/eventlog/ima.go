@@ -0,0 +1,175 @@
+package eventlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/sha1" //nolint:gosec // IMA template hashes use SHA-1
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.step.sm/crypto/tpm"
+)
+
+// IMAEntry is an entry of the Linux Integrity Measurement Architecture (IMA)
+// measurement list.
+type IMAEntry struct {
+	// PCR is the index of the PCR the entry was extended into, usually 10.
+	PCR int
+	// TemplateHash is the SHA-1 hash of the template data. It is all zeros
+	// for measurement violations.
+	TemplateHash []byte
+	// TemplateName is the name of the IMA template, ima-ng or ima-sig.
+	TemplateName string
+	// FileHashAlgorithm is the name of the algorithm used to hash the file.
+	FileHashAlgorithm string
+	// FileHash is the hash of the file contents.
+	FileHash []byte
+	// Path is the path of the file.
+	Path string
+	// Signature is the file signature of ima-sig entries, if any.
+	Signature []byte
+}
+
+// ParseIMALog parses the ASCII IMA measurement list, as found in
+// /sys/kernel/security/ima/ascii_runtime_measurements. Only the ima-ng and
+// ima-sig templates are supported, and the template hash of each entry is
+// checked against the entry fields. Paths with spaces are not supported.
+func ParseIMALog(data []byte) ([]IMAEntry, error) {
+	var entries []IMAEntry
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		e, err := parseIMAEntry(fields)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing IMA entry on line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed reading IMA log: %w", err)
+	}
+	return entries, nil
+}
+
+func parseIMAEntry(fields []string) (IMAEntry, error) {
+	if len(fields) < 5 {
+		return IMAEntry{}, fmt.Errorf("expected at least 5 fields, got %d", len(fields))
+	}
+
+	pcr, err := strconv.Atoi(fields[0])
+	if err != nil || pcr < 0 || pcr >= numPCRs {
+		return IMAEntry{}, fmt.Errorf("invalid PCR index %q", fields[0])
+	}
+	templateHash, err := hex.DecodeString(fields[1])
+	if err != nil || len(templateHash) != sha1.Size {
+		return IMAEntry{}, fmt.Errorf("invalid template hash %q", fields[1])
+	}
+
+	e := IMAEntry{
+		PCR:          pcr,
+		TemplateHash: templateHash,
+		TemplateName: fields[2],
+		Path:         fields[4],
+	}
+	switch {
+	case e.TemplateName == "ima-ng" && len(fields) == 5:
+	case e.TemplateName == "ima-sig" && len(fields) <= 6:
+		if len(fields) == 6 {
+			if e.Signature, err = hex.DecodeString(fields[5]); err != nil {
+				return IMAEntry{}, fmt.Errorf("invalid signature %q", fields[5])
+			}
+		}
+	default:
+		return IMAEntry{}, fmt.Errorf("unsupported IMA template %q", e.TemplateName)
+	}
+
+	alg, digest, ok := strings.Cut(fields[3], ":")
+	if !ok {
+		return IMAEntry{}, fmt.Errorf("invalid file hash %q", fields[3])
+	}
+	e.FileHashAlgorithm = alg
+	if e.FileHash, err = hex.DecodeString(digest); err != nil {
+		return IMAEntry{}, fmt.Errorf("invalid file hash %q", fields[3])
+	}
+
+	if !isZero(e.TemplateHash) && !bytes.Equal(e.templateHash(), e.TemplateHash) {
+		return IMAEntry{}, fmt.Errorf("template hash of %q does not match the entry", e.Path)
+	}
+
+	return e, nil
+}
+
+// templateHash computes the SHA-1 hash of the template data. Each template
+// field is prefixed by its little-endian 32-bit length.
+func (e *IMAEntry) templateHash() []byte {
+	fields := [][]byte{
+		append([]byte(e.FileHashAlgorithm+":\x00"), e.FileHash...), // d-ng
+		append([]byte(e.Path), 0),                                  // n-ng
+	}
+	if e.TemplateName == "ima-sig" {
+		fields = append(fields, e.Signature) // sig
+	}
+
+	h := sha1.New() //nolint:gosec // IMA template hashes use SHA-1
+	for _, f := range fields {
+		var size [4]byte
+		binary.LittleEndian.PutUint32(size[:], uint32(len(f)))
+		h.Write(size[:])
+		h.Write(f)
+	}
+	return h.Sum(nil)
+}
+
+// ReplayIMA extends the template hashes of the IMA entries and returns the
+// resulting value of each PCR, ordered by index. As the ASCII measurement list
+// only contains SHA-1 template hashes, only the SHA-1 PCR bank is computed.
+// Following the kernel implementation, measurement violations are extended as
+// all ones.
+func ReplayIMA(entries []IMAEntry) []tpm.PCR {
+	values := make(map[int][]byte)
+	for _, e := range entries {
+		digest := e.TemplateHash
+		if isZero(digest) {
+			digest = bytes.Repeat([]byte{0xff}, sha1.Size)
+		}
+		v, ok := values[e.PCR]
+		if !ok {
+			v = make([]byte, sha1.Size)
+		}
+		h := sha1.New() //nolint:gosec // SHA-1 PCR bank
+		h.Write(v)
+		h.Write(digest)
+		values[e.PCR] = h.Sum(nil)
+	}
+
+	pcrs := make([]tpm.PCR, 0, len(values))
+	for i, v := range values {
+		pcrs = append(pcrs, tpm.PCR{
+			Index:           i,
+			Digest:          v,
+			DigestAlgorithm: crypto.SHA1,
+		})
+	}
+	sort.Slice(pcrs, func(i, j int) bool {
+		return pcrs[i].Index < pcrs[j].Index
+	})
+
+	return pcrs
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
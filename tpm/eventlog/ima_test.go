@@ -0,0 +1,77 @@
+package eventlog
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1" //nolint:gosec // IMA template hashes use SHA-1
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/tpm"
+)
+
+func newTestIMALine(e IMAEntry) string {
+	if e.TemplateHash == nil {
+		e.TemplateHash = e.templateHash()
+	}
+	line := fmt.Sprintf("%d %x %s %s:%x %s", e.PCR, e.TemplateHash, e.TemplateName, e.FileHashAlgorithm, e.FileHash, e.Path)
+	if len(e.Signature) > 0 {
+		line += " " + hex.EncodeToString(e.Signature)
+	}
+	return line
+}
+
+func TestParseIMALog(t *testing.T) {
+	entries := []IMAEntry{
+		{PCR: 10, TemplateName: "ima-ng", FileHashAlgorithm: "sha1", FileHash: bytes.Repeat([]byte{1}, 20), Path: "boot_aggregate"},
+		{PCR: 10, TemplateName: "ima-ng", FileHashAlgorithm: "sha256", FileHash: bytes.Repeat([]byte{2}, 32), Path: "/usr/bin/bash"},
+		{PCR: 10, TemplateName: "ima-sig", FileHashAlgorithm: "sha256", FileHash: bytes.Repeat([]byte{3}, 32), Path: "/usr/bin/ls", Signature: []byte{0x03, 0x02, 0x01}},
+		{PCR: 10, TemplateName: "ima-sig", FileHashAlgorithm: "sha256", FileHash: bytes.Repeat([]byte{4}, 32), Path: "/usr/lib/libc.so.6"},
+		{PCR: 10, TemplateName: "ima-ng", TemplateHash: make([]byte, 20), FileHashAlgorithm: "sha256", FileHash: make([]byte, 32), Path: "/var/log/violation"},
+	}
+	lines := make([]string, len(entries))
+	for i := range entries {
+		lines[i] = newTestIMALine(entries[i])
+		if entries[i].TemplateHash == nil {
+			entries[i].TemplateHash = entries[i].templateHash()
+		}
+	}
+
+	got, err := ParseIMALog([]byte(strings.Join(lines, "\n") + "\n\n"))
+	require.NoError(t, err)
+	assert.Equal(t, entries, got)
+
+	// Replay the entries, violations are extended as all ones.
+	pcr := make([]byte, sha1.Size)
+	for _, e := range entries[:4] {
+		pcr = digest(crypto.SHA1, pcr, e.TemplateHash)
+	}
+	pcr = digest(crypto.SHA1, pcr, bytes.Repeat([]byte{0xff}, sha1.Size))
+	assert.Equal(t, []tpm.PCR{
+		{Index: 10, Digest: pcr, DigestAlgorithm: crypto.SHA1},
+	}, ReplayIMA(got))
+
+	valid := lines[1]
+	for _, line := range []string{
+		"10 0000",
+		strings.Replace(valid, "10 ", "24 ", 1),
+		strings.Replace(valid, "10 ", "x ", 1),
+		strings.Replace(valid, "10 ", "10 00", 1),
+		strings.Replace(valid, "ima-ng", "ima", 1),
+		strings.Replace(valid, "ima-ng", "ima-buf", 1),
+		strings.Replace(valid, "sha256:", "sha256-", 1),
+		strings.Replace(valid, "sha256:", "sha256:zz", 1),
+		strings.Replace(valid, "/usr/bin/bash", "/usr/bin/sh", 1),
+		valid + " extra",
+		lines[2] + " extra",
+		strings.Replace(lines[2], " 030201", " zz", 1),
+	} {
+		_, err := ParseIMALog([]byte(line))
+		assert.Error(t, err, line)
+	}
+}
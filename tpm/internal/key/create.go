@@ -1,6 +1,9 @@
 package key
 
-import "io"
+import (
+	"crypto"
+	"io"
+)
 
 // Create creates a new TPM key without attesting it and returns a
 // serialized representation of it. The serialized format is compatible
@@ -18,3 +21,28 @@ import "io"
 func Create(rwc io.ReadWriteCloser, keyName string, config CreateConfig) ([]byte, error) {
 	return create(rwc, keyName, config)
 }
+
+// CreateAttested creates a new TPM key attested by the AK in the serialized
+// `ak` data, and returns a serialized representation of it. The AK certifies
+// the key with TPM2_Certify, using `qualifyingData` as the nonce, so that the
+// result can be verified in the same way as keys created by `go-attestation`.
+// Unlike `go-attestation`, it allows to set the password and policy of the
+// key.
+func CreateAttested(rwc io.ReadWriteCloser, keyName string, ak []byte, qualifyingData []byte, config CreateConfig) ([]byte, error) {
+	return createAttested(rwc, keyName, ak, qualifyingData, config)
+}
+
+// SRK returns the public key of the Storage Root Key (SRK) used to create
+// keys, creating and persisting it if it doesn't exist. Keys wrapped to the
+// SRK can be imported using [Import].
+func SRK(rwc io.ReadWriteCloser) (crypto.PublicKey, error) {
+	return srk(rwc)
+}
+
+// Import imports a key wrapped to the SRK, with the given public area,
+// duplicate and encrypted seed, and returns a serialized representation
+// of it. The serialized format is the same used for keys created with
+// [Create].
+func Import(rwc io.ReadWriteCloser, keyName string, public, duplicate, seed []byte) ([]byte, error) {
+	return importKey(rwc, keyName, public, duplicate, seed)
+}
@@ -100,12 +100,35 @@ func (k *serializedKey) Serialize() ([]byte, error) {
 	return json.Marshal(k)
 }
 
+// Blobs returns the public and private blobs of a serialized key. It
+// returns an error if the key is not fully represented in encrypted
+// form, as is the case for keys managed by the OS.
+func Blobs(data []byte) (public, private []byte, err error) {
+	var sk serializedKey
+	if err := json.Unmarshal(data, &sk); err != nil {
+		return nil, nil, fmt.Errorf("failed decoding key: %w", err)
+	}
+	if sk.Encoding != keyEncodingEncrypted {
+		return nil, nil, fmt.Errorf("unsupported key encoding: %s", sk.Encoding)
+	}
+	return sk.Public, sk.Blob, nil
+}
+
 type CreateConfig struct {
 	// Algorithm to be used, either RSA or ECDSA.
 	Algorithm string
 	// Size is used to specify the bit size of the key or elliptic curve. For
 	// example, '256' is used to specify curve P-256.
 	Size int
+	// Password is the authorization value of the key. If empty, the key
+	// doesn't require an authorization value.
+	Password string
+	// AuthPolicy is the policy digest of the key. If set, the key can only
+	// be used for signing in a policy session satisfying the policy.
+	AuthPolicy []byte
+	// Decrypt creates a decryption key instead of a signing key. RSA keys
+	// can be used for RSA decryption, and ECDSA keys for ECDH.
+	Decrypt bool
 }
 
 func (c *CreateConfig) Validate() error {
@@ -295,3 +318,34 @@ func templateFromConfig(opts *KeyConfig) (tpm2.Public, error) {
 
 	return tmpl, nil
 }
+
+// applyDecrypt changes the template of a signing key to a template of a
+// decryption key, if configured. The schemes are not set, so they can be
+// selected when the key is used.
+func applyDecrypt(tmpl tpm2.Public, config CreateConfig) tpm2.Public {
+	if !config.Decrypt {
+		return tmpl
+	}
+	tmpl.Attributes = tmpl.Attributes&^tpm2.FlagSign | tpm2.FlagDecrypt
+	switch {
+	case tmpl.RSAParameters != nil:
+		params := *tmpl.RSAParameters
+		params.Sign = nil
+		tmpl.RSAParameters = &params
+	case tmpl.ECCParameters != nil:
+		params := *tmpl.ECCParameters
+		params.Sign = nil
+		tmpl.ECCParameters = &params
+	}
+	return tmpl
+}
+
+// applyAuth sets the authorization policy of the key in the template.
+// Keys with a policy can't be used with just the authorization value.
+func applyAuth(tmpl tpm2.Public, config CreateConfig) tpm2.Public {
+	if len(config.AuthPolicy) > 0 {
+		tmpl.Attributes &^= tpm2.FlagUserWithAuth
+		tmpl.AuthPolicy = config.AuthPolicy
+	}
+	return tmpl
+}
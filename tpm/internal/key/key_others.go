@@ -4,10 +4,13 @@
 package key
 
 import (
+	"bytes"
+	"crypto"
 	"fmt"
 	"io"
 
 	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/google/go-tpm/tpmutil"
 )
 
 func create(rwc io.ReadWriteCloser, keyName string, config CreateConfig) ([]byte, error) {
@@ -16,23 +19,135 @@ func create(rwc io.ReadWriteCloser, keyName string, config CreateConfig) ([]byte
 		return nil, fmt.Errorf("failed to get SRK handle: %w", err)
 	}
 
+	blob, pub, creationData, err := createKey(rwc, srk, config)
+	if err != nil {
+		return nil, err
+	}
+
+	out := serializedKey{
+		Encoding:   keyEncodingEncrypted,
+		TPMVersion: uint8(2), // hardcoded to not import github.com/google/go-attestation/attest
+		Name:       keyName,
+		Public:     pub,
+		Blob:       blob,
+		CreateData: creationData,
+	}
+
+	return out.Serialize()
+}
+
+func createKey(rwc io.ReadWriteCloser, srk tpmutil.Handle, config CreateConfig) (blob, pub, creationData []byte, err error) {
 	tmpl, err := templateFromConfig(&KeyConfig{Algorithm: Algorithm(config.Algorithm), Size: config.Size})
 	if err != nil {
-		return nil, fmt.Errorf("incorrect key options: %w", err)
+		return nil, nil, nil, fmt.Errorf("incorrect key options: %w", err)
 	}
 
-	blob, pub, creationData, _, _, err := tpm2.CreateKey(rwc, srk, tpm2.PCRSelection{}, "", "", tmpl)
+	blob, pub, creationData, _, _, err = tpm2.CreateKey(rwc, srk, tpm2.PCRSelection{}, "", config.Password, applyAuth(applyDecrypt(tmpl, config), config))
 	if err != nil {
-		return nil, fmt.Errorf("CreateKey() failed: %w", err)
+		return nil, nil, nil, fmt.Errorf("CreateKey() failed: %w", err)
+	}
+
+	return blob, pub, creationData, nil
+}
+
+func createAttested(rwc io.ReadWriteCloser, keyName string, ak []byte, qualifyingData []byte, config CreateConfig) ([]byte, error) {
+	akPublic, akPrivate, err := Blobs(ak)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading AK: %w", err)
+	}
+
+	srk, _, err := getPrimaryKeyHandle(rwc, commonSrkEquivalentHandle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SRK handle: %w", err)
+	}
+
+	akHandle, _, err := tpm2.Load(rwc, srk, "", akPublic, akPrivate)
+	if err != nil {
+		return nil, fmt.Errorf("Load() AK failed: %w", err)
+	}
+	defer tpm2.FlushContext(rwc, akHandle)
+
+	blob, pub, creationData, err := createKey(rwc, srk, config)
+	if err != nil {
+		return nil, err
+	}
+
+	keyHandle, _, err := tpm2.Load(rwc, srk, "", pub, blob)
+	if err != nil {
+		return nil, fmt.Errorf("Load() failed: %w", err)
+	}
+	defer tpm2.FlushContext(rwc, keyHandle)
+
+	// Keys with a policy don't allow the authorization value to be used for
+	// user actions, but TPM2_Certify requires the admin role for the key,
+	// which is still authorized with it.
+	attestation, signature, err := tpm2.CertifyEx(rwc, config.Password, "", keyHandle, akHandle, qualifyingData, tpm2.SigScheme{
+		Alg:  tpm2.AlgRSASSA,
+		Hash: tpm2.AlgSHA256,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("CertifyEx() failed: %w", err)
+	}
+
+	// Check that the certified key is the created one.
+	tpmPub, _, _, err := tpm2.ReadPublic(rwc, keyHandle)
+	if err != nil {
+		return nil, fmt.Errorf("ReadPublic() failed: %w", err)
+	}
+	public, err := tpmPub.Encode()
+	if err != nil {
+		return nil, fmt.Errorf("failed encoding public key: %w", err)
+	}
+	if !bytes.Equal(pub, public) {
+		return nil, fmt.Errorf("certified incorrect key, expected: %v, certified: %v", pub, public)
+	}
+
+	out := serializedKey{
+		Encoding:          keyEncodingEncrypted,
+		TPMVersion:        uint8(2), // hardcoded to not import github.com/google/go-attestation/attest
+		Name:              keyName,
+		Public:            pub,
+		Blob:              blob,
+		CreateData:        creationData,
+		CreateAttestation: attestation,
+		CreateSignature:   signature,
+	}
+
+	return out.Serialize()
+}
+
+func srk(rwc io.ReadWriteCloser) (crypto.PublicKey, error) {
+	srk, _, err := getPrimaryKeyHandle(rwc, commonSrkEquivalentHandle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SRK handle: %w", err)
+	}
+
+	pub, _, _, err := tpm2.ReadPublic(rwc, srk)
+	if err != nil {
+		return nil, fmt.Errorf("ReadPublic() failed: %w", err)
+	}
+
+	return pub.Key()
+}
+
+func importKey(rwc io.ReadWriteCloser, keyName string, public, duplicate, seed []byte) ([]byte, error) {
+	srk, _, err := getPrimaryKeyHandle(rwc, commonSrkEquivalentHandle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SRK handle: %w", err)
+	}
+
+	auth := tpm2.AuthCommand{Session: tpm2.HandlePasswordSession, Attributes: tpm2.AttrContinueSession}
+	blob, err := tpm2.Import(rwc, srk, auth, public, duplicate, seed, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Import() failed: %w", err)
 	}
 
 	out := serializedKey{
 		Encoding:   keyEncodingEncrypted,
 		TPMVersion: uint8(2), // hardcoded to not import github.com/google/go-attestation/attest
 		Name:       keyName,
-		Public:     pub,
+		Public:     public,
 		Blob:       blob,
-		CreateData: creationData,
 	}
 
 	return out.Serialize()
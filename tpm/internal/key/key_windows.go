@@ -4,11 +4,20 @@
 package key
 
 import (
+	"crypto"
+	"errors"
 	"fmt"
 	"io"
 )
 
 func create(_ io.ReadWriteCloser, keyName string, config CreateConfig) ([]byte, error) {
+	if config.Password != "" || len(config.AuthPolicy) > 0 {
+		return nil, errors.New("keys with a password or policy are not supported on Windows")
+	}
+	if config.Decrypt {
+		return nil, errors.New("decryption keys are not supported on Windows")
+	}
+
 	pcp, err := openPCP()
 	if err != nil {
 		return nil, fmt.Errorf("failed to open PCP: %w", err)
@@ -29,3 +38,15 @@ func create(_ io.ReadWriteCloser, keyName string, config CreateConfig) ([]byte,
 
 	return out.Serialize()
 }
+
+func createAttested(_ io.ReadWriteCloser, _ string, _, _ []byte, _ CreateConfig) ([]byte, error) {
+	return nil, errors.New("attesting keys with a password or policy is not supported on Windows")
+}
+
+func srk(_ io.ReadWriteCloser) (crypto.PublicKey, error) {
+	return nil, errors.New("reading the SRK is not supported on Windows")
+}
+
+func importKey(_ io.ReadWriteCloser, _ string, _, _, _ []byte) ([]byte, error) {
+	return nil, errors.New("importing keys is not supported on Windows")
+}
@@ -13,6 +13,7 @@ import (
 
 	internalkey "go.step.sm/crypto/tpm/internal/key"
 	"go.step.sm/crypto/tpm/storage"
+	"go.step.sm/crypto/tpm/tss2"
 )
 
 // Key models a TPM 2.0 Key. A Key can be used
@@ -25,6 +26,7 @@ type Key struct {
 	attestedBy string
 	chain      []*x509.Certificate
 	createdAt  time.Time
+	auth       *keyAuth
 	blobs      *Blobs
 	tpm        *TPM
 }
@@ -119,6 +121,16 @@ type CreateKeyConfig struct {
 	// Size is used to specify the bit size of the key or elliptic curve. For
 	// example, '256' is used to specify curve P-256.
 	Size int
+	// Password is the password required to sign with the Key. If
+	// empty, no password is required.
+	Password string
+	// Policy is the policy that has to be satisfied to sign with the
+	// Key. If nil, the Key can be used without a policy.
+	Policy *KeyPolicy
+	// Decrypt creates a decryption Key instead of a signing Key. RSA
+	// Keys can be used to decrypt, and ECDSA Keys to compute ECDH shared
+	// secrets. See [Key.Decrypter].
+	Decrypt bool
 
 	// TODO(hs): move key name to this struct?
 }
@@ -137,6 +149,16 @@ type AttestKeyConfig struct {
 	// When used with ACME `device-attest-01`, this contains a hash of
 	// the key authorization.
 	QualifyingData []byte
+	// Password is the password required to sign with the Key. If
+	// empty, no password is required.
+	Password string
+	// Policy is the policy that has to be satisfied to sign with the
+	// Key. If nil, the Key can be used without a policy.
+	Policy *KeyPolicy
+	// Decrypt creates a decryption Key instead of a signing Key. RSA
+	// Keys can be used to decrypt, and ECDSA Keys to compute ECDH shared
+	// secrets. See [Key.Decrypter].
+	Decrypt bool
 
 	// TODO(hs): add akName and key name to this struct?
 }
@@ -163,10 +185,16 @@ func (t *TPM) CreateKey(ctx context.Context, name string, config CreateKeyConfig
 		return nil, fmt.Errorf("failed creating key %q: %w", name, err)
 	}
 
-	createConfig := internalkey.CreateConfig{
-		Algorithm: config.Algorithm,
-		Size:      config.Size,
+	auth, err := t.keyAuth(config.Password, config.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating key %q: %w", name, err)
+	}
+
+	createConfig, err := auth.createConfig(config.Algorithm, config.Size, config.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating key %q: %w", name, err)
 	}
+	createConfig.Decrypt = config.Decrypt
 	if err := t.validate(&createConfig); err != nil {
 		return nil, fmt.Errorf("invalid key creation parameters: %w", err)
 	}
@@ -179,6 +207,7 @@ func (t *TPM) CreateKey(ctx context.Context, name string, config CreateKeyConfig
 		name:      name,
 		data:      data,
 		createdAt: now,
+		auth:      auth,
 		tpm:       t,
 	}
 
@@ -193,6 +222,101 @@ func (t *TPM) CreateKey(ctx context.Context, name string, config CreateKeyConfig
 	return
 }
 
+// ImportKeyConfig is used to pass configuration
+// when importing Keys.
+type ImportKeyConfig struct {
+	// Password is the password required to sign with the Key. If
+	// empty, no password is required.
+	Password string
+	// Policy is the policy that has to be satisfied to sign with the
+	// Key. If nil, the Key can be used without a policy.
+	Policy *KeyPolicy
+}
+
+// ImportKey imports the RSA or ECDSA private key `privateKey` into the TPM,
+// creating a new Key identified by `name`. If no name is provided, a random
+// 10 character name is generated. If a Key with the same name exists,
+// `ErrExists` is returned. The private key is wrapped to the Storage Root
+// Key (SRK), so the Key can only be used with this TPM, but, unlike keys
+// created in the TPM, the private key is known outside of it. Imported Keys
+// are not attested by an AK.
+//
+// Keys can also be wrapped without access to the TPM using
+// [tss2.CreateImportable] and the public key returned by [TPM.GetSRK], and
+// then used with [CreateTSS2Signer].
+func (t *TPM) ImportKey(ctx context.Context, name string, privateKey crypto.PrivateKey, config ImportKeyConfig) (key *Key, err error) {
+	if err = t.open(goTPMCall(ctx)); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	now := time.Now()
+	if name, err = processName(name); err != nil {
+		return nil, err
+	}
+
+	_, err = t.store.GetKey(name)
+	switch {
+	case err == nil:
+		return nil, fmt.Errorf("failed importing key %q: %w", name, ErrExists)
+	case errors.Is(err, storage.ErrNoStorageConfigured):
+		return nil, fmt.Errorf("failed importing key %q: %w", name, err)
+	}
+
+	auth, err := t.keyAuth(config.Password, config.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed importing key %q: %w", name, err)
+	}
+
+	srk, err := internalkey.SRK(t.rwc)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting SRK: %w", err)
+	}
+	wrapped, err := tss2.CreateImportable(srk, privateKey, config.Password, tss2.WithPolicy(auth.Policy...))
+	if err != nil {
+		return nil, fmt.Errorf("failed wrapping key %q: %w", name, err)
+	}
+	data, err := internalkey.Import(t.rwc, prefixKey(name), wrapped.PublicKey[2:], wrapped.PrivateKey[2:], wrapped.Secret[2:])
+	if err != nil {
+		return nil, fmt.Errorf("failed importing key %q: %w", name, err)
+	}
+
+	key = &Key{
+		name:      name,
+		data:      data,
+		createdAt: now,
+		auth:      auth,
+		tpm:       t,
+	}
+
+	if err := t.store.AddKey(key.toStorage()); err != nil {
+		return nil, fmt.Errorf("failed adding key %q to storage: %w", name, err)
+	}
+
+	if err := t.store.Persist(); err != nil {
+		return nil, fmt.Errorf("failed persisting key %q to storage: %w", name, err)
+	}
+
+	return
+}
+
+// GetSRK returns the public key of the Storage Root Key (SRK) of the TPM,
+// creating and persisting the SRK if it doesn't exist yet. Keys can be
+// wrapped to the SRK using [tss2.CreateImportable], so that only this TPM
+// can use them.
+func (t *TPM) GetSRK(ctx context.Context) (pub crypto.PublicKey, err error) {
+	if err = t.open(goTPMCall(ctx)); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	if pub, err = internalkey.SRK(t.rwc); err != nil {
+		return nil, fmt.Errorf("failed getting SRK: %w", err)
+	}
+
+	return
+}
+
 type attestValidationWrapper attest.KeyConfig
 
 func (w attestValidationWrapper) Validate() error {
@@ -212,8 +336,13 @@ func (w attestValidationWrapper) Validate() error {
 // AttestKey creates a new Key identified by `name` and attested by the AK
 // identified by `akName`. If no name is  provided, a random 10 character
 // name is generated. If a Key with the same name exists, `ErrExists` is
-// returned.
+// returned. Keys with a password or policy are certified by the AK in the
+// same way, so they can be verified using their CertificationParameters.
 func (t *TPM) AttestKey(ctx context.Context, akName, name string, config AttestKeyConfig) (key *Key, err error) {
+	if config.Password != "" || config.Policy != nil || config.Decrypt {
+		return t.attestKeyWithAuth(ctx, akName, name, config)
+	}
+
 	if err = t.open(ctx); err != nil {
 		return nil, fmt.Errorf("failed opening TPM: %w", err)
 	}
@@ -285,6 +414,75 @@ func (t *TPM) AttestKey(ctx context.Context, akName, name string, config AttestK
 	return
 }
 
+// attestKeyWithAuth creates a new Key with a password, a policy or for
+// decryption, and attests it with the AK identified by `akName`.
+// `go-attestation` doesn't support creating such keys, so the key is
+// created and certified using go-tpm.
+func (t *TPM) attestKeyWithAuth(ctx context.Context, akName, name string, config AttestKeyConfig) (key *Key, err error) {
+	if err = t.open(goTPMCall(ctx)); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	now := time.Now()
+	if name, err = processName(name); err != nil {
+		return nil, err
+	}
+
+	_, err = t.store.GetKey(name)
+	switch {
+	case err == nil:
+		return nil, fmt.Errorf("failed creating key %q: %w", name, ErrExists)
+	case errors.Is(err, storage.ErrNoStorageConfigured):
+		return nil, fmt.Errorf("failed creating key %q: %w", name, err)
+	}
+
+	ak, err := t.store.GetAK(akName)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("failed getting AK %q: %w", akName, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed getting AK %q: %w", akName, err)
+	}
+
+	auth, err := t.keyAuth(config.Password, config.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating key %q: %w", name, err)
+	}
+
+	createConfig, err := auth.createConfig(config.Algorithm, config.Size, config.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating key %q: %w", name, err)
+	}
+	createConfig.Decrypt = config.Decrypt
+	if err := t.validate(&createConfig); err != nil {
+		return nil, fmt.Errorf("invalid key attestation parameters: %w", err)
+	}
+	data, err := internalkey.CreateAttested(t.rwc, prefixKey(name), ak.Data, config.QualifyingData, createConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating key %q: %w", name, err)
+	}
+
+	key = &Key{
+		name:       name,
+		data:       data,
+		attestedBy: akName,
+		createdAt:  now,
+		auth:       auth,
+		tpm:        t,
+	}
+
+	if err := t.store.AddKey(key.toStorage()); err != nil {
+		return nil, fmt.Errorf("failed adding key %q to storage: %w", name, err)
+	}
+
+	if err := t.store.Persist(); err != nil {
+		return nil, fmt.Errorf("failed persisting key %q: %w", name, err)
+	}
+
+	return
+}
+
 // GetKey returns the Key identified by `name`. It returns `ErrNotfound`
 // if it doesn't exist.
 func (t *TPM) GetKey(ctx context.Context, name string) (key *Key, err error) {
@@ -301,7 +499,7 @@ func (t *TPM) GetKey(ctx context.Context, name string) (key *Key, err error) {
 		return nil, fmt.Errorf("failed getting key %q: %w", name, err)
 	}
 
-	return keyFromStorage(skey, t), nil
+	return keyFromStorage(skey, t)
 }
 
 // ListKeys returns a slice of Keys. The result is (currently)
@@ -319,7 +517,11 @@ func (t *TPM) ListKeys(ctx context.Context) (keys []*Key, err error) {
 
 	keys = make([]*Key, 0, len(skeys))
 	for _, skey := range skeys {
-		keys = append(keys, keyFromStorage(skey, t))
+		key, err := keyFromStorage(skey, t)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
 	}
 
 	return
@@ -341,7 +543,11 @@ func (t *TPM) GetKeysAttestedBy(ctx context.Context, akName string) (keys []*Key
 	keys = make([]*Key, 0, len(skeys))
 	for _, skey := range skeys {
 		if skey.AttestedBy == akName {
-			keys = append(keys, keyFromStorage(skey, t))
+			key, err := keyFromStorage(skey, t)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
 		}
 	}
 
@@ -384,6 +590,52 @@ func (k *Key) Signer(ctx context.Context) (crypto.Signer, error) {
 	return k.tpm.GetSigner(ctx, k.name)
 }
 
+// SignerWithPassword returns a crypto.Signer backed by the Key, using
+// `password` to authorize signing with it. The password is ignored if
+// the Key doesn't require one.
+func (k *Key) SignerWithPassword(ctx context.Context, password string) (crypto.Signer, error) {
+	return k.tpm.GetSignerWithPassword(ctx, k.name, password)
+}
+
+// HasPassword returns whether a password is required to sign
+// with the Key.
+func (k *Key) HasPassword() bool {
+	return k.auth != nil && k.auth.Password
+}
+
+// HasPolicy returns whether a policy has to be satisfied to sign
+// with the Key.
+func (k *Key) HasPolicy() bool {
+	return k.auth != nil && len(k.auth.Policy) > 0
+}
+
+// AddSignedPolicy adds a policy signed by the authority of the Key
+// policy. The signed policy is created with [tss2.SignPolicy], and
+// it's used to satisfy the policy of the Key if no other signed
+// policy is satisfied. It returns an error if the Key was not
+// created with an [AuthorizePolicy].
+func (k *Key) AddSignedPolicy(ctx context.Context, policy tss2.TPMAuthPolicy) (err error) {
+	if err = k.tpm.open(ctx); err != nil {
+		return fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, k.tpm, &err)
+
+	if !k.auth.hasAuthorize() {
+		return fmt.Errorf("failed adding signed policy to key %q: key does not have an authorize policy", k.name)
+	}
+
+	k.auth.AuthPolicy = append(k.auth.AuthPolicy, policy)
+	if err := k.tpm.store.UpdateKey(k.toStorage()); err != nil {
+		return fmt.Errorf("failed updating key %q: %w", k.name, err)
+	}
+
+	if err := k.tpm.store.Persist(); err != nil {
+		return fmt.Errorf("failed persisting key %q: %w", k.name, err)
+	}
+
+	return
+}
+
 // CertificationParameters returns information about the key that can be used to
 // verify key certification.
 func (k *Key) CertificationParameters(ctx context.Context) (params attest.CertificationParameters, err error) {
@@ -476,24 +728,31 @@ func (k *Key) SetCertificateChain(ctx context.Context, chain []*x509.Certificate
 // toStorage transforms the Key to the struct used for
 // persisting Keys.
 func (k *Key) toStorage() *storage.Key {
+	policy, _ := k.auth.encode() // policies are always valid JSON
 	return &storage.Key{
 		Name:       k.name,
 		Data:       k.data,
 		AttestedBy: k.attestedBy,
 		Chain:      k.chain,
 		CreatedAt:  k.createdAt.UTC(),
+		Policy:     policy,
 	}
 }
 
 // keyFromStorage recreates a Key from the struct used for
 // persisting Keys.
-func keyFromStorage(sk *storage.Key, t *TPM) *Key {
+func keyFromStorage(sk *storage.Key, t *TPM) (*Key, error) {
+	auth, err := decodeKeyAuth(sk.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting key %q: %w", sk.Name, err)
+	}
 	return &Key{
 		name:       sk.Name,
 		data:       sk.Data,
 		attestedBy: sk.AttestedBy,
 		chain:      sk.Chain,
 		createdAt:  sk.CreatedAt.Local(),
+		auth:       auth,
 		tpm:        t,
-	}
+	}, nil
 }
@@ -0,0 +1,480 @@
+package tpm
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+)
+
+// Well-known NV indices defined in the TCG EK Credential Profile and
+// the TCG Registry of Reserved TPM 2.0 Handles. Not all TPMs have
+// certificates stored in all of them.
+const (
+	// EKCertificateRSAIndex is the NV index of the RSA 2048 EK certificate.
+	EKCertificateRSAIndex uint32 = 0x01C00002
+	// EKCertificateECCIndex is the NV index of the ECC NIST P-256 EK
+	// certificate.
+	EKCertificateECCIndex uint32 = 0x01C0000A
+	// EKCertificateRSA3072Index is the NV index of the RSA 3072 EK
+	// certificate in the high range.
+	EKCertificateRSA3072Index uint32 = 0x01C0001C
+	// EKCertificateECCP384Index is the NV index of the ECC NIST P-384 EK
+	// certificate in the high range.
+	EKCertificateECCP384Index uint32 = 0x01C00016
+	// PlatformCertificateIndex is the first NV index in the range
+	// reserved for platform certificates.
+	PlatformCertificateIndex uint32 = 0x01C08000
+)
+
+const (
+	// nvIndexFirst and nvIndexLast are the first and last
+	// handles in the NV index handle range.
+	nvIndexFirst uint32 = 0x01000000
+	nvIndexLast  uint32 = 0x01FFFFFF
+	// nvTypeMask masks the TPM_NT bits of the NV attributes,
+	// and nvTypeCounter is the TPM_NT value of counters.
+	nvTypeMask    NVAttributes = 0x000000F0
+	nvTypeCounter NVAttributes = 0x00000010
+	// counterSize is the size of a NV counter.
+	counterSize = 8
+)
+
+// NVAttributes is a bitmask with the attributes of a NV index, as
+// defined by TPMA_NV in the TPM 2.0 specification.
+type NVAttributes uint32
+
+// NV index attributes that can be set when defining a NV index.
+const (
+	// NVPPWrite allows writing the NV index with platform authorization.
+	NVPPWrite NVAttributes = NVAttributes(tpm2.AttrPPWrite)
+	// NVOwnerWrite allows writing the NV index with owner authorization.
+	NVOwnerWrite NVAttributes = NVAttributes(tpm2.AttrOwnerWrite)
+	// NVAuthWrite allows writing the NV index with its password.
+	NVAuthWrite NVAttributes = NVAttributes(tpm2.AttrAuthWrite)
+	// NVPolicyDelete requires a policy to delete the NV index.
+	NVPolicyDelete NVAttributes = NVAttributes(tpm2.AttrPolicyDelete)
+	// NVWriteDefine allows the NV index to be write locked permanently.
+	NVWriteDefine NVAttributes = NVAttributes(tpm2.AttrWriteDefine)
+	// NVPPRead allows reading the NV index with platform authorization.
+	NVPPRead NVAttributes = NVAttributes(tpm2.AttrPPRead)
+	// NVOwnerRead allows reading the NV index with owner authorization.
+	NVOwnerRead NVAttributes = NVAttributes(tpm2.AttrOwnerRead)
+	// NVAuthRead allows reading the NV index with its password.
+	NVAuthRead NVAttributes = NVAttributes(tpm2.AttrAuthRead)
+	// NVNoDA exempts the NV index from dictionary attack protections.
+	NVNoDA NVAttributes = NVAttributes(tpm2.AttrNoDA)
+)
+
+// NV index attributes set by the TPM.
+const (
+	// NVWriteLocked is set when the NV index can't be written.
+	NVWriteLocked NVAttributes = NVAttributes(tpm2.AttrWriteLocked)
+	// NVReadLocked is set when the NV index can't be read.
+	NVReadLocked NVAttributes = NVAttributes(tpm2.AttrReadLocked)
+	// NVWritten is set when the NV index has been written.
+	NVWritten NVAttributes = NVAttributes(tpm2.AttrWritten)
+	// NVPlatformCreate is set when the NV index was defined by the
+	// platform.
+	NVPlatformCreate NVAttributes = NVAttributes(tpm2.AttrPlatformCreate)
+)
+
+// defaultNVAttributes are the attributes used when defining a NV index
+// if none are provided.
+const defaultNVAttributes = NVOwnerWrite | NVOwnerRead | NVAuthWrite | NVAuthRead | NVNoDA
+
+// IsCounter returns whether the NV index is a monotonic counter.
+func (a NVAttributes) IsCounter() bool {
+	return a&nvTypeMask == nvTypeCounter
+}
+
+// String returns a textual representation of the NV attributes.
+func (a NVAttributes) String() string {
+	return tpm2.NVAttr(a).String()
+}
+
+// NVIndex models a NV index defined in a TPM 2.0.
+type NVIndex struct {
+	// Index is the handle of the NV index.
+	Index uint32
+	// Attributes are the attributes of the NV index.
+	Attributes NVAttributes
+	// Size is the size of the data in the NV index.
+	Size int
+	// AuthPolicy is the policy digest required to use the NV
+	// index, if set.
+	AuthPolicy []byte
+}
+
+// NVConfig is used to pass configuration when defining a NV index.
+type NVConfig struct {
+	// Size is the size of the data in the NV index. It's ignored
+	// for counters, which are always 8 bytes long.
+	Size int
+	// Counter defines a monotonic counter instead of an ordinary
+	// NV index.
+	Counter bool
+	// Password is the password of the NV index, used when the NV
+	// index is written or read with its own authorization.
+	Password string
+	// Attributes are the attributes of the NV index. If zero, the
+	// NV index can be written and read with owner authorization
+	// and with its password, and it's exempt from dictionary
+	// attack protections.
+	Attributes NVAttributes
+}
+
+func validateNVIndex(index uint32) error {
+	if index < nvIndexFirst || index > nvIndexLast {
+		return fmt.Errorf("invalid NV index 0x%08x", index)
+	}
+	return nil
+}
+
+// nvError transforms TPM errors returned for NV indices into ErrExists
+// or ErrNotFound errors, if possible.
+func nvError(index uint32, err error) error {
+	var (
+		tErr tpm2.Error
+		hErr tpm2.HandleError
+	)
+	switch {
+	case errors.As(err, &tErr) && tErr.Code == tpm2.RCNVDefined:
+		return fmt.Errorf("NV index 0x%08x %w", index, ErrExists)
+	case errors.As(err, &hErr) && hErr.Code == tpm2.RCHandle:
+		return fmt.Errorf("NV index 0x%08x %w", index, ErrNotFound)
+	default:
+		return err
+	}
+}
+
+// DefineNV defines a new NV index identified by `index` using the owner
+// hierarchy. If the NV index exists, `ErrExists` is returned.
+func (t *TPM) DefineNV(ctx context.Context, index uint32, config NVConfig) (err error) {
+	if err = validateNVIndex(index); err != nil {
+		return err
+	}
+
+	attrs := config.Attributes
+	if attrs == 0 {
+		attrs = defaultNVAttributes
+	}
+	if attrs&nvTypeMask != 0 {
+		return errors.New("invalid NV attributes: type must be set using Counter")
+	}
+
+	size := config.Size
+	switch {
+	case config.Counter:
+		attrs |= nvTypeCounter
+		size = counterSize
+	case size <= 0 || size > math.MaxUint16:
+		return fmt.Errorf("invalid NV index size %d", size)
+	}
+
+	if err = t.open(goTPMCall(ctx)); err != nil {
+		return fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	if err = tpm2.NVDefineSpaceEx(t.rwc, tpm2.HandleOwner, config.Password, tpm2.NVPublic{
+		NVIndex:    tpmutil.Handle(index),
+		NameAlg:    tpm2.AlgSHA256,
+		Attributes: tpm2.NVAttr(attrs),
+		DataSize:   uint16(size),
+	}, tpm2.AuthCommand{
+		Session:    tpm2.HandlePasswordSession,
+		Attributes: tpm2.AttrContinueSession,
+	}); err != nil {
+		return fmt.Errorf("failed defining NV index 0x%08x: %w", index, nvError(index, err))
+	}
+
+	return
+}
+
+// UndefineNV deletes the NV index identified by `index` using the owner
+// hierarchy. It returns `ErrNotFound` if the NV index doesn't exist.
+func (t *TPM) UndefineNV(ctx context.Context, index uint32) (err error) {
+	if err = validateNVIndex(index); err != nil {
+		return err
+	}
+
+	if err = t.open(goTPMCall(ctx)); err != nil {
+		return fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	if err = tpm2.NVUndefineSpace(t.rwc, "", tpm2.HandleOwner, tpmutil.Handle(index)); err != nil {
+		return fmt.Errorf("failed undefining NV index 0x%08x: %w", index, nvError(index, err))
+	}
+
+	return
+}
+
+// GetNV returns the public information of the NV index identified by
+// `index`. It returns `ErrNotFound` if the NV index doesn't exist.
+func (t *TPM) GetNV(ctx context.Context, index uint32) (nv *NVIndex, err error) {
+	if err = validateNVIndex(index); err != nil {
+		return nil, err
+	}
+
+	if err = t.open(goTPMCall(ctx)); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	return t.getNV(index)
+}
+
+func (t *TPM) getNV(index uint32) (*NVIndex, error) {
+	pub, err := tpm2.NVReadPublic(t.rwc, tpmutil.Handle(index))
+	if err != nil {
+		return nil, fmt.Errorf("failed reading NV index 0x%08x public area: %w", index, nvError(index, err))
+	}
+
+	return &NVIndex{
+		Index:      uint32(pub.NVIndex),
+		Attributes: NVAttributes(pub.Attributes),
+		Size:       int(pub.DataSize),
+		AuthPolicy: pub.AuthPolicy,
+	}, nil
+}
+
+// ListNV returns the NV indices defined in the TPM, ordered by index.
+func (t *TPM) ListNV(ctx context.Context) (nvs []*NVIndex, err error) {
+	if err = t.open(goTPMCall(ctx)); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	var handles []uint32
+	for next, more := nvIndexFirst, true; more; {
+		var vals []interface{}
+		vals, more, err = tpm2.GetCapability(t.rwc, tpm2.CapabilityHandles, math.MaxUint32, next)
+		if err != nil {
+			return nil, fmt.Errorf("failed getting NV indices: %w", err)
+		}
+		for _, v := range vals {
+			h, ok := v.(tpmutil.Handle)
+			if !ok {
+				return nil, fmt.Errorf("unexpected handle type %T", v)
+			}
+			if uint32(h) > nvIndexLast {
+				more = false
+				break
+			}
+			handles = append(handles, uint32(h))
+			next = uint32(h) + 1
+		}
+		if len(vals) == 0 {
+			break
+		}
+	}
+
+	nvs = make([]*NVIndex, 0, len(handles))
+	for _, h := range handles {
+		nv, err := t.getNV(h)
+		if err != nil {
+			return nil, err
+		}
+		nvs = append(nvs, nv)
+	}
+
+	return
+}
+
+// nvAuthHandle returns the handle used to authorize reading or writing
+// the NV index. The NV index own authorization is preferred over the
+// owner and platform authorizations.
+func nvAuthHandle(nv *NVIndex, auth, owner, platform NVAttributes) (tpmutil.Handle, error) {
+	switch {
+	case nv.Attributes&auth != 0:
+		return tpmutil.Handle(nv.Index), nil
+	case nv.Attributes&owner != 0:
+		return tpm2.HandleOwner, nil
+	case nv.Attributes&platform != 0:
+		return tpm2.HandlePlatform, nil
+	default:
+		return 0, fmt.Errorf("NV index 0x%08x does not support password authorization", nv.Index)
+	}
+}
+
+// nvBufferSize returns the maximum size of the data read from or written
+// to a NV index in a single command.
+func (t *TPM) nvBufferSize() (int, error) {
+	vals, _, err := tpm2.GetCapability(t.rwc, tpm2.CapabilityTPMProperties, 1, uint32(tpm2.NVMaxBufferSize))
+	if err != nil {
+		return 0, fmt.Errorf("failed getting NV buffer size: %w", err)
+	}
+	if len(vals) != 1 {
+		return 0, errors.New("failed getting NV buffer size: unexpected number of properties")
+	}
+	p, ok := vals[0].(tpm2.TaggedProperty)
+	if !ok || p.Tag != tpm2.NVMaxBufferSize || p.Value == 0 {
+		return 0, errors.New("failed getting NV buffer size: unexpected property")
+	}
+	return int(p.Value), nil
+}
+
+// WriteNV writes `data` to the NV index identified by `index`, starting at
+// `offset`. The `password` is used as the NV index password if the NV index
+// can be written with its own authorization; otherwise, it's used as the
+// owner or platform password.
+func (t *TPM) WriteNV(ctx context.Context, index uint32, data []byte, offset int, password string) (err error) {
+	if err = validateNVIndex(index); err != nil {
+		return err
+	}
+
+	if err = t.open(goTPMCall(ctx)); err != nil {
+		return fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	nv, err := t.getNV(index)
+	if err != nil {
+		return err
+	}
+	switch {
+	case nv.Attributes.IsCounter():
+		return fmt.Errorf("failed writing NV index 0x%08x: counters can only be incremented", index)
+	case offset < 0 || offset+len(data) > nv.Size:
+		return fmt.Errorf("failed writing NV index 0x%08x: %d bytes at offset %d exceed its size %d", index, len(data), offset, nv.Size)
+	}
+
+	authHandle, err := nvAuthHandle(nv, NVAuthWrite, NVOwnerWrite, NVPPWrite)
+	if err != nil {
+		return fmt.Errorf("failed writing NV index 0x%08x: %w", index, err)
+	}
+
+	blockSize, err := t.nvBufferSize()
+	if err != nil {
+		return err
+	}
+
+	for len(data) > 0 {
+		n := len(data)
+		if n > blockSize {
+			n = blockSize
+		}
+		if err = tpm2.NVWrite(t.rwc, authHandle, tpmutil.Handle(index), password, data[:n], uint16(offset)); err != nil {
+			return fmt.Errorf("failed writing NV index 0x%08x: %w", index, err)
+		}
+		data, offset = data[n:], offset+n
+	}
+
+	return
+}
+
+// ReadNV returns the data in the NV index identified by `index`. The
+// `password` is used as the NV index password if the NV index can be read
+// with its own authorization; otherwise, it's used as the owner or platform
+// password. It returns `ErrNotFound` if the NV index doesn't exist.
+func (t *TPM) ReadNV(ctx context.Context, index uint32, password string) (data []byte, err error) {
+	if err = validateNVIndex(index); err != nil {
+		return nil, err
+	}
+
+	if err = t.open(goTPMCall(ctx)); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	return t.readNV(index, password)
+}
+
+func (t *TPM) readNV(index uint32, password string) ([]byte, error) {
+	nv, err := t.getNV(index)
+	if err != nil {
+		return nil, err
+	}
+
+	authHandle, err := nvAuthHandle(nv, NVAuthRead, NVOwnerRead, NVPPRead)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading NV index 0x%08x: %w", index, err)
+	}
+
+	blockSize, err := t.nvBufferSize()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := tpm2.NVReadEx(t.rwc, tpmutil.Handle(index), authHandle, password, blockSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading NV index 0x%08x: %w", index, err)
+	}
+
+	return data, nil
+}
+
+// IncrementCounter increments the NV counter identified by `index` and
+// returns its new value. The `password` is used in the same way as in
+// [TPM.WriteNV].
+func (t *TPM) IncrementCounter(ctx context.Context, index uint32, password string) (value uint64, err error) {
+	if err = validateNVIndex(index); err != nil {
+		return 0, err
+	}
+
+	if err = t.open(goTPMCall(ctx)); err != nil {
+		return 0, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	nv, err := t.getNV(index)
+	if err != nil {
+		return 0, err
+	}
+	if !nv.Attributes.IsCounter() {
+		return 0, fmt.Errorf("failed incrementing NV index 0x%08x: NV index is not a counter", index)
+	}
+
+	authHandle, err := nvAuthHandle(nv, NVAuthWrite, NVOwnerWrite, NVPPWrite)
+	if err != nil {
+		return 0, fmt.Errorf("failed incrementing NV index 0x%08x: %w", index, err)
+	}
+	if authHandle != tpmutil.Handle(index) {
+		return 0, fmt.Errorf("failed incrementing NV index 0x%08x: only counters with the NVAuthWrite attribute are supported", index)
+	}
+
+	if err = tpm2.NVIncrement(t.rwc, authHandle, password); err != nil {
+		return 0, fmt.Errorf("failed incrementing NV index 0x%08x: %w", index, err)
+	}
+
+	data, err := t.readNV(index, password)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) != counterSize {
+		return 0, fmt.Errorf("failed reading NV index 0x%08x: unexpected counter size %d", index, len(data))
+	}
+
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// ReadNVCertificate reads and parses the X.509 certificate stored in the
+// NV index identified by `index`, such as the EK certificates in
+// [EKCertificateRSAIndex] and [EKCertificateECCIndex]. Data after the
+// DER encoded certificate, like the padding added by some manufacturers,
+// is ignored. It returns `ErrNotFound` if the NV index doesn't exist.
+func (t *TPM) ReadNVCertificate(ctx context.Context, index uint32) (*x509.Certificate, error) {
+	data, err := t.ReadNV(ctx, index, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed parsing certificate in NV index 0x%08x: %w", index, err)
+	}
+	cert, err := x509.ParseCertificate(raw.FullBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing certificate in NV index 0x%08x: %w", index, err)
+	}
+
+	return cert, nil
+}
@@ -0,0 +1,122 @@
+package tpm
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"sort"
+
+	"github.com/smallstep/go-attestation/attest"
+)
+
+// numPCRs is the number of PCRs in a TPM 2.0 PCR bank.
+const numPCRs = 24
+
+// PCR represents the value of a Platform Configuration Register
+// in a specific PCR bank.
+type PCR struct {
+	Index           int
+	Digest          []byte
+	DigestAlgorithm crypto.Hash
+}
+
+// PCRSelection selects a set of PCRs in a PCR bank. If PCRs is
+// empty, all PCRs in the bank are selected.
+type PCRSelection struct {
+	Bank crypto.Hash
+	PCRs []int
+}
+
+// indexes returns the PCR indexes in the selection. It returns all
+// PCR indexes if none were selected.
+func (s PCRSelection) indexes() ([]int, error) {
+	if len(s.PCRs) == 0 {
+		pcrs := make([]int, numPCRs)
+		for i := range pcrs {
+			pcrs[i] = i
+		}
+		return pcrs, nil
+	}
+
+	seen := make(map[int]bool, len(s.PCRs))
+	pcrs := make([]int, 0, len(s.PCRs))
+	for _, i := range s.PCRs {
+		if i < 0 || i >= numPCRs {
+			return nil, fmt.Errorf("invalid PCR index %d", i)
+		}
+		if !seen[i] {
+			seen[i] = true
+			pcrs = append(pcrs, i)
+		}
+	}
+	sort.Ints(pcrs)
+
+	return pcrs, nil
+}
+
+// hashAlgFromCrypto returns the attest.HashAlg for a PCR bank.
+func hashAlgFromCrypto(bank crypto.Hash) (attest.HashAlg, error) {
+	switch bank {
+	case crypto.SHA1:
+		return attest.HashSHA1, nil
+	case crypto.SHA256:
+		return attest.HashSHA256, nil
+	default:
+		return 0, fmt.Errorf("unsupported PCR bank %q", bank)
+	}
+}
+
+// ReadPCRs returns the current values of all PCRs in the PCR `bank`.
+// The PCRs are ordered by index. Supported banks are crypto.SHA1 and
+// crypto.SHA256.
+func (t *TPM) ReadPCRs(ctx context.Context, bank crypto.Hash) (pcrs []PCR, err error) {
+	alg, err := hashAlgFromCrypto(bank)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = t.open(ctx); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	return t.readPCRs(alg)
+}
+
+func (t *TPM) readPCRs(alg attest.HashAlg) ([]PCR, error) {
+	apcrs, err := t.attestTPM.PCRs(alg)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading %s PCRs: %w", alg, err)
+	}
+
+	pcrs := make([]PCR, 0, len(apcrs))
+	for _, p := range apcrs {
+		pcrs = append(pcrs, PCR{
+			Index:           p.Index,
+			Digest:          p.Digest,
+			DigestAlgorithm: p.DigestAlg,
+		})
+	}
+	sort.Slice(pcrs, func(i, j int) bool {
+		return pcrs[i].Index < pcrs[j].Index
+	})
+
+	return pcrs, nil
+}
+
+// MeasurementLog returns the raw TCG event log with the measurements made
+// by the platform during boot. The log can be parsed and replayed with the
+// eventlog package, and verified against PCR values from a quote.
+func (t *TPM) MeasurementLog(ctx context.Context) (log []byte, err error) {
+	if err = t.open(ctx); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	log, err = t.attestTPM.MeasurementLog()
+	if err != nil {
+		return nil, fmt.Errorf("failed reading measurement log: %w", err)
+	}
+
+	return log, nil
+}
@@ -0,0 +1,187 @@
+package tpm
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	internalkey "go.step.sm/crypto/tpm/internal/key"
+	"go.step.sm/crypto/tpm/tss2"
+)
+
+// commandPolicyAuthorize is the command code of TPM2_PolicyAuthorize.
+const commandPolicyAuthorize = 0x16A
+
+// KeyPolicy is used to pass the policy that has to be satisfied to
+// sign with a Key. The policies set are combined, so all of them
+// have to be satisfied.
+type KeyPolicy struct {
+	// Authorize allows the Key to be used with any policy signed by
+	// the authority. Signed policies are added to the Key with
+	// [Key.AddSignedPolicy], so that the PCR values the Key is bound
+	// to can be updated without creating a new Key. If nil, the Key
+	// doesn't accept signed policies.
+	Authorize *AuthorizePolicy
+	// PCRs binds the Key to the current values of the selected PCRs,
+	// so that it can only be used if the PCR values don't change. If
+	// nil, the Key is not bound to PCR values. Supported banks are
+	// crypto.SHA1 and crypto.SHA256.
+	PCRs *PCRSelection
+	// Or is satisfied if any of the policies is satisfied. Between 2
+	// and 8 policies are supported, and they can't use Authorize.
+	Or []KeyPolicy
+}
+
+// AuthorizePolicy is used to pass the authority allowed to sign
+// policies for a Key.
+type AuthorizePolicy struct {
+	// Authority is the public key used to verify signed policies.
+	// RSA and ECDSA keys are supported.
+	Authority crypto.PublicKey
+	// PolicyRef is an optional value that restricts the policies
+	// accepted to the ones signed for it.
+	PolicyRef []byte
+}
+
+// keyAuth is the authorization of a Key. It's persisted with the Key, so
+// that the Key can be used with the right policy session.
+type keyAuth struct {
+	Password   bool                 `json:"password,omitempty"`
+	Policy     []tss2.TPMPolicy     `json:"policy,omitempty"`
+	AuthPolicy []tss2.TPMAuthPolicy `json:"authPolicy,omitempty"`
+}
+
+// isEmpty returns whether the Key can be used without authorization.
+func (a *keyAuth) isEmpty() bool {
+	return a == nil || (!a.Password && len(a.Policy) == 0)
+}
+
+// hasAuthorize returns whether the Key accepts signed policies.
+func (a *keyAuth) hasAuthorize() bool {
+	return a != nil && len(a.Policy) > 0 && a.Policy[0].CommandCode == commandPolicyAuthorize
+}
+
+// createConfig returns the configuration used to create a Key with the
+// authorization.
+func (a *keyAuth) createConfig(algorithm string, size int, password string) (internalkey.CreateConfig, error) {
+	config := internalkey.CreateConfig{
+		Algorithm: algorithm,
+		Size:      size,
+		Password:  password,
+	}
+	if len(a.Policy) > 0 {
+		digest, err := tss2.PolicyDigest(a.Policy)
+		if err != nil {
+			return config, fmt.Errorf("failed computing policy digest: %w", err)
+		}
+		config.AuthPolicy = digest
+	}
+	return config, nil
+}
+
+func (a *keyAuth) encode() ([]byte, error) {
+	if a.isEmpty() {
+		return nil, nil
+	}
+	return json.Marshal(a)
+}
+
+func decodeKeyAuth(data []byte) (*keyAuth, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	a := new(keyAuth)
+	if err := json.Unmarshal(data, a); err != nil {
+		return nil, fmt.Errorf("failed decoding key policy: %w", err)
+	}
+	return a, nil
+}
+
+// PCRPolicy returns a TPM2_PolicyPCR policy for the current values of the
+// PCRs in the selection. The policy can be signed with [tss2.SignPolicy] to
+// authorize a Key created with an [AuthorizePolicy] for the current PCR
+// values.
+func (t *TPM) PCRPolicy(ctx context.Context, selection PCRSelection) (policy tss2.TPMPolicy, err error) {
+	if err = t.open(goTPMCall(ctx)); err != nil {
+		return policy, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	if policy, err = t.pcrPolicy(selection); err != nil {
+		return policy, fmt.Errorf("failed creating PCR policy: %w", err)
+	}
+
+	return
+}
+
+// keyAuth returns the authorization for a new Key with the given password
+// and policy. The TPM must be opened for go-tpm calls.
+func (t *TPM) keyAuth(password string, policy *KeyPolicy) (*keyAuth, error) {
+	auth := &keyAuth{
+		Password: password != "",
+	}
+	if policy == nil {
+		return auth, nil
+	}
+
+	if policy.Authorize != nil {
+		p, err := tss2.PolicyAuthorize(policy.Authorize.Authority, policy.Authorize.PolicyRef)
+		if err != nil {
+			return nil, fmt.Errorf("failed creating authorize policy: %w", err)
+		}
+		auth.Policy = append(auth.Policy, p)
+	}
+
+	policies, err := t.keyPolicies(*policy)
+	if err != nil {
+		return nil, err
+	}
+	auth.Policy = append(auth.Policy, policies...)
+
+	if len(auth.Policy) == 0 {
+		return nil, errors.New("invalid key policy: policy cannot be empty")
+	}
+	if auth.Password {
+		auth.Policy = append(auth.Policy, tss2.PolicyAuthValue())
+	}
+
+	return auth, nil
+}
+
+// keyPolicies returns the PCR and OR policies in the KeyPolicy.
+func (t *TPM) keyPolicies(policy KeyPolicy) ([]tss2.TPMPolicy, error) {
+	var policies []tss2.TPMPolicy
+	if policy.PCRs != nil {
+		p, err := t.pcrPolicy(*policy.PCRs)
+		if err != nil {
+			return nil, fmt.Errorf("failed creating PCR policy: %w", err)
+		}
+		policies = append(policies, p)
+	}
+
+	if len(policy.Or) > 0 {
+		branches := make([][]tss2.TPMPolicy, len(policy.Or))
+		for i, b := range policy.Or {
+			if b.Authorize != nil {
+				return nil, errors.New("invalid key policy: authorize policy cannot be used in an OR policy")
+			}
+			branch, err := t.keyPolicies(b)
+			if err != nil {
+				return nil, err
+			}
+			if len(branch) == 0 {
+				return nil, errors.New("invalid key policy: OR policy branches cannot be empty")
+			}
+			branches[i] = branch
+		}
+		p, err := tss2.PolicyOR(branches...)
+		if err != nil {
+			return nil, fmt.Errorf("failed creating OR policy: %w", err)
+		}
+		policies = append(policies, p)
+	}
+
+	return policies, nil
+}
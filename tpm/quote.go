@@ -0,0 +1,237 @@
+package tpm
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+)
+
+// Quote is the result of a TPM2_Quote operation performed with an AK.
+// It contains the TPMS_ATTEST structure signed by the AK, the signature
+// in TPMT_SIGNATURE format, and the values of the quoted PCRs.
+type Quote struct {
+	Quote     []byte
+	Signature []byte
+	PCRs      []PCR
+}
+
+// Quote returns a quote over the PCRs in `selection`, signed by the AK.
+// The nonce is included in the quote to prevent replays. Some TPMs
+// don't support nonces longer than 20 bytes, so longer data should
+// be hashed to construct the nonce.
+//
+// The PCR values are read after the quote has been generated, and are
+// checked against the digest in the quote, so that the returned PCRs
+// are the ones covered by the quote.
+func (ak *AK) Quote(ctx context.Context, nonce []byte, selection PCRSelection) (quote *Quote, err error) {
+	alg, err := hashAlgFromCrypto(selection.Bank)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := selection.indexes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = ak.tpm.open(ctx); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, ak.tpm, &err)
+
+	loadedAK, err := ak.tpm.attestTPM.LoadAK(ak.data)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading AK %q: %w", ak.name, err)
+	}
+	defer loadedAK.Close(ak.tpm.attestTPM)
+
+	q, err := loadedAK.QuotePCRs(ak.tpm.attestTPM, nonce, alg, indexes)
+	if err != nil {
+		return nil, fmt.Errorf("failed quoting PCRs with AK %q: %w", ak.name, err)
+	}
+
+	pcrs, err := ak.tpm.readPCRs(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[int]bool, len(indexes))
+	for _, i := range indexes {
+		selected[i] = true
+	}
+	quote = &Quote{
+		Quote:     q.Quote,
+		Signature: q.Signature,
+		PCRs:      make([]PCR, 0, len(indexes)),
+	}
+	for _, p := range pcrs {
+		if selected[p.Index] {
+			quote.PCRs = append(quote.PCRs, p)
+		}
+	}
+
+	// PCRs can be extended between quoting and reading them. Fail if that
+	// happened, so that a quote with inconsistent values isn't returned.
+	akPublic, err := ak.public(internalCall(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed getting AK public key: %w", err)
+	}
+	if _, _, err := verifyQuoteSignature(akPublic, quote, nonce); err != nil {
+		return nil, fmt.Errorf("failed verifying quote: %w", err)
+	}
+
+	return quote, nil
+}
+
+// PCRMismatchError is returned by VerifyQuote if the value of a quoted PCR
+// does not match the expected value.
+type PCRMismatchError struct {
+	Index    int
+	Expected []byte
+	Actual   []byte
+}
+
+func (e *PCRMismatchError) Error() string {
+	return fmt.Sprintf("PCR %d has value %x; expected %x", e.Index, e.Actual, e.Expected)
+}
+
+// VerifyQuote verifies the quote signature using the AK public key, checks
+// that the nonce in the quote matches `nonce`, and that the PCR values in the
+// quote are the ones covered by the signed PCR digest. PCRs that are not part
+// of the signed PCR selection result in an error. Then it checks that the
+// quoted PCRs have the `expected` values. An expected PCR that is not part of
+// the quote will result in an error. If a quoted PCR does not have the expected
+// value a *PCRMismatchError is returned.
+func VerifyQuote(akPublic crypto.PublicKey, quote *Quote, nonce []byte, expected []PCR) error {
+	if quote == nil {
+		return errors.New("quote cannot be nil")
+	}
+
+	bank, quoted, err := verifyQuoteSignature(akPublic, quote, nonce)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range expected {
+		if e.DigestAlgorithm != 0 && e.DigestAlgorithm != bank {
+			return fmt.Errorf("expected PCR %d uses bank %s, but quote uses bank %s", e.Index, e.DigestAlgorithm, bank)
+		}
+		actual, ok := quoted[e.Index]
+		if !ok {
+			return fmt.Errorf("expected PCR %d is not part of the quote", e.Index)
+		}
+		if !bytes.Equal(actual, e.Digest) {
+			return &PCRMismatchError{Index: e.Index, Expected: e.Digest, Actual: actual}
+		}
+	}
+
+	return nil
+}
+
+// verifyQuoteSignature verifies the quote signature and the digest of
+// the PCR values. It returns the PCR bank used in the quote and the values of
+// the PCRs in the signed PCR selection.
+func verifyQuoteSignature(akPublic crypto.PublicKey, quote *Quote, nonce []byte) (crypto.Hash, map[int][]byte, error) {
+	sig, err := tpm2.DecodeSignature(bytes.NewBuffer(quote.Signature))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed decoding quote signature: %w", err)
+	}
+
+	var sigHashAlg tpm2.Algorithm
+	switch {
+	case sig.RSA != nil:
+		sigHashAlg = sig.RSA.HashAlg
+	case sig.ECC != nil:
+		sigHashAlg = sig.ECC.HashAlg
+	default:
+		return 0, nil, fmt.Errorf("unsupported quote signature algorithm %s", sig.Alg)
+	}
+	sigHash, err := sigHashAlg.Hash()
+	if err != nil {
+		return 0, nil, fmt.Errorf("unsupported quote signature hash algorithm: %w", err)
+	}
+
+	h := sigHash.New()
+	h.Write(quote.Quote)
+	digest := h.Sum(nil)
+
+	switch pub := akPublic.(type) {
+	case *rsa.PublicKey:
+		switch {
+		case sig.RSA == nil:
+			return 0, nil, errors.New("invalid quote signature: RSA public key provided for ECC signature")
+		case sig.Alg == tpm2.AlgRSAPSS:
+			err = rsa.VerifyPSS(pub, sigHash, digest, sig.RSA.Signature, nil)
+		default:
+			err = rsa.VerifyPKCS1v15(pub, sigHash, digest, sig.RSA.Signature)
+		}
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid quote signature: %w", err)
+		}
+	case *ecdsa.PublicKey:
+		if sig.ECC == nil {
+			return 0, nil, errors.New("invalid quote signature: ECDSA public key provided for RSA signature")
+		}
+		if !ecdsa.Verify(pub, digest, sig.ECC.R, sig.ECC.S) {
+			return 0, nil, errors.New("invalid quote signature")
+		}
+	default:
+		return 0, nil, fmt.Errorf("unsupported AK public key type %T", akPublic)
+	}
+
+	att, err := tpm2.DecodeAttestationData(quote.Quote)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed decoding quote: %w", err)
+	}
+	if att.Type != tpm2.TagAttestQuote || att.AttestedQuoteInfo == nil {
+		return 0, nil, fmt.Errorf("attestation data is not a quote; got type 0x%x", att.Type)
+	}
+	if !bytes.Equal(att.ExtraData, nonce) {
+		return 0, nil, errors.New("quote nonce does not match")
+	}
+
+	selection := att.AttestedQuoteInfo.PCRSelection
+	bank, err := selection.Hash.Hash()
+	if err != nil {
+		return 0, nil, fmt.Errorf("unsupported quote PCR bank: %w", err)
+	}
+
+	selected := make(map[int]bool, len(selection.PCRs))
+	for _, i := range selection.PCRs {
+		selected[i] = true
+	}
+
+	// Only the PCRs in the signed selection are covered by the quote, so any
+	// other PCR value could have been forged.
+	values := make(map[int][]byte, len(selection.PCRs))
+	for _, p := range quote.PCRs {
+		if p.DigestAlgorithm != bank || !selected[p.Index] {
+			return 0, nil, fmt.Errorf("PCR %d in bank %s is not part of the quote PCR selection", p.Index, p.DigestAlgorithm)
+		}
+		if _, ok := values[p.Index]; ok {
+			return 0, nil, fmt.Errorf("PCR %d is provided more than once", p.Index)
+		}
+		values[p.Index] = p.Digest
+	}
+
+	// The PCR digest is the hash of the concatenation of the selected PCR
+	// values, in ascending order, using the hash algorithm of the signature.
+	h = sigHash.New()
+	for _, i := range selection.PCRs {
+		v, ok := values[i]
+		if !ok {
+			return 0, nil, fmt.Errorf("quote was over PCR %d which wasn't provided", i)
+		}
+		h.Write(v)
+	}
+	if !bytes.Equal(h.Sum(nil), att.AttestedQuoteInfo.PCRDigest) {
+		return 0, nil, errors.New("quote PCR digest does not match the provided PCR values")
+	}
+
+	return bank, values, nil
+}
@@ -0,0 +1,184 @@
+package tpm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // SHA-1 PCR bank
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPCRs(bank crypto.Hash, indexes ...int) []PCR {
+	pcrs := make([]PCR, len(indexes))
+	for i, index := range indexes {
+		h := bank.New()
+		h.Write([]byte{byte(index)})
+		pcrs[i] = PCR{Index: index, Digest: h.Sum(nil), DigestAlgorithm: bank}
+	}
+	return pcrs
+}
+
+// newTestQuote creates a quote over `pcrs` signed by `signer`, emulating
+// the output of TPM2_Quote.
+func newTestQuote(t *testing.T, signer crypto.Signer, nonce []byte, bank tpm2.Algorithm, pcrs []PCR) *Quote {
+	t.Helper()
+
+	h := sha256.New()
+	selection := tpm2.PCRSelection{Hash: bank}
+	for _, p := range pcrs {
+		h.Write(p.Digest)
+		selection.PCRs = append(selection.PCRs, p.Index)
+	}
+	handle := tpmutil.Handle(0x80000001)
+	att := tpm2.AttestationData{
+		Magic:           0xff544347,
+		Type:            tpm2.TagAttestQuote,
+		QualifiedSigner: tpm2.Name{Handle: &handle},
+		ExtraData:       nonce,
+		AttestedQuoteInfo: &tpm2.QuoteInfo{
+			PCRSelection: selection,
+			PCRDigest:    h.Sum(nil),
+		},
+	}
+	data, err := att.Encode()
+	require.NoError(t, err)
+
+	digest := sha256.Sum256(data)
+	var tpmSig tpm2.Signature
+	switch key := signer.(type) {
+	case *rsa.PrivateKey:
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+		tpmSig = tpm2.Signature{
+			Alg: tpm2.AlgRSASSA,
+			RSA: &tpm2.SignatureRSA{HashAlg: tpm2.AlgSHA256, Signature: sig},
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+		tpmSig = tpm2.Signature{
+			Alg: tpm2.AlgECDSA,
+			ECC: &tpm2.SignatureECC{HashAlg: tpm2.AlgSHA256, R: r, S: s},
+		}
+	default:
+		t.Fatalf("unsupported key type %T", signer)
+	}
+	sigData, err := tpmSig.Encode()
+	require.NoError(t, err)
+
+	return &Quote{
+		Quote:     data,
+		Signature: sigData,
+		PCRs:      pcrs,
+	}
+}
+
+func TestVerifyQuote(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	nonce := []byte("nonce")
+	pcrs := newTestPCRs(crypto.SHA256, 0, 1, 7)
+	sha1PCRs := newTestPCRs(crypto.SHA1, 0, 7)
+	rsaQuote := newTestQuote(t, rsaKey, nonce, tpm2.AlgSHA256, pcrs)
+	ecQuote := newTestQuote(t, ecKey, nonce, tpm2.AlgSHA256, pcrs)
+	sha1Quote := newTestQuote(t, rsaKey, nonce, tpm2.AlgSHA1, sha1PCRs)
+
+	tamperedPCRs := newTestPCRs(crypto.SHA256, 0, 1, 7)
+	tamperedPCRs[1].Digest = make([]byte, 32)
+	tamperedQuote := *rsaQuote
+	tamperedQuote.PCRs = tamperedPCRs
+
+	missingQuote := *rsaQuote
+	missingQuote.PCRs = pcrs[:2]
+
+	// a forged PCR 7 appended to a quote over PCRs 0 and 1
+	partialQuote := newTestQuote(t, rsaKey, nonce, tpm2.AlgSHA256, pcrs[:2])
+	forgedQuote := *partialQuote
+	forgedQuote.PCRs = append(append([]PCR{}, pcrs[:2]...), pcrs[2])
+
+	otherBankQuote := *rsaQuote
+	otherBankQuote.PCRs = append(append([]PCR{}, pcrs...), sha1PCRs[1])
+
+	duplicateQuote := *rsaQuote
+	duplicateQuote.PCRs = append(append([]PCR{}, pcrs...), pcrs[2])
+
+	mismatch := newTestPCRs(crypto.SHA256, 7)
+	mismatch[0].Digest = make([]byte, 32)
+
+	sum := sha1.Sum([]byte{7}) //nolint:gosec // SHA-1 PCR bank
+
+	tests := []struct {
+		name     string
+		akPublic crypto.PublicKey
+		quote    *Quote
+		nonce    []byte
+		expected []PCR
+		wantErr  bool
+	}{
+		{"ok rsa", rsaKey.Public(), rsaQuote, nonce, pcrs, false},
+		{"ok ecdsa", ecKey.Public(), ecQuote, nonce, pcrs, false},
+		{"ok subset", rsaKey.Public(), rsaQuote, nonce, pcrs[2:], false},
+		{"ok no expected", rsaKey.Public(), rsaQuote, nonce, nil, false},
+		{"ok sha1", rsaKey.Public(), sha1Quote, nonce, []PCR{{Index: 7, Digest: sum[:]}}, false},
+		{"fail nil", rsaKey.Public(), nil, nonce, pcrs, true},
+		{"fail wrong key", ecKey.Public(), rsaQuote, nonce, pcrs, true},
+		{"fail other key", &rsa.PublicKey{N: rsaKey.N, E: 3}, rsaQuote, nonce, pcrs, true},
+		{"fail key type", []byte("key"), rsaQuote, nonce, pcrs, true},
+		{"fail nonce", rsaKey.Public(), rsaQuote, []byte("other"), pcrs, true},
+		{"fail tampered pcrs", rsaKey.Public(), &tamperedQuote, nonce, nil, true},
+		{"fail missing pcr", rsaKey.Public(), &missingQuote, nonce, nil, true},
+		{"fail pcr not in selection", rsaKey.Public(), &forgedQuote, nonce, pcrs, true},
+		{"fail pcr not in selection no expected", rsaKey.Public(), &forgedQuote, nonce, nil, true},
+		{"fail pcr in other bank", rsaKey.Public(), &otherBankQuote, nonce, nil, true},
+		{"fail duplicate pcr", rsaKey.Public(), &duplicateQuote, nonce, nil, true},
+		{"fail not quoted", rsaKey.Public(), rsaQuote, nonce, newTestPCRs(crypto.SHA256, 2), true},
+		{"fail bank", rsaKey.Public(), rsaQuote, nonce, newTestPCRs(crypto.SHA1, 0), true},
+		{"fail signature", rsaKey.Public(), &Quote{Quote: rsaQuote.Quote, Signature: []byte{0, 1}}, nonce, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyQuote(tt.akPublic, tt.quote, tt.nonce, tt.expected)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	err = VerifyQuote(rsaKey.Public(), rsaQuote, nonce, mismatch)
+	var pcrErr *PCRMismatchError
+	require.True(t, errors.As(err, &pcrErr))
+	assert.Equal(t, 7, pcrErr.Index)
+	assert.Equal(t, mismatch[0].Digest, pcrErr.Expected)
+	assert.Equal(t, pcrs[2].Digest, pcrErr.Actual)
+}
+
+func TestPCRSelection_indexes(t *testing.T) {
+	all, err := PCRSelection{Bank: crypto.SHA256}.indexes()
+	require.NoError(t, err)
+	assert.Len(t, all, 24)
+	assert.Equal(t, 0, all[0])
+	assert.Equal(t, 23, all[23])
+
+	got, err := PCRSelection{Bank: crypto.SHA256, PCRs: []int{7, 0, 7, 4}}.indexes()
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 4, 7}, got)
+
+	_, err = PCRSelection{Bank: crypto.SHA256, PCRs: []int{24}}.indexes()
+	assert.Error(t, err)
+	_, err = PCRSelection{Bank: crypto.SHA256, PCRs: []int{-1}}.indexes()
+	assert.Error(t, err)
+}
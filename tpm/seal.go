@@ -0,0 +1,294 @@
+package tpm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+
+	"go.step.sm/crypto/tpm/storage"
+	"go.step.sm/crypto/tpm/tss2"
+)
+
+// SealedData models data sealed to a TPM 2.0. Sealed data can
+// only be unsealed by the TPM that sealed it, and only if the
+// policy set when sealing it is satisfied.
+type SealedData struct {
+	name      string
+	data      []byte
+	createdAt time.Time
+	tpm       *TPM
+}
+
+// Name returns the SealedData name. The name uniquely
+// identifies the SealedData if a TPM with persistent
+// storage is used.
+func (s *SealedData) Name() string {
+	return s.name
+}
+
+// Data returns the SealedData data blob. The data blob is
+// the sealed object in the TSS2 format, in ASN.1 DER form.
+func (s *SealedData) Data() []byte {
+	return s.data
+}
+
+// CreatedAt returns the the creation time of the SealedData.
+func (s *SealedData) CreatedAt() time.Time {
+	return s.createdAt.Truncate(time.Second)
+}
+
+// MarshalJSON marshals the SealedData to JSON.
+func (s *SealedData) MarshalJSON() ([]byte, error) {
+	o := struct {
+		Name      string    `json:"name"`
+		Data      []byte    `json:"data"`
+		CreatedAt time.Time `json:"createdAt"`
+	}{
+		Name:      s.name,
+		Data:      s.data,
+		CreatedAt: s.createdAt,
+	}
+	return json.Marshal(o)
+}
+
+// ToTSS2 returns the SealedData as a [*tss2.TPMKey]. The key can be
+// encoded to a "TSS2 PRIVATE KEY" PEM block using the sealed key
+// type, and unsealed by other tools supporting the format.
+func (s *SealedData) ToTSS2() (*tss2.TPMKey, error) {
+	key, err := tss2.ParsePrivateKey(s.data)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing sealed data %q: %w", s.name, err)
+	}
+	return key, nil
+}
+
+// Unseal returns the data sealed in the SealedData. The password is
+// required if it was set when sealing the data.
+func (s *SealedData) Unseal(ctx context.Context, password string) ([]byte, error) {
+	key, err := s.ToTSS2()
+	if err != nil {
+		return nil, err
+	}
+	return s.tpm.UnsealTSS2(ctx, key, password)
+}
+
+// SealPolicy is used to pass the policy that has to be satisfied
+// to unseal data.
+type SealPolicy struct {
+	// PCRs binds the data to the current values of the selected PCRs,
+	// so that it can only be unsealed if the PCR values don't change.
+	// If nil, the data is not bound to PCR values. Supported banks are
+	// crypto.SHA1 and crypto.SHA256.
+	PCRs *PCRSelection
+	// Password is the password required to unseal the data. If
+	// empty, no password is required.
+	Password string
+}
+
+// Seal seals `secret` to the TPM, creating a new SealedData identified by
+// `name`. If no name is provided, a random 10 character name is generated.
+// If a SealedData with the same name exists, `ErrExists` is returned. The
+// secret can be at most 128 bytes long, so it's usually a key protecting
+// larger data.
+func (t *TPM) Seal(ctx context.Context, name string, secret []byte, policy SealPolicy) (sealed *SealedData, err error) {
+	if err = t.open(goTPMCall(ctx)); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	now := time.Now()
+	if name, err = processName(name); err != nil {
+		return nil, err
+	}
+
+	_, err = t.store.GetSealedData(name)
+	switch {
+	case err == nil:
+		return nil, fmt.Errorf("failed sealing data %q: %w", name, ErrExists)
+	case errors.Is(err, storage.ErrNoStorageConfigured):
+		return nil, fmt.Errorf("failed sealing data %q: %w", name, err)
+	}
+
+	var policies []tss2.TPMPolicy
+	if policy.PCRs != nil {
+		pcrPolicy, err := t.pcrPolicy(*policy.PCRs)
+		if err != nil {
+			return nil, fmt.Errorf("failed creating PCR policy: %w", err)
+		}
+		policies = append(policies, pcrPolicy)
+		if policy.Password != "" {
+			policies = append(policies, tss2.PolicyAuthValue())
+		}
+	}
+
+	key, err := tss2.Seal(t.rwc, secret, policy.Password, policies...)
+	if err != nil {
+		return nil, fmt.Errorf("failed sealing data %q: %w", name, err)
+	}
+
+	data, err := tss2.MarshalPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshaling sealed data %q: %w", name, err)
+	}
+
+	sealed = &SealedData{
+		name:      name,
+		data:      data,
+		createdAt: now,
+		tpm:       t,
+	}
+
+	if err := t.store.AddSealedData(sealed.toStorage()); err != nil {
+		return nil, fmt.Errorf("failed adding sealed data %q to storage: %w", name, err)
+	}
+
+	if err := t.store.Persist(); err != nil {
+		return nil, fmt.Errorf("failed persisting sealed data %q to storage: %w", name, err)
+	}
+
+	return
+}
+
+// pcrPolicy returns a TPM2_PolicyPCR policy for the current values of
+// the PCRs in the selection.
+func (t *TPM) pcrPolicy(selection PCRSelection) (tss2.TPMPolicy, error) {
+	alg, err := hashAlgFromCrypto(selection.Bank)
+	if err != nil {
+		return tss2.TPMPolicy{}, err
+	}
+	indexes, err := selection.indexes()
+	if err != nil {
+		return tss2.TPMPolicy{}, err
+	}
+
+	policy, err := tss2.PolicyPCRFromTPM(t.rwc, tpm2.PCRSelection{
+		Hash: tpm2.Algorithm(alg),
+		PCRs: indexes,
+	})
+	if err != nil {
+		return tss2.TPMPolicy{}, fmt.Errorf("failed reading %s PCRs: %w", alg, err)
+	}
+
+	return policy, nil
+}
+
+// Unseal returns the data sealed in the SealedData identified by `name`.
+// It returns `ErrNotFound` if it doesn't exist. The password is required
+// if it was set when sealing the data.
+func (t *TPM) Unseal(ctx context.Context, name, password string) (data []byte, err error) {
+	if err = t.open(goTPMCall(ctx)); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	sealed, err := t.GetSealedData(internalCall(ctx), name)
+	if err != nil {
+		return nil, err
+	}
+
+	return sealed.Unseal(internalCall(ctx), password)
+}
+
+// UnsealTSS2 returns the data sealed in the TSS2 `key`. The key must have
+// been sealed to the TPM, and have the sealed key type. The password is
+// required if the key doesn't have an empty auth.
+func (t *TPM) UnsealTSS2(ctx context.Context, key *tss2.TPMKey, password string) (data []byte, err error) {
+	if err = t.open(goTPMCall(ctx)); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	if data, err = tss2.Unseal(t.rwc, key, password); err != nil {
+		return nil, fmt.Errorf("failed unsealing data: %w", err)
+	}
+
+	return
+}
+
+// GetSealedData returns the SealedData identified by `name`. It returns
+// `ErrNotfound` if it doesn't exist.
+func (t *TPM) GetSealedData(ctx context.Context, name string) (sealed *SealedData, err error) {
+	if err = t.open(ctx); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	ssd, err := t.store.GetSealedData(name)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("failed getting sealed data %q: %w", name, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed getting sealed data %q: %w", name, err)
+	}
+
+	return sealedDataFromStorage(ssd, t), nil
+}
+
+// ListSealedData returns a slice of SealedData. The result is
+// (currently) not ordered.
+func (t *TPM) ListSealedData(ctx context.Context) (sealed []*SealedData, err error) {
+	if err = t.open(ctx); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	ssds, err := t.store.ListSealedData()
+	if err != nil {
+		return nil, fmt.Errorf("failed listing sealed data: %w", err)
+	}
+
+	sealed = make([]*SealedData, 0, len(ssds))
+	for _, ssd := range ssds {
+		sealed = append(sealed, sealedDataFromStorage(ssd, t))
+	}
+
+	return
+}
+
+// DeleteSealedData removes the SealedData identified by `name`. It returns
+// `ErrNotfound` if it doesn't exist. Sealed data objects are not persisted
+// in the TPM, so deleting it from storage makes the data unrecoverable.
+func (t *TPM) DeleteSealedData(ctx context.Context, name string) (err error) {
+	if err := t.open(ctx); err != nil {
+		return fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, t, &err)
+
+	if err := t.store.DeleteSealedData(name); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("failed deleting sealed data %q: %w", name, ErrNotFound)
+		}
+		return fmt.Errorf("failed deleting sealed data %q from storage: %w", name, err)
+	}
+
+	if err := t.store.Persist(); err != nil {
+		return fmt.Errorf("failed persisting storage: %w", err)
+	}
+
+	return
+}
+
+// toStorage transforms the SealedData to the struct used for
+// persisting SealedData.
+func (s *SealedData) toStorage() *storage.SealedData {
+	return &storage.SealedData{
+		Name:      s.name,
+		Data:      s.data,
+		CreatedAt: s.createdAt.UTC(),
+	}
+}
+
+// sealedDataFromStorage recreates a SealedData from the struct
+// used for persisting SealedData.
+func sealedDataFromStorage(ssd *storage.SealedData, t *TPM) *SealedData {
+	return &SealedData{
+		name:      ssd.Name,
+		data:      ssd.Data,
+		createdAt: ssd.CreatedAt.Local(),
+		tpm:       t,
+	}
+}
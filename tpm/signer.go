@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 
+	internalkey "go.step.sm/crypto/tpm/internal/key"
 	"go.step.sm/crypto/tpm/storage"
 	"go.step.sm/crypto/tpm/tss2"
 )
@@ -55,6 +56,14 @@ func (s *signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) (si
 
 // GetSigner returns a crypto.Signer for a TPM Key identified by `name`.
 func (t *TPM) GetSigner(ctx context.Context, name string) (csigner crypto.Signer, err error) {
+	return t.GetSignerWithPassword(ctx, name, "")
+}
+
+// GetSignerWithPassword returns a crypto.Signer for a TPM Key identified by
+// `name`, using `password` to authorize signing with it. If the Key has a
+// policy, the policy session is started and satisfied on each call to Sign().
+// The password is ignored if the Key doesn't require one.
+func (t *TPM) GetSignerWithPassword(ctx context.Context, name, password string) (csigner crypto.Signer, err error) {
 	if err = t.open(ctx); err != nil {
 		return nil, fmt.Errorf("failed opening TPM: %w", err)
 	}
@@ -68,6 +77,14 @@ func (t *TPM) GetSigner(ctx context.Context, name string) (csigner crypto.Signer
 		return nil, fmt.Errorf("failed getting signer for key %q: %w", name, err)
 	}
 
+	auth, err := decodeKeyAuth(key.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting signer for key %q: %w", name, err)
+	}
+	if !auth.isEmpty() {
+		return newPolicySigner(t, name, key.Data, auth, password)
+	}
+
 	loadedKey, err := t.attestTPM.LoadKey(key.Data)
 	if err != nil {
 		return nil, err
@@ -92,6 +109,80 @@ func (t *TPM) GetSigner(ctx context.Context, name string) (csigner crypto.Signer
 	return
 }
 
+// policySigner implements crypto.Signer backed by a TPM key that
+// requires a password or a policy session. The key is loaded with
+// a [*tss2.Signer] on every call to Sign().
+type policySigner struct {
+	tpm      *TPM
+	name     string
+	key      *tss2.TPMKey
+	password string
+	public   crypto.PublicKey
+}
+
+func newPolicySigner(t *TPM, name string, data []byte, auth *keyAuth, password string) (*policySigner, error) {
+	key, err := storedTSS2Key(data, auth)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting signer for key %q: %w", name, err)
+	}
+	pub, err := key.Public()
+	if err != nil {
+		return nil, fmt.Errorf("failed getting public key for key %q: %w", name, err)
+	}
+
+	return &policySigner{
+		tpm:      t,
+		name:     name,
+		key:      key,
+		password: password,
+		public:   pub,
+	}, nil
+}
+
+// Public returns the signers public key.
+func (s *policySigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign implements crypto.Signer. The policy of the TPM key is
+// satisfied before signing, so the PCR values are checked on
+// every call.
+func (s *policySigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	ctx := context.Background()
+	if err = s.tpm.open(goTPMCall(ctx)); err != nil {
+		return nil, fmt.Errorf("failed opening TPM: %w", err)
+	}
+	defer closeTPM(ctx, s.tpm, &err)
+
+	signer, err := tss2.CreateSigner(s.tpm.rwc, s.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading TPM key %q: %w", s.name, err)
+	}
+	signer.SetPassword(s.password)
+
+	return signer.Sign(rand, digest, opts)
+}
+
+// storedTSS2Key returns the [*tss2.TPMKey] for the serialized key data
+// and its authorization, without loading the key in the TPM.
+func storedTSS2Key(data []byte, auth *keyAuth) (*tss2.TPMKey, error) {
+	public, private, err := internalkey.Blobs(data)
+	if err != nil {
+		return nil, err
+	}
+	opts := []tss2.TPMOption{
+		tss2.WithParent(commonSrkEquivalentHandle), // default parent used by go-tpm/go-attestation
+	}
+	if auth != nil {
+		opts = append(opts,
+			tss2.WithEmptyAuth(!auth.Password),
+			tss2.WithPolicy(auth.Policy...),
+			tss2.WithAuthPolicy(auth.AuthPolicy...),
+		)
+	}
+	return tss2.New(public, private, opts...), nil
+}
+
 // tss2Signer is a wrapper on top of [*tss2.Signer] that opens and closes the
 // tpm on each sign call.
 type tss2Signer struct {
@@ -111,7 +202,16 @@ func (s *tss2Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts)
 }
 
 // CreateTSS2Signer returns a crypto.Signer using the given [TPM] and [tss2.TPMKey].
+// Importable keys, like the ones created with [tss2.CreateImportable], are
+// imported into the TPM the first time they are used to sign.
 func CreateTSS2Signer(ctx context.Context, t *TPM, key *tss2.TPMKey) (csigner crypto.Signer, err error) {
+	return CreateTSS2SignerWithPassword(ctx, t, key, "")
+}
+
+// CreateTSS2SignerWithPassword returns a crypto.Signer using the given [TPM]
+// and [tss2.TPMKey], using `password` to authorize signing with the key. The
+// policy in the [tss2.TPMKey] is satisfied on each call to Sign().
+func CreateTSS2SignerWithPassword(ctx context.Context, t *TPM, key *tss2.TPMKey, password string) (csigner crypto.Signer, err error) {
 	if err := t.open(goTPMCall(ctx)); err != nil {
 		return nil, fmt.Errorf("failed opening TPM: %w", err)
 	}
@@ -121,6 +221,7 @@ func CreateTSS2Signer(ctx context.Context, t *TPM, key *tss2.TPMKey) (csigner cr
 	if err != nil {
 		return nil, fmt.Errorf("failed creating TSS2 signer: %w", err)
 	}
+	s.SetPassword(password)
 
 	csigner = &tss2Signer{
 		Signer: s,
@@ -1,13 +1,21 @@
-//nolint:unused // ignore unused types for now
+// Package skae implements the Subject Key Attestation Evidence (SKAE)
+// X.509 certificate extension defined by the Trusted Computing Group. The
+// extension carries the evidence of a TPM key being certified by an AK, so
+// that relying parties can verify that the private key of a certificate
+// resides in a TPM using the leaf certificate and the AK certificate.
 package skae
 
 import (
+	"bytes"
+	"crypto"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"errors"
+	"fmt"
 	"math/big"
 
+	"github.com/google/go-tpm/legacy/tpm2"
 	"github.com/smallstep/go-attestation/attest"
 )
 
@@ -17,102 +25,250 @@ var (
 	oidAuthorityInfoAccessIssuers    = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 2}
 )
 
-func CreateSubjectKeyAttestationEvidenceExtension(_ *x509.Certificate, _ attest.CertificationParameters, _ bool) (pkix.Extension, error) {
-	return pkix.Extension{}, errors.New("not implemented yet") // return early; not verified to be working as expected yet
+const (
+	// nameTypeURI is the tag of the uniformResourceIdentifier
+	// GeneralName.
+	nameTypeURI = 6
+	// attestEvidenceTag and envelopedAttestEvidenceTag are the tags of
+	// the KeyAttestationEvidence CHOICE.
+	attestEvidenceTag          = 0
+	envelopedAttestEvidenceTag = 1
+)
 
-	/*
-		asn1Issuer, err := asn1.Marshal(akCert.Issuer.ToRDNSequence()) //nolint:govet // intentionally breaking early
-		if err != nil {
-			return pkix.Extension{}, fmt.Errorf("error marshaling issuer: %w", err)
-		}
+// SubjectKeyAttestationEvidence is the decoded SKAE extension. For TPM 2.0
+// keys, the CertifyInfo is a TPMS_ATTEST structure with the result of
+// TPM2_Certify, and the Signature is the TPMT_SIGNATURE created by the AK
+// over it.
+type SubjectKeyAttestationEvidence struct {
+	// Major and Minor are the TCG specification version.
+	Major, Minor int
+	// CertifyInfo is the TPMS_ATTEST structure certifying the key.
+	CertifyInfo []byte
+	// Signature is the TPMT_SIGNATURE over the CertifyInfo.
+	Signature []byte
+	// Public is the TPMT_PUBLIC structure of the certified key. It's
+	// required to verify the evidence.
+	Public []byte
+	// OCSPServer and IssuingCertificateURL are the locations from
+	// which information about the AK certificate can be retrieved.
+	OCSPServer            []string
+	IssuingCertificateURL []string
+	// RawIssuer and SerialNumber identify the AK certificate.
+	RawIssuer    []byte
+	SerialNumber *big.Int
+}
+
+// CreateSubjectKeyAttestationEvidenceExtension creates the SKAE extension for
+// a key certified by the AK in `akCert`, using the key CertificationParameters.
+// Enveloped (encrypted) evidence is not supported yet, so `shouldEncrypt` must
+// be false.
+//
+// Besides the fields defined by the SKAE specification, the evidence includes
+// the TPMT_PUBLIC structure of the key as an optional field, so that the
+// TPM attributes of the key can be verified.
+func CreateSubjectKeyAttestationEvidenceExtension(akCert *x509.Certificate, params attest.CertificationParameters, shouldEncrypt bool) (pkix.Extension, error) {
+	switch {
+	case akCert == nil:
+		return pkix.Extension{}, errors.New("AK certificate cannot be nil")
+	case akCert.SerialNumber == nil:
+		return pkix.Extension{}, errors.New("AK certificate serial number cannot be empty")
+	case len(params.CreateAttestation) == 0:
+		return pkix.Extension{}, errors.New("certification parameters attestation cannot be empty")
+	case len(params.CreateSignature) == 0:
+		return pkix.Extension{}, errors.New("certification parameters signature cannot be empty")
+	case shouldEncrypt:
+		return pkix.Extension{}, errors.New("encrypting the AttestEvidence is not yet supported")
+	}
 
-		skaeExtension := asn1SKAE{
-			TCGSpecVersion:         asn1TCGSpecVersion{Major: 2, Minor: 0},
-			KeyAttestationEvidence: asn1KeyAttestationEvidence{},
+	issuer := akCert.RawIssuer
+	if len(issuer) == 0 {
+		var err error
+		if issuer, err = asn1.Marshal(akCert.Issuer.ToRDNSequence()); err != nil {
+			return pkix.Extension{}, fmt.Errorf("error marshaling issuer: %w", err)
 		}
+	}
 
-		attestationEvidence := asn1AttestationEvidence{
-			TPMCertifyInfo: asn1TPMCertifyInfo{
-				CertifyInfo: asn1.BitString{ // TODO: check if setting the values like this is correct
-					Bytes:     params.CreateAttestation,
-					BitLength: len(params.CreateAttestation) * 8,
-				},
-				Signature: asn1.BitString{
-					Bytes:     params.CreateSignature,
-					BitLength: len(params.CreateSignature) * 8,
-				},
+	attestationEvidence := asn1AttestationEvidence{
+		TPMCertifyInfo: asn1TPMCertifyInfo{
+			CertifyInfo: asn1.BitString{
+				Bytes:     params.CreateAttestation,
+				BitLength: len(params.CreateAttestation) * 8,
 			},
-			TPMIdentityCredAccessInfo: asn1TPMIdentityCredentialAccessInfo{
-				AuthorityInfoAccess: createAIA(akCert),
-				IssuerSerial: issuerAndSerial{
-					IssuerName:   asn1.RawValue{FullBytes: asn1Issuer},
-					SerialNumber: akCert.SerialNumber,
-				},
+			Signature: asn1.BitString{
+				Bytes:     params.CreateSignature,
+				BitLength: len(params.CreateSignature) * 8,
 			},
-		}
+		},
+		TPMIdentityCredAccessInfo: asn1TPMIdentityCredentialAccessInfo{
+			AuthorityInfoAccess: createAIA(akCert),
+			IssuerSerial: issuerAndSerial{
+				IssuerName:   asn1.RawValue{FullBytes: issuer},
+				SerialNumber: akCert.SerialNumber,
+			},
+		},
+		TPMPublic: params.Public,
+	}
 
-		aeb, err := asn1.Marshal(attestationEvidence)
-		if err != nil {
-			return pkix.Extension{}, fmt.Errorf("error marshaling attestation evidence: %w", err)
-		}
+	aeb, err := asn1.Marshal(attestationEvidence)
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf("error marshaling attestation evidence: %w", err)
+	}
 
-		if !shouldEncrypt {
-			//skaeExtension.KeyAttestationEvidence.AttestEvidence = attestationEvidence
-			skaeExtension.KeyAttestationEvidence.Evidence = asn1.RawValue{
-				Class:      asn1.ClassContextSpecific,
-				IsCompound: true,
-				Tag:        0, // CHOICE "0"
-				Bytes:      aeb,
-			}
-		} else {
-			// TODO: encrypt the AttestEvidence to (right) recipient; set it as the EnvelopedAttestEvidence
-			encryptedAEB := aeb
-
-			eae := asn1EnvelopedAttestationEvidence{
-				RecipientInfos: []recipientInfo{}, // TODO: fill recipient(s)
-				EncryptedAttestInfo: asn1EncryptedAttestationInfo{
-					EncryptionAlgorithm: pkix.AlgorithmIdentifier{
-						Algorithm: nil, // TODO: select and fill
-					},
-					EncryptedAttestEvidence: encryptedAEB,
-				},
-			}
+	skaeExtensionBytes, err := asn1.Marshal(asn1SKAE{
+		TCGSpecVersion: asn1TCGSpecVersion{Major: 2, Minor: 0},
+		KeyAttestationEvidence: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			IsCompound: true,
+			Tag:        attestEvidenceTag,
+			Bytes:      aeb,
+		},
+	})
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf("creating SKAE extension failed: %w", err)
+	}
 
-			eaeBytes, err := asn1.Marshal(eae)
-			if err != nil {
-				return pkix.Extension{}, errors.New("error marshaling EnvelopedAttestationEvidence")
-			}
+	return pkix.Extension{
+		Id:       oidSubjectKeyAttestationEvidence,
+		Critical: false, // non standard extension; don't break clients
+		Value:    skaeExtensionBytes,
+	}, nil
+}
 
-			skaeExtension.KeyAttestationEvidence.Evidence = asn1.RawValue{
-				Class:      asn1.ClassContextSpecific,
-				IsCompound: true,
-				Tag:        1, // CHOICE "1"
-				Bytes:      eaeBytes,
-			}
+// ParseSubjectKeyAttestationEvidenceExtension parses the SKAE extension. It
+// returns an error if the extension is not a SKAE extension or if the
+// evidence is enveloped.
+func ParseSubjectKeyAttestationEvidenceExtension(ext pkix.Extension) (*SubjectKeyAttestationEvidence, error) {
+	if !ext.Id.Equal(oidSubjectKeyAttestationEvidence) {
+		return nil, fmt.Errorf("extension %s is not a SKAE extension", ext.Id)
+	}
 
-			return pkix.Extension{}, errors.New("encrypting the AttestEvidence is not yet supported")
-		}
+	var skae asn1SKAE
+	if rest, err := asn1.Unmarshal(ext.Value, &skae); err != nil {
+		return nil, fmt.Errorf("error parsing SKAE extension: %w", err)
+	} else if len(rest) > 0 {
+		return nil, errors.New("error parsing SKAE extension: trailing data")
+	}
 
-		skaeExtensionBytes, err := asn1.Marshal(skaeExtension)
-		if err != nil {
-			return pkix.Extension{}, fmt.Errorf("creating SKAE extension failed: %w", err)
+	// Support the evidence choice wrapped in a sequence.
+	evidence := skae.KeyAttestationEvidence
+	if evidence.Class == asn1.ClassUniversal && evidence.Tag == asn1.TagSequence {
+		if _, err := asn1.Unmarshal(evidence.Bytes, &evidence); err != nil {
+			return nil, fmt.Errorf("error parsing SKAE extension: %w", err)
 		}
+	}
+	if evidence.Class != asn1.ClassContextSpecific {
+		return nil, errors.New("error parsing SKAE extension: invalid key attestation evidence")
+	}
 
-		result := pkix.Extension{
-			Id:       oidSubjectKeyAttestationEvidence,
-			Critical: false, // non standard extension; don't break clients
-			Value:    skaeExtensionBytes,
-		}
+	switch evidence.Tag {
+	case attestEvidenceTag:
+	case envelopedAttestEvidenceTag:
+		return nil, errors.New("error parsing SKAE extension: enveloped attestation evidence is not supported")
+	default:
+		return nil, errors.New("error parsing SKAE extension: invalid key attestation evidence")
+	}
 
-		b, err := asn1.Marshal(result)
-		if err != nil {
-			return result, err
+	var ae asn1AttestationEvidence
+	if _, err := asn1.Unmarshal(evidence.Bytes, &ae); err != nil {
+		return nil, fmt.Errorf("error parsing SKAE attestation evidence: %w", err)
+	}
+
+	v := &SubjectKeyAttestationEvidence{
+		Major:        skae.TCGSpecVersion.Major,
+		Minor:        skae.TCGSpecVersion.Minor,
+		CertifyInfo:  ae.TPMCertifyInfo.CertifyInfo.RightAlign(),
+		Signature:    ae.TPMCertifyInfo.Signature.RightAlign(),
+		Public:       ae.TPMPublic,
+		RawIssuer:    ae.TPMIdentityCredAccessInfo.IssuerSerial.IssuerName.FullBytes,
+		SerialNumber: ae.TPMIdentityCredAccessInfo.IssuerSerial.SerialNumber,
+	}
+	for _, aia := range ae.TPMIdentityCredAccessInfo.AuthorityInfoAccess {
+		if aia.Location.Class != asn1.ClassContextSpecific || aia.Location.Tag != nameTypeURI {
+			continue
 		}
+		switch {
+		case aia.Method.Equal(oidAuthorityInfoAccessOcsp):
+			v.OCSPServer = append(v.OCSPServer, string(aia.Location.Bytes))
+		case aia.Method.Equal(oidAuthorityInfoAccessIssuers):
+			v.IssuingCertificateURL = append(v.IssuingCertificateURL, string(aia.Location.Bytes))
+		}
+	}
+
+	return v, nil
+}
+
+// Verify verifies that the evidence certifies the key `pub` using the AK in
+// `akCert`. It checks that the evidence references the AK certificate, that
+// the signature of the AK is valid, and that the certified key is a TPM
+// generated key that can't be exported from the TPM. Only RSA AKs are
+// supported.
+//
+// Verify does not verify the AK certificate; it must be verified by the
+// caller.
+func (e *SubjectKeyAttestationEvidence) Verify(akCert *x509.Certificate, pub crypto.PublicKey) error {
+	switch {
+	case akCert == nil:
+		return errors.New("AK certificate cannot be nil")
+	case !bytes.Equal(e.RawIssuer, akCert.RawIssuer) || e.SerialNumber == nil || e.SerialNumber.Cmp(akCert.SerialNumber) != 0:
+		return errors.New("SKAE evidence does not reference the AK certificate")
+	case len(e.Public) == 0:
+		return errors.New("SKAE evidence does not contain the public area of the key")
+	}
+
+	tpmPub, err := tpm2.DecodePublic(e.Public)
+	if err != nil {
+		return fmt.Errorf("error decoding SKAE public area: %w", err)
+	}
+	key, err := tpmPub.Key()
+	if err != nil {
+		return fmt.Errorf("error decoding SKAE public key: %w", err)
+	}
+	if k, ok := key.(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(pub) {
+		return errors.New("SKAE evidence does not certify the public key")
+	}
+
+	sig, err := tpm2.DecodeSignature(bytes.NewBuffer(e.Signature))
+	if err != nil {
+		return fmt.Errorf("error decoding SKAE signature: %w", err)
+	}
+	if sig.RSA == nil {
+		return fmt.Errorf("unsupported SKAE signature algorithm %s", sig.Alg)
+	}
+	hash, err := sig.RSA.HashAlg.Hash()
+	if err != nil {
+		return fmt.Errorf("unsupported SKAE signature hash: %w", err)
+	}
+
+	params := attest.CertificationParameters{
+		Public:            e.Public,
+		CreateAttestation: e.CertifyInfo,
+		CreateSignature:   e.Signature,
+	}
+	if err := params.Verify(attest.VerifyOpts{
+		Public: akCert.PublicKey,
+		Hash:   hash,
+	}); err != nil {
+		return fmt.Errorf("error verifying SKAE evidence: %w", err)
+	}
 
-		_ = b
+	return nil
+}
 
-		return result, nil
-	*/
+// VerifyCertificate verifies the SKAE extension in `cert` using the AK in
+// `akCert`. It returns an error if the certificate does not have a SKAE
+// extension, or if the evidence does not certify the certificate key. See
+// [SubjectKeyAttestationEvidence.Verify] for more details.
+func VerifyCertificate(cert, akCert *x509.Certificate) error {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidSubjectKeyAttestationEvidence) {
+			evidence, err := ParseSubjectKeyAttestationEvidenceExtension(ext)
+			if err != nil {
+				return err
+			}
+			return evidence.Verify(akCert, cert.PublicKey)
+		}
+	}
+	return errors.New("certificate does not have a SKAE extension")
 }
 
 func createAIA(ak *x509.Certificate) []asn1AuthorityInfoAccessSyntax {
@@ -120,13 +276,13 @@ func createAIA(ak *x509.Certificate) []asn1AuthorityInfoAccessSyntax {
 	for _, server := range ak.OCSPServer {
 		aiaValues = append(aiaValues, asn1AuthorityInfoAccessSyntax{
 			Method:   oidAuthorityInfoAccessOcsp,
-			Location: asn1.RawValue{Tag: asn1.TagOID, Class: asn1.ClassContextSpecific, Bytes: []byte(server)},
+			Location: asn1.RawValue{Tag: nameTypeURI, Class: asn1.ClassContextSpecific, Bytes: []byte(server)},
 		})
 	}
 	for _, url := range ak.IssuingCertificateURL {
 		aiaValues = append(aiaValues, asn1AuthorityInfoAccessSyntax{
 			Method:   oidAuthorityInfoAccessIssuers,
-			Location: asn1.RawValue{Tag: asn1.TagOID, Class: asn1.ClassContextSpecific, Bytes: []byte(url)},
+			Location: asn1.RawValue{Tag: nameTypeURI, Class: asn1.ClassContextSpecific, Bytes: []byte(url)},
 		})
 	}
 	return aiaValues
@@ -134,7 +290,7 @@ func createAIA(ak *x509.Certificate) []asn1AuthorityInfoAccessSyntax {
 
 type asn1SKAE struct {
 	TCGSpecVersion         asn1TCGSpecVersion
-	KeyAttestationEvidence asn1KeyAttestationEvidence
+	KeyAttestationEvidence asn1.RawValue // CHOICE of asn1AttestationEvidence and asn1EnvelopedAttestationEvidence
 }
 
 type asn1TCGSpecVersion struct {
@@ -142,15 +298,10 @@ type asn1TCGSpecVersion struct {
 	Minor int
 }
 
-type asn1KeyAttestationEvidence struct {
-	// AttestEvidence          asn1AttestationEvidence // TODO: ASN1 CHOICE between those two
-	// EnvelopedAttestEvidence asn1EnvelopedAttestationEvidence
-	Evidence asn1.RawValue
-}
-
 type asn1AttestationEvidence struct {
 	TPMCertifyInfo            asn1TPMCertifyInfo
 	TPMIdentityCredAccessInfo asn1TPMIdentityCredentialAccessInfo
+	TPMPublic                 []byte `asn1:"optional,tag:0"` // TPMT_PUBLIC of TPM 2.0 keys
 }
 
 type asn1TPMCertifyInfo struct {
@@ -172,20 +323,3 @@ type issuerAndSerial struct {
 	IssuerName   asn1.RawValue
 	SerialNumber *big.Int
 }
-
-type asn1EnvelopedAttestationEvidence struct {
-	RecipientInfos      []recipientInfo `asn1:"set"`
-	EncryptedAttestInfo asn1EncryptedAttestationInfo
-}
-
-type recipientInfo struct {
-	Version                int
-	IssuerAndSerialNumber  issuerAndSerial
-	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
-	EncryptedKey           []byte
-}
-
-type asn1EncryptedAttestationInfo struct {
-	EncryptionAlgorithm     pkix.AlgorithmIdentifier
-	EncryptedAttestEvidence []byte // -- The ciphertext resulting from the encryption of DER-encoded AttestationEvidence (against public key in recipientinfo; something like that)
-}
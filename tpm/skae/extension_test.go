@@ -5,14 +5,21 @@ import (
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"math/big"
-	"reflect"
 	"testing"
 
 	"github.com/smallstep/go-attestation/attest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	b, err := asn1.Marshal(v)
+	require.NoError(t, err)
+	return b
+}
+
 func TestCreateSubjectKeyAttestationEvidenceExtension(t *testing.T) {
-	t.Skip("skipping because SKAE is not complete yet")
 	akCert := &x509.Certificate{
 		Issuer: pkix.Name{
 			CommonName: "AK Test Issuer",
@@ -26,6 +33,13 @@ func TestCreateSubjectKeyAttestationEvidenceExtension(t *testing.T) {
 			"https://www.example.com/issuing/cert1",
 		},
 	}
+	params := attest.CertificationParameters{
+		Public:            []byte("test-fake-public"),
+		CreateAttestation: []byte("test-fake-create-attestation"),
+		CreateSignature:   []byte("test-fake-create-signature"),
+	}
+	rawIssuer := mustMarshal(t, akCert.Issuer.ToRDNSequence())
+
 	type args struct {
 		akCert        *x509.Certificate
 		params        attest.CertificationParameters
@@ -34,55 +48,148 @@ func TestCreateSubjectKeyAttestationEvidenceExtension(t *testing.T) {
 	tests := []struct {
 		name    string
 		args    args
-		want    pkix.Extension
+		want    *SubjectKeyAttestationEvidence
 		wantErr bool
 	}{
-		{
-			name: "attest",
-			args: args{
-				akCert: akCert,
-				params: attest.CertificationParameters{
-					CreateAttestation: []byte("test-fake-create-attestation"),
-					CreateSignature:   []byte("test-fake-create-signature"),
-				},
-				shouldEncrypt: false,
-			},
-			want: pkix.Extension{
-				Id:       asn1.ObjectIdentifier{2, 23, 133, 6, 1, 1},
-				Critical: false,
-				Value:    []byte{},
-			},
-			wantErr: false,
+		{"ok", args{akCert, params, false}, &SubjectKeyAttestationEvidence{
+			Major:                 2,
+			Minor:                 0,
+			CertifyInfo:           []byte("test-fake-create-attestation"),
+			Signature:             []byte("test-fake-create-signature"),
+			Public:                []byte("test-fake-public"),
+			OCSPServer:            []string{"https://www.example.com/ocsp/1", "https://www.example.com/ocsp/2"},
+			IssuingCertificateURL: []string{"https://www.example.com/issuing/cert1"},
+			RawIssuer:             rawIssuer,
+			SerialNumber:          big.NewInt(1337),
+		}, false},
+		{"ok no public", args{&x509.Certificate{RawIssuer: rawIssuer, SerialNumber: big.NewInt(1)}, attest.CertificationParameters{
+			CreateAttestation: []byte("test-fake-create-attestation"),
+			CreateSignature:   []byte("test-fake-create-signature"),
+		}, false}, &SubjectKeyAttestationEvidence{
+			Major:        2,
+			Minor:        0,
+			CertifyInfo:  []byte("test-fake-create-attestation"),
+			Signature:    []byte("test-fake-create-signature"),
+			RawIssuer:    rawIssuer,
+			SerialNumber: big.NewInt(1),
+		}, false},
+		{"fail enveloped", args{akCert, params, true}, nil, true},
+		{"fail nil akCert", args{nil, params, false}, nil, true},
+		{"fail no serial", args{&x509.Certificate{}, params, false}, nil, true},
+		{"fail no attestation", args{akCert, attest.CertificationParameters{CreateSignature: []byte("sig")}, false}, nil, true},
+		{"fail no signature", args{akCert, attest.CertificationParameters{CreateAttestation: []byte("att")}, false}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CreateSubjectKeyAttestationEvidenceExtension(tt.args.akCert, tt.args.params, tt.args.shouldEncrypt)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Equal(t, pkix.Extension{}, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, asn1.ObjectIdentifier{2, 23, 133, 6, 1, 1}, got.Id)
+			assert.False(t, got.Critical)
+
+			evidence, err := ParseSubjectKeyAttestationEvidenceExtension(got)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, evidence)
+		})
+	}
+}
+
+func TestParseSubjectKeyAttestationEvidenceExtension(t *testing.T) {
+	rawIssuer := mustMarshal(t, pkix.Name{CommonName: "AK CA"}.ToRDNSequence())
+	evidence := mustMarshal(t, asn1AttestationEvidence{
+		TPMCertifyInfo: asn1TPMCertifyInfo{
+			CertifyInfo: asn1.BitString{Bytes: []byte{1, 2}, BitLength: 16},
+			Signature:   asn1.BitString{Bytes: []byte{3, 4}, BitLength: 16},
 		},
-		{
-			name: "enveloped-attest",
-			args: args{
-				akCert: akCert,
-				params: attest.CertificationParameters{
-					CreateAttestation: []byte("test-fake-create-attestation"),
-					CreateSignature:   []byte("test-fake-create-signature"),
-				},
-				shouldEncrypt: true,
+		TPMIdentityCredAccessInfo: asn1TPMIdentityCredentialAccessInfo{
+			AuthorityInfoAccess: []asn1AuthorityInfoAccessSyntax{
+				{Method: oidAuthorityInfoAccessIssuers, Location: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: nameTypeURI, Bytes: []byte("http://ca.example.com/ak.crt")}},
+				{Method: oidAuthorityInfoAccessIssuers, Location: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte("ca.example.com")}},
 			},
-			// want: pkix.Extension{
-			// 	Id:       asn1.ObjectIdentifier{2, 23, 133, 6, 1, 1},
-			// 	Critical: false,
-			// 	Value:    []byte{},
-			// },
-			want:    pkix.Extension{},
-			wantErr: true,
+			IssuerSerial: issuerAndSerial{IssuerName: asn1.RawValue{FullBytes: rawIssuer}, SerialNumber: big.NewInt(255)},
 		},
+	})
+	ext := func(evidence asn1.RawValue) pkix.Extension {
+		return pkix.Extension{
+			Id: oidSubjectKeyAttestationEvidence,
+			Value: mustMarshal(t, asn1SKAE{
+				TCGSpecVersion:         asn1TCGSpecVersion{Major: 2, Minor: 0},
+				KeyAttestationEvidence: evidence,
+			}),
+		}
+	}
+	explicit := func(tag int, b []byte) asn1.RawValue {
+		return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: b}
+	}
+	want := &SubjectKeyAttestationEvidence{
+		Major:                 2,
+		CertifyInfo:           []byte{1, 2},
+		Signature:             []byte{3, 4},
+		IssuingCertificateURL: []string{"http://ca.example.com/ak.crt"},
+		RawIssuer:             rawIssuer,
+		SerialNumber:          big.NewInt(255),
+	}
+
+	tests := []struct {
+		name    string
+		ext     pkix.Extension
+		want    *SubjectKeyAttestationEvidence
+		wantErr bool
+	}{
+		{"ok", ext(explicit(0, evidence)), want, false},
+		{"ok wrapped", ext(asn1.RawValue{FullBytes: mustMarshal(t, struct{ Evidence asn1.RawValue }{explicit(0, evidence)})}), want, false},
+		{"fail oid", pkix.Extension{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: ext(explicit(0, evidence)).Value}, nil, true},
+		{"fail asn1", pkix.Extension{Id: oidSubjectKeyAttestationEvidence, Value: []byte{0x30, 0x01}}, nil, true},
+		{"fail trailing data", pkix.Extension{Id: oidSubjectKeyAttestationEvidence, Value: append(ext(explicit(0, evidence)).Value, 0)}, nil, true},
+		{"fail enveloped", ext(explicit(1, evidence)), nil, true},
+		{"fail tag", ext(explicit(2, evidence)), nil, true},
+		{"fail class", ext(asn1.RawValue{Class: asn1.ClassApplication, Tag: 0, IsCompound: true, Bytes: evidence}), nil, true},
+		{"fail evidence", ext(explicit(0, []byte{0x30, 0x00})), nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := CreateSubjectKeyAttestationEvidenceExtension(tt.args.akCert, tt.args.params, tt.args.shouldEncrypt)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("CreateSubjectKeyAttestationEvidenceExtension() error = %v, wantErr %v", err, tt.wantErr)
+			got, err := ParseSubjectKeyAttestationEvidenceExtension(tt.ext)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("CreateSubjectKeyAttestationEvidenceExtension() = %v, want %v", got, tt.want)
-			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
 		})
 	}
 }
+
+func TestSubjectKeyAttestationEvidence_Verify(t *testing.T) {
+	rawIssuer := mustMarshal(t, pkix.Name{CommonName: "AK CA"}.ToRDNSequence())
+	akCert := &x509.Certificate{RawIssuer: rawIssuer, SerialNumber: big.NewInt(1)}
+
+	tests := []struct {
+		name     string
+		evidence *SubjectKeyAttestationEvidence
+		akCert   *x509.Certificate
+	}{
+		{"fail nil akCert", &SubjectKeyAttestationEvidence{RawIssuer: rawIssuer, SerialNumber: big.NewInt(1)}, nil},
+		{"fail issuer", &SubjectKeyAttestationEvidence{RawIssuer: []byte{0x30, 0x00}, SerialNumber: big.NewInt(1)}, akCert},
+		{"fail serial", &SubjectKeyAttestationEvidence{RawIssuer: rawIssuer, SerialNumber: big.NewInt(2)}, akCert},
+		{"fail no serial", &SubjectKeyAttestationEvidence{RawIssuer: rawIssuer}, akCert},
+		{"fail no public", &SubjectKeyAttestationEvidence{RawIssuer: rawIssuer, SerialNumber: big.NewInt(1)}, akCert},
+		{"fail public", &SubjectKeyAttestationEvidence{RawIssuer: rawIssuer, SerialNumber: big.NewInt(1), Public: []byte("public")}, akCert},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, tt.evidence.Verify(tt.akCert, nil))
+		})
+	}
+}
+
+func TestVerifyCertificate(t *testing.T) {
+	assert.EqualError(t, VerifyCertificate(&x509.Certificate{}, &x509.Certificate{}), "certificate does not have a SKAE extension")
+	assert.Error(t, VerifyCertificate(&x509.Certificate{
+		Extensions: []pkix.Extension{{Id: oidSubjectKeyAttestationEvidence, Value: []byte{0x30, 0x00}}},
+	}, &x509.Certificate{}))
+}
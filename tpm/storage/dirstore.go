@@ -223,6 +223,157 @@ func (s *Dirstore) DeleteAK(name string) error {
 	return nil
 }
 
+func (s *Dirstore) ListSealedData() ([]*SealedData, error) {
+	var result = make([]*SealedData, 0)
+	c := s.store.KeysPrefix(sealedDataPrefix, nil)
+	for k := range c {
+		data, err := s.store.Read(k)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading sealed data from store: %w", err)
+		}
+		sd := &SealedData{}
+		if err := json.Unmarshal(data, sd); err != nil {
+			return nil, fmt.Errorf("failed unmarshaling sealed data: %w", err)
+		}
+		result = append(result, sd)
+	}
+	return result, nil
+}
+
+func (s *Dirstore) ListSealedDataNames() []string {
+	var result = make([]string, 0)
+	c := s.store.KeysPrefix(sealedDataPrefix, nil)
+	for k := range c {
+		result = append(result, strings.TrimPrefix(k, sealedDataPrefix))
+	}
+	return result
+}
+
+func (s *Dirstore) GetSealedData(name string) (*SealedData, error) {
+	sdKey := keyForSealedData(name)
+	if !s.store.Has(sdKey) {
+		return nil, ErrNotFound
+	}
+	data, err := s.store.Read(sdKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading sealed data from store: %w", err)
+	}
+	sd := &SealedData{}
+	if err := json.Unmarshal(data, sd); err != nil {
+		return nil, fmt.Errorf("failed unmarshaling sealed data: %w", err)
+	}
+	return sd, nil
+}
+
+func (s *Dirstore) AddSealedData(sd *SealedData) error {
+	sdKey := keyForSealedData(sd.Name)
+	if s.store.Has(sdKey) {
+		return ErrExists
+	}
+	data, err := json.Marshal(sd)
+	if err != nil {
+		return fmt.Errorf("failed serializing sealed data: %w", err)
+	}
+	if err := s.store.WriteStream(sdKey, bytes.NewBuffer(data), true); err != nil {
+		return fmt.Errorf("failed writing sealed data to disk: %w", err)
+	}
+	return nil
+}
+
+func (s *Dirstore) DeleteSealedData(name string) error {
+	sdKey := keyForSealedData(name)
+	if !s.store.Has(sdKey) {
+		return ErrNotFound
+	}
+	if err := s.store.Erase(sdKey); err != nil {
+		return fmt.Errorf("failed deleting sealed data from disk: %w", err)
+	}
+	return nil
+}
+
+func (s *Dirstore) ListEKCertificates() ([]*EKCertificate, error) {
+	var result = make([]*EKCertificate, 0)
+	c := s.store.KeysPrefix(ekCertificatePrefix, nil)
+	for k := range c {
+		data, err := s.store.Read(k)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading EK certificate from store: %w", err)
+		}
+		ekc := &EKCertificate{}
+		if err := json.Unmarshal(data, ekc); err != nil {
+			return nil, fmt.Errorf("failed unmarshaling EK certificate: %w", err)
+		}
+		result = append(result, ekc)
+	}
+	return result, nil
+}
+
+func (s *Dirstore) ListEKCertificateNames() []string {
+	var result = make([]string, 0)
+	c := s.store.KeysPrefix(ekCertificatePrefix, nil)
+	for k := range c {
+		result = append(result, strings.TrimPrefix(k, ekCertificatePrefix))
+	}
+	return result
+}
+
+func (s *Dirstore) GetEKCertificate(name string) (*EKCertificate, error) {
+	ekcKey := keyForEKCertificate(name)
+	if !s.store.Has(ekcKey) {
+		return nil, ErrNotFound
+	}
+	data, err := s.store.Read(ekcKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading EK certificate from store: %w", err)
+	}
+	ekc := &EKCertificate{}
+	if err := json.Unmarshal(data, ekc); err != nil {
+		return nil, fmt.Errorf("failed unmarshaling EK certificate: %w", err)
+	}
+	return ekc, nil
+}
+
+func (s *Dirstore) AddEKCertificate(ekc *EKCertificate) error {
+	ekcKey := keyForEKCertificate(ekc.Name)
+	if s.store.Has(ekcKey) {
+		return ErrExists
+	}
+	data, err := json.Marshal(ekc)
+	if err != nil {
+		return fmt.Errorf("failed serializing EK certificate: %w", err)
+	}
+	if err := s.store.WriteStream(ekcKey, bytes.NewBuffer(data), true); err != nil {
+		return fmt.Errorf("failed writing EK certificate to disk: %w", err)
+	}
+	return nil
+}
+
+func (s *Dirstore) UpdateEKCertificate(ekc *EKCertificate) error {
+	ekcKey := keyForEKCertificate(ekc.Name)
+	if !s.store.Has(ekcKey) {
+		return ErrNotFound
+	}
+	data, err := json.Marshal(ekc)
+	if err != nil {
+		return fmt.Errorf("failed serializing EK certificate: %w", err)
+	}
+	if err := s.store.WriteStream(ekcKey, bytes.NewBuffer(data), true); err != nil {
+		return fmt.Errorf("failed writing EK certificate to disk: %w", err)
+	}
+	return nil
+}
+
+func (s *Dirstore) DeleteEKCertificate(name string) error {
+	ekcKey := keyForEKCertificate(name)
+	if !s.store.Has(ekcKey) {
+		return ErrNotFound
+	}
+	if err := s.store.Erase(ekcKey); err != nil {
+		return fmt.Errorf("failed deleting EK certificate from disk: %w", err)
+	}
+	return nil
+}
+
 func (s *Dirstore) Persist() error {
 	// writes are persisted directly
 	return nil
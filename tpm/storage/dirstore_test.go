@@ -122,3 +122,102 @@ func TestDirstore_AKOperations(t *testing.T) {
 	require.NoError(t, err)
 	require.ElementsMatch(t, []*AK{ak2}, aks)
 }
+
+func TestDirstore_SealedDataOperations(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	store := NewDirstore(tempDir)
+	sd1 := &SealedData{Name: "1st-sealed", Data: []byte{1, 2, 3, 4}}
+	sd2 := &SealedData{Name: "2nd-sealed", Data: []byte{5, 6, 7, 8}}
+
+	err := store.AddSealedData(sd1)
+	require.NoError(t, err)
+
+	err = store.AddSealedData(sd2)
+	require.NoError(t, err)
+
+	err = store.AddSealedData(sd1)
+	require.EqualError(t, err, "already exists")
+
+	err = store.AddKey(&Key{Name: "1st-sealed"})
+	require.NoError(t, err)
+
+	sd, err := store.GetSealedData("1st-sealed")
+	require.NoError(t, err)
+	require.Equal(t, sd1, sd)
+
+	sd, err = store.GetSealedData("3rd-sealed")
+	require.EqualError(t, err, "not found")
+	require.Nil(t, sd)
+
+	names := store.ListSealedDataNames()
+	require.Equal(t, []string{"1st-sealed", "2nd-sealed"}, names)
+
+	sds, err := store.ListSealedData()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []*SealedData{sd1, sd2}, sds)
+
+	err = store.DeleteSealedData("3rd-sealed")
+	require.EqualError(t, err, "not found")
+
+	err = store.DeleteSealedData("1st-sealed")
+	require.NoError(t, err)
+
+	sds, err = store.ListSealedData()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []*SealedData{sd2}, sds)
+
+	_, err = store.GetKey("1st-sealed")
+	require.NoError(t, err)
+}
+
+func TestDirstore_EKCertificateOperations(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	store := NewDirstore(tempDir)
+	ekc1 := &EKCertificate{Name: "1st-ekcert", URL: "https://ek.example.com/1"}
+	ekc2 := &EKCertificate{Name: "2nd-ekcert"}
+
+	err := store.AddEKCertificate(ekc1)
+	require.NoError(t, err)
+
+	err = store.AddEKCertificate(ekc2)
+	require.NoError(t, err)
+
+	err = store.AddEKCertificate(ekc1)
+	require.EqualError(t, err, "already exists")
+
+	ekc, err := store.GetEKCertificate("1st-ekcert")
+	require.NoError(t, err)
+	require.Equal(t, ekc1, ekc)
+
+	ekc, err = store.GetEKCertificate("3rd-ekcert")
+	require.EqualError(t, err, "not found")
+	require.Nil(t, ekc)
+
+	names := store.ListEKCertificateNames()
+	require.Equal(t, []string{"1st-ekcert", "2nd-ekcert"}, names)
+
+	ekc1.URL = "https://ek.example.com/updated"
+	err = store.UpdateEKCertificate(ekc1)
+	require.NoError(t, err)
+
+	err = store.UpdateEKCertificate(&EKCertificate{Name: "3rd-ekcert"})
+	require.EqualError(t, err, "not found")
+
+	ekcs, err := store.ListEKCertificates()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []*EKCertificate{ekc1, ekc2}, ekcs)
+
+	err = store.DeleteEKCertificate("3rd-ekcert")
+	require.EqualError(t, err, "not found")
+
+	err = store.DeleteEKCertificate("1st-ekcert")
+	require.NoError(t, err)
+
+	ekcs, err = store.ListEKCertificates()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []*EKCertificate{ekc2}, ekcs)
+}
@@ -97,6 +97,83 @@ func (f *FeedthroughStore) DeleteAK(name string) error {
 	return f.store.DeleteAK(name)
 }
 
+func (f *FeedthroughStore) ListSealedData() ([]*SealedData, error) {
+	if f.store == nil {
+		return nil, ErrNoStorageConfigured
+	}
+	return f.store.ListSealedData()
+}
+
+func (f *FeedthroughStore) ListSealedDataNames() []string {
+	if f.store == nil {
+		return nil
+	}
+	return f.store.ListSealedDataNames()
+}
+
+func (f *FeedthroughStore) GetSealedData(name string) (*SealedData, error) {
+	if f.store == nil {
+		return nil, ErrNoStorageConfigured
+	}
+	return f.store.GetSealedData(name)
+}
+
+func (f *FeedthroughStore) AddSealedData(sd *SealedData) error {
+	if f.store == nil {
+		return ErrNoStorageConfigured
+	}
+	return f.store.AddSealedData(sd)
+}
+
+func (f *FeedthroughStore) DeleteSealedData(name string) error {
+	if f.store == nil {
+		return ErrNoStorageConfigured
+	}
+	return f.store.DeleteSealedData(name)
+}
+
+func (f *FeedthroughStore) ListEKCertificates() ([]*EKCertificate, error) {
+	if f.store == nil {
+		return nil, ErrNoStorageConfigured
+	}
+	return f.store.ListEKCertificates()
+}
+
+func (f *FeedthroughStore) ListEKCertificateNames() []string {
+	if f.store == nil {
+		return nil
+	}
+	return f.store.ListEKCertificateNames()
+}
+
+func (f *FeedthroughStore) GetEKCertificate(name string) (*EKCertificate, error) {
+	if f.store == nil {
+		return nil, ErrNoStorageConfigured
+	}
+	return f.store.GetEKCertificate(name)
+}
+
+func (f *FeedthroughStore) AddEKCertificate(ekc *EKCertificate) error {
+	if f.store == nil {
+		return ErrNoStorageConfigured
+	}
+	return f.store.AddEKCertificate(ekc)
+}
+
+func (f *FeedthroughStore) UpdateEKCertificate(ekc *EKCertificate) error {
+	if f.store == nil {
+		return ErrNoStorageConfigured
+	}
+	return f.store.UpdateEKCertificate(ekc)
+}
+
+func (f *FeedthroughStore) DeleteEKCertificate(name string) error {
+	if f.store == nil {
+		return ErrNoStorageConfigured
+	}
+	return f.store.DeleteEKCertificate(name)
+}
+
 func (f *FeedthroughStore) Persist() error {
 	if f.store == nil {
 		return nil
@@ -225,3 +225,130 @@ func TestFeedthroughStore_AKOperations(t *testing.T) {
 	err = store.Load()
 	require.NoError(t, err)
 }
+
+func TestFeedthroughStore_NilSealedDataOperations(t *testing.T) {
+	t.Parallel()
+
+	store := NewFeedthroughStore(nil)
+
+	err := store.AddSealedData(&SealedData{Name: "1st-sealed"})
+	require.ErrorIs(t, err, ErrNoStorageConfigured)
+
+	sd, err := store.GetSealedData("1st-sealed")
+	require.ErrorIs(t, err, ErrNoStorageConfigured)
+	require.Nil(t, sd)
+
+	names := store.ListSealedDataNames()
+	require.Empty(t, names)
+
+	sds, err := store.ListSealedData()
+	require.ErrorIs(t, err, ErrNoStorageConfigured)
+	require.Empty(t, sds)
+
+	err = store.DeleteSealedData("1st-sealed")
+	require.ErrorIs(t, err, ErrNoStorageConfigured)
+}
+
+func TestFeedthroughStore_SealedDataOperations(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	store := NewFeedthroughStore(NewDirstore(tempDir))
+
+	sd1 := &SealedData{Name: "1st-sealed"}
+	sd2 := &SealedData{Name: "2nd-sealed"}
+
+	err := store.AddSealedData(sd1)
+	require.NoError(t, err)
+
+	err = store.AddSealedData(sd2)
+	require.NoError(t, err)
+
+	err = store.AddSealedData(sd1)
+	require.EqualError(t, err, "already exists")
+
+	sd, err := store.GetSealedData("1st-sealed")
+	require.NoError(t, err)
+	require.Equal(t, sd1, sd)
+
+	names := store.ListSealedDataNames()
+	require.Equal(t, []string{"1st-sealed", "2nd-sealed"}, names)
+
+	sds, err := store.ListSealedData()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []*SealedData{sd1, sd2}, sds)
+
+	err = store.DeleteSealedData("1st-sealed")
+	require.NoError(t, err)
+
+	sd, err = store.GetSealedData("1st-sealed")
+	require.EqualError(t, err, "not found")
+	require.Nil(t, sd)
+}
+
+func TestFeedthroughStore_NilEKCertificateOperations(t *testing.T) {
+	t.Parallel()
+
+	store := NewFeedthroughStore(nil)
+
+	err := store.AddEKCertificate(&EKCertificate{Name: "1st-ekcert"})
+	require.ErrorIs(t, err, ErrNoStorageConfigured)
+
+	ekc, err := store.GetEKCertificate("1st-ekcert")
+	require.ErrorIs(t, err, ErrNoStorageConfigured)
+	require.Nil(t, ekc)
+
+	err = store.UpdateEKCertificate(&EKCertificate{Name: "1st-ekcert"})
+	require.ErrorIs(t, err, ErrNoStorageConfigured)
+
+	names := store.ListEKCertificateNames()
+	require.Empty(t, names)
+
+	ekcs, err := store.ListEKCertificates()
+	require.ErrorIs(t, err, ErrNoStorageConfigured)
+	require.Empty(t, ekcs)
+
+	err = store.DeleteEKCertificate("1st-ekcert")
+	require.ErrorIs(t, err, ErrNoStorageConfigured)
+}
+
+func TestFeedthroughStore_EKCertificateOperations(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	store := NewFeedthroughStore(NewDirstore(tempDir))
+
+	ekc1 := &EKCertificate{Name: "1st-ekcert"}
+	ekc2 := &EKCertificate{Name: "2nd-ekcert"}
+
+	err := store.AddEKCertificate(ekc1)
+	require.NoError(t, err)
+
+	err = store.AddEKCertificate(ekc2)
+	require.NoError(t, err)
+
+	err = store.AddEKCertificate(ekc1)
+	require.EqualError(t, err, "already exists")
+
+	ekc1.URL = "https://ek.example.com/1"
+	err = store.UpdateEKCertificate(ekc1)
+	require.NoError(t, err)
+
+	ekc, err := store.GetEKCertificate("1st-ekcert")
+	require.NoError(t, err)
+	require.Equal(t, ekc1, ekc)
+
+	names := store.ListEKCertificateNames()
+	require.Equal(t, []string{"1st-ekcert", "2nd-ekcert"}, names)
+
+	ekcs, err := store.ListEKCertificates()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []*EKCertificate{ekc1, ekc2}, ekcs)
+
+	err = store.DeleteEKCertificate("1st-ekcert")
+	require.NoError(t, err)
+
+	ekc, err = store.GetEKCertificate("1st-ekcert")
+	require.EqualError(t, err, "not found")
+	require.Nil(t, ekc)
+}
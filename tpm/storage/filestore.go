@@ -136,7 +136,7 @@ func (s *Filestore) DeleteAK(name string) error {
 }
 
 func (s *Filestore) ListKeys() ([]*Key, error) {
-	keys := s.store.GetAll(regexp.MustCompile(keyPrefix))
+	keys := s.store.GetAll(regexp.MustCompile("^" + keyPrefix))
 	var result = make([]*Key, 0, len(keys))
 	for _, v := range keys {
 		key := &Key{}
@@ -151,7 +151,7 @@ func (s *Filestore) ListKeys() ([]*Key, error) {
 }
 
 func (s *Filestore) ListAKs() ([]*AK, error) {
-	aks := s.store.GetAll(regexp.MustCompile(akPrefix))
+	aks := s.store.GetAll(regexp.MustCompile("^" + akPrefix))
 	var result = make([]*AK, 0, len(aks))
 	for _, v := range aks {
 		ak := &AK{}
@@ -189,6 +189,153 @@ func (s *Filestore) ListAKNames() []string {
 	return result
 }
 
+func (s *Filestore) AddSealedData(sd *SealedData) error {
+	sdKey := keyForSealedData(sd.Name)
+	if err := s.store.Get(sdKey, nil); err != nil {
+		nsk := &jsonstore.NoSuchKeyError{}
+		if errors.As(err, nsk) {
+			return s.store.Set(sdKey, sd)
+		}
+		return err
+	}
+
+	return ErrExists
+}
+
+func (s *Filestore) GetSealedData(name string) (*SealedData, error) {
+	sd := &SealedData{}
+	if err := s.store.Get(keyForSealedData(name), sd); err != nil {
+		nsk := &jsonstore.NoSuchKeyError{}
+		if errors.As(err, nsk) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return sd, nil
+}
+
+func (s *Filestore) DeleteSealedData(name string) error {
+	sdKey := keyForSealedData(name)
+	if err := s.store.Get(sdKey, nil); err != nil {
+		nsk := &jsonstore.NoSuchKeyError{}
+		if errors.As(err, nsk) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	s.store.Delete(sdKey)
+	return nil
+}
+
+func (s *Filestore) ListSealedData() ([]*SealedData, error) {
+	sds := s.store.GetAll(regexp.MustCompile("^" + sealedDataPrefix))
+	var result = make([]*SealedData, 0, len(sds))
+	for _, v := range sds {
+		sd := &SealedData{}
+		err := json.Unmarshal(v, sd)
+		if err != nil {
+			return nil, fmt.Errorf("failed unmarshaling sealed data: %w", err)
+		}
+		result = append(result, sd)
+	}
+
+	return result, nil
+}
+
+func (s *Filestore) ListSealedDataNames() []string {
+	keys := s.store.Keys()
+	var result = make([]string, 0, len(keys))
+	for _, k := range keys {
+		if strings.HasPrefix(k, sealedDataPrefix) {
+			result = append(result, strings.TrimPrefix(k, sealedDataPrefix))
+		}
+	}
+
+	return result
+}
+
+func (s *Filestore) AddEKCertificate(ekc *EKCertificate) error {
+	ekcKey := keyForEKCertificate(ekc.Name)
+	if err := s.store.Get(ekcKey, nil); err != nil {
+		nsk := &jsonstore.NoSuchKeyError{}
+		if errors.As(err, nsk) {
+			return s.store.Set(ekcKey, ekc)
+		}
+		return err
+	}
+
+	return ErrExists
+}
+
+func (s *Filestore) GetEKCertificate(name string) (*EKCertificate, error) {
+	ekc := &EKCertificate{}
+	if err := s.store.Get(keyForEKCertificate(name), ekc); err != nil {
+		nsk := &jsonstore.NoSuchKeyError{}
+		if errors.As(err, nsk) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return ekc, nil
+}
+
+func (s *Filestore) UpdateEKCertificate(ekc *EKCertificate) error {
+	ekcKey := keyForEKCertificate(ekc.Name)
+	if err := s.store.Get(ekcKey, nil); err != nil {
+		nsk := &jsonstore.NoSuchKeyError{}
+		if errors.As(err, nsk) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return s.store.Set(ekcKey, ekc)
+}
+
+func (s *Filestore) DeleteEKCertificate(name string) error {
+	ekcKey := keyForEKCertificate(name)
+	if err := s.store.Get(ekcKey, nil); err != nil {
+		nsk := &jsonstore.NoSuchKeyError{}
+		if errors.As(err, nsk) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	s.store.Delete(ekcKey)
+	return nil
+}
+
+func (s *Filestore) ListEKCertificates() ([]*EKCertificate, error) {
+	ekcs := s.store.GetAll(regexp.MustCompile("^" + ekCertificatePrefix))
+	var result = make([]*EKCertificate, 0, len(ekcs))
+	for _, v := range ekcs {
+		ekc := &EKCertificate{}
+		err := json.Unmarshal(v, ekc)
+		if err != nil {
+			return nil, fmt.Errorf("failed unmarshaling EK certificate: %w", err)
+		}
+		result = append(result, ekc)
+	}
+
+	return result, nil
+}
+
+func (s *Filestore) ListEKCertificateNames() []string {
+	keys := s.store.Keys()
+	var result = make([]string, 0, len(keys))
+	for _, k := range keys {
+		if strings.HasPrefix(k, ekCertificatePrefix) {
+			result = append(result, strings.TrimPrefix(k, ekCertificatePrefix))
+		}
+	}
+
+	return result
+}
+
 func (s *Filestore) Persist() error {
 	return jsonstore.Save(s.store, s.filepath)
 }
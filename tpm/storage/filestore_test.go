@@ -7,6 +7,7 @@ import (
 
 	"github.com/schollz/jsonstore"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFilestore_AddKey(t *testing.T) {
@@ -544,3 +545,80 @@ func TestFilestore_ListAKNames(t *testing.T) {
 
 	assert.ElementsMatch(t, expected, got)
 }
+
+func TestFilestore_SealedDataOperations(t *testing.T) {
+	t.Parallel()
+	t0 := time.Time{} // we're hit by https://github.com/stretchr/testify/issues/950
+	store := new(jsonstore.JSONStore)
+	store.Set("key-sealed-key", serializedKey{Name: "sealed-key", Type: typeKey, Data: []byte{1, 2, 3, 4}, CreatedAt: t0})
+	s := &Filestore{store: store}
+
+	sd1 := &SealedData{Name: "1st-sealed", Data: []byte{1, 2, 3, 4}, CreatedAt: t0}
+	sd2 := &SealedData{Name: "2nd-sealed", Data: []byte{5, 6, 7, 8}, CreatedAt: t0}
+	require.NoError(t, s.AddSealedData(sd1))
+	require.NoError(t, s.AddSealedData(sd2))
+	assert.ErrorIs(t, s.AddSealedData(sd1), ErrExists)
+
+	got, err := s.GetSealedData("1st-sealed")
+	require.NoError(t, err)
+	assert.Equal(t, sd1, got)
+
+	_, err = s.GetSealedData("3rd-sealed")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.ElementsMatch(t, []string{"1st-sealed", "2nd-sealed"}, s.ListSealedDataNames())
+	sds, err := s.ListSealedData()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []*SealedData{sd1, sd2}, sds)
+
+	// Keys with a name containing the sealed data prefix are not listed.
+	keys, err := s.ListKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, "sealed-key", keys[0].Name)
+
+	assert.ErrorIs(t, s.DeleteSealedData("3rd-sealed"), ErrNotFound)
+	require.NoError(t, s.DeleteSealedData("1st-sealed"))
+	assert.Equal(t, []string{"2nd-sealed"}, s.ListSealedDataNames())
+
+	store.Data["sealed-bad-storage"] = nil
+	_, err = s.ListSealedData()
+	assert.EqualError(t, err, "failed unmarshaling sealed data: unexpected end of JSON input")
+}
+
+func TestFilestore_EKCertificateOperations(t *testing.T) {
+	t.Parallel()
+	t0 := time.Time{} // we're hit by https://github.com/stretchr/testify/issues/950
+	store := new(jsonstore.JSONStore)
+	s := &Filestore{store: store}
+
+	ekc1 := &EKCertificate{Name: "1st-ekcert", URL: "https://ek.example.com/1", CreatedAt: t0}
+	ekc2 := &EKCertificate{Name: "2nd-ekcert", CreatedAt: t0}
+	require.NoError(t, s.AddEKCertificate(ekc1))
+	require.NoError(t, s.AddEKCertificate(ekc2))
+	assert.ErrorIs(t, s.AddEKCertificate(ekc1), ErrExists)
+
+	got, err := s.GetEKCertificate("1st-ekcert")
+	require.NoError(t, err)
+	assert.Equal(t, ekc1, got)
+
+	_, err = s.GetEKCertificate("3rd-ekcert")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	ekc1.URL = "https://ek.example.com/updated"
+	require.NoError(t, s.UpdateEKCertificate(ekc1))
+	assert.ErrorIs(t, s.UpdateEKCertificate(&EKCertificate{Name: "3rd-ekcert"}), ErrNotFound)
+
+	assert.ElementsMatch(t, []string{"1st-ekcert", "2nd-ekcert"}, s.ListEKCertificateNames())
+	ekcs, err := s.ListEKCertificates()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []*EKCertificate{ekc1, ekc2}, ekcs)
+
+	assert.ErrorIs(t, s.DeleteEKCertificate("3rd-ekcert"), ErrNotFound)
+	require.NoError(t, s.DeleteEKCertificate("1st-ekcert"))
+	assert.Equal(t, []string{"2nd-ekcert"}, s.ListEKCertificateNames())
+
+	store.Data["ekcert-bad-storage"] = nil
+	_, err = s.ListEKCertificates()
+	assert.EqualError(t, err, "failed unmarshaling EK certificate: unexpected end of JSON input")
+}
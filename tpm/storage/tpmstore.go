@@ -33,6 +33,19 @@ type TPMStore interface {
 	UpdateAK(ak *AK) error
 	DeleteAK(name string) error
 
+	ListSealedData() ([]*SealedData, error)
+	ListSealedDataNames() []string
+	GetSealedData(name string) (*SealedData, error)
+	AddSealedData(sd *SealedData) error
+	DeleteSealedData(name string) error
+
+	ListEKCertificates() ([]*EKCertificate, error)
+	ListEKCertificateNames() []string
+	GetEKCertificate(name string) (*EKCertificate, error)
+	AddEKCertificate(ekc *EKCertificate) error
+	UpdateEKCertificate(ekc *EKCertificate) error
+	DeleteEKCertificate(name string) error
+
 	Persist() error
 	Load() error
 }
@@ -73,6 +73,7 @@ type Key struct {
 	AttestedBy string
 	Chain      []*x509.Certificate
 	CreatedAt  time.Time
+	Policy     []byte
 }
 
 // MarshalJSON marshals the Key into JSON.
@@ -88,6 +89,7 @@ func (key *Key) MarshalJSON() ([]byte, error) {
 		Data:       key.Data,
 		AttestedBy: key.AttestedBy,
 		CreatedAt:  key.CreatedAt,
+		Policy:     key.Policy,
 	}
 
 	if len(chain) > 0 {
@@ -112,6 +114,7 @@ func (key *Key) UnmarshalJSON(data []byte) error {
 	key.Data = sk.Data
 	key.AttestedBy = sk.AttestedBy
 	key.CreatedAt = sk.CreatedAt
+	key.Policy = sk.Policy
 
 	if len(sk.Chain) > 0 {
 		chain := make([]*x509.Certificate, len(sk.Chain))
@@ -128,16 +131,117 @@ func (key *Key) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// SealedData is the type used to store sealed data objects.
+type SealedData struct {
+	Name      string
+	Data      []byte
+	CreatedAt time.Time
+}
+
+// MarshalJSON marshals the SealedData into JSON.
+func (sd *SealedData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(serializedSealedData{
+		Name:      sd.Name,
+		Type:      typeSealedData,
+		Data:      sd.Data,
+		CreatedAt: sd.CreatedAt,
+	})
+}
+
+// UnmarshalJSON unmarshals `data` into a SealedData.
+func (sd *SealedData) UnmarshalJSON(data []byte) error {
+	ssd := &serializedSealedData{}
+	if err := json.Unmarshal(data, ssd); err != nil {
+		return fmt.Errorf("failed unmarshaling serialized sealed data: %w", err)
+	}
+
+	if ssd.Type != typeSealedData {
+		return fmt.Errorf("unexpected serialized data type %q", ssd.Type)
+	}
+
+	sd.Name = ssd.Name
+	sd.Data = ssd.Data
+	sd.CreatedAt = ssd.CreatedAt
+
+	return nil
+}
+
+// EKCertificate is the type used to cache EK certificates and their
+// intermediate CA certificates. The Name is the hex encoded SHA256 of
+// the EK public key. The first certificate in the Chain is the EK
+// certificate.
+type EKCertificate struct {
+	Name      string
+	URL       string
+	Chain     []*x509.Certificate
+	CreatedAt time.Time
+}
+
+// MarshalJSON marshals the EKCertificate into JSON.
+func (ekc *EKCertificate) MarshalJSON() ([]byte, error) {
+	chain := make([][]byte, len(ekc.Chain))
+	for i, cert := range ekc.Chain {
+		chain[i] = cert.Raw
+	}
+
+	sekc := serializedEKCertificate{
+		Name:      ekc.Name,
+		Type:      typeEKCertificate,
+		URL:       ekc.URL,
+		CreatedAt: ekc.CreatedAt,
+	}
+
+	if len(chain) > 0 {
+		sekc.Chain = chain
+	}
+
+	return json.Marshal(sekc)
+}
+
+// UnmarshalJSON unmarshals `data` into an EKCertificate.
+func (ekc *EKCertificate) UnmarshalJSON(data []byte) error {
+	sekc := &serializedEKCertificate{}
+	if err := json.Unmarshal(data, sekc); err != nil {
+		return fmt.Errorf("failed unmarshaling serialized EK certificate: %w", err)
+	}
+
+	if sekc.Type != typeEKCertificate {
+		return fmt.Errorf("unexpected serialized data type %q", sekc.Type)
+	}
+
+	ekc.Name = sekc.Name
+	ekc.URL = sekc.URL
+	ekc.CreatedAt = sekc.CreatedAt
+
+	if len(sekc.Chain) > 0 {
+		chain := make([]*x509.Certificate, len(sekc.Chain))
+		for i, certBytes := range sekc.Chain {
+			cert, err := x509.ParseCertificate(certBytes)
+			if err != nil {
+				return fmt.Errorf("failed parsing certificate: %w", err)
+			}
+			chain[i] = cert
+		}
+		ekc.Chain = chain
+	}
+
+	return nil
+}
+
 const (
-	akPrefix  = "ak-"
-	keyPrefix = "key-"
+	akPrefix            = "ak-"
+	keyPrefix           = "key-"
+	sealedDataPrefix    = "sealed-"
+	ekCertificatePrefix = "ekcert-"
 )
 
 type tpmObjectType string
 
 const (
-	typeAK  tpmObjectType = "AK"
-	typeKey tpmObjectType = "KEY"
+	typeAK            tpmObjectType = "AK"
+	typeKey           tpmObjectType = "KEY"
+	typeSealedData    tpmObjectType = "SEALED"
+	typeEKCertificate tpmObjectType = "EKCERT"
 )
 
 // serializedAK is the struct used when marshaling
@@ -159,6 +263,26 @@ type serializedKey struct {
 	AttestedBy string        `json:"attestedBy"`
 	Chain      [][]byte      `json:"chain"`
 	CreatedAt  time.Time     `json:"createdAt"`
+	Policy     []byte        `json:"policy,omitempty"`
+}
+
+// serializedSealedData is the struct used when marshaling
+// a storage SealedData to JSON.
+type serializedSealedData struct {
+	Name      string        `json:"name"`
+	Type      tpmObjectType `json:"type"`
+	Data      []byte        `json:"data"`
+	CreatedAt time.Time     `json:"createdAt"`
+}
+
+// serializedEKCertificate is the struct used when marshaling
+// a storage EKCertificate to JSON.
+type serializedEKCertificate struct {
+	Name      string        `json:"name"`
+	Type      tpmObjectType `json:"type"`
+	URL       string        `json:"url,omitempty"`
+	Chain     [][]byte      `json:"chain"`
+	CreatedAt time.Time     `json:"createdAt"`
 }
 
 // keyForAK returns the key to use when storing an AK.
@@ -170,3 +294,13 @@ func keyForAK(name string) string {
 func keyForKey(name string) string {
 	return fmt.Sprintf("%s%s", keyPrefix, name)
 }
+
+// keyForSealedData returns the key to use when storing a SealedData.
+func keyForSealedData(name string) string {
+	return fmt.Sprintf("%s%s", sealedDataPrefix, name)
+}
+
+// keyForEKCertificate returns the key to use when storing an EKCertificate.
+func keyForEKCertificate(name string) string {
+	return fmt.Sprintf("%s%s", ekCertificatePrefix, name)
+}
@@ -78,4 +78,67 @@ func TestKey_MarshalUnmarshal(t *testing.T) {
 	err = json.Unmarshal(data, rkey)
 	require.NoError(t, err)
 	require.Equal(t, key, rkey)
+
+	key.Policy = []byte{5, 6, 7, 8}
+	data, err = json.Marshal(key)
+	require.NoError(t, err)
+
+	rkey = &Key{}
+	err = json.Unmarshal(data, rkey)
+	require.NoError(t, err)
+	require.Equal(t, key, rkey)
+}
+
+func TestSealedData_MarshalUnmarshal(t *testing.T) {
+	sd := &SealedData{
+		Name:      "sealed1",
+		Data:      []byte{1, 2, 3, 4},
+		CreatedAt: time.Time{},
+	}
+
+	data, err := json.Marshal(sd)
+	require.NoError(t, err)
+
+	var rsd = &SealedData{}
+	err = json.Unmarshal(data, rsd)
+	require.NoError(t, err)
+	require.Equal(t, sd, rsd)
+
+	data, err = json.Marshal(&Key{Name: "key1"})
+	require.NoError(t, err)
+	err = json.Unmarshal(data, rsd)
+	require.EqualError(t, err, `unexpected serialized data type "KEY"`)
+}
+
+func TestEKCertificate_MarshalUnmarshal(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+
+	signer, err := keyutil.GenerateSigner("RSA", "", 2048)
+	require.NoError(t, err)
+
+	cert, err := ca.Sign(&x509.Certificate{
+		PublicKey: signer.Public(),
+	})
+	require.NoError(t, err)
+
+	ekc := &EKCertificate{
+		Name:      "0123456789abcdef",
+		URL:       "https://ek.example.com/0123456789abcdef",
+		Chain:     []*x509.Certificate{cert, ca.Intermediate},
+		CreatedAt: time.Time{},
+	}
+
+	data, err := json.Marshal(ekc)
+	require.NoError(t, err)
+
+	var rekc = &EKCertificate{}
+	err = json.Unmarshal(data, rekc)
+	require.NoError(t, err)
+	require.Equal(t, ekc, rekc)
+
+	data, err = json.Marshal(&AK{Name: "ak1"})
+	require.NoError(t, err)
+	err = json.Unmarshal(data, rekc)
+	require.EqualError(t, err, `unexpected serialized data type "AK"`)
 }
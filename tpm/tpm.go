@@ -32,6 +32,7 @@ type TPM struct {
 	simulator              simulator.Simulator
 	commandChannel         CommandChannel
 	downloader             *downloader
+	ekRoots                *EKRoots
 	options                *options
 	initCommandChannelOnce sync.Once
 	info                   *Info
@@ -65,8 +66,8 @@ func WithStore(store storage.TPMStore) NewTPMOption {
 	}
 }
 
-// WithDisableDownload disables EK certificates from being downloaded
-// from online hosts.
+// WithDisableDownload disables EK certificates and their intermediate
+// CA certificates from being downloaded from online hosts.
 func WithDisableDownload() NewTPMOption {
 	return func(o *options) error {
 		o.downloader.enabled = false
@@ -74,6 +75,31 @@ func WithDisableDownload() NewTPMOption {
 	}
 }
 
+// WithHTTPClient is used to set the [HTTPClient] that is used to download
+// EK certificates and the intermediate CA certificates required to verify
+// them. Defaults to [http.DefaultClient].
+func WithHTTPClient(client HTTPClient) NewTPMOption {
+	return func(o *options) error {
+		if client == nil {
+			client = http.DefaultClient
+		}
+		o.downloader.client = client
+		return nil
+	}
+}
+
+// WithEKRoots is used to set the TPM manufacturer root certificates that
+// are used to verify EK certificates. Defaults to the roots returned by
+// [DefaultEKRoots], which only include the AMD roots. Callers verifying
+// EK certificates of other manufacturers must provide their roots, e.g.
+// by adding them to the [DefaultEKRoots] using [EKRoots.AddPEM].
+func WithEKRoots(roots *EKRoots) NewTPMOption {
+	return func(o *options) error {
+		o.ekRoots = roots
+		return nil
+	}
+}
+
 // WithSimulator is used to configure a TPM simulator implementation
 // that simulates TPM operations instead of interacting with an actual
 // TPM.
@@ -102,6 +128,7 @@ type options struct {
 	commandChannel CommandChannel
 	store          storage.TPMStore
 	downloader     *downloader
+	ekRoots        *EKRoots
 }
 
 func (o *options) validate() error {
@@ -136,6 +163,7 @@ func New(opts ...NewTPMOption) (*TPM, error) {
 		attestConfig:   tpmOptions.attestConfig,
 		store:          tpmOptions.store,
 		downloader:     tpmOptions.downloader,
+		ekRoots:        tpmOptions.ekRoots,
 		simulator:      tpmOptions.simulator,
 		commandChannel: tpmOptions.commandChannel,
 		options:        &tpmOptions,
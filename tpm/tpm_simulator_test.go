@@ -4,22 +4,30 @@
 package tpm
 
 import (
+	"bytes"
 	"context"
 	"crypto"
+	"crypto/ecdh"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/binary"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"math"
+	"net/http"
 	"strings"
 	"testing"
 
+	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/google/go-tpm/tpmutil"
 	"github.com/smallstep/go-attestation/attest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -27,6 +35,7 @@ import (
 	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/minica"
 	"go.step.sm/crypto/tpm/simulator"
+	"go.step.sm/crypto/tpm/skae"
 	"go.step.sm/crypto/tpm/storage"
 	"go.step.sm/crypto/tpm/tss2"
 	"go.step.sm/crypto/x509util"
@@ -212,6 +221,126 @@ func TestTPM_GetEKs(t *testing.T) {
 	require.Len(t, b, 32)
 }
 
+func TestTPM_VerifyEKCertificate(t *testing.T) {
+	ctx := context.Background()
+	tpm := newSimulatedTPM(t)
+	ca, err := minica.New()
+	require.NoError(t, err)
+
+	var downloads int
+	tpm.downloader.client = &mockClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			downloads++
+			if req.URL.String() != "https://ca.example.com/intermediate.der" {
+				return &http.Response{StatusCode: http.StatusNotFound, Body: http.NoBody}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewReader(ca.Intermediate.Raw)),
+			}, nil
+		},
+	}
+
+	eks, err := tpm.GetEKs(ctx)
+	require.NoError(t, err)
+	require.Len(t, eks, 1)
+	_, err = tpm.VerifyEKCertificate(ctx, eks[0])
+	assert.EqualError(t, err, "EK does not have a certificate")
+
+	ekCert := newTestEKCertificate(t, ca, eks[0].Public(), "https://ca.example.com/intermediate.der")
+	require.NoError(t, tpm.DefineNV(ctx, EKCertificateRSAIndex, NVConfig{
+		Size:       len(ekCert.Raw),
+		Attributes: NVOwnerWrite | NVOwnerRead | NVAuthRead | NVNoDA,
+	}))
+	require.NoError(t, tpm.WriteNV(ctx, EKCertificateRSAIndex, ekCert.Raw, 0, ""))
+
+	// reset the cached EKs, so that the EK certificate is read from NV
+	tpm.eks = nil
+	eks, err = tpm.GetEKs(ctx)
+	require.NoError(t, err)
+	require.Len(t, eks, 1)
+	ek := eks[0]
+	require.NotNil(t, ek.Certificate())
+
+	// the simulator manufacturer has no embedded roots
+	_, err = tpm.VerifyEKCertificate(ctx, ek)
+	assert.ErrorContains(t, err, "no EK roots available for TPM manufacturer")
+
+	info, err := tpm.Info(ctx)
+	require.NoError(t, err)
+	other, err := minica.New()
+	require.NoError(t, err)
+	tpm.ekRoots = NewEKRoots()
+	tpm.ekRoots.Add(info.Manufacturer.ID, other.Root)
+	_, err = tpm.VerifyEKCertificate(ctx, ek)
+	assert.Error(t, err)
+	assert.Equal(t, 1, downloads)
+
+	// the intermediate is downloaded once, and then read from storage
+	tpm.ekRoots = NewEKRoots()
+	tpm.ekRoots.Add(info.Manufacturer.ID, ca.Root)
+	for i := 0; i < 2; i++ {
+		chain, err := tpm.VerifyEKCertificate(ctx, ek)
+		require.NoError(t, err)
+		assert.Equal(t, []*x509.Certificate{ek.Certificate(), ca.Intermediate, ca.Root}, chain)
+		assert.Equal(t, 2, downloads)
+	}
+
+	name, err := ekCertificateName(ek.Public())
+	require.NoError(t, err)
+	ekc, err := tpm.store.GetEKCertificate(name)
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{ek.Certificate(), ca.Intermediate}, ekc.Chain)
+
+	_, err = tpm.VerifyEKCertificate(ctx, &EK{public: ca.Root.PublicKey, certificate: ek.Certificate()})
+	assert.EqualError(t, err, "EK certificate does not match EK public key")
+}
+
+func TestTPM_VerifyEKCertificate_withEKRoots(t *testing.T) {
+	ctx := context.Background()
+	ca, err := minica.New()
+	require.NoError(t, err)
+
+	// The roots of manufacturers that are not embedded, like the simulator,
+	// are provided by the caller on top of the default ones.
+	roots, err := DefaultEKRoots()
+	require.NoError(t, err)
+	tpm, err := New(withSimulator(t), WithStore(storage.NewDirstore(t.TempDir())), WithEKRoots(roots),
+		WithHTTPClient(&mockClient{
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(bytes.NewReader(ca.Intermediate.Raw)),
+				}, nil
+			},
+		}))
+	require.NoError(t, err)
+
+	eks, err := tpm.GetEKs(ctx)
+	require.NoError(t, err)
+	require.Len(t, eks, 1)
+	ekCert := newTestEKCertificate(t, ca, eks[0].Public(), "https://ca.example.com/intermediate.der")
+	require.NoError(t, tpm.DefineNV(ctx, EKCertificateRSAIndex, NVConfig{
+		Size:       len(ekCert.Raw),
+		Attributes: NVOwnerWrite | NVOwnerRead | NVAuthRead | NVNoDA,
+	}))
+	require.NoError(t, tpm.WriteNV(ctx, EKCertificateRSAIndex, ekCert.Raw, 0, ""))
+	tpm.eks = nil
+	eks, err = tpm.GetEKs(ctx)
+	require.NoError(t, err)
+	require.Len(t, eks, 1)
+
+	_, err = tpm.VerifyEKCertificate(ctx, eks[0])
+	assert.ErrorContains(t, err, "no EK roots available for TPM manufacturer")
+
+	info, err := tpm.Info(ctx)
+	require.NoError(t, err)
+	require.NoError(t, roots.AddPEM(info.Manufacturer.ID, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw})))
+	chain, err := tpm.VerifyEKCertificate(ctx, eks[0])
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{eks[0].Certificate(), ca.Intermediate, ca.Root}, chain)
+}
+
 func TestTPM_CreateAK(t *testing.T) {
 	tpm := newSimulatedTPM(t)
 	ak, err := tpm.CreateAK(context.Background(), "first-ak")
@@ -339,6 +468,287 @@ func TestAK_ActivateCredential(t *testing.T) {
 	require.Equal(t, expectedSecret, secret)
 }
 
+func TestTPM_ReadPCRs(t *testing.T) {
+	tpm := newSimulatedTPM(t)
+
+	pcrs, err := tpm.ReadPCRs(context.Background(), crypto.SHA256)
+	require.NoError(t, err)
+	require.Len(t, pcrs, 24)
+	for i, pcr := range pcrs {
+		require.Equal(t, i, pcr.Index)
+		require.Equal(t, crypto.SHA256, pcr.DigestAlgorithm)
+		require.Len(t, pcr.Digest, 32)
+	}
+
+	pcrs, err = tpm.ReadPCRs(context.Background(), crypto.SHA1)
+	require.NoError(t, err)
+	require.Len(t, pcrs, 24)
+	require.Len(t, pcrs[0].Digest, 20)
+
+	_, err = tpm.ReadPCRs(context.Background(), crypto.SHA512)
+	require.Error(t, err)
+}
+
+func TestTPM_MeasurementLog(t *testing.T) {
+	tpm := newSimulatedTPM(t)
+
+	// The simulator doesn't have a measurement log.
+	log, err := tpm.MeasurementLog(context.Background())
+	require.Error(t, err)
+	require.Nil(t, log)
+}
+
+func TestTPM_Seal(t *testing.T) {
+	tpm := newSimulatedTPM(t)
+	secret := []byte("the-disk-unlock-key")
+
+	sealed, err := tpm.Seal(context.Background(), "pcr-bound", secret, SealPolicy{
+		PCRs: &PCRSelection{Bank: crypto.SHA256, PCRs: []int{0, 7, 16}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "pcr-bound", sealed.Name())
+	require.NotEmpty(t, sealed.Data())
+
+	_, err = tpm.Seal(context.Background(), "pcr-bound", secret, SealPolicy{})
+	require.ErrorIs(t, err, ErrExists)
+
+	withPassword, err := tpm.Seal(context.Background(), "", secret, SealPolicy{
+		PCRs:     &PCRSelection{Bank: crypto.SHA1, PCRs: []int{16}},
+		Password: "password",
+	})
+	require.NoError(t, err)
+	require.Len(t, withPassword.Name(), 10)
+
+	_, err = tpm.Seal(context.Background(), "password-only", secret, SealPolicy{Password: "password"})
+	require.NoError(t, err)
+
+	// all PCRs in the bank are read in multiple commands
+	allPCRs, err := tpm.Seal(context.Background(), "all-pcrs", secret, SealPolicy{PCRs: &PCRSelection{Bank: crypto.SHA256}})
+	require.NoError(t, err)
+
+	sealedData, err := tpm.ListSealedData(context.Background())
+	require.NoError(t, err)
+	require.Len(t, sealedData, 4)
+
+	data, err := tpm.Unseal(context.Background(), "pcr-bound", "")
+	require.NoError(t, err)
+	require.Equal(t, secret, data)
+
+	data, err = withPassword.Unseal(context.Background(), "password")
+	require.NoError(t, err)
+	require.Equal(t, secret, data)
+
+	_, err = withPassword.Unseal(context.Background(), "wrong-password")
+	require.Error(t, err)
+
+	data, err = tpm.Unseal(context.Background(), "password-only", "password")
+	require.NoError(t, err)
+	require.Equal(t, secret, data)
+
+	data, err = allPCRs.Unseal(context.Background(), "")
+	require.NoError(t, err)
+	require.Equal(t, secret, data)
+
+	// the sealed data can be exported and unsealed using the TSS2 format
+	key, err := sealed.ToTSS2()
+	require.NoError(t, err)
+	pemBytes, err := key.EncodeToMemory()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(pemBytes), "-----BEGIN TSS2 PRIVATE KEY-----"))
+	data, err = tpm.UnsealTSS2(context.Background(), key, "")
+	require.NoError(t, err)
+	require.Equal(t, secret, data)
+
+	// extending a PCR prevents unsealing the data bound to it
+	measurement := sha256.Sum256([]byte("measurement"))
+	err = tpm2.PCRExtend(tpm.simulator, tpmutil.Handle(16), tpm2.AlgSHA256, measurement[:], "")
+	require.NoError(t, err)
+	_, err = tpm.Unseal(context.Background(), "pcr-bound", "")
+	require.Error(t, err)
+	_, err = tpm.Unseal(context.Background(), "all-pcrs", "")
+	require.Error(t, err)
+
+	// the SHA-1 bank was not extended
+	data, err = withPassword.Unseal(context.Background(), "password")
+	require.NoError(t, err)
+	require.Equal(t, secret, data)
+
+	_, err = tpm.Unseal(context.Background(), "non-existing", "")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	_, err = tpm.Seal(context.Background(), "too-long", make([]byte, 129), SealPolicy{})
+	require.Error(t, err)
+
+	_, err = tpm.Seal(context.Background(), "invalid-bank", secret, SealPolicy{PCRs: &PCRSelection{Bank: crypto.SHA512}})
+	require.Error(t, err)
+
+	err = tpm.DeleteSealedData(context.Background(), "pcr-bound")
+	require.NoError(t, err)
+	_, err = tpm.GetSealedData(context.Background(), "pcr-bound")
+	require.ErrorIs(t, err, ErrNotFound)
+	err = tpm.DeleteSealedData(context.Background(), "pcr-bound")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestTPM_NV(t *testing.T) {
+	tpm := newSimulatedTPM(t)
+	ctx := context.Background()
+	const (
+		index   uint32 = 0x01500000
+		counter uint32 = 0x01500001
+		owner   uint32 = 0x01500002
+	)
+
+	err := tpm.DefineNV(ctx, index, NVConfig{Size: 2048, Password: "password"})
+	require.NoError(t, err)
+	err = tpm.DefineNV(ctx, index, NVConfig{Size: 16})
+	require.ErrorIs(t, err, ErrExists)
+	err = tpm.DefineNV(ctx, counter, NVConfig{Counter: true})
+	require.NoError(t, err)
+	err = tpm.DefineNV(ctx, owner, NVConfig{Size: 16, Attributes: NVOwnerWrite | NVOwnerRead | NVNoDA})
+	require.NoError(t, err)
+
+	nv, err := tpm.GetNV(ctx, index)
+	require.NoError(t, err)
+	require.Equal(t, index, nv.Index)
+	require.Equal(t, 2048, nv.Size)
+	require.False(t, nv.Attributes.IsCounter())
+	require.Zero(t, nv.Attributes&NVWritten)
+
+	// data larger than the NV buffer size is written in multiple commands
+	data := make([]byte, 2048)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+	err = tpm.WriteNV(ctx, index, data, 0, "password")
+	require.NoError(t, err)
+	err = tpm.WriteNV(ctx, index, data, 0, "wrong-password")
+	require.Error(t, err)
+	err = tpm.WriteNV(ctx, index, []byte("overflow"), 2044, "password")
+	require.Error(t, err)
+
+	got, err := tpm.ReadNV(ctx, index, "password")
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	err = tpm.WriteNV(ctx, index, []byte("hello"), 10, "password")
+	require.NoError(t, err)
+	got, err = tpm.ReadNV(ctx, index, "password")
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), got[10:15])
+
+	err = tpm.WriteNV(ctx, owner, []byte("owner"), 0, "")
+	require.NoError(t, err)
+	got, err = tpm.ReadNV(ctx, owner, "")
+	require.NoError(t, err)
+	require.Equal(t, []byte("owner"), got[:5])
+
+	value, err := tpm.IncrementCounter(ctx, counter, "")
+	require.NoError(t, err)
+	next, err := tpm.IncrementCounter(ctx, counter, "")
+	require.NoError(t, err)
+	require.Equal(t, value+1, next)
+	err = tpm.WriteNV(ctx, counter, []byte("data"), 0, "")
+	require.Error(t, err)
+	_, err = tpm.IncrementCounter(ctx, index, "password")
+	require.Error(t, err)
+
+	nvs, err := tpm.ListNV(ctx)
+	require.NoError(t, err)
+	var indices []uint32
+	for _, nv := range nvs {
+		indices = append(indices, nv.Index)
+		if nv.Index == counter {
+			require.True(t, nv.Attributes.IsCounter())
+			require.NotZero(t, nv.Attributes&NVWritten)
+		}
+	}
+	require.Subset(t, indices, []uint32{index, counter, owner})
+
+	// the NV index can be used to store certificates
+	ca, err := minica.New()
+	require.NoError(t, err)
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	cert, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "nv-certificate"},
+		PublicKey: signer.Public(),
+	})
+	require.NoError(t, err)
+	err = tpm.WriteNV(ctx, index, cert.Raw, 0, "password")
+	require.NoError(t, err)
+	_, err = tpm.ReadNVCertificate(ctx, index)
+	require.Error(t, err) // the NV index requires a password
+	err = tpm.DefineNV(ctx, EKCertificateECCIndex, NVConfig{
+		Size:       len(cert.Raw) + 16, // padded
+		Attributes: NVOwnerWrite | NVAuthRead | NVOwnerRead | NVNoDA,
+	})
+	require.NoError(t, err)
+	err = tpm.WriteNV(ctx, EKCertificateECCIndex, cert.Raw, 0, "")
+	require.NoError(t, err)
+	got, err = tpm.ReadNV(ctx, EKCertificateECCIndex, "")
+	require.NoError(t, err)
+	require.Len(t, got, len(cert.Raw)+16)
+	nvCert, err := tpm.ReadNVCertificate(ctx, EKCertificateECCIndex)
+	require.NoError(t, err)
+	require.Equal(t, cert.Raw, nvCert.Raw)
+
+	err = tpm.UndefineNV(ctx, index)
+	require.NoError(t, err)
+	_, err = tpm.GetNV(ctx, index)
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = tpm.ReadNV(ctx, index, "password")
+	require.ErrorIs(t, err, ErrNotFound)
+	err = tpm.UndefineNV(ctx, index)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	err = tpm.DefineNV(ctx, 0x81000001, NVConfig{Size: 16})
+	require.Error(t, err)
+	err = tpm.DefineNV(ctx, index, NVConfig{})
+	require.Error(t, err)
+}
+
+func TestAK_Quote(t *testing.T) {
+	tpm := newSimulatedTPM(t)
+	ak, err := tpm.CreateAK(context.Background(), "first-ak")
+	require.NoError(t, err)
+
+	// extend the debug PCR, so that it has a known, non-zero value
+	measurement := sha256.Sum256([]byte("measurement"))
+	err = tpm2.PCRExtend(tpm.simulator, tpmutil.Handle(16), tpm2.AlgSHA256, measurement[:], "")
+	require.NoError(t, err)
+	expected := sha256.Sum256(append(make([]byte, 32), measurement[:]...))
+
+	nonce := []byte("nonce")
+	quote, err := ak.Quote(context.Background(), nonce, PCRSelection{Bank: crypto.SHA256, PCRs: []int{16, 0, 7}})
+	require.NoError(t, err)
+	require.Len(t, quote.PCRs, 3)
+	require.Equal(t, []int{0, 7, 16}, []int{quote.PCRs[0].Index, quote.PCRs[1].Index, quote.PCRs[2].Index})
+	require.Equal(t, expected[:], quote.PCRs[2].Digest)
+
+	akPublic := ak.Public()
+	require.NotNil(t, akPublic)
+
+	err = VerifyQuote(akPublic, quote, nonce, []PCR{{Index: 16, Digest: expected[:], DigestAlgorithm: crypto.SHA256}})
+	require.NoError(t, err)
+
+	err = VerifyQuote(akPublic, quote, []byte("other-nonce"), nil)
+	require.Error(t, err)
+
+	var pcrErr *PCRMismatchError
+	err = VerifyQuote(akPublic, quote, nonce, []PCR{{Index: 16, Digest: measurement[:], DigestAlgorithm: crypto.SHA256}})
+	require.ErrorAs(t, err, &pcrErr)
+	require.Equal(t, 16, pcrErr.Index)
+
+	// all PCRs in the SHA-1 bank
+	quote, err = ak.Quote(context.Background(), nonce, PCRSelection{Bank: crypto.SHA1})
+	require.NoError(t, err)
+	require.Len(t, quote.PCRs, 24)
+	require.NoError(t, VerifyQuote(akPublic, quote, nonce, nil))
+
+	_, err = ak.Quote(context.Background(), nonce, PCRSelection{Bank: crypto.SHA256, PCRs: []int{24}})
+	require.Error(t, err)
+}
+
 func TestAK_Blobs(t *testing.T) {
 	tpm := newSimulatedTPM(t)
 	ak, err := tpm.CreateAK(context.Background(), "first-ak")
@@ -530,6 +940,322 @@ func TestTPM_AttestKey(t *testing.T) {
 	assert.Nil(t, key)
 }
 
+func TestTPM_CreateKey_policy(t *testing.T) {
+	tpm := newSimulatedTPM(t)
+	ctx := context.Background()
+	digest := sha256.Sum256([]byte("rulingly-quailed-cloacal-indifferentist-roughhoused-self-mad"))
+
+	sign := func(t *testing.T, signer crypto.Signer) error {
+		t.Helper()
+		sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			return err
+		}
+		pub, ok := signer.Public().(*ecdsa.PublicKey)
+		require.True(t, ok)
+		require.True(t, ecdsa.VerifyASN1(pub, digest[:], sig))
+		return nil
+	}
+
+	pcrBound, err := tpm.CreateKey(ctx, "pcr-bound", CreateKeyConfig{
+		Algorithm: "ECDSA",
+		Size:      256,
+		Policy: &KeyPolicy{
+			PCRs: &PCRSelection{Bank: crypto.SHA256, PCRs: []int{7, 16}},
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, pcrBound.HasPolicy())
+	require.False(t, pcrBound.HasPassword())
+
+	withPassword, err := tpm.CreateKey(ctx, "password", CreateKeyConfig{
+		Algorithm: "ECDSA",
+		Size:      256,
+		Password:  "password",
+	})
+	require.NoError(t, err)
+	require.False(t, withPassword.HasPolicy())
+	require.True(t, withPassword.HasPassword())
+
+	pcrAndPassword, err := tpm.CreateKey(ctx, "pcr-and-password", CreateKeyConfig{
+		Algorithm: "ECDSA",
+		Size:      256,
+		Password:  "password",
+		Policy: &KeyPolicy{
+			PCRs: &PCRSelection{Bank: crypto.SHA1, PCRs: []int{16}},
+		},
+	})
+	require.NoError(t, err)
+
+	// the OR policy is satisfied by the current value of PCR 16 or by
+	// the current value of PCR 23.
+	measurement := sha256.Sum256([]byte("measurement"))
+	orBound, err := tpm.CreateKey(ctx, "or-bound", CreateKeyConfig{
+		Algorithm: "ECDSA",
+		Size:      256,
+		Policy: &KeyPolicy{
+			Or: []KeyPolicy{
+				{PCRs: &PCRSelection{Bank: crypto.SHA256, PCRs: []int{16}}},
+				{PCRs: &PCRSelection{Bank: crypto.SHA256, PCRs: []int{23}}},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	authority, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	authorized, err := tpm.CreateKey(ctx, "authorized", CreateKeyConfig{
+		Algorithm: "ECDSA",
+		Size:      256,
+		Policy: &KeyPolicy{
+			Authorize: &AuthorizePolicy{Authority: authority.Public(), PolicyRef: []byte("ref")},
+		},
+	})
+	require.NoError(t, err)
+	pcrPolicy, err := tpm.PCRPolicy(ctx, PCRSelection{Bank: crypto.SHA256, PCRs: []int{16}})
+	require.NoError(t, err)
+	signedPolicy, err := tss2.SignPolicy(authority, "pcr16", []byte("ref"), pcrPolicy)
+	require.NoError(t, err)
+	require.NoError(t, authorized.AddSignedPolicy(ctx, signedPolicy))
+	require.Error(t, pcrBound.AddSignedPolicy(ctx, signedPolicy))
+
+	// the policy is persisted with the key
+	key, err := tpm.GetKey(ctx, "authorized")
+	require.NoError(t, err)
+	require.Equal(t, authorized.auth, key.auth)
+
+	signer, err := pcrBound.Signer(ctx)
+	require.NoError(t, err)
+	require.NoError(t, sign(t, signer))
+
+	signer, err = tpm.GetSigner(ctx, "password")
+	require.NoError(t, err)
+	require.Error(t, sign(t, signer))
+	signer, err = withPassword.SignerWithPassword(ctx, "password")
+	require.NoError(t, err)
+	require.NoError(t, sign(t, signer))
+
+	signer, err = tpm.GetSignerWithPassword(ctx, "pcr-and-password", "wrong-password")
+	require.NoError(t, err)
+	require.Error(t, sign(t, signer))
+	signer, err = pcrAndPassword.SignerWithPassword(ctx, "password")
+	require.NoError(t, err)
+	require.NoError(t, sign(t, signer))
+
+	orSigner, err := orBound.Signer(ctx)
+	require.NoError(t, err)
+	require.NoError(t, sign(t, orSigner))
+
+	authorizedSigner, err := tpm.GetSigner(ctx, "authorized")
+	require.NoError(t, err)
+	require.NoError(t, sign(t, authorizedSigner))
+
+	// the keys can be exported to the TSS2 format with their policy
+	tss2Key, err := pcrAndPassword.ToTSS2(ctx)
+	require.NoError(t, err)
+	require.False(t, tss2Key.EmptyAuth)
+	require.Len(t, tss2Key.Policy, 2)
+	tss2Signer, err := CreateTSS2SignerWithPassword(ctx, tpm, tss2Key, "password")
+	require.NoError(t, err)
+	require.NoError(t, sign(t, tss2Signer))
+
+	tss2Key, err = authorized.ToTSS2(ctx)
+	require.NoError(t, err)
+	require.Len(t, tss2Key.AuthPolicy, 1)
+	tss2Signer, err = CreateTSS2Signer(ctx, tpm, tss2Key)
+	require.NoError(t, err)
+	require.NoError(t, sign(t, tss2Signer))
+
+	// extending PCR 16 only breaks the keys not accepting its new value
+	err = tpm2.PCRExtend(tpm.simulator, tpmutil.Handle(16), tpm2.AlgSHA256, measurement[:], "")
+	require.NoError(t, err)
+	require.NoError(t, sign(t, signer)) // the SHA-1 bank was not extended
+	signer, err = pcrBound.Signer(ctx)
+	require.NoError(t, err)
+	require.Error(t, sign(t, signer))
+	require.NoError(t, sign(t, orSigner))
+	require.Error(t, sign(t, authorizedSigner))
+
+	// a new signed policy authorizes the key again
+	pcrPolicy, err = tpm.PCRPolicy(ctx, PCRSelection{Bank: crypto.SHA256, PCRs: []int{16}})
+	require.NoError(t, err)
+	signedPolicy, err = tss2.SignPolicy(authority, "pcr16-updated", []byte("ref"), pcrPolicy)
+	require.NoError(t, err)
+	require.NoError(t, authorized.AddSignedPolicy(ctx, signedPolicy))
+	authorizedSigner, err = tpm.GetSigner(ctx, "authorized")
+	require.NoError(t, err)
+	require.NoError(t, sign(t, authorizedSigner))
+
+	// invalid policies
+	_, err = tpm.CreateKey(ctx, "empty-policy", CreateKeyConfig{Algorithm: "ECDSA", Size: 256, Policy: &KeyPolicy{}})
+	require.Error(t, err)
+	_, err = tpm.CreateKey(ctx, "single-branch", CreateKeyConfig{Algorithm: "ECDSA", Size: 256, Policy: &KeyPolicy{
+		Or: []KeyPolicy{{PCRs: &PCRSelection{Bank: crypto.SHA256, PCRs: []int{16}}}},
+	}})
+	require.Error(t, err)
+	_, err = tpm.CreateKey(ctx, "authorize-in-or", CreateKeyConfig{Algorithm: "ECDSA", Size: 256, Policy: &KeyPolicy{
+		Or: []KeyPolicy{
+			{PCRs: &PCRSelection{Bank: crypto.SHA256, PCRs: []int{16}}},
+			{Authorize: &AuthorizePolicy{Authority: authority.Public()}},
+		},
+	}})
+	require.Error(t, err)
+}
+
+func TestTPM_AttestKey_policy(t *testing.T) {
+	tpm := newSimulatedTPM(t)
+	ctx := context.Background()
+	ak, err := tpm.CreateAK(ctx, "first-ak")
+	require.NoError(t, err)
+
+	key, err := tpm.AttestKey(ctx, "first-ak", "first-key", AttestKeyConfig{
+		Algorithm:      "ECDSA",
+		Size:           256,
+		QualifyingData: []byte("qualifying-data"),
+		Password:       "password",
+		Policy: &KeyPolicy{
+			PCRs: &PCRSelection{Bank: crypto.SHA256, PCRs: []int{0, 7}},
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, key.WasAttestedBy(ak))
+	require.True(t, key.HasPassword())
+	require.True(t, key.HasPolicy())
+
+	params, err := key.CertificationParameters(ctx)
+	require.NoError(t, err)
+	akParams, err := ak.AttestationParameters(ctx)
+	require.NoError(t, err)
+	akPublic, err := attest.ParseAKPublic(attest.TPMVersion20, akParams.Public)
+	require.NoError(t, err)
+	err = params.Verify(attest.VerifyOpts{
+		Public: akPublic.Public,
+		Hash:   akPublic.Hash,
+	})
+	require.NoError(t, err)
+
+	signer, err := key.SignerWithPassword(ctx, "password")
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte("rulingly-quailed-cloacal-indifferentist-roughhoused-self-mad"))
+	sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	require.NoError(t, err)
+	pub, ok := signer.Public().(*ecdsa.PublicKey)
+	require.True(t, ok)
+	require.True(t, ecdsa.VerifyASN1(pub, digest[:], sig))
+
+	_, err = tpm.AttestKey(ctx, "first-ak", "first-key", AttestKeyConfig{Algorithm: "ECDSA", Size: 256, Password: "password"})
+	require.ErrorIs(t, err, ErrExists)
+	_, err = tpm.AttestKey(ctx, "non-existing-ak", "second-key", AttestKeyConfig{Algorithm: "ECDSA", Size: 256, Password: "password"})
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestTPM_ImportKey(t *testing.T) {
+	tpm := newSimulatedTPM(t)
+	ctx := context.Background()
+	digest := sha256.Sum256([]byte("bioherm-defoliator-unabsolved-snobbery-tinhorn"))
+
+	verify := func(t *testing.T, signer crypto.Signer, pub crypto.PublicKey) {
+		t.Helper()
+		sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		require.NoError(t, err)
+		switch p := pub.(type) {
+		case *ecdsa.PublicKey:
+			assert.True(t, ecdsa.VerifyASN1(p, digest[:], sig))
+		case *rsa.PublicKey:
+			assert.NoError(t, rsa.VerifyPKCS1v15(p, crypto.SHA256, digest[:], sig))
+		default:
+			t.Fatalf("unexpected public key type %T", pub)
+		}
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	t.Run("ok RSA", func(t *testing.T) {
+		key, err := tpm.ImportKey(ctx, "rsa-key", rsaKey, ImportKeyConfig{})
+		require.NoError(t, err)
+		require.Equal(t, "rsa-key", key.Name())
+		require.False(t, key.WasAttested())
+		require.False(t, key.HasPassword())
+
+		signer, err := tpm.GetSigner(ctx, "rsa-key")
+		require.NoError(t, err)
+		require.Equal(t, rsaKey.Public(), signer.Public())
+		verify(t, signer, rsaKey.Public())
+	})
+
+	t.Run("ok ECDSA password", func(t *testing.T) {
+		key, err := tpm.ImportKey(ctx, "ecdsa-key", ecKey, ImportKeyConfig{Password: "password"})
+		require.NoError(t, err)
+		require.True(t, key.HasPassword())
+
+		signer, err := tpm.GetSignerWithPassword(ctx, "ecdsa-key", "password")
+		require.NoError(t, err)
+		require.Equal(t, ecKey.Public(), signer.Public())
+		verify(t, signer, ecKey.Public())
+
+		signer, err = tpm.GetSignerWithPassword(ctx, "ecdsa-key", "wrong-password")
+		require.NoError(t, err)
+		_, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		assert.Error(t, err)
+	})
+
+	t.Run("ok policy", func(t *testing.T) {
+		key, err := tpm.ImportKey(ctx, "policy-key", ecKey, ImportKeyConfig{
+			Policy: &KeyPolicy{PCRs: &PCRSelection{Bank: crypto.SHA256, PCRs: []int{0, 7}}},
+		})
+		require.NoError(t, err)
+		require.True(t, key.HasPolicy())
+
+		signer, err := key.Signer(ctx)
+		require.NoError(t, err)
+		verify(t, signer, ecKey.Public())
+	})
+
+	t.Run("ok TSS2", func(t *testing.T) {
+		srk, err := tpm.GetSRK(ctx)
+		require.NoError(t, err)
+
+		for _, parent := range []tpmutil.Handle{0x40000001, 0x81000001} {
+			wrapped, err := tss2.CreateImportable(srk, rsaKey, "", tss2.WithParent(parent))
+			require.NoError(t, err)
+			pemBytes, err := wrapped.EncodeToMemory()
+			require.NoError(t, err)
+
+			block, _ := pem.Decode(pemBytes)
+			require.NotNil(t, block)
+			tss2Key, err := tss2.ParsePrivateKey(block.Bytes)
+			require.NoError(t, err)
+
+			signer, err := CreateTSS2Signer(ctx, tpm, tss2Key)
+			require.NoError(t, err)
+			verify(t, signer, rsaKey.Public())
+			verify(t, signer, rsaKey.Public())
+		}
+	})
+
+	t.Run("fail exists", func(t *testing.T) {
+		_, err := tpm.ImportKey(ctx, "rsa-key", rsaKey, ImportKeyConfig{})
+		assert.ErrorIs(t, err, ErrExists)
+	})
+
+	t.Run("fail key type", func(t *testing.T) {
+		_, err := tpm.ImportKey(ctx, "bad-key", []byte("key"), ImportKeyConfig{})
+		assert.Error(t, err)
+	})
+
+	t.Run("fail other TPM", func(t *testing.T) {
+		wrapped, err := tss2.CreateImportable(rsaKey.Public(), ecKey, "")
+		require.NoError(t, err)
+		signer, err := CreateTSS2Signer(ctx, tpm, wrapped)
+		require.NoError(t, err)
+		_, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		assert.Error(t, err)
+	})
+}
+
 func TestTPM_GetKey(t *testing.T) {
 	tpm := newSimulatedTPM(t)
 	config := CreateKeyConfig{
@@ -651,6 +1377,61 @@ func TestKey_CertificationParameters(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestKey_SKAE(t *testing.T) {
+	tpm := newSimulatedTPM(t)
+	ak, err := tpm.CreateAK(context.Background(), "ak")
+	require.NoError(t, err)
+	key, err := tpm.AttestKey(context.Background(), "ak", "key", AttestKeyConfig{Algorithm: "ECDSA", Size: 256})
+	require.NoError(t, err)
+	params, err := key.CertificationParameters(context.Background())
+	require.NoError(t, err)
+	signer, err := key.Signer(context.Background())
+	require.NoError(t, err)
+
+	ca, err := minica.New()
+	require.NoError(t, err)
+	akCert, err := ca.Sign(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "ak"},
+		PublicKey:             ak.Public(),
+		IssuingCertificateURL: []string{"https://ca.example.com/intermediate.crt"},
+	})
+	require.NoError(t, err)
+
+	ext, err := skae.CreateSubjectKeyAttestationEvidenceExtension(akCert, params, false)
+	require.NoError(t, err)
+	cert, err := x509util.NewCertificateFromX509(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "key"},
+		PublicKey: signer.Public(),
+	}, x509util.WithExtensions(ext))
+	require.NoError(t, err)
+	leaf, err := ca.Sign(cert.GetCertificate())
+	require.NoError(t, err)
+
+	// the key can be verified from the leaf and AK certificates
+	err = skae.VerifyCertificate(leaf, akCert)
+	require.NoError(t, err)
+
+	evidence, err := skae.ParseSubjectKeyAttestationEvidenceExtension(ext)
+	require.NoError(t, err)
+	require.Equal(t, []string{"https://ca.example.com/intermediate.crt"}, evidence.IssuingCertificateURL)
+
+	// the evidence doesn't verify other keys or AKs
+	other, err := tpm.AttestKey(context.Background(), "ak", "other", AttestKeyConfig{Algorithm: "ECDSA", Size: 256})
+	require.NoError(t, err)
+	otherSigner, err := other.Signer(context.Background())
+	require.NoError(t, err)
+	require.Error(t, evidence.Verify(akCert, otherSigner.Public()))
+
+	otherAK, err := tpm.CreateAK(context.Background(), "other-ak")
+	require.NoError(t, err)
+	otherAKCert, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "other-ak"},
+		PublicKey: otherAK.Public(),
+	})
+	require.NoError(t, err)
+	require.Error(t, skae.VerifyCertificate(leaf, otherAKCert))
+}
+
 func TestKey_Blobs(t *testing.T) {
 	tpm := newSimulatedTPM(t)
 	config := CreateKeyConfig{
@@ -1024,6 +1805,114 @@ func Test_tss2Signer_Sign_RSAPSS(t *testing.T) {
 	}))
 }
 
+func TestTPM_GetDecrypter(t *testing.T) {
+	ctx := context.Background()
+	tpm := newSimulatedTPM(t)
+	_, err := tpm.CreateAK(ctx, "ak")
+	require.NoError(t, err)
+
+	msg := []byte("unsquirted-prologuize-caryatidal-antiepiscopist")
+
+	t.Run("ok RSA", func(t *testing.T) {
+		key, err := tpm.CreateKey(ctx, "rsa-key", CreateKeyConfig{Algorithm: "RSA", Size: 2048, Decrypt: true})
+		require.NoError(t, err)
+
+		decrypter, err := key.Decrypter(ctx)
+		require.NoError(t, err)
+		pub, ok := decrypter.Public().(*rsa.PublicKey)
+		require.True(t, ok)
+
+		ciphertext, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, msg, nil)
+		require.NoError(t, err)
+		plaintext, err := decrypter.Decrypt(rand.Reader, ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256})
+		require.NoError(t, err)
+		assert.Equal(t, msg, plaintext)
+
+		// Decryption keys cannot sign.
+		signer, err := key.Signer(ctx)
+		require.NoError(t, err)
+		digest := sha256.Sum256(msg)
+		_, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		assert.Error(t, err)
+	})
+
+	t.Run("ok ECDSA password", func(t *testing.T) {
+		key, err := tpm.CreateKey(ctx, "ecdsa-key", CreateKeyConfig{Algorithm: "ECDSA", Size: 256, Password: "password", Decrypt: true})
+		require.NoError(t, err)
+
+		decrypter, err := tpm.GetDecrypterWithPassword(ctx, "ecdsa-key", "password")
+		require.NoError(t, err)
+		pub, ok := decrypter.Public().(*ecdsa.PublicKey)
+		require.True(t, ok)
+		ecdhPublic, err := pub.ECDH()
+		require.NoError(t, err)
+
+		remote, err := ecdh.P256().GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		want, err := remote.ECDH(ecdhPublic)
+		require.NoError(t, err)
+		got, err := decrypter.ECDH(remote.PublicKey())
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+
+		decrypter, err = key.DecrypterWithPassword(ctx, "wrong-password")
+		require.NoError(t, err)
+		_, err = decrypter.ECDH(remote.PublicKey())
+		assert.Error(t, err)
+	})
+
+	t.Run("ok attested", func(t *testing.T) {
+		key, err := tpm.AttestKey(ctx, "ak", "attested-key", AttestKeyConfig{Algorithm: "ECDSA", Size: 256, Decrypt: true})
+		require.NoError(t, err)
+		require.True(t, key.WasAttested())
+
+		decrypter, err := key.Decrypter(ctx)
+		require.NoError(t, err)
+		pub, ok := decrypter.Public().(*ecdsa.PublicKey)
+		require.True(t, ok)
+		ecdhPublic, err := pub.ECDH()
+		require.NoError(t, err)
+
+		remote, err := ecdh.P256().GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		want, err := remote.ECDH(ecdhPublic)
+		require.NoError(t, err)
+		got, err := decrypter.ECDH(remote.PublicKey())
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("ok TSS2", func(t *testing.T) {
+		key, err := tpm.GetKey(ctx, "rsa-key")
+		require.NoError(t, err)
+		tss2Key, err := key.ToTSS2(ctx)
+		require.NoError(t, err)
+
+		decrypter, err := CreateTSS2Decrypter(ctx, tpm, tss2Key)
+		require.NoError(t, err)
+		pub, ok := decrypter.Public().(*rsa.PublicKey)
+		require.True(t, ok)
+
+		ciphertext, err := rsa.EncryptPKCS1v15(rand.Reader, pub, msg)
+		require.NoError(t, err)
+		plaintext, err := decrypter.Decrypt(rand.Reader, ciphertext, nil)
+		require.NoError(t, err)
+		assert.Equal(t, msg, plaintext)
+	})
+
+	t.Run("fail signing key", func(t *testing.T) {
+		_, err := tpm.CreateKey(ctx, "signing-key", CreateKeyConfig{Algorithm: "ECDSA", Size: 256})
+		require.NoError(t, err)
+		_, err = tpm.GetDecrypter(ctx, "signing-key")
+		assert.Error(t, err)
+	})
+
+	t.Run("fail not found", func(t *testing.T) {
+		_, err := tpm.GetDecrypter(ctx, "not-found")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
 func TestTPMOnlyFailsWithoutStorageWhenRequired(t *testing.T) {
 	tpm, err := New(withSimulator(t)) // defaults to blackhole; no storage
 	require.NoError(t, err)
@@ -29,15 +29,22 @@ func (ak *AK) ToTSS2(ctx context.Context) (*tss2.TPMKey, error) {
 	), nil
 }
 
-// ToTSS2 gets the public and private blobs and returns a [*tss2.TPMKey].
+// ToTSS2 gets the public and private blobs and returns a [*tss2.TPMKey]. The
+// password and policy of the Key are included in it.
 func (k *Key) ToTSS2(ctx context.Context) (*tss2.TPMKey, error) {
 	blobs, err := k.Blobs(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return tss2.New(
-		blobs.public,
-		blobs.private,
+	opts := []tss2.TPMOption{
 		tss2.WithParent(commonSrkEquivalentHandle), // default parent used by go-tpm/go-attestation
-	), nil
+	}
+	if k.auth != nil {
+		opts = append(opts,
+			tss2.WithEmptyAuth(!k.auth.Password),
+			tss2.WithPolicy(k.auth.Policy...),
+			tss2.WithAuthPolicy(k.auth.AuthPolicy...),
+		)
+	}
+	return tss2.New(blobs.public, blobs.private, opts...), nil
 }
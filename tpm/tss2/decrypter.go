@@ -0,0 +1,299 @@
+package tss2
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+)
+
+// Decrypter implements [crypto.Decrypter] using a [TPMKey]. RSA keys are used
+// to decrypt using RSA-OAEP or RSAES-PKCS1-v1_5, and ECDSA keys are used to
+// compute ECDH shared secrets with [Decrypter.ECDH]. The key must have been
+// created with the decrypt attribute.
+//
+// # Experimental
+//
+// Notice: This API is EXPERIMENTAL and may be changed or removed in a later
+// release.
+type Decrypter struct {
+	m           sync.Mutex
+	rw          io.ReadWriter
+	publicKey   crypto.PublicKey
+	tpmKey      *TPMKey
+	srkTemplate tpm2.Public
+	password    string
+}
+
+// CreateDecrypter creates a new [crypto.Decrypter] with the given TPM (rw)
+// and [TPMKey]. The caller is responsible for opening and closing the TPM.
+//
+// # Experimental
+//
+// Notice: This API is EXPERIMENTAL and may be changed or removed in a later
+// release.
+func CreateDecrypter(rw io.ReadWriter, key *TPMKey) (*Decrypter, error) {
+	switch {
+	case rw == nil:
+		return nil, errors.New("invalid TPM channel: rw cannot be nil")
+	case key == nil:
+		return nil, errors.New("invalid TPM key: key cannot be nil")
+	}
+	if err := validateLoadableKey(key); err != nil {
+		return nil, err
+	}
+
+	public, err := tpm2.DecodePublic(key.PublicKey[2:])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding TSS2 public key: %w", err)
+	}
+	if public.Attributes&tpm2.FlagDecrypt == 0 || public.Attributes&tpm2.FlagRestricted != 0 {
+		return nil, errors.New("invalid TSS2 key: key is not a decryption key")
+	}
+	publicKey, err := public.Key()
+	if err != nil {
+		return nil, fmt.Errorf("error decoding TSS2 public key: %w", err)
+	}
+
+	switch publicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported decryption key type %T", publicKey)
+	}
+
+	return &Decrypter{
+		rw:          rw,
+		publicKey:   publicKey,
+		tpmKey:      key,
+		srkTemplate: RSASRKTemplate,
+	}, nil
+}
+
+// SetSRKTemplate allows to change the Storage Root Key (SRK) template used
+// to load the the public/private blobs into an object in the TPM. It
+// defaults to [RSASRKTemplate].
+//
+// # Experimental
+//
+// Notice: This API is EXPERIMENTAL and may be changed or removed in a later
+// release.
+func (d *Decrypter) SetSRKTemplate(p tpm2.Public) {
+	d.m.Lock()
+	d.srkTemplate = p
+	d.m.Unlock()
+}
+
+// SetPassword sets the authorization value used to decrypt with keys that
+// don't have an empty auth.
+//
+// # Experimental
+//
+// Notice: This API is EXPERIMENTAL and may be changed or removed in a later
+// release.
+func (d *Decrypter) SetPassword(password string) {
+	d.m.Lock()
+	d.password = password
+	d.m.Unlock()
+}
+
+// SetCommandChannel allows to change the TPM channel. This operation is
+// useful if the channel set in [CreateDecrypter] is closed and opened again
+// before calling [Decrypter.Decrypt] or [Decrypter.ECDH].
+//
+// # Experimental
+//
+// Notice: This API is EXPERIMENTAL and may be changed or removed in a later
+// release.
+func (d *Decrypter) SetCommandChannel(rw io.ReadWriter) {
+	d.m.Lock()
+	d.rw = rw
+	d.m.Unlock()
+}
+
+// Public implements the [crypto.Decrypter] interface.
+func (d *Decrypter) Public() crypto.PublicKey {
+	return d.publicKey
+}
+
+// Decrypt implements the [crypto.Decrypter] interface. RSA-OAEP is used if
+// opts is an [*rsa.OAEPOptions], otherwise RSAES-PKCS1-v1_5 is used. Labels
+// in RSA-OAEP must be empty or end with a zero byte, as required by the TPM.
+// Decrypt is not supported with ECDSA keys, [Decrypter.ECDH] must be used
+// instead.
+func (d *Decrypter) Decrypt(_ io.Reader, msg []byte, opts crypto.DecrypterOpts) (plaintext []byte, err error) {
+	if _, ok := d.publicKey.(*rsa.PublicKey); !ok {
+		return nil, fmt.Errorf("decrypt is not supported with %T keys", d.publicKey)
+	}
+
+	scheme := &tpm2.AsymScheme{Alg: tpm2.AlgRSAES}
+	var label string
+	switch o := opts.(type) {
+	case nil, *rsa.PKCS1v15DecryptOptions:
+	case *rsa.OAEPOptions:
+		if o.MGFHash != 0 && o.MGFHash != o.Hash {
+			return nil, errors.New("invalid OAEP options: MGF hash must be the same as the hash")
+		}
+		h, err := tpm2.HashToAlgorithm(o.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("error getting algorithm: %w", err)
+		}
+		scheme = &tpm2.AsymScheme{Alg: tpm2.AlgOAEP, Hash: h}
+		if n := len(o.Label); n > 0 {
+			if o.Label[n-1] != 0 {
+				return nil, errors.New("invalid OAEP options: label must end with a zero byte")
+			}
+			label = string(o.Label[:n-1])
+		}
+	default:
+		return nil, fmt.Errorf("unsupported decrypter options %T", opts)
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	keyHandle, session, password, closer, err := d.load()
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+
+	if plaintext, err = tpm2.RSADecryptWithSession(d.rw, session, keyHandle, password, msg, scheme, label); err != nil {
+		return nil, fmt.Errorf("error decrypting data: %w", err)
+	}
+	return plaintext, nil
+}
+
+// ECDH performs an ECDH exchange with the remote public key and returns the
+// shared secret, the x-coordinate of the shared point, as specified in SEC 1,
+// Version 2.0, Section 3.3.1. The curve of the remote public key must be the
+// curve of the key.
+//
+// # Experimental
+//
+// Notice: This API is EXPERIMENTAL and may be changed or removed in a later
+// release.
+func (d *Decrypter) ECDH(remote *ecdh.PublicKey) ([]byte, error) {
+	pub, ok := d.publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("ECDH is not supported with %T keys", d.publicKey)
+	}
+	curve, err := ecdhCurve(pub.Curve)
+	if err != nil {
+		return nil, err
+	}
+	if remote == nil || remote.Curve() != curve {
+		return nil, errors.New("invalid remote public key: curve does not match")
+	}
+
+	// Uncompressed points are encoded as 0x04 || X || Y.
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	point := remote.Bytes()
+	inPoint := tpm2.ECPoint{
+		XRaw: point[1 : 1+size],
+		YRaw: point[1+size:],
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	keyHandle, session, password, closer, err := d.load()
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+
+	z, err := ecdhZGen(d.rw, session, keyHandle, password, inPoint)
+	if err != nil {
+		return nil, fmt.Errorf("error computing shared secret: %w", err)
+	}
+
+	// Leading zeros may have been removed.
+	if len(z.XRaw) > size {
+		return nil, errors.New("error computing shared secret: invalid point")
+	}
+	return append(make([]byte, size-len(z.XRaw)), z.XRaw...), nil
+}
+
+// load loads the key and starts the policy session. It returns the handles
+// of the key and session, the password used with them, and a function to
+// flush them.
+func (d *Decrypter) load() (tpmutil.Handle, tpmutil.Handle, string, func(), error) {
+	key, keyHandle, err := loadKey(d.rw, d.tpmKey, d.srkTemplate)
+	if err != nil {
+		return 0, 0, "", nil, err
+	}
+	d.tpmKey = key
+
+	session, closer, err := policySession(d.rw, d.tpmKey)
+	if err != nil {
+		_ = tpm2.FlushContext(d.rw, keyHandle)
+		return 0, 0, "", nil, err
+	}
+
+	var password string
+	if !d.tpmKey.EmptyAuth {
+		password = d.password
+	}
+
+	return keyHandle, session, password, func() {
+		closer()
+		_ = tpm2.FlushContext(d.rw, keyHandle)
+	}, nil
+}
+
+// ecdhZGen runs TPM2_ECDH_ZGen. It's like [tpm2.ECDHZGen], but it allows to
+// use a policy session to authorize the key.
+func ecdhZGen(rw io.ReadWriter, session, key tpmutil.Handle, password string, inPoint tpm2.ECPoint) (*tpm2.ECPoint, error) {
+	auth, err := tpmutil.Pack(tpm2.AuthCommand{Session: session, Attributes: tpm2.AttrContinueSession, Auth: []byte(password)})
+	if err != nil {
+		return nil, err
+	}
+	point, err := tpmutil.Pack(inPoint)
+	if err != nil {
+		return nil, err
+	}
+	cmd, err := tpmutil.Pack(key, uint32(len(auth)), tpmutil.RawBytes(auth), tpmutil.U16Bytes(point))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, code, err := tpmutil.RunCommand(rw, tpm2.TagSessions, tpm2.CmdECDHZGen, tpmutil.RawBytes(cmd))
+	if err != nil {
+		return nil, err
+	}
+	if code != tpmutil.RCSuccess {
+		return nil, fmt.Errorf("TPM2_ECDH_ZGen failed with response code 0x%x", uint32(code))
+	}
+
+	var paramSize uint32
+	var z2B tpmutil.U16Bytes
+	if _, err := tpmutil.Unpack(resp, &paramSize, &z2B); err != nil {
+		return nil, err
+	}
+	var z tpm2.ECPoint
+	if _, err := tpmutil.Unpack(z2B, &z.XRaw, &z.YRaw); err != nil {
+		return nil, err
+	}
+	return &z, nil
+}
+
+func ecdhCurve(curve elliptic.Curve) (ecdh.Curve, error) {
+	switch curve {
+	case elliptic.P256():
+		return ecdh.P256(), nil
+	case elliptic.P384():
+		return ecdh.P384(), nil
+	case elliptic.P521():
+		return ecdh.P521(), nil
+	default:
+		return nil, fmt.Errorf("unsupported curve %s", curve.Params().Name)
+	}
+}
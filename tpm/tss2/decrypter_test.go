@@ -0,0 +1,249 @@
+package tss2
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var defaultDecryptKeyParamsEC = tpm2.Public{
+	Type:       tpm2.AlgECC,
+	NameAlg:    tpm2.AlgSHA256,
+	Attributes: tpm2.FlagFixedTPM | tpm2.FlagFixedParent | tpm2.FlagSensitiveDataOrigin | tpm2.FlagUserWithAuth | tpm2.FlagDecrypt,
+	ECCParameters: &tpm2.ECCParams{
+		CurveID: tpm2.CurveNISTP256,
+	},
+}
+
+var defaultDecryptKeyParamsRSA = tpm2.Public{
+	Type:       tpm2.AlgRSA,
+	NameAlg:    tpm2.AlgSHA256,
+	Attributes: tpm2.FlagFixedTPM | tpm2.FlagFixedParent | tpm2.FlagSensitiveDataOrigin | tpm2.FlagUserWithAuth | tpm2.FlagDecrypt,
+	RSAParameters: &tpm2.RSAParams{
+		KeyBits: 2048,
+	},
+}
+
+func TestDecrypter_Decrypt(t *testing.T) {
+	rw := openTPM(t)
+	t.Cleanup(func() {
+		assert.NoError(t, rw.Close())
+	})
+
+	keyHnd, _, err := tpm2.CreatePrimary(rw, tpm2.HandleOwner, tpm2.PCRSelection{}, "", "", RSASRKTemplate)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, tpm2.FlushContext(rw, keyHnd))
+	})
+
+	priv, pub, _, _, _, err := tpm2.CreateKey(rw, keyHnd, tpm2.PCRSelection{}, "", "", defaultDecryptKeyParamsRSA)
+	require.NoError(t, err)
+
+	decrypter, err := CreateDecrypter(rw, New(pub, priv))
+	require.NoError(t, err)
+	pk, ok := decrypter.Public().(*rsa.PublicKey)
+	require.True(t, ok)
+
+	msg := []byte("reinduct-unshamefaced-sulphurous-oversolemn")
+	encrypt := func(opts crypto.DecrypterOpts) []byte {
+		if o, ok := opts.(*rsa.OAEPOptions); ok {
+			b, err := rsa.EncryptOAEP(o.Hash.New(), rand.Reader, pk, msg, o.Label)
+			require.NoError(t, err)
+			return b
+		}
+		b, err := rsa.EncryptPKCS1v15(rand.Reader, pk, msg)
+		require.NoError(t, err)
+		return b
+	}
+
+	tests := []struct {
+		name      string
+		opts      crypto.DecrypterOpts
+		assertion assert.ErrorAssertionFunc
+	}{
+		{"ok OAEP SHA-256", &rsa.OAEPOptions{Hash: crypto.SHA256}, assert.NoError},
+		{"ok OAEP SHA-1", &rsa.OAEPOptions{Hash: crypto.SHA1}, assert.NoError},
+		{"ok OAEP label", &rsa.OAEPOptions{Hash: crypto.SHA256, Label: []byte("label\x00")}, assert.NoError},
+		{"ok PKCS1v15", &rsa.PKCS1v15DecryptOptions{}, assert.NoError},
+		{"ok nil", nil, assert.NoError},
+		{"fail OAEP label", &rsa.OAEPOptions{Hash: crypto.SHA256, Label: []byte("label")}, assert.Error},
+		{"fail OAEP MGFHash", &rsa.OAEPOptions{Hash: crypto.SHA256, MGFHash: crypto.SHA1}, assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decrypter.Decrypt(rand.Reader, encrypt(tt.opts), tt.opts)
+			tt.assertion(t, err)
+			if err == nil {
+				assert.Equal(t, msg, got)
+			}
+		})
+	}
+
+	t.Run("fail ECDH", func(t *testing.T) {
+		remote, err := ecdh.P256().GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		_, err = decrypter.ECDH(remote.PublicKey())
+		assert.Error(t, err)
+	})
+}
+
+func TestDecrypter_ECDH(t *testing.T) {
+	rw := openTPM(t)
+	t.Cleanup(func() {
+		assert.NoError(t, rw.Close())
+	})
+
+	keyHnd, _, err := tpm2.CreatePrimary(rw, tpm2.HandleOwner, tpm2.PCRSelection{}, "", "", RSASRKTemplate)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, tpm2.FlushContext(rw, keyHnd))
+	})
+
+	pcrPolicy, err := PolicyPCRFromTPM(rw, tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: []int{0, 7}})
+	require.NoError(t, err)
+	policies := []TPMPolicy{pcrPolicy, PolicyAuthValue()}
+	digest, err := PolicyDigest(policies)
+	require.NoError(t, err)
+
+	policyParams := defaultDecryptKeyParamsEC
+	policyParams.Attributes &^= tpm2.FlagUserWithAuth
+	policyParams.AuthPolicy = digest
+
+	p384Params := defaultDecryptKeyParamsEC
+	p384Params.ECCParameters = &tpm2.ECCParams{CurveID: tpm2.CurveNISTP384}
+
+	tests := []struct {
+		name     string
+		params   tpm2.Public
+		password string
+		opts     []TPMOption
+		curve    ecdh.Curve
+	}{
+		{"ok P-256", defaultDecryptKeyParamsEC, "", nil, ecdh.P256()},
+		{"ok P-384", p384Params, "", nil, ecdh.P384()},
+		{"ok password", defaultDecryptKeyParamsEC, "password", []TPMOption{WithEmptyAuth(false)}, ecdh.P256()},
+		{"ok policy", policyParams, "password", []TPMOption{WithEmptyAuth(false), WithPolicy(policies...)}, ecdh.P256()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			priv, pub, _, _, _, err := tpm2.CreateKey(rw, keyHnd, tpm2.PCRSelection{}, "", tt.password, tt.params)
+			require.NoError(t, err)
+
+			decrypter, err := CreateDecrypter(rw, New(pub, priv, tt.opts...))
+			require.NoError(t, err)
+			decrypter.SetPassword(tt.password)
+
+			pk, ok := decrypter.Public().(*ecdsa.PublicKey)
+			require.True(t, ok)
+			ecdhPublic, err := pk.ECDH()
+			require.NoError(t, err)
+
+			// Compare with multiple remote keys, some of them will have
+			// shared secrets with leading zeros.
+			for i := 0; i < 8; i++ {
+				remote, err := tt.curve.GenerateKey(rand.Reader)
+				require.NoError(t, err)
+				want, err := remote.ECDH(ecdhPublic)
+				require.NoError(t, err)
+
+				got, err := decrypter.ECDH(remote.PublicKey())
+				require.NoError(t, err)
+				assert.Equal(t, want, got)
+			}
+
+			if tt.password != "" {
+				remote, err := tt.curve.GenerateKey(rand.Reader)
+				require.NoError(t, err)
+				decrypter.SetPassword("wrong-password")
+				_, err = decrypter.ECDH(remote.PublicKey())
+				assert.Error(t, err)
+			}
+		})
+	}
+
+	t.Run("fail curve", func(t *testing.T) {
+		priv, pub, _, _, _, err := tpm2.CreateKey(rw, keyHnd, tpm2.PCRSelection{}, "", "", defaultDecryptKeyParamsEC)
+		require.NoError(t, err)
+		decrypter, err := CreateDecrypter(rw, New(pub, priv))
+		require.NoError(t, err)
+
+		remote, err := ecdh.P384().GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		_, err = decrypter.ECDH(remote.PublicKey())
+		assert.Error(t, err)
+		_, err = decrypter.ECDH(nil)
+		assert.Error(t, err)
+		_, err = decrypter.Decrypt(rand.Reader, []byte("ciphertext"), nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestCreateDecrypter(t *testing.T) {
+	var rw bytes.Buffer
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	parent, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	// Importable keys are signing keys.
+	signingKey, err := CreateImportable(parent.Public(), ecKey, "")
+	require.NoError(t, err)
+
+	decryptPublic := func(params tpm2.Public) []byte {
+		params.ECCParameters = &tpm2.ECCParams{
+			CurveID: tpm2.CurveNISTP256,
+			Point: tpm2.ECPoint{
+				XRaw: ecKey.X.FillBytes(make([]byte, 32)),
+				YRaw: ecKey.Y.FillBytes(make([]byte, 32)),
+			},
+		}
+		b, err := params.Encode()
+		require.NoError(t, err)
+		return b
+	}
+	decryptKey := New(decryptPublic(defaultDecryptKeyParamsEC), []byte{1, 2, 3, 4})
+	restrictedParams := defaultDecryptKeyParamsEC
+	restrictedParams.Attributes |= tpm2.FlagRestricted
+	restrictedKey := New(decryptPublic(restrictedParams), []byte{1, 2, 3, 4})
+
+	tests := []struct {
+		name      string
+		rw        *bytes.Buffer
+		key       *TPMKey
+		want      crypto.PublicKey
+		assertion assert.ErrorAssertionFunc
+	}{
+		{"ok", &rw, decryptKey, ecKey.Public(), assert.NoError},
+		{"fail rw", nil, decryptKey, nil, assert.Error},
+		{"fail key", &rw, nil, nil, assert.Error},
+		{"fail signing key", &rw, signingKey, nil, assert.Error},
+		{"fail restricted key", &rw, restrictedKey, nil, assert.Error},
+		{"fail parent", &rw, New(decryptKey.PublicKey[2:], []byte{1, 2, 3, 4}, WithParent(0)), nil, assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *Decrypter
+			var err error
+			if tt.rw == nil {
+				got, err = CreateDecrypter(nil, tt.key)
+			} else {
+				got, err = CreateDecrypter(tt.rw, tt.key)
+			}
+			tt.assertion(t, err)
+			if err != nil {
+				assert.Nil(t, got)
+				return
+			}
+			assert.Equal(t, tt.want, got.Public())
+		})
+	}
+}
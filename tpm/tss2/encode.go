@@ -19,6 +19,31 @@ func WithParent(parent tpmutil.Handle) TPMOption {
 	}
 }
 
+// WithEmptyAuth sets whether the [TPMKey] requires an authorization value or
+// not. By default keys do not require it.
+func WithEmptyAuth(emptyAuth bool) TPMOption {
+	return func(t *TPMKey) {
+		t.EmptyAuth = emptyAuth
+	}
+}
+
+// WithPolicy appends the given policies to the [TPMKey] policy. The policies
+// must be executed in order before using the key.
+func WithPolicy(policies ...TPMPolicy) TPMOption {
+	return func(t *TPMKey) {
+		t.Policy = append(t.Policy, policies...)
+	}
+}
+
+// WithAuthPolicy appends the given signed policies to the [TPMKey] auth
+// policy. Signed policies are created with [SignPolicy], and they are used
+// to satisfy a [PolicyAuthorize] policy.
+func WithAuthPolicy(policies ...TPMAuthPolicy) TPMOption {
+	return func(t *TPMKey) {
+		t.AuthPolicy = append(t.AuthPolicy, policies...)
+	}
+}
+
 // New creates a new [TPMKey] with the given public and private keys.
 func New(pub, priv []byte, opts ...TPMOption) *TPMKey {
 	key := &TPMKey{
@@ -34,6 +59,19 @@ func New(pub, priv []byte, opts ...TPMOption) *TPMKey {
 	return key
 }
 
+// NewSealed creates a new [TPMKey] with the given public and private parts of a
+// sealed data object.
+func NewSealed(pub, priv []byte, opts ...TPMOption) *TPMKey {
+	key := New(pub, priv, opts...)
+	key.Type = oidSealedKey
+	return key
+}
+
+// IsSealed returns true if the [TPMKey] contains a sealed data object.
+func (k *TPMKey) IsSealed() bool {
+	return k.Type.Equal(oidSealedKey)
+}
+
 // Encode encodes the [TPMKey] returns a [*pem.Block].
 func (k *TPMKey) Encode() (*pem.Block, error) {
 	b, err := MarshalPrivateKey(k)
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNew(t *testing.T) {
@@ -48,6 +49,27 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewSealed(t *testing.T) {
+	policy := TPMPolicy{CommandCode: 0x17F, CommandPolicy: []byte("pcr-policy")}
+	key := NewSealed([]byte("public"), []byte("private"), WithEmptyAuth(false), WithPolicy(policy), WithParent(0x81000001))
+	assert.Equal(t, &TPMKey{
+		Type:       oidSealedKey,
+		EmptyAuth:  false,
+		Policy:     []TPMPolicy{policy},
+		Parent:     0x81000001,
+		PublicKey:  append([]byte{0, 6}, []byte("public")...),
+		PrivateKey: append([]byte{0, 7}, []byte("private")...),
+	}, key)
+	assert.True(t, key.IsSealed())
+	assert.False(t, New([]byte("public"), []byte("private")).IsSealed())
+
+	der, err := MarshalPrivateKey(key)
+	require.NoError(t, err)
+	got, err := ParsePrivateKey(der)
+	require.NoError(t, err)
+	assert.Equal(t, key, got)
+}
+
 func TestTPMKey_Encode(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -0,0 +1,408 @@
+package tss2
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+)
+
+// CreateImportable wraps the private key `key` to the storage key `parent`,
+// and returns an importable [TPMKey]. The key can only be imported by the
+// TPM that holds the private part of the parent, and once imported it can
+// be used like a key created in that TPM. It doesn't require access to the
+// TPM, so it can be used to provision an existing key to a TPM.
+//
+// The parent is the public key of the Storage Root Key (SRK) of the TPM,
+// or the public key of its Endorsement Key (EK), and it must use SHA-256
+// as its name algorithm and AES-128-CFB as its symmetric algorithm, like
+// the TCG reference templates. By default the parent is the SRK created
+// using [RSASRKTemplate] in the owner hierarchy; [WithParent] can be used
+// to select a persistent handle, like an EK persisted at 0x81010001.
+//
+// The password is the authorization value of the key, and policies can be
+// set using [WithPolicy]. Only RSA and ECDSA keys are supported.
+//
+// # Experimental
+//
+// Notice: This API is EXPERIMENTAL and may be changed or removed in a later
+// release.
+func CreateImportable(parent crypto.PublicKey, key crypto.PrivateKey, password string, opts ...TPMOption) (*TPMKey, error) {
+	parentPublic, err := storagePublic(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	tpmKey := &TPMKey{
+		Type:      oidImportableKey,
+		EmptyAuth: password == "",
+		Parent:    int(handleOwner),
+	}
+	for _, fn := range opts {
+		fn(tpmKey)
+	}
+	if !validateParent(tpmKey.Parent) {
+		return nil, fmt.Errorf("invalid parent '%d'", tpmKey.Parent)
+	}
+
+	public, private, err := importablePublicPrivate(key, password)
+	if err != nil {
+		return nil, err
+	}
+	if len(tpmKey.Policy) == 0 {
+		public.Attributes |= tpm2.FlagUserWithAuth
+	} else {
+		if public.AuthPolicy, err = PolicyDigest(tpmKey.Policy); err != nil {
+			return nil, err
+		}
+	}
+
+	seed, secret, err := createSeed(parentPublic)
+	if err != nil {
+		return nil, err
+	}
+	duplicate, err := createDuplicate(parentPublic, public, private, seed)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := public.Encode()
+	if err != nil {
+		return nil, fmt.Errorf("error encoding public key: %w", err)
+	}
+
+	tpmKey.PublicKey = addPrefixLength(pub)
+	tpmKey.PrivateKey = addPrefixLength(duplicate)
+	tpmKey.Secret = addPrefixLength(secret)
+	return tpmKey, nil
+}
+
+// IsImportable returns true if the [TPMKey] contains a key that must be
+// imported before it can be loaded.
+func (k *TPMKey) IsImportable() bool {
+	return k.Type.Equal(oidImportableKey)
+}
+
+// Import imports an importable [TPMKey] into the TPM, and returns a
+// loadable [TPMKey] with the same parent, policies and authorization
+// value. Keys imported to the owner hierarchy are imported to the SRK
+// created using [RSASRKTemplate]. The caller is responsible for opening
+// and closing the TPM.
+//
+// # Experimental
+//
+// Notice: This API is EXPERIMENTAL and may be changed or removed in a later
+// release.
+func Import(rw io.ReadWriter, key *TPMKey) (*TPMKey, error) {
+	switch {
+	case rw == nil:
+		return nil, errors.New("invalid TPM channel: rw cannot be nil")
+	case key == nil:
+		return nil, errors.New("invalid TPM key: key cannot be nil")
+	}
+	return importKey(rw, key, RSASRKTemplate)
+}
+
+func importKey(rw io.ReadWriter, key *TPMKey, srkTemplate tpm2.Public) (*TPMKey, error) {
+	switch {
+	case !key.IsImportable():
+		return nil, fmt.Errorf("invalid TSS2 key: type %q is not valid", key.Type.String())
+	case !validateParent(key.Parent):
+		return nil, fmt.Errorf("invalid TSS2 key: parent '%d' is not valid", key.Parent)
+	case !validateKey(key.Secret):
+		return nil, errors.New("invalid TSS2 key: secret is invalid")
+	case !validateKey(key.PublicKey):
+		return nil, errors.New("invalid TSS2 key: public key is invalid")
+	case !validateKey(key.PrivateKey):
+		return nil, errors.New("invalid TSS2 key: private key key is invalid")
+	}
+
+	parentHandle, auth, closer, err := loadParent(rw, key.Parent, srkTemplate)
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+
+	private, err := tpm2.Import(rw, parentHandle, auth, key.PublicKey[2:], key.PrivateKey[2:], key.Secret[2:], nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error importing key: %w", err)
+	}
+
+	return &TPMKey{
+		Type:       oidLoadableKey,
+		EmptyAuth:  key.EmptyAuth,
+		Policy:     key.Policy,
+		AuthPolicy: key.AuthPolicy,
+		Parent:     key.Parent,
+		PublicKey:  key.PublicKey,
+		PrivateKey: addPrefixLength(private),
+	}, nil
+}
+
+// loadParent returns the handle of the parent of a key, and the
+// authorization used to load or import keys under it. If the parent is
+// not persistent, a primary key is created using the given template.
+// Persistent parents that don't allow authorization with the password,
+// like an EK, are authorized with a TPM2_PolicySecret session for the
+// endorsement hierarchy. The returned function flushes the transient
+// objects and sessions.
+func loadParent(rw io.ReadWriter, parent int, template tpm2.Public) (tpmutil.Handle, tpm2.AuthCommand, func(), error) {
+	auth := tpm2.AuthCommand{Session: tpm2.HandlePasswordSession, Attributes: tpm2.AttrContinueSession}
+
+	handle := tpmutil.Handle(parent)
+	if !handleIsPersistent(parent) {
+		primary, _, err := tpm2.CreatePrimary(rw, handle, tpm2.PCRSelection{}, "", "", template)
+		if err != nil {
+			return 0, auth, nil, fmt.Errorf("error creating primary: %w", err)
+		}
+		return primary, auth, func() {
+			_ = tpm2.FlushContext(rw, primary)
+		}, nil
+	}
+
+	public, _, _, err := tpm2.ReadPublic(rw, handle)
+	if err != nil {
+		return 0, auth, nil, fmt.Errorf("error reading parent: %w", err)
+	}
+	if public.Attributes&tpm2.FlagUserWithAuth != 0 {
+		return handle, auth, func() {}, nil
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return 0, auth, nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+	session, _, err := tpm2.StartAuthSession(rw, tpm2.HandleNull, tpm2.HandleNull, nonce, nil, tpm2.SessionPolicy, tpm2.AlgNull, tpm2.AlgSHA256)
+	if err != nil {
+		return 0, auth, nil, fmt.Errorf("error starting policy session: %w", err)
+	}
+	closer := func() {
+		_ = tpm2.FlushContext(rw, session)
+	}
+	if _, _, err := tpm2.PolicySecret(rw, tpm2.HandleEndorsement, tpm2.AuthCommand{Session: tpm2.HandlePasswordSession, Attributes: tpm2.AttrContinueSession}, session, nil, nil, nil, 0); err != nil {
+		closer()
+		return 0, auth, nil, fmt.Errorf("error executing secret policy: %w", err)
+	}
+
+	return handle, tpm2.AuthCommand{Session: session, Attributes: tpm2.AttrContinueSession}, closer, nil
+}
+
+// storagePublic returns the public area of a storage key with the given
+// public key, using the parameters of the TCG reference templates.
+func storagePublic(key crypto.PublicKey) (tpm2.Public, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		public := RSASRKTemplate
+		public.RSAParameters = &tpm2.RSAParams{
+			Symmetric:   RSASRKTemplate.RSAParameters.Symmetric,
+			KeyBits:     uint16(k.N.BitLen()),
+			ExponentRaw: uint32(k.E),
+			ModulusRaw:  k.N.Bytes(),
+		}
+		return public, nil
+	case *ecdsa.PublicKey:
+		curveID, err := curveID(k.Curve)
+		if err != nil {
+			return tpm2.Public{}, err
+		}
+		public := ECCSRKTemplate
+		public.ECCParameters = &tpm2.ECCParams{
+			Symmetric: ECCSRKTemplate.ECCParameters.Symmetric,
+			Sign:      ECCSRKTemplate.ECCParameters.Sign,
+			CurveID:   curveID,
+			Point: tpm2.ECPoint{
+				XRaw: k.X.FillBytes(make([]byte, (k.Curve.Params().BitSize+7)/8)),
+				YRaw: k.Y.FillBytes(make([]byte, (k.Curve.Params().BitSize+7)/8)),
+			},
+		}
+		return public, nil
+	default:
+		return tpm2.Public{}, fmt.Errorf("unsupported parent key type %T", key)
+	}
+}
+
+// importablePublicPrivate returns the public and sensitive areas of a
+// signing key. The key must not have the fixedTPM, fixedParent and
+// sensitiveDataOrigin attributes, as it's created outside the TPM.
+func importablePublicPrivate(key crypto.PrivateKey, password string) (tpm2.Public, tpm2.Private, error) {
+	var public tpm2.Public
+	var private tpm2.Private
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		public = tpm2.Public{
+			Type:    tpm2.AlgRSA,
+			NameAlg: tpm2.AlgSHA256,
+			RSAParameters: &tpm2.RSAParams{
+				Sign:        &tpm2.SigScheme{Alg: tpm2.AlgNull},
+				KeyBits:     uint16(k.N.BitLen()),
+				ExponentRaw: uint32(k.E),
+				ModulusRaw:  k.N.Bytes(),
+			},
+		}
+		private = tpm2.Private{
+			Type:      tpm2.AlgRSA,
+			Sensitive: k.Primes[0].Bytes(),
+		}
+	case *ecdsa.PrivateKey:
+		curveID, err := curveID(k.Curve)
+		if err != nil {
+			return tpm2.Public{}, tpm2.Private{}, err
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		public = tpm2.Public{
+			Type:    tpm2.AlgECC,
+			NameAlg: tpm2.AlgSHA256,
+			ECCParameters: &tpm2.ECCParams{
+				Sign:    &tpm2.SigScheme{Alg: tpm2.AlgNull},
+				CurveID: curveID,
+				Point: tpm2.ECPoint{
+					XRaw: k.X.FillBytes(make([]byte, size)),
+					YRaw: k.Y.FillBytes(make([]byte, size)),
+				},
+			},
+		}
+		private = tpm2.Private{
+			Type:      tpm2.AlgECC,
+			Sensitive: k.D.FillBytes(make([]byte, size)),
+		}
+	default:
+		return tpm2.Public{}, tpm2.Private{}, fmt.Errorf("unsupported key type %T", key)
+	}
+
+	public.Attributes = tpm2.FlagSign
+	if password == "" {
+		public.Attributes |= tpm2.FlagNoDA
+	}
+	private.AuthValue = []byte(password)
+	return public, private, nil
+}
+
+// createSeed creates the seed used to protect the duplicated key, and
+// returns it with the seed encrypted to the parent, as defined in the TPM
+// 2.0 specification, part 1, sections "Protected Storage" and "Secret
+// Sharing".
+func createSeed(parent tpm2.Public) (seed, secret []byte, err error) {
+	switch parent.Type {
+	case tpm2.AlgRSA:
+		seed = make([]byte, parent.RSAParameters.Symmetric.KeyBits/8)
+		if _, err := io.ReadFull(rand.Reader, seed); err != nil {
+			return nil, nil, fmt.Errorf("error generating seed: %w", err)
+		}
+		key, err := parent.Key()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error decoding parent: %w", err)
+		}
+		secret, err = rsa.EncryptOAEP(crypto.SHA256.New(), rand.Reader, key.(*rsa.PublicKey), seed, []byte("DUPLICATE\x00"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error encrypting seed: %w", err)
+		}
+		return seed, secret, nil
+	case tpm2.AlgECC:
+		key, err := parent.Key()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error decoding parent: %w", err)
+		}
+		parentKey, err := key.(*ecdsa.PublicKey).ECDH()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error decoding parent: %w", err)
+		}
+		ephemeral, err := parentKey.Curve().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error generating ephemeral key: %w", err)
+		}
+		z, err := ephemeral.ECDH(parentKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error computing shared secret: %w", err)
+		}
+
+		// Uncompressed points are encoded as 0x04 || X || Y.
+		size := len(z)
+		point := ephemeral.PublicKey().Bytes()
+		x, y := point[1:1+size], point[1+size:]
+		if seed, err = tpm2.KDFe(parent.NameAlg, z, "DUPLICATE", x, parent.ECCParameters.Point.XRaw, crypto.SHA256.Size()*8); err != nil {
+			return nil, nil, fmt.Errorf("error deriving seed: %w", err)
+		}
+		if secret, err = tpmutil.Pack(tpmutil.U16Bytes(x), tpmutil.U16Bytes(y)); err != nil {
+			return nil, nil, fmt.Errorf("error encoding ephemeral key: %w", err)
+		}
+		return seed, secret, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported parent type %v", parent.Type)
+	}
+}
+
+// createDuplicate encrypts the sensitive area of a key with the outer
+// wrapper derived from the seed, and returns the duplicate blob.
+func createDuplicate(parent, public tpm2.Public, private tpm2.Private, seed []byte) ([]byte, error) {
+	name, err := public.Name()
+	if err != nil {
+		return nil, fmt.Errorf("error computing key name: %w", err)
+	}
+	encodedName, err := name.Digest.Encode()
+	if err != nil {
+		return nil, fmt.Errorf("error encoding key name: %w", err)
+	}
+	sensitive, err := private.Encode()
+	if err != nil {
+		return nil, fmt.Errorf("error encoding private key: %w", err)
+	}
+	sensitive, err = tpmutil.Pack(tpmutil.U16Bytes(sensitive))
+	if err != nil {
+		return nil, fmt.Errorf("error encoding private key: %w", err)
+	}
+
+	var symBits int
+	switch parent.Type {
+	case tpm2.AlgRSA:
+		symBits = int(parent.RSAParameters.Symmetric.KeyBits)
+	case tpm2.AlgECC:
+		symBits = int(parent.ECCParameters.Symmetric.KeyBits)
+	}
+	symKey, err := tpm2.KDFa(parent.NameAlg, seed, "STORAGE", encodedName, nil, symBits)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving symmetric key: %w", err)
+	}
+	block, err := aes.NewCipher(symKey)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+	encrypted := make([]byte, len(sensitive))
+	// The TPM 2.0 specification requires an all-zero IV.
+	cipher.NewCFBEncrypter(block, make([]byte, block.BlockSize())).XORKeyStream(encrypted, sensitive)
+
+	hmacKey, err := tpm2.KDFa(parent.NameAlg, seed, "INTEGRITY", nil, nil, crypto.SHA256.Size()*8)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving integrity key: %w", err)
+	}
+	mac := hmac.New(crypto.SHA256.New, hmacKey)
+	mac.Write(encrypted)
+	mac.Write(encodedName)
+
+	return tpmutil.Pack(tpm2.IDObject{
+		IntegrityHMAC: mac.Sum(nil),
+		EncIdentity:   encrypted,
+	})
+}
+
+func curveID(curve elliptic.Curve) (tpm2.EllipticCurve, error) {
+	switch curve {
+	case elliptic.P256():
+		return tpm2.CurveNISTP256, nil
+	case elliptic.P384():
+		return tpm2.CurveNISTP384, nil
+	case elliptic.P521():
+		return tpm2.CurveNISTP521, nil
+	default:
+		return 0, fmt.Errorf("unsupported curve %s", curve.Params().Name)
+	}
+}
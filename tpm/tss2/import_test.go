@@ -0,0 +1,254 @@
+package tss2
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"testing"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rsaEKTemplate is the TCG default RSA-2048 EK template.
+var rsaEKTemplate = tpm2.Public{
+	Type:    tpm2.AlgRSA,
+	NameAlg: tpm2.AlgSHA256,
+	Attributes: tpm2.FlagFixedTPM | tpm2.FlagFixedParent | tpm2.FlagSensitiveDataOrigin |
+		tpm2.FlagAdminWithPolicy | tpm2.FlagRestricted | tpm2.FlagDecrypt,
+	AuthPolicy: mustDecodeHex("837197674484b3f81a90cc8d46a5d724fd52d76e06520b64f2a1da1b331469aa"),
+	RSAParameters: &tpm2.RSAParams{
+		Symmetric: &tpm2.SymScheme{
+			Alg:     tpm2.AlgAES,
+			KeyBits: 128,
+			Mode:    tpm2.AlgCFB,
+		},
+		KeyBits:    2048,
+		ModulusRaw: make([]byte, 256),
+	},
+}
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestCreateImportable(t *testing.T) {
+	rsaParent, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecParent, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	p224Key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	require.NoError(t, err)
+
+	type args struct {
+		parent   crypto.PublicKey
+		key      crypto.PrivateKey
+		password string
+		opts     []TPMOption
+	}
+	tests := []struct {
+		name          string
+		args          args
+		wantPublic    crypto.PublicKey
+		wantEmptyAuth bool
+		wantParent    int
+		assertion     assert.ErrorAssertionFunc
+	}{
+		{"ok RSA parent", args{rsaParent.Public(), ecKey, "", nil}, ecKey.Public(), true, 0x40000001, assert.NoError},
+		{"ok EC parent", args{ecParent.Public(), rsaKey, "", nil}, rsaKey.Public(), true, 0x40000001, assert.NoError},
+		{"ok password", args{rsaParent.Public(), rsaKey, "password", nil}, rsaKey.Public(), false, 0x40000001, assert.NoError},
+		{"ok parent", args{rsaParent.Public(), ecKey, "", []TPMOption{WithParent(0x81010001)}}, ecKey.Public(), true, 0x81010001, assert.NoError},
+		{"ok policy", args{ecParent.Public(), ecKey, "password", []TPMOption{WithPolicy(PolicyAuthValue())}}, ecKey.Public(), false, 0x40000001, assert.NoError},
+		{"fail parent type", args{edKey.Public(), ecKey, "", nil}, nil, false, 0, assert.Error},
+		{"fail parent curve", args{p224Key.Public(), ecKey, "", nil}, nil, false, 0, assert.Error},
+		{"fail parent handle", args{rsaParent.Public(), ecKey, "", []TPMOption{WithParent(0)}}, nil, false, 0, assert.Error},
+		{"fail key type", args{rsaParent.Public(), edKey, "", nil}, nil, false, 0, assert.Error},
+		{"fail key curve", args{rsaParent.Public(), p224Key, "", nil}, nil, false, 0, assert.Error},
+		{"fail policy", args{rsaParent.Public(), ecKey, "", []TPMOption{WithPolicy(TPMPolicy{CommandCode: 1})}}, nil, false, 0, assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CreateImportable(tt.args.parent, tt.args.key, tt.args.password, tt.args.opts...)
+			tt.assertion(t, err)
+			if err != nil {
+				assert.Nil(t, got)
+				return
+			}
+
+			assert.True(t, got.IsImportable())
+			assert.Equal(t, tt.wantEmptyAuth, got.EmptyAuth)
+			assert.Equal(t, tt.wantParent, got.Parent)
+			assert.True(t, validateKey(got.Secret))
+			assert.True(t, validateKey(got.PublicKey))
+			assert.True(t, validateKey(got.PrivateKey))
+
+			pub, err := got.Public()
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPublic, pub)
+
+			// The key must be encoded and parsed as any other key.
+			b, err := MarshalPrivateKey(got)
+			require.NoError(t, err)
+			parsed, err := ParsePrivateKey(b)
+			require.NoError(t, err)
+			assert.Equal(t, got, parsed)
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	rw := openTPM(t)
+	t.Cleanup(func() {
+		assert.NoError(t, rw.Close())
+	})
+
+	rsaSRK, _, err := tpm2.CreatePrimary(rw, tpm2.HandleOwner, tpm2.PCRSelection{}, "", "", RSASRKTemplate)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, tpm2.FlushContext(rw, rsaSRK))
+	})
+	rsaSRKPublic, _, _, err := tpm2.ReadPublic(rw, rsaSRK)
+	require.NoError(t, err)
+	rsaSRKKey, err := rsaSRKPublic.Key()
+	require.NoError(t, err)
+
+	// Persist an ECC SRK and an EK to import keys with persistent parents.
+	persist := func(hierarchy tpmutil.Handle, template tpm2.Public, handle tpmutil.Handle) crypto.PublicKey {
+		h, pub, err := tpm2.CreatePrimary(rw, hierarchy, tpm2.PCRSelection{}, "", "", template)
+		require.NoError(t, err)
+		defer tpm2.FlushContext(rw, h)
+		require.NoError(t, tpm2.EvictControl(rw, "", tpm2.HandleOwner, h, handle))
+		t.Cleanup(func() {
+			assert.NoError(t, tpm2.EvictControl(rw, "", tpm2.HandleOwner, handle, handle))
+		})
+		return pub
+	}
+	eccSRKKey := persist(tpm2.HandleOwner, ECCSRKTemplate, 0x81000002)
+	ekKey := persist(tpm2.HandleEndorsement, rsaEKTemplate, 0x81010001)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	pcrPolicy, err := PolicyPCRFromTPM(rw, tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: []int{0, 7}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		parent   crypto.PublicKey
+		key      crypto.Signer
+		password string
+		opts     []TPMOption
+	}{
+		{"ok RSA SRK", rsaSRKKey, ecKey, "", nil},
+		{"ok RSA SRK RSA", rsaSRKKey, rsaKey, "", nil},
+		{"ok RSA SRK password", rsaSRKKey, ecKey, "password", nil},
+		{"ok ECC SRK", eccSRKKey, rsaKey, "", []TPMOption{WithParent(0x81000002)}},
+		{"ok EK", ekKey, ecKey, "", []TPMOption{WithParent(0x81010001)}},
+		{"ok EK policy", ekKey, rsaKey, "password", []TPMOption{WithParent(0x81010001), WithPolicy(pcrPolicy, PolicyAuthValue())}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := CreateImportable(tt.parent, tt.key, tt.password, tt.opts...)
+			require.NoError(t, err)
+
+			loadable, err := Import(rw, key)
+			require.NoError(t, err)
+			assert.False(t, loadable.IsImportable())
+			assert.Empty(t, loadable.Secret)
+			assert.Equal(t, key.Parent, loadable.Parent)
+			assert.Equal(t, key.PublicKey, loadable.PublicKey)
+			assert.Equal(t, key.Policy, loadable.Policy)
+
+			sum := crypto.SHA256.New()
+			sum.Write([]byte("bioherm-defoliator-unabsolved-snobbery-tinhorn"))
+			digest := sum.Sum(nil)
+
+			for _, k := range []*TPMKey{key, loadable} {
+				signer, err := CreateSigner(rw, k)
+				require.NoError(t, err)
+				signer.SetPassword(tt.password)
+				assert.Equal(t, tt.key.Public(), signer.Public())
+
+				sig, err := signer.Sign(rand.Reader, digest, crypto.SHA256)
+				require.NoError(t, err)
+				switch pub := tt.key.Public().(type) {
+				case *ecdsa.PublicKey:
+					assert.True(t, ecdsa.VerifyASN1(pub, digest, sig))
+				case *rsa.PublicKey:
+					assert.NoError(t, rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, sig))
+				}
+			}
+		})
+	}
+
+	t.Run("fail wrong TPM", func(t *testing.T) {
+		other, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		key, err := CreateImportable(other.Public(), ecKey, "")
+		require.NoError(t, err)
+		_, err = Import(rw, key)
+		assert.Error(t, err)
+	})
+}
+
+func TestImport_fail(t *testing.T) {
+	var rw bytes.Buffer
+	parent, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	key, err := CreateImportable(parent.Public(), ecKey, "")
+	require.NoError(t, err)
+
+	modKey := func(fn func(k *TPMKey)) *TPMKey {
+		k := *key
+		fn(&k)
+		return &k
+	}
+
+	tests := []struct {
+		name string
+		rw   *bytes.Buffer
+		key  *TPMKey
+	}{
+		{"fail rw", nil, key},
+		{"fail key", &rw, nil},
+		{"fail type", &rw, modKey(func(k *TPMKey) { k.Type = oidLoadableKey })},
+		{"fail parent", &rw, modKey(func(k *TPMKey) { k.Parent = 0 })},
+		{"fail secret", &rw, modKey(func(k *TPMKey) { k.Secret = nil })},
+		{"fail publicKey", &rw, modKey(func(k *TPMKey) { k.PublicKey = k.PublicKey[2:] })},
+		{"fail privateKey", &rw, modKey(func(k *TPMKey) { k.PrivateKey = k.PrivateKey[2:] })},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *TPMKey
+			var err error
+			if tt.rw == nil {
+				got, err = Import(nil, tt.key)
+			} else {
+				got, err = Import(tt.rw, tt.key)
+			}
+			assert.Error(t, err)
+			assert.Nil(t, got)
+		})
+	}
+}
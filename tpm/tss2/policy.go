@@ -0,0 +1,814 @@
+package tss2
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+	tpm2new "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpmutil"
+)
+
+const (
+	// commandPolicyPCR is the command code of TPM2_PolicyPCR.
+	commandPolicyPCR = int(tpm2.CmdPolicyPCR)
+	// commandPolicyAuthValue is the command code of TPM2_PolicyAuthValue.
+	commandPolicyAuthValue = 0x16B
+	// commandPolicyOR is the command code of TPM2_PolicyOR.
+	commandPolicyOR = int(tpm2.CmdPolicyOr)
+	// commandPolicyAuthorize is the command code of TPM2_PolicyAuthorize.
+	commandPolicyAuthorize = 0x16A
+
+	// maxSealedDataSize is the maximum size of the data in a sealed data
+	// object, MAX_SYM_DATA in the TPM 2.0 specification.
+	maxSealedDataSize = 128
+
+	// maxPCRsPerRead is the number of PCRs read with a single
+	// TPM2_PCR_Read command. TPMs may return fewer PCRs than
+	// requested, but 8 PCRs are returned by all of them.
+	maxPCRsPerRead = 8
+
+	// maxPolicyORBranches is the maximum number of digests in
+	// TPM2_PolicyOR.
+	maxPolicyORBranches = 8
+)
+
+// PolicyPCR returns a [TPMPolicy] for the TPM2_PolicyPCR command. The
+// policy is satisfied if the PCRs in the selection have the values
+// that result in the given digest. As defined in the TSS2 key format,
+// the command policy contains the digest as a TPM2B_DIGEST followed by
+// the selection as a TPML_PCR_SELECTION. The order of the PCRs in the
+// selection is not relevant, the TPM always uses them in ascending order.
+func PolicyPCR(pcrDigest []byte, sel tpm2.PCRSelection) (TPMPolicy, error) {
+	sel = sortPCRSelection(sel)
+	b, err := tpmutil.Pack(tpmutil.U16Bytes(pcrDigest))
+	if err != nil {
+		return TPMPolicy{}, fmt.Errorf("error encoding PCR digest: %w", err)
+	}
+	s, err := encodePCRSelection(sel)
+	if err != nil {
+		return TPMPolicy{}, err
+	}
+	return TPMPolicy{
+		CommandCode:   commandPolicyPCR,
+		CommandPolicy: append(b, s...),
+	}, nil
+}
+
+// PolicyPCRFromTPM returns a [TPMPolicy] for the TPM2_PolicyPCR command
+// with the current values of the PCRs in the selection. The caller is
+// responsible for opening and closing the TPM.
+func PolicyPCRFromTPM(rw io.ReadWriter, sel tpm2.PCRSelection) (TPMPolicy, error) {
+	sel = sortPCRSelection(sel)
+	digest, err := readPCRDigest(rw, sel)
+	if err != nil {
+		return TPMPolicy{}, err
+	}
+	return PolicyPCR(digest, sel)
+}
+
+// PolicyAuthValue returns a [TPMPolicy] for the TPM2_PolicyAuthValue
+// command. The policy requires the authorization value of the object
+// to be provided.
+func PolicyAuthValue() TPMPolicy {
+	return TPMPolicy{
+		CommandCode:   commandPolicyAuthValue,
+		CommandPolicy: []byte{},
+	}
+}
+
+// PolicyOR returns a [TPMPolicy] for the TPM2_PolicyOR command. The
+// policy is satisfied if the policies in any of the branches are
+// satisfied. Between 2 and 8 branches are supported. The command
+// policy contains the DER encoding of the branches, a SEQUENCE OF
+// SEQUENCE OF TPMPolicy, so that the policies in a branch can be
+// executed before TPM2_PolicyOR.
+func PolicyOR(branches ...[]TPMPolicy) (TPMPolicy, error) {
+	if len(branches) < 2 || len(branches) > maxPolicyORBranches {
+		return TPMPolicy{}, fmt.Errorf("invalid number of OR branches %d: it must be between 2 and %d", len(branches), maxPolicyORBranches)
+	}
+	for _, b := range branches {
+		if err := validatePolicy(b); err != nil {
+			return TPMPolicy{}, err
+		}
+	}
+	b, err := asn1.Marshal(branches)
+	if err != nil {
+		return TPMPolicy{}, fmt.Errorf("error encoding OR branches: %w", err)
+	}
+	return TPMPolicy{
+		CommandCode:   commandPolicyOR,
+		CommandPolicy: b,
+	}, nil
+}
+
+// PolicyAuthorize returns a [TPMPolicy] for the TPM2_PolicyAuthorize
+// command. The policy is satisfied by any policy signed by the authority
+// key with [SignPolicy]. The signed policies are stored in the AuthPolicy
+// of the [TPMKey], and new ones can be added without changing the key.
+// The command policy contains the public key of the authority as a
+// TPM2B_PUBLIC followed by the policy reference as a TPM2B_NONCE. The
+// policy must be the first one in the key policy.
+func PolicyAuthorize(authority crypto.PublicKey, policyRef []byte) (TPMPolicy, error) {
+	pub, err := authorityPublic(authority)
+	if err != nil {
+		return TPMPolicy{}, err
+	}
+	return TPMPolicy{
+		CommandCode:   commandPolicyAuthorize,
+		CommandPolicy: encodeAuthorize(pub, policyRef, nil),
+	}, nil
+}
+
+// SignPolicy signs the given policies with the authority of a
+// [PolicyAuthorize] policy, and returns a [TPMAuthPolicy] with them that
+// can be added to a [TPMKey] with [WithAuthPolicy]. The name is used to
+// identify the signed policy. RSA and ECDSA authorities are supported.
+func SignPolicy(authority crypto.Signer, name string, policyRef []byte, policies ...TPMPolicy) (TPMAuthPolicy, error) {
+	pub, err := authorityPublic(authority.Public())
+	if err != nil {
+		return TPMAuthPolicy{}, err
+	}
+	approved, err := PolicyDigest(policies)
+	if err != nil {
+		return TPMAuthPolicy{}, err
+	}
+
+	h := sha256.New()
+	h.Write(approved)
+	h.Write(policyRef)
+	aHash := h.Sum(nil)
+
+	b, err := authority.Sign(rand.Reader, aHash, crypto.SHA256)
+	if err != nil {
+		return TPMAuthPolicy{}, fmt.Errorf("error signing policy: %w", err)
+	}
+
+	var sig tpm2new.TPMTSignature
+	switch authority.Public().(type) {
+	case *rsa.PublicKey:
+		sig = tpm2new.TPMTSignature{
+			SigAlg: tpm2new.TPMAlgRSASSA,
+			Signature: tpm2new.NewTPMUSignature(tpm2new.TPMAlgRSASSA, &tpm2new.TPMSSignatureRSA{
+				Hash: tpm2new.TPMAlgSHA256,
+				Sig:  tpm2new.TPM2BPublicKeyRSA{Buffer: b},
+			}),
+		}
+	case *ecdsa.PublicKey:
+		var rs struct {
+			R, S *big.Int
+		}
+		if _, err := asn1.Unmarshal(b, &rs); err != nil {
+			return TPMAuthPolicy{}, fmt.Errorf("error decoding ECDSA signature: %w", err)
+		}
+		sig = tpm2new.TPMTSignature{
+			SigAlg: tpm2new.TPMAlgECDSA,
+			Signature: tpm2new.NewTPMUSignature(tpm2new.TPMAlgECDSA, &tpm2new.TPMSSignatureECC{
+				Hash:       tpm2new.TPMAlgSHA256,
+				SignatureR: tpm2new.TPM2BECCParameter{Buffer: rs.R.Bytes()},
+				SignatureS: tpm2new.TPM2BECCParameter{Buffer: rs.S.Bytes()},
+			}),
+		}
+	}
+
+	return TPMAuthPolicy{
+		Name: name,
+		Policy: append(append([]TPMPolicy{}, policies...), TPMPolicy{
+			CommandCode:   commandPolicyAuthorize,
+			CommandPolicy: encodeAuthorize(pub, policyRef, &sig),
+		}),
+	}, nil
+}
+
+// PolicyDigest computes the policy digest of the given policies. The
+// digest is used as the authorization policy of the objects that require
+// the policies to be satisfied. Policy sessions use SHA-256.
+func PolicyDigest(policies []TPMPolicy) ([]byte, error) {
+	return policyDigest(make([]byte, sha256.Size), policies)
+}
+
+func policyDigest(digest []byte, policies []TPMPolicy) ([]byte, error) {
+	extend := func(reset bool, data ...[]byte) {
+		if reset {
+			digest = make([]byte, sha256.Size)
+		}
+		h := sha256.New()
+		h.Write(digest)
+		for _, d := range data {
+			h.Write(d)
+		}
+		digest = h.Sum(nil)
+	}
+
+	for _, p := range policies {
+		cc := binary.BigEndian.AppendUint32(nil, uint32(p.CommandCode))
+		switch p.CommandCode {
+		case commandPolicyPCR:
+			pcrDigest, sel, err := decodePolicyPCR(p.CommandPolicy)
+			if err != nil {
+				return nil, err
+			}
+			s, err := encodePCRSelection(sel)
+			if err != nil {
+				return nil, err
+			}
+			extend(false, cc, s, pcrDigest)
+		case commandPolicyAuthValue:
+			extend(false, cc)
+		case commandPolicyOR:
+			branches, err := decodePolicyOR(p.CommandPolicy)
+			if err != nil {
+				return nil, err
+			}
+			digests, err := branchDigests(digest, branches)
+			if err != nil {
+				return nil, err
+			}
+			extend(true, append([][]byte{cc}, digests...)...)
+		case commandPolicyAuthorize:
+			pub, policyRef, _, err := decodeAuthorize(p.CommandPolicy)
+			if err != nil {
+				return nil, err
+			}
+			name, err := tpm2new.ObjectName(pub)
+			if err != nil {
+				return nil, fmt.Errorf("error computing authority name: %w", err)
+			}
+			extend(true, cc, name.Buffer)
+			extend(false, policyRef)
+		default:
+			return nil, fmt.Errorf("invalid TSS2 key: policy command code 0x%x is not implemented", p.CommandCode)
+		}
+	}
+
+	return digest, nil
+}
+
+func branchDigests(digest []byte, branches [][]TPMPolicy) ([][]byte, error) {
+	digests := make([][]byte, len(branches))
+	for i, b := range branches {
+		d, err := policyDigest(digest, b)
+		if err != nil {
+			return nil, err
+		}
+		digests[i] = d
+	}
+	return digests, nil
+}
+
+// validatePolicy checks that the policies are supported and well formed.
+func validatePolicy(policies []TPMPolicy) error {
+	_, err := PolicyDigest(policies)
+	return err
+}
+
+// Seal creates a sealed data object with the given data in the TPM, under
+// the storage primary key created with [RSASRKTemplate], and returns it as a
+// [TPMKey]. If a password is given, it's set as the authorization value of
+// the object. If policies are given, the object can only be unsealed after
+// satisfying them; a [PolicyAuthValue] policy is required to also require the
+// password in that case. The caller is responsible for opening and closing
+// the TPM.
+//
+// # Experimental
+//
+// Notice: This API is EXPERIMENTAL and may be changed or removed in a later
+// release.
+func Seal(rw io.ReadWriter, data []byte, password string, policies ...TPMPolicy) (*TPMKey, error) {
+	switch {
+	case rw == nil:
+		return nil, errors.New("invalid TPM channel: rw cannot be nil")
+	case len(data) == 0 || len(data) > maxSealedDataSize:
+		return nil, fmt.Errorf("invalid data size %d: it must be between 1 and %d bytes", len(data), maxSealedDataSize)
+	}
+
+	template := tpm2.Public{
+		Type:       tpm2.AlgKeyedHash,
+		NameAlg:    tpm2.AlgSHA256,
+		Attributes: tpm2.FlagFixedTPM | tpm2.FlagFixedParent,
+		KeyedHashParameters: &tpm2.KeyedHashParams{
+			Alg: tpm2.AlgNull,
+		},
+	}
+	if password == "" {
+		template.Attributes |= tpm2.FlagNoDA
+	}
+	if len(policies) == 0 {
+		template.Attributes |= tpm2.FlagUserWithAuth
+	} else {
+		digest, err := PolicyDigest(policies)
+		if err != nil {
+			return nil, err
+		}
+		template.AuthPolicy = digest
+	}
+
+	parentHandle, _, err := tpm2.CreatePrimary(rw, handleOwner, tpm2.PCRSelection{}, "", "", RSASRKTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("error creating primary: %w", err)
+	}
+	defer tpm2.FlushContext(rw, parentHandle)
+
+	private, public, _, _, _, err := tpm2.CreateKeyWithSensitive(rw, parentHandle, tpm2.PCRSelection{}, "", password, template, data)
+	if err != nil {
+		return nil, fmt.Errorf("error creating sealed data: %w", err)
+	}
+
+	return NewSealed(public, private,
+		WithEmptyAuth(password == ""),
+		WithPolicy(policies...),
+	), nil
+}
+
+// Unseal returns the data of a sealed data [TPMKey], satisfying the
+// policies in the key. The password is the authorization value of the
+// sealed object, it's ignored if the key has an empty auth. The caller
+// is responsible for opening and closing the TPM.
+//
+// # Experimental
+//
+// Notice: This API is EXPERIMENTAL and may be changed or removed in a later
+// release.
+func Unseal(rw io.ReadWriter, key *TPMKey, password string) (data []byte, err error) {
+	switch {
+	case rw == nil:
+		return nil, errors.New("invalid TPM channel: rw cannot be nil")
+	case key == nil:
+		return nil, errors.New("invalid TPM key: key cannot be nil")
+	case !key.IsSealed():
+		return nil, fmt.Errorf("invalid TSS2 key: type %q is not valid", key.Type.String())
+	case len(key.Secret) > 0:
+		return nil, errors.New("invalid TSS2 key: secret should not be set")
+	case !validateParent(key.Parent):
+		return nil, fmt.Errorf("invalid TSS2 key: parent '%d' is not valid", key.Parent)
+	case !validateKey(key.PublicKey):
+		return nil, errors.New("invalid TSS2 key: public key is invalid")
+	case !validateKey(key.PrivateKey):
+		return nil, errors.New("invalid TSS2 key: private key key is invalid")
+	}
+	if err := validatePolicy(key.Policy); err != nil {
+		return nil, err
+	}
+	if key.EmptyAuth {
+		password = ""
+	}
+
+	parentHandle := tpmutil.Handle(key.Parent)
+	if !handleIsPersistent(key.Parent) {
+		parentHandle, _, err = tpm2.CreatePrimary(rw, parentHandle, tpm2.PCRSelection{}, "", "", RSASRKTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("error creating primary: %w", err)
+		}
+		defer tpm2.FlushContext(rw, parentHandle)
+	}
+
+	handle, _, err := tpm2.Load(rw, parentHandle, "", key.PublicKey[2:], key.PrivateKey[2:])
+	if err != nil {
+		return nil, fmt.Errorf("error loading sealed data: %w", err)
+	}
+	defer tpm2.FlushContext(rw, handle)
+
+	session, closer, err := policySession(rw, key)
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+
+	if data, err = tpm2.UnsealWithSession(rw, session, handle, password); err != nil {
+		return nil, fmt.Errorf("error unsealing data: %w", err)
+	}
+	return data, nil
+}
+
+// policySession starts a policy session satisfying the policies of the key,
+// and returns its handle and a function to flush it. If the key doesn't have
+// policies, the password session is returned.
+func policySession(rw io.ReadWriter, key *TPMKey) (tpmutil.Handle, func(), error) {
+	if len(key.Policy) == 0 {
+		return tpm2.HandlePasswordSession, func() {}, nil
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return 0, nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+	session, _, err := tpm2.StartAuthSession(rw, tpm2.HandleNull, tpm2.HandleNull, nonce, nil, tpm2.SessionPolicy, tpm2.AlgNull, tpm2.AlgSHA256)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error starting policy session: %w", err)
+	}
+	closer := func() {
+		_ = tpm2.FlushContext(rw, session)
+	}
+
+	if err := runPolicies(rw, session, key.Policy, key.AuthPolicy); err != nil {
+		closer()
+		return 0, nil, err
+	}
+	return session, closer, nil
+}
+
+// runPolicies executes the policies in the policy session. The branches of
+// TPM2_PolicyOR and the signed policies of TPM2_PolicyAuthorize are selected
+// checking the current PCR values, as a failed policy can't be reverted.
+func runPolicies(rw io.ReadWriter, session tpmutil.Handle, policies []TPMPolicy, authPolicies []TPMAuthPolicy) error {
+	for _, p := range policies {
+		switch p.CommandCode {
+		case commandPolicyPCR:
+			digest, sel, err := decodePolicyPCR(p.CommandPolicy)
+			if err != nil {
+				return err
+			}
+			if err := tpm2.PolicyPCR(rw, session, digest, sel); err != nil {
+				return fmt.Errorf("error executing PCR policy: %w", err)
+			}
+		case commandPolicyAuthValue:
+			// TPM2_PolicyPassword extends the policy digest like
+			// TPM2_PolicyAuthValue, but the authorization value is sent in
+			// clear text instead of being used in an HMAC.
+			if err := tpm2.PolicyPassword(rw, session); err != nil {
+				return fmt.Errorf("error executing auth value policy: %w", err)
+			}
+		case commandPolicyOR:
+			if err := runPolicyOR(rw, session, p, authPolicies); err != nil {
+				return err
+			}
+		case commandPolicyAuthorize:
+			if err := runPolicyAuthorize(rw, session, p, authPolicies); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("invalid TSS2 key: policy command code 0x%x is not implemented", p.CommandCode)
+		}
+	}
+	return nil
+}
+
+func runPolicyOR(rw io.ReadWriter, session tpmutil.Handle, p TPMPolicy, authPolicies []TPMAuthPolicy) error {
+	branches, err := decodePolicyOR(p.CommandPolicy)
+	if err != nil {
+		return err
+	}
+	current, err := tpm2.PolicyGetDigest(rw, session)
+	if err != nil {
+		return fmt.Errorf("error getting policy digest: %w", err)
+	}
+	digests, err := branchDigests(current, branches)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range branches {
+		ok, err := satisfied(rw, b, authPolicies)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := runPolicies(rw, session, b, authPolicies); err != nil {
+			return err
+		}
+		if err := tpm2.PolicyOr(rw, session, tpm2.TPMLDigest{Digests: toTPMDigests(digests)}); err != nil {
+			return fmt.Errorf("error executing OR policy: %w", err)
+		}
+		return nil
+	}
+
+	return errors.New("error executing OR policy: no branch is satisfied")
+}
+
+func runPolicyAuthorize(rw io.ReadWriter, session tpmutil.Handle, p TPMPolicy, authPolicies []TPMAuthPolicy) error {
+	pub, policyRef, _, err := decodeAuthorize(p.CommandPolicy)
+	if err != nil {
+		return err
+	}
+	approved, sig, err := selectSignedPolicy(rw, p.CommandPolicy, authPolicies)
+	if err != nil {
+		return err
+	}
+	if err := runPolicies(rw, session, approved, nil); err != nil {
+		return err
+	}
+	approvedDigest, err := tpm2.PolicyGetDigest(rw, session)
+	if err != nil {
+		return fmt.Errorf("error getting policy digest: %w", err)
+	}
+
+	tpm := transport.FromReadWriter(rw)
+	loaded, err := tpm2new.LoadExternal{
+		InPublic:  tpm2new.New2B(*pub),
+		Hierarchy: tpm2new.TPMRHOwner,
+	}.Execute(tpm)
+	if err != nil {
+		return fmt.Errorf("error loading policy authority: %w", err)
+	}
+	defer tpm2.FlushContext(rw, tpmutil.Handle(loaded.ObjectHandle))
+
+	h := sha256.New()
+	h.Write(approvedDigest)
+	h.Write(policyRef)
+	verified, err := tpm2new.VerifySignature{
+		KeyHandle: loaded.ObjectHandle,
+		Digest:    tpm2new.TPM2BDigest{Buffer: h.Sum(nil)},
+		Signature: *sig,
+	}.Execute(tpm)
+	if err != nil {
+		return fmt.Errorf("error verifying signed policy: %w", err)
+	}
+
+	if _, err := (tpm2new.PolicyAuthorize{
+		PolicySession:  tpm2new.TPMHandle(session),
+		ApprovedPolicy: tpm2new.TPM2BDigest{Buffer: approvedDigest},
+		PolicyRef:      tpm2new.TPM2BDigest{Buffer: policyRef},
+		KeySign:        loaded.Name,
+		CheckTicket:    verified.Validation,
+	}).Execute(tpm); err != nil {
+		return fmt.Errorf("error executing authorize policy: %w", err)
+	}
+
+	return nil
+}
+
+// selectSignedPolicy returns the policies and signature of the first signed
+// policy for the given authority and policy reference that is satisfied.
+func selectSignedPolicy(rw io.ReadWriter, authorize []byte, authPolicies []TPMAuthPolicy) ([]TPMPolicy, *tpm2new.TPMTSignature, error) {
+	for _, ap := range authPolicies {
+		n := len(ap.Policy)
+		if n == 0 || ap.Policy[n-1].CommandCode != commandPolicyAuthorize {
+			continue
+		}
+		last := ap.Policy[n-1].CommandPolicy
+		if len(last) <= len(authorize) || !bytes.Equal(last[:len(authorize)], authorize) {
+			continue
+		}
+		_, _, sig, err := decodeAuthorize(last)
+		if err != nil {
+			return nil, nil, err
+		}
+		ok, err := satisfied(rw, ap.Policy[:n-1], nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			return ap.Policy[:n-1], sig, nil
+		}
+	}
+	return nil, nil, errors.New("error executing authorize policy: no signed policy is satisfied")
+}
+
+// satisfied returns whether the given policies can be satisfied with the
+// current PCR values.
+func satisfied(rw io.ReadWriter, policies []TPMPolicy, authPolicies []TPMAuthPolicy) (bool, error) {
+	for _, p := range policies {
+		switch p.CommandCode {
+		case commandPolicyPCR:
+			digest, sel, err := decodePolicyPCR(p.CommandPolicy)
+			if err != nil {
+				return false, err
+			}
+			current, err := readPCRDigest(rw, sel)
+			if err != nil {
+				return false, err
+			}
+			if !bytes.Equal(digest, current) {
+				return false, nil
+			}
+		case commandPolicyOR:
+			branches, err := decodePolicyOR(p.CommandPolicy)
+			if err != nil {
+				return false, err
+			}
+			var ok bool
+			for _, b := range branches {
+				if ok, err = satisfied(rw, b, authPolicies); err != nil {
+					return false, err
+				} else if ok {
+					break
+				}
+			}
+			if !ok {
+				return false, nil
+			}
+		case commandPolicyAuthorize:
+			if _, _, err := selectSignedPolicy(rw, p.CommandPolicy, authPolicies); err != nil {
+				return false, nil //nolint:nilerr // no signed policy is satisfied
+			}
+		}
+	}
+	return true, nil
+}
+
+// readPCRDigest returns the digest of the current values of the PCRs in
+// the selection, as used in TPM2_PolicyPCR. The digest is computed with
+// the hash algorithm of the policy session, and not the one of the PCR
+// bank. The PCR values are hashed in ascending order of their indices.
+func readPCRDigest(rw io.ReadWriter, sel tpm2.PCRSelection) ([]byte, error) {
+	sel = sortPCRSelection(sel)
+	h := sha256.New()
+	for i := 0; i < len(sel.PCRs); i += maxPCRsPerRead {
+		s := tpm2.PCRSelection{
+			Hash: sel.Hash,
+			PCRs: sel.PCRs[i:min(i+maxPCRsPerRead, len(sel.PCRs))],
+		}
+		values, err := tpm2.ReadPCRs(rw, s)
+		if err != nil {
+			return nil, fmt.Errorf("error reading PCRs: %w", err)
+		}
+		for _, index := range s.PCRs {
+			v, ok := values[index]
+			if !ok {
+				return nil, fmt.Errorf("error reading PCR %d", index)
+			}
+			h.Write(v)
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+func toTPMDigests(digests [][]byte) []tpmutil.U16Bytes {
+	ds := make([]tpmutil.U16Bytes, len(digests))
+	for i, d := range digests {
+		ds[i] = d
+	}
+	return ds
+}
+
+// sortPCRSelection returns a copy of the selection with the PCR indices
+// sorted in ascending order and without duplicates.
+func sortPCRSelection(sel tpm2.PCRSelection) tpm2.PCRSelection {
+	pcrs := append([]int(nil), sel.PCRs...)
+	sort.Ints(pcrs)
+	unique := pcrs[:0]
+	for _, v := range pcrs {
+		if len(unique) == 0 || v != unique[len(unique)-1] {
+			unique = append(unique, v)
+		}
+	}
+	return tpm2.PCRSelection{Hash: sel.Hash, PCRs: unique}
+}
+
+// encodePCRSelection encodes a TPML_PCR_SELECTION with a single PCR bank.
+// The PCRs are encoded in the bitmap, so the order of the PCRs in the
+// selection is not relevant.
+func encodePCRSelection(sel tpm2.PCRSelection) ([]byte, error) {
+	var bitmap [3]byte
+	for _, i := range sel.PCRs {
+		if i < 0 || i >= len(bitmap)*8 {
+			return nil, fmt.Errorf("invalid PCR index %d", i)
+		}
+		bitmap[i/8] |= 1 << (i % 8)
+	}
+	return tpmutil.Pack(uint32(1), sel.Hash, uint8(len(bitmap)), bitmap)
+}
+
+// decodePolicyPCR decodes the command policy of a TPM2_PolicyPCR policy.
+// Only selections of a single PCR bank are supported.
+func decodePolicyPCR(b []byte) ([]byte, tpm2.PCRSelection, error) {
+	var (
+		digest tpmutil.U16Bytes
+		count  uint32
+		hash   tpm2.Algorithm
+		size   uint8
+	)
+	r := bytes.NewReader(b)
+	if err := tpmutil.UnpackBuf(r, &digest, &count, &hash, &size); err != nil {
+		return nil, tpm2.PCRSelection{}, fmt.Errorf("invalid TSS2 key: malformed PCR policy: %w", err)
+	}
+	if count != 1 {
+		return nil, tpm2.PCRSelection{}, fmt.Errorf("invalid TSS2 key: PCR policy with %d banks is not supported", count)
+	}
+	bitmap := make([]byte, size)
+	if _, err := io.ReadFull(r, bitmap); err != nil || r.Len() != 0 {
+		return nil, tpm2.PCRSelection{}, errors.New("invalid TSS2 key: malformed PCR policy")
+	}
+
+	sel := tpm2.PCRSelection{Hash: hash}
+	for i, v := range bitmap {
+		for j := 0; j < 8; j++ {
+			if v&(1<<j) != 0 {
+				sel.PCRs = append(sel.PCRs, i*8+j)
+			}
+		}
+	}
+	return digest, sel, nil
+}
+
+// decodePolicyOR decodes the command policy of a TPM2_PolicyOR policy.
+func decodePolicyOR(b []byte) ([][]TPMPolicy, error) {
+	var branches [][]TPMPolicy
+	if rest, err := asn1.Unmarshal(b, &branches); err != nil || len(rest) > 0 {
+		return nil, errors.New("invalid TSS2 key: malformed OR policy")
+	}
+	if len(branches) < 2 || len(branches) > maxPolicyORBranches {
+		return nil, fmt.Errorf("invalid TSS2 key: OR policy with %d branches is not supported", len(branches))
+	}
+	return branches, nil
+}
+
+// encodeAuthorize encodes the command policy of a TPM2_PolicyAuthorize
+// policy. Signed policies also contain the signature as a TPMT_SIGNATURE.
+func encodeAuthorize(pub *tpm2new.TPMTPublic, policyRef []byte, sig *tpm2new.TPMTSignature) []byte {
+	b := tpm2new.Marshal(tpm2new.New2B(*pub))
+	b = append(b, tpm2new.Marshal(tpm2new.TPM2BNonce{Buffer: policyRef})...)
+	if sig != nil {
+		b = append(b, tpm2new.Marshal(sig)...)
+	}
+	return b
+}
+
+// decodeAuthorize decodes the command policy of a TPM2_PolicyAuthorize
+// policy. The signature is nil if it's not present.
+func decodeAuthorize(b []byte) (*tpm2new.TPMTPublic, []byte, *tpm2new.TPMTSignature, error) {
+	var (
+		public    tpmutil.U16Bytes
+		policyRef tpmutil.U16Bytes
+	)
+	r := bytes.NewReader(b)
+	if err := tpmutil.UnpackBuf(r, &public, &policyRef); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid TSS2 key: malformed authorize policy: %w", err)
+	}
+	pub, err := tpm2new.Unmarshal[tpm2new.TPMTPublic](public)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid TSS2 key: malformed authorize policy: %w", err)
+	}
+	if r.Len() == 0 {
+		return pub, policyRef, nil, nil
+	}
+	sig, err := tpm2new.Unmarshal[tpm2new.TPMTSignature](b[len(b)-r.Len():])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid TSS2 key: malformed authorize policy: %w", err)
+	}
+	return pub, policyRef, sig, nil
+}
+
+// authorityPublic returns the TPMT_PUBLIC used to load the public key of a
+// policy authority in the TPM.
+func authorityPublic(key crypto.PublicKey) (*tpm2new.TPMTPublic, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		exponent := uint32(k.E)
+		if k.E == 65537 {
+			exponent = 0
+		}
+		return &tpm2new.TPMTPublic{
+			Type:    tpm2new.TPMAlgRSA,
+			NameAlg: tpm2new.TPMAlgSHA256,
+			ObjectAttributes: tpm2new.TPMAObject{
+				SignEncrypt: true,
+			},
+			Parameters: tpm2new.NewTPMUPublicParms(tpm2new.TPMAlgRSA, &tpm2new.TPMSRSAParms{
+				Symmetric: tpm2new.TPMTSymDefObject{Algorithm: tpm2new.TPMAlgNull},
+				Scheme:    tpm2new.TPMTRSAScheme{Scheme: tpm2new.TPMAlgNull},
+				KeyBits:   tpm2new.TPMKeyBits(k.N.BitLen()),
+				Exponent:  exponent,
+			}),
+			Unique: tpm2new.NewTPMUPublicID(tpm2new.TPMAlgRSA, &tpm2new.TPM2BPublicKeyRSA{
+				Buffer: k.N.Bytes(),
+			}),
+		}, nil
+	case *ecdsa.PublicKey:
+		var curve tpm2new.TPMECCCurve
+		switch k.Curve.Params().Name {
+		case "P-256":
+			curve = tpm2new.TPMECCNistP256
+		case "P-384":
+			curve = tpm2new.TPMECCNistP384
+		case "P-521":
+			curve = tpm2new.TPMECCNistP521
+		default:
+			return nil, fmt.Errorf("unsupported policy authority curve %s", k.Curve.Params().Name)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return &tpm2new.TPMTPublic{
+			Type:    tpm2new.TPMAlgECC,
+			NameAlg: tpm2new.TPMAlgSHA256,
+			ObjectAttributes: tpm2new.TPMAObject{
+				SignEncrypt: true,
+			},
+			Parameters: tpm2new.NewTPMUPublicParms(tpm2new.TPMAlgECC, &tpm2new.TPMSECCParms{
+				Symmetric: tpm2new.TPMTSymDefObject{Algorithm: tpm2new.TPMAlgNull},
+				Scheme:    tpm2new.TPMTECCScheme{Scheme: tpm2new.TPMAlgNull},
+				CurveID:   curve,
+				KDF:       tpm2new.TPMTKDFScheme{Scheme: tpm2new.TPMAlgNull},
+			}),
+			Unique: tpm2new.NewTPMUPublicID(tpm2new.TPMAlgECC, &tpm2new.TPMSECCPoint{
+				X: tpm2new.TPM2BECCParameter{Buffer: k.X.FillBytes(make([]byte, size))},
+				Y: tpm2new.TPM2BECCParameter{Buffer: k.Y.FillBytes(make([]byte, size))},
+			}),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported policy authority key type %T", key)
+	}
+}
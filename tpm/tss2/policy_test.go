@@ -0,0 +1,363 @@
+package tss2
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"io"
+	"math/big"
+	"testing"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+	tpm2new "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyPCR(t *testing.T) {
+	digest := bytes.Repeat([]byte{0xaa}, 32)
+	sel := tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: []int{0, 7, 16, 23}}
+
+	policy, err := PolicyPCR(digest, sel)
+	require.NoError(t, err)
+	assert.Equal(t, 0x17F, policy.CommandCode)
+	assert.Equal(t, append(append([]byte{0x00, 0x20}, digest...),
+		0x00, 0x00, 0x00, 0x01, // count
+		0x00, 0x0b, // sha256
+		0x03, 0x81, 0x00, 0x81, // size of select, bitmap
+	), policy.CommandPolicy)
+
+	gotDigest, gotSel, err := decodePolicyPCR(policy.CommandPolicy)
+	require.NoError(t, err)
+	assert.Equal(t, digest, gotDigest)
+	assert.Equal(t, sel, gotSel)
+
+	// The selection is sorted and without duplicates.
+	unsorted, err := PolicyPCR(digest, tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: []int{23, 7, 0, 16, 7}})
+	require.NoError(t, err)
+	assert.Equal(t, policy, unsorted)
+
+	_, err = PolicyPCR(digest, tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: []int{24}})
+	assert.Error(t, err)
+
+	for _, b := range [][]byte{
+		nil,
+		policy.CommandPolicy[:len(policy.CommandPolicy)-1],
+		append(policy.CommandPolicy, 0),
+		bytes.Replace(policy.CommandPolicy, []byte{0, 0, 0, 1}, []byte{0, 0, 0, 2}, 1),
+	} {
+		_, _, err := decodePolicyPCR(b)
+		assert.Error(t, err)
+	}
+}
+
+func TestPolicyPCRFromTPM(t *testing.T) {
+	rw := openTPM(t)
+	t.Cleanup(func() {
+		assert.NoError(t, rw.Close())
+	})
+
+	require.NoError(t, tpm2.PCRExtend(rw, tpmutil.Handle(16), tpm2.AlgSHA256, bytes.Repeat([]byte{2}, 32), ""))
+	pcrs, err := tpm2.ReadPCRs(rw, tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: []int{0, 7, 16}})
+	require.NoError(t, err)
+	h := sha256.New()
+	h.Write(pcrs[0])
+	h.Write(pcrs[7])
+	h.Write(pcrs[16])
+	want, err := PolicyPCR(h.Sum(nil), tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: []int{0, 7, 16}})
+	require.NoError(t, err)
+
+	// The PCR values are hashed in ascending order, as the TPM does.
+	policy, err := PolicyPCRFromTPM(rw, tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: []int{16, 0, 7, 16}})
+	require.NoError(t, err)
+	assert.Equal(t, want, policy)
+
+	key, err := Seal(rw, []byte("the secret"), "", policy)
+	require.NoError(t, err)
+	data, err := Unseal(rw, key, "")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("the secret"), data)
+}
+
+func TestPolicyAuthValue(t *testing.T) {
+	assert.Equal(t, TPMPolicy{CommandCode: 0x16B, CommandPolicy: []byte{}}, PolicyAuthValue())
+}
+
+func extendDigest(digest []byte, data ...[]byte) []byte {
+	h := sha256.New()
+	h.Write(digest)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+func TestPolicyOR(t *testing.T) {
+	branch := []TPMPolicy{PolicyAuthValue()}
+	policy, err := PolicyOR(branch, branch)
+	require.NoError(t, err)
+	assert.Equal(t, 0x171, policy.CommandCode)
+
+	branches, err := decodePolicyOR(policy.CommandPolicy)
+	require.NoError(t, err)
+	assert.Equal(t, [][]TPMPolicy{branch, branch}, branches)
+
+	_, err = PolicyOR(branch)
+	assert.Error(t, err)
+	_, err = PolicyOR(branch, branch, branch, branch, branch, branch, branch, branch, branch)
+	assert.Error(t, err)
+	_, err = PolicyOR(branch, []TPMPolicy{{CommandCode: 1}})
+	assert.Error(t, err)
+
+	for _, b := range [][]byte{
+		nil,
+		append(policy.CommandPolicy, 0),
+		policy.CommandPolicy[:len(policy.CommandPolicy)-1],
+	} {
+		_, err := decodePolicyOR(b)
+		assert.Error(t, err)
+	}
+}
+
+func TestPolicyAuthorize(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for _, key := range []crypto.Signer{ecKey, rsaKey} {
+		policy, err := PolicyAuthorize(key.Public(), []byte("ref"))
+		require.NoError(t, err)
+		assert.Equal(t, 0x16A, policy.CommandCode)
+
+		pub, ref, sig, err := decodeAuthorize(policy.CommandPolicy)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("ref"), ref)
+		assert.Nil(t, sig)
+		want, err := authorityPublic(key.Public())
+		require.NoError(t, err)
+		assert.Equal(t, tpm2new.Marshal(want), tpm2new.Marshal(pub))
+
+		approved := []TPMPolicy{PolicyAuthValue()}
+		signed, err := SignPolicy(key, "signed", []byte("ref"), approved...)
+		require.NoError(t, err)
+		assert.Equal(t, "signed", signed.Name)
+		require.Len(t, signed.Policy, 2)
+		assert.Equal(t, approved, signed.Policy[:1])
+
+		// The signature is over the digest of the approved policies and
+		// the policy reference.
+		_, _, sig, err = decodeAuthorize(signed.Policy[1].CommandPolicy)
+		require.NoError(t, err)
+		digest, err := PolicyDigest(approved)
+		require.NoError(t, err)
+		aHash := sha256.Sum256(append(digest, []byte("ref")...))
+		switch k := key.Public().(type) {
+		case *ecdsa.PublicKey:
+			s, err := sig.Signature.ECDSA()
+			require.NoError(t, err)
+			r := new(big.Int).SetBytes(s.SignatureR.Buffer)
+			ss := new(big.Int).SetBytes(s.SignatureS.Buffer)
+			assert.True(t, ecdsa.Verify(k, aHash[:], r, ss))
+		case *rsa.PublicKey:
+			s, err := sig.Signature.RSASSA()
+			require.NoError(t, err)
+			assert.NoError(t, rsa.VerifyPKCS1v15(k, crypto.SHA256, aHash[:], s.Sig.Buffer))
+		}
+
+		_, err = SignPolicy(key, "signed", nil, TPMPolicy{CommandCode: 1})
+		assert.Error(t, err)
+	}
+
+	_, err = PolicyAuthorize(edKey.Public(), nil)
+	assert.Error(t, err)
+	_, err = SignPolicy(edKey, "signed", nil)
+	assert.Error(t, err)
+	_, _, _, err = decodeAuthorize([]byte{0x00})
+	assert.Error(t, err)
+}
+
+func TestPolicyDigest(t *testing.T) {
+	zeros := make([]byte, 32)
+	pcrDigest := bytes.Repeat([]byte{0xaa}, 32)
+	pcrPolicy, err := PolicyPCR(pcrDigest, tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: []int{7}})
+	require.NoError(t, err)
+	orPolicy, err := PolicyOR([]TPMPolicy{pcrPolicy}, []TPMPolicy{PolicyAuthValue()})
+	require.NoError(t, err)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	authorizePolicy, err := PolicyAuthorize(key.Public(), []byte("ref"))
+	require.NoError(t, err)
+	pub, err := authorityPublic(key.Public())
+	require.NoError(t, err)
+	name, err := tpm2new.ObjectName(pub)
+	require.NoError(t, err)
+
+	pcr := extendDigest(zeros, []byte{0, 0, 0x01, 0x7F}, []byte{0, 0, 0, 1, 0, 0x0b, 3, 0x80, 0, 0}, pcrDigest)
+	authValue := extendDigest(zeros, []byte{0, 0, 0x01, 0x6B})
+
+	tests := []struct {
+		name      string
+		policies  []TPMPolicy
+		want      []byte
+		assertion assert.ErrorAssertionFunc
+	}{
+		{"ok empty", nil, zeros, assert.NoError},
+		{"ok auth value", []TPMPolicy{PolicyAuthValue()}, authValue, assert.NoError},
+		{"ok pcr", []TPMPolicy{pcrPolicy}, pcr, assert.NoError},
+		{"ok pcr and auth value", []TPMPolicy{pcrPolicy, PolicyAuthValue()}, extendDigest(pcr, []byte{0, 0, 0x01, 0x6B}), assert.NoError},
+		{"ok or", []TPMPolicy{orPolicy}, extendDigest(zeros, []byte{0, 0, 0x01, 0x71}, pcr, authValue), assert.NoError},
+		{"ok authorize", []TPMPolicy{authorizePolicy}, extendDigest(extendDigest(zeros, []byte{0, 0, 0x01, 0x6A}, name.Buffer), []byte("ref")), assert.NoError},
+		{"fail command code", []TPMPolicy{{CommandCode: 1}}, nil, assert.Error},
+		{"fail pcr", []TPMPolicy{{CommandCode: 0x17F}}, nil, assert.Error},
+		{"fail or", []TPMPolicy{{CommandCode: 0x171}}, nil, assert.Error},
+		{"fail authorize", []TPMPolicy{{CommandCode: 0x16A}}, nil, assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PolicyDigest(tt.policies)
+			tt.assertion(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSeal(t *testing.T) {
+	rw := openTPM(t)
+	t.Cleanup(func() {
+		assert.NoError(t, rw.Close())
+	})
+
+	pcrs, err := tpm2.ReadPCRs(rw, tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: []int{16}})
+	require.NoError(t, err)
+	pcrDigest := sha256.Sum256(pcrs[16])
+	pcrPolicy, err := PolicyPCR(pcrDigest[:], tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: []int{16}})
+	require.NoError(t, err)
+	otherPolicy, err := PolicyPCR(bytes.Repeat([]byte{0xaa}, 32), tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: []int{16}})
+	require.NoError(t, err)
+	orPolicy, err := PolicyOR([]TPMPolicy{otherPolicy}, []TPMPolicy{pcrPolicy})
+	require.NoError(t, err)
+
+	authority, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	authorizePolicy, err := PolicyAuthorize(authority.Public(), []byte("ref"))
+	require.NoError(t, err)
+	otherSigned, err := SignPolicy(authority, "other", []byte("ref"), otherPolicy)
+	require.NoError(t, err)
+	signed, err := SignPolicy(authority, "signed", []byte("ref"), pcrPolicy)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		password     string
+		policies     []TPMPolicy
+		authPolicies []TPMAuthPolicy
+	}{
+		{"ok", "", nil, nil},
+		{"ok password", "password", nil, nil},
+		{"ok pcr", "", []TPMPolicy{pcrPolicy}, nil},
+		{"ok pcr and password", "password", []TPMPolicy{pcrPolicy, PolicyAuthValue()}, nil},
+		{"ok or", "", []TPMPolicy{orPolicy}, nil},
+		{"ok authorize", "password", []TPMPolicy{authorizePolicy, PolicyAuthValue()}, []TPMAuthPolicy{otherSigned, signed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := Seal(rw, []byte("the secret"), tt.password, tt.policies...)
+			require.NoError(t, err)
+			assert.True(t, key.IsSealed())
+			assert.Equal(t, tt.password == "", key.EmptyAuth)
+			assert.Equal(t, tt.policies, key.Policy)
+			WithAuthPolicy(tt.authPolicies...)(key)
+
+			// The key can be marshaled and parsed again.
+			der, err := MarshalPrivateKey(key)
+			require.NoError(t, err)
+			key, err = ParsePrivateKey(der)
+			require.NoError(t, err)
+
+			data, err := Unseal(rw, key, tt.password)
+			require.NoError(t, err)
+			assert.Equal(t, []byte("the secret"), data)
+
+			if tt.password != "" {
+				_, err = Unseal(rw, key, "wrong password")
+				assert.Error(t, err)
+			}
+		})
+	}
+
+	_, err = Seal(rw, nil, "")
+	assert.Error(t, err)
+	_, err = Seal(rw, make([]byte, 129), "")
+	assert.Error(t, err)
+	_, err = Seal(nil, []byte("the secret"), "")
+	assert.Error(t, err)
+	_, err = Seal(rw, []byte("the secret"), "", TPMPolicy{CommandCode: 1})
+	assert.Error(t, err)
+
+	// Data bound to a PCR can't be unsealed once the PCR changes.
+	key, err := Seal(rw, []byte("the secret"), "", pcrPolicy)
+	require.NoError(t, err)
+	orKey, err := Seal(rw, []byte("the secret"), "", orPolicy)
+	require.NoError(t, err)
+	authorizeKey, err := Seal(rw, []byte("the secret"), "", authorizePolicy)
+	require.NoError(t, err)
+	require.NoError(t, tpm2.PCRExtend(rw, tpmutil.Handle(16), tpm2.AlgSHA256, bytes.Repeat([]byte{1}, 32), ""))
+	_, err = Unseal(rw, key, "")
+	assert.Error(t, err)
+	_, err = Unseal(rw, orKey, "")
+	assert.Error(t, err)
+	_, err = Unseal(rw, authorizeKey, "")
+	assert.Error(t, err)
+
+	// A new signed policy authorizes the new PCR value without changing
+	// the sealed object.
+	newPolicy, err := PolicyPCRFromTPM(rw, tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: []int{16}})
+	require.NoError(t, err)
+	newSigned, err := SignPolicy(authority, "new", []byte("ref"), newPolicy)
+	require.NoError(t, err)
+	WithAuthPolicy(signed, newSigned)(authorizeKey)
+	data, err := Unseal(rw, authorizeKey, "")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("the secret"), data)
+}
+
+func TestUnseal_fail(t *testing.T) {
+	rw := new(bytes.Buffer)
+	sealed := NewSealed([]byte("public"), []byte("private"))
+
+	tests := []struct {
+		name string
+		rw   io.ReadWriter
+		key  *TPMKey
+	}{
+		{"fail rw", nil, sealed},
+		{"fail key", rw, nil},
+		{"fail type", rw, New([]byte("public"), []byte("private"))},
+		{"fail policy", rw, NewSealed([]byte("public"), []byte("private"), WithPolicy(TPMPolicy{CommandCode: 1}))},
+		{"fail secret", rw, NewSealed([]byte("public"), []byte("private"), func(k *TPMKey) {
+			k.Secret = []byte("secret")
+		})},
+		{"fail parent", rw, NewSealed([]byte("public"), []byte("private"), WithParent(1))},
+		{"fail public key", rw, NewSealed([]byte("public"), []byte("private"), func(k *TPMKey) {
+			k.PublicKey = []byte("public")
+		})},
+		{"fail private key", rw, NewSealed([]byte("public"), []byte("private"), func(k *TPMKey) {
+			k.PrivateKey = []byte("private")
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Unseal(tt.rw, tt.key, "")
+			assert.Error(t, err)
+		})
+	}
+}
@@ -86,30 +86,23 @@ type Signer struct {
 	publicKey   crypto.PublicKey
 	tpmKey      *TPMKey
 	srkTemplate tpm2.Public
+	password    string
 }
 
 // CreateSigner creates a new [crypto.Signer] with the given TPM (rw) and
 // [TPMKey]. The caller is responsible for opening and closing the TPM.
+//
+// Importable keys are imported into the TPM the first time they are used
+// to sign.
 func CreateSigner(rw io.ReadWriter, key *TPMKey) (*Signer, error) {
 	switch {
 	case rw == nil:
 		return nil, fmt.Errorf("invalid TPM channel: rw cannot be nil")
 	case key == nil:
 		return nil, fmt.Errorf("invalid TPM key: key cannot be nil")
-	case !key.Type.Equal(oidLoadableKey):
-		return nil, fmt.Errorf("invalid TSS2 key: type %q is not valid", key.Type.String())
-	case len(key.Policy) != 0:
-		return nil, errors.New("invalid TSS2 key: policy is not implemented")
-	case len(key.AuthPolicy) != 0:
-		return nil, errors.New("invalid TSS2 key: auth policy is not implemented")
-	case len(key.Secret) > 0:
-		return nil, errors.New("invalid TSS2 key: secret should not be set")
-	case !validateParent(key.Parent):
-		return nil, fmt.Errorf("invalid TSS2 key: parent '%d' is not valid", key.Parent)
-	case !validateKey(key.PublicKey):
-		return nil, errors.New("invalid TSS2 key: public key is invalid")
-	case !validateKey(key.PrivateKey):
-		return nil, errors.New("invalid TSS2 key: private key key is invalid")
+	}
+	if err := validateLoadableKey(key); err != nil {
+		return nil, err
 	}
 
 	publicKey, err := key.Public()
@@ -141,6 +134,20 @@ func (s *Signer) SetSRKTemplate(p tpm2.Public) {
 	s.m.Unlock()
 }
 
+// SetPassword sets the authorization value used to sign with keys that
+// don't have an empty auth. The password is sent in clear text, and it's
+// ignored if the key has an empty auth.
+//
+// # Experimental
+//
+// Notice: This API is EXPERIMENTAL and may be changed or removed in a later
+// release.
+func (s *Signer) SetPassword(password string) {
+	s.m.Lock()
+	s.password = password
+	s.m.Unlock()
+}
+
 // SetCommandChannel allows to change the TPM channel. This operation is useful
 // if the channel set in [CreateSigner] is closed and opened again before
 // calling [Signer.Sign].
@@ -162,38 +169,44 @@ func (s *Signer) Public() crypto.PublicKey {
 
 // Sign implements the [crypto.Signer] interface.
 func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
-	parentHandle := tpmutil.Handle(s.tpmKey.Parent)
-	if !handleIsPersistent(s.tpmKey.Parent) {
-		parentHandle, _, err = tpm2.CreatePrimary(s.rw, parentHandle, tpm2.PCRSelection{}, "", "", s.srkTemplate)
-		if err != nil {
-			return nil, fmt.Errorf("error creating primary: %w", err)
-		}
-		defer tpm2.FlushContext(s.rw, parentHandle)
-	}
+	s.m.Lock()
+	defer s.m.Unlock()
 
-	keyHandle, _, err := tpm2.Load(s.rw, parentHandle, "", s.tpmKey.PublicKey[2:], s.tpmKey.PrivateKey[2:])
+	key, keyHandle, err := loadKey(s.rw, s.tpmKey, s.srkTemplate)
 	if err != nil {
-		return nil, fmt.Errorf("error loading key handle: %w", err)
+		return nil, err
 	}
 	defer tpm2.FlushContext(s.rw, keyHandle)
+	s.tpmKey = key
+
+	session, closer, err := policySession(s.rw, s.tpmKey)
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+
+	var password string
+	if !s.tpmKey.EmptyAuth {
+		password = s.password
+	}
 
 	switch p := s.publicKey.(type) {
 	case *ecdsa.PublicKey:
-		return signECDSA(s.rw, keyHandle, digest, p.Curve)
+		return signECDSA(s.rw, session, keyHandle, password, digest, p.Curve)
 	case *rsa.PublicKey:
-		return signRSA(s.rw, keyHandle, digest, opts)
+		return signRSA(s.rw, session, keyHandle, password, digest, opts)
 	default:
 		return nil, fmt.Errorf("unsupported signing key type %T", s.publicKey)
 	}
 }
 
 // https://github.com/smallstep/go-attestation/blob/f5480326fb6d63859537ec89fbea7c62485bc4da/attest/wrapped_tpm20.go#L513
-func signECDSA(rw io.ReadWriter, key tpmutil.Handle, digest []byte, curve elliptic.Curve) ([]byte, error) {
+func signECDSA(rw io.ReadWriter, session, key tpmutil.Handle, password string, digest []byte, curve elliptic.Curve) ([]byte, error) {
 	scheme, err := curveSigScheme(curve)
 	if err != nil {
 		return nil, err
 	}
-	sig, err := tpm2.Sign(rw, key, "", digest, nil, scheme)
+	sig, err := tpm2.SignWithSession(rw, session, key, password, digest, nil, scheme)
 	if err != nil {
 		return nil, fmt.Errorf("error creating ECDSA signature: %w", err)
 	}
@@ -207,7 +220,7 @@ func signECDSA(rw io.ReadWriter, key tpmutil.Handle, digest []byte, curve ellipt
 }
 
 // https://github.com/smallstep/go-attestation/blob/f5480326fb6d63859537ec89fbea7c62485bc4da/attest/wrapped_tpm20.go#L527
-func signRSA(rw io.ReadWriter, key tpmutil.Handle, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+func signRSA(rw io.ReadWriter, session, key tpmutil.Handle, password string, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
 	h, err := tpm2.HashToAlgorithm(opts.HashFunc())
 	if err != nil {
 		return nil, fmt.Errorf("error getting algorithm: %w", err)
@@ -225,7 +238,7 @@ func signRSA(rw io.ReadWriter, key tpmutil.Handle, digest []byte, opts crypto.Si
 		scheme.Alg = tpm2.AlgRSAPSS
 	}
 
-	sig, err := tpm2.Sign(rw, key, "", digest, nil, scheme)
+	sig, err := tpm2.SignWithSession(rw, session, key, password, digest, nil, scheme)
 	if err != nil {
 		return nil, fmt.Errorf("error creating RSA signature: %w", err)
 	}
@@ -253,6 +266,64 @@ func curveSigScheme(curve elliptic.Curve) (*tpm2.SigScheme, error) {
 	return scheme, nil
 }
 
+// validateLoadableKey validates a [TPMKey] used to sign or decrypt. The key
+// must be a loadable or an importable key.
+func validateLoadableKey(key *TPMKey) error {
+	switch {
+	case key.IsImportable():
+		if !validateKey(key.Secret) {
+			return errors.New("invalid TSS2 key: secret is invalid")
+		}
+	case !key.Type.Equal(oidLoadableKey):
+		return fmt.Errorf("invalid TSS2 key: type %q is not valid", key.Type.String())
+	case len(key.Secret) > 0:
+		return errors.New("invalid TSS2 key: secret should not be set")
+	}
+
+	switch {
+	case !validateParent(key.Parent):
+		return fmt.Errorf("invalid TSS2 key: parent '%d' is not valid", key.Parent)
+	case !validateKey(key.PublicKey):
+		return errors.New("invalid TSS2 key: public key is invalid")
+	case !validateKey(key.PrivateKey):
+		return errors.New("invalid TSS2 key: private key key is invalid")
+	}
+
+	if err := validatePolicy(key.Policy); err != nil {
+		return err
+	}
+	for _, ap := range key.AuthPolicy {
+		if err := validatePolicy(ap.Policy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadKey loads the key in the TPM and returns its handle. Importable keys
+// are imported first, and the returned [TPMKey] is the loadable key that
+// can be used in subsequent calls.
+func loadKey(rw io.ReadWriter, key *TPMKey, srkTemplate tpm2.Public) (*TPMKey, tpmutil.Handle, error) {
+	if key.IsImportable() {
+		var err error
+		if key, err = importKey(rw, key, srkTemplate); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	parentHandle, auth, closer, err := loadParent(rw, key.Parent, srkTemplate)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer closer()
+
+	keyHandle, _, err := tpm2.LoadUsingAuth(rw, parentHandle, auth, key.PublicKey[2:], key.PrivateKey[2:])
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading key handle: %w", err)
+	}
+	return key, keyHandle, nil
+}
+
 func handleIsPersistent(h int) bool {
 	return (h >> 24) == int(tpm2.HandleTypePersistent)
 }
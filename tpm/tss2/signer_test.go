@@ -144,6 +144,49 @@ func TestSign(t *testing.T) {
 	}
 }
 
+func TestSign_policy(t *testing.T) {
+	rw := openTPM(t)
+	t.Cleanup(func() {
+		assert.NoError(t, rw.Close())
+	})
+
+	keyHnd, _, err := tpm2.CreatePrimary(rw, tpm2.HandleOwner, tpm2.PCRSelection{}, "", "", RSASRKTemplate)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, tpm2.FlushContext(rw, keyHnd))
+	})
+
+	pcrPolicy, err := PolicyPCRFromTPM(rw, tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: []int{0, 7}})
+	require.NoError(t, err)
+	policies := []TPMPolicy{pcrPolicy, PolicyAuthValue()}
+	digest, err := PolicyDigest(policies)
+	require.NoError(t, err)
+
+	params := defaultKeyParamsEC
+	params.Attributes &^= tpm2.FlagUserWithAuth
+	params.AuthPolicy = digest
+	priv, pub, _, _, _, err := tpm2.CreateKey(rw, keyHnd, tpm2.PCRSelection{}, "", "password", params)
+	require.NoError(t, err)
+
+	signer, err := CreateSigner(rw, New(pub, priv, WithEmptyAuth(false), WithPolicy(policies...)))
+	require.NoError(t, err)
+
+	hash := crypto.SHA256.New()
+	hash.Write([]byte("rulingly-quailed-cloacal-indifferentist-roughhoused-self-mad"))
+	sum := hash.Sum(nil)
+
+	// The policy requires the password.
+	_, err = signer.Sign(rand.Reader, sum, crypto.SHA256)
+	assert.Error(t, err)
+
+	signer.SetPassword("password")
+	sig, err := signer.Sign(rand.Reader, sum, crypto.SHA256)
+	require.NoError(t, err)
+	pk, ok := signer.Public().(*ecdsa.PublicKey)
+	require.True(t, ok)
+	assert.True(t, ecdsa.VerifyASN1(pk, sum, sig))
+}
+
 func TestSign_SetTPM(t *testing.T) {
 	var signer *Signer
 
@@ -330,7 +373,7 @@ func Test_signECDSA_fail(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := signECDSA(tt.args.rw, tt.args.key, tt.args.digest, tt.args.curve)
+			got, err := signECDSA(tt.args.rw, tpm2.HandlePasswordSession, tt.args.key, "", tt.args.digest, tt.args.curve)
 			tt.assertion(t, err)
 			assert.Equal(t, tt.want, got)
 		})
@@ -367,7 +410,7 @@ func Test_signRSA_fail(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := signRSA(tt.args.rw, tt.args.key, tt.args.digest, tt.args.opts)
+			got, err := signRSA(tt.args.rw, tpm2.HandlePasswordSession, tt.args.key, "", tt.args.digest, tt.args.opts)
 			tt.assertion(t, err)
 			assert.Equal(t, tt.want, got)
 		})
@@ -96,7 +96,6 @@ func ParsePrivateKey(derBytes []byte) (*TPMKey, error) {
 		}
 	}
 
-	// TODO(mariano): generate key with secret
 	if tag, ok := readOptionalTag(&input, 2); ok {
 		if key.Secret, ok = readOctetString(&tag); !ok {
 			return nil, errors.New("malformed TSS2 secret")
@@ -3,10 +3,15 @@
 package x509util
 
 import (
+	"bytes"
 	"crypto"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/json"
+	"math/big"
 	"time"
 
 	"github.com/pkg/errors"
@@ -36,7 +41,13 @@ type Certificate struct {
 	OCSPServer            OCSPServer               `json:"ocspServer"`
 	IssuingCertificateURL IssuingCertificateURL    `json:"issuingCertificateURL"`
 	CRLDistributionPoints CRLDistributionPoints    `json:"crlDistributionPoints"`
+	DistributionPoints    DistributionPoints       `json:"distributionPoints"`
+	FreshestCRL           FreshestCRL              `json:"freshestCRL"`
 	PolicyIdentifiers     PolicyIdentifiers        `json:"policyIdentifiers"`
+	CertificatePolicies   CertificatePolicies      `json:"certificatePolicies"`
+	PolicyMappings        PolicyMappings           `json:"policyMappings"`
+	PolicyConstraints     *PolicyConstraints       `json:"policyConstraints"`
+	InhibitAnyPolicy      *InhibitAnyPolicy        `json:"inhibitAnyPolicy"`
 	BasicConstraints      *BasicConstraints        `json:"basicConstraints"`
 	NameConstraints       *NameConstraints         `json:"nameConstraints"`
 	SignatureAlgorithm    SignatureAlgorithm       `json:"signatureAlgorithm"`
@@ -85,6 +96,178 @@ func NewCertificateFromX509(template *x509.Certificate, opts ...Option) (*Certif
 	return newCertificateWithOptions(csr, o)
 }
 
+// CertificateFromX509 creates a Certificate from a parsed x509.Certificate.
+// This is the reverse of NewCertificate, the JSON representation of the
+// returned Certificate can be used as a template to create a certificate with
+// the same contents, for example to renew or clone an existing certificate.
+//
+// Extensions are mapped to the Certificate fields when the Go standard library
+// would encode them with the same value and criticality, otherwise they are
+// kept in the Extensions field as raw extensions. Subject alternative names
+// not supported by the Go standard library, like PermanentIdentifier,
+// HardwareModuleName or UserPrincipalName, are added to the SANs field. The
+// RawSubject is only set if the Subject field cannot reproduce the original
+// encoding.
+//
+// Like in NewCertificate, extensions that are always generated by the Go
+// standard library, like the subject key identifier in CA certificates, will
+// still be generated when the certificate is signed.
+func CertificateFromX509(cert *x509.Certificate) (*Certificate, error) {
+	c := &Certificate{
+		Version:            cert.Version,
+		Subject:            newSubject(cert.Subject),
+		Issuer:             newIssuer(cert.Issuer),
+		SerialNumber:       SerialNumber{cert.SerialNumber},
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		SignatureAlgorithm: SignatureAlgorithm(cert.SignatureAlgorithm),
+		PublicKeyAlgorithm: cert.PublicKeyAlgorithm,
+		PublicKey:          cert.PublicKey,
+	}
+
+	// Keep the raw subject only if the subject cannot be encoded in the same
+	// way.
+	if len(cert.RawSubject) > 0 {
+		subject, err := asn1.Marshal(Name(c.Subject).goValue().ToRDNSequence())
+		if err != nil || !bytes.Equal(subject, cert.RawSubject) {
+			c.RawSubject = cert.RawSubject
+		}
+	}
+
+	// Extensions supported by the Go standard library.
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidExtensionSubjectAltName):
+			sans, err := ParseSubjectAlternativeNameExtension(ext.Value)
+			switch {
+			case err != nil:
+				// Use the raw extension.
+			case hasExtendedSANs(sans):
+				c.SANs = sans
+			default:
+				c.DNSNames = cert.DNSNames
+				c.EmailAddresses = cert.EmailAddresses
+				c.IPAddresses = cert.IPAddresses
+				c.URIs = cert.URIs
+			}
+		case ext.Id.Equal(oidExtensionKeyUsage):
+			c.KeyUsage = KeyUsage(cert.KeyUsage)
+		case ext.Id.Equal(oidExtensionExtendedKeyUsage):
+			c.ExtKeyUsage = ExtKeyUsage(cert.ExtKeyUsage)
+			c.UnknownExtKeyUsage = UnknownExtKeyUsage(cert.UnknownExtKeyUsage)
+		case ext.Id.Equal(oidExtensionSubjectKeyID):
+			c.SubjectKeyID = SubjectKeyID(cert.SubjectKeyId)
+		case ext.Id.Equal(oidExtensionAuthorityKeyID):
+			c.AuthorityKeyID = AuthorityKeyID(cert.AuthorityKeyId)
+		case ext.Id.Equal(oidExtensionAuthorityInfoAccess):
+			c.OCSPServer = OCSPServer(cert.OCSPServer)
+			c.IssuingCertificateURL = IssuingCertificateURL(cert.IssuingCertificateURL)
+		case ext.Id.Equal(oidExtensionCRLDistributionPoints):
+			if points, err := parseDistributionPoints(ext.Value); err == nil && !points.isURIOnly() {
+				c.DistributionPoints = points
+			} else {
+				c.CRLDistributionPoints = CRLDistributionPoints(cert.CRLDistributionPoints)
+			}
+		case ext.Id.Equal(oidExtensionFreshestCRL):
+			if points, err := parseDistributionPoints(ext.Value); err == nil {
+				c.FreshestCRL = FreshestCRL(points)
+			}
+		case ext.Id.Equal(oidExtensionCertificatePolicies):
+			if policies, err := parseCertificatePolicies(ext.Value); err == nil && policies.hasQualifiers() {
+				c.CertificatePolicies = policies
+			} else {
+				c.PolicyIdentifiers = PolicyIdentifiers(cert.PolicyIdentifiers)
+			}
+		case ext.Id.Equal(oidExtensionPolicyMappings):
+			if mappings, err := parsePolicyMappings(ext.Value); err == nil {
+				c.PolicyMappings = mappings
+			}
+		case ext.Id.Equal(oidExtensionPolicyConstraints):
+			if constraints, err := parsePolicyConstraints(ext.Value); err == nil {
+				c.PolicyConstraints = constraints
+			}
+		case ext.Id.Equal(oidExtensionInhibitAnyPolicy):
+			if inhibit, err := parseInhibitAnyPolicy(ext.Value); err == nil {
+				c.InhibitAnyPolicy = inhibit
+			}
+		case ext.Id.Equal(oidExtensionBasicConstraints):
+			c.BasicConstraints = &BasicConstraints{
+				IsCA:       cert.IsCA,
+				MaxPathLen: cert.MaxPathLen,
+			}
+		case ext.Id.Equal(oidExtensionNameConstraints):
+			c.NameConstraints = &NameConstraints{
+				Critical:                cert.PermittedDNSDomainsCritical,
+				PermittedDNSDomains:     cert.PermittedDNSDomains,
+				ExcludedDNSDomains:      cert.ExcludedDNSDomains,
+				PermittedIPRanges:       cert.PermittedIPRanges,
+				ExcludedIPRanges:        cert.ExcludedIPRanges,
+				PermittedEmailAddresses: cert.PermittedEmailAddresses,
+				ExcludedEmailAddresses:  cert.ExcludedEmailAddresses,
+				PermittedURIDomains:     cert.PermittedURIDomains,
+				ExcludedURIDomains:      cert.ExcludedURIDomains,
+			}
+		}
+	}
+
+	// Create a certificate with the mapped fields, and keep the original
+	// extension if the new one does not match.
+	generated, err := c.generateExtensions()
+	if err != nil {
+		return nil, err
+	}
+	for _, ext := range cert.Extensions {
+		if e, ok := generated[ext.Id.String()]; ok && e.Critical == ext.Critical && bytes.Equal(e.Value, ext.Value) {
+			continue
+		}
+		if ext.Id.Equal(oidExtensionSubjectAltName) {
+			c.SANs = nil
+			c.DNSNames = cert.DNSNames
+			c.EmailAddresses = cert.EmailAddresses
+			c.IPAddresses = cert.IPAddresses
+			c.URIs = cert.URIs
+		}
+		c.Extensions = append(c.Extensions, newExtension(ext))
+	}
+
+	return c, nil
+}
+
+// generateExtensions signs the certificate with a random key and returns the
+// extensions generated by the Go standard library. It is used to verify that
+// the mapping of a parsed certificate generates the same extensions.
+func (c *Certificate) generateExtensions() (map[string]pkix.Extension, error) {
+	cc := *c
+	cc.Extensions = nil
+	if err := cc.addExtendedSANsExtension(); err != nil {
+		return nil, err
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating key")
+	}
+	template := cc.GetCertificate()
+	template.PublicKey = pub
+	template.PublicKeyAlgorithm = x509.Ed25519
+	template.SignatureAlgorithm = x509.PureEd25519
+	template.SerialNumber = big.NewInt(1)
+	asn1Data, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating certificate")
+	}
+	cert, err := x509.ParseCertificate(asn1Data)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate")
+	}
+
+	m := make(map[string]pkix.Extension, len(cert.Extensions))
+	for _, ext := range cert.Extensions {
+		m[ext.Id.String()] = ext
+	}
+	return m, nil
+}
+
 // newCertificateWithOptions creates a new Certificate from an x509.CertificateRequest
 // with options applied. If no template was applied, the data from the x509.CertificateRequest
 // will simply be copied over and returned with the default leaf key usages. Otherwise, the
@@ -93,7 +276,9 @@ func newCertificateWithOptions(csr *x509.CertificateRequest, o *Options) (*Certi
 	// If no template is set, use only the certificate request with the
 	// default leaf key usages.
 	if o.CertBuffer == nil {
-		return NewCertificateRequestFromX509(csr).GetLeafCertificate(), nil
+		cert := NewCertificateRequestFromX509(csr).GetLeafCertificate()
+		cert.addExtensions(o.Extensions)
+		return lintCertificate(cert, o)
 	}
 
 	// With templates
@@ -106,19 +291,58 @@ func newCertificateWithOptions(csr *x509.CertificateRequest, o *Options) (*Certi
 	cert.PublicKey = csr.PublicKey
 	cert.PublicKeyAlgorithm = csr.PublicKeyAlgorithm
 
-	// Generate the subjectAltName extension if the certificate contains SANs
-	// that are not supported in the Go standard library.
-	if cert.hasExtendedSANs() && !cert.hasExtension(oidExtensionSubjectAltName) {
-		ext, err := createCertificateSubjectAltNameExtension(cert, cert.Subject.IsEmpty())
+	if err := cert.addExtendedSANsExtension(); err != nil {
+		return nil, err
+	}
+	cert.addExtensions(o.Extensions)
+
+	return lintCertificate(&cert, o)
+}
+
+// addExtensions adds the given extensions to the certificate, replacing the
+// existing ones with the same identifier.
+func (c *Certificate) addExtensions(extensions []pkix.Extension) {
+	for _, e := range extensions {
+		ext := newExtension(e)
+		replaced := false
+		for i := range c.Extensions {
+			if c.Extensions[i].ID.Equal(ext.ID) {
+				c.Extensions[i] = ext
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			c.Extensions = append(c.Extensions, ext)
+		}
+	}
+}
+
+// addExtendedSANsExtension generates the subjectAltName extension if the
+// certificate contains SANs that are not supported in the Go standard library.
+func (c *Certificate) addExtendedSANsExtension() error {
+	if c.hasExtendedSANs() && !c.hasExtension(oidExtensionSubjectAltName) {
+		ext, err := createCertificateSubjectAltNameExtension(*c, c.Subject.IsEmpty())
 		if err != nil {
-			return nil, err
+			return err
 		}
 		// Prepend extension to achieve a certificate as similar as possible to
 		// the one generated by the Go standard library.
-		cert.Extensions = append([]Extension{ext}, cert.Extensions...)
+		c.Extensions = append([]Extension{ext}, c.Extensions...)
 	}
+	return nil
+}
 
-	return &cert, nil
+// lintCertificate runs the linter in the options, if any, and returns an error
+// if the certificate does not pass the rules with LintSeverityError severity.
+func lintCertificate(cert *Certificate, o *Options) (*Certificate, error) {
+	if o.Linter == nil {
+		return cert, nil
+	}
+	if err := o.Linter.LintCertificate(cert).Err(); err != nil {
+		return nil, err
+	}
+	return cert, nil
 }
 
 // GetCertificate returns the x509.Certificate representation of the
@@ -158,6 +382,28 @@ func (c *Certificate) GetCertificate() *x509.Certificate {
 	c.IssuingCertificateURL.Set(cert)
 	c.CRLDistributionPoints.Set(cert)
 	c.PolicyIdentifiers.Set(cert)
+
+	// Extensions not supported by the Go standard library. A custom extension
+	// with the same oid takes precedence.
+	if len(c.DistributionPoints) > 0 && !c.hasExtension(ObjectIdentifier(oidExtensionCRLDistributionPoints)) {
+		c.DistributionPoints.Set(cert)
+	}
+	if len(c.FreshestCRL) > 0 && !c.hasExtension(ObjectIdentifier(oidExtensionFreshestCRL)) {
+		c.FreshestCRL.Set(cert)
+	}
+	if len(c.CertificatePolicies) > 0 && !c.hasExtension(ObjectIdentifier(oidExtensionCertificatePolicies)) {
+		c.CertificatePolicies.Set(cert)
+	}
+	if len(c.PolicyMappings) > 0 && !c.hasExtension(ObjectIdentifier(oidExtensionPolicyMappings)) {
+		c.PolicyMappings.Set(cert)
+	}
+	if c.PolicyConstraints != nil && !c.hasExtension(ObjectIdentifier(oidExtensionPolicyConstraints)) {
+		c.PolicyConstraints.Set(cert)
+	}
+	if c.InhibitAnyPolicy != nil && !c.hasExtension(ObjectIdentifier(oidExtensionInhibitAnyPolicy)) {
+		c.InhibitAnyPolicy.Set(cert)
+	}
+
 	if c.BasicConstraints != nil {
 		c.BasicConstraints.Set(cert)
 	}
@@ -187,7 +433,11 @@ func (c *Certificate) GetCertificate() *x509.Certificate {
 //
 // See also https://datatracker.ietf.org/doc/html/rfc5280.html#section-4.2.1.6
 func (c *Certificate) hasExtendedSANs() bool {
-	for _, san := range c.SANs {
+	return hasExtendedSANs(c.SANs)
+}
+
+func hasExtendedSANs(sans []SubjectAlternativeName) bool {
+	for _, san := range sans {
 		if !(san.Type == DNSType || san.Type == EmailType || san.Type == IPType || san.Type == URIType || san.Type == AutoType || san.Type == "") {
 			return true
 		}
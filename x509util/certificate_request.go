@@ -318,12 +318,7 @@ func (c *CertificateRequest) GetLeafCertificate() *Certificate {
 //
 // See also https://datatracker.ietf.org/doc/html/rfc5280.html#section-4.2.1.6
 func (c *CertificateRequest) hasExtendedSANs() bool {
-	for _, san := range c.SANs {
-		if !(san.Type == DNSType || san.Type == EmailType || san.Type == IPType || san.Type == URIType || san.Type == AutoType || san.Type == "") {
-			return true
-		}
-	}
-	return false
+	return hasExtendedSANs(c.SANs)
 }
 
 // hasExtension returns true if the given extension oid is in the certificate.
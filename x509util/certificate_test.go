@@ -10,6 +10,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"io"
@@ -1024,3 +1025,191 @@ func TestCreateCertificate_debug(t *testing.T) {
 		})
 	}
 }
+
+func TestCertificateFromX509(t *testing.T) {
+	iss, issPriv := createIssuerCertificate(t, "issuer")
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	sanExtension, err := createSubjectAltNameExtension([]string{"foo.com"}, nil, nil, nil, []SubjectAlternativeName{
+		{Type: EmailType, Value: "jane@doe.com"},
+		{Type: PermanentIdentifierType, Value: "123456789"},
+		{Type: HardwareModuleNameType, ASN1Value: []byte(`{"type":"1.2.3.4","serialNumber":"MTIzNDU2Nzg5"}`)},
+		{Type: UserPrincipalNameType, Value: "jane@doe.com"},
+		{Type: DirectoryNameType, ASN1Value: []byte(`{"country":"US","organization":"Smallstep","commonName":"Jane"}`)},
+		{Type: RegisteredIDType, Value: "1.2.3.4.5"},
+		{Type: "1.2.3.4", Value: "utf8:foo"},
+		{Type: "1.2.3.5", Value: "int:123"},
+		{Type: IPType, Value: "127.0.0.1"},
+		{Type: URIType, Value: "urn:uuid:2bbe86fc-a35e-4c68-a5cb-cb1060f57629"},
+	}, false)
+	require.NoError(t, err)
+
+	utf8Subject, err := asn1.Marshal(pkix.RDNSequence{{{
+		Type:  asn1.ObjectIdentifier{2, 5, 4, 3},
+		Value: asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte("Jane")},
+	}}})
+	require.NoError(t, err)
+
+	nonCriticalKeyUsage, err := asn1.Marshal(asn1.BitString{Bytes: []byte{0x80}, BitLength: 1})
+	require.NoError(t, err)
+
+	_, ipNet, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	mustCreate := func(t *testing.T, template *x509.Certificate) *x509.Certificate {
+		t.Helper()
+		template.SubjectKeyId, err = generateSubjectKeyID(pub)
+		require.NoError(t, err)
+		cert, err := CreateCertificate(template, iss, pub, issPriv)
+		require.NoError(t, err)
+		return cert
+	}
+
+	now := time.Now().Truncate(time.Second)
+	leaf := mustCreate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "foo.com", Organization: []string{"Smallstep"}},
+		NotBefore:             now,
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		UnknownExtKeyUsage:    []asn1.ObjectIdentifier{{1, 2, 3, 4}},
+		BasicConstraintsValid: true,
+		OCSPServer:            []string{"https://ocsp.smallstep.com"},
+		IssuingCertificateURL: []string{"https://ca.smallstep.com/ca.crt"},
+		CRLDistributionPoints: []string{"https://ca.smallstep.com/ca.crl"},
+		PolicyIdentifiers:     []asn1.ObjectIdentifier{{1, 2, 3, 4}, {2, 23, 140, 1, 2, 1}},
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier(sanExtension.ID), Critical: sanExtension.Critical, Value: sanExtension.Value},
+			{Id: asn1.ObjectIdentifier{1, 2, 3, 4, 5}, Critical: true, Value: []byte{0x05, 0x00}},
+		},
+	})
+	intermediate := mustCreate(t, &x509.Certificate{
+		RawSubject:                  utf8Subject,
+		NotBefore:                   now,
+		NotAfter:                    now.Add(time.Hour),
+		KeyUsage:                    x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid:       true,
+		IsCA:                        true,
+		MaxPathLen:                  0,
+		MaxPathLenZero:              true,
+		PermittedDNSDomainsCritical: true,
+		PermittedDNSDomains:         []string{"smallstep.com"},
+		ExcludedIPRanges:            []*net.IPNet{ipNet},
+		PermittedEmailAddresses:     []string{"smallstep.com"},
+		PermittedURIDomains:         []string{".smallstep.com"},
+	})
+	nonCritical := mustCreate(t, &x509.Certificate{
+		Subject:   pkix.Name{},
+		NotBefore: now,
+		NotAfter:  now.Add(time.Hour),
+		DNSNames:  []string{"foo.com"},
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier(oidExtensionKeyUsage), Critical: false, Value: nonCriticalKeyUsage},
+		},
+	})
+
+	requireExplicitPolicy := 0
+	policiesExtension, err := CertificatePolicies{
+		{ID: ObjectIdentifier{2, 23, 140, 1, 2, 1}, Qualifiers: []PolicyQualifier{
+			{CPS: "https://smallstep.com/cps"},
+			{UserNotice: &UserNotice{Organization: "Smallstep", NoticeNumbers: []int{1, 2}, ExplicitText: "Test policy"}},
+		}},
+	}.extension(nil)
+	require.NoError(t, err)
+	mappingsExtension, err := PolicyMappings{
+		{IssuerDomainPolicy: ObjectIdentifier{1, 2, 3, 4}, SubjectDomainPolicy: ObjectIdentifier{2, 23, 140, 1, 2, 1}},
+	}.extension()
+	require.NoError(t, err)
+	constraintsExtension, err := PolicyConstraints{RequireExplicitPolicy: &requireExplicitPolicy}.extension()
+	require.NoError(t, err)
+	inhibitExtension, err := InhibitAnyPolicy(1).extension()
+	require.NoError(t, err)
+	policies := mustCreate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Policy CA"},
+		NotBefore:             now,
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		ExtraExtensions: []pkix.Extension{
+			policiesExtension, mappingsExtension, constraintsExtension, inhibitExtension,
+		},
+	})
+
+	distributionPoints, err := DistributionPoints{
+		{FullName: []SubjectAlternativeName{{Type: URIType, Value: "https://ca.smallstep.com/1.crl"}}, Reasons: ReasonFlags(1<<1 | 1<<2)},
+		{FullName: []SubjectAlternativeName{{Type: URIType, Value: "ldap://ldap.smallstep.com/cn=CRL2"}}, CRLIssuer: []SubjectAlternativeName{
+			{Type: DirectoryNameType, ASN1Value: []byte(`{"commonName":"issuer"}`)},
+		}},
+	}.marshal(nil)
+	require.NoError(t, err)
+	freshestCRL, err := DistributionPoints{
+		{FullName: []SubjectAlternativeName{{Type: URIType, Value: "https://ca.smallstep.com/delta.crl"}}},
+	}.marshal(nil)
+	require.NoError(t, err)
+	partitioned := mustCreate(t, &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "foo.com"},
+		NotBefore: now,
+		NotAfter:  now.Add(time.Hour),
+		DNSNames:  []string{"foo.com"},
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier(oidExtensionCRLDistributionPoints), Value: distributionPoints},
+			{Id: oidExtensionFreshestCRL, Value: freshestCRL},
+		},
+	})
+
+	sortedExtensions := func(exts []pkix.Extension) map[string]pkix.Extension {
+		m := make(map[string]pkix.Extension)
+		for _, e := range exts {
+			m[e.Id.String()] = e
+		}
+		return m
+	}
+
+	tests := []struct {
+		name           string
+		cert           *x509.Certificate
+		wantSANs       int
+		wantRawSubject bool
+		wantExtensions []string
+	}{
+		{"ok leaf", leaf, 11, false, []string{"1.2.3.4.5"}},
+		{"ok intermediate", intermediate, 0, true, nil},
+		{"ok non critical", nonCritical, 0, false, []string{"2.5.29.15"}},
+		{"ok policies", policies, 0, false, nil},
+		{"ok distribution points", partitioned, 0, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := CertificateFromX509(tt.cert)
+			require.NoError(t, err)
+
+			assert.Len(t, c.SANs, tt.wantSANs)
+			assert.Equal(t, tt.wantRawSubject, c.RawSubject != nil)
+			var extensions []string
+			for _, e := range c.Extensions {
+				extensions = append(extensions, asn1.ObjectIdentifier(e.ID).String())
+			}
+			assert.Equal(t, tt.wantExtensions, extensions)
+
+			// Generate a new certificate using the JSON as a template.
+			b, err := json.Marshal(c)
+			require.NoError(t, err)
+			csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, priv)
+			require.NoError(t, err)
+			cr, err := x509.ParseCertificateRequest(csr)
+			require.NoError(t, err)
+			cert, err := NewCertificate(cr, WithTemplate(string(b), TemplateData{}))
+			require.NoError(t, err)
+			got, err := CreateCertificate(cert.GetCertificate(), iss, pub, issPriv)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.cert.RawSubject, got.RawSubject)
+			assert.Equal(t, tt.cert.SerialNumber, got.SerialNumber)
+			assert.Equal(t, tt.cert.NotBefore, got.NotBefore)
+			assert.Equal(t, tt.cert.NotAfter, got.NotAfter)
+			assert.Equal(t, sortedExtensions(tt.cert.Extensions), sortedExtensions(got.Extensions))
+		})
+	}
+}
@@ -0,0 +1,440 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+var oidExtensionFreshestCRL = asn1.ObjectIdentifier{2, 5, 29, 46}
+
+// Names used for the reason flags in a distribution point.
+const (
+	ReasonFlagKeyCompromise        = "keyCompromise"
+	ReasonFlagCACompromise         = "cACompromise"
+	ReasonFlagAffiliationChanged   = "affiliationChanged"
+	ReasonFlagSuperseded           = "superseded"
+	ReasonFlagCessationOfOperation = "cessationOfOperation"
+	ReasonFlagCertificateHold      = "certificateHold"
+	ReasonFlagPrivilegeWithdrawn   = "privilegeWithdrawn"
+	ReasonFlagAACompromise         = "aACompromise"
+)
+
+// reasonFlagNames contains the names of the reason flags indexed by their bit
+// position, the bit 0 is unused.
+var reasonFlagNames = []string{
+	"",
+	ReasonFlagKeyCompromise,
+	ReasonFlagCACompromise,
+	ReasonFlagAffiliationChanged,
+	ReasonFlagSuperseded,
+	ReasonFlagCessationOfOperation,
+	ReasonFlagCertificateHold,
+	ReasonFlagPrivilegeWithdrawn,
+	ReasonFlagAACompromise,
+}
+
+// DistributionPoints represents the list of distribution points encoded in the
+// CRL distribution points or the freshest CRL extensions. In the CRL
+// distribution points extension, the URLs in CRLDistributionPoints that are not
+// in this list will be added as distribution points with just a full name.
+type DistributionPoints []DistributionPoint
+
+// DistributionPoint mirrors the ASN.1 structure DistributionPoint in RFC 5280,
+// Section 4.2.1.13. Only one of FullName or RelativeName can be set, and a
+// distribution point requires a name or a CRLIssuer. In JSON, a distribution
+// point can also be represented with just a URL.
+//
+// Note that the Go standard library fails to parse certificates with a
+// distribution point using a RelativeName.
+type DistributionPoint struct {
+	FullName     []SubjectAlternativeName `json:"fullName,omitempty"`
+	RelativeName []DistinguishedName      `json:"relativeName,omitempty"`
+	Reasons      ReasonFlags              `json:"reasons,omitempty"`
+	CRLIssuer    []SubjectAlternativeName `json:"crlIssuer,omitempty"`
+}
+
+// ReasonFlags represents the reasons covered by a distribution point. Each
+// reason is represented by the bit with the position defined in RFC 5280.
+type ReasonFlags uint16
+
+type asn1DistributionPoint struct {
+	DistributionPoint asn1.RawValue  `asn1:"optional,tag:0"`
+	Reasons           asn1.BitString `asn1:"optional,tag:1"`
+	CRLIssuer         asn1.RawValue  `asn1:"optional,tag:2"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface in
+// DistributionPoints.
+func (d *DistributionPoints) UnmarshalJSON(data []byte) error {
+	var v []DistributionPoint
+	if err := json.Unmarshal(data, &v); err != nil {
+		return errors.Wrap(err, "error unmarshaling json")
+	}
+	for _, dp := range v {
+		if _, err := dp.asn1Value(); err != nil {
+			return err
+		}
+	}
+	*d = v
+	return nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface in DistributionPoint
+// and accepts a string with the URL of the CRL or the object representation.
+func (d *DistributionPoint) UnmarshalJSON(data []byte) error {
+	if s, err := unmarshalString(data); err == nil {
+		if s == "" {
+			return errors.New("error unmarshaling json: distribution point cannot be empty")
+		}
+		*d = DistributionPoint{
+			FullName: []SubjectAlternativeName{{Type: URIType, Value: s}},
+		}
+		return nil
+	}
+
+	type distributionPoint DistributionPoint
+	var v distributionPoint
+	if err := json.Unmarshal(data, &v); err != nil {
+		return errors.Wrap(err, "error unmarshaling json")
+	}
+	*d = DistributionPoint(v)
+	return nil
+}
+
+// Set sets the CRL distribution points extension in the given certificate.
+// The URLs already present in the certificate are added at the end of the
+// list.
+func (d DistributionPoints) Set(c *x509.Certificate) {
+	if b, err := d.marshal(c.CRLDistributionPoints); err == nil {
+		c.ExtraExtensions = append(c.ExtraExtensions, pkix.Extension{
+			Id:    oidExtensionCRLDistributionPoints,
+			Value: b,
+		})
+	}
+}
+
+// FreshestCRL represents the freshest CRL extension, it uses the same syntax
+// as the CRL distribution points extension and identifies how delta CRL
+// information is obtained.
+type FreshestCRL DistributionPoints
+
+// UnmarshalJSON implements the json.Unmarshaler interface in FreshestCRL.
+func (f *FreshestCRL) UnmarshalJSON(data []byte) error {
+	var v DistributionPoints
+	if err := v.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	*f = FreshestCRL(v)
+	return nil
+}
+
+// Set sets the freshest CRL extension in the given certificate.
+func (f FreshestCRL) Set(c *x509.Certificate) {
+	if b, err := DistributionPoints(f).marshal(nil); err == nil {
+		c.ExtraExtensions = append(c.ExtraExtensions, pkix.Extension{
+			Id:    oidExtensionFreshestCRL,
+			Value: b,
+		})
+	}
+}
+
+// marshal returns the DER encoding of the distribution points, the given URLs
+// not present as a full name in the list are appended to it.
+func (d DistributionPoints) marshal(urls []string) ([]byte, error) {
+	points := make([]asn1.RawValue, 0, len(d)+len(urls))
+	for _, dp := range d {
+		rv, err := dp.asn1Value()
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, rv)
+	}
+	for _, u := range urls {
+		if d.containsURI(u) {
+			continue
+		}
+		rv, err := DistributionPoint{
+			FullName: []SubjectAlternativeName{{Type: URIType, Value: u}},
+		}.asn1Value()
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, rv)
+	}
+	if len(points) == 0 {
+		return nil, errors.New("error creating distribution points: distribution points cannot be empty")
+	}
+	b, err := asn1.Marshal(points)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling distribution points")
+	}
+	return b, nil
+}
+
+func (d DistributionPoints) containsURI(u string) bool {
+	for _, dp := range d {
+		for _, san := range dp.FullName {
+			if san.Type == URIType && san.Value == u {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isURIOnly returns true if all the distribution points contain only a full
+// name with URIs. These distribution points can be represented using
+// CRLDistributionPoints.
+func (d DistributionPoints) isURIOnly() bool {
+	for _, dp := range d {
+		if len(dp.FullName) == 0 || len(dp.RelativeName) > 0 || dp.Reasons != 0 || len(dp.CRLIssuer) > 0 {
+			return false
+		}
+		for _, san := range dp.FullName {
+			if san.Type != URIType {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (d DistributionPoint) asn1Value() (asn1.RawValue, error) {
+	var zero asn1.RawValue
+	var elems [][]byte
+
+	switch {
+	case len(d.FullName) > 0 && len(d.RelativeName) > 0:
+		return zero, errors.New("error creating distribution point: fullName and relativeName cannot be used at the same time")
+	case len(d.FullName) == 0 && len(d.RelativeName) == 0 && len(d.CRLIssuer) == 0:
+		return zero, errors.New("error creating distribution point: fullName, relativeName or crlIssuer are required")
+	case len(d.FullName) > 0:
+		b, err := marshalGeneralNames(d.FullName, 0)
+		if err != nil {
+			return zero, errors.Wrap(err, "error creating distribution point fullName")
+		}
+		if b, err = marshalContextSpecific(0, b); err != nil {
+			return zero, err
+		}
+		elems = append(elems, b)
+	case len(d.RelativeName) > 0:
+		b, err := asn1.Marshal(pkix.RelativeDistinguishedNameSET(fromDistinguishedNames(d.RelativeName)))
+		if err != nil {
+			return zero, errors.Wrap(err, "error marshaling distribution point relativeName")
+		}
+		// Replace the SET tag with the context-specific tag [1].
+		b[0] = asn1.ClassContextSpecific<<6 | 0x20 | 1
+		if b, err = marshalContextSpecific(0, b); err != nil {
+			return zero, err
+		}
+		elems = append(elems, b)
+	}
+
+	if d.Reasons != 0 {
+		b, err := asn1.MarshalWithParams(d.Reasons.bitString(), "tag:1")
+		if err != nil {
+			return zero, errors.Wrap(err, "error marshaling distribution point reasons")
+		}
+		elems = append(elems, b)
+	}
+
+	if len(d.CRLIssuer) > 0 {
+		b, err := marshalGeneralNames(d.CRLIssuer, 2)
+		if err != nil {
+			return zero, errors.Wrap(err, "error creating distribution point crlIssuer")
+		}
+		elems = append(elems, b)
+	}
+
+	return asn1.RawValue{
+		Class:      asn1.ClassUniversal,
+		Tag:        asn1.TagSequence,
+		IsCompound: true,
+		Bytes:      bytes.Join(elems, nil),
+	}, nil
+}
+
+// marshalGeneralNames encodes the given names as GeneralNames with the given
+// context-specific tag.
+func marshalGeneralNames(sans []SubjectAlternativeName, tag int) ([]byte, error) {
+	var names [][]byte
+	for _, san := range sans {
+		rv, err := san.RawValue()
+		if err != nil {
+			return nil, err
+		}
+		b, err := asn1.Marshal(rv)
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling general name")
+		}
+		names = append(names, b)
+	}
+	return marshalContextSpecific(tag, bytes.Join(names, nil))
+}
+
+// marshalContextSpecific returns the given bytes wrapped in a constructed
+// context-specific tag.
+func marshalContextSpecific(tag int, b []byte) ([]byte, error) {
+	b, err := asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        tag,
+		IsCompound: true,
+		Bytes:      b,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling context-specific value")
+	}
+	return b, nil
+}
+
+// parseDistributionPoints parses the value of a CRL distribution points or a
+// freshest CRL extension.
+func parseDistributionPoints(der []byte) (DistributionPoints, error) {
+	var points []asn1DistributionPoint
+	if rest, err := asn1.Unmarshal(der, &points); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling distribution points")
+	} else if len(rest) > 0 {
+		return nil, errors.New("error unmarshaling distribution points: trailing data")
+	}
+
+	ret := make(DistributionPoints, len(points))
+	for i, p := range points {
+		if len(p.DistributionPoint.Bytes) > 0 {
+			var name asn1.RawValue
+			if _, err := asn1.Unmarshal(p.DistributionPoint.Bytes, &name); err != nil {
+				return nil, errors.Wrap(err, "error unmarshaling distribution point name")
+			}
+			switch {
+			case name.Class == asn1.ClassContextSpecific && name.Tag == 0:
+				sans, err := parseGeneralNames(name.Bytes)
+				if err != nil {
+					return nil, errors.Wrap(err, "error parsing distribution point fullName")
+				}
+				ret[i].FullName = sans
+			case name.Class == asn1.ClassContextSpecific && name.Tag == 1:
+				b, err := asn1.Marshal(asn1.RawValue{
+					Class:      asn1.ClassUniversal,
+					Tag:        asn1.TagSet,
+					IsCompound: true,
+					Bytes:      name.Bytes,
+				})
+				if err != nil {
+					return nil, errors.Wrap(err, "error marshaling distribution point relativeName")
+				}
+				var rdn pkix.RelativeDistinguishedNameSET
+				if _, err := asn1.Unmarshal(b, &rdn); err != nil {
+					return nil, errors.Wrap(err, "error unmarshaling distribution point relativeName")
+				}
+				for _, atv := range rdn {
+					ret[i].RelativeName = append(ret[i].RelativeName, DistinguishedName{
+						Type:  ObjectIdentifier(atv.Type),
+						Value: atv.Value,
+					})
+				}
+			default:
+				return nil, fmt.Errorf("error parsing distribution point: unsupported name tag %d", name.Tag)
+			}
+		}
+		ret[i].Reasons = newReasonFlags(p.Reasons)
+		if len(p.CRLIssuer.Bytes) > 0 {
+			sans, err := parseGeneralNames(p.CRLIssuer.Bytes)
+			if err != nil {
+				return nil, errors.Wrap(err, "error parsing distribution point crlIssuer")
+			}
+			ret[i].CRLIssuer = sans
+		}
+	}
+	return ret, nil
+}
+
+// parseGeneralNames parses the contents of a GeneralNames sequence.
+func parseGeneralNames(b []byte) ([]SubjectAlternativeName, error) {
+	der, err := asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassUniversal,
+		Tag:        asn1.TagSequence,
+		IsCompound: true,
+		Bytes:      b,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ParseSubjectAlternativeNameExtension(der)
+}
+
+func newReasonFlags(bs asn1.BitString) ReasonFlags {
+	var r ReasonFlags
+	for i := 1; i < len(reasonFlagNames); i++ {
+		if bs.At(i) == 1 {
+			r |= 1 << i
+		}
+	}
+	return r
+}
+
+// bitString returns the reason flags as an ASN.1 bit string without trailing
+// zeros.
+func (r ReasonFlags) bitString() asn1.BitString {
+	var bs asn1.BitString
+	for i := 1; i < len(reasonFlagNames); i++ {
+		if r&(1<<i) != 0 {
+			bs.BitLength = i + 1
+		}
+	}
+	bs.Bytes = make([]byte, (bs.BitLength+7)/8)
+	for i := 1; i < bs.BitLength; i++ {
+		if r&(1<<i) != 0 {
+			bs.Bytes[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return bs
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface and converts a
+// string or a list of strings into reason flags.
+func (r *ReasonFlags) UnmarshalJSON(data []byte) error {
+	ms, err := unmarshalMultiString(data)
+	if err != nil {
+		return err
+	}
+
+	*r = 0
+
+	for _, s := range ms {
+		var found bool
+		for i := 1; i < len(reasonFlagNames); i++ {
+			if convertName(s) == convertName(reasonFlagNames[i]) {
+				*r |= 1 << i
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Errorf("unsupported reason flag %s", s)
+		}
+	}
+
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface and converts reason
+// flags into a list of strings.
+func (r ReasonFlags) MarshalJSON() ([]byte, error) {
+	var reasons []string
+	for i := 1; i < len(reasonFlagNames); i++ {
+		if r&(1<<i) != 0 {
+			reasons = append(reasons, reasonFlagNames[i])
+		}
+	}
+
+	if len(reasons) == 0 && r != 0 {
+		return nil, fmt.Errorf("cannot marshal reason flags %v", uint16(r))
+	}
+
+	return json.Marshal(reasons)
+}
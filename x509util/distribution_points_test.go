@@ -0,0 +1,230 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDistributionPoints_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    DistributionPoints
+		wantErr bool
+	}{
+		{"ok", `[{"fullName":[{"type":"uri","value":"https://ca.smallstep.com/1.crl"}],"reasons":["keyCompromise","cACompromise"],"crlIssuer":[{"type":"dn","asn1Value":{"commonName":"Issuer"}}]}]`, DistributionPoints{
+			{
+				FullName:  []SubjectAlternativeName{{Type: URIType, Value: "https://ca.smallstep.com/1.crl"}},
+				Reasons:   ReasonFlags(1<<1 | 1<<2),
+				CRLIssuer: []SubjectAlternativeName{{Type: DirectoryNameType, ASN1Value: []byte(`{"commonName":"Issuer"}`)}},
+			},
+		}, false},
+		{"ok string", `["https://ca.smallstep.com/ca.crl"]`, DistributionPoints{
+			{FullName: []SubjectAlternativeName{{Type: URIType, Value: "https://ca.smallstep.com/ca.crl"}}},
+		}, false},
+		{"ok relativeName", `[{"relativeName":[{"type":"2.5.4.3","value":"CRL1"}],"reasons":"superseded"}]`, DistributionPoints{
+			{
+				RelativeName: []DistinguishedName{{Type: ObjectIdentifier{2, 5, 4, 3}, Value: "CRL1"}},
+				Reasons:      ReasonFlags(1 << 4),
+			},
+		}, false},
+		{"ok crlIssuer", `[{"crlIssuer":[{"type":"uri","value":"https://ca.smallstep.com"}]}]`, DistributionPoints{
+			{CRLIssuer: []SubjectAlternativeName{{Type: URIType, Value: "https://ca.smallstep.com"}}},
+		}, false},
+		{"ok null", `null`, nil, false},
+		{"fail empty", `[{}]`, nil, true},
+		{"fail empty string", `[""]`, nil, true},
+		{"fail both names", `[{"fullName":[{"type":"uri","value":"https://ca.smallstep.com/ca.crl"}],"relativeName":[{"type":"2.5.4.3","value":"CRL1"}]}]`, nil, true},
+		{"fail reasons", `[{"fullName":[{"type":"uri","value":"https://ca.smallstep.com/ca.crl"}],"reasons":["unused"]}]`, nil, true},
+		{"fail fullName", `[{"fullName":[{"type":"ip","value":"foo"}]}]`, nil, true},
+		{"fail json", `{"fullName":[]}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got DistributionPoints
+			err := json.Unmarshal([]byte(tt.data), &got)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDistributionPoints_Set(t *testing.T) {
+	cert := &x509.Certificate{
+		CRLDistributionPoints: []string{"https://ca.smallstep.com/1.crl", "https://ca.smallstep.com/2.crl"},
+	}
+	DistributionPoints{
+		{
+			FullName: []SubjectAlternativeName{{Type: URIType, Value: "https://ca.smallstep.com/1.crl"}},
+			Reasons:  ReasonFlags(1 << 1),
+		},
+	}.Set(cert)
+	require.Len(t, cert.ExtraExtensions, 1)
+	assert.Equal(t, oidExtensionCRLDistributionPoints, cert.ExtraExtensions[0].Id)
+	assert.False(t, cert.ExtraExtensions[0].Critical)
+
+	got, err := parseDistributionPoints(cert.ExtraExtensions[0].Value)
+	require.NoError(t, err)
+	assert.Equal(t, DistributionPoints{
+		{
+			FullName: []SubjectAlternativeName{{Type: URIType, Value: "https://ca.smallstep.com/1.crl"}},
+			Reasons:  ReasonFlags(1 << 1),
+		},
+		{FullName: []SubjectAlternativeName{{Type: URIType, Value: "https://ca.smallstep.com/2.crl"}}},
+	}, got)
+
+	// The encoding of URLs matches the one in the Go standard library.
+	iss, signer := createIssuerCertificate(t, "issuer")
+	crt, err := CreateCertificate(&x509.Certificate{
+		CRLDistributionPoints: []string{"https://ca.smallstep.com/ca.crl"},
+	}, iss, signer.Public(), signer)
+	require.NoError(t, err)
+	want := crt.Extensions
+	cert = &x509.Certificate{}
+	DistributionPoints{
+		{FullName: []SubjectAlternativeName{{Type: URIType, Value: "https://ca.smallstep.com/ca.crl"}}},
+	}.Set(cert)
+	require.Len(t, cert.ExtraExtensions, 1)
+	for _, ext := range want {
+		if ext.Id.Equal(oidExtensionCRLDistributionPoints) {
+			assert.Equal(t, ext.Value, cert.ExtraExtensions[0].Value)
+		}
+	}
+
+	// Invalid distribution points are ignored.
+	cert = &x509.Certificate{}
+	DistributionPoints{{}}.Set(cert)
+	assert.Empty(t, cert.ExtraExtensions)
+}
+
+func TestFreshestCRL(t *testing.T) {
+	var got FreshestCRL
+	require.NoError(t, json.Unmarshal([]byte(`["https://ca.smallstep.com/delta.crl"]`), &got))
+	assert.Equal(t, FreshestCRL{
+		{FullName: []SubjectAlternativeName{{Type: URIType, Value: "https://ca.smallstep.com/delta.crl"}}},
+	}, got)
+
+	cert := &x509.Certificate{CRLDistributionPoints: []string{"https://ca.smallstep.com/ca.crl"}}
+	got.Set(cert)
+	require.Len(t, cert.ExtraExtensions, 1)
+	assert.Equal(t, oidExtensionFreshestCRL, cert.ExtraExtensions[0].Id)
+
+	parsed, err := parseDistributionPoints(cert.ExtraExtensions[0].Value)
+	require.NoError(t, err)
+	assert.Equal(t, DistributionPoints(got), parsed)
+
+	assert.Error(t, json.Unmarshal([]byte(`[{}]`), &got))
+}
+
+func Test_parseDistributionPoints(t *testing.T) {
+	points := DistributionPoints{
+		{
+			RelativeName: []DistinguishedName{{Type: ObjectIdentifier{2, 5, 4, 3}, Value: "CRL1"}},
+			Reasons:      ReasonFlags(1<<1 | 1<<8),
+			CRLIssuer: []SubjectAlternativeName{
+				{Type: DirectoryNameType, ASN1Value: []byte(`{"organization":["Smallstep"],"commonName":"Issuer"}`)},
+			},
+		},
+		{
+			FullName: []SubjectAlternativeName{
+				{Type: URIType, Value: "ldap://ldap.smallstep.com/cn=CRL2"},
+				{Type: DNSType, Value: "crl.smallstep.com"},
+			},
+		},
+	}
+	b, err := points.marshal(nil)
+	require.NoError(t, err)
+	got, err := parseDistributionPoints(b)
+	require.NoError(t, err)
+
+	// Directory names are normalized by the parser.
+	assert.Equal(t, points[0].RelativeName, got[0].RelativeName)
+	assert.Equal(t, points[0].Reasons, got[0].Reasons)
+	require.Len(t, got[0].CRLIssuer, 1)
+	assert.Equal(t, DirectoryNameType, got[0].CRLIssuer[0].Type)
+	assert.Equal(t, points[1], got[1])
+
+	b2, err := got.marshal(nil)
+	require.NoError(t, err)
+	assert.Equal(t, b, b2)
+
+	_, err = parseDistributionPoints([]byte{0x30})
+	assert.Error(t, err)
+	_, err = parseDistributionPoints(append(b, 0x00))
+	assert.Error(t, err)
+}
+
+func TestReasonFlags_bitString(t *testing.T) {
+	tests := []struct {
+		name string
+		r    ReasonFlags
+		want []byte
+	}{
+		{"keyCompromise", ReasonFlags(1 << 1), []byte{0x03, 0x02, 0x06, 0x40}},
+		{"keyCompromise cACompromise", ReasonFlags(1<<1 | 1<<2), []byte{0x03, 0x02, 0x05, 0x60}},
+		{"aACompromise", ReasonFlags(1 << 8), []byte{0x03, 0x03, 0x07, 0x00, 0x80}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := asn1.Marshal(tt.r.bitString())
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.r, newReasonFlags(tt.r.bitString()))
+		})
+	}
+}
+
+func TestReasonFlags_MarshalJSON(t *testing.T) {
+	b, err := json.Marshal(ReasonFlags(1<<1 | 1<<6))
+	require.NoError(t, err)
+	assert.Equal(t, `["keyCompromise","certificateHold"]`, string(b))
+
+	var r ReasonFlags
+	require.NoError(t, json.Unmarshal(b, &r))
+	assert.Equal(t, ReasonFlags(1<<1|1<<6), r)
+	require.NoError(t, json.Unmarshal([]byte(`"CESSATION_OF_OPERATION"`), &r))
+	assert.Equal(t, ReasonFlags(1<<5), r)
+
+	_, err = json.Marshal(ReasonFlags(1))
+	assert.Error(t, err)
+	assert.Error(t, json.Unmarshal([]byte(`["foo"]`), &r))
+	assert.Error(t, json.Unmarshal([]byte(`1`), &r))
+}
+
+func TestCertificate_GetCertificate_distributionPoints(t *testing.T) {
+	var c Certificate
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"crlDistributionPoints": ["https://ca.smallstep.com/ca.crl"],
+		"distributionPoints": [{"fullName": [{"type":"uri","value":"https://ca.smallstep.com/1.crl"}], "reasons": ["keyCompromise"]}],
+		"freshestCRL": ["https://ca.smallstep.com/delta.crl"]
+	}`), &c))
+
+	cert := c.GetCertificate()
+	assert.Equal(t, []string{"https://ca.smallstep.com/ca.crl"}, cert.CRLDistributionPoints)
+	require.Len(t, cert.ExtraExtensions, 2)
+	assert.Equal(t, oidExtensionCRLDistributionPoints, cert.ExtraExtensions[0].Id)
+	assert.Equal(t, oidExtensionFreshestCRL, cert.ExtraExtensions[1].Id)
+
+	points, err := parseDistributionPoints(cert.ExtraExtensions[0].Value)
+	require.NoError(t, err)
+	assert.Equal(t, DistributionPoints{
+		{FullName: []SubjectAlternativeName{{Type: URIType, Value: "https://ca.smallstep.com/1.crl"}}, Reasons: ReasonFlags(1 << 1)},
+		{FullName: []SubjectAlternativeName{{Type: URIType, Value: "https://ca.smallstep.com/ca.crl"}}},
+	}, points)
+
+	// Custom extensions take precedence.
+	c.Extensions = []Extension{{ID: ObjectIdentifier(oidExtensionFreshestCRL), Value: []byte{0x30, 0x00}}}
+	cert = c.GetCertificate()
+	require.Len(t, cert.ExtraExtensions, 2)
+	assert.Equal(t, pkix.Extension{Id: oidExtensionFreshestCRL, Value: []byte{0x30, 0x00}}, cert.ExtraExtensions[1])
+}
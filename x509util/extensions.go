@@ -83,6 +83,19 @@ const (
 	nameTypeRegisteredID  = 8
 )
 
+// Object identifiers of the extensions supported by the Go standard library.
+var (
+	oidExtensionSubjectKeyID          = asn1.ObjectIdentifier{2, 5, 29, 14}
+	oidExtensionKeyUsage              = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionBasicConstraints      = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidExtensionNameConstraints       = asn1.ObjectIdentifier{2, 5, 29, 30}
+	oidExtensionCRLDistributionPoints = asn1.ObjectIdentifier{2, 5, 29, 31}
+	oidExtensionCertificatePolicies   = asn1.ObjectIdentifier{2, 5, 29, 32}
+	oidExtensionAuthorityKeyID        = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidExtensionExtendedKeyUsage      = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidExtensionAuthorityInfoAccess   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 1}
+)
+
 // sanTypeSeparator is used to set the type of otherName SANs. The format string
 // is "[type:]value", printable will be used as default type if none is
 // provided.
@@ -1009,13 +1022,14 @@ func (s *SerialNumber) UnmarshalJSON(data []byte) error {
 		return nil
 	}
 
-	// Assume a number.
-	var i int64
-	if err := json.Unmarshal(data, &i); err != nil {
+	// Assume a number, big.Int accepts numbers larger than an int64, like the
+	// ones generated by MarshalJSON.
+	b := new(big.Int)
+	if err := b.UnmarshalJSON(data); err != nil {
 		return errors.Wrap(err, "error unmarshaling json")
 	}
 	*s = SerialNumber{
-		Int: new(big.Int).SetInt64(i),
+		Int: b,
 	}
 	return nil
 }
@@ -1230,6 +1244,135 @@ func parseSubjectAltName(ext pkix.Extension) (dirNames []pkix.Name, otherNames [
 	return
 }
 
+// ParseSubjectAlternativeNameExtension parses the value of a subjectAltName
+// extension and returns the list of SubjectAlternativeName in the same order,
+// the returned names can be used to generate the same extension. X400Address
+// and EDIPartyName types are not supported.
+func ParseSubjectAlternativeNameExtension(der []byte) ([]SubjectAlternativeName, error) {
+	var sans []SubjectAlternativeName
+	err := forEachSAN(der, func(generalName asn1.RawValue) error {
+		if generalName.Class != asn1.ClassContextSpecific {
+			return errors.New("unsupported general name class")
+		}
+		switch generalName.Tag {
+		case nameTypeOtherName:
+			san, err := parseOtherName(generalName.FullBytes)
+			if err != nil {
+				return err
+			}
+			sans = append(sans, san)
+		case nameTypeEmail:
+			sans = append(sans, SubjectAlternativeName{Type: EmailType, Value: string(generalName.Bytes)})
+		case nameTypeDNS:
+			sans = append(sans, SubjectAlternativeName{Type: DNSType, Value: string(generalName.Bytes)})
+		case nameTypeDirectoryName:
+			var rdns pkix.RDNSequence
+			if rest, err := asn1.Unmarshal(generalName.Bytes, &rdns); err != nil {
+				return fmt.Errorf("failed unmarshaling directoryName: %w", err)
+			} else if len(rest) > 0 {
+				return errors.New("failed unmarshaling directoryName: trailing data")
+			}
+			var dirName pkix.Name
+			dirName.FillFromRDNSequence(&rdns)
+			b, err := json.Marshal(newName(dirName))
+			if err != nil {
+				return fmt.Errorf("failed marshaling directoryName: %w", err)
+			}
+			sans = append(sans, SubjectAlternativeName{Type: DirectoryNameType, ASN1Value: b})
+		case nameTypeURI:
+			sans = append(sans, SubjectAlternativeName{Type: URIType, Value: string(generalName.Bytes)})
+		case nameTypeIP:
+			if len(generalName.Bytes) != net.IPv4len && len(generalName.Bytes) != net.IPv6len {
+				return errors.New("failed parsing ip: invalid length")
+			}
+			sans = append(sans, SubjectAlternativeName{Type: IPType, Value: net.IP(generalName.Bytes).String()})
+		case nameTypeRegisteredID:
+			var oid asn1.ObjectIdentifier
+			if _, err := asn1.UnmarshalWithParams(generalName.FullBytes, &oid, "tag:8"); err != nil {
+				return fmt.Errorf("failed unmarshaling registeredID: %w", err)
+			}
+			sans = append(sans, SubjectAlternativeName{Type: RegisteredIDType, Value: oid.String()})
+		default:
+			return fmt.Errorf("unsupported general name tag %d", generalName.Tag)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sans, nil
+}
+
+// parseOtherName parses an otherName general name. PermanentIdentifier,
+// HardwareModuleName and UserPrincipalName are converted to the types
+// supported by SubjectAlternativeName, other types will use their OID as type
+// and a value prefixed with the ASN.1 type, or the base64 raw value if the type
+// is not a supported string.
+func parseOtherName(der []byte) (SubjectAlternativeName, error) {
+	var zero SubjectAlternativeName
+
+	var on otherName
+	if _, err := asn1.UnmarshalWithParams(der, &on, "tag:0"); err != nil {
+		return zero, fmt.Errorf("failed unmarshaling otherName: %w", err)
+	}
+
+	switch {
+	case on.TypeID.Equal(oidPermanentIdentifier):
+		v, err := parsePermanentIdentifier(on.Value.FullBytes)
+		if err != nil {
+			return zero, fmt.Errorf("failed parsing PermanentIdentifier: %w", err)
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return zero, fmt.Errorf("failed marshaling PermanentIdentifier: %w", err)
+		}
+		return SubjectAlternativeName{Type: PermanentIdentifierType, ASN1Value: b}, nil
+	case on.TypeID.Equal(oidHardwareModuleNameIdentifier):
+		v, err := parseHardwareModuleName(on.Value.FullBytes)
+		if err != nil {
+			return zero, fmt.Errorf("failed parsing HardwareModuleName: %w", err)
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return zero, fmt.Errorf("failed marshaling HardwareModuleName: %w", err)
+		}
+		return SubjectAlternativeName{Type: HardwareModuleNameType, ASN1Value: b}, nil
+	}
+
+	var value asn1.RawValue
+	if _, err := asn1.Unmarshal(on.Value.Bytes, &value); err != nil {
+		return zero, fmt.Errorf("failed unmarshaling otherName value: %w", err)
+	}
+
+	if on.TypeID.Equal(oidUserPrincipalName) && value.Class == asn1.ClassUniversal && value.Tag == asn1.TagUTF8String {
+		return SubjectAlternativeName{Type: UserPrincipalNameType, Value: string(value.Bytes)}, nil
+	}
+
+	var prefix string
+	if value.Class == asn1.ClassUniversal {
+		switch value.Tag {
+		case asn1.TagUTF8String:
+			prefix = "utf8"
+		case asn1.TagIA5String:
+			prefix = "ia5"
+		case asn1.TagPrintableString:
+			prefix = "printable"
+		case asn1.TagNumericString:
+			prefix = "numeric"
+		}
+	}
+	if prefix == "" {
+		return SubjectAlternativeName{
+			Type:  on.TypeID.String(),
+			Value: "raw" + sanTypeSeparator + base64.StdEncoding.EncodeToString(on.Value.FullBytes),
+		}, nil
+	}
+	return SubjectAlternativeName{
+		Type:  on.TypeID.String(),
+		Value: prefix + sanTypeSeparator + string(value.Bytes),
+	}, nil
+}
+
 func parsePermanentIdentifier(der []byte) (PermanentIdentifier, error) {
 	var permID asn1PermanentIdentifier
 	if _, err := asn1.UnmarshalWithParams(der, &permID, "explicit,tag:0"); err != nil {
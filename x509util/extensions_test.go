@@ -1240,6 +1240,11 @@ func TestSerialNumber_UnmarshalJSON(t *testing.T) {
 		{"string", args{[]byte(`"12345"`)}, expected, false},
 		{"stringHex", args{[]byte(`"0x3039"`)}, expected, false},
 		{"number", args{[]byte(`12345`)}, expected, false},
+		{"bigNumber", args{[]byte(`265320449602904321456668534129402025361`)}, SerialNumber{func() *big.Int {
+			b, _ := new(big.Int).SetString("265320449602904321456668534129402025361", 10)
+			return b
+		}()}, false},
+		{"float", args{[]byte(`123.45`)}, SerialNumber{}, true},
 		{"badString", args{[]byte(`"123s"`)}, SerialNumber{}, true},
 		{"object", args{[]byte(`{}`)}, SerialNumber{}, true},
 		{"badJSON", args{[]byte(`{`)}, SerialNumber{}, true},
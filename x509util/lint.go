@@ -0,0 +1,641 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LintSeverity is the severity of a lint result.
+type LintSeverity int
+
+// Severities supported by the linter. A result with LintSeverityError severity
+// makes the certificate invalid.
+const (
+	LintSeverityNotice LintSeverity = iota + 1
+	LintSeverityWarning
+	LintSeverityError
+)
+
+// String returns a string representation of the severity.
+func (s LintSeverity) String() string {
+	switch s {
+	case LintSeverityNotice:
+		return "notice"
+	case LintSeverityWarning:
+		return "warning"
+	case LintSeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// LintProfile is the name of a set of lint rules.
+type LintProfile string
+
+// Profiles supported by the linter.
+const (
+	// LintProfileRFC5280 contains the rules derived from RFC 5280, this profile
+	// is the one used by default.
+	LintProfileRFC5280 LintProfile = "rfc5280"
+	// LintProfileCABFTLS contains the rules derived from the CA/Browser Forum
+	// Baseline Requirements for TLS server certificates.
+	LintProfileCABFTLS LintProfile = "cabf-tls-br"
+	// LintProfileMTLS contains the rules used for internal mutual TLS
+	// certificates.
+	LintProfileMTLS LintProfile = "mtls"
+)
+
+// LintRule is a check run against a certificate. The Check function returns
+// nil if the certificate passes the check, or an error describing the
+// problem. A rule without profiles will be run in all profiles.
+//
+// The certificate passed to Check can be a template that has not been signed
+// yet, in that case the Raw field is empty, the extensions generated by the
+// standard library are not present, and the fields that CreateCertificate
+// fills in, like the serial number or the subject key identifier, might be
+// empty.
+type LintRule struct {
+	Name        string
+	Description string
+	Severity    LintSeverity
+	Profiles    []LintProfile
+	Check       func(cert *x509.Certificate) error
+}
+
+func (r *LintRule) inProfile(profiles []LintProfile) bool {
+	if len(r.Profiles) == 0 {
+		return true
+	}
+	for _, p := range r.Profiles {
+		for _, pp := range profiles {
+			if p == pp {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LintResult is the result of a failed rule.
+type LintResult struct {
+	Rule     string       `json:"rule"`
+	Severity LintSeverity `json:"severity"`
+	Message  string       `json:"message"`
+}
+
+// String returns a string representation of the result.
+func (r LintResult) String() string {
+	return fmt.Sprintf("%s: %s: %s", r.Severity, r.Rule, r.Message)
+}
+
+// LintResults is the list of results returned by a linter.
+type LintResults []LintResult
+
+// HasErrors returns true if any of the results has the LintSeverityError
+// severity.
+func (r LintResults) HasErrors() bool {
+	for _, res := range r {
+		if res.Severity >= LintSeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns a *LintError with the results with LintSeverityError severity,
+// or nil if there are none.
+func (r LintResults) Err() error {
+	var errs LintResults
+	for _, res := range r {
+		if res.Severity >= LintSeverityError {
+			errs = append(errs, res)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &LintError{Results: errs}
+}
+
+// LintError is the error returned when a certificate fails one or more lint
+// rules with LintSeverityError severity.
+type LintError struct {
+	Results LintResults
+}
+
+// Error implements the error interface.
+func (e *LintError) Error() string {
+	msgs := make([]string, len(e.Results))
+	for i, r := range e.Results {
+		msgs[i] = r.Rule + ": " + r.Message
+	}
+	return "certificate lint failed: " + strings.Join(msgs, "; ")
+}
+
+var lintRegistry = struct {
+	sync.RWMutex
+	rules []LintRule
+}{}
+
+// RegisterLintRule adds a custom rule to the list of rules used by the
+// linters. It will fail if the rule is not valid or if a rule with the same
+// name already exists.
+func RegisterLintRule(rule LintRule) error {
+	switch {
+	case rule.Name == "":
+		return errors.New("error registering lint rule: name cannot be empty")
+	case rule.Check == nil:
+		return errors.Errorf("error registering lint rule %s: check cannot be nil", rule.Name)
+	case rule.Severity < LintSeverityNotice || rule.Severity > LintSeverityError:
+		return errors.Errorf("error registering lint rule %s: severity is not valid", rule.Name)
+	}
+
+	lintRegistry.Lock()
+	defer lintRegistry.Unlock()
+	for _, r := range lintRegistry.rules {
+		if r.Name == rule.Name {
+			return errors.Errorf("error registering lint rule %s: rule already exists", rule.Name)
+		}
+	}
+	lintRegistry.rules = append(lintRegistry.rules, rule)
+	return nil
+}
+
+// LintRules returns the list of built-in and registered rules.
+func LintRules() []LintRule {
+	lintRegistry.RLock()
+	defer lintRegistry.RUnlock()
+	rules := make([]LintRule, 0, len(defaultLintRules)+len(lintRegistry.rules))
+	rules = append(rules, defaultLintRules...)
+	return append(rules, lintRegistry.rules...)
+}
+
+// LintOption is the type used to modify the behavior of a Linter.
+type LintOption func(l *Linter)
+
+// WithLintProfiles sets the profiles to run. By default only the
+// LintProfileRFC5280 profile is used.
+func WithLintProfiles(profiles ...LintProfile) LintOption {
+	return func(l *Linter) {
+		l.profiles = profiles
+	}
+}
+
+// WithLintRules adds the given rules to the linter. These rules will be run
+// only by this linter.
+func WithLintRules(rules ...LintRule) LintOption {
+	return func(l *Linter) {
+		l.rules = append(l.rules, rules...)
+	}
+}
+
+// WithLintIgnore skips the rules with the given names.
+func WithLintIgnore(names ...string) LintOption {
+	return func(l *Linter) {
+		for _, name := range names {
+			l.ignore[name] = struct{}{}
+		}
+	}
+}
+
+// WithLintMinSeverity sets the minimum severity reported by the linter. By
+// default all results are reported.
+func WithLintMinSeverity(severity LintSeverity) LintOption {
+	return func(l *Linter) {
+		l.minSeverity = severity
+	}
+}
+
+// Linter runs a set of rules against a certificate.
+type Linter struct {
+	profiles    []LintProfile
+	rules       []LintRule
+	ignore      map[string]struct{}
+	minSeverity LintSeverity
+}
+
+// NewLinter creates a new linter with the given options.
+func NewLinter(opts ...LintOption) *Linter {
+	l := &Linter{
+		profiles: []LintProfile{LintProfileRFC5280},
+		ignore:   make(map[string]struct{}),
+	}
+	for _, fn := range opts {
+		fn(l)
+	}
+	return l
+}
+
+// Lint runs the linter rules against the given certificate. The certificate
+// can be a signed certificate or a template.
+func (l *Linter) Lint(cert *x509.Certificate) LintResults {
+	var results LintResults
+	for _, rule := range append(LintRules(), l.rules...) {
+		if _, ok := l.ignore[rule.Name]; ok {
+			continue
+		}
+		if rule.Severity < l.minSeverity || !rule.inProfile(l.profiles) {
+			continue
+		}
+		if err := rule.Check(cert); err != nil {
+			results = append(results, LintResult{
+				Rule:     rule.Name,
+				Severity: rule.Severity,
+				Message:  err.Error(),
+			})
+		}
+	}
+	return results
+}
+
+// LintCertificate runs the linter rules against the template representation
+// of the given certificate.
+func (l *Linter) LintCertificate(c *Certificate) LintResults {
+	return l.Lint(c.GetCertificate())
+}
+
+// Lint runs the rules in the given profiles against the x509.Certificate. The
+// certificate can be a signed certificate or a template.
+func Lint(cert *x509.Certificate, opts ...LintOption) LintResults {
+	return NewLinter(opts...).Lint(cert)
+}
+
+// LintCertificate runs the rules in the given profiles against the
+// Certificate before signing it.
+func LintCertificate(c *Certificate, opts ...LintOption) LintResults {
+	return NewLinter(opts...).LintCertificate(c)
+}
+
+// maxSubscriberValidity is the maximum validity of subscriber certificates
+// since 2020-09-01.
+const maxSubscriberValidity = 398 * 24 * time.Hour
+
+// maxMTLSValidity is the maximum recommended validity for internal mutual
+// TLS certificates.
+const maxMTLSValidity = 90 * 24 * time.Hour
+
+var defaultLintRules = []LintRule{
+	{
+		Name:        "rfc5280_serial_number_positive",
+		Description: "The serial number must be a positive integer.",
+		Severity:    LintSeverityError,
+		Profiles:    []LintProfile{LintProfileRFC5280, LintProfileCABFTLS, LintProfileMTLS},
+		Check: func(cert *x509.Certificate) error {
+			if cert.SerialNumber != nil && cert.SerialNumber.Sign() <= 0 {
+				return errors.Errorf("serial number %s is not positive", cert.SerialNumber)
+			}
+			return nil
+		},
+	},
+	{
+		Name:        "rfc5280_serial_number_too_long",
+		Description: "The serial number must not be longer than 20 octets.",
+		Severity:    LintSeverityError,
+		Profiles:    []LintProfile{LintProfileRFC5280, LintProfileCABFTLS, LintProfileMTLS},
+		Check: func(cert *x509.Certificate) error {
+			// A positive serial number with the most significant bit set
+			// requires an extra octet in DER.
+			if cert.SerialNumber != nil && cert.SerialNumber.BitLen() > 159 {
+				return errors.New("serial number is longer than 20 octets")
+			}
+			return nil
+		},
+	},
+	{
+		Name:        "rfc5280_validity_order",
+		Description: "The notAfter date must not be before the notBefore date.",
+		Severity:    LintSeverityError,
+		Profiles:    []LintProfile{LintProfileRFC5280, LintProfileCABFTLS, LintProfileMTLS},
+		Check: func(cert *x509.Certificate) error {
+			if !cert.NotBefore.IsZero() && !cert.NotAfter.IsZero() && cert.NotAfter.Before(cert.NotBefore) {
+				return errors.Errorf("notAfter %s is before notBefore %s", cert.NotAfter.Format(time.RFC3339), cert.NotBefore.Format(time.RFC3339))
+			}
+			return nil
+		},
+	},
+	{
+		Name:        "rfc5280_ca_subject_key_id_missing",
+		Description: "CA certificates must include the subject key identifier extension.",
+		Severity:    LintSeverityError,
+		Profiles:    []LintProfile{LintProfileRFC5280, LintProfileCABFTLS, LintProfileMTLS},
+		Check: func(cert *x509.Certificate) error {
+			// Templates get a subject key identifier in CreateCertificate.
+			if isCA(cert) && len(cert.Raw) > 0 && len(cert.SubjectKeyId) == 0 {
+				return errors.New("CA certificate does not have a subject key identifier")
+			}
+			return nil
+		},
+	},
+	{
+		Name:        "rfc5280_ca_key_usage_cert_sign",
+		Description: "CA certificates must assert the keyCertSign key usage.",
+		Severity:    LintSeverityError,
+		Profiles:    []LintProfile{LintProfileRFC5280, LintProfileCABFTLS, LintProfileMTLS},
+		Check: func(cert *x509.Certificate) error {
+			if isCA(cert) && cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+				return errors.New("CA certificate does not have the certSign key usage")
+			}
+			return nil
+		},
+	},
+	{
+		Name:        "rfc5280_cert_sign_without_ca",
+		Description: "The keyCertSign key usage must only be asserted in CA certificates.",
+		Severity:    LintSeverityError,
+		Profiles:    []LintProfile{LintProfileRFC5280, LintProfileCABFTLS, LintProfileMTLS},
+		Check: func(cert *x509.Certificate) error {
+			if !isCA(cert) && cert.KeyUsage&x509.KeyUsageCertSign != 0 {
+				return errors.New("certificate has the certSign key usage but it is not a CA")
+			}
+			return nil
+		},
+	},
+	{
+		Name:        "rfc5280_name_constraints_without_ca",
+		Description: "The name constraints extension must only be used in CA certificates.",
+		Severity:    LintSeverityError,
+		Profiles:    []LintProfile{LintProfileRFC5280, LintProfileCABFTLS, LintProfileMTLS},
+		Check: func(cert *x509.Certificate) error {
+			if !isCA(cert) && hasNameConstraints(cert) {
+				return errors.New("certificate has name constraints but it is not a CA")
+			}
+			return nil
+		},
+	},
+	{
+		Name:        "rfc5280_key_usage_key_type",
+		Description: "The key usage must be compatible with the type of the public key.",
+		Severity:    LintSeverityError,
+		Profiles:    []LintProfile{LintProfileRFC5280, LintProfileCABFTLS, LintProfileMTLS},
+		Check: func(cert *x509.Certificate) error {
+			ku := cert.KeyUsage
+			switch cert.PublicKey.(type) {
+			case *rsa.PublicKey:
+				if ku&(x509.KeyUsageKeyAgreement|x509.KeyUsageEncipherOnly|x509.KeyUsageDecipherOnly) != 0 {
+					return errors.New("RSA keys cannot have the keyAgreement, encipherOnly or decipherOnly key usages")
+				}
+			case *ecdsa.PublicKey:
+				if ku&(x509.KeyUsageKeyEncipherment|x509.KeyUsageDataEncipherment) != 0 {
+					return errors.New("ECDSA keys cannot have the keyEncipherment or dataEncipherment key usages")
+				}
+			case ed25519.PublicKey:
+				if ku&(x509.KeyUsageKeyEncipherment|x509.KeyUsageDataEncipherment|x509.KeyUsageKeyAgreement) != 0 {
+					return errors.New("Ed25519 keys cannot have the keyEncipherment, dataEncipherment or keyAgreement key usages")
+				}
+			}
+			if ku&(x509.KeyUsageEncipherOnly|x509.KeyUsageDecipherOnly) != 0 && ku&x509.KeyUsageKeyAgreement == 0 {
+				return errors.New("the encipherOnly and decipherOnly key usages require keyAgreement")
+			}
+			return nil
+		},
+	},
+	{
+		Name:        "rfc5280_empty_subject_san_critical",
+		Description: "Certificates with an empty subject must have a critical subject alternative name extension.",
+		Severity:    LintSeverityError,
+		Profiles:    []LintProfile{LintProfileRFC5280, LintProfileCABFTLS, LintProfileMTLS},
+		Check: func(cert *x509.Certificate) error {
+			if !hasEmptySubject(cert) {
+				return nil
+			}
+			ext, ok := findExtension(cert, oidExtensionSubjectAltName)
+			switch {
+			case ok && !ext.Critical:
+				return errors.New("subject is empty and the subject alternative name extension is not critical")
+			case ok:
+				return nil
+			case len(cert.Raw) == 0 && hasStandardSANs(cert):
+				// The standard library will mark the extension as critical.
+				return nil
+			default:
+				return errors.New("subject is empty and the certificate does not have subject alternative names")
+			}
+		},
+	},
+	{
+		Name:        "cabf_subscriber_validity_too_long",
+		Description: "Subscriber certificates must not have a validity period longer than 398 days.",
+		Severity:    LintSeverityError,
+		Profiles:    []LintProfile{LintProfileCABFTLS},
+		Check: func(cert *x509.Certificate) error {
+			if !isCA(cert) && !cert.NotBefore.IsZero() && cert.NotAfter.Sub(cert.NotBefore) > maxSubscriberValidity {
+				return errors.New("validity period is longer than 398 days")
+			}
+			return nil
+		},
+	},
+	{
+		Name:        "cabf_subscriber_san_missing",
+		Description: "Subscriber certificates must contain at least one DNS name or IP address.",
+		Severity:    LintSeverityError,
+		Profiles:    []LintProfile{LintProfileCABFTLS},
+		Check: func(cert *x509.Certificate) error {
+			dnsNames, ips := lintDNSNamesAndIPs(cert)
+			if !isCA(cert) && len(dnsNames) == 0 && len(ips) == 0 {
+				return errors.New("certificate does not have any DNS name or IP address")
+			}
+			return nil
+		},
+	},
+	{
+		Name:        "cabf_subscriber_common_name_not_in_san",
+		Description: "The common name of subscriber certificates must be one of the subject alternative names.",
+		Severity:    LintSeverityError,
+		Profiles:    []LintProfile{LintProfileCABFTLS},
+		Check: func(cert *x509.Certificate) error {
+			cn := cert.Subject.CommonName
+			if isCA(cert) || cn == "" {
+				return nil
+			}
+			dnsNames, ips := lintDNSNamesAndIPs(cert)
+			for _, name := range dnsNames {
+				if strings.EqualFold(name, cn) {
+					return nil
+				}
+			}
+			for _, ip := range ips {
+				if ip.String() == cn {
+					return nil
+				}
+			}
+			return errors.Errorf("common name %q is not in the subject alternative names", cn)
+		},
+	},
+	{
+		Name:        "cabf_subscriber_server_auth",
+		Description: "Subscriber certificates must have the serverAuth extended key usage and must not have anyExtendedKeyUsage.",
+		Severity:    LintSeverityError,
+		Profiles:    []LintProfile{LintProfileCABFTLS},
+		Check: func(cert *x509.Certificate) error {
+			if isCA(cert) {
+				return nil
+			}
+			if hasExtKeyUsage(cert, x509.ExtKeyUsageAny) {
+				return errors.New("certificate has the any extended key usage")
+			}
+			if !hasExtKeyUsage(cert, x509.ExtKeyUsageServerAuth) {
+				return errors.New("certificate does not have the serverAuth extended key usage")
+			}
+			return nil
+		},
+	},
+	{
+		Name:        "cabf_serial_number_entropy",
+		Description: "Serial numbers should be at least 64 bits long to contain 64 bits of output from a CSPRNG.",
+		Severity:    LintSeverityWarning,
+		Profiles:    []LintProfile{LintProfileCABFTLS},
+		Check: func(cert *x509.Certificate) error {
+			if cert.SerialNumber != nil && cert.SerialNumber.BitLen() < 64 {
+				return errors.New("serial number is shorter than 64 bits")
+			}
+			return nil
+		},
+	},
+	{
+		Name:        "cabf_public_key_type",
+		Description: "Public keys must be RSA keys of at least 2048 bits or ECDSA keys on P-256, P-384 or P-521.",
+		Severity:    LintSeverityError,
+		Profiles:    []LintProfile{LintProfileCABFTLS},
+		Check: func(cert *x509.Certificate) error {
+			switch pub := cert.PublicKey.(type) {
+			case *rsa.PublicKey:
+				if pub.N.BitLen() < 2048 {
+					return errors.Errorf("RSA key size %d is lower than 2048", pub.N.BitLen())
+				}
+				if pub.N.BitLen()%8 != 0 {
+					return errors.Errorf("RSA key size %d is not divisible by 8", pub.N.BitLen())
+				}
+			case *ecdsa.PublicKey:
+				switch pub.Curve {
+				case elliptic.P256(), elliptic.P384(), elliptic.P521():
+				default:
+					return errors.Errorf("ECDSA curve %s is not allowed", pub.Curve.Params().Name)
+				}
+			default:
+				return errors.Errorf("public key type %T is not allowed", pub)
+			}
+			return nil
+		},
+	},
+	{
+		Name:        "mtls_leaf_ext_key_usage",
+		Description: "Internal mutual TLS certificates must have the clientAuth or serverAuth extended key usages.",
+		Severity:    LintSeverityError,
+		Profiles:    []LintProfile{LintProfileMTLS},
+		Check: func(cert *x509.Certificate) error {
+			if !isCA(cert) && !hasExtKeyUsage(cert, x509.ExtKeyUsageClientAuth) && !hasExtKeyUsage(cert, x509.ExtKeyUsageServerAuth) {
+				return errors.New("certificate does not have the clientAuth or serverAuth extended key usages")
+			}
+			return nil
+		},
+	},
+	{
+		Name:        "mtls_leaf_digital_signature",
+		Description: "Internal mutual TLS certificates must have the digitalSignature key usage.",
+		Severity:    LintSeverityError,
+		Profiles:    []LintProfile{LintProfileMTLS},
+		Check: func(cert *x509.Certificate) error {
+			if !isCA(cert) && cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+				return errors.New("certificate does not have the digitalSignature key usage")
+			}
+			return nil
+		},
+	},
+	{
+		Name:        "mtls_leaf_validity_too_long",
+		Description: "Internal mutual TLS certificates should not have a validity period longer than 90 days.",
+		Severity:    LintSeverityWarning,
+		Profiles:    []LintProfile{LintProfileMTLS},
+		Check: func(cert *x509.Certificate) error {
+			if !isCA(cert) && !cert.NotBefore.IsZero() && cert.NotAfter.Sub(cert.NotBefore) > maxMTLSValidity {
+				return errors.New("validity period is longer than 90 days")
+			}
+			return nil
+		},
+	},
+}
+
+func isCA(cert *x509.Certificate) bool {
+	return cert.BasicConstraintsValid && cert.IsCA
+}
+
+// findExtension looks for the extension in the parsed extensions and in the
+// extra extensions used in templates.
+func findExtension(cert *x509.Certificate, oid asn1.ObjectIdentifier) (pkix.Extension, bool) {
+	for _, exts := range [][]pkix.Extension{cert.Extensions, cert.ExtraExtensions} {
+		for _, ext := range exts {
+			if ext.Id.Equal(oid) {
+				return ext, true
+			}
+		}
+	}
+	return pkix.Extension{}, false
+}
+
+func hasNameConstraints(cert *x509.Certificate) bool {
+	if _, ok := findExtension(cert, oidExtensionNameConstraints); ok {
+		return true
+	}
+	return len(cert.PermittedDNSDomains) > 0 || len(cert.ExcludedDNSDomains) > 0 ||
+		len(cert.PermittedIPRanges) > 0 || len(cert.ExcludedIPRanges) > 0 ||
+		len(cert.PermittedEmailAddresses) > 0 || len(cert.ExcludedEmailAddresses) > 0 ||
+		len(cert.PermittedURIDomains) > 0 || len(cert.ExcludedURIDomains) > 0
+}
+
+func hasStandardSANs(cert *x509.Certificate) bool {
+	return len(cert.DNSNames) > 0 || len(cert.EmailAddresses) > 0 ||
+		len(cert.IPAddresses) > 0 || len(cert.URIs) > 0
+}
+
+// lintDNSNamesAndIPs returns the DNS names and IP addresses in the certificate.
+// Templates can have the subject alternative name extension in the extra
+// extensions, in that case the names are parsed from it.
+func lintDNSNamesAndIPs(cert *x509.Certificate) (dnsNames []string, ips []net.IP) {
+	dnsNames, ips = cert.DNSNames, cert.IPAddresses
+	for _, ext := range cert.ExtraExtensions {
+		if !ext.Id.Equal(oidExtensionSubjectAltName) {
+			continue
+		}
+		_ = forEachSAN(ext.Value, func(v asn1.RawValue) error {
+			switch {
+			case v.Class != asn1.ClassContextSpecific:
+			case v.Tag == nameTypeDNS:
+				dnsNames = append(dnsNames, string(v.Bytes))
+			case v.Tag == nameTypeIP:
+				ips = append(ips, net.IP(v.Bytes))
+			}
+			return nil
+		})
+	}
+	return
+}
+
+func hasEmptySubject(cert *x509.Certificate) bool {
+	if len(cert.RawSubject) > 0 {
+		return bytes.Equal(cert.RawSubject, emptyASN1Subject)
+	}
+	return len(cert.Subject.ToRDNSequence()) == 0
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, eku x509.ExtKeyUsage) bool {
+	for _, v := range cert.ExtKeyUsage {
+		if v == eku {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,255 @@
+package x509util
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lintRuleNames(results LintResults) []string {
+	var names []string
+	for _, r := range results {
+		names = append(names, r.Rule)
+	}
+	return names
+}
+
+func TestLint(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	now := time.Now()
+	leaf := func(fn func(c *x509.Certificate)) *x509.Certificate {
+		c := &x509.Certificate{
+			Subject:      pkix.Name{CommonName: "test.smallstep.com"},
+			SerialNumber: new(big.Int).Lsh(big.NewInt(1), 127),
+			NotBefore:    now,
+			NotAfter:     now.Add(24 * time.Hour),
+			DNSNames:     []string{"test.smallstep.com"},
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			PublicKey:    ecKey.Public(),
+		}
+		if fn != nil {
+			fn(c)
+		}
+		return c
+	}
+	ca := func(fn func(c *x509.Certificate)) *x509.Certificate {
+		c := leaf(func(c *x509.Certificate) {
+			c.DNSNames = nil
+			c.ExtKeyUsage = nil
+			c.BasicConstraintsValid = true
+			c.IsCA = true
+			c.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		})
+		if fn != nil {
+			fn(c)
+		}
+		return c
+	}
+
+	type args struct {
+		cert *x509.Certificate
+		opts []LintOption
+	}
+	tests := []struct {
+		name string
+		args args
+		want []string
+	}{
+		{"ok leaf", args{leaf(nil), nil}, nil},
+		{"ok ca", args{ca(nil), nil}, nil},
+		{"ok cabf", args{leaf(nil), []LintOption{WithLintProfiles(LintProfileCABFTLS)}}, nil},
+		{"ok mtls", args{leaf(nil), []LintOption{WithLintProfiles(LintProfileMTLS)}}, nil},
+		{"ok template without serial", args{leaf(func(c *x509.Certificate) {
+			c.SerialNumber = nil
+		}), nil}, nil},
+		{"ok empty subject template", args{leaf(func(c *x509.Certificate) {
+			c.Subject = pkix.Name{}
+		}), nil}, nil},
+		{"ok ignore", args{leaf(func(c *x509.Certificate) {
+			c.SerialNumber = big.NewInt(-1)
+		}), []LintOption{WithLintIgnore("rfc5280_serial_number_positive")}}, nil},
+		{"ok min severity", args{leaf(func(c *x509.Certificate) {
+			c.SerialNumber = big.NewInt(1234)
+		}), []LintOption{WithLintProfiles(LintProfileCABFTLS), WithLintMinSeverity(LintSeverityError)}}, nil},
+		{"fail negative serial", args{leaf(func(c *x509.Certificate) {
+			c.SerialNumber = big.NewInt(-1)
+		}), nil}, []string{"rfc5280_serial_number_positive"}},
+		{"fail zero serial", args{leaf(func(c *x509.Certificate) {
+			c.SerialNumber = big.NewInt(0)
+		}), nil}, []string{"rfc5280_serial_number_positive"}},
+		{"fail long serial", args{leaf(func(c *x509.Certificate) {
+			c.SerialNumber = new(big.Int).Lsh(big.NewInt(1), 159)
+		}), nil}, []string{"rfc5280_serial_number_too_long"}},
+		{"fail validity", args{leaf(func(c *x509.Certificate) {
+			c.NotAfter = now.Add(-time.Hour)
+		}), nil}, []string{"rfc5280_validity_order"}},
+		{"fail ca skid", args{ca(func(c *x509.Certificate) {
+			c.Raw = []byte("signed")
+		}), nil}, []string{"rfc5280_ca_subject_key_id_missing"}},
+		{"fail ca cert sign", args{ca(func(c *x509.Certificate) {
+			c.KeyUsage = x509.KeyUsageDigitalSignature
+		}), nil}, []string{"rfc5280_ca_key_usage_cert_sign"}},
+		{"fail cert sign", args{leaf(func(c *x509.Certificate) {
+			c.KeyUsage |= x509.KeyUsageCertSign
+		}), nil}, []string{"rfc5280_cert_sign_without_ca"}},
+		{"fail name constraints", args{leaf(func(c *x509.Certificate) {
+			c.PermittedDNSDomains = []string{"smallstep.com"}
+		}), nil}, []string{"rfc5280_name_constraints_without_ca"}},
+		{"fail ecdsa key usage", args{leaf(func(c *x509.Certificate) {
+			c.KeyUsage |= x509.KeyUsageKeyEncipherment
+		}), nil}, []string{"rfc5280_key_usage_key_type"}},
+		{"fail rsa key usage", args{leaf(func(c *x509.Certificate) {
+			c.PublicKey = rsaKey.Public()
+			c.KeyUsage |= x509.KeyUsageKeyAgreement
+		}), nil}, []string{"rfc5280_key_usage_key_type"}},
+		{"fail ed25519 key usage", args{leaf(func(c *x509.Certificate) {
+			c.PublicKey = edPub
+			c.KeyUsage |= x509.KeyUsageDataEncipherment
+		}), nil}, []string{"rfc5280_key_usage_key_type"}},
+		{"fail empty subject", args{leaf(func(c *x509.Certificate) {
+			c.Subject = pkix.Name{}
+			c.DNSNames = nil
+		}), nil}, []string{"rfc5280_empty_subject_san_critical"}},
+		{"fail empty subject not critical", args{leaf(func(c *x509.Certificate) {
+			c.Subject = pkix.Name{}
+			c.ExtraExtensions = []pkix.Extension{{Id: []int{2, 5, 29, 17}, Critical: false, Value: []byte{0x30, 0x00}}}
+		}), nil}, []string{"rfc5280_empty_subject_san_critical"}},
+		{"fail cabf", args{leaf(func(c *x509.Certificate) {
+			c.SerialNumber = big.NewInt(1234)
+			c.PublicKey = rsaKey.Public()
+			c.NotAfter = now.Add(400 * 24 * time.Hour)
+			c.DNSNames = nil
+			c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		}), []LintOption{WithLintProfiles(LintProfileCABFTLS)}}, []string{
+			"cabf_subscriber_validity_too_long", "cabf_subscriber_san_missing",
+			"cabf_subscriber_common_name_not_in_san", "cabf_subscriber_server_auth",
+			"cabf_serial_number_entropy", "cabf_public_key_type",
+		}},
+		{"fail cabf any", args{leaf(func(c *x509.Certificate) {
+			c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+			c.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		}), []LintOption{WithLintProfiles(LintProfileCABFTLS)}}, []string{"cabf_subscriber_server_auth"}},
+		{"fail mtls", args{leaf(func(c *x509.Certificate) {
+			c.KeyUsage = x509.KeyUsageKeyAgreement
+			c.ExtKeyUsage = nil
+			c.NotAfter = now.Add(91 * 24 * time.Hour)
+		}), []LintOption{WithLintProfiles(LintProfileMTLS)}}, []string{
+			"mtls_leaf_ext_key_usage", "mtls_leaf_digital_signature", "mtls_leaf_validity_too_long",
+		}},
+		{"fail custom rule", args{leaf(nil), []LintOption{WithLintRules(LintRule{
+			Name:     "custom",
+			Severity: LintSeverityNotice,
+			Check: func(cert *x509.Certificate) error {
+				return errors.New("custom failure")
+			},
+		})}}, []string{"custom"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lint(tt.args.cert, tt.args.opts...)
+			assert.Equal(t, tt.want, lintRuleNames(got))
+		})
+	}
+}
+
+func TestLintCertificate(t *testing.T) {
+	cr, _ := createCertificateRequest(t, "commonName", []string{"foo.com"})
+	cert, err := NewCertificate(cr, WithTemplate(DefaultLeafTemplate, CreateTemplateData("commonName", []string{"foo.com"})))
+	require.NoError(t, err)
+
+	assert.Empty(t, LintCertificate(cert))
+	assert.Equal(t, []string{"cabf_subscriber_common_name_not_in_san", "cabf_public_key_type"},
+		lintRuleNames(LintCertificate(cert, WithLintProfiles(LintProfileCABFTLS))))
+}
+
+func TestRegisterLintRule(t *testing.T) {
+	t.Cleanup(func() {
+		lintRegistry.Lock()
+		lintRegistry.rules = nil
+		lintRegistry.Unlock()
+	})
+
+	rule := LintRule{
+		Name:     "test_registered_rule",
+		Severity: LintSeverityWarning,
+		Profiles: []LintProfile{LintProfileMTLS},
+		Check: func(cert *x509.Certificate) error {
+			if cert.Subject.CommonName == "" {
+				return errors.New("common name is empty")
+			}
+			return nil
+		},
+	}
+
+	assert.Error(t, RegisterLintRule(LintRule{Severity: LintSeverityError, Check: rule.Check}))
+	assert.Error(t, RegisterLintRule(LintRule{Name: "no-check", Severity: LintSeverityError}))
+	assert.Error(t, RegisterLintRule(LintRule{Name: "no-severity", Check: rule.Check}))
+	require.NoError(t, RegisterLintRule(rule))
+	assert.Error(t, RegisterLintRule(rule))
+	assert.Len(t, LintRules(), len(defaultLintRules)+1)
+
+	cert := &x509.Certificate{
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		DNSNames:    []string{"foo.com"},
+	}
+	assert.Empty(t, Lint(cert))
+	assert.Equal(t, LintResults{
+		{Rule: "test_registered_rule", Severity: LintSeverityWarning, Message: "common name is empty"},
+	}, Lint(cert, WithLintProfiles(LintProfileMTLS)))
+}
+
+func TestLintResults_Err(t *testing.T) {
+	results := LintResults{
+		{Rule: "rule1", Severity: LintSeverityWarning, Message: "warning message"},
+		{Rule: "rule2", Severity: LintSeverityError, Message: "error message"},
+	}
+	assert.True(t, results.HasErrors())
+	assert.EqualError(t, results.Err(), "certificate lint failed: rule2: error message")
+	var lintErr *LintError
+	assert.ErrorAs(t, results.Err(), &lintErr)
+	assert.Equal(t, results[1:], lintErr.Results)
+
+	assert.False(t, results[:1].HasErrors())
+	assert.NoError(t, results[:1].Err())
+	assert.NoError(t, LintResults(nil).Err())
+}
+
+func TestWithLint(t *testing.T) {
+	cr, _ := createCertificateRequest(t, "commonName", []string{"foo.com"})
+	data := CreateTemplateData("commonName", []string{"foo.com"})
+
+	cert, err := NewCertificate(cr, WithTemplate(DefaultLeafTemplate, data), WithLint())
+	require.NoError(t, err)
+	assert.NotNil(t, cert)
+
+	cert, err = NewCertificate(cr, WithLint(WithLintProfiles(LintProfileCABFTLS)))
+	assert.Nil(t, cert)
+	var lintErr *LintError
+	if assert.ErrorAs(t, err, &lintErr) {
+		assert.Equal(t, []string{"cabf_subscriber_common_name_not_in_san", "cabf_public_key_type"}, lintRuleNames(lintErr.Results))
+	}
+
+	cert, err = NewCertificate(cr, WithTemplate(`{"subject": {"commonName": "foo.com"}, "dnsNames": ["foo.com"], "keyUsage": ["digitalSignature", "certSign"]}`, data), WithLint())
+	assert.Nil(t, cert)
+	assert.EqualError(t, err, "certificate lint failed: rfc5280_cert_sign_without_ca: certificate has the certSign key usage but it is not a CA")
+}
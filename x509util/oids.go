@@ -0,0 +1,178 @@
+package x509util
+
+import (
+	"encoding/asn1"
+	"sync"
+)
+
+// oidNames contains the human readable names of well known object
+// identifiers. It is used to pretty-print certificates, certificate requests
+// and other structures using these object identifiers.
+var oidNames = map[string]string{
+	// Attribute types, RFC 5280 and RFC 4519.
+	"2.5.4.3":                    "commonName",
+	"2.5.4.4":                    "surname",
+	"2.5.4.5":                    "serialNumber",
+	"2.5.4.6":                    "countryName",
+	"2.5.4.7":                    "localityName",
+	"2.5.4.8":                    "stateOrProvinceName",
+	"2.5.4.9":                    "streetAddress",
+	"2.5.4.10":                   "organizationName",
+	"2.5.4.11":                   "organizationalUnitName",
+	"2.5.4.12":                   "title",
+	"2.5.4.17":                   "postalCode",
+	"2.5.4.42":                   "givenName",
+	"2.5.4.43":                   "initials",
+	"2.5.4.44":                   "generationQualifier",
+	"2.5.4.46":                   "dnQualifier",
+	"2.5.4.65":                   "pseudonym",
+	"2.5.4.97":                   "organizationIdentifier",
+	"0.9.2342.19200300.100.1.1":  "userId",
+	"0.9.2342.19200300.100.1.25": "domainComponent",
+	"1.2.840.113549.1.9.1":       "emailAddress",
+	"1.2.840.113549.1.9.7":       "challengePassword",
+	"1.2.840.113549.1.9.14":      "extensionRequest",
+
+	// Extensions, RFC 5280 and others.
+	"2.5.29.9":                    "Subject Directory Attributes",
+	"2.5.29.14":                   "Subject Key Identifier",
+	"2.5.29.15":                   "Key Usage",
+	"2.5.29.16":                   "Private Key Usage Period",
+	"2.5.29.17":                   "Subject Alternative Name",
+	"2.5.29.18":                   "Issuer Alternative Name",
+	"2.5.29.19":                   "Basic Constraints",
+	"2.5.29.20":                   "CRL Number",
+	"2.5.29.21":                   "CRL Reason Code",
+	"2.5.29.24":                   "Invalidity Date",
+	"2.5.29.27":                   "Delta CRL Indicator",
+	"2.5.29.28":                   "Issuing Distribution Point",
+	"2.5.29.29":                   "Certificate Issuer",
+	"2.5.29.30":                   "Name Constraints",
+	"2.5.29.31":                   "CRL Distribution Points",
+	"2.5.29.32":                   "Certificate Policies",
+	"2.5.29.33":                   "Policy Mappings",
+	"2.5.29.35":                   "Authority Key Identifier",
+	"2.5.29.36":                   "Policy Constraints",
+	"2.5.29.37":                   "Extended Key Usage",
+	"2.5.29.46":                   "Freshest CRL",
+	"2.5.29.54":                   "Inhibit Any Policy",
+	"1.3.6.1.5.5.7.1.1":           "Authority Information Access",
+	"1.3.6.1.5.5.7.1.3":           "Qualified Certificate Statements",
+	"1.3.6.1.5.5.7.1.11":          "Subject Information Access",
+	"1.3.6.1.5.5.7.1.24":          "TLS Feature",
+	"1.3.6.1.5.5.7.48.1.2":        "OCSP Nonce",
+	"1.3.6.1.5.5.7.48.1.5":        "OCSP No Check",
+	"1.3.6.1.4.1.11129.2.4.2":     "CT Precertificate SCTs",
+	"1.3.6.1.4.1.11129.2.4.3":     "CT Precertificate Poison",
+	"1.3.6.1.4.1.311.20.2":        "Microsoft Certificate Template Name",
+	"1.3.6.1.4.1.311.21.7":        "Microsoft Certificate Template",
+	"1.3.6.1.4.1.311.21.10":       "Microsoft Application Policies",
+	"1.3.6.1.4.1.37476.9000.64.1": "step Provisioner",
+	"1.3.6.1.4.1.57264.1.1":       "Sigstore OIDC Issuer",
+
+	// Access methods.
+	"1.3.6.1.5.5.7.48.1": "OCSP",
+	"1.3.6.1.5.5.7.48.2": "CA Issuers",
+	"1.3.6.1.5.5.7.48.3": "Time Stamping",
+	"1.3.6.1.5.5.7.48.5": "CA Repository",
+
+	// Extended key usages.
+	"2.5.29.37.0":            "Any Extended Key Usage",
+	"1.3.6.1.5.5.7.3.1":      "Server Authentication",
+	"1.3.6.1.5.5.7.3.2":      "Client Authentication",
+	"1.3.6.1.5.5.7.3.3":      "Code Signing",
+	"1.3.6.1.5.5.7.3.4":      "Email Protection",
+	"1.3.6.1.5.5.7.3.5":      "IPSec End System",
+	"1.3.6.1.5.5.7.3.6":      "IPSec Tunnel",
+	"1.3.6.1.5.5.7.3.7":      "IPSec User",
+	"1.3.6.1.5.5.7.3.8":      "Time Stamping",
+	"1.3.6.1.5.5.7.3.9":      "OCSP Signing",
+	"1.3.6.1.5.5.7.3.17":     "IPSec IKE",
+	"1.3.6.1.4.1.311.10.3.3": "Microsoft Server Gated Crypto",
+	"2.16.840.1.113730.4.1":  "Netscape Server Gated Crypto",
+	"1.3.6.1.4.1.311.2.1.22": "Microsoft Commercial Code Signing",
+	"1.3.6.1.4.1.311.61.1.1": "Microsoft Kernel Code Signing",
+	"1.3.6.1.4.1.311.20.2.2": "Microsoft Smart Card Logon",
+	"1.3.6.1.5.2.3.5":        "Kerberos PKINIT KDC",
+	"2.23.133.8.1":           "TCG Endorsement Key Certificate",
+	"2.23.133.8.3":           "TCG Attestation Identity Key Certificate",
+
+	// Subject alternative name types.
+	"1.3.6.1.4.1.311.20.2.3": "User Principal Name",
+	"1.3.6.1.5.5.7.8.3":      "Permanent Identifier",
+	"1.3.6.1.5.5.7.8.4":      "Hardware Module Name",
+
+	// Certificate policies.
+	"2.5.29.32.0":       "Any Policy",
+	"1.3.6.1.5.5.7.2.1": "CPS",
+	"1.3.6.1.5.5.7.2.2": "User Notice",
+	"2.23.140.1.1":      "CA/B Forum Extended Validation",
+	"2.23.140.1.2.1":    "CA/B Forum Domain Validated",
+	"2.23.140.1.2.2":    "CA/B Forum Organization Validated",
+	"2.23.140.1.2.3":    "CA/B Forum Individual Validated",
+	"2.23.140.1.3":      "CA/B Forum Extended Validation Code Signing",
+	"2.23.140.1.4.1":    "CA/B Forum Code Signing",
+	"2.23.140.1.31":     "CA/B Forum Tor Service Descriptor",
+
+	// Trusted Computing Group.
+	"2.23.133.2.1":   "TPM Manufacturer",
+	"2.23.133.2.2":   "TPM Model",
+	"2.23.133.2.3":   "TPM Version",
+	"2.23.133.2.16":  "TPM Specification",
+	"2.23.133.2.18":  "TPM Security Assertions",
+	"2.23.133.6.1.1": "Subject Key Attestation Evidence",
+
+	// Public key algorithms.
+	"1.2.840.113549.1.1.1":  "rsaEncryption",
+	"1.2.840.113549.1.1.10": "RSASSA-PSS",
+	"1.2.840.10045.2.1":     "id-ecPublicKey",
+	"1.2.840.10040.4.1":     "DSA",
+	"1.3.101.110":           "X25519",
+	"1.3.101.111":           "X448",
+	"1.3.101.112":           "Ed25519",
+	"1.3.101.113":           "Ed448",
+
+	// Named curves.
+	"1.2.840.10045.3.1.7": "P-256",
+	"1.3.132.0.34":        "P-384",
+	"1.3.132.0.35":        "P-521",
+	"1.3.132.0.10":        "secp256k1",
+
+	// Signature algorithms.
+	"1.2.840.113549.1.1.2":   "MD2-RSA",
+	"1.2.840.113549.1.1.4":   "MD5-RSA",
+	"1.2.840.113549.1.1.5":   "SHA1-RSA",
+	"1.2.840.113549.1.1.11":  "SHA256-RSA",
+	"1.2.840.113549.1.1.12":  "SHA384-RSA",
+	"1.2.840.113549.1.1.13":  "SHA512-RSA",
+	"1.2.840.10040.4.3":      "DSA-SHA1",
+	"2.16.840.1.101.3.4.3.2": "DSA-SHA256",
+	"1.2.840.10045.4.1":      "ECDSA-SHA1",
+	"1.2.840.10045.4.3.2":    "ECDSA-SHA256",
+	"1.2.840.10045.4.3.3":    "ECDSA-SHA384",
+	"1.2.840.10045.4.3.4":    "ECDSA-SHA512",
+
+	// Hash algorithms.
+	"1.3.14.3.2.26":          "SHA-1",
+	"2.16.840.1.101.3.4.2.1": "SHA-256",
+	"2.16.840.1.101.3.4.2.2": "SHA-384",
+	"2.16.840.1.101.3.4.2.3": "SHA-512",
+}
+
+var oidNamesMutex sync.RWMutex
+
+// OIDName returns the human readable name of the given object identifier. It
+// returns an empty string if the object identifier is not known.
+func OIDName(oid asn1.ObjectIdentifier) string {
+	oidNamesMutex.RLock()
+	defer oidNamesMutex.RUnlock()
+	return oidNames[oid.String()]
+}
+
+// RegisterOIDName adds or replaces the human readable name of an object
+// identifier. The name will be used by OIDName.
+func RegisterOIDName(oid asn1.ObjectIdentifier, name string) {
+	oidNamesMutex.Lock()
+	defer oidNamesMutex.Unlock()
+	oidNames[oid.String()] = name
+}
@@ -0,0 +1,44 @@
+package x509util
+
+import (
+	"encoding/asn1"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOIDName(t *testing.T) {
+	tests := []struct {
+		name string
+		oid  asn1.ObjectIdentifier
+		want string
+	}{
+		{"commonName", asn1.ObjectIdentifier{2, 5, 4, 3}, "commonName"},
+		{"subjectAltName", oidExtensionSubjectAltName, "Subject Alternative Name"},
+		{"serverAuth", asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}, "Server Authentication"},
+		{"permanentIdentifier", oidPermanentIdentifier, "Permanent Identifier"},
+		{"tpmManufacturer", oidTPMManufacturer, "TPM Manufacturer"},
+		{"unknown", asn1.ObjectIdentifier{1, 2, 3, 4}, ""},
+		{"nil", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, OIDName(tt.oid))
+		})
+	}
+}
+
+func TestRegisterOIDName(t *testing.T) {
+	oid := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 99}
+	t.Cleanup(func() {
+		oidNamesMutex.Lock()
+		delete(oidNames, oid.String())
+		oidNamesMutex.Unlock()
+	})
+
+	assert.Equal(t, "", OIDName(oid))
+	RegisterOIDName(oid, "Test Extension")
+	assert.Equal(t, "Test Extension", OIDName(oid))
+	RegisterOIDName(oid, "Other Test Extension")
+	assert.Equal(t, "Other Test Extension", OIDName(oid))
+}
@@ -3,6 +3,7 @@ package x509util
 import (
 	"bytes"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	encoding_asn1 "encoding/asn1"
 	"encoding/base64"
 	"os"
@@ -19,6 +20,8 @@ import (
 // Options are the options that can be passed to NewCertificate.
 type Options struct {
 	CertBuffer *bytes.Buffer
+	Linter     *Linter
+	Extensions []pkix.Extension
 }
 
 func (o *Options) apply(cr *x509.CertificateRequest, opts []Option) (*Options, error) {
@@ -111,6 +114,29 @@ func WithTemplateFile(path string, data TemplateData) Option {
 	}
 }
 
+// WithLint is an option that runs a linter with the given options against the
+// certificate created by NewCertificate or NewCertificateFromX509. These
+// methods will fail if any of the rules returns an error with the
+// LintSeverityError severity.
+func WithLint(opts ...LintOption) Option {
+	return func(cr *x509.CertificateRequest, o *Options) error {
+		o.Linter = NewLinter(opts...)
+		return nil
+	}
+}
+
+// WithExtensions is an option that adds the given extensions to the
+// certificate created by NewCertificate or NewCertificateFromX509. An
+// extension replaces the one in the template with the same identifier. It can
+// be used to add extensions that can't be created from a template, like the
+// Subject Key Attestation Evidence created by the tpm/skae package.
+func WithExtensions(extensions ...pkix.Extension) Option {
+	return func(cr *x509.CertificateRequest, o *Options) error {
+		o.Extensions = append(o.Extensions, extensions...)
+		return nil
+	}
+}
+
 func asn1Encode(str string) (string, error) {
 	value, params := str, "printable"
 	if strings.Contains(value, sanTypeSeparator) {
@@ -329,6 +329,32 @@ func mustMarshal(t *testing.T, value interface{}, params string) string {
 	return base64.StdEncoding.EncodeToString(b)
 }
 
+func TestWithExtensions(t *testing.T) {
+	cr, _ := createCertificateRequest(t, "commonName", []string{"foo.com"})
+	data := CreateTemplateData("commonName", []string{"foo.com"})
+	ext := pkix.Extension{Id: asn1.ObjectIdentifier{2, 23, 133, 6, 1, 1}, Value: []byte{0x30, 0x00}}
+	replace := pkix.Extension{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Critical: true, Value: []byte{0x05, 0x00}}
+
+	cert, err := NewCertificate(cr, WithExtensions(ext))
+	require.NoError(t, err)
+	require.Equal(t, newExtension(ext), cert.Extensions[len(cert.Extensions)-1])
+
+	cert, err = NewCertificate(cr, WithTemplate(`{
+		"subject": {{ toJson .Subject }},
+		"sans": {{ toJson .SANs }},
+		"extensions": [{"id": "1.2.3.4", "value": "BQA="}, {"id": "1.2.3.5", "value": "BQA="}]
+	}`, data), WithExtensions(ext, replace))
+	require.NoError(t, err)
+	require.Equal(t, []Extension{
+		{ID: ObjectIdentifier{1, 2, 3, 4}, Critical: true, Value: []byte{0x05, 0x00}},
+		{ID: ObjectIdentifier{1, 2, 3, 5}, Value: []byte{0x05, 0x00}},
+		newExtension(ext),
+	}, cert.Extensions)
+
+	x509Cert := cert.GetCertificate()
+	require.Len(t, x509Cert.ExtraExtensions, 3)
+}
+
 func Test_asn1Encode(t *testing.T) {
 	now := time.Now().UTC()
 
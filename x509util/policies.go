@@ -0,0 +1,541 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+// Object identifiers used in the certificate policies and policy control
+// extensions.
+var (
+	oidExtensionPolicyMappings    = asn1.ObjectIdentifier{2, 5, 29, 33}
+	oidExtensionPolicyConstraints = asn1.ObjectIdentifier{2, 5, 29, 36}
+	oidExtensionInhibitAnyPolicy  = asn1.ObjectIdentifier{2, 5, 29, 54}
+	oidPolicyQualifierCPS         = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 1}
+	oidPolicyQualifierUserNotice  = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 2}
+)
+
+// CertificatePolicies represents the list of policies, with their optional
+// qualifiers, to set in the certificate policies extension. If the certificate
+// also defines PolicyIdentifiers, the ones that are not in this list will be
+// added to the extension without qualifiers.
+type CertificatePolicies []PolicyInformation
+
+// PolicyInformation represents a policy in the certificate policies extension.
+// In JSON, a policy can also be represented with just the string representation
+// of the policy identifier.
+type PolicyInformation struct {
+	ID         ObjectIdentifier  `json:"id"`
+	Qualifiers []PolicyQualifier `json:"qualifiers,omitempty"`
+}
+
+// PolicyQualifier represents a policy qualifier, only one of CPS or UserNotice
+// can be set. The CPS is the URI of the certification practice statement.
+type PolicyQualifier struct {
+	CPS        string      `json:"cps,omitempty"`
+	UserNotice *UserNotice `json:"userNotice,omitempty"`
+}
+
+// UserNotice represents the user notice policy qualifier. The organization
+// and the notice numbers form the optional notice reference. Text values are
+// encoded as UTF8String.
+type UserNotice struct {
+	Organization  string `json:"organization,omitempty"`
+	NoticeNumbers []int  `json:"noticeNumbers,omitempty"`
+	ExplicitText  string `json:"explicitText,omitempty"`
+}
+
+type asn1PolicyInformation struct {
+	Policy     asn1.ObjectIdentifier
+	Qualifiers []asn1PolicyQualifierInfo `asn1:"optional,omitempty"`
+}
+
+type asn1PolicyQualifierInfo struct {
+	ID        asn1.ObjectIdentifier
+	Qualifier asn1.RawValue
+}
+
+type asn1NoticeReference struct {
+	Organization  string `asn1:"utf8"`
+	NoticeNumbers []int
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface in
+// CertificatePolicies.
+func (p *CertificatePolicies) UnmarshalJSON(data []byte) error {
+	var v []PolicyInformation
+	if err := json.Unmarshal(data, &v); err != nil {
+		return errors.Wrap(err, "error unmarshaling json")
+	}
+	if _, err := CertificatePolicies(v).extension(nil); err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface in PolicyInformation
+// and accepts a string with the policy identifier or the object
+// representation.
+func (p *PolicyInformation) UnmarshalJSON(data []byte) error {
+	if s, err := unmarshalString(data); err == nil {
+		oid, err := parseObjectIdentifier(s)
+		if err != nil {
+			return err
+		}
+		*p = PolicyInformation{ID: ObjectIdentifier(oid)}
+		return nil
+	}
+
+	type policyInformation PolicyInformation
+	var v policyInformation
+	if err := json.Unmarshal(data, &v); err != nil {
+		return errors.Wrap(err, "error unmarshaling json")
+	}
+	*p = PolicyInformation(v)
+	return nil
+}
+
+// Set sets the certificate policies extension in the given certificate.
+func (p CertificatePolicies) Set(c *x509.Certificate) {
+	if ext, err := p.extension(c.PolicyIdentifiers); err == nil {
+		c.ExtraExtensions = append(c.ExtraExtensions, ext)
+	}
+}
+
+// extension returns the certificate policies extension with the policies and
+// the identifiers in ids that are not in the policies.
+func (p CertificatePolicies) extension(ids []asn1.ObjectIdentifier) (pkix.Extension, error) {
+	policies := make([]asn1PolicyInformation, 0, len(p)+len(ids))
+	for _, pi := range p {
+		if len(pi.ID) == 0 {
+			return pkix.Extension{}, errors.New("error creating certificate policies: policy id cannot be empty")
+		}
+		info := asn1PolicyInformation{
+			Policy: asn1.ObjectIdentifier(pi.ID),
+		}
+		for _, q := range pi.Qualifiers {
+			qi, err := q.asn1Value()
+			if err != nil {
+				return pkix.Extension{}, err
+			}
+			info.Qualifiers = append(info.Qualifiers, qi)
+		}
+		policies = append(policies, info)
+	}
+
+	for _, id := range ids {
+		if !p.contains(id) {
+			policies = append(policies, asn1PolicyInformation{Policy: id})
+		}
+	}
+
+	b, err := asn1.Marshal(policies)
+	if err != nil {
+		return pkix.Extension{}, errors.Wrap(err, "error marshaling certificate policies")
+	}
+	return pkix.Extension{
+		Id:    oidExtensionCertificatePolicies,
+		Value: b,
+	}, nil
+}
+
+// hasQualifiers returns true if any of the policies has qualifiers.
+func (p CertificatePolicies) hasQualifiers() bool {
+	for _, pi := range p {
+		if len(pi.Qualifiers) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (p CertificatePolicies) contains(id asn1.ObjectIdentifier) bool {
+	for _, pi := range p {
+		if asn1.ObjectIdentifier(pi.ID).Equal(id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q PolicyQualifier) asn1Value() (asn1PolicyQualifierInfo, error) {
+	var zero asn1PolicyQualifierInfo
+	switch {
+	case q.CPS != "" && q.UserNotice != nil:
+		return zero, errors.New("error creating policy qualifier: cps and userNotice cannot be used at the same time")
+	case q.CPS != "":
+		if !isIA5String(q.CPS) {
+			return zero, errors.New("error creating policy qualifier: cps is not a valid ia5 string")
+		}
+		b, err := asn1.MarshalWithParams(q.CPS, "ia5")
+		if err != nil {
+			return zero, errors.Wrap(err, "error marshaling cps")
+		}
+		return asn1PolicyQualifierInfo{
+			ID:        oidPolicyQualifierCPS,
+			Qualifier: asn1.RawValue{FullBytes: b},
+		}, nil
+	case q.UserNotice != nil:
+		b, err := q.UserNotice.marshal()
+		if err != nil {
+			return zero, err
+		}
+		return asn1PolicyQualifierInfo{
+			ID:        oidPolicyQualifierUserNotice,
+			Qualifier: asn1.RawValue{FullBytes: b},
+		}, nil
+	default:
+		return zero, errors.New("error creating policy qualifier: cps or userNotice are required")
+	}
+}
+
+func (n UserNotice) marshal() ([]byte, error) {
+	var elems [][]byte
+	if n.Organization != "" || len(n.NoticeNumbers) > 0 {
+		if !isUTF8String(n.Organization) {
+			return nil, errors.New("error creating user notice: organization is not a valid utf8 string")
+		}
+		b, err := asn1.Marshal(asn1NoticeReference{
+			Organization:  n.Organization,
+			NoticeNumbers: n.NoticeNumbers,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling notice reference")
+		}
+		elems = append(elems, b)
+	}
+	if n.ExplicitText != "" {
+		if !isUTF8String(n.ExplicitText) {
+			return nil, errors.New("error creating user notice: explicitText is not a valid utf8 string")
+		}
+		b, err := asn1.MarshalWithParams(n.ExplicitText, "utf8")
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling explicit text")
+		}
+		elems = append(elems, b)
+	}
+	b, err := asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassUniversal,
+		Tag:        asn1.TagSequence,
+		IsCompound: true,
+		Bytes:      bytes.Join(elems, nil),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling user notice")
+	}
+	return b, nil
+}
+
+// parseCertificatePolicies parses the value of a certificate policies
+// extension.
+func parseCertificatePolicies(der []byte) (CertificatePolicies, error) {
+	var policies []asn1PolicyInformation
+	if rest, err := asn1.Unmarshal(der, &policies); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling certificate policies")
+	} else if len(rest) > 0 {
+		return nil, errors.New("error unmarshaling certificate policies: trailing data")
+	}
+
+	ret := make(CertificatePolicies, len(policies))
+	for i, p := range policies {
+		ret[i].ID = ObjectIdentifier(p.Policy)
+		for _, q := range p.Qualifiers {
+			switch {
+			case q.ID.Equal(oidPolicyQualifierCPS):
+				s, err := parseDisplayText(q.Qualifier)
+				if err != nil {
+					return nil, errors.Wrap(err, "error parsing cps")
+				}
+				ret[i].Qualifiers = append(ret[i].Qualifiers, PolicyQualifier{CPS: s})
+			case q.ID.Equal(oidPolicyQualifierUserNotice):
+				n, err := parseUserNotice(q.Qualifier.FullBytes)
+				if err != nil {
+					return nil, err
+				}
+				ret[i].Qualifiers = append(ret[i].Qualifiers, PolicyQualifier{UserNotice: n})
+			default:
+				return nil, errors.Errorf("error parsing certificate policies: unsupported qualifier %s", q.ID)
+			}
+		}
+	}
+	return ret, nil
+}
+
+func parseUserNotice(der []byte) (*UserNotice, error) {
+	var elems []asn1.RawValue
+	if rest, err := asn1.Unmarshal(der, &elems); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling user notice")
+	} else if len(rest) > 0 {
+		return nil, errors.New("error unmarshaling user notice: trailing data")
+	}
+
+	n := new(UserNotice)
+	for _, e := range elems {
+		if e.Class == asn1.ClassUniversal && e.Tag == asn1.TagSequence {
+			var ref struct {
+				Organization  asn1.RawValue
+				NoticeNumbers []int
+			}
+			if _, err := asn1.Unmarshal(e.FullBytes, &ref); err != nil {
+				return nil, errors.Wrap(err, "error unmarshaling notice reference")
+			}
+			s, err := parseDisplayText(ref.Organization)
+			if err != nil {
+				return nil, errors.Wrap(err, "error parsing organization")
+			}
+			n.Organization = s
+			n.NoticeNumbers = ref.NoticeNumbers
+			continue
+		}
+		s, err := parseDisplayText(e)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing explicit text")
+		}
+		n.ExplicitText = s
+	}
+	return n, nil
+}
+
+// parseDisplayText returns the value of the string types used in the DisplayText
+// type and the CPS qualifier.
+func parseDisplayText(v asn1.RawValue) (string, error) {
+	if v.Class != asn1.ClassUniversal {
+		return "", errors.New("invalid string class")
+	}
+	switch v.Tag {
+	case asn1.TagIA5String, asn1.TagUTF8String, 26: // 26 is VisibleString
+		return string(v.Bytes), nil
+	case 30: // BMPString
+		if len(v.Bytes)%2 != 0 {
+			return "", errors.New("invalid BMPString")
+		}
+		s := make([]uint16, len(v.Bytes)/2)
+		for i := range s {
+			s[i] = uint16(v.Bytes[2*i])<<8 | uint16(v.Bytes[2*i+1])
+		}
+		return string(utf16.Decode(s)), nil
+	default:
+		return "", errors.Errorf("invalid string tag %d", v.Tag)
+	}
+}
+
+// PolicyMappings represents the list of mappings to set in the policy mappings
+// extension. The extension is marked as critical.
+type PolicyMappings []PolicyMapping
+
+// PolicyMapping represents the equivalence between a policy of the issuer
+// domain and a policy of the subject domain.
+type PolicyMapping struct {
+	IssuerDomainPolicy  ObjectIdentifier `json:"issuerDomainPolicy"`
+	SubjectDomainPolicy ObjectIdentifier `json:"subjectDomainPolicy"`
+}
+
+type asn1PolicyMapping struct {
+	IssuerDomainPolicy  asn1.ObjectIdentifier
+	SubjectDomainPolicy asn1.ObjectIdentifier
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface in PolicyMappings.
+func (p *PolicyMappings) UnmarshalJSON(data []byte) error {
+	var v []PolicyMapping
+	if err := json.Unmarshal(data, &v); err != nil {
+		return errors.Wrap(err, "error unmarshaling json")
+	}
+	if _, err := PolicyMappings(v).extension(); err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
+
+// Set sets the policy mappings extension in the given certificate.
+func (p PolicyMappings) Set(c *x509.Certificate) {
+	if ext, err := p.extension(); err == nil {
+		c.ExtraExtensions = append(c.ExtraExtensions, ext)
+	}
+}
+
+func (p PolicyMappings) extension() (pkix.Extension, error) {
+	mappings := make([]asn1PolicyMapping, len(p))
+	for i, m := range p {
+		if len(m.IssuerDomainPolicy) == 0 || len(m.SubjectDomainPolicy) == 0 {
+			return pkix.Extension{}, errors.New("error creating policy mappings: issuerDomainPolicy and subjectDomainPolicy are required")
+		}
+		mappings[i] = asn1PolicyMapping{
+			IssuerDomainPolicy:  asn1.ObjectIdentifier(m.IssuerDomainPolicy),
+			SubjectDomainPolicy: asn1.ObjectIdentifier(m.SubjectDomainPolicy),
+		}
+	}
+	b, err := asn1.Marshal(mappings)
+	if err != nil {
+		return pkix.Extension{}, errors.Wrap(err, "error marshaling policy mappings")
+	}
+	return pkix.Extension{
+		Id:       oidExtensionPolicyMappings,
+		Critical: true,
+		Value:    b,
+	}, nil
+}
+
+func parsePolicyMappings(der []byte) (PolicyMappings, error) {
+	var mappings []asn1PolicyMapping
+	if rest, err := asn1.Unmarshal(der, &mappings); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling policy mappings")
+	} else if len(rest) > 0 {
+		return nil, errors.New("error unmarshaling policy mappings: trailing data")
+	}
+	ret := make(PolicyMappings, len(mappings))
+	for i, m := range mappings {
+		ret[i] = PolicyMapping{
+			IssuerDomainPolicy:  ObjectIdentifier(m.IssuerDomainPolicy),
+			SubjectDomainPolicy: ObjectIdentifier(m.SubjectDomainPolicy),
+		}
+	}
+	return ret, nil
+}
+
+// PolicyConstraints represents the policy constraints extension. At least one
+// of RequireExplicitPolicy or InhibitPolicyMapping must be set. The extension
+// is marked as critical.
+type PolicyConstraints struct {
+	RequireExplicitPolicy *int `json:"requireExplicitPolicy,omitempty"`
+	InhibitPolicyMapping  *int `json:"inhibitPolicyMapping,omitempty"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface in
+// PolicyConstraints.
+func (p *PolicyConstraints) UnmarshalJSON(data []byte) error {
+	type policyConstraints PolicyConstraints
+	var v policyConstraints
+	if err := json.Unmarshal(data, &v); err != nil {
+		return errors.Wrap(err, "error unmarshaling json")
+	}
+	if _, err := PolicyConstraints(v).extension(); err != nil {
+		return err
+	}
+	*p = PolicyConstraints(v)
+	return nil
+}
+
+// Set sets the policy constraints extension in the given certificate.
+func (p PolicyConstraints) Set(c *x509.Certificate) {
+	if ext, err := p.extension(); err == nil {
+		c.ExtraExtensions = append(c.ExtraExtensions, ext)
+	}
+}
+
+func (p PolicyConstraints) extension() (pkix.Extension, error) {
+	if p.RequireExplicitPolicy == nil && p.InhibitPolicyMapping == nil {
+		return pkix.Extension{}, errors.New("error creating policy constraints: requireExplicitPolicy or inhibitPolicyMapping are required")
+	}
+
+	var elems [][]byte
+	for i, v := range []*int{p.RequireExplicitPolicy, p.InhibitPolicyMapping} {
+		if v == nil {
+			continue
+		}
+		if *v < 0 {
+			return pkix.Extension{}, errors.New("error creating policy constraints: skip certs cannot be negative")
+		}
+		b, err := asn1.MarshalWithParams(*v, "tag:"+string(rune('0'+i)))
+		if err != nil {
+			return pkix.Extension{}, errors.Wrap(err, "error marshaling policy constraints")
+		}
+		elems = append(elems, b)
+	}
+
+	b, err := asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassUniversal,
+		Tag:        asn1.TagSequence,
+		IsCompound: true,
+		Bytes:      bytes.Join(elems, nil),
+	})
+	if err != nil {
+		return pkix.Extension{}, errors.Wrap(err, "error marshaling policy constraints")
+	}
+	return pkix.Extension{
+		Id:       oidExtensionPolicyConstraints,
+		Critical: true,
+		Value:    b,
+	}, nil
+}
+
+func parsePolicyConstraints(der []byte) (*PolicyConstraints, error) {
+	var v struct {
+		RequireExplicitPolicy int `asn1:"optional,tag:0,default:-1"`
+		InhibitPolicyMapping  int `asn1:"optional,tag:1,default:-1"`
+	}
+	if rest, err := asn1.Unmarshal(der, &v); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling policy constraints")
+	} else if len(rest) > 0 {
+		return nil, errors.New("error unmarshaling policy constraints: trailing data")
+	}
+	p := new(PolicyConstraints)
+	if v.RequireExplicitPolicy >= 0 {
+		p.RequireExplicitPolicy = &v.RequireExplicitPolicy
+	}
+	if v.InhibitPolicyMapping >= 0 {
+		p.InhibitPolicyMapping = &v.InhibitPolicyMapping
+	}
+	return p, nil
+}
+
+// InhibitAnyPolicy represents the inhibit anyPolicy extension. Its value is
+// the number of additional non-self-issued certificates that may appear in the
+// path before anyPolicy is no longer permitted. The extension is marked as
+// critical.
+type InhibitAnyPolicy int
+
+// UnmarshalJSON implements the json.Unmarshaler interface in
+// InhibitAnyPolicy.
+func (i *InhibitAnyPolicy) UnmarshalJSON(data []byte) error {
+	var v int
+	if err := json.Unmarshal(data, &v); err != nil {
+		return errors.Wrap(err, "error unmarshaling json")
+	}
+	if v < 0 {
+		return errors.New("error unmarshaling json: inhibitAnyPolicy cannot be negative")
+	}
+	*i = InhibitAnyPolicy(v)
+	return nil
+}
+
+// Set sets the inhibit anyPolicy extension in the given certificate.
+func (i InhibitAnyPolicy) Set(c *x509.Certificate) {
+	if ext, err := i.extension(); err == nil {
+		c.ExtraExtensions = append(c.ExtraExtensions, ext)
+	}
+}
+
+func (i InhibitAnyPolicy) extension() (pkix.Extension, error) {
+	if i < 0 {
+		return pkix.Extension{}, errors.New("error creating inhibit anyPolicy: skip certs cannot be negative")
+	}
+	b, err := asn1.Marshal(int(i))
+	if err != nil {
+		return pkix.Extension{}, errors.Wrap(err, "error marshaling inhibit anyPolicy")
+	}
+	return pkix.Extension{
+		Id:       oidExtensionInhibitAnyPolicy,
+		Critical: true,
+		Value:    b,
+	}, nil
+}
+
+func parseInhibitAnyPolicy(der []byte) (*InhibitAnyPolicy, error) {
+	var v int
+	if rest, err := asn1.Unmarshal(der, &v); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling inhibit anyPolicy")
+	} else if len(rest) > 0 {
+		return nil, errors.New("error unmarshaling inhibit anyPolicy: trailing data")
+	}
+	i := InhibitAnyPolicy(v)
+	return &i, nil
+}
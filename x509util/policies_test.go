@@ -0,0 +1,261 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestCertificatePolicies_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    CertificatePolicies
+		wantErr bool
+	}{
+		{"ok", `[{"id":"2.23.140.1.2.1","qualifiers":[{"cps":"https://smallstep.com/cps"},{"userNotice":{"organization":"Smallstep","noticeNumbers":[1,2],"explicitText":"Test"}}]}]`, CertificatePolicies{
+			{ID: ObjectIdentifier{2, 23, 140, 1, 2, 1}, Qualifiers: []PolicyQualifier{
+				{CPS: "https://smallstep.com/cps"},
+				{UserNotice: &UserNotice{Organization: "Smallstep", NoticeNumbers: []int{1, 2}, ExplicitText: "Test"}},
+			}},
+		}, false},
+		{"ok string", `["1.2.3.4", {"id":"1.2.3.5"}]`, CertificatePolicies{
+			{ID: ObjectIdentifier{1, 2, 3, 4}},
+			{ID: ObjectIdentifier{1, 2, 3, 5}},
+		}, false},
+		{"ok explicitText", `[{"id":"1.2.3.4","qualifiers":[{"userNotice":{"explicitText":"Test"}}]}]`, CertificatePolicies{
+			{ID: ObjectIdentifier{1, 2, 3, 4}, Qualifiers: []PolicyQualifier{
+				{UserNotice: &UserNotice{ExplicitText: "Test"}},
+			}},
+		}, false},
+		{"ok null", `null`, nil, false},
+		{"fail id", `[{"qualifiers":[{"cps":"https://smallstep.com/cps"}]}]`, nil, true},
+		{"fail bad id", `["foo"]`, nil, true},
+		{"fail empty qualifier", `[{"id":"1.2.3.4","qualifiers":[{}]}]`, nil, true},
+		{"fail both qualifiers", `[{"id":"1.2.3.4","qualifiers":[{"cps":"https://smallstep.com/cps","userNotice":{"explicitText":"Test"}}]}]`, nil, true},
+		{"fail cps", `[{"id":"1.2.3.4","qualifiers":[{"cps":"https://smallstep.com/ñ"}]}]`, nil, true},
+		{"fail json", `{"id":"1.2.3.4"}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got CertificatePolicies
+			err := json.Unmarshal([]byte(tt.data), &got)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCertificatePolicies_Set(t *testing.T) {
+	cps, err := asn1.MarshalWithParams("https://smallstep.com/cps", "ia5")
+	require.NoError(t, err)
+	value, err := asn1.Marshal([]asn1PolicyInformation{
+		{Policy: asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}, Qualifiers: []asn1PolicyQualifierInfo{
+			{ID: oidPolicyQualifierCPS, Qualifier: asn1.RawValue{FullBytes: cps}},
+		}},
+		{Policy: asn1.ObjectIdentifier{1, 2, 3, 4}},
+	})
+	require.NoError(t, err)
+
+	cert := &x509.Certificate{
+		PolicyIdentifiers: []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 1}, {1, 2, 3, 4}},
+	}
+	CertificatePolicies{
+		{ID: ObjectIdentifier{2, 23, 140, 1, 2, 1}, Qualifiers: []PolicyQualifier{
+			{CPS: "https://smallstep.com/cps"},
+		}},
+	}.Set(cert)
+	assert.Equal(t, []pkix.Extension{
+		{Id: oidExtensionCertificatePolicies, Value: value},
+	}, cert.ExtraExtensions)
+
+	// Invalid policies are ignored.
+	cert = &x509.Certificate{}
+	CertificatePolicies{{ID: ObjectIdentifier{1, 2, 3, 4}, Qualifiers: []PolicyQualifier{{}}}}.Set(cert)
+	assert.Empty(t, cert.ExtraExtensions)
+}
+
+func Test_parseCertificatePolicies(t *testing.T) {
+	policies := CertificatePolicies{
+		{ID: ObjectIdentifier{2, 23, 140, 1, 2, 1}, Qualifiers: []PolicyQualifier{
+			{CPS: "https://smallstep.com/cps"},
+			{UserNotice: &UserNotice{Organization: "Smallstep", NoticeNumbers: []int{1}}},
+			{UserNotice: &UserNotice{ExplicitText: "Test"}},
+		}},
+		{ID: ObjectIdentifier{1, 2, 3, 4}},
+	}
+	ext, err := policies.extension(nil)
+	require.NoError(t, err)
+	got, err := parseCertificatePolicies(ext.Value)
+	require.NoError(t, err)
+	assert.Equal(t, policies, got)
+
+	// BMPString explicit text.
+	bmp := asn1.RawValue{Tag: 30, Bytes: []byte{0x00, 'H', 0x00, 'i'}}
+	notice, err := asn1.Marshal([]asn1.RawValue{bmp})
+	require.NoError(t, err)
+	value, err := asn1.Marshal([]asn1PolicyInformation{
+		{Policy: asn1.ObjectIdentifier{1, 2, 3, 4}, Qualifiers: []asn1PolicyQualifierInfo{
+			{ID: oidPolicyQualifierUserNotice, Qualifier: asn1.RawValue{FullBytes: notice}},
+		}},
+	})
+	require.NoError(t, err)
+	got, err = parseCertificatePolicies(value)
+	require.NoError(t, err)
+	assert.Equal(t, CertificatePolicies{
+		{ID: ObjectIdentifier{1, 2, 3, 4}, Qualifiers: []PolicyQualifier{{UserNotice: &UserNotice{ExplicitText: "Hi"}}}},
+	}, got)
+
+	// Unknown qualifier.
+	value, err = asn1.Marshal([]asn1PolicyInformation{
+		{Policy: asn1.ObjectIdentifier{1, 2, 3, 4}, Qualifiers: []asn1PolicyQualifierInfo{
+			{ID: asn1.ObjectIdentifier{1, 2, 3, 5}, Qualifier: asn1.RawValue{FullBytes: []byte{0x05, 0x00}}},
+		}},
+	})
+	require.NoError(t, err)
+	_, err = parseCertificatePolicies(value)
+	assert.Error(t, err)
+
+	_, err = parseCertificatePolicies([]byte{0x30})
+	assert.Error(t, err)
+}
+
+func TestPolicyMappings(t *testing.T) {
+	var got PolicyMappings
+	require.NoError(t, json.Unmarshal([]byte(`[{"issuerDomainPolicy":"1.2.3.4","subjectDomainPolicy":"2.23.140.1.2.1"}]`), &got))
+	want := PolicyMappings{
+		{IssuerDomainPolicy: ObjectIdentifier{1, 2, 3, 4}, SubjectDomainPolicy: ObjectIdentifier{2, 23, 140, 1, 2, 1}},
+	}
+	assert.Equal(t, want, got)
+
+	b, err := json.Marshal(got)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"issuerDomainPolicy":"1.2.3.4","subjectDomainPolicy":"2.23.140.1.2.1"}]`, string(b))
+
+	cert := new(x509.Certificate)
+	got.Set(cert)
+	require.Len(t, cert.ExtraExtensions, 1)
+	assert.Equal(t, oidExtensionPolicyMappings, cert.ExtraExtensions[0].Id)
+	assert.True(t, cert.ExtraExtensions[0].Critical)
+
+	parsed, err := parsePolicyMappings(cert.ExtraExtensions[0].Value)
+	require.NoError(t, err)
+	assert.Equal(t, want, parsed)
+
+	assert.Error(t, json.Unmarshal([]byte(`[{"issuerDomainPolicy":"1.2.3.4"}]`), &got))
+	assert.Error(t, json.Unmarshal([]byte(`{"issuerDomainPolicy":"1.2.3.4"}`), &got))
+}
+
+func TestPolicyConstraints(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    *PolicyConstraints
+		wantDER []byte
+		wantErr bool
+	}{
+		{"ok", `{"requireExplicitPolicy":0,"inhibitPolicyMapping":2}`, &PolicyConstraints{RequireExplicitPolicy: intPtr(0), InhibitPolicyMapping: intPtr(2)}, []byte{0x30, 0x06, 0x80, 0x01, 0x00, 0x81, 0x01, 0x02}, false},
+		{"ok requireExplicitPolicy", `{"requireExplicitPolicy":1}`, &PolicyConstraints{RequireExplicitPolicy: intPtr(1)}, []byte{0x30, 0x03, 0x80, 0x01, 0x01}, false},
+		{"ok inhibitPolicyMapping", `{"inhibitPolicyMapping":0}`, &PolicyConstraints{InhibitPolicyMapping: intPtr(0)}, []byte{0x30, 0x03, 0x81, 0x01, 0x00}, false},
+		{"fail empty", `{}`, nil, nil, true},
+		{"fail negative", `{"requireExplicitPolicy":-1}`, nil, nil, true},
+		{"fail json", `[]`, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *PolicyConstraints
+			err := json.Unmarshal([]byte(tt.data), &got)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			b, err := json.Marshal(got)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.data, string(b))
+
+			cert := new(x509.Certificate)
+			got.Set(cert)
+			assert.Equal(t, []pkix.Extension{
+				{Id: oidExtensionPolicyConstraints, Critical: true, Value: tt.wantDER},
+			}, cert.ExtraExtensions)
+
+			parsed, err := parsePolicyConstraints(tt.wantDER)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, parsed)
+		})
+	}
+}
+
+func TestInhibitAnyPolicy(t *testing.T) {
+	var got *InhibitAnyPolicy
+	require.NoError(t, json.Unmarshal([]byte(`0`), &got))
+	require.NotNil(t, got)
+	assert.Equal(t, InhibitAnyPolicy(0), *got)
+
+	b, err := json.Marshal(got)
+	require.NoError(t, err)
+	assert.Equal(t, `0`, string(b))
+
+	cert := new(x509.Certificate)
+	got.Set(cert)
+	assert.Equal(t, []pkix.Extension{
+		{Id: oidExtensionInhibitAnyPolicy, Critical: true, Value: []byte{0x02, 0x01, 0x00}},
+	}, cert.ExtraExtensions)
+
+	parsed, err := parseInhibitAnyPolicy([]byte{0x02, 0x01, 0x03})
+	require.NoError(t, err)
+	assert.Equal(t, InhibitAnyPolicy(3), *parsed)
+
+	assert.Error(t, json.Unmarshal([]byte(`-1`), &got))
+	assert.Error(t, json.Unmarshal([]byte(`"1"`), &got))
+}
+
+func TestCertificate_GetCertificate_policies(t *testing.T) {
+	var c Certificate
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"policyIdentifiers": ["1.2.3.4"],
+		"certificatePolicies": [{"id": "2.23.140.1.2.1", "qualifiers": [{"cps": "https://smallstep.com/cps"}]}],
+		"policyMappings": [{"issuerDomainPolicy": "1.2.3.4", "subjectDomainPolicy": "2.23.140.1.2.1"}],
+		"policyConstraints": {"requireExplicitPolicy": 0},
+		"inhibitAnyPolicy": 0,
+		"extensions": [{"id": "2.5.29.54", "critical": true, "value": "AgEB"}]
+	}`), &c))
+
+	cert := c.GetCertificate()
+	assert.Equal(t, []asn1.ObjectIdentifier{{1, 2, 3, 4}}, cert.PolicyIdentifiers)
+
+	exts := make(map[string]pkix.Extension)
+	for _, e := range cert.ExtraExtensions {
+		_, ok := exts[e.Id.String()]
+		require.False(t, ok, "duplicated extension %s", e.Id)
+		exts[e.Id.String()] = e
+	}
+	require.Len(t, exts, 4)
+
+	policies, err := parseCertificatePolicies(exts["2.5.29.32"].Value)
+	require.NoError(t, err)
+	assert.Equal(t, CertificatePolicies{
+		{ID: ObjectIdentifier{2, 23, 140, 1, 2, 1}, Qualifiers: []PolicyQualifier{{CPS: "https://smallstep.com/cps"}}},
+		{ID: ObjectIdentifier{1, 2, 3, 4}},
+	}, policies)
+	assert.True(t, exts["2.5.29.33"].Critical)
+	assert.True(t, exts["2.5.29.36"].Critical)
+	// The custom extension takes precedence.
+	assert.Equal(t, []byte{0x02, 0x01, 0x01}, exts["2.5.29.54"].Value)
+}